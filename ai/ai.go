@@ -0,0 +1,173 @@
+// Package ai wraps the generative AI backend the bot talks to behind an
+// interface, so the Discord side can be tested with a fake.
+package ai
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Client is the AI backend used by the bot
+type Client interface {
+	// NewChat starts a multi-turn conversation
+	NewChat() Chat
+
+	// Generate sends a one-off prompt, outside of any chat, and returns the reply
+	Generate(ctx context.Context, parts ...genai.Part) (*Reply, error)
+
+	// GenerateJSON sends a one-off prompt and returns a reply whose text is
+	// JSON matching schema, or any JSON when schema is nil
+	GenerateJSON(ctx context.Context, schema *genai.Schema, parts ...genai.Part) (*Reply, error)
+
+	// GenerateStream sends a one-off prompt, calling onText with each piece
+	// of the answer's text as it arrives, and returns the whole reply
+	GenerateStream(ctx context.Context, onText func(text string), parts ...genai.Part) (*Reply, error)
+
+	// CountTokens returns the number of tokens the parts take up
+	CountTokens(ctx context.Context, parts ...genai.Part) (int, error)
+
+	// EmbedDocuments embeds texts that will be searched later
+	EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error)
+
+	// EmbedQuery embeds a search query
+	EmbedQuery(ctx context.Context, query string) ([]float32, error)
+
+	// UploadFile uploads a file for use in prompts, waiting until it is ready
+	UploadFile(ctx context.Context, data []byte, mimeType string, displayName string) (genai.Part, error)
+
+	// GenerateImages generates up to count images from a prompt
+	GenerateImages(ctx context.Context, prompt string, count int, strictSafety bool) ([]Image, error)
+
+	// EditImage edits images following an instruction, returning the reply
+	// with any text the model wrote along with the edited images
+	EditImage(ctx context.Context, images []Image, instruction string) (*Reply, []Image, error)
+
+	// Speak converts text to speech, returning a WAV file
+	Speak(ctx context.Context, text string) ([]byte, error)
+}
+
+// Backend is a Client the bot owns, which can also cache context shared by
+// every chat
+type Backend interface {
+	Client
+
+	// CacheContext caches documents and instructions for chats to reference
+	CacheContext(ctx context.Context, paths []string, instructions string, model string) error
+
+	// Close releases the backend's resources
+	Close() error
+
+	ModelSwitcher
+}
+
+// ModelSwitcher is a client whose chat model can change while the bot runs
+type ModelSwitcher interface {
+	// Model returns the name of the chat model
+	Model() string
+
+	// SetModel switches the chat model, for requests started afterwards
+	SetModel(name string)
+}
+
+// chatModel is the name of a backend's chat model, which a configuration
+// reload can change while requests are running
+type chatModel struct {
+	name atomic.Pointer[string]
+}
+
+// Model returns the name of the chat model
+func (m *chatModel) Model() string {
+	if name := m.name.Load(); name != nil {
+		return *name
+	}
+	return ""
+}
+
+// SetModel switches the chat model, for requests started afterwards
+func (m *chatModel) SetModel(name string) {
+	m.name.Store(&name)
+}
+
+// New creates the mock backend when requested, the Vertex AI backend when a
+// Vertex project is configured, and the Gemini API backend otherwise
+func New(ctx context.Context, opts Options) (Backend, error) {
+	if opts.Mock {
+		return NewMock(opts), nil
+	}
+	if opts.VertexProject != "" {
+		return NewVertex(ctx, opts)
+	}
+	return NewGemini(ctx, opts)
+}
+
+// Chat is a multi-turn conversation
+type Chat interface {
+	// Send sends a message and returns the model's reply
+	Send(ctx context.Context, parts ...genai.Part) (*Reply, error)
+
+	// History returns the conversation so far
+	History() []*genai.Content
+
+	// SetHistory replaces the conversation so far
+	SetHistory(history []*genai.Content)
+}
+
+// RequestOptions change how requests made with a context are answered, such
+// as those of a server that chose its own model
+type RequestOptions struct {
+	// Model answering instead of the backend's current one
+	Model string
+
+	// Safety blocks responses rated at least this harmful: "low", "medium"
+	// or "high"; empty blocks nothing, as requests without options
+	Safety string
+
+	// Most tokens the answer may take, 0 for the model's limit
+	MaxOutputTokens int
+}
+
+// requestOptionsKey is the context key of RequestOptions
+type requestOptionsKey struct{}
+
+// WithRequestOptions returns a context whose requests use opts
+func WithRequestOptions(ctx context.Context, opts RequestOptions) context.Context {
+	return context.WithValue(ctx, requestOptionsKey{}, opts)
+}
+
+// requestOptions returns the options of a context's requests
+func requestOptions(ctx context.Context) RequestOptions {
+	opts, _ := ctx.Value(requestOptionsKey{}).(RequestOptions)
+	return opts
+}
+
+// model returns the model a request answers with, fallback unless overridden
+func (o RequestOptions) model(fallback string) string {
+	if o.Model != "" {
+		return o.Model
+	}
+	return fallback
+}
+
+// Reply is the model's answer to a prompt or chat message
+type Reply struct {
+	Text          string
+	FunctionCalls []genai.FunctionCall
+
+	// Model that answered and the tokens the exchange used
+	Model          string
+	PromptTokens   int
+	ResponseTokens int
+
+	// Why the model stopped, such as "STOP" or "SAFETY", and the harm
+	// categories it rated at least medium probability, like "HARASSMENT: HIGH"
+	FinishReason string
+	SafetyFlags  []string
+}
+
+// Image is an image sent to or returned by the model
+type Image struct {
+	MIMEType string
+	Data     []byte
+}
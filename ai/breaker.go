@@ -0,0 +1,262 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/googleapi"
+
+	"go-discord-bot/metrics"
+)
+
+// ErrUnavailable is returned without calling the model while its circuit
+// breaker is open, after a run of failed requests
+var ErrUnavailable = errors.New("the AI is temporarily unavailable, please try again in a few minutes")
+
+// States of a circuit breaker, as exported by the circuit breaker metric
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breakerClient stops calling a provider that keeps failing: after threshold
+// failed requests in a row it opens, failing requests at once with
+// ErrUnavailable. Once cooldown has passed it half-opens, letting a single
+// request through to probe whether the provider recovered, which closes it
+// again on success and reopens it for another cooldown on failure.
+type breakerClient struct {
+	Client
+
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker wraps the client of the named provider in a circuit breaker
+// opening after threshold failed requests in a row, for cooldown between
+// probes. A threshold of 0 disables it.
+func NewBreaker(client Client, name string, threshold int, cooldown time.Duration) Client {
+	if threshold <= 0 {
+		return client
+	}
+	metrics.CircuitBreakerState.WithLabelValues(name).Set(breakerClosed)
+	return &breakerClient{Client: client, name: name, threshold: threshold, cooldown: cooldown}
+}
+
+// BreakerOpen reports whether a client's circuit breaker is open or probing
+// after an outage, and false for clients without one
+func BreakerOpen(client Client) bool {
+	b, ok := client.(*breakerClient)
+	if !ok {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != breakerClosed
+}
+
+// allow reports whether a request may call the provider, half-opening the
+// breaker for a probe once the cooldown has passed
+func (b *breakerClient) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		b.setState(breakerHalfOpen)
+	}
+	switch {
+	case b.state == breakerClosed:
+		return nil
+	case b.state == breakerHalfOpen && !b.probing:
+		b.probing = true
+		return nil
+	default:
+		metrics.RateLimitRejections.WithLabelValues("circuit_breaker").Inc()
+		return ErrUnavailable
+	}
+}
+
+// record counts the outcome of a request allow let through
+func (b *breakerClient) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen && b.probing {
+		b.probing = false
+		switch {
+		case errors.Is(err, context.Canceled):
+			// The probe was abandoned, the next request probes instead
+		case outage(err):
+			b.open()
+		default:
+			b.failures = 0
+			b.setState(breakerClosed)
+		}
+		return
+	}
+	if !outage(err) {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == breakerClosed && b.failures >= b.threshold {
+		b.open()
+	}
+}
+
+// open starts a cooldown during which requests fail at once
+func (b *breakerClient) open() {
+	b.openedAt = time.Now()
+	b.setState(breakerOpen)
+	metrics.CircuitBreakerTrips.WithLabelValues(b.name).Inc()
+}
+
+// setState changes the breaker's state, exporting it
+func (b *breakerClient) setState(state int) {
+	b.state = state
+	metrics.CircuitBreakerState.WithLabelValues(b.name).Set(float64(state))
+}
+
+// outage reports whether a request's error suggests the provider is down,
+// rather than the request being abandoned, refused by the bot, or rejected
+// for its content
+func outage(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrBusy) ||
+		errors.Is(err, ErrUnsupported) || errors.Is(err, ErrUnavailable) {
+		return false
+	}
+	var blocked *genai.BlockedError
+	if errors.As(err, &blocked) {
+		return false
+	}
+	// Client errors other than running out of quota are the request's fault
+	code := 0
+	var apiErr *googleapi.Error
+	var statusErr *statusError
+	if errors.As(err, &apiErr) {
+		code = apiErr.Code
+	} else if errors.As(err, &statusErr) {
+		code = statusErr.code
+	}
+	return code < 400 || code >= 500 || code == http.StatusTooManyRequests
+}
+
+func (b *breakerClient) NewChat() Chat {
+	return &breakerChat{Chat: b.Client.NewChat(), breaker: b}
+}
+
+func (b *breakerClient) Generate(ctx context.Context, parts ...genai.Part) (*Reply, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	reply, err := b.Client.Generate(ctx, parts...)
+	b.record(err)
+	return reply, err
+}
+
+func (b *breakerClient) GenerateJSON(ctx context.Context, schema *genai.Schema, parts ...genai.Part) (*Reply, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	reply, err := b.Client.GenerateJSON(ctx, schema, parts...)
+	b.record(err)
+	return reply, err
+}
+
+func (b *breakerClient) GenerateStream(ctx context.Context, onText func(text string), parts ...genai.Part) (*Reply, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	reply, err := b.Client.GenerateStream(ctx, onText, parts...)
+	b.record(err)
+	return reply, err
+}
+
+func (b *breakerClient) CountTokens(ctx context.Context, parts ...genai.Part) (int, error) {
+	if err := b.allow(); err != nil {
+		return 0, err
+	}
+	n, err := b.Client.CountTokens(ctx, parts...)
+	b.record(err)
+	return n, err
+}
+
+func (b *breakerClient) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	vectors, err := b.Client.EmbedDocuments(ctx, texts)
+	b.record(err)
+	return vectors, err
+}
+
+func (b *breakerClient) EmbedQuery(ctx context.Context, query string) ([]float32, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	vector, err := b.Client.EmbedQuery(ctx, query)
+	b.record(err)
+	return vector, err
+}
+
+func (b *breakerClient) UploadFile(ctx context.Context, data []byte, mimeType string, displayName string) (genai.Part, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	part, err := b.Client.UploadFile(ctx, data, mimeType, displayName)
+	b.record(err)
+	return part, err
+}
+
+func (b *breakerClient) GenerateImages(ctx context.Context, prompt string, count int, strictSafety bool) ([]Image, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	images, err := b.Client.GenerateImages(ctx, prompt, count, strictSafety)
+	b.record(err)
+	return images, err
+}
+
+func (b *breakerClient) EditImage(ctx context.Context, images []Image, instruction string) (*Reply, []Image, error) {
+	if err := b.allow(); err != nil {
+		return nil, nil, err
+	}
+	reply, edited, err := b.Client.EditImage(ctx, images, instruction)
+	b.record(err)
+	return reply, edited, err
+}
+
+func (b *breakerClient) Speak(ctx context.Context, text string) ([]byte, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	audio, err := b.Client.Speak(ctx, text)
+	b.record(err)
+	return audio, err
+}
+
+// breakerChat is a Chat whose messages go through a breakerClient
+type breakerChat struct {
+	Chat
+	breaker *breakerClient
+}
+
+func (c *breakerChat) Send(ctx context.Context, parts ...genai.Part) (*Reply, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	reply, err := c.Chat.Send(ctx, parts...)
+	c.breaker.record(err)
+	return reply, err
+}
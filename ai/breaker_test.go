@@ -0,0 +1,78 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// flakyClient fails Generate with err, counting the calls that reach it
+type flakyClient struct {
+	Client
+	err   error
+	calls int
+}
+
+func (c *flakyClient) Generate(context.Context, ...genai.Part) (*Reply, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &Reply{Text: "ok"}, nil
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	inner := &flakyClient{err: errors.New("connection refused")}
+	client := NewBreaker(inner, "test", 2, time.Hour)
+	ctx := context.Background()
+
+	for range 2 {
+		client.Generate(ctx)
+	}
+	if !BreakerOpen(client) {
+		t.Fatal("breaker still closed after 2 failures")
+	}
+	if _, err := client.Generate(ctx); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Generate while open = %v, want ErrUnavailable", err)
+	}
+	if inner.calls != 2 {
+		t.Errorf("%d calls reached the client, want 2", inner.calls)
+	}
+}
+
+func TestBreakerProbesAfterCooldown(t *testing.T) {
+	inner := &flakyClient{err: errors.New("connection refused")}
+	client := NewBreaker(inner, "test", 1, 10*time.Millisecond)
+	ctx := context.Background()
+
+	client.Generate(ctx)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := client.Generate(ctx); errors.Is(err, ErrUnavailable) {
+		t.Fatal("probe after the cooldown was short-circuited")
+	}
+	if !BreakerOpen(client) {
+		t.Fatal("breaker closed after a failed probe")
+	}
+
+	inner.err = nil
+	time.Sleep(20 * time.Millisecond)
+	if _, err := client.Generate(ctx); err != nil {
+		t.Fatalf("probe = %v, want success", err)
+	}
+	if BreakerOpen(client) {
+		t.Error("breaker still open after a successful probe")
+	}
+}
+
+func TestBreakerIgnoresRefusedRequests(t *testing.T) {
+	inner := &flakyClient{err: ErrBusy}
+	client := NewBreaker(inner, "test", 1, time.Hour)
+
+	client.Generate(context.Background())
+	if BreakerOpen(client) {
+		t.Error("breaker opened on a request the bot refused")
+	}
+}
@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mime"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// How long the context cache lives without being refreshed
+const contextCacheTTL = time.Hour
+
+// CacheContext uploads documents and a persona once, caching them
+// server-side so chats reference them instead of resending them every turn.
+// model must be a pinned model version rather than a "-latest" alias.
+// Calling it again replaces the cache, and with nothing to cache removes it.
+func (g *Gemini) CacheContext(ctx context.Context, paths []string, instructions string, model string) error {
+	if len(paths) == 0 && instructions == "" {
+		g.cacheMu.Lock()
+		g.cache = nil
+		g.cacheMu.Unlock()
+		return nil
+	}
+
+	var parts []genai.Part
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", path, err)
+		}
+		// Cached content and its files live in the primary key's project
+		part, err := g.uploadFile(ctx, g.keys.primary(), data, mime.TypeByExtension(filepath.Ext(path)), filepath.Base(path))
+		if err != nil {
+			return fmt.Errorf("error uploading %s: %v", path, err)
+		}
+		parts = append(parts, part)
+	}
+
+	// Models using cached content take their tools from the cache
+	cc := &genai.CachedContent{
+		Model:      model,
+		Expiration: genai.ExpireTimeOrTTL{TTL: contextCacheTTL},
+		Tools:      g.opts.ChatTools,
+	}
+	if len(parts) > 0 {
+		cc.Contents = []*genai.Content{{Role: "user", Parts: parts}}
+	}
+	if instructions != "" {
+		cc.SystemInstruction = genai.NewUserContent(genai.Text(instructions))
+	}
+
+	cached, err := g.keys.primary().client.CreateCachedContent(ctx, cc)
+	if err != nil {
+		return fmt.Errorf("error creating cached content: %v", err)
+	}
+	g.cacheMu.Lock()
+	g.cache = cached
+	g.cacheMu.Unlock()
+	slog.Info("Cached context", "name", cached.Name, "model", model, "documents", len(parts))
+
+	g.refreshCache.Do(func() { go g.refreshContextCache(ctx) })
+	return nil
+}
+
+// refreshContextCache keeps extending the cache's expiry while the bot runs
+func (g *Gemini) refreshContextCache(ctx context.Context) {
+	for range time.Tick(contextCacheTTL / 2) {
+		g.cacheMu.Lock()
+		cached := g.cache
+		g.cacheMu.Unlock()
+		if cached == nil {
+			continue
+		}
+
+		updated, err := g.keys.primary().client.UpdateCachedContent(ctx, cached, &genai.CachedContentToUpdate{
+			Expiration: &genai.ExpireTimeOrTTL{TTL: contextCacheTTL},
+		})
+		if err != nil {
+			slog.Error("Error refreshing cached context", "error", err)
+			continue
+		}
+		// Keep a cache that was replaced meanwhile
+		g.cacheMu.Lock()
+		if g.cache == cached {
+			g.cache = updated
+		}
+		g.cacheMu.Unlock()
+	}
+}
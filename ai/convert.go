@@ -0,0 +1,170 @@
+package ai
+
+import (
+	"encoding/base64"
+	"log/slog"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Schema type names used by the REST API
+var restTypes = map[genai.Type]string{
+	genai.TypeString:  "STRING",
+	genai.TypeNumber:  "NUMBER",
+	genai.TypeInteger: "INTEGER",
+	genai.TypeBoolean: "BOOLEAN",
+	genai.TypeArray:   "ARRAY",
+	genai.TypeObject:  "OBJECT",
+}
+
+// Schema type names used by JSON Schema
+var jsonSchemaTypes = map[genai.Type]string{
+	genai.TypeString:  "string",
+	genai.TypeNumber:  "number",
+	genai.TypeInteger: "integer",
+	genai.TypeBoolean: "boolean",
+	genai.TypeArray:   "array",
+	genai.TypeObject:  "object",
+}
+
+// toRESTContents converts SDK contents to their REST form
+func toRESTContents(contents []*genai.Content) []restContent {
+	converted := make([]restContent, 0, len(contents))
+	for _, content := range contents {
+		converted = append(converted, restContent{Role: content.Role, Parts: toRESTParts(content.Parts)})
+	}
+	return converted
+}
+
+// toRESTParts converts SDK parts to their REST form, leaving out kinds the
+// bot never sends
+func toRESTParts(parts []genai.Part) []restPart {
+	var converted []restPart
+	for _, part := range parts {
+		switch p := part.(type) {
+		case genai.Text:
+			converted = append(converted, restPart{Text: string(p)})
+		case genai.Blob:
+			converted = append(converted, restPart{InlineData: &restBlob{
+				MIMEType: p.MIMEType,
+				Data:     base64.StdEncoding.EncodeToString(p.Data),
+			}})
+		case genai.FileData:
+			converted = append(converted, restPart{FileData: &restFileData{MIMEType: p.MIMEType, FileURI: p.URI}})
+		case genai.FunctionCall:
+			converted = append(converted, restPart{FunctionCall: &restFunctionCall{Name: p.Name, Args: p.Args}})
+		case genai.FunctionResponse:
+			converted = append(converted, restPart{FunctionResponse: &restFunctionResponse{Name: p.Name, Response: p.Response}})
+		default:
+			slog.Warn("Dropping unsupported part from REST request", "part", part)
+		}
+	}
+	return converted
+}
+
+// fromRESTParts converts REST parts back to SDK parts
+func fromRESTParts(parts []restPart) []genai.Part {
+	var converted []genai.Part
+	for _, part := range parts {
+		switch {
+		case part.FunctionCall != nil:
+			converted = append(converted, genai.FunctionCall{Name: part.FunctionCall.Name, Args: part.FunctionCall.Args})
+		case part.InlineData != nil:
+			data, err := base64.StdEncoding.DecodeString(part.InlineData.Data)
+			if err != nil {
+				slog.Error("Error decoding inline data", "error", err)
+				continue
+			}
+			converted = append(converted, genai.Blob{MIMEType: part.InlineData.MIMEType, Data: data})
+		case part.Text != "":
+			converted = append(converted, genai.Text(part.Text))
+		}
+	}
+	return converted
+}
+
+// toRESTSchema converts an SDK schema to its REST form
+func toRESTSchema(schema *genai.Schema) map[string]any {
+	return convertSchema(schema, restTypes)
+}
+
+// toJSONSchema converts an SDK schema to JSON Schema, as used by
+// OpenAI-compatible APIs
+func toJSONSchema(schema *genai.Schema) map[string]any {
+	return convertSchema(schema, jsonSchemaTypes)
+}
+
+// convertSchema converts an SDK schema to a JSON object naming types with
+// typeNames
+func convertSchema(schema *genai.Schema, typeNames map[genai.Type]string) map[string]any {
+	if schema == nil {
+		return nil
+	}
+	converted := map[string]any{"type": typeNames[schema.Type]}
+	if schema.Format != "" {
+		converted["format"] = schema.Format
+	}
+	if schema.Description != "" {
+		converted["description"] = schema.Description
+	}
+	if schema.Nullable {
+		converted["nullable"] = true
+	}
+	if len(schema.Enum) > 0 {
+		converted["enum"] = schema.Enum
+	}
+	if schema.Items != nil {
+		converted["items"] = convertSchema(schema.Items, typeNames)
+	}
+	if len(schema.Properties) > 0 {
+		properties := map[string]any{}
+		for name, property := range schema.Properties {
+			properties[name] = convertSchema(property, typeNames)
+		}
+		converted["properties"] = properties
+	}
+	if len(schema.Required) > 0 {
+		converted["required"] = schema.Required
+	}
+	return converted
+}
+
+// toRESTTools converts SDK tools to their REST form
+func toRESTTools(tools []*genai.Tool) []map[string]any {
+	var converted []map[string]any
+	for _, tool := range tools {
+		var declarations []map[string]any
+		for _, fn := range tool.FunctionDeclarations {
+			declarations = append(declarations, map[string]any{
+				"name":        fn.Name,
+				"description": fn.Description,
+				"parameters":  toRESTSchema(fn.Parameters),
+			})
+		}
+		converted = append(converted, map[string]any{"functionDeclarations": declarations})
+	}
+	return converted
+}
+
+// toSDKResponse converts a REST generateContent response to the SDK's form
+func (r *restGenerateResponse) toSDKResponse() *genai.GenerateContentResponse {
+	resp := &genai.GenerateContentResponse{UsageMetadata: &genai.UsageMetadata{
+		PromptTokenCount:     r.UsageMetadata.PromptTokenCount,
+		CandidatesTokenCount: r.UsageMetadata.CandidatesTokenCount,
+	}}
+	for _, cand := range r.Candidates {
+		converted := &genai.Candidate{
+			Content:      &genai.Content{Role: "model", Parts: fromRESTParts(cand.Content.Parts)},
+			FinishReason: parseEnum[genai.FinishReason](cand.FinishReason, "FinishReason"),
+		}
+		for _, rating := range cand.SafetyRatings {
+			converted.SafetyRatings = append(converted.SafetyRatings, &genai.SafetyRating{
+				Category:    parseEnum[genai.HarmCategory](strings.TrimPrefix(rating.Category, "HARM_CATEGORY_"), "HarmCategory"),
+				Probability: parseEnum[genai.HarmProbability](rating.Probability, "HarmProbability"),
+			})
+		}
+		resp.Candidates = append(resp.Candidates, converted)
+	}
+	return resp
+}
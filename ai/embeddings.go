@@ -0,0 +1,62 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// Gemini embeddings model used for retrieval
+	embeddingModelName = "text-embedding-004"
+
+	// Texts per batch embedding request (the API's limit)
+	maxEmbeddingBatch = 100
+)
+
+// EmbedDocuments embeds texts that will be searched later
+func (g *Gemini) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	var vectors [][]float32
+	for start := 0; start < len(texts); start += maxEmbeddingBatch {
+		var resp *genai.BatchEmbedContentsResponse
+		err := g.keys.do(nil, func(k *apiKey) (err error) {
+			model := k.client.EmbeddingModel(embeddingModelName)
+			model.TaskType = genai.TaskTypeRetrievalDocument
+			batch := model.NewBatch()
+			for _, text := range texts[start:min(start+maxEmbeddingBatch, len(texts))] {
+				batch.AddContent(genai.Text(text))
+			}
+			requestStart := time.Now()
+			resp, err = model.BatchEmbedContents(ctx, batch)
+			observeRequest(embeddingModelName, requestStart, err)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error embedding documents: %v", err)
+		}
+		for _, embedding := range resp.Embeddings {
+			vectors = append(vectors, embedding.Values)
+		}
+	}
+	return vectors, nil
+}
+
+// EmbedQuery embeds a search query
+func (g *Gemini) EmbedQuery(ctx context.Context, query string) ([]float32, error) {
+	var resp *genai.EmbedContentResponse
+	err := g.keys.do(nil, func(k *apiKey) (err error) {
+		model := k.client.EmbeddingModel(embeddingModelName)
+		model.TaskType = genai.TaskTypeRetrievalQuery
+
+		start := time.Now()
+		resp, err = model.EmbedContent(ctx, genai.Text(query))
+		observeRequest(embeddingModelName, start, err)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error embedding query: %v", err)
+	}
+	return resp.Embedding.Values, nil
+}
@@ -0,0 +1,55 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/metrics"
+)
+
+// UploadFile uploads a file to the Gemini File API and returns the part
+// referencing it once it has been processed
+func (g *Gemini) UploadFile(ctx context.Context, data []byte, mimeType string, displayName string) (part genai.Part, err error) {
+	err = g.keys.do(nil, func(k *apiKey) (err error) {
+		part, err = g.uploadFile(ctx, k, data, mimeType, displayName)
+		return err
+	})
+	return part, err
+}
+
+// uploadFile uploads a file with a given API key, which prompts
+// referencing the file must then use
+func (g *Gemini) uploadFile(ctx context.Context, k *apiKey, data []byte, mimeType string, displayName string) (part genai.Part, err error) {
+	defer func() { metrics.FileUploads.WithLabelValues(metrics.Outcome(err)).Inc() }()
+
+	uploaded, err := k.client.UploadFile(ctx, "", bytes.NewReader(data), &genai.UploadFileOptions{
+		DisplayName: displayName,
+		MIMEType:    mimeType,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error uploading file: %w", err)
+	}
+	g.keys.addFile(uploaded.URI, k)
+	return waitForFile(ctx, k, uploaded.Name)
+}
+
+// waitForFile waits until an uploaded file has been processed and returns
+// the part referencing it
+func waitForFile(ctx context.Context, k *apiKey, name string) (genai.Part, error) {
+	// Wait for processing (simple polling)
+	for {
+		file, err := k.client.GetFile(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("error checking file status: %v", err)
+		}
+		if file.State == genai.FileStateActive {
+			return genai.FileData{MIMEType: file.MIMEType, URI: file.URI}, nil
+		}
+		// Simple delay between checks
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,350 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+
+	"go-discord-bot/metrics"
+)
+
+// Options configures the Gemini client
+type Options struct {
+	// API keys requests rotate between
+	APIKeys []string
+
+	// Model used for chat and one-off prompts, until changed with SetModel
+	Model string
+
+	// Image-output model used by EditImage
+	ImageEditModel string
+
+	// Prebuilt voice used by Speak
+	TTSVoice string
+
+	// Tools chat sessions may call
+	ChatTools []*genai.Tool
+
+	// Base URL of the Gemini API, when not https://generativelanguage.googleapis.com
+	BaseURL string
+
+	// Google Cloud project and location used by the Vertex AI backend
+	VertexProject  string
+	VertexLocation string
+
+	// Replaces the model with the deterministic Mock backend, which waits
+	// MockDelay before answering and fails every MockFailEvery-th request
+	Mock          bool
+	MockDelay     time.Duration
+	MockFailEvery int
+}
+
+// Gemini is the Client backed by the Google Gemini API
+type Gemini struct {
+	restAPI
+	chatModel
+	keys *keyRing
+
+	// Cached context shared by all chats, nil when none is configured
+	cacheMu      sync.Mutex
+	cache        *genai.CachedContent
+	refreshCache sync.Once
+}
+
+// Gemini must implement Client
+var _ Client = (*Gemini)(nil)
+
+// NewGemini creates a Gemini client
+func NewGemini(ctx context.Context, opts Options) (*Gemini, error) {
+	var clientOpts []option.ClientOption
+	base := geminiAPIBase
+	if opts.BaseURL != "" {
+		endpoint := strings.TrimSuffix(opts.BaseURL, "/")
+		clientOpts = append(clientOpts, option.WithEndpoint(endpoint))
+		base = endpoint + "/v1beta/"
+	}
+	keys, err := newKeyRing(ctx, opts.APIKeys, clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+	g := &Gemini{keys: keys}
+	g.restAPI = restAPI{opts: opts, base: base, send: g.send}
+	g.SetModel(opts.Model)
+	return g, nil
+}
+
+// send posts a REST request with the next API key
+func (g *Gemini) send(ctx context.Context, url string, payload []byte) (body []byte, err error) {
+	err = g.keys.do(nil, func(k *apiKey) error {
+		body, err = sendRequest(ctx, http.DefaultClient, url, k.key, payload)
+		return err
+	})
+	return body, err
+}
+
+// Close closes the underlying clients
+func (g *Gemini) Close() error {
+	return g.keys.close()
+}
+
+// model returns a model using a key's client with the safety settings of a
+// request's options
+func (g *Gemini) model(k *apiKey, opts RequestOptions) *genai.GenerativeModel {
+	model := k.client.GenerativeModel(opts.model(g.Model()))
+	model.SafetySettings = safetySettings(opts.Safety)
+	if opts.MaxOutputTokens > 0 {
+		model.SetMaxOutputTokens(int32(opts.MaxOutputTokens))
+	}
+	return model
+}
+
+// NewChat starts a chat session, which can call the chat tools and
+// references the cached context when there is one
+func (g *Gemini) NewChat() Chat {
+	g.cacheMu.Lock()
+	cached := g.cache
+	g.cacheMu.Unlock()
+
+	return &geminiChat{gemini: g, cached: cached}
+}
+
+// Generate sends a one-off prompt and returns the reply
+func (g *Gemini) Generate(ctx context.Context, parts ...genai.Part) (*Reply, error) {
+	opts := requestOptions(ctx)
+	var resp *genai.GenerateContentResponse
+	err := g.keys.do([]*genai.Content{genai.NewUserContent(parts...)}, func(k *apiKey) (err error) {
+		start := time.Now()
+		resp, err = g.model(k, opts).GenerateContent(ctx, parts...)
+		observeResponse(opts.model(g.Model()), start, resp, err)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newReply(opts.model(g.Model()), resp), nil
+}
+
+// GenerateJSON sends a one-off prompt and returns a reply whose text is JSON
+// matching schema, or any JSON when schema is nil
+func (g *Gemini) GenerateJSON(ctx context.Context, schema *genai.Schema, parts ...genai.Part) (*Reply, error) {
+	opts := requestOptions(ctx)
+	var resp *genai.GenerateContentResponse
+	err := g.keys.do([]*genai.Content{genai.NewUserContent(parts...)}, func(k *apiKey) (err error) {
+		model := g.model(k, opts)
+		model.ResponseMIMEType = "application/json"
+		model.ResponseSchema = schema
+
+		start := time.Now()
+		resp, err = model.GenerateContent(ctx, parts...)
+		observeResponse(opts.model(g.Model()), start, resp, err)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newReply(opts.model(g.Model()), resp), nil
+}
+
+// GenerateStream sends a one-off prompt, calling onText with each piece of
+// the answer's text as it arrives, and returns the whole reply
+func (g *Gemini) GenerateStream(ctx context.Context, onText func(text string), parts ...genai.Part) (*Reply, error) {
+	opts := requestOptions(ctx)
+	var resp *genai.GenerateContentResponse
+	err := g.keys.do([]*genai.Content{genai.NewUserContent(parts...)}, func(k *apiKey) error {
+		start := time.Now()
+		iter := g.model(k, opts).GenerateContentStream(ctx, parts...)
+		for {
+			chunk, err := iter.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				observeResponse(opts.model(g.Model()), start, nil, err)
+				return err
+			}
+			if text := responseText(chunk); text != "" {
+				onText(text)
+			}
+		}
+		resp = iter.MergedResponse()
+		if resp == nil {
+			resp = &genai.GenerateContentResponse{}
+		}
+		observeResponse(opts.model(g.Model()), start, resp, nil)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newReply(opts.model(g.Model()), resp), nil
+}
+
+// CountTokens returns the number of tokens the parts take up
+func (g *Gemini) CountTokens(ctx context.Context, parts ...genai.Part) (int, error) {
+	var resp *genai.CountTokensResponse
+	err := g.keys.do([]*genai.Content{genai.NewUserContent(parts...)}, func(k *apiKey) (err error) {
+		resp, err = g.model(k, requestOptions(ctx)).CountTokens(ctx, parts...)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.TotalTokens), nil
+}
+
+// geminiChat is a Chat backed by Gemini. Each message may be sent with a
+// different API key, so the chat keeps the history itself.
+type geminiChat struct {
+	gemini  *Gemini
+	cached  *genai.CachedContent
+	history []*genai.Content
+}
+
+// model returns the name of the model answering the chat's requests with
+// options. Only chats keeping the backend's model use the cached context.
+func (c *geminiChat) model(opts RequestOptions) string {
+	if c.cached != nil && opts.Model == "" {
+		return c.cached.Model
+	}
+	return opts.model(c.gemini.Model())
+}
+
+// Send sends a message and returns the model's reply
+func (c *geminiChat) Send(ctx context.Context, parts ...genai.Part) (*Reply, error) {
+	opts := requestOptions(ctx)
+	var resp *genai.GenerateContentResponse
+	request := func(k *apiKey) (err error) {
+		session := c.session(k, opts)
+		start := time.Now()
+		resp, err = session.SendMessage(ctx, parts...)
+		observeResponse(c.model(opts), start, resp, err)
+		if err == nil {
+			c.history = session.History
+		}
+		return err
+	}
+
+	var err error
+	if c.cached != nil && opts.Model == "" {
+		// Cached content only exists in the project that created it
+		err = request(c.gemini.keys.primary())
+	} else {
+		contents := append(c.History(), genai.NewUserContent(parts...))
+		err = c.gemini.keys.do(contents, request)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newReply(c.model(opts), resp), nil
+}
+
+// session returns a chat session using a key's client, continuing the history
+func (c *geminiChat) session(k *apiKey, opts RequestOptions) *genai.ChatSession {
+	var model *genai.GenerativeModel
+	if c.cached == nil || opts.Model != "" {
+		model = c.gemini.model(k, opts)
+		model.Tools = c.gemini.opts.ChatTools
+	} else {
+		// Models using cached content take their tools from the cache
+		model = k.client.GenerativeModelFromCachedContent(c.cached)
+		model.SafetySettings = safetySettings(opts.Safety)
+		if opts.MaxOutputTokens > 0 {
+			model.SetMaxOutputTokens(int32(opts.MaxOutputTokens))
+		}
+	}
+	session := model.StartChat()
+	session.History = append([]*genai.Content(nil), c.history...)
+	return session
+}
+
+// History returns the conversation so far
+func (c *geminiChat) History() []*genai.Content {
+	return c.history
+}
+
+// SetHistory replaces the conversation so far
+func (c *geminiChat) SetHistory(history []*genai.Content) {
+	c.history = history
+}
+
+// newReply builds a Reply from a Gemini response
+func newReply(model string, resp *genai.GenerateContentResponse) *Reply {
+	reply := &Reply{Text: responseText(resp), Model: model}
+	if resp.UsageMetadata != nil {
+		reply.PromptTokens = int(resp.UsageMetadata.PromptTokenCount)
+		reply.ResponseTokens = int(resp.UsageMetadata.CandidatesTokenCount)
+	}
+	for _, cand := range resp.Candidates {
+		reply.FunctionCalls = append(reply.FunctionCalls, cand.FunctionCalls()...)
+	}
+	reply.setSafety(resp)
+	return reply
+}
+
+// responseText joins the text of every candidate in a Gemini response
+func responseText(resp *genai.GenerateContentResponse) string {
+	var text string
+	for _, cand := range resp.Candidates {
+		if cand.Content == nil {
+			continue
+		}
+		for _, part := range cand.Content.Parts {
+			if t, ok := part.(genai.Text); ok {
+				text += fmt.Sprint(t)
+			}
+		}
+	}
+	return text
+}
+
+// observeResponse records a finished Gemini generate request, with its
+// token usage, in the logs and metrics
+func observeResponse(model string, start time.Time, resp *genai.GenerateContentResponse, err error) {
+	var args []any
+	if err == nil && resp.UsageMetadata != nil {
+		prompt, response := resp.UsageMetadata.PromptTokenCount, resp.UsageMetadata.CandidatesTokenCount
+		metrics.TokensUsed.WithLabelValues(model, "prompt").Add(float64(prompt))
+		metrics.TokensUsed.WithLabelValues(model, "response").Add(float64(response))
+		args = append(args, "prompt_tokens", prompt, "response_tokens", response)
+	}
+	observeRequest(model, start, err, args...)
+}
+
+// Unix nanoseconds of the last successful Gemini request, 0 before any
+var lastSuccess atomic.Int64
+
+// LastSuccess returns when a Gemini request last succeeded, or the zero time
+// if none has yet
+func LastSuccess() time.Time {
+	if nanos := lastSuccess.Load(); nanos != 0 {
+		return time.Unix(0, nanos)
+	}
+	return time.Time{}
+}
+
+// observeRequest records a finished Gemini request in the logs and metrics
+func observeRequest(model string, start time.Time, err error, args ...any) {
+	latency := time.Since(start)
+	if err == nil {
+		lastSuccess.Store(time.Now().UnixNano())
+	}
+	metrics.GeminiRequests.WithLabelValues(model, metrics.Outcome(err)).Inc()
+	metrics.GeminiLatency.WithLabelValues(model).Observe(latency.Seconds())
+
+	logger := slog.With("model", model, "latency", latency)
+	if err != nil {
+		logger.Warn("Gemini request failed", "error", err)
+		return
+	}
+	logger.Debug("Gemini request", args...)
+}
@@ -0,0 +1,93 @@
+package ai
+
+import (
+	"context"
+	"encoding/base64"
+	"log/slog"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Imagen model used by GenerateImages
+const imagenModel = "imagen-3.0-generate-002"
+
+// imagenResponse is the subset of the Imagen predict response the bot uses
+type imagenResponse struct {
+	Predictions []struct {
+		BytesBase64Encoded string `json:"bytesBase64Encoded"`
+		MIMEType           string `json:"mimeType"`
+	} `json:"predictions"`
+}
+
+// GenerateImages generates images with Imagen. Images removed by the safety
+// filter are left out, so fewer than count images may be returned; strict
+// safety applies Imagen's strictest filter.
+func (r *restAPI) GenerateImages(ctx context.Context, prompt string, count int, strictSafety bool) ([]Image, error) {
+	safetySetting := "block_only_high"
+	if strictSafety {
+		safetySetting = "block_low_and_above"
+	}
+
+	var resp imagenResponse
+	err := r.post(ctx, "models/"+imagenModel+":predict", map[string]any{
+		"instances": []map[string]any{
+			{"prompt": prompt},
+		},
+		"parameters": map[string]any{
+			"sampleCount":   count,
+			"safetySetting": safetySetting,
+		},
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []Image
+	for _, prediction := range resp.Predictions {
+		data, err := base64.StdEncoding.DecodeString(prediction.BytesBase64Encoded)
+		if err != nil {
+			slog.Error("Error decoding generated image", "error", err)
+			continue
+		}
+		images = append(images, Image{MIMEType: prediction.MIMEType, Data: data})
+	}
+	return images, nil
+}
+
+// EditImage asks an image-output model to edit images following an
+// instruction, returning the text it wrote, with the tokens it used, and the
+// edited images
+func (r *restAPI) EditImage(ctx context.Context, images []Image, instruction string) (*Reply, []Image, error) {
+	// Image-output models take images inline rather than through the File API
+	var parts []restPart
+	for _, image := range images {
+		parts = append(parts, restPart{InlineData: &restBlob{
+			MIMEType: image.MIMEType,
+			Data:     base64.StdEncoding.EncodeToString(image.Data),
+		}})
+	}
+	parts = append(parts, restPart{Text: instruction})
+
+	var resp restGenerateResponse
+	err := r.post(ctx, "models/"+r.opts.ImageEditModel+":generateContent", map[string]any{
+		"contents": []restContent{{Role: "user", Parts: parts}},
+		"generationConfig": map[string]any{
+			"responseModalities": []string{"TEXT", "IMAGE"},
+		},
+	}, &resp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Collect the returned images, the text is the reply's
+	sdkResp := resp.toSDKResponse()
+	var edited []Image
+	for _, cand := range sdkResp.Candidates {
+		for _, part := range cand.Content.Parts {
+			if blob, ok := part.(genai.Blob); ok {
+				edited = append(edited, Image{MIMEType: blob.MIMEType, Data: blob.Data})
+			}
+		}
+	}
+	return newReply(r.opts.ImageEditModel, sdkResp), edited, nil
+}
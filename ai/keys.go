@@ -0,0 +1,177 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+const (
+	// How long a key that ran out of quota is skipped
+	keyCooldown = time.Minute
+
+	// How long the File API keeps uploaded files
+	fileLifetime = 48 * time.Hour
+)
+
+// apiKey is one Gemini API key with its own client
+type apiKey struct {
+	key    string
+	client *genai.Client
+
+	// Unix nanoseconds until which the key is skipped
+	coolUntil atomic.Int64
+}
+
+// exhausted marks the key as out of quota for a while
+func (k *apiKey) exhausted() {
+	k.coolUntil.Store(time.Now().Add(keyCooldown).UnixNano())
+}
+
+// cooling reports whether the key recently ran out of quota
+func (k *apiKey) cooling() bool {
+	return time.Now().UnixNano() < k.coolUntil.Load()
+}
+
+// keyRing rotates requests between API keys, possibly of different Google
+// Cloud projects. Uploaded files only exist in the project that uploaded
+// them, so requests referencing one stay on its key.
+type keyRing struct {
+	keys []*apiKey
+	next atomic.Uint64
+
+	// Key each uploaded file's URI belongs to, and when it was uploaded
+	filesMu sync.Mutex
+	files   map[string]uploadedFile
+}
+
+// uploadedFile is a file uploaded with one of the keys
+type uploadedFile struct {
+	key        *apiKey
+	uploadedAt time.Time
+}
+
+// newKeyRing creates a client for every key, with the other client options
+func newKeyRing(ctx context.Context, keys []string, opts ...option.ClientOption) (*keyRing, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no Gemini API key configured")
+	}
+	r := &keyRing{files: map[string]uploadedFile{}}
+	for _, key := range keys {
+		client, err := genai.NewClient(ctx, append([]option.ClientOption{option.WithAPIKey(key)}, opts...)...)
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+		r.keys = append(r.keys, &apiKey{key: key, client: client})
+	}
+	return r, nil
+}
+
+// close closes every key's client
+func (r *keyRing) close() error {
+	var errs []error
+	for _, k := range r.keys {
+		errs = append(errs, k.client.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// primary returns the first key, used for the context cache
+func (r *keyRing) primary() *apiKey {
+	return r.keys[0]
+}
+
+// rotation returns every key in the order requests should try them: round
+// robin, with keys that recently ran out of quota last
+func (r *keyRing) rotation() []*apiKey {
+	start := int(r.next.Add(1)-1) % len(r.keys)
+	var ready, cooling []*apiKey
+	for n := range r.keys {
+		k := r.keys[(start+n)%len(r.keys)]
+		if k.cooling() {
+			cooling = append(cooling, k)
+		} else {
+			ready = append(ready, k)
+		}
+	}
+	return append(ready, cooling...)
+}
+
+// do runs a request with the next key, moving on to the following keys while
+// it fails for lack of quota. Requests referencing uploaded files only run
+// with the key the files were uploaded with.
+func (r *keyRing) do(contents []*genai.Content, request func(k *apiKey) error) error {
+	keys := r.rotation()
+	if pinned := r.fileKey(contents); pinned != nil {
+		keys = []*apiKey{pinned}
+	}
+
+	var err error
+	for _, k := range keys {
+		if err = request(k); !isQuotaError(err) {
+			return err
+		}
+		k.exhausted()
+		slog.Warn("Gemini API key out of quota, trying the next one", "key", maskKey(k.key))
+	}
+	return err
+}
+
+// addFile records the key a file was uploaded with, forgetting files the
+// File API has deleted since
+func (r *keyRing) addFile(uri string, k *apiKey) {
+	r.filesMu.Lock()
+	defer r.filesMu.Unlock()
+
+	for name, file := range r.files {
+		if time.Since(file.uploadedAt) > fileLifetime {
+			delete(r.files, name)
+		}
+	}
+	r.files[uri] = uploadedFile{key: k, uploadedAt: time.Now()}
+}
+
+// fileKey returns the key the files referenced by contents were uploaded
+// with, or nil when they don't reference any
+func (r *keyRing) fileKey(contents []*genai.Content) *apiKey {
+	r.filesMu.Lock()
+	defer r.filesMu.Unlock()
+
+	for _, content := range contents {
+		for _, part := range content.Parts {
+			if data, ok := part.(genai.FileData); ok {
+				if file, ok := r.files[data.URI]; ok {
+					return file.key
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isQuotaError reports whether a request failed because its key ran out of quota
+func isQuotaError(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusTooManyRequests
+	}
+	var statusErr *statusError
+	return errors.As(err, &statusErr) && statusErr.code == http.StatusTooManyRequests
+}
+
+// maskKey shortens a key to its last characters for logging
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return "…" + key[len(key)-4:]
+}
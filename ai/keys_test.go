@@ -0,0 +1,109 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/googleapi"
+)
+
+// testKeyRing builds a key ring without clients
+func testKeyRing(names ...string) *keyRing {
+	r := &keyRing{files: map[string]uploadedFile{}}
+	for _, name := range names {
+		r.keys = append(r.keys, &apiKey{key: name})
+	}
+	return r
+}
+
+func TestKeyRingRotates(t *testing.T) {
+	r := testKeyRing("a", "b", "c")
+	var used []string
+	for range 4 {
+		r.do(nil, func(k *apiKey) error {
+			used = append(used, k.key)
+			return nil
+		})
+	}
+	if fmt.Sprint(used) != "[a b c a]" {
+		t.Errorf("keys used = %v, want [a b c a]", used)
+	}
+}
+
+func TestKeyRingSkipsExhaustedKeys(t *testing.T) {
+	r := testKeyRing("a", "b", "c")
+	quota := &googleapi.Error{Code: http.StatusTooManyRequests}
+
+	var used []string
+	err := r.do(nil, func(k *apiKey) error {
+		used = append(used, k.key)
+		if k.key == "a" {
+			return quota
+		}
+		return nil
+	})
+	if err != nil || fmt.Sprint(used) != "[a b]" {
+		t.Fatalf("first request used %v and returned %v, want [a b] and no error", used, err)
+	}
+
+	// "a" is cooling down, so it comes last even when its turn is next
+	r.next.Store(0)
+	if keys := r.rotation(); keys[0].key != "b" || keys[2].key != "a" {
+		t.Errorf("rotation starts with %q and ends with %q, want b and a", keys[0].key, keys[2].key)
+	}
+
+	// Every key out of quota returns the last error
+	err = r.do(nil, func(k *apiKey) error { return quota })
+	if !errors.Is(err, quota) {
+		t.Errorf("do with every key exhausted = %v, want the quota error", err)
+	}
+}
+
+func TestKeyRingPinsUploadedFiles(t *testing.T) {
+	r := testKeyRing("a", "b")
+	r.addFile("files/report", r.keys[1])
+
+	contents := []*genai.Content{genai.NewUserContent(genai.FileData{URI: "files/report"}, genai.Text("summarize"))}
+	for range 3 {
+		var used *apiKey
+		err := r.do(contents, func(k *apiKey) error {
+			used = k
+			return &statusError{code: http.StatusTooManyRequests}
+		})
+		if used != r.keys[1] || err == nil {
+			t.Fatalf("request referencing the file used %q and returned %v, want b and its error", used.key, err)
+		}
+	}
+}
+
+func TestIsQuotaError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("boom"), false},
+		{&googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{fmt.Errorf("error uploading file: %w", &googleapi.Error{Code: http.StatusTooManyRequests}), true},
+		{&googleapi.Error{Code: http.StatusBadRequest}, false},
+		{&statusError{code: http.StatusTooManyRequests, message: "quota"}, true},
+		{&statusError{code: http.StatusInternalServerError}, false},
+	}
+	for _, test := range tests {
+		if got := isQuotaError(test.err); got != test.want {
+			t.Errorf("isQuotaError(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestMaskKey(t *testing.T) {
+	if got := maskKey("AIzaSyExample1234"); got != "…1234" {
+		t.Errorf("maskKey = %q", got)
+	}
+	if got := maskKey("abc"); got != "****" {
+		t.Errorf("maskKey of a short key = %q", got)
+	}
+}
@@ -0,0 +1,184 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/metrics"
+)
+
+// ErrBusy is returned when too many requests are already waiting for the model
+var ErrBusy = errors.New("the bot is busy, please try again in a moment")
+
+// limitedClient bounds how many requests run at once and how many may wait
+// for a turn, failing fast with ErrBusy beyond that
+type limitedClient struct {
+	Client
+
+	slots   chan struct{}
+	depth   int64
+	waiting atomic.Int64
+}
+
+// NewLimited wraps a client so at most concurrency requests run at once and
+// at most depth more wait for a turn
+func NewLimited(client Client, concurrency int, depth int) Client {
+	return &limitedClient{Client: client, slots: make(chan struct{}, concurrency), depth: int64(depth)}
+}
+
+// Unwrap returns the client limits and circuit breakers wrap, or the client
+// itself
+func Unwrap(client Client) Client {
+	for {
+		switch c := client.(type) {
+		case *limitedClient:
+			client = c.Client
+		case *breakerClient:
+			client = c.Client
+		default:
+			return client
+		}
+	}
+}
+
+// Queue returns how many requests a limited client is running and how many
+// wait for a turn, or zeros for other clients
+func Queue(client Client) (running int, waiting int) {
+	if b, ok := client.(*breakerClient); ok {
+		client = b.Client
+	}
+	l, ok := client.(*limitedClient)
+	if !ok {
+		return 0, 0
+	}
+	return len(l.slots), int(l.waiting.Load())
+}
+
+// acquire waits for a free slot, or returns ErrBusy if the queue is full
+func (l *limitedClient) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if l.waiting.Add(1) > l.depth {
+		l.waiting.Add(-1)
+		metrics.RateLimitRejections.WithLabelValues("queue").Inc()
+		return ErrBusy
+	}
+	defer l.waiting.Add(-1)
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a slot taken by acquire
+func (l *limitedClient) release() {
+	<-l.slots
+}
+
+func (l *limitedClient) NewChat() Chat {
+	return &limitedChat{Chat: l.Client.NewChat(), limiter: l}
+}
+
+func (l *limitedClient) Generate(ctx context.Context, parts ...genai.Part) (*Reply, error) {
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer l.release()
+	return l.Client.Generate(ctx, parts...)
+}
+
+func (l *limitedClient) GenerateJSON(ctx context.Context, schema *genai.Schema, parts ...genai.Part) (*Reply, error) {
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer l.release()
+	return l.Client.GenerateJSON(ctx, schema, parts...)
+}
+
+func (l *limitedClient) GenerateStream(ctx context.Context, onText func(text string), parts ...genai.Part) (*Reply, error) {
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer l.release()
+	return l.Client.GenerateStream(ctx, onText, parts...)
+}
+
+func (l *limitedClient) CountTokens(ctx context.Context, parts ...genai.Part) (int, error) {
+	if err := l.acquire(ctx); err != nil {
+		return 0, err
+	}
+	defer l.release()
+	return l.Client.CountTokens(ctx, parts...)
+}
+
+func (l *limitedClient) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer l.release()
+	return l.Client.EmbedDocuments(ctx, texts)
+}
+
+func (l *limitedClient) EmbedQuery(ctx context.Context, query string) ([]float32, error) {
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer l.release()
+	return l.Client.EmbedQuery(ctx, query)
+}
+
+func (l *limitedClient) UploadFile(ctx context.Context, data []byte, mimeType string, displayName string) (genai.Part, error) {
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer l.release()
+	return l.Client.UploadFile(ctx, data, mimeType, displayName)
+}
+
+func (l *limitedClient) GenerateImages(ctx context.Context, prompt string, count int, strictSafety bool) ([]Image, error) {
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer l.release()
+	return l.Client.GenerateImages(ctx, prompt, count, strictSafety)
+}
+
+func (l *limitedClient) EditImage(ctx context.Context, images []Image, instruction string) (*Reply, []Image, error) {
+	if err := l.acquire(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer l.release()
+	return l.Client.EditImage(ctx, images, instruction)
+}
+
+func (l *limitedClient) Speak(ctx context.Context, text string) ([]byte, error) {
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer l.release()
+	return l.Client.Speak(ctx, text)
+}
+
+// limitedChat is a Chat whose messages go through a limitedClient's queue
+type limitedChat struct {
+	Chat
+	limiter *limitedClient
+}
+
+func (c *limitedChat) Send(ctx context.Context, parts ...genai.Part) (*Reply, error) {
+	if err := c.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.limiter.release()
+	return c.Chat.Send(ctx, parts...)
+}
@@ -0,0 +1,78 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// blockingClient blocks Generate until release is closed
+type blockingClient struct {
+	Client
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingClient) Generate(context.Context, ...genai.Part) (*Reply, error) {
+	c.started <- struct{}{}
+	<-c.release
+	return &Reply{Text: "done"}, nil
+}
+
+func TestLimitedRejectsWhenQueueIsFull(t *testing.T) {
+	inner := &blockingClient{started: make(chan struct{}, 10), release: make(chan struct{})}
+	client := NewLimited(inner, 1, 1)
+	ctx := context.Background()
+
+	results := make(chan error, 2)
+	go func() {
+		_, err := client.Generate(ctx)
+		results <- err
+	}()
+	<-inner.started
+
+	// The second request waits for the first one
+	go func() {
+		_, err := client.Generate(ctx)
+		results <- err
+	}()
+	for client.(*limitedClient).waiting.Load() != 1 {
+		runtime.Gosched()
+	}
+
+	// The third one finds the queue full
+	if _, err := client.Generate(ctx); !errors.Is(err, ErrBusy) {
+		t.Errorf("Generate with a full queue = %v, want ErrBusy", err)
+	}
+	if running, waiting := Queue(client); running != 1 || waiting != 1 {
+		t.Errorf("Queue = %d running, %d waiting, want 1 and 1", running, waiting)
+	}
+	if Unwrap(client) != Client(inner) {
+		t.Error("Unwrap didn't return the wrapped client")
+	}
+
+	close(inner.release)
+	for range 2 {
+		if err := <-results; err != nil {
+			t.Errorf("queued Generate: %v", err)
+		}
+	}
+}
+
+func TestLimitedHonorsContext(t *testing.T) {
+	inner := &blockingClient{started: make(chan struct{}, 10), release: make(chan struct{})}
+	defer close(inner.release)
+	client := NewLimited(inner, 1, 1)
+
+	go client.Generate(context.Background())
+	<-inner.started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.Generate(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Generate with a canceled context = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,342 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// Prompts containing these make the mock backend fail, or answer at
+	// length so splitting can be tested
+	mockFailDirective = "!fail"
+	mockLongDirective = "!long"
+
+	// Length of the answers to prompts with mockLongDirective
+	mockLongLength = 5000
+
+	// Dimensions of the mock backend's embeddings
+	mockEmbeddingSize = 64
+)
+
+// Mock is a deterministic Backend that spends no quota, for testing the bot
+// end to end on Discord: it echoes prompts, fills JSON schemas with
+// placeholder values, and can be made slow or failing.
+type Mock struct {
+	chatModel
+
+	delay     time.Duration
+	failEvery int
+	requests  atomic.Int64
+}
+
+// Mock must implement Backend
+var _ Backend = (*Mock)(nil)
+
+// NewMock creates the mock backend. Every request waits opts.MockDelay and,
+// when opts.MockFailEvery is set, every MockFailEvery-th request fails.
+func NewMock(opts Options) *Mock {
+	m := &Mock{delay: opts.MockDelay, failEvery: opts.MockFailEvery}
+	m.SetModel("mock")
+	return m
+}
+
+// request simulates a request's latency and failures, recording it like a
+// real one
+func (m *Mock) request(ctx context.Context, prompt string) error {
+	start := time.Now()
+	n := m.requests.Add(1)
+	var err error
+	select {
+	case <-time.After(m.delay):
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err == nil && (strings.Contains(prompt, mockFailDirective) || m.failEvery > 0 && n%int64(m.failEvery) == 0) {
+		err = fmt.Errorf("mock backend: simulated failure of request %d", n)
+	}
+	observeRequest(m.Model(), start, err)
+	return err
+}
+
+// reply answers a prompt with text, counting tokens like CountTokens
+func (m *Mock) reply(prompt string, text string) *Reply {
+	return &Reply{
+		Text:           text,
+		Model:          m.Model(),
+		PromptTokens:   mockTokens(prompt),
+		ResponseTokens: mockTokens(text),
+		FinishReason:   "STOP",
+	}
+}
+
+// Close releases nothing
+func (m *Mock) Close() error {
+	return nil
+}
+
+// CacheContext does nothing, the mock has no context to cache
+func (m *Mock) CacheContext(context.Context, []string, string, string) error {
+	return nil
+}
+
+// NewChat starts a chat whose replies echo each message
+func (m *Mock) NewChat() Chat {
+	return &mockChat{mock: m}
+}
+
+// Generate echoes the prompt
+func (m *Mock) Generate(ctx context.Context, parts ...genai.Part) (*Reply, error) {
+	prompt := mockText(parts)
+	if err := m.request(ctx, prompt); err != nil {
+		return nil, err
+	}
+	return m.reply(prompt, mockEcho("Echo: ", prompt)), nil
+}
+
+// GenerateJSON answers with placeholder values matching schema: the first
+// of enums, two items per array and strings naming their field. Without a
+// schema it echoes the prompt in a JSON object.
+func (m *Mock) GenerateJSON(ctx context.Context, schema *genai.Schema, parts ...genai.Part) (*Reply, error) {
+	prompt := mockText(parts)
+	if err := m.request(ctx, prompt); err != nil {
+		return nil, err
+	}
+	var value any = map[string]string{"echo": prompt}
+	if schema != nil {
+		value = mockValue(schema, "mock")
+	}
+	text, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return m.reply(prompt, string(text)), nil
+}
+
+// GenerateStream echoes the prompt a word at a time
+func (m *Mock) GenerateStream(ctx context.Context, onText func(text string), parts ...genai.Part) (*Reply, error) {
+	reply, err := m.Generate(ctx, parts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, word := range strings.SplitAfter(reply.Text, " ") {
+		onText(word)
+	}
+	return reply, nil
+}
+
+// CountTokens estimates a token per four characters
+func (m *Mock) CountTokens(_ context.Context, parts ...genai.Part) (int, error) {
+	return mockTokens(mockText(parts)), nil
+}
+
+// EmbedDocuments embeds texts by hashing their words, so texts sharing words
+// are similar
+func (m *Mock) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	if err := m.request(ctx, strings.Join(texts, "\n")); err != nil {
+		return nil, err
+	}
+	vectors := make([][]float32, len(texts))
+	for n, text := range texts {
+		vectors[n] = mockEmbedding(text)
+	}
+	return vectors, nil
+}
+
+// EmbedQuery embeds a query like EmbedDocuments
+func (m *Mock) EmbedQuery(ctx context.Context, query string) ([]float32, error) {
+	if err := m.request(ctx, query); err != nil {
+		return nil, err
+	}
+	return mockEmbedding(query), nil
+}
+
+// UploadFile describes the file as text instead of uploading it
+func (m *Mock) UploadFile(_ context.Context, data []byte, mimeType string, displayName string) (genai.Part, error) {
+	return genai.Text(fmt.Sprintf("[%s: %s, %d bytes]", displayName, mimeType, len(data))), nil
+}
+
+// GenerateImages returns count small images, colored after the prompt
+func (m *Mock) GenerateImages(ctx context.Context, prompt string, count int, _ bool) ([]Image, error) {
+	if err := m.request(ctx, prompt); err != nil {
+		return nil, err
+	}
+	images := make([]Image, 0, count)
+	for n := range count {
+		data, err := mockPNG(fmt.Sprintf("%s %d", prompt, n))
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, Image{MIMEType: "image/png", Data: data})
+	}
+	return images, nil
+}
+
+// EditImage echoes the instruction and returns the images unchanged
+func (m *Mock) EditImage(ctx context.Context, images []Image, instruction string) (*Reply, []Image, error) {
+	if err := m.request(ctx, instruction); err != nil {
+		return nil, nil, err
+	}
+	return m.reply(instruction, mockEcho("Echo: ", instruction)), images, nil
+}
+
+// Speak returns half a second of silence
+func (m *Mock) Speak(ctx context.Context, text string) ([]byte, error) {
+	if err := m.request(ctx, text); err != nil {
+		return nil, err
+	}
+	const sampleRate = 24000
+	return pcmToWAV(make([]byte, sampleRate), sampleRate), nil
+}
+
+// mockChat is a chat with the mock backend, whose replies echo each message
+// with its turn number
+type mockChat struct {
+	mock *Mock
+
+	mu      sync.Mutex
+	history []*genai.Content
+}
+
+// Send echoes the message
+func (c *mockChat) Send(ctx context.Context, parts ...genai.Part) (*Reply, error) {
+	prompt := mockText(parts)
+	if err := c.mock.request(ctx, prompt); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	turn := len(c.history)/2 + 1
+	text := mockEcho(fmt.Sprintf("Echo (turn %d): ", turn), prompt)
+	c.history = append(c.history, genai.NewUserContent(parts...), &genai.Content{Role: "model", Parts: []genai.Part{genai.Text(text)}})
+	return c.mock.reply(prompt, text), nil
+}
+
+// History returns the conversation so far
+func (c *mockChat) History() []*genai.Content {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.history
+}
+
+// SetHistory replaces the conversation so far
+func (c *mockChat) SetHistory(history []*genai.Content) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.history = history
+}
+
+// mockText returns the text of parts, describing the others
+func mockText(parts []genai.Part) string {
+	var texts []string
+	for _, part := range parts {
+		switch part := part.(type) {
+		case genai.Text:
+			texts = append(texts, string(part))
+		case genai.FunctionResponse:
+			texts = append(texts, fmt.Sprintf("[result of %s]", part.Name))
+		default:
+			texts = append(texts, fmt.Sprintf("[%T]", part))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// mockEcho echoes a prompt after prefix, repeating it up to mockLongLength
+// characters when it asks for a long answer
+func mockEcho(prefix string, prompt string) string {
+	text := prefix + prompt
+	if !strings.Contains(prompt, mockLongDirective) {
+		return text
+	}
+	var long []rune
+	for n := 1; len(long) < mockLongLength; n++ {
+		long = append(long, []rune(fmt.Sprintf("%d. %s\n\n", n, text))...)
+	}
+	return string(long[:mockLongLength])
+}
+
+// mockTokens estimates the tokens of text at four characters each
+func mockTokens(text string) int {
+	return len([]rune(text))/4 + 1
+}
+
+// mockValue returns a placeholder value matching schema, naming strings
+// after the field they fill
+func mockValue(schema *genai.Schema, name string) any {
+	switch schema.Type {
+	case genai.TypeObject:
+		object := map[string]any{}
+		for property, propertySchema := range schema.Properties {
+			object[property] = mockValue(propertySchema, property)
+		}
+		return object
+	case genai.TypeArray:
+		var items []any
+		for n := 1; n <= 2 && schema.Items != nil; n++ {
+			items = append(items, mockValue(schema.Items, fmt.Sprintf("%s %d", name, n)))
+		}
+		return items
+	case genai.TypeInteger, genai.TypeNumber:
+		return 0
+	case genai.TypeBoolean:
+		return false
+	default:
+		if len(schema.Enum) > 0 {
+			return schema.Enum[0]
+		}
+		return name
+	}
+}
+
+// mockEmbedding hashes the words of text into a unit vector
+func mockEmbedding(text string) []float32 {
+	vector := make([]float32, mockEmbeddingSize)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		hash := fnv.New32a()
+		hash.Write([]byte(word))
+		vector[hash.Sum32()%mockEmbeddingSize]++
+	}
+	var norm float64
+	for _, value := range vector {
+		norm += float64(value * value)
+	}
+	if norm > 0 {
+		for n := range vector {
+			vector[n] /= float32(math.Sqrt(norm))
+		}
+	}
+	return vector
+}
+
+// mockPNG returns a small PNG of a color derived from seed
+func mockPNG(seed string) ([]byte, error) {
+	hash := fnv.New32a()
+	hash.Write([]byte(seed))
+	sum := hash.Sum32()
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	fill := color.RGBA{R: uint8(sum), G: uint8(sum >> 8), B: uint8(sum >> 16), A: 255}
+	for x := range 64 {
+		for y := range 64 {
+			img.Set(x, y, fill)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,112 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+func TestMockChatEchoesEachTurn(t *testing.T) {
+	chat := NewMock(Options{}).NewChat()
+	ctx := context.Background()
+
+	for _, want := range []string{"Echo (turn 1): hello", "Echo (turn 2): again"} {
+		_, prompt, _ := strings.Cut(want, ": ")
+		reply, err := chat.Send(ctx, genai.Text(prompt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply.Text != want {
+			t.Errorf("reply = %q, want %q", reply.Text, want)
+		}
+	}
+	if n := len(chat.History()); n != 4 {
+		t.Errorf("history has %d entries, want 4", n)
+	}
+}
+
+func TestMockGenerateStream(t *testing.T) {
+	var streamed string
+	reply, err := NewMock(Options{}).GenerateStream(context.Background(), func(text string) { streamed += text }, genai.Text("hello there"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Text != "Echo: hello there" || streamed != reply.Text {
+		t.Errorf("reply = %q, streamed %q, want the echo streamed whole", reply.Text, streamed)
+	}
+}
+
+func TestMockDirectives(t *testing.T) {
+	mock := NewMock(Options{})
+	ctx := context.Background()
+
+	if _, err := mock.Generate(ctx, genai.Text("please !fail")); err == nil {
+		t.Error("prompt with !fail succeeded")
+	}
+	reply, err := mock.Generate(ctx, genai.Text("!long"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len([]rune(reply.Text)); n != mockLongLength {
+		t.Errorf("long reply has %d characters, want %d", n, mockLongLength)
+	}
+}
+
+func TestMockFailEvery(t *testing.T) {
+	mock := NewMock(Options{MockFailEvery: 2})
+	ctx := context.Background()
+
+	var failures int
+	for range 6 {
+		if _, err := mock.Generate(ctx, genai.Text("hi")); err != nil {
+			failures++
+		}
+	}
+	if failures != 3 {
+		t.Errorf("%d of 6 requests failed, want 3", failures)
+	}
+}
+
+func TestMockGenerateJSONFollowsSchema(t *testing.T) {
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"kind":    {Type: genai.TypeString, Enum: []string{"bug", "style"}},
+			"answers": {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+			"count":   {Type: genai.TypeInteger},
+		},
+	}
+	reply, err := NewMock(Options{}).GenerateJSON(context.Background(), schema, genai.Text("quiz me"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Kind    string   `json:"kind"`
+		Answers []string `json:"answers"`
+		Count   int      `json:"count"`
+	}
+	if err := json.Unmarshal([]byte(reply.Text), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Kind != "bug" {
+		t.Errorf("kind = %q, want the first enum value", got.Kind)
+	}
+	if len(got.Answers) != 2 || got.Answers[0] == got.Answers[1] {
+		t.Errorf("answers = %q, want two distinct items", got.Answers)
+	}
+}
+
+func TestMockDelayRespectsContext(t *testing.T) {
+	mock := NewMock(Options{MockDelay: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := mock.Generate(ctx, genai.Text("hi")); err == nil {
+		t.Error("request with a canceled context succeeded")
+	}
+}
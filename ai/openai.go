@@ -0,0 +1,516 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Returned by features an OpenAI-compatible provider doesn't offer
+var ErrUnsupported = errors.New("not supported by this AI provider")
+
+// OpenAIOptions configures a client for an OpenAI-compatible API
+type OpenAIOptions struct {
+	// Base URL of the API, such as "https://api.openai.com/v1" or
+	// "http://localhost:11434/v1" for Ollama
+	BaseURL string
+
+	// API key, which local servers usually don't need
+	APIKey string
+
+	// Models used for chat, until changed with SetModel, and for embeddings
+	Model          string
+	EmbeddingModel string
+
+	// Tools chat sessions may call
+	ChatTools []*genai.Tool
+}
+
+// OpenAI is the Client backed by an OpenAI-compatible chat completions API,
+// which covers OpenAI itself and local servers like Ollama or LM Studio
+type OpenAI struct {
+	chatModel
+	opts OpenAIOptions
+}
+
+// OpenAI must implement Client
+var _ Client = (*OpenAI)(nil)
+
+// NewOpenAI creates an OpenAI-compatible client
+func NewOpenAI(opts OpenAIOptions) *OpenAI {
+	opts.BaseURL = strings.TrimSuffix(opts.BaseURL, "/")
+	o := &OpenAI{opts: opts}
+	o.SetModel(opts.Model)
+	return o
+}
+
+// Close releases nothing, requests don't hold connections open
+func (o *OpenAI) Close() error {
+	return nil
+}
+
+// CacheContext isn't supported by OpenAI-compatible providers
+func (o *OpenAI) CacheContext(ctx context.Context, paths []string, instructions string, model string) error {
+	if len(paths) == 0 && instructions == "" {
+		return nil
+	}
+	return fmt.Errorf("context caching is %v", ErrUnsupported)
+}
+
+// Most a line of a streamed completion may take
+const openAIMaxEventSize = 1 << 20
+
+// post sends a JSON request to an endpoint such as "chat/completions" and
+// decodes the JSON response into out
+func (o *OpenAI) post(ctx context.Context, endpoint string, body any, out any) error {
+	return o.send(ctx, endpoint, body, func(r io.Reader) error {
+		respBody, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("error reading response: %v", err)
+		}
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("error decoding response: %v", err)
+		}
+		return nil
+	})
+}
+
+// send sends a JSON request to an endpoint and reads the body of a
+// successful response with read
+func (o *OpenAI) send(ctx context.Context, endpoint string, body any, read func(r io.Reader) error) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error encoding request: %v", err)
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, geminiRESTTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, o.opts.BaseURL+"/"+endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.opts.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.opts.APIKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling AI provider: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("error reading response: %v", err)
+		}
+		// OpenAI-compatible APIs report errors like the Gemini REST API
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("AI provider error (%d): %s", resp.StatusCode, apiErr.Error.Message)
+		}
+		return fmt.Errorf("AI provider error (%d): %s", resp.StatusCode, respBody)
+	}
+	return read(resp.Body)
+}
+
+// openAIMessage is a chat completions message
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    any              `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// openAIToolCall is a function call made by the model
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// openAIResponse is the subset of a chat completions response the bot uses,
+// or of a chunk of a streamed one
+type openAIResponse struct {
+	Choices []openAIChoice `json:"choices"`
+	Usage   struct {
+		PromptTokens     int32 `json:"prompt_tokens"`
+		CompletionTokens int32 `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// openAIChoice is an answer of a chat completions response
+type openAIChoice struct {
+	Message struct {
+		Content   string           `json:"content"`
+		ToolCalls []openAIToolCall `json:"tool_calls"`
+	} `json:"message"`
+	// The text a chunk of a streamed answer adds
+	Delta struct {
+		Content string `json:"content"`
+	} `json:"delta"`
+	FinishReason string `json:"finish_reason"`
+}
+
+// complete sends contents to the chat model, with JSON output when json is
+// set, matching schema when there is one. Of the request options only the
+// answer's token limit applies, their models and safety levels are Gemini's.
+func (o *OpenAI) complete(ctx context.Context, contents []*genai.Content, json bool, schema *genai.Schema, tools []*genai.Tool) (*genai.GenerateContentResponse, error) {
+	var resp openAIResponse
+	start := time.Now()
+	if err := o.post(ctx, "chat/completions", o.completionRequest(ctx, contents, json, schema, tools), &resp); err != nil {
+		observeResponse(o.Model(), start, nil, err)
+		return nil, err
+	}
+	sdkResp := resp.toSDKResponse()
+	observeResponse(o.Model(), start, sdkResp, nil)
+	return sdkResp, nil
+}
+
+// completeStream sends contents to the chat model with the answer streamed
+// as server-sent events, calling onText with the text of each
+func (o *OpenAI) completeStream(ctx context.Context, contents []*genai.Content, onText func(text string)) (*genai.GenerateContentResponse, error) {
+	body := o.completionRequest(ctx, contents, false, nil, nil)
+	body["stream"] = true
+	body["stream_options"] = map[string]any{"include_usage": true}
+
+	resp := openAIResponse{Choices: make([]openAIChoice, 1)}
+	answer := &resp.Choices[0]
+	start := time.Now()
+	err := o.send(ctx, "chat/completions", body, func(r io.Reader) error {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, openAIMaxEventSize)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if data = strings.TrimSpace(data); !ok || data == "" {
+				continue
+			}
+			if data == "[DONE]" {
+				return nil
+			}
+			var chunk openAIResponse
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return fmt.Errorf("error decoding response: %v", err)
+			}
+			for _, choice := range chunk.Choices {
+				if choice.Delta.Content != "" {
+					answer.Message.Content += choice.Delta.Content
+					onText(choice.Delta.Content)
+				}
+				if choice.FinishReason != "" {
+					answer.FinishReason = choice.FinishReason
+				}
+			}
+			// The usage comes with the last chunk
+			if chunk.Usage.PromptTokens > 0 || chunk.Usage.CompletionTokens > 0 {
+				resp.Usage = chunk.Usage
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("error reading response: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		observeResponse(o.Model(), start, nil, err)
+		return nil, err
+	}
+	sdkResp := resp.toSDKResponse()
+	observeResponse(o.Model(), start, sdkResp, nil)
+	return sdkResp, nil
+}
+
+// completionRequest returns the body of a chat completions request
+func (o *OpenAI) completionRequest(ctx context.Context, contents []*genai.Content, json bool, schema *genai.Schema, tools []*genai.Tool) map[string]any {
+	body := map[string]any{
+		"model":    o.Model(),
+		"messages": toOpenAIMessages(contents),
+	}
+	if limit := requestOptions(ctx).MaxOutputTokens; limit > 0 {
+		body["max_tokens"] = limit
+	}
+	switch {
+	case json && schema != nil:
+		body["response_format"] = map[string]any{
+			"type":        "json_schema",
+			"json_schema": map[string]any{"name": "response", "schema": toJSONSchema(schema)},
+		}
+	case json:
+		body["response_format"] = map[string]any{"type": "json_object"}
+	}
+	var functions []map[string]any
+	for _, tool := range tools {
+		for _, fn := range tool.FunctionDeclarations {
+			functions = append(functions, map[string]any{
+				"type": "function",
+				"function": map[string]any{
+					"name":        fn.Name,
+					"description": fn.Description,
+					"parameters":  toJSONSchema(fn.Parameters),
+				},
+			})
+		}
+	}
+	if len(functions) > 0 {
+		body["tools"] = functions
+	}
+	return body
+}
+
+// SDK finish reasons of the chat completions ones
+var openAIFinishReasons = map[string]genai.FinishReason{
+	"stop":           genai.FinishReasonStop,
+	"tool_calls":     genai.FinishReasonStop,
+	"length":         genai.FinishReasonMaxTokens,
+	"content_filter": genai.FinishReasonSafety,
+}
+
+// toSDKResponse converts a chat completions response to the SDK's form
+func (r *openAIResponse) toSDKResponse() *genai.GenerateContentResponse {
+	resp := &genai.GenerateContentResponse{UsageMetadata: &genai.UsageMetadata{
+		PromptTokenCount:     r.Usage.PromptTokens,
+		CandidatesTokenCount: r.Usage.CompletionTokens,
+	}}
+	for _, choice := range r.Choices {
+		var parts []genai.Part
+		if choice.Message.Content != "" {
+			parts = append(parts, genai.Text(choice.Message.Content))
+		}
+		for _, call := range choice.Message.ToolCalls {
+			var args map[string]any
+			json.Unmarshal([]byte(call.Function.Arguments), &args)
+			parts = append(parts, genai.FunctionCall{Name: call.Function.Name, Args: args})
+		}
+		resp.Candidates = append(resp.Candidates, &genai.Candidate{
+			Content:      &genai.Content{Role: "model", Parts: parts},
+			FinishReason: openAIFinishReasons[choice.FinishReason],
+		})
+	}
+	return resp
+}
+
+// toOpenAIMessages converts SDK contents to chat completions messages.
+// Function calls get IDs from their position, and responses are matched to
+// the latest call of the same function.
+func toOpenAIMessages(contents []*genai.Content) []openAIMessage {
+	var messages []openAIMessage
+	callIDs := map[string]string{}
+	for n, content := range contents {
+		if content.Role == "model" {
+			message := openAIMessage{Role: "assistant", Content: ""}
+			for p, part := range content.Parts {
+				switch part := part.(type) {
+				case genai.Text:
+					message.Content = message.Content.(string) + string(part)
+				case genai.FunctionCall:
+					args, _ := json.Marshal(part.Args)
+					call := openAIToolCall{ID: fmt.Sprintf("call_%d_%d", n, p), Type: "function"}
+					call.Function.Name = part.Name
+					call.Function.Arguments = string(args)
+					message.ToolCalls = append(message.ToolCalls, call)
+					callIDs[part.Name] = call.ID
+				}
+			}
+			messages = append(messages, message)
+			continue
+		}
+
+		var userParts []genai.Part
+		for _, part := range content.Parts {
+			if response, ok := part.(genai.FunctionResponse); ok {
+				result, _ := json.Marshal(response.Response)
+				messages = append(messages, openAIMessage{Role: "tool", ToolCallID: callIDs[response.Name], Content: string(result)})
+			} else {
+				userParts = append(userParts, part)
+			}
+		}
+		if len(userParts) > 0 {
+			messages = append(messages, openAIMessage{Role: "user", Content: toOpenAIContent(userParts)})
+		}
+	}
+	return messages
+}
+
+// toOpenAIContent converts user parts to message content. Images are sent
+// inline and text files as text; other files are described, since
+// chat completions can't take them.
+func toOpenAIContent(parts []genai.Part) []map[string]any {
+	var content []map[string]any
+	text := func(s string) { content = append(content, map[string]any{"type": "text", "text": s}) }
+	for _, part := range parts {
+		switch p := part.(type) {
+		case genai.Text:
+			text(string(p))
+		case genai.Blob:
+			switch {
+			case strings.HasPrefix(p.MIMEType, "image/"):
+				content = append(content, map[string]any{
+					"type":      "image_url",
+					"image_url": map[string]any{"url": "data:" + p.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(p.Data)},
+				})
+			case strings.HasPrefix(p.MIMEType, "text/") && utf8.Valid(p.Data):
+				text(string(p.Data))
+			default:
+				text(fmt.Sprintf("[attached %s file, which this model can't read]", p.MIMEType))
+			}
+		case genai.FileData:
+			text(fmt.Sprintf("[attached %s file, which this model can't read]", p.MIMEType))
+		}
+	}
+	return content
+}
+
+// NewChat starts a chat session, which can call the chat tools
+func (o *OpenAI) NewChat() Chat {
+	return &openAIChat{openAI: o}
+}
+
+// Generate sends a one-off prompt and returns the reply
+func (o *OpenAI) Generate(ctx context.Context, parts ...genai.Part) (*Reply, error) {
+	resp, err := o.complete(ctx, []*genai.Content{genai.NewUserContent(parts...)}, false, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newReply(o.Model(), resp), nil
+}
+
+// GenerateJSON sends a one-off prompt and returns a reply whose text is JSON
+// matching schema, or any JSON when schema is nil
+func (o *OpenAI) GenerateJSON(ctx context.Context, schema *genai.Schema, parts ...genai.Part) (*Reply, error) {
+	resp, err := o.complete(ctx, []*genai.Content{genai.NewUserContent(parts...)}, true, schema, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newReply(o.Model(), resp), nil
+}
+
+// GenerateStream sends a one-off prompt, calling onText with each piece of
+// the answer's text as it arrives, and returns the whole reply
+func (o *OpenAI) GenerateStream(ctx context.Context, onText func(text string), parts ...genai.Part) (*Reply, error) {
+	resp, err := o.completeStream(ctx, []*genai.Content{genai.NewUserContent(parts...)}, onText)
+	if err != nil {
+		return nil, err
+	}
+	return newReply(o.Model(), resp), nil
+}
+
+// CountTokens estimates the tokens the parts take up, at about four
+// characters per token, as chat completions APIs have no counting endpoint
+func (o *OpenAI) CountTokens(ctx context.Context, parts ...genai.Part) (int, error) {
+	characters := 0
+	for _, part := range parts {
+		if text, ok := part.(genai.Text); ok {
+			characters += utf8.RuneCountInString(string(text))
+		}
+	}
+	return characters / 4, nil
+}
+
+// EmbedDocuments embeds texts that will be searched later
+func (o *OpenAI) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	var vectors [][]float32
+	for start := 0; start < len(texts); start += maxEmbeddingBatch {
+		var resp struct {
+			Data []struct {
+				Embedding []float32 `json:"embedding"`
+			} `json:"data"`
+		}
+		requestStart := time.Now()
+		err := o.post(ctx, "embeddings", map[string]any{
+			"model": o.opts.EmbeddingModel,
+			"input": texts[start:min(start+maxEmbeddingBatch, len(texts))],
+		}, &resp)
+		observeRequest(o.opts.EmbeddingModel, requestStart, err)
+		if err != nil {
+			return nil, fmt.Errorf("error embedding documents: %v", err)
+		}
+		for _, data := range resp.Data {
+			vectors = append(vectors, data.Embedding)
+		}
+	}
+	return vectors, nil
+}
+
+// EmbedQuery embeds a search query
+func (o *OpenAI) EmbedQuery(ctx context.Context, query string) ([]float32, error) {
+	vectors, err := o.EmbedDocuments(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("error embedding query: %v", err)
+	}
+	if len(vectors) == 0 {
+		return nil, errors.New("error embedding query: no embedding returned")
+	}
+	return vectors[0], nil
+}
+
+// UploadFile returns the file as inline data, since there is no file API
+func (o *OpenAI) UploadFile(ctx context.Context, data []byte, mimeType string, displayName string) (genai.Part, error) {
+	return genai.Blob{MIMEType: mimeType, Data: data}, nil
+}
+
+// GenerateImages isn't supported by OpenAI-compatible providers
+func (o *OpenAI) GenerateImages(ctx context.Context, prompt string, count int, strictSafety bool) ([]Image, error) {
+	return nil, fmt.Errorf("image generation is %v", ErrUnsupported)
+}
+
+// EditImage isn't supported by OpenAI-compatible providers
+func (o *OpenAI) EditImage(ctx context.Context, images []Image, instruction string) (*Reply, []Image, error) {
+	return nil, nil, fmt.Errorf("image editing is %v", ErrUnsupported)
+}
+
+// Speak isn't supported by OpenAI-compatible providers
+func (o *OpenAI) Speak(ctx context.Context, text string) ([]byte, error) {
+	return nil, fmt.Errorf("text-to-speech is %v", ErrUnsupported)
+}
+
+// openAIChat is a Chat backed by an OpenAI-compatible API, which keeps no
+// server-side session, so every message is sent along with the history
+type openAIChat struct {
+	openAI  *OpenAI
+	history []*genai.Content
+}
+
+// Send sends a message and returns the model's reply
+func (c *openAIChat) Send(ctx context.Context, parts ...genai.Part) (*Reply, error) {
+	contents := slices.Concat(c.history, []*genai.Content{genai.NewUserContent(parts...)})
+	resp, err := c.openAI.complete(ctx, contents, false, nil, c.openAI.opts.ChatTools)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Candidates) > 0 {
+		contents = append(contents, resp.Candidates[0].Content)
+	}
+	c.history = contents
+	return newReply(c.openAI.Model(), resp), nil
+}
+
+// History returns the conversation so far
+func (c *openAIChat) History() []*genai.Content {
+	return c.history
+}
+
+// SetHistory replaces the conversation so far
+func (c *openAIChat) SetHistory(history []*genai.Content) {
+	c.history = history
+}
@@ -0,0 +1,181 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+func TestOpenAIChatWithToolCall(t *testing.T) {
+	var requests []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("request %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body)
+
+		message := map[string]any{"role": "assistant", "content": "Noted!"}
+		if len(requests) == 1 {
+			message = map[string]any{"role": "assistant", "content": nil, "tool_calls": []any{map[string]any{
+				"id":       "abc",
+				"type":     "function",
+				"function": map[string]any{"name": "remember", "arguments": `{"fact":"likes tea"}`},
+			}}}
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": message}},
+			"usage":   map[string]any{"prompt_tokens": 20, "completion_tokens": 4},
+		})
+	}))
+	defer server.Close()
+
+	o := NewOpenAI(OpenAIOptions{BaseURL: server.URL + "/v1/", APIKey: "secret", Model: "local-model",
+		ChatTools: []*genai.Tool{{FunctionDeclarations: []*genai.FunctionDeclaration{{Name: "remember"}}}}})
+	chat := o.NewChat()
+
+	reply, err := chat.Send(context.Background(), genai.Text("I like tea"))
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	want := []genai.FunctionCall{{Name: "remember", Args: map[string]any{"fact": "likes tea"}}}
+	if !reflect.DeepEqual(reply.FunctionCalls, want) || reply.PromptTokens != 20 || reply.ResponseTokens != 4 {
+		t.Errorf("reply = %+v", reply)
+	}
+
+	reply, err = chat.Send(context.Background(), genai.FunctionResponse{Name: "remember", Response: map[string]any{"ok": true}})
+	if err != nil || reply.Text != "Noted!" {
+		t.Fatalf("Send function response = %+v, %v", reply, err)
+	}
+
+	// The tool result answers the call made in the previous turn
+	messages := requests[1]["messages"].([]any)
+	call := messages[1].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)
+	result := messages[2].(map[string]any)
+	if result["role"] != "tool" || result["tool_call_id"] != call["id"] || result["content"] != `{"ok":true}` {
+		t.Errorf("tool result message = %v, call = %v", result, call)
+	}
+	if _, ok := requests[0]["tools"]; !ok {
+		t.Error("chat request didn't declare the chat tools")
+	}
+}
+
+func TestOpenAIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": {"message": "model not found"}}`))
+	}))
+	defer server.Close()
+
+	_, err := NewOpenAI(OpenAIOptions{BaseURL: server.URL, Model: "missing"}).Generate(context.Background(), genai.Text("hi"))
+	if err == nil || err.Error() != "AI provider error (404): model not found" {
+		t.Errorf("Generate error = %v", err)
+	}
+}
+
+func TestOpenAIGenerateJSON(t *testing.T) {
+	var formats []any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		formats = append(formats, body["response_format"].(map[string]any)["type"])
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": `{"ok":true}`}}},
+		})
+	}))
+	defer server.Close()
+
+	o := NewOpenAI(OpenAIOptions{BaseURL: server.URL, Model: "local-model"})
+	for _, schema := range []*genai.Schema{{Type: genai.TypeObject}, nil} {
+		if _, err := o.GenerateJSON(context.Background(), schema, genai.Text("Reply with JSON")); err != nil {
+			t.Fatalf("GenerateJSON: %v", err)
+		}
+	}
+	if want := []any{"json_schema", "json_object"}; !reflect.DeepEqual(formats, want) {
+		t.Errorf("response formats = %v, want %v", formats, want)
+	}
+}
+
+func TestOpenAIGenerateStream(t *testing.T) {
+	var request map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{
+			`{"choices":[{"delta":{"role":"assistant","content":""}}]}`,
+			`{"choices":[{"delta":{"content":"Hello"}}]}`,
+			`{"choices":[{"delta":{"content":", world"},"finish_reason":"length"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":3}}`,
+			`[DONE]`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+	defer server.Close()
+
+	var pieces []string
+	reply, err := NewOpenAI(OpenAIOptions{BaseURL: server.URL, Model: "local-model"}).
+		GenerateStream(context.Background(), func(text string) { pieces = append(pieces, text) }, genai.Text("hi"))
+	if err != nil {
+		t.Fatalf("GenerateStream: %v", err)
+	}
+	if request["stream"] != true {
+		t.Errorf("request = %v, want it streamed", request)
+	}
+	if want := []string{"Hello", ", world"}; !reflect.DeepEqual(pieces, want) {
+		t.Errorf("pieces = %q, want %q", pieces, want)
+	}
+	if reply.Text != "Hello, world" || reply.FinishReason != "MAX_TOKENS" || reply.PromptTokens != 5 || reply.ResponseTokens != 3 {
+		t.Errorf("reply = %+v", reply)
+	}
+}
+
+func TestOpenAIEmbedDocuments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path != "/embeddings" || body.Model != "embedder" {
+			t.Errorf("request %s for %q", r.URL.Path, body.Model)
+		}
+		var data []any
+		for n := range body.Input {
+			data = append(data, map[string]any{"embedding": []float32{float32(n), 1}})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	defer server.Close()
+
+	o := NewOpenAI(OpenAIOptions{BaseURL: server.URL, EmbeddingModel: "embedder"})
+	vectors, err := o.EmbedDocuments(context.Background(), []string{"first", "second"})
+	if want := [][]float32{{0, 1}, {1, 1}}; err != nil || !reflect.DeepEqual(vectors, want) {
+		t.Errorf("EmbedDocuments = %v, %v, want %v", vectors, err, want)
+	}
+}
+
+func TestToOpenAIContent(t *testing.T) {
+	content := toOpenAIContent([]genai.Part{
+		genai.Text("what is this?"),
+		genai.Blob{MIMEType: "image/png", Data: []byte("png")},
+		genai.Blob{MIMEType: "text/plain", Data: []byte("notes")},
+		genai.Blob{MIMEType: "application/pdf", Data: []byte("%PDF")},
+	})
+	want := []map[string]any{
+		{"type": "text", "text": "what is this?"},
+		{"type": "image_url", "image_url": map[string]any{"url": "data:image/png;base64,cG5n"}},
+		{"type": "text", "text": "notes"},
+		{"type": "text", "text": "[attached application/pdf file, which this model can't read]"},
+	}
+	if !reflect.DeepEqual(content, want) {
+		t.Errorf("toOpenAIContent = %v, want %v", content, want)
+	}
+}
@@ -0,0 +1,175 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Base URL of the Gemini API's REST endpoints
+	geminiAPIBase = "https://generativelanguage.googleapis.com/v1beta/"
+
+	// How long a single REST call may take, image generation included
+	geminiRESTTimeout = 2 * time.Minute
+)
+
+// restAPI calls the Gemini REST endpoints shared by both backends, such as
+// Imagen and text-to-speech, which the Go SDK doesn't cover yet
+type restAPI struct {
+	opts Options
+
+	// URL endpoints such as "models/<model>:predict" are relative to
+	base string
+
+	// send posts a JSON payload to a URL and returns the response body
+	send func(ctx context.Context, url string, payload []byte) ([]byte, error)
+}
+
+// post sends a JSON request to a REST endpoint such as
+// "models/<model>:predict" and decodes the JSON response into out
+func (r *restAPI) post(ctx context.Context, endpoint string, body any, out any) (err error) {
+	start := time.Now()
+	model, _, _ := strings.Cut(strings.TrimPrefix(endpoint, "models/"), ":")
+	defer func() { observeRequest(model, start, err) }()
+
+	return r.call(ctx, endpoint, body, out)
+}
+
+// call is post without recording the request, for callers that record it
+// themselves
+func (r *restAPI) call(ctx context.Context, endpoint string, body any, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error encoding request: %v", err)
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, geminiRESTTimeout)
+	defer cancel()
+
+	respBody, err := r.send(reqCtx, r.base+endpoint, payload)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+	return nil
+}
+
+// sendRequest posts a JSON payload with an HTTP client and returns the
+// response body, authenticating with an API key when one is given
+func sendRequest(ctx context.Context, client *http.Client, url string, apiKey string, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("x-goog-api-key", apiKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling Gemini API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Surface the API's own error message when there is one
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		message := string(respBody)
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error.Message != "" {
+			message = apiErr.Error.Message
+		}
+		return nil, &statusError{code: resp.StatusCode, message: message}
+	}
+	return respBody, nil
+}
+
+// statusError is an error status returned by a Gemini REST endpoint
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("gemini API error (%d): %s", e.code, e.message)
+}
+
+// restContent mirrors the REST API's Content object
+type restContent struct {
+	Role  string     `json:"role,omitempty"`
+	Parts []restPart `json:"parts"`
+}
+
+// restPart mirrors the REST API's Part object
+type restPart struct {
+	Text             string                `json:"text,omitempty"`
+	InlineData       *restBlob             `json:"inlineData,omitempty"`
+	FileData         *restFileData         `json:"fileData,omitempty"`
+	FunctionCall     *restFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *restFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+// restBlob holds base64-encoded inline data such as images or audio
+type restBlob struct {
+	MIMEType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+// restFileData references a file by URI
+type restFileData struct {
+	MIMEType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+// restFunctionCall is a tool call made by the model
+type restFunctionCall struct {
+	Name string         `json:"name"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+// restFunctionResponse is the result of a tool call sent back to the model
+type restFunctionResponse struct {
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+// restGenerateResponse is the subset of a generateContent response the bot uses
+type restGenerateResponse struct {
+	Candidates []struct {
+		Content       restContent `json:"content"`
+		FinishReason  string      `json:"finishReason"`
+		SafetyRatings []struct {
+			Category    string `json:"category"`
+			Probability string `json:"probability"`
+		} `json:"safetyRatings"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int32 `json:"promptTokenCount"`
+		CandidatesTokenCount int32 `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+// parts returns the parts of every candidate in the response
+func (r *restGenerateResponse) parts() []restPart {
+	var parts []restPart
+	for _, cand := range r.Candidates {
+		parts = append(parts, cand.Content.Parts...)
+	}
+	return parts
+}
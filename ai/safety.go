@@ -0,0 +1,99 @@
+package ai
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// sdkEnum is an enum of the Gemini SDK, whose names are like
+// "FinishReasonMaxTokens"
+type sdkEnum interface {
+	~int32
+	String() string
+}
+
+// enumName converts the name of an SDK enum value to the API's form, so
+// "FinishReasonMaxTokens" becomes "MAX_TOKENS"
+func enumName[T sdkEnum](value T, prefix string) string {
+	var sb strings.Builder
+	for n, r := range strings.TrimPrefix(value.String(), prefix) {
+		if n > 0 && unicode.IsUpper(r) {
+			sb.WriteByte('_')
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+	return sb.String()
+}
+
+// parseEnum returns the SDK enum value with an API name such as
+// "MAX_TOKENS", or 0 (unspecified) for names the SDK doesn't know
+func parseEnum[T sdkEnum](name string, prefix string) T {
+	for value := T(1); value < 32; value++ {
+		if enumName(value, prefix) == name {
+			return value
+		}
+	}
+	return 0
+}
+
+// setSafety records why the model stopped and the harm categories it rated
+// at least medium probability, as the verdicts of a reply
+func (r *Reply) setSafety(resp *genai.GenerateContentResponse) {
+	for _, cand := range resp.Candidates {
+		if cand.FinishReason != genai.FinishReasonUnspecified && r.FinishReason == "" {
+			r.FinishReason = enumName(cand.FinishReason, "FinishReason")
+		}
+		for _, rating := range cand.SafetyRatings {
+			if rating.Probability >= genai.HarmProbabilityMedium {
+				r.SafetyFlags = append(r.SafetyFlags, enumName(rating.Category, "HarmCategory")+": "+enumName(rating.Probability, "HarmProbability"))
+			}
+		}
+	}
+	if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != genai.BlockReasonUnspecified {
+		r.FinishReason = "PROMPT_BLOCKED_" + enumName(resp.PromptFeedback.BlockReason, "BlockReason")
+	}
+}
+
+// SafetyLevels are the levels RequestOptions.Safety blocks responses at,
+// from the strictest
+var SafetyLevels = []string{"low", "medium", "high"}
+
+// Harm categories the bot sets safety thresholds for
+var harmCategories = []genai.HarmCategory{
+	genai.HarmCategoryHarassment,
+	genai.HarmCategoryHateSpeech,
+	genai.HarmCategorySexuallyExplicit,
+}
+
+// safetySettings returns the settings blocking responses rated at least as
+// harmful as a safety level, blocking nothing for no or an unknown level
+func safetySettings(level string) []*genai.SafetySetting {
+	threshold := genai.HarmBlockNone
+	switch level {
+	case "low":
+		threshold = genai.HarmBlockLowAndAbove
+	case "medium":
+		threshold = genai.HarmBlockMediumAndAbove
+	case "high":
+		threshold = genai.HarmBlockOnlyHigh
+	}
+	settings := make([]*genai.SafetySetting, 0, len(harmCategories))
+	for _, category := range harmCategories {
+		settings = append(settings, &genai.SafetySetting{Category: category, Threshold: threshold})
+	}
+	return settings
+}
+
+// restSafetySettings returns safetySettings in the REST API's form
+func restSafetySettings(level string) []map[string]string {
+	var settings []map[string]string
+	for _, setting := range safetySettings(level) {
+		settings = append(settings, map[string]string{
+			"category":  "HARM_CATEGORY_" + enumName(setting.Category, "HarmCategory"),
+			"threshold": "BLOCK_" + enumName(setting.Threshold, "HarmBlock"),
+		})
+	}
+	return settings
+}
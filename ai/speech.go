@@ -0,0 +1,80 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Text-to-speech model used by Speak
+const ttsModel = "gemini-2.5-flash-preview-tts"
+
+// Speak converts text to speech with Gemini TTS, returning a WAV file
+func (r *restAPI) Speak(ctx context.Context, text string) ([]byte, error) {
+	var resp restGenerateResponse
+	err := r.post(ctx, "models/"+ttsModel+":generateContent", map[string]any{
+		"contents": []restContent{{Role: "user", Parts: []restPart{{Text: text}}}},
+		"generationConfig": map[string]any{
+			"responseModalities": []string{"AUDIO"},
+			"speechConfig": map[string]any{
+				"voiceConfig": map[string]any{
+					"prebuiltVoiceConfig": map[string]any{"voiceName": r.opts.TTSVoice},
+				},
+			},
+		},
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, part := range resp.parts() {
+		if part.InlineData == nil {
+			continue
+		}
+		pcm, err := base64.StdEncoding.DecodeString(part.InlineData.Data)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding audio: %v", err)
+		}
+		return pcmToWAV(pcm, pcmSampleRate(part.InlineData.MIMEType)), nil
+	}
+	return nil, fmt.Errorf("no audio was generated")
+}
+
+// pcmSampleRate reads the sample rate from a MIME type such as
+// "audio/L16;codec=pcm;rate=24000", defaulting to 24kHz
+func pcmSampleRate(mimeType string) int {
+	for _, param := range strings.Split(mimeType, ";") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(param), "rate="); ok {
+			if rate, err := strconv.Atoi(value); err == nil {
+				return rate
+			}
+		}
+	}
+	return 24000
+}
+
+// pcmToWAV wraps 16-bit mono little-endian PCM samples in a WAV header
+func pcmToWAV(pcm []byte, sampleRate int) []byte {
+	const channels, bitsPerSample = 1, 16
+	byteRate := sampleRate * channels * bitsPerSample / 8
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+len(pcm)))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(1)) // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(channels))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(&buf, binary.LittleEndian, uint32(byteRate))
+	binary.Write(&buf, binary.LittleEndian, uint16(channels*bitsPerSample/8))
+	binary.Write(&buf, binary.LittleEndian, uint16(bitsPerSample))
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(pcm)))
+	buf.Write(pcm)
+	return buf.Bytes()
+}
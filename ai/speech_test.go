@@ -0,0 +1,51 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestPCMSampleRate(t *testing.T) {
+	tests := []struct {
+		mimeType string
+		want     int
+	}{
+		{"audio/L16;codec=pcm;rate=16000", 16000},
+		{"audio/L16; rate=44100", 44100},
+		{"audio/L16;codec=pcm", 24000},
+		{"audio/L16;rate=fast", 24000},
+	}
+	for _, test := range tests {
+		if got := pcmSampleRate(test.mimeType); got != test.want {
+			t.Errorf("pcmSampleRate(%q) = %d, want %d", test.mimeType, got, test.want)
+		}
+	}
+}
+
+func TestPCMToWAV(t *testing.T) {
+	pcm := []byte{1, 2, 3, 4, 5, 6}
+	wav := pcmToWAV(pcm, 24000)
+
+	if len(wav) != 44+len(pcm) {
+		t.Fatalf("WAV is %d bytes, want %d", len(wav), 44+len(pcm))
+	}
+	if string(wav[:4]) != "RIFF" || string(wav[8:16]) != "WAVEfmt " || string(wav[36:40]) != "data" {
+		t.Errorf("bad WAV header %q", wav[:44])
+	}
+	if size := binary.LittleEndian.Uint32(wav[4:]); size != uint32(36+len(pcm)) {
+		t.Errorf("RIFF size = %d, want %d", size, 36+len(pcm))
+	}
+	if rate := binary.LittleEndian.Uint32(wav[24:]); rate != 24000 {
+		t.Errorf("sample rate = %d, want 24000", rate)
+	}
+	if byteRate := binary.LittleEndian.Uint32(wav[28:]); byteRate != 48000 {
+		t.Errorf("byte rate = %d, want 48000", byteRate)
+	}
+	if size := binary.LittleEndian.Uint32(wav[40:]); size != uint32(len(pcm)) {
+		t.Errorf("data size = %d, want %d", size, len(pcm))
+	}
+	if !bytes.Equal(wav[44:], pcm) {
+		t.Error("samples weren't copied")
+	}
+}
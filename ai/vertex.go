@@ -0,0 +1,244 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"golang.org/x/oauth2/google"
+)
+
+// OAuth scope Vertex AI requests are authorized with
+const vertexScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// Vertex is the Client backed by Gemini on Vertex AI, billed to a Google
+// Cloud project and authorized with Application Default Credentials
+type Vertex struct {
+	restAPI
+	chatModel
+}
+
+// Vertex must implement Client
+var _ Client = (*Vertex)(nil)
+
+// NewVertex creates a Vertex AI client for opts.VertexProject and
+// opts.VertexLocation
+func NewVertex(ctx context.Context, opts Options) (*Vertex, error) {
+	if opts.VertexProject == "" {
+		return nil, errors.New("no Vertex AI project configured")
+	}
+	client, err := google.DefaultClient(ctx, vertexScope)
+	if err != nil {
+		return nil, fmt.Errorf("error finding Google Cloud credentials: %v", err)
+	}
+
+	// The global location has no regional host
+	host := opts.VertexLocation + "-aiplatform.googleapis.com"
+	if opts.VertexLocation == "global" {
+		host = "aiplatform.googleapis.com"
+	}
+	base := fmt.Sprintf("https://%s/v1/projects/%s/locations/%s/publishers/google/", host, opts.VertexProject, opts.VertexLocation)
+
+	v := &Vertex{restAPI: restAPI{
+		opts: opts,
+		base: base,
+		send: func(ctx context.Context, url string, payload []byte) ([]byte, error) {
+			return sendRequest(ctx, client, url, "", payload)
+		},
+	}}
+	v.SetModel(opts.Model)
+	return v, nil
+}
+
+// Close releases nothing, Vertex requests don't hold connections open
+func (v *Vertex) Close() error {
+	return nil
+}
+
+// CacheContext isn't supported on Vertex AI yet
+func (v *Vertex) CacheContext(ctx context.Context, paths []string, instructions string, model string) error {
+	if len(paths) == 0 && instructions == "" {
+		return nil
+	}
+	return errors.New("context caching isn't supported with Vertex AI")
+}
+
+// generate sends contents to the chat model, or the one of the context's
+// request options, with JSON output when json is set, matching schema when
+// there is one. It returns the response and the model that answered.
+func (v *Vertex) generate(ctx context.Context, contents []*genai.Content, json bool, schema *genai.Schema, tools []*genai.Tool) (*genai.GenerateContentResponse, string, error) {
+	opts := requestOptions(ctx)
+	model := opts.model(v.Model())
+	body := map[string]any{
+		"contents":       toRESTContents(contents),
+		"safetySettings": restSafetySettings(opts.Safety),
+	}
+	config := map[string]any{}
+	if json {
+		config["responseMimeType"] = "application/json"
+		if schema != nil {
+			config["responseSchema"] = toRESTSchema(schema)
+		}
+	}
+	if opts.MaxOutputTokens > 0 {
+		config["maxOutputTokens"] = opts.MaxOutputTokens
+	}
+	if len(config) > 0 {
+		body["generationConfig"] = config
+	}
+	if len(tools) > 0 {
+		body["tools"] = toRESTTools(tools)
+	}
+
+	var resp restGenerateResponse
+	start := time.Now()
+	err := v.call(ctx, "models/"+model+":generateContent", body, &resp)
+	if err != nil {
+		observeResponse(model, start, nil, err)
+		return nil, model, err
+	}
+	sdkResp := resp.toSDKResponse()
+	observeResponse(model, start, sdkResp, nil)
+	return sdkResp, model, nil
+}
+
+// NewChat starts a chat session, which can call the chat tools
+func (v *Vertex) NewChat() Chat {
+	return &vertexChat{vertex: v}
+}
+
+// Generate sends a one-off prompt and returns the reply
+func (v *Vertex) Generate(ctx context.Context, parts ...genai.Part) (*Reply, error) {
+	resp, model, err := v.generate(ctx, []*genai.Content{genai.NewUserContent(parts...)}, false, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newReply(model, resp), nil
+}
+
+// GenerateJSON sends a one-off prompt and returns a reply whose text is JSON
+// matching schema, or any JSON when schema is nil
+func (v *Vertex) GenerateJSON(ctx context.Context, schema *genai.Schema, parts ...genai.Part) (*Reply, error) {
+	resp, model, err := v.generate(ctx, []*genai.Content{genai.NewUserContent(parts...)}, true, schema, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newReply(model, resp), nil
+}
+
+// GenerateStream sends a one-off prompt and passes the answer's text to
+// onText in one piece, as Vertex requests aren't streamed yet
+func (v *Vertex) GenerateStream(ctx context.Context, onText func(text string), parts ...genai.Part) (*Reply, error) {
+	reply, err := v.Generate(ctx, parts...)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Text != "" {
+		onText(reply.Text)
+	}
+	return reply, nil
+}
+
+// CountTokens returns the number of tokens the parts take up
+func (v *Vertex) CountTokens(ctx context.Context, parts ...genai.Part) (int, error) {
+	var resp struct {
+		TotalTokens int `json:"totalTokens"`
+	}
+	err := v.call(ctx, "models/"+requestOptions(ctx).model(v.Model())+":countTokens", map[string]any{
+		"contents": toRESTContents([]*genai.Content{genai.NewUserContent(parts...)}),
+	}, &resp)
+	if err != nil {
+		return 0, err
+	}
+	return resp.TotalTokens, nil
+}
+
+// vertexEmbeddingResponse is the subset of an embedding predict response the bot uses
+type vertexEmbeddingResponse struct {
+	Predictions []struct {
+		Embeddings struct {
+			Values []float32 `json:"values"`
+		} `json:"embeddings"`
+	} `json:"predictions"`
+}
+
+// embed embeds texts for a retrieval task type
+func (v *Vertex) embed(ctx context.Context, texts []string, taskType string) ([][]float32, error) {
+	var vectors [][]float32
+	for start := 0; start < len(texts); start += maxEmbeddingBatch {
+		var instances []map[string]string
+		for _, text := range texts[start:min(start+maxEmbeddingBatch, len(texts))] {
+			instances = append(instances, map[string]string{"content": text, "task_type": taskType})
+		}
+		var resp vertexEmbeddingResponse
+		err := v.post(ctx, "models/"+embeddingModelName+":predict", map[string]any{"instances": instances}, &resp)
+		if err != nil {
+			return nil, err
+		}
+		for _, prediction := range resp.Predictions {
+			vectors = append(vectors, prediction.Embeddings.Values)
+		}
+	}
+	return vectors, nil
+}
+
+// EmbedDocuments embeds texts that will be searched later
+func (v *Vertex) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors, err := v.embed(ctx, texts, "RETRIEVAL_DOCUMENT")
+	if err != nil {
+		return nil, fmt.Errorf("error embedding documents: %v", err)
+	}
+	return vectors, nil
+}
+
+// EmbedQuery embeds a search query
+func (v *Vertex) EmbedQuery(ctx context.Context, query string) ([]float32, error) {
+	vectors, err := v.embed(ctx, []string{query}, "RETRIEVAL_QUERY")
+	if err != nil {
+		return nil, fmt.Errorf("error embedding query: %v", err)
+	}
+	if len(vectors) == 0 {
+		return nil, errors.New("error embedding query: no embedding returned")
+	}
+	return vectors[0], nil
+}
+
+// UploadFile returns the file as inline data, Vertex AI has no File API
+// and reads files from Cloud Storage instead
+func (v *Vertex) UploadFile(ctx context.Context, data []byte, mimeType string, displayName string) (genai.Part, error) {
+	return genai.Blob{MIMEType: mimeType, Data: data}, nil
+}
+
+// vertexChat is a Chat backed by Vertex AI, which keeps no server-side
+// session, so every message is sent along with the history
+type vertexChat struct {
+	vertex  *Vertex
+	history []*genai.Content
+}
+
+// Send sends a message and returns the model's reply
+func (c *vertexChat) Send(ctx context.Context, parts ...genai.Part) (*Reply, error) {
+	contents := slices.Concat(c.history, []*genai.Content{genai.NewUserContent(parts...)})
+	resp, model, err := c.vertex.generate(ctx, contents, false, nil, c.vertex.opts.ChatTools)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Candidates) > 0 {
+		contents = append(contents, resp.Candidates[0].Content)
+	}
+	c.history = contents
+	return newReply(model, resp), nil
+}
+
+// History returns the conversation so far
+func (c *vertexChat) History() []*genai.Content {
+	return c.history
+}
+
+// SetHistory replaces the conversation so far
+func (c *vertexChat) SetHistory(history []*genai.Content) {
+	c.history = history
+}
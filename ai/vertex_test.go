@@ -0,0 +1,229 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// testVertex returns a Vertex client talking to a test server, which records
+// the requests it receives
+func testVertex(t *testing.T, handler func(path string, body map[string]any) any) *Vertex {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		json.NewEncoder(w).Encode(handler(r.URL.Path, body))
+	}))
+	t.Cleanup(server.Close)
+
+	v := &Vertex{restAPI: restAPI{
+		opts: Options{ChatTools: []*genai.Tool{{FunctionDeclarations: []*genai.FunctionDeclaration{{Name: "remember"}}}}},
+		base: server.URL + "/",
+		send: func(ctx context.Context, url string, payload []byte) ([]byte, error) {
+			return sendRequest(ctx, server.Client(), url, "", payload)
+		},
+	}}
+	v.SetModel("gemini-test")
+	return v
+}
+
+func TestVertexChat(t *testing.T) {
+	var requests []map[string]any
+	v := testVertex(t, func(path string, body map[string]any) any {
+		if path != "/models/gemini-test:generateContent" {
+			t.Errorf("path = %q", path)
+		}
+		requests = append(requests, body)
+		return map[string]any{
+			"candidates": []any{map[string]any{"content": map[string]any{
+				"role":  "model",
+				"parts": []any{map[string]any{"text": "hi alice"}},
+			}}},
+			"usageMetadata": map[string]any{"promptTokenCount": 12, "candidatesTokenCount": 3},
+		}
+	})
+
+	chat := v.NewChat()
+	for _, message := range []string{"hi, I'm alice", "what's my name?"} {
+		reply, err := chat.Send(context.Background(), genai.Text(message))
+		if err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		if reply.Text != "hi alice" || reply.PromptTokens != 12 || reply.ResponseTokens != 3 {
+			t.Errorf("reply = %+v", reply)
+		}
+	}
+
+	// The second request carries the first exchange
+	if contents := requests[1]["contents"].([]any); len(contents) != 3 {
+		t.Errorf("second request sent %d contents, want 3", len(contents))
+	}
+	if _, ok := requests[0]["tools"]; !ok {
+		t.Error("chat request didn't declare the chat tools")
+	}
+	if got := len(chat.History()); got != 4 {
+		t.Errorf("history has %d entries, want 4", got)
+	}
+}
+
+func TestVertexSetModel(t *testing.T) {
+	var paths []string
+	v := testVertex(t, func(path string, body map[string]any) any {
+		paths = append(paths, path)
+		return map[string]any{"candidates": []any{}}
+	})
+
+	chat := v.NewChat()
+	for _, model := range []string{"gemini-test", "gemini-other"} {
+		v.SetModel(model)
+		if _, err := chat.Send(context.Background(), genai.Text("hello")); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	// A chat started before the switch moves to the new model
+	want := []string{"/models/gemini-test:generateContent", "/models/gemini-other:generateContent"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("paths = %q, want %q", paths, want)
+	}
+}
+
+func TestVertexRequestOptions(t *testing.T) {
+	var path string
+	var safety, config any
+	v := testVertex(t, func(p string, body map[string]any) any {
+		path, safety, config = p, body["safetySettings"], body["generationConfig"]
+		return map[string]any{"candidates": []any{}}
+	})
+
+	ctx := WithRequestOptions(context.Background(), RequestOptions{Model: "gemini-flash", Safety: "medium", MaxOutputTokens: 400})
+	reply, err := v.NewChat().Send(ctx, genai.Text("hello"))
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if path != "/models/gemini-flash:generateContent" || reply.Model != "gemini-flash" {
+		t.Errorf("answered by %q at %s, want gemini-flash", reply.Model, path)
+	}
+	want := []any{
+		map[string]any{"category": "HARM_CATEGORY_HARASSMENT", "threshold": "BLOCK_MEDIUM_AND_ABOVE"},
+		map[string]any{"category": "HARM_CATEGORY_HATE_SPEECH", "threshold": "BLOCK_MEDIUM_AND_ABOVE"},
+		map[string]any{"category": "HARM_CATEGORY_SEXUALLY_EXPLICIT", "threshold": "BLOCK_MEDIUM_AND_ABOVE"},
+	}
+	if !reflect.DeepEqual(safety, want) {
+		t.Errorf("safety settings = %v, want %v", safety, want)
+	}
+	if !reflect.DeepEqual(config, map[string]any{"maxOutputTokens": float64(400)}) {
+		t.Errorf("generation config = %v, want the answer's token limit", config)
+	}
+
+	// Without options requests keep the backend's model and block nothing
+	if _, err := v.Generate(context.Background(), genai.Text("hello")); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if path != "/models/gemini-test:generateContent" || safety.([]any)[0].(map[string]any)["threshold"] != "BLOCK_NONE" || config != nil {
+		t.Errorf("without options: %s, %v, %v", path, safety, config)
+	}
+}
+
+func TestVertexGenerateError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error": {"message": "Quota exceeded"}}`))
+	}))
+	defer server.Close()
+	v := &Vertex{restAPI: restAPI{
+		base: server.URL + "/",
+		send: func(ctx context.Context, url string, payload []byte) ([]byte, error) {
+			return sendRequest(ctx, server.Client(), url, "", payload)
+		},
+	}}
+	v.SetModel("gemini-test")
+
+	_, err := v.Generate(context.Background(), genai.Text("hello"))
+	if err == nil || err.Error() != "gemini API error (429): Quota exceeded" {
+		t.Errorf("Generate error = %v", err)
+	}
+}
+
+func TestVertexEmbedQuery(t *testing.T) {
+	v := testVertex(t, func(path string, body map[string]any) any {
+		instance := body["instances"].([]any)[0].(map[string]any)
+		if path != "/models/"+embeddingModelName+":predict" || instance["task_type"] != "RETRIEVAL_QUERY" {
+			t.Errorf("request %s %v", path, body)
+		}
+		return map[string]any{"predictions": []any{
+			map[string]any{"embeddings": map[string]any{"values": []float32{0.5, 1}}},
+		}}
+	})
+
+	vector, err := v.EmbedQuery(context.Background(), "when is the meeting?")
+	if err != nil || !reflect.DeepEqual(vector, []float32{0.5, 1}) {
+		t.Errorf("EmbedQuery = %v, %v", vector, err)
+	}
+}
+
+func TestToRESTSchema(t *testing.T) {
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"language": {Type: genai.TypeString, Description: "Detected language"},
+			"tags":     {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+		},
+		Required: []string{"language"},
+	}
+	want := map[string]any{
+		"type": "OBJECT",
+		"properties": map[string]any{
+			"language": map[string]any{"type": "STRING", "description": "Detected language"},
+			"tags":     map[string]any{"type": "ARRAY", "items": map[string]any{"type": "STRING"}},
+		},
+		"required": []string{"language"},
+	}
+	if got := toRESTSchema(schema); !reflect.DeepEqual(got, want) {
+		t.Errorf("toRESTSchema = %v, want %v", got, want)
+	}
+}
+
+func TestRESTPartsRoundTrip(t *testing.T) {
+	parts := []genai.Part{
+		genai.Text("look"),
+		genai.Blob{MIMEType: "image/png", Data: []byte{1, 2, 3}},
+		genai.FunctionCall{Name: "remember", Args: map[string]any{"fact": "likes Go"}},
+	}
+	if got := fromRESTParts(toRESTParts(parts)); !reflect.DeepEqual(got, parts) {
+		t.Errorf("round trip = %v, want %v", got, parts)
+	}
+}
+
+func TestVertexSafetyVerdicts(t *testing.T) {
+	v := testVertex(t, func(path string, body map[string]any) any {
+		return map[string]any{"candidates": []any{map[string]any{
+			"content":      map[string]any{"role": "model", "parts": []any{}},
+			"finishReason": "SAFETY",
+			"safetyRatings": []any{
+				map[string]any{"category": "HARM_CATEGORY_HARASSMENT", "probability": "HIGH"},
+				map[string]any{"category": "HARM_CATEGORY_HATE_SPEECH", "probability": "LOW"},
+				map[string]any{"category": "HARM_CATEGORY_DANGEROUS_CONTENT", "probability": "MEDIUM"},
+			},
+		}}}
+	})
+
+	reply, err := v.Generate(context.Background(), genai.Text("hello"))
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if reply.FinishReason != "SAFETY" {
+		t.Errorf("FinishReason = %q, want SAFETY", reply.FinishReason)
+	}
+	if want := []string{"HARASSMENT: HIGH", "DANGEROUS_CONTENT: MEDIUM"}; !slices.Equal(reply.SafetyFlags, want) {
+		t.Errorf("SafetyFlags = %q, want %q", reply.SafetyFlags, want)
+	}
+}
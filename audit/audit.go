@@ -0,0 +1,153 @@
+// Package audit records the prompts the bot sends and the responses it gets,
+// for moderators and abuse investigations.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"time"
+)
+
+// How often entries past the retention period are deleted
+const pruneInterval = time.Hour
+
+// Discord user mentions, such as <@123> or <@!123>
+var mentionPattern = regexp.MustCompile(`<@!?(\d+)>`)
+
+// Entry is one prompt and the response to it
+type Entry struct {
+	Time     time.Time `json:"time"`
+	UserID   string    `json:"user_id"`
+	GuildID  string    `json:"guild_id,omitempty"`
+	Model    string    `json:"model,omitempty"`
+	Prompt   string    `json:"prompt"`
+	Response string    `json:"response,omitempty"`
+
+	// Safety verdicts: why the model stopped and the harm categories it
+	// flagged, as in ai.Reply
+	FinishReason string   `json:"finish_reason,omitempty"`
+	SafetyFlags  []string `json:"safety_flags,omitempty"`
+
+	// Error returned instead of a response
+	Error string `json:"error,omitempty"`
+}
+
+// Sink stores audit entries
+type Sink interface {
+	// Write stores an entry
+	Write(e Entry) error
+
+	// Prune deletes entries older than before, returning how many it deleted
+	Prune(before time.Time) (int, error)
+
+	// UserEntries returns the entries of a user, oldest first
+	UserEntries(userID string) ([]Entry, error)
+
+	// Forget deletes the entries of a user, returning how many it deleted
+	Forget(userID string) (int, error)
+}
+
+// Options configures an audit log
+type Options struct {
+	// Replace user and guild IDs, including mentions, with pseudonyms
+	// derived from Salt, so entries by the same user can still be told apart
+	Anonymize bool
+	Salt      string
+
+	// How long entries are kept, forever when 0
+	Retention time.Duration
+}
+
+// Log records entries to a sink
+type Log struct {
+	sink Sink
+	opts Options
+}
+
+// New creates an audit log writing to sink
+func New(sink Sink, opts Options) *Log {
+	return &Log{sink: sink, opts: opts}
+}
+
+// Record stores an entry, anonymizing it first if configured. Failures are
+// logged rather than returned, auditing never stops the bot from answering.
+func (l *Log) Record(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if l.opts.Anonymize {
+		e.UserID = l.pseudonym(e.UserID)
+		e.GuildID = l.pseudonym(e.GuildID)
+		e.Prompt = l.anonymizeMentions(e.Prompt)
+		e.Response = l.anonymizeMentions(e.Response)
+	}
+	if err := l.sink.Write(e); err != nil {
+		slog.Error("Error writing audit entry", "error", err)
+	}
+}
+
+// UserEntries returns the entries recorded for a user
+func (l *Log) UserEntries(userID string) ([]Entry, error) {
+	return l.sink.UserEntries(l.userKey(userID))
+}
+
+// Forget deletes the entries recorded for a user, returning how many it deleted
+func (l *Log) Forget(userID string) (int, error) {
+	return l.sink.Forget(l.userKey(userID))
+}
+
+// userKey returns the ID a user's entries are stored under
+func (l *Log) userKey(userID string) string {
+	if l.opts.Anonymize {
+		return l.pseudonym(userID)
+	}
+	return userID
+}
+
+// pseudonym returns a stable stand-in for a Discord ID
+func (l *Log) pseudonym(id string) string {
+	if id == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(l.opts.Salt + id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// anonymizeMentions replaces the user IDs of mentions in text with pseudonyms
+func (l *Log) anonymizeMentions(text string) string {
+	return mentionPattern.ReplaceAllStringFunc(text, func(mention string) string {
+		return "<@" + l.pseudonym(mentionPattern.FindStringSubmatch(mention)[1]) + ">"
+	})
+}
+
+// Run deletes entries past the retention period until ctx is done
+func (l *Log) Run(ctx context.Context) {
+	if l.opts.Retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		l.prune()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// prune deletes entries past the retention period
+func (l *Log) prune() {
+	deleted, err := l.sink.Prune(time.Now().Add(-l.opts.Retention))
+	if err != nil {
+		slog.Error("Error pruning audit log", "error", err)
+		return
+	}
+	if deleted > 0 {
+		slog.Info("Pruned audit log", "deleted", deleted)
+	}
+}
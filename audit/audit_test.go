@@ -0,0 +1,170 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// memorySink keeps entries in memory
+type memorySink struct {
+	entries []Entry
+}
+
+func (m *memorySink) Write(e Entry) error {
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+func (m *memorySink) Prune(time.Time) (int, error) {
+	return 0, nil
+}
+
+func (m *memorySink) UserEntries(userID string) ([]Entry, error) {
+	var entries []Entry
+	for _, e := range m.entries {
+		if e.UserID == userID {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (m *memorySink) Forget(userID string) (int, error) {
+	kept := m.entries[:0]
+	for _, e := range m.entries {
+		if e.UserID != userID {
+			kept = append(kept, e)
+		}
+	}
+	deleted := len(m.entries) - len(kept)
+	m.entries = kept
+	return deleted, nil
+}
+
+func TestRecordKeepsIDs(t *testing.T) {
+	sink := &memorySink{}
+	New(sink, Options{}).Record(Entry{UserID: "123", GuildID: "789", Prompt: "ask <@!456> about it"})
+
+	e := sink.entries[0]
+	if e.Time.IsZero() {
+		t.Error("entry has no time")
+	}
+	if e.UserID != "123" || e.GuildID != "789" || e.Prompt != "ask <@!456> about it" {
+		t.Errorf("entry = %+v, want it unchanged", e)
+	}
+}
+
+func TestRecordAnonymizes(t *testing.T) {
+	sink := &memorySink{}
+	log := New(sink, Options{Anonymize: true, Salt: "salt"})
+	log.Record(Entry{UserID: "123", GuildID: "789", Prompt: "ask <@!456> about it"})
+	log.Record(Entry{UserID: "456", Prompt: "hi"})
+
+	// Pseudonyms hide IDs but stay the same for the same user
+	e, mentioned := sink.entries[0], sink.entries[1].UserID
+	if e.UserID == "123" || e.GuildID == "789" || len(e.UserID) != 16 {
+		t.Errorf("IDs weren't anonymized: %+v", e)
+	}
+	if e.Prompt != "ask <@"+mentioned+"> about it" {
+		t.Errorf("prompt = %q, want the mention replaced by %q", e.Prompt, mentioned)
+	}
+}
+
+func TestForgetAnonymizedUser(t *testing.T) {
+	sink := &memorySink{}
+	log := New(sink, Options{Anonymize: true, Salt: "salt"})
+	log.Record(Entry{UserID: "123", Prompt: "one"})
+	log.Record(Entry{UserID: "456", Prompt: "two"})
+
+	// Users are found by their real ID
+	if entries, err := log.UserEntries("123"); err != nil || len(entries) != 1 || entries[0].Prompt != "one" {
+		t.Errorf("UserEntries = %+v, %v, want the first entry", entries, err)
+	}
+	if deleted, err := log.Forget("123"); err != nil || deleted != 1 {
+		t.Errorf("Forget = %d, %v, want 1 deleted", deleted, err)
+	}
+	if len(sink.entries) != 1 || sink.entries[0].Prompt != "two" {
+		t.Errorf("entries left = %+v, want the second one", sink.entries)
+	}
+}
+
+func TestFileForget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer f.Close()
+
+	for _, e := range []Entry{{UserID: "alice", Prompt: "one"}, {UserID: "bob", Prompt: "two"}, {UserID: "alice", Prompt: "three"}} {
+		if err := f.Write(e); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if entries, err := f.UserEntries("alice"); err != nil || len(entries) != 2 {
+		t.Errorf("UserEntries = %+v, %v, want 2 entries", entries, err)
+	}
+	if deleted, err := f.Forget("alice"); err != nil || deleted != 2 {
+		t.Fatalf("Forget = %d, %v, want 2 deleted", deleted, err)
+	}
+	if got := readPrompts(t, path); len(got) != 1 || got[0] != "two" {
+		t.Errorf("file holds %q, want [two]", got)
+	}
+}
+
+func TestFilePrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer f.Close()
+
+	now := time.Now()
+	for _, e := range []Entry{
+		{Time: now.Add(-48 * time.Hour), Prompt: "old"},
+		{Time: now, Prompt: "recent"},
+	} {
+		if err := f.Write(e); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	deleted, err := f.Prune(now.Add(-24 * time.Hour))
+	if err != nil || deleted != 1 {
+		t.Fatalf("Prune = %d, %v, want 1 deleted", deleted, err)
+	}
+
+	// Writes after pruning land in the rewritten file
+	if err := f.Write(Entry{Time: now, Prompt: "later"}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got := readPrompts(t, path); len(got) != 2 || got[0] != "recent" || got[1] != "later" {
+		t.Errorf("file holds %q, want [recent later]", got)
+	}
+}
+
+// readPrompts returns the prompts of the entries in a JSONL file
+func readPrompts(t *testing.T, path string) []string {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer file.Close()
+
+	var prompts []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("decoding %q: %v", scanner.Text(), err)
+		}
+		prompts = append(prompts, e.Prompt)
+	}
+	return prompts
+}
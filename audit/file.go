@@ -0,0 +1,148 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// File is a Sink appending entries to a JSONL file, one JSON object per line
+type File struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// OpenFile opens or creates the JSONL file at path
+func OpenFile(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit file: %v", err)
+	}
+	return &File{path: path, f: f}, nil
+}
+
+// Write appends an entry to the file
+func (f *File) Write(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error encoding audit entry: %v", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err = f.f.Write(append(line, '\n'))
+	return err
+}
+
+// Prune rewrites the file without the entries older than before
+func (f *File) Prune(before time.Time) (int, error) {
+	return f.rewrite(func(e Entry) bool { return e.Time.Before(before) })
+}
+
+// Forget rewrites the file without the entries of a user
+func (f *File) Forget(userID string) (int, error) {
+	return f.rewrite(func(e Entry) bool { return e.UserID == userID })
+}
+
+// UserEntries returns the entries of a user
+func (f *File) UserEntries(userID string) ([]Entry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var entries []Entry
+	err := f.scan(func(line []byte, e *Entry) error {
+		if e != nil && e.UserID == userID {
+			entries = append(entries, *e)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// scan calls fn with every line of the file and the entry on it, or nil
+// for lines that can't be read
+func (f *File) scan(fn func(line []byte, e *Entry) error) error {
+	in, err := os.Open(f.path)
+	if err != nil {
+		return fmt.Errorf("error reading audit file: %v", err)
+	}
+	defer in.Close()
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var e Entry
+		entry := &e
+		if json.Unmarshal(scanner.Bytes(), entry) != nil {
+			entry = nil
+		}
+		if err := fn(scanner.Bytes(), entry); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading audit file: %v", err)
+	}
+	return nil
+}
+
+// rewrite rewrites the file without the entries drop matches, returning how
+// many it dropped. Lines that can't be read are kept rather than lost.
+func (f *File) rewrite(drop func(e Entry) bool) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), ".audit-*")
+	if err != nil {
+		return 0, fmt.Errorf("error creating audit file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	dropped := 0
+	err = f.scan(func(line []byte, e *Entry) error {
+		if e != nil && drop(*e) {
+			dropped++
+			return nil
+		}
+		if _, err := tmp.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("error writing audit file: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("error writing audit file: %v", err)
+	}
+	if dropped == 0 {
+		return 0, nil
+	}
+
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return 0, fmt.Errorf("error replacing audit file: %v", err)
+	}
+	if err := os.Chmod(f.path, 0o600); err != nil {
+		return 0, fmt.Errorf("error replacing audit file: %v", err)
+	}
+	// Appends must go to the new file
+	f.f.Close()
+	f.f, err = os.OpenFile(f.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return dropped, fmt.Errorf("error reopening audit file: %v", err)
+	}
+	return dropped, nil
+}
+
+// Close closes the file
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.f.Close()
+}
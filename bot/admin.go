@@ -0,0 +1,162 @@
+package bot
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+// Sent instead of an answer while the bot is in maintenance mode
+const maintenanceMessage = "The bot is down for maintenance, please try again later."
+
+// adminCommand handles the /admin subcommands, which only the bot owner may use
+func (b *Bot) adminCommand(i *discordgo.InteractionCreate) {
+	owner := b.config().OwnerID
+	if owner == "" || interactionUserID(i) != owner {
+		b.respondEphemeral(i, tr(i, "Only the bot owner can use this command."))
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	switch subcommand.Name {
+	case "reload":
+		b.adminReload(i)
+	case "stats":
+		b.respondEphemeral(i, b.runtimeStats(i))
+	case "model":
+		b.adminModel(i, commandOption(subcommand.Options, "name").StringValue())
+	case "leave":
+		b.adminLeave(i, commandOption(subcommand.Options, "server").StringValue())
+	case "broadcast":
+		b.adminBroadcast(i, commandOption(subcommand.Options, "message").StringValue())
+	case "maintenance":
+		b.adminMaintenance(i, commandOption(subcommand.Options, "mode").StringValue() == "on")
+	}
+}
+
+// adminReload re-reads the configuration
+func (b *Bot) adminReload(i *discordgo.InteractionCreate) {
+	if b.reload == nil {
+		b.respondEphemeral(i, tr(i, "Reloading isn't available."))
+		return
+	}
+	if err := b.reload(); err != nil {
+		interactionLogger(i).Error("Error reloading configuration", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v\nThe current configuration was kept.", err))
+		return
+	}
+	interactionLogger(i).Info("Reloaded configuration from /admin")
+	b.respondEphemeral(i, tr(i, "Configuration reloaded."))
+}
+
+// runtimeStats describes the bot's uptime, servers, goroutines, memory and
+// request queues, in the language of the user of an interaction
+func (b *Bot) runtimeStats(i *discordgo.InteractionCreate) string {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	var sb strings.Builder
+	sb.WriteString(tr(i, "**Runtime**\nUptime: %s\nServers: %d\nGoroutines: %d\nMemory: %.1f MiB heap, %.1f MiB from the OS\n",
+		time.Since(b.started).Round(time.Second), len(b.session.Guilds()), runtime.NumGoroutine(),
+		float64(mem.HeapAlloc)/(1<<20), float64(mem.Sys)/(1<<20)))
+	if b.maintenance.Load() {
+		sb.WriteString(tr(i, "Maintenance mode: on") + "\n")
+	}
+
+	names := make([]string, 0, len(b.providers))
+	for name := range b.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	sb.WriteString("\n" + tr(i, "**Providers**"))
+	for _, name := range names {
+		client := b.providers[name]
+		running, waiting := ai.Queue(client)
+		fmt.Fprintf(&sb, "\n`%s`", name)
+		if switcher, ok := ai.Unwrap(client).(ai.ModelSwitcher); ok {
+			fmt.Fprintf(&sb, " (%s)", switcher.Model())
+		}
+		sb.WriteString(": " + tr(i, "%d running, %d waiting", running, waiting))
+		if ai.BreakerOpen(client) {
+			sb.WriteString(", " + tr(i, "circuit breaker open"))
+		}
+	}
+	return sb.String()
+}
+
+// adminModel switches the default provider's chat model, until the next
+// reload or restart
+func (b *Bot) adminModel(i *discordgo.InteractionCreate, name string) {
+	switcher, ok := ai.Unwrap(b.ai).(ai.ModelSwitcher)
+	if !ok {
+		b.respondEphemeral(i, tr(i, "The default provider's model can't be switched."))
+		return
+	}
+	previous := switcher.Model()
+	switcher.SetModel(name)
+	b.updatePresence()
+	interactionLogger(i).Info("Switched model", "from", previous, "to", name)
+	b.respondEphemeral(i, tr(i, "Switched from `%s` to `%s` until the next reload or restart.", previous, name))
+}
+
+// adminLeave makes the bot leave a server
+func (b *Bot) adminLeave(i *discordgo.InteractionCreate, guildID string) {
+	if err := b.session.GuildLeave(guildID); err != nil {
+		interactionLogger(i).Error("Error leaving guild", "target_guild", guildID, "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	interactionLogger(i).Info("Left guild", "target_guild", guildID)
+	b.respondEphemeral(i, tr(i, "Left server `%s`.", guildID))
+}
+
+// adminBroadcast posts a maintenance notice in the system channel of every
+// server that has one
+func (b *Bot) adminBroadcast(i *discordgo.InteractionCreate, message string) {
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to admin command", "error", err)
+		return
+	}
+
+	guilds := b.session.Guilds()
+	sent := 0
+	for _, guild := range guilds {
+		if guild.SystemChannelID == "" {
+			continue
+		}
+		_, err := b.session.ChannelMessageSend(guild.SystemChannelID, "🔧 **Maintenance notice:** "+message)
+		if err != nil {
+			interactionLogger(i).Warn("Error sending maintenance notice", "target_guild", guild.ID, "error", err)
+			continue
+		}
+		sent++
+	}
+	interactionLogger(i).Info("Broadcast maintenance notice", "sent", sent, "guilds", len(guilds))
+	b.editInteractionResponse(i, tr(i, "Posted the notice in %d of %d servers.", sent, len(guilds)))
+}
+
+// adminMaintenance turns maintenance mode on or off, until the next restart.
+// While it is on, new AI requests are refused with a notice and requests
+// already running finish.
+func (b *Bot) adminMaintenance(i *discordgo.InteractionCreate, on bool) {
+	b.maintenance.Store(on)
+	b.updatePresence()
+	interactionLogger(i).Info("Switched maintenance mode", "on", on)
+	if !on {
+		b.respondEphemeral(i, tr(i, "Maintenance mode is off, the bot answers again."))
+		return
+	}
+
+	running := 0
+	for _, client := range b.providers {
+		n, _ := ai.Queue(client)
+		running += n
+	}
+	b.respondEphemeral(i, tr(i, "Maintenance mode is on until the next restart: new AI requests are refused, and the %d running will finish.", running))
+}
@@ -0,0 +1,136 @@
+package bot
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+// switchableAI is a fake client whose model can be switched
+type switchableAI struct {
+	*fakeAI
+	model string
+}
+
+func (s *switchableAI) Model() string {
+	return s.model
+}
+
+func (s *switchableAI) SetModel(name string) {
+	s.model = name
+}
+
+// adminInteraction is an /admin subcommand sent by a user in a DM
+func adminInteraction(userID, subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type: discordgo.InteractionApplicationCommand,
+		User: &discordgo.User{ID: userID},
+		Data: discordgo.ApplicationCommandInteractionData{
+			Name: "admin",
+			Options: []*discordgo.ApplicationCommandInteractionDataOption{
+				{Name: subcommand, Type: discordgo.ApplicationCommandOptionSubCommand, Options: options},
+			},
+		},
+	}}
+}
+
+// stringOption is a string option of a slash command
+func stringOption(name, value string) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Name: name, Type: discordgo.ApplicationCommandOptionString, Value: value}
+}
+
+func TestAdminCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		interaction *discordgo.InteractionCreate
+		reloadErr   error
+		want        string
+	}{
+		{"not the owner", adminInteraction("user", "reload"), nil, "Only the bot owner can use this command."},
+		{"reload", adminInteraction("owner", "reload"), nil, "Configuration reloaded."},
+		{"invalid reload", adminInteraction("owner", "reload"), errors.New("bad file"), "Sorry, an error occurred: bad file\nThe current configuration was kept."},
+		{"model", adminInteraction("owner", "model", stringOption("name", "gemini-flash")), nil, "Switched from `gemini-pro` to `gemini-flash` until the next reload or restart."},
+		{"leave", adminInteraction("owner", "leave", stringOption("server", "other")), nil, "Left server `other`."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &switchableAI{fakeAI: &fakeAI{}, model: "gemini-pro"}
+			b, session := newTestBot(t, client)
+			b.config().OwnerID = "owner"
+			b.SetReload(func() error { return test.reloadErr })
+
+			b.HandleInteraction(test.interaction)
+			if len(session.responses) != 1 || session.responses[0].Data.Content != test.want {
+				t.Errorf("responded %v, want %q", session.responses, test.want)
+			}
+		})
+	}
+}
+
+func TestAdminLeaveAndStats(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+	b.config().OwnerID = "owner"
+	session.guilds = []*discordgo.Guild{{ID: "one", SystemChannelID: "general"}, {ID: "two"}}
+
+	b.HandleInteraction(adminInteraction("owner", "leave", stringOption("server", "two")))
+	if !slices.Equal(session.left, []string{"two"}) {
+		t.Errorf("left %q, want [two]", session.left)
+	}
+
+	b.HandleInteraction(adminInteraction("owner", "stats"))
+	stats := session.responses[1].Data.Content
+	if !strings.Contains(stats, "Servers: 2") || !strings.Contains(stats, "`gemini`: 0 running, 0 waiting") {
+		t.Errorf("stats = %q", stats)
+	}
+}
+
+func TestAdminBroadcast(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+	b.config().OwnerID = "owner"
+	session.guilds = []*discordgo.Guild{{ID: "one", SystemChannelID: "general"}, {ID: "two"}}
+
+	b.HandleInteraction(adminInteraction("owner", "broadcast", stringOption("message", "Restarting at 18:00 UTC")))
+
+	if want := []string{"🔧 **Maintenance notice:** Restarting at 18:00 UTC"}; !slices.Equal(session.messages, want) {
+		t.Errorf("sent %q, want %q", session.messages, want)
+	}
+	if len(session.edits) != 1 || *session.edits[0].Content != "Posted the notice in 1 of 2 servers." {
+		t.Errorf("edits = %v", session.edits)
+	}
+}
+
+func TestAdminMaintenance(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello"}}}
+	b, session := newTestBot(t, client)
+	b.config().OwnerID = "owner"
+
+	b.HandleInteraction(adminInteraction("owner", "maintenance", stringOption("mode", "on")))
+	if len(session.presences) != 1 || session.presences[0].Status != string(discordgo.StatusDoNotDisturb) || session.presences[0].Activities[0].State != maintenanceStatus {
+		t.Errorf("presences = %+v, want maintenance", session.presences)
+	}
+
+	// New requests are refused, commands that don't use the model still work
+	b.HandleMessage(userMessage("hi"))
+	b.HandleInteraction(commandInteraction("imagine"))
+	b.HandleInteraction(commandInteraction("usage"))
+	if !slices.Equal(session.messages, []string{maintenanceMessage}) || len(client.chats) != 0 {
+		t.Errorf("sent %q, want the maintenance notice and no chat", session.messages)
+	}
+	if len(session.responses) != 3 || session.responses[1].Data.Content != maintenanceMessage || session.responses[2].Data.Content == maintenanceMessage {
+		t.Errorf("responses = %v, want /imagine refused and /usage answered", session.responses)
+	}
+
+	b.HandleInteraction(adminInteraction("owner", "maintenance", stringOption("mode", "off")))
+	b.HandleMessage(userMessage("hi"))
+	if len(session.messages) != 2 || session.messages[1] != "hello" {
+		t.Errorf("sent %q, want an answer after maintenance", session.messages)
+	}
+	if len(session.presences) != 2 || session.presences[1].Status != string(discordgo.StatusOnline) {
+		t.Errorf("presences = %+v, want back online", session.presences)
+	}
+}
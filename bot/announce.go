@@ -0,0 +1,208 @@
+package bot
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// Custom IDs of the draft's buttons and the edit modal all start with
+	// announcePrefix, and end with ":<channel ID>" the announcement goes to
+	announcePrefix        = "announce-"
+	announceApprovePrefix = "announce-approve:"
+	announceEditPrefix    = "announce-edit:"
+	announceCancelPrefix  = "announce-cancel:"
+	announceModalPrefix   = "announce-modal:"
+	announceTextID        = "text"
+
+	// Longest announcement, so it's posted as a single message
+	maxAnnouncementLength = 2000
+)
+
+// announcementPrompt asks the model for an announcement about a topic
+func announcementPrompt(topic string) string {
+	return "Write an announcement for a Discord channel from the following, formatted with Discord markdown. " +
+		"Only write the announcement, without a title line about it being one or any other comment.\n\n" + topic
+}
+
+// announceCommand handles /announce, having the model draft an announcement
+// and showing it to its author, who edits and approves it before it's posted
+func (b *Bot) announceCommand(i *discordgo.InteractionCreate) {
+	if !b.canAnnounce(i) {
+		return
+	}
+	options := i.ApplicationCommandData().Options
+	topic := commandOption(options, "topic").StringValue()
+	channelID := commandOption(options, "channel").ChannelValue(nil).ID
+
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to announce command", "error", err)
+		return
+	}
+	settings := b.guildSettings(i.GuildID)
+	parts := withGuildSettings(settings, topic, []genai.Part{genai.Text(announcementPrompt(topic))})
+	text, err := b.generate(interactionUserID(i), i.GuildID, parts...)
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	text = truncate(strings.TrimSpace(text), maxAnnouncementLength)
+
+	content := tr(i, "Draft announcement for <#%s>, nothing is posted until you approve it.", channelID)
+	embeds := []*discordgo.MessageEmbed{announcementEmbed(i, text)}
+	components := announcementComponents(i, channelID)
+	_, err = b.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content, Embeds: &embeds, Components: &components})
+	if err != nil {
+		interactionLogger(i).Error("Error showing announcement draft", "error", err)
+		return
+	}
+	interactionLogger(i).Info("Drafted announcement", "target_channel", channelID)
+}
+
+// canAnnounce checks that an interaction comes from a server member with the
+// Manage Server permission or one of the announcer roles, telling them
+// otherwise
+func (b *Bot) canAnnounce(i *discordgo.InteractionCreate) bool {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Announcements only work in servers."))
+		return false
+	}
+	roles := b.config().AnnounceRoles
+	if i.Member == nil || (i.Member.Permissions&discordgo.PermissionManageServer == 0 &&
+		!slices.ContainsFunc(i.Member.Roles, func(role string) bool { return slices.Contains(roles, role) })) {
+		b.respondEphemeral(i, tr(i, "You need the Manage Server permission or an announcer role to post announcements."))
+		return false
+	}
+	return true
+}
+
+// announceComponent handles the buttons of an announcement's draft, posting
+// it, opening the form to edit it or dropping it. The draft is read back
+// from its embed.
+func (b *Bot) announceComponent(i *discordgo.InteractionCreate) {
+	if !b.canAnnounce(i) {
+		return
+	}
+	customID := i.MessageComponentData().CustomID
+	if strings.HasPrefix(customID, announceCancelPrefix) {
+		b.closeAnnouncement(i, tr(i, "Cancelled the announcement, nothing was posted."))
+		return
+	}
+	text := announcementFromEmbed(i.Message)
+	if text == "" {
+		interactionLogger(i).Warn("Announcement draft without its embed", "custom_id", customID)
+		return
+	}
+
+	if channelID, ok := strings.CutPrefix(customID, announceApprovePrefix); ok {
+		b.postAnnouncement(i, channelID, text)
+		return
+	}
+	channelID, ok := strings.CutPrefix(customID, announceEditPrefix)
+	if !ok {
+		return
+	}
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: announceModalPrefix + channelID,
+			Title:    tr(i, "Edit the announcement"),
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.TextInput{CustomID: announceTextID, Label: tr(i, "Announcement"), Value: text,
+						Style: discordgo.TextInputParagraph, Required: true, MaxLength: maxAnnouncementLength},
+				}},
+			},
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error opening announcement modal", "error", err)
+	}
+}
+
+// announceModal shows the draft as its author edited it, still waiting for
+// approval
+func (b *Bot) announceModal(i *discordgo.InteractionCreate) {
+	if !b.canAnnounce(i) {
+		return
+	}
+	data := i.ModalSubmitData()
+	channelID := strings.TrimPrefix(data.CustomID, announceModalPrefix)
+	text := strings.TrimSpace(modalTextValue(data, announceTextID))
+	if text == "" {
+		b.respondEphemeral(i, tr(i, "The announcement can't be empty."))
+		return
+	}
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    tr(i, "Draft announcement for <#%s>, nothing is posted until you approve it.", channelID),
+			Embeds:     []*discordgo.MessageEmbed{announcementEmbed(i, text)},
+			Components: announcementComponents(i, channelID),
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error updating announcement draft", "error", err)
+	}
+}
+
+// postAnnouncement posts an approved announcement in its channel, without
+// letting its mentions ping anyone, and tells its author it was posted
+func (b *Bot) postAnnouncement(i *discordgo.InteractionCreate, channelID string, text string) {
+	_, err := b.session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:         text,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error posting announcement", "target_channel", channelID, "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	interactionLogger(i).Info("Posted announcement", "target_channel", channelID)
+	b.closeAnnouncement(i, tr(i, "Posted the announcement in <#%s>.", channelID))
+}
+
+// closeAnnouncement replaces an announcement's draft with content
+func (b *Bot) closeAnnouncement(i *discordgo.InteractionCreate, content string) {
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{Content: content, Embeds: []*discordgo.MessageEmbed{}, Components: []discordgo.MessageComponent{}},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error updating announcement draft", "error", err)
+	}
+}
+
+// announcementEmbed shows an announcement's draft
+func announcementEmbed(i *discordgo.InteractionCreate, text string) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Description: text,
+		Color:       embedColor,
+		Footer:      &discordgo.MessageEmbedFooter{Text: tr(i, "Draft announcement, only you can see it")},
+	}
+}
+
+// announcementFromEmbed reads an announcement's draft back from the message
+// showing it
+func announcementFromEmbed(m *discordgo.Message) string {
+	if m == nil || len(m.Embeds) == 0 {
+		return ""
+	}
+	return m.Embeds[0].Description
+}
+
+// announcementComponents returns the buttons approving, editing and
+// cancelling a draft
+func announcementComponents(i *discordgo.InteractionCreate, channelID string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{CustomID: announceApprovePrefix + channelID, Label: tr(i, "Approve"), Style: discordgo.SuccessButton},
+			discordgo.Button{CustomID: announceEditPrefix + channelID, Label: tr(i, "Edit"), Style: discordgo.SecondaryButton},
+			discordgo.Button{CustomID: announceCancelPrefix + channelID, Label: tr(i, "Cancel"), Style: discordgo.DangerButton},
+		}},
+	}
+}
@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestAnnounce(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{text: "📣 Game night is on Friday!"})
+	command := commandInteraction("announce")
+	command.Data = discordgo.ApplicationCommandInteractionData{
+		Name: "announce",
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{
+			stringOption("topic", "game night friday"),
+			{Name: "channel", Type: discordgo.ApplicationCommandOptionChannel, Value: "news"},
+		},
+	}
+
+	// Members need Manage Server or an announcer role
+	b.HandleInteraction(command)
+	if len(session.responses) != 1 || !strings.Contains(session.responses[0].Data.Content, "announcer role") {
+		t.Fatalf("responses = %v, want the member refused", session.responses)
+	}
+	b.config().AnnounceRoles = []string{"announcers"}
+	command.Member.Roles = []string{"announcers"}
+	b.HandleInteraction(command)
+	if len(session.messages) != 0 || len(session.edits) != 1 || session.edits[0].Embeds == nil {
+		t.Fatalf("messages = %q, edits = %v, want a draft only", session.messages, session.edits)
+	}
+	draft := &discordgo.Message{Embeds: *session.edits[0].Embeds}
+	if draft.Embeds[0].Description != "📣 Game night is on Friday!" {
+		t.Errorf("draft = %q", draft.Embeds[0].Description)
+	}
+
+	// Edit opens a form with the draft filled in, whose changes are shown
+	// without being posted
+	component := settingsInteraction(0, discordgo.MessageComponentInteractionData{CustomID: announceEditPrefix + "news"})
+	component.Member.Roles = []string{"announcers"}
+	component.Message = draft
+	b.HandleInteraction(component)
+	if last := session.responses[len(session.responses)-1]; last.Data.CustomID != announceModalPrefix+"news" {
+		t.Fatalf("response = %v, want the announcement form", last.Data)
+	}
+	form := settingsInteraction(0, discordgo.ModalSubmitInteractionData{CustomID: announceModalPrefix + "news", Components: []discordgo.MessageComponent{
+		&discordgo.ActionsRow{Components: []discordgo.MessageComponent{&discordgo.TextInput{CustomID: announceTextID, Value: "📣 Game night moves to Saturday!"}}},
+	}})
+	form.Member.Roles = []string{"announcers"}
+	b.HandleInteraction(form)
+	last := session.responses[len(session.responses)-1]
+	if len(session.messages) != 0 || last.Type != discordgo.InteractionResponseUpdateMessage || last.Data.Embeds[0].Description != "📣 Game night moves to Saturday!" {
+		t.Fatalf("messages = %q, response = %v, want the edited draft shown", session.messages, last.Data)
+	}
+
+	// Approve posts the draft as edited, without pinging anyone
+	component = settingsInteraction(0, discordgo.MessageComponentInteractionData{CustomID: announceApprovePrefix + "news"})
+	component.Member.Roles = []string{"announcers"}
+	component.Message = &discordgo.Message{Embeds: last.Data.Embeds}
+	b.HandleInteraction(component)
+	if len(session.messages) != 1 || session.messages[0] != "📣 Game night moves to Saturday!" {
+		t.Errorf("messages = %q, want the edited announcement posted", session.messages)
+	}
+	if last := session.responses[len(session.responses)-1]; !strings.Contains(last.Data.Content, "Posted the announcement in <#news>") {
+		t.Errorf("response = %v, want the post confirmed", last.Data)
+	}
+
+	// Cancel posts nothing
+	component = settingsInteraction(discordgo.PermissionManageServer, discordgo.MessageComponentInteractionData{CustomID: announceCancelPrefix + "news"})
+	component.Message = draft
+	b.HandleInteraction(component)
+	if len(session.messages) != 1 || !strings.Contains(session.responses[len(session.responses)-1].Data.Content, "Cancelled") {
+		t.Errorf("messages = %q, want nothing more posted", session.messages)
+	}
+}
@@ -0,0 +1,255 @@
+package bot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/config"
+	"go-discord-bot/metrics"
+	"go-discord-bot/store"
+)
+
+const (
+	// Largest API request body, in bytes, and longest prompt in characters
+	maxAPIBody   = 64 << 10
+	maxAPIPrompt = 4000
+
+	// Prefix of the user ID integrations are counted as in rate limits,
+	// usage and the audit log, followed by the name of their API key
+	apiUserPrefix = "api:"
+)
+
+// apiCallerKey is the context key of the caller of an API request
+type apiCallerKey struct{}
+
+// apiCaller is the integration an API key stands for, and the servers or
+// channels it may post in
+type apiCaller struct {
+	name string
+	ids  []string
+}
+
+// allows reports whether the caller may post in a channel, named by itself,
+// its parent channel for threads, or its server
+func (c apiCaller) allows(channel *discordgo.Channel) bool {
+	return slices.Contains(c.ids, channel.ID) || slices.Contains(c.ids, channel.GuildID) ||
+		(channel.ParentID != "" && slices.Contains(c.ids, channel.ParentID))
+}
+
+// apiRequest is the JSON body of both API endpoints
+type apiRequest struct {
+	ChannelID string `json:"channel_id"`
+	Prompt    string `json:"prompt"`
+}
+
+// apiResponse is what the API answers with once the bot posted
+type apiResponse struct {
+	Text       string   `json:"text"`
+	MessageIDs []string `json:"message_ids"`
+}
+
+// apiError is what the API answers with when it refuses a request
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// APIHandler returns the HTTP API external systems such as CI, monitoring or
+// websites push questions and announcements into channels with:
+//
+//   - POST /v1/ask answers a prompt in a channel as if a member asked it,
+//     carrying on the channel's conversation
+//   - POST /v1/announce writes an announcement from a prompt and posts it
+//
+// Both take a JSON body with "channel_id" and "prompt", need an API key as a
+// bearer token, which only posts in the servers or channels it was given,
+// and go through the channel's server's rate limit and quota.
+func (b *Bot) APIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/ask", b.apiAsk)
+	mux.HandleFunc("POST /v1/announce", b.apiAnnounce)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, ok := b.apiCaller(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, "missing or unknown API key")
+			return
+		}
+		mux.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiCallerKey{}, caller)))
+	})
+}
+
+// apiCaller returns the caller of the API key a request's bearer token is,
+// or false when it isn't one
+func (b *Bot) apiCaller(r *http.Request) (apiCaller, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return apiCaller{}, false
+	}
+	for _, entry := range b.config().APIKeys {
+		name, key, ids := config.SplitAPIKey(entry)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+			return apiCaller{name: name, ids: ids}, true
+		}
+	}
+	return apiCaller{}, false
+}
+
+// apiAsk handles POST /v1/ask, answering a prompt in a channel the way a
+// message there is answered, after the channel's earlier messages, and
+// responds with the answer
+func (b *Bot) apiAsk(w http.ResponseWriter, r *http.Request) {
+	m, settings, ok := b.apiMessage(w, r)
+	if !ok {
+		return
+	}
+	b.apiTrack(w, func() {
+		t := b.takeTicket(m.ChannelID)
+		defer b.releaseTicket(t)
+		t.wait()
+
+		parts := b.promptParts(m)
+		chat := b.chatFor(m.ChannelID, m.GuildID)
+		unlock := b.lockSession(chat)
+		defer unlock()
+		parts = withGuildSettings(settings, m.Content, withVerbosity(settings.Verbosity, b.withPersona(m.ChannelID, parts)))
+		reply, latency, err := b.answer(b.answerContext(m.GuildID, m.ChannelID, settings.Verbosity), chat, m, parts)
+		if err != nil {
+			writeAPIReplyError(w, err)
+			return
+		}
+		metrics.MessagesHandled.Inc()
+
+		// Show what was asked above the answer, since no member asked it
+		asked := fmt.Sprintf("-# Asked by **%s** through the API\n> %s\n", m.Author.Username, strings.ReplaceAll(truncate(m.Content, 300), "\n", "\n> "))
+		ids := b.sendResponse(m.ChannelID, asked+b.expiryNotice(chat)+b.responseText(m.GuildID, reply), responseFooter(reply, latency), withSpoilers(settings, reply), "", nil)
+		b.compactHistory(chat, m.Author.ID, m.GuildID)
+		b.saveSession(chat)
+		writeAPIJSON(w, http.StatusOK, apiResponse{Text: reply.Text, MessageIDs: ids})
+	})
+}
+
+// apiAnnounce handles POST /v1/announce, writing an announcement from a
+// prompt and posting it in a channel, and responds with the announcement
+func (b *Bot) apiAnnounce(w http.ResponseWriter, r *http.Request) {
+	m, settings, ok := b.apiMessage(w, r)
+	if !ok {
+		return
+	}
+	b.apiTrack(w, func() {
+		parts := withGuildSettings(settings, m.Content, []genai.Part{genai.Text(announcementPrompt(m.Content))})
+		text, err := b.generate(m.Author.ID, m.GuildID, parts...)
+		if err != nil {
+			writeAPIReplyError(w, err)
+			return
+		}
+		text = strings.TrimSpace(text)
+		ids := b.sendResponse(m.ChannelID, text, "", false, "", nil)
+		slog.Info("Posted API announcement", "caller", m.Author.Username, "channel", m.ChannelID, "guild", m.GuildID)
+		writeAPIJSON(w, http.StatusOK, apiResponse{Text: text, MessageIDs: ids})
+	})
+}
+
+// apiMessage reads an API request as a message from its caller in the
+// channel it names, responding with an error and returning false when it's
+// invalid or the channel's server can't take it now
+func (b *Bot) apiMessage(w http.ResponseWriter, r *http.Request) (*discordgo.Message, store.GuildSettings, bool) {
+	var request apiRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody)).Decode(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return nil, store.GuildSettings{}, false
+	}
+	request.Prompt = strings.TrimSpace(request.Prompt)
+	if request.ChannelID == "" || request.Prompt == "" {
+		writeAPIError(w, http.StatusBadRequest, "channel_id and prompt are required")
+		return nil, store.GuildSettings{}, false
+	}
+	if len([]rune(request.Prompt)) > maxAPIPrompt {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("prompt is longer than %d characters", maxAPIPrompt))
+		return nil, store.GuildSettings{}, false
+	}
+	channel, err := b.session.Channel(request.ChannelID)
+	if err != nil || channel.GuildID == "" {
+		writeAPIError(w, http.StatusNotFound, "unknown channel, or not a server channel the bot can see")
+		return nil, store.GuildSettings{}, false
+	}
+	caller := r.Context().Value(apiCallerKey{}).(apiCaller)
+	if !caller.allows(channel) {
+		writeAPIError(w, http.StatusForbidden, "this API key can't post in that channel")
+		return nil, store.GuildSettings{}, false
+	}
+
+	name := caller.name
+	m := &discordgo.Message{
+		ChannelID: channel.ID,
+		GuildID:   channel.GuildID,
+		Content:   request.Prompt,
+		Author:    &discordgo.User{ID: apiUserPrefix + name, Username: name, Bot: true},
+	}
+	settings := b.guildSettings(m.GuildID)
+	if b.maintenance.Load() {
+		writeAPIError(w, http.StatusServiceUnavailable, maintenanceMessage)
+		return nil, settings, false
+	}
+	if b.quotaExhausted(m.GuildID) {
+		writeAPIError(w, http.StatusTooManyRequests, quotaExhaustedMessage)
+		return nil, settings, false
+	}
+	if limited, _, wait := b.countRate(m.GuildID, m.Author.ID, settings.RateLimit); limited {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		writeAPIError(w, http.StatusTooManyRequests, fmt.Sprintf("this server's limit is %d a minute per member", settings.RateLimit))
+		return nil, settings, false
+	}
+	slog.Info("API request", "caller", name, "path", r.URL.Path, "channel", m.ChannelID, "guild", m.GuildID)
+	return m, settings, true
+}
+
+// apiTrack handles an API request as an event, refusing it once the bot is
+// shutting down
+func (b *Bot) apiTrack(w http.ResponseWriter, handler func()) {
+	handled := false
+	b.track(func() {
+		handled = true
+		handler()
+	}, func() {
+		writeAPIError(w, http.StatusInternalServerError, "something went wrong")
+	})
+	if !handled {
+		writeAPIError(w, http.StatusServiceUnavailable, "the bot is shutting down")
+	}
+}
+
+// writeAPIReplyError responds with the error the model returned
+func writeAPIReplyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ai.ErrBusy):
+		writeAPIError(w, http.StatusServiceUnavailable, "too many requests are queued, try again later")
+	case errors.Is(err, ai.ErrUnavailable):
+		writeAPIError(w, http.StatusServiceUnavailable, "the AI is temporarily unavailable, try again in a few minutes")
+	default:
+		writeAPIError(w, http.StatusBadGateway, err.Error())
+	}
+}
+
+// writeAPIError responds with an error message
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIJSON(w, status, apiError{Error: message})
+}
+
+// writeAPIJSON responds with a JSON body
+func writeAPIJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
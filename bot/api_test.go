@@ -0,0 +1,104 @@
+package bot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/store"
+)
+
+func TestAPI(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "All green."}}, text: "Release 2.0 is out!"}
+	b, session := newTestBot(t, client)
+	cfg := *b.config()
+	cfg.APIKeys = []string{"ci:0123456789abcdef:guild", "status:fedcba9876543210:other/elsewhere"}
+	b.SetConfig(&cfg)
+	session.channels["channel"] = &discordgo.Channel{ID: "channel", GuildID: "guild", Type: discordgo.ChannelTypeGuildText}
+	session.channels["dm"] = &discordgo.Channel{ID: "dm", Type: discordgo.ChannelTypeDM}
+	if err := b.store.SetGuildSettings(store.GuildSettings{GuildID: "guild", RateLimit: 2}); err != nil {
+		t.Fatal(err)
+	}
+	api := b.APIHandler()
+
+	request := func(path string, key string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if key != "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request("/v1/ask", "wrong-key-0123456789", `{"channel_id": "channel", "prompt": "Status?"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401 with an unknown key", w.Code)
+	}
+	if w := request("/v1/ask", "0123456789abcdef", `{"channel_id": "dm", "prompt": "Status?"}`); w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 outside a server", w.Code)
+	}
+
+	if w := request("/v1/ask", "fedcba9876543210", `{"channel_id": "channel", "prompt": "Status?"}`); w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403 outside the key's servers and channels", w.Code)
+	}
+
+	w := request("/v1/ask", "0123456789abcdef", `{"channel_id": "channel", "prompt": "Status?"}`)
+	var answer apiResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &answer); w.Code != http.StatusOK || err != nil || answer.Text != "All green." || len(answer.MessageIDs) != 1 {
+		t.Fatalf("ask = %d %s, want the answer", w.Code, w.Body)
+	}
+	if len(session.messages) != 1 || !strings.HasPrefix(session.messages[0], "-# Asked by **ci** through the API\n> Status?\n") {
+		t.Errorf("messages = %q, want the answer under the question", session.messages)
+	}
+	if usage, err := b.store.UserUsage(apiUserPrefix+"ci", time.Time{}); err != nil || usage.Requests != 1 {
+		t.Errorf("usage = %+v, %v, want the request counted for the key", usage, err)
+	}
+
+	w = request("/v1/announce", "0123456789abcdef", `{"channel_id": "channel", "prompt": "We shipped 2.0"}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &answer); w.Code != http.StatusOK || err != nil || answer.Text != "Release 2.0 is out!" {
+		t.Fatalf("announce = %d %s, want the announcement", w.Code, w.Body)
+	}
+	if len(session.messages) != 2 || session.messages[1] != "Release 2.0 is out!" {
+		t.Errorf("messages = %q, want the announcement posted", session.messages)
+	}
+
+	// The server's rate limit counts the key as a member
+	w = request("/v1/announce", "0123456789abcdef", `{"channel_id": "channel", "prompt": "Again"}`)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("status = %d, want 429 with Retry-After over the rate limit", w.Code)
+	}
+}
+
+func TestAPIAskWaitsForChannel(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{replies: []*ai.Reply{{Text: "All green."}}})
+	cfg := *b.config()
+	cfg.APIKeys = []string{"ci:0123456789abcdef:channel"}
+	b.SetConfig(&cfg)
+	session.channels["channel"] = &discordgo.Channel{ID: "channel", GuildID: "guild", Type: discordgo.ChannelTypeGuildText}
+
+	// A message of the channel is still being answered
+	earlier := b.takeTicket("channel")
+	done := make(chan int)
+	go func() {
+		r := httptest.NewRequest(http.MethodPost, "/v1/ask", strings.NewReader(`{"channel_id": "channel", "prompt": "Status?"}`))
+		r.Header.Set("Authorization", "Bearer 0123456789abcdef")
+		w := httptest.NewRecorder()
+		b.APIHandler().ServeHTTP(w, r)
+		done <- w.Code
+	}()
+	select {
+	case <-done:
+		t.Fatal("the API answered before the channel's earlier message")
+	case <-time.After(50 * time.Millisecond):
+	}
+	b.releaseTicket(earlier)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("status = %d, want the answer once the earlier message was handled", code)
+	}
+}
@@ -0,0 +1,134 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// Name of the message context-menu command (right-click → Apps)
+	askCommandName = "Ask Gemini about this"
+
+	// Modal custom IDs are "ask:<channelID>:<messageID>"
+	askModalPrefix = "ask:"
+
+	// Custom ID of the question text input inside the modal
+	askQuestionInputID = "question"
+)
+
+// askAboutMessage opens a modal asking what the user wants to know about the
+// message the context-menu command was used on
+func (b *Bot) askAboutMessage(i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: askModalPrefix + i.ChannelID + ":" + data.TargetID,
+			Title:    "Ask Gemini",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:  askQuestionInputID,
+							Label:     "What do you want to know about it?",
+							Style:     discordgo.TextInputParagraph,
+							Required:  true,
+							MaxLength: 1000,
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error opening ask modal", "error", err)
+	}
+}
+
+// answerAskModal sends the selected message together with the user's question
+// to Gemini and replies in a thread started on that message
+func (b *Bot) answerAskModal(i *discordgo.InteractionCreate) {
+	data := i.ModalSubmitData()
+
+	// Recover the target message from the modal custom ID
+	ids := strings.SplitN(strings.TrimPrefix(data.CustomID, askModalPrefix), ":", 2)
+	if len(ids) != 2 {
+		interactionLogger(i).Warn("Malformed ask modal ID", "custom_id", data.CustomID)
+		return
+	}
+	channelID, messageID := ids[0], ids[1]
+	question := modalTextValue(data, askQuestionInputID)
+
+	// Acknowledge now, answering can take longer than the interaction deadline
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to ask modal", "error", err)
+		return
+	}
+
+	message, err := b.session.ChannelMessage(channelID, messageID)
+	if err != nil {
+		interactionLogger(i).Error("Error fetching message", "message", messageID, "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, I couldn't read that message."))
+		return
+	}
+
+	// Build the prompt from the message content, its attachments and the question
+	var parts []genai.Part
+	parts = append(parts, b.uploadAttachments(interactionUserID(i), i.GuildID, message.Attachments)...)
+	prompt := fmt.Sprintf("Here is a Discord message from %s:\n\n%s\n\nQuestion about this message: %s", message.Author.Username,
+		b.untrusted(interactionUserID(i), i.GuildID, "a message by "+message.Author.Username, message.Content), question)
+	parts = append(parts, genai.Text(prompt))
+
+	responseText, err := b.generate(interactionUserID(i), i.GuildID, parts...)
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if responseText == "" {
+		responseText = tr(i, "I couldn't generate a response.")
+	}
+
+	// Reply in the message's thread, falling back to the interaction itself
+	// where threads aren't available (DMs, messages already inside a thread)
+	threadID, err := b.messageThread(message, question)
+	if err != nil {
+		interactionLogger(i).Error("Error starting thread", "error", err)
+		for _, chunk := range splitMessage(fmt.Sprintf("> %s\n\n%s", question, responseText)) {
+			_, err := b.session.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+				Content:         chunk,
+				AllowedMentions: &discordgo.MessageAllowedMentions{},
+			})
+			if err != nil {
+				interactionLogger(i).Error("Error sending ask follow-up", "error", err)
+				return
+			}
+		}
+		return
+	}
+	b.sendLongMessage(threadID, fmt.Sprintf("<@%s> asked: %s\n\n%s", interactionUserID(i), question, responseText))
+	b.editInteractionResponse(i, tr(i, "Answered in <#%s>", threadID))
+}
+
+// messageThread returns the ID of the thread attached to a message, starting
+// one if the message doesn't have a thread yet
+func (b *Bot) messageThread(message *discordgo.Message, question string) (string, error) {
+	if message.Thread != nil {
+		return message.Thread.ID, nil
+	}
+
+	// Thread names are limited to 100 characters
+	name := truncate("Gemini: "+question, 100)
+	thread, err := b.session.MessageThreadStartComplex(message.ChannelID, message.ID, &discordgo.ThreadStart{
+		Name:                name,
+		AutoArchiveDuration: 60,
+	})
+	if err != nil {
+		return "", err
+	}
+	return thread.ID, nil
+}
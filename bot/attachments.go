@@ -0,0 +1,314 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/store"
+)
+
+const (
+	// Tokens the model counts per second of video and audio, and per page of
+	// a PDF
+	videoTokensPerSecond = 263
+	audioTokensPerSecond = 32
+	pdfTokensPerPage     = 258
+
+	// Sizes assumed for media whose length can't be read from its headers:
+	// bytes per second of audio and video, and bytes per page of a PDF
+	assumedAudioByteRate = 16_000
+	assumedVideoByteRate = 250_000
+	assumedPDFPageSize   = 100_000
+
+	// Custom IDs of the buttons confirming or cancelling costly attachments,
+	// followed by the ID of their message
+	attachmentsConfirmPrefix = "attachments-confirm:"
+	attachmentsCancelPrefix  = "attachments-cancel:"
+
+	// Messages waiting for their author to confirm their attachments, the
+	// oldest are forgotten past this many
+	maxPendingAttachments = 100
+)
+
+// attachmentLimit matches a limit typed in the /settings form, like
+// "10 minutes" or "50 pages"
+var attachmentLimit = regexp.MustCompile(`^(\d+)\s*(minutes?|mins?|m|pages?|p)$`)
+
+// attachmentCost is what sending an audio, video or PDF attachment to the
+// model would take: its length when its headers tell it, and the tokens
+// estimated for it
+type attachmentCost struct {
+	attachment *discordgo.MessageAttachment
+	duration   time.Duration
+	pages      int
+	tokens     int
+}
+
+// costlyAttachment reports whether an attachment's type is one whose tokens
+// grow with its length
+func costlyAttachment(contentType string) bool {
+	return strings.HasPrefix(contentType, "audio/") || strings.HasPrefix(contentType, "video/") ||
+		strings.Contains(contentType, "pdf")
+}
+
+// attachmentCostOf probes the length of an audio, video or PDF file and
+// estimates its tokens, from its size when the length is unknown
+func attachmentCostOf(contentType string, data []byte) attachmentCost {
+	var cost attachmentCost
+	switch {
+	case strings.Contains(contentType, "pdf"):
+		cost.pages = pdfPages(data)
+		pages := cost.pages
+		if pages == 0 {
+			pages = len(data)/assumedPDFPageSize + 1
+		}
+		cost.tokens = pages * pdfTokensPerPage
+	case strings.HasPrefix(contentType, "video/"):
+		cost.duration, _ = mediaDuration(data)
+		cost.tokens = mediaTokens(cost.duration, len(data), videoTokensPerSecond, assumedVideoByteRate)
+	default:
+		cost.duration, _ = mediaDuration(data)
+		cost.tokens = mediaTokens(cost.duration, len(data), audioTokensPerSecond, assumedAudioByteRate)
+	}
+	return cost
+}
+
+// mediaTokens estimates the tokens of audio or video lasting duration, or
+// of size bytes at byteRate when its duration is unknown
+func mediaTokens(duration time.Duration, size int, tokensPerSecond int, byteRate int) int {
+	seconds := int(duration.Seconds())
+	if duration == 0 {
+		seconds = size / byteRate
+	}
+	return (seconds + 1) * tokensPerSecond
+}
+
+// attachmentLimits returns the longest audio or video in minutes and the
+// most PDF pages a guild sends to the model, following the bot's limits
+// where the guild set none, and 0 when unlimited
+func (b *Bot) attachmentLimits(settings store.GuildSettings) (minutes int, pages int) {
+	minutes, pages = settings.MaxMediaMinutes, settings.MaxPDFPages
+	if minutes == 0 {
+		minutes = b.config().MaxMediaMinutes
+	}
+	if pages == 0 {
+		pages = b.config().MaxPDFPages
+	}
+	return minutes, pages
+}
+
+// checkAttachments probes the audio, video and PDF attachments of a message
+// before they are sent to the model, reporting whether it can be answered
+// right away. Attachments over the guild's limits are refused, and when
+// they would use more tokens than configured the author is asked to
+// confirm with a button first.
+func (b *Bot) checkAttachments(m *discordgo.MessageCreate, settings store.GuildSettings) bool {
+	var costs []attachmentCost
+	for _, attachment := range m.Attachments {
+		if !costlyAttachment(attachment.ContentType) {
+			continue
+		}
+		data, err := b.attachmentData(attachment)
+		if err != nil {
+			// Left to uploadAttachments, which skips it
+			slog.Error("Error downloading attachment", "file", attachment.Filename, "error", err)
+			continue
+		}
+		b.probedMu.Lock()
+		b.probed[attachment.ID] = data
+		b.probedMu.Unlock()
+
+		cost := attachmentCostOf(attachment.ContentType, data)
+		cost.attachment = attachment
+		costs = append(costs, cost)
+	}
+	if len(costs) == 0 {
+		return true
+	}
+
+	maxMinutes, maxPages := b.attachmentLimits(settings)
+	tokens := 0
+	for _, cost := range costs {
+		var refusal string
+		switch {
+		case maxMinutes > 0 && cost.duration > time.Duration(maxMinutes)*time.Minute:
+			refusal = b.trGuild(m.GuildID, "%s is %d minutes long, over this server's limit of %d minutes for audio and video.",
+				cost.attachment.Filename, int(cost.duration.Minutes()+0.5), maxMinutes)
+		case maxPages > 0 && cost.pages > maxPages:
+			refusal = b.trGuild(m.GuildID, "%s has %d pages, over this server's limit of %d pages for PDFs.",
+				cost.attachment.Filename, cost.pages, maxPages)
+		}
+		if refusal != "" {
+			messageLogger(m).Info("Refused attachment over the limits", "file", cost.attachment.Filename,
+				"duration", cost.duration, "pages", cost.pages)
+			b.forgetProbed(m.Attachments)
+			b.session.ChannelMessageSend(m.ChannelID, refusal)
+			return false
+		}
+		tokens += cost.tokens
+	}
+
+	limit := b.config().AttachmentConfirmTokens
+	if limit == 0 || tokens <= limit {
+		return true
+	}
+
+	// Ask first, without keeping the files around until the author decides
+	b.forgetProbed(m.Attachments)
+	messageLogger(m).Info("Costly attachments need confirmation", "tokens", tokens, "limit", limit)
+	_, err := b.session.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content: b.trGuild(m.GuildID, "📎 The attachments of this message would use about %d tokens, costing around $%.4f. Send them to the model anyway?",
+			tokens, b.promptCost(tokens)),
+		Reference: m.Reference(),
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{CustomID: attachmentsConfirmPrefix + m.ID, Label: b.trGuild(m.GuildID, "Send"), Style: discordgo.PrimaryButton},
+				discordgo.Button{CustomID: attachmentsCancelPrefix + m.ID, Label: b.trGuild(m.GuildID, "Cancel"), Style: discordgo.SecondaryButton},
+			}},
+		},
+	})
+	if err != nil {
+		messageLogger(m).Error("Error asking to confirm attachments", "error", err)
+		return false
+	}
+
+	b.pendingMu.Lock()
+	defer b.pendingMu.Unlock()
+	if _, ok := b.pending[m.ID]; !ok {
+		b.pendingOrder = append(b.pendingOrder, m.ID)
+	}
+	b.pending[m.ID] = m
+	if len(b.pendingOrder) > maxPendingAttachments {
+		delete(b.pending, b.pendingOrder[0])
+		b.pendingOrder = b.pendingOrder[1:]
+	}
+	return false
+}
+
+// attachmentsComponent handles the buttons asking to confirm costly
+// attachments, answering the message when its author sends them anyway
+func (b *Bot) attachmentsComponent(i *discordgo.InteractionCreate) {
+	customID := i.MessageComponentData().CustomID
+	messageID, confirmed := strings.CutPrefix(customID, attachmentsConfirmPrefix)
+	if !confirmed {
+		messageID = strings.TrimPrefix(customID, attachmentsCancelPrefix)
+	}
+
+	b.pendingMu.Lock()
+	m := b.pending[messageID]
+	if m != nil && m.Author.ID == interactionUserID(i) {
+		delete(b.pending, messageID)
+		b.pendingOrder = slices.DeleteFunc(b.pendingOrder, func(id string) bool { return id == messageID })
+	}
+	b.pendingMu.Unlock()
+
+	if m == nil {
+		b.respondEphemeral(i, tr(i, "This confirmation expired, send the message again."))
+		return
+	}
+	if m.Author.ID != interactionUserID(i) {
+		b.respondEphemeral(i, tr(i, "Only whoever sent the message can decide that."))
+		return
+	}
+
+	content := tr(i, "The attachments weren't sent.")
+	if confirmed {
+		content = tr(i, "Sending the attachments.")
+	}
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error updating attachments confirmation", "error", err)
+	}
+	if confirmed {
+		b.answerMessage(m, b.guildSettings(m.GuildID))
+	}
+}
+
+// attachmentData returns the contents of an attachment, as downloaded when
+// it was probed or else from Discord
+func (b *Bot) attachmentData(attachment *discordgo.MessageAttachment) ([]byte, error) {
+	b.probedMu.Lock()
+	data, ok := b.probed[attachment.ID]
+	delete(b.probed, attachment.ID)
+	b.probedMu.Unlock()
+	if ok {
+		return data, nil
+	}
+	return downloadAttachment(attachment)
+}
+
+// forgetProbed drops the probed contents of attachments that weren't
+// uploaded
+func (b *Bot) forgetProbed(attachments []*discordgo.MessageAttachment) {
+	b.probedMu.Lock()
+	defer b.probedMu.Unlock()
+	for _, attachment := range attachments {
+		delete(b.probed, attachment.ID)
+	}
+}
+
+// attachmentLimitsText describes the attachment limits of a guild for
+// /settings
+func (b *Bot) attachmentLimitsText(settings store.GuildSettings) string {
+	minutes, pages := b.attachmentLimits(settings)
+	media, pdf := "audio and video of any length", "PDFs of any length"
+	if minutes > 0 {
+		media = fmt.Sprintf("up to %d minutes of audio or video", minutes)
+	}
+	if pages > 0 {
+		pdf = fmt.Sprintf("PDFs up to %d pages", pages)
+	}
+	text := strings.ToUpper(media[:1]) + media[1:] + ", " + pdf
+	if settings.MaxMediaMinutes == 0 && settings.MaxPDFPages == 0 {
+		text += " (default)"
+	}
+	return text
+}
+
+// parseAttachmentLimits reads the attachment limits typed in the /settings
+// form, like "10 minutes, 50 pages", either of which may be left out to
+// follow the bot's limit
+func parseAttachmentLimits(text string) (minutes int, pages int, ok bool) {
+	for _, limit := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return r == ',' || r == ';' }) {
+		match := attachmentLimit.FindStringSubmatch(strings.TrimSpace(limit))
+		if match == nil {
+			return 0, 0, false
+		}
+		n, err := strconv.Atoi(match[1])
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if strings.HasPrefix(match[2], "m") {
+			minutes = n
+		} else {
+			pages = n
+		}
+	}
+	return minutes, pages, true
+}
+
+// formatAttachmentLimits writes a guild's own attachment limits the way
+// parseAttachmentLimits reads them
+func formatAttachmentLimits(settings store.GuildSettings) string {
+	var limits []string
+	if settings.MaxMediaMinutes > 0 {
+		limits = append(limits, fmt.Sprintf("%d minutes", settings.MaxMediaMinutes))
+	}
+	if settings.MaxPDFPages > 0 {
+		limits = append(limits, fmt.Sprintf("%d pages", settings.MaxPDFPages))
+	}
+	return strings.Join(limits, ", ")
+}
@@ -0,0 +1,841 @@
+// Package bot implements the Discord side of the bot: message and
+// interaction handlers answering through an AI backend.
+package bot
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/audit"
+	"go-discord-bot/config"
+	"go-discord-bot/metrics"
+	"go-discord-bot/plugins"
+	"go-discord-bot/script"
+	"go-discord-bot/store"
+)
+
+// Bot answers Discord messages and interactions through an AI backend
+type Bot struct {
+	ctx     context.Context
+	cfg     atomic.Pointer[config.Config]
+	session Session
+	ai      ai.Client
+	store   *store.Store
+
+	// Where chat sessions, guild settings, memories and usage are kept when
+	// STORE_DRIVER chose another backend than the database, see state
+	backend store.Backend
+
+	// Plugins built in, and their slash commands by name, set before the
+	// bot handles events
+	plugins        []plugins.Plugin
+	pluginCommands map[string]pluginCommand
+
+	// AI providers guilds can choose between with /provider, by name, and
+	// the name of the default one
+	providers       map[string]ai.Client
+	defaultProvider string
+
+	// Shared chat session of each provider, sessions of threads started in
+	// auto-thread mode keyed by thread ID, and the thread each user has in
+	// each channel keyed by "<channelID>:<userID>", and the chats of
+	// conversation profiles keyed by profileChatKey
+	chatsMu      sync.Mutex
+	sharedChats  map[string]ai.Chat
+	threadChats  map[string]ai.Chat
+	userThreads  map[string]string
+	profileChats map[string]ai.Chat
+
+	// Per-user /imagine usage, reset every day (UTC)
+	imagineMu    sync.Mutex
+	imagineUsage map[string]*dailyUsage
+
+	// Full text of recent responses keyed by the ID of the message carrying
+	// the 🔊 button, since long answers are split over several messages
+	spokenMu    sync.Mutex
+	spoken      map[string]string
+	spokenOrder []string
+
+	// Prompts and responses of recent answers keyed by the ID of the message
+	// carrying the 👍/👎 buttons
+	feedbackMu    sync.Mutex
+	feedback      map[string]feedbackExchange
+	feedbackOrder []string
+
+	// Compiled scripts of guilds, nil for the ones without one
+	scriptsMu sync.Mutex
+	scripts   map[string]*script.Script
+
+	// Threads AUTO_THREAD started that still wait for a title, and the
+	// latest rename of each channel, which can be undone
+	untitledMu  sync.Mutex
+	untitled    map[string]bool
+	renamesMu   sync.Mutex
+	renames     map[string]rename
+	renameOrder []string
+
+	// Pinned summaries of thread conversations, by thread ID, see
+	// THREAD_SUMMARY_TURNS
+	summariesMu sync.Mutex
+	summaries   map[string]*threadSummary
+
+	// Where the latest message of each channel is in its queue, closed once
+	// it was handled, see takeTicket
+	queuesMu sync.Mutex
+	queues   map[string]chan struct{}
+
+	// Answers being written, by the ID of the message answered, see
+	// startGeneration
+	generationsMu sync.Mutex
+	generations   map[string]*generation
+
+	// Rapid-fire messages of members waiting to be answered together, by
+	// channel and author, see debounce
+	burstsMu sync.Mutex
+	bursts   map[string]*burst
+
+	// Active voice connections by guild ID
+	voiceMu       sync.Mutex
+	voiceSessions map[string]*voiceSession
+
+	// Messages waiting to be embedded and indexed
+	indexMu    sync.Mutex
+	indexQueue []*discordgo.Message
+	indexTimer *time.Timer
+
+	// History of each chat from before its latest answered message
+	lastTurnsMu sync.Mutex
+	lastTurns   map[ai.Chat]lastTurn
+
+	// Replies sent to bots in each channel since a human last posted there
+	botStreaksMu sync.Mutex
+	botStreaks   map[string]*botStreak
+
+	// Recent messages already acted on by a reaction, keyed by message ID and
+	// action, so every reaction after the first is ignored
+	reactedMu    sync.Mutex
+	reacted      map[string]bool
+	reactedOrder []string
+
+	// Contents of attachments downloaded to probe their length, by attachment
+	// ID until they are uploaded, and the messages whose costly attachments
+	// wait for their author to confirm, by message ID
+	probedMu     sync.Mutex
+	probed       map[string][]byte
+	pendingMu    sync.Mutex
+	pending      map[string]*discordgo.MessageCreate
+	pendingOrder []string
+
+	// Who wrote recent history entries and when, for /export
+	turnsMu   sync.Mutex
+	turns     map[*genai.Content]turnInfo
+	turnOrder []*genai.Content
+
+	// When each chat last answered, the chats whose history expired since,
+	// mapped to whether it was summarized, and the locks of chats being
+	// answered in, see lockChat
+	sessionsMu   sync.Mutex
+	chatActivity map[ai.Chat]chatActivity
+	expiredChats map[ai.Chat]bool
+	chatLocks    map[ai.Chat]*chatLock
+
+	// Settings of guilds by ID, cached until /settings changes them unless a
+	// shared backend keeps them, and the messages each member had answered
+	// in the current minute, keyed by "<guildID>:<userID>"
+	settingsMu  sync.Mutex
+	settings    map[string]store.GuildSettings
+	rateMu      sync.Mutex
+	rateWindows map[string]*rateWindow
+
+	// Answers to recent one-off prompts by cache key, most recently used
+	// first in responseOrder
+	responsesMu   sync.Mutex
+	responses     map[string]*list.Element
+	responseOrder *list.List
+
+	// Saved chat histories of each conversation by name, see conversation
+	checkpointsMu sync.Mutex
+	checkpoints   map[string]map[string]checkpoint
+
+	// Position in the configured statuses, and the status last shown as the
+	// bot's presence
+	presenceMu    sync.Mutex
+	presenceIndex int
+	presence      string
+
+	// Whether the owner put the bot in maintenance mode with /admin, refusing
+	// new AI requests
+	maintenance atomic.Bool
+
+	// Where prompts and responses are recorded, nil when auditing is off
+	audit *audit.Log
+
+	// When the bot started, how /admin reload re-reads the configuration,
+	// and how commands are registered again after the gateway session is
+	// invalidated, nil in processes that don't register them
+	started      time.Time
+	reload       func() error
+	syncCommands func() error
+
+	// Handlers in flight, and whether the bot stopped taking new events
+	inflightMu sync.Mutex
+	inflight   sync.WaitGroup
+	closing    bool
+}
+
+// New creates a bot talking to Discord through session and answering with
+// client, the provider named by cfg.DefaultProvider
+func New(ctx context.Context, cfg *config.Config, session Session, client ai.Client, st *store.Store) *Bot {
+	b := &Bot{
+		ctx:             ctx,
+		session:         session,
+		ai:              client,
+		store:           st,
+		providers:       map[string]ai.Client{cfg.DefaultProvider: client},
+		defaultProvider: cfg.DefaultProvider,
+		sharedChats:     map[string]ai.Chat{},
+		threadChats:     map[string]ai.Chat{},
+		userThreads:     map[string]string{},
+		profileChats:    map[string]ai.Chat{},
+		imagineUsage:    map[string]*dailyUsage{},
+		spoken:          map[string]string{},
+		feedback:        map[string]feedbackExchange{},
+		scripts:         map[string]*script.Script{},
+		untitled:        map[string]bool{},
+		renames:         map[string]rename{},
+		summaries:       map[string]*threadSummary{},
+		queues:          map[string]chan struct{}{},
+		generations:     map[string]*generation{},
+		bursts:          map[string]*burst{},
+		voiceSessions:   map[string]*voiceSession{},
+		lastTurns:       map[ai.Chat]lastTurn{},
+		botStreaks:      map[string]*botStreak{},
+		reacted:         map[string]bool{},
+		probed:          map[string][]byte{},
+		pending:         map[string]*discordgo.MessageCreate{},
+		turns:           map[*genai.Content]turnInfo{},
+		checkpoints:     map[string]map[string]checkpoint{},
+		settings:        map[string]store.GuildSettings{},
+		rateWindows:     map[string]*rateWindow{},
+		chatActivity:    map[ai.Chat]chatActivity{},
+		chatLocks:       map[ai.Chat]*chatLock{},
+		expiredChats:    map[ai.Chat]bool{},
+		responses:       map[string]*list.Element{},
+		responseOrder:   list.New(),
+		started:         time.Now(),
+	}
+	b.cfg.Store(cfg)
+	return b
+}
+
+// config returns the current configuration
+func (b *Bot) config() *config.Config {
+	return b.cfg.Load()
+}
+
+// SetConfig replaces the configuration, for events handled afterwards, and
+// updates the presence for it. The default provider and its client stay the
+// ones the bot was created with.
+func (b *Bot) SetConfig(cfg *config.Config) {
+	b.cfg.Store(cfg)
+	b.updatePresence()
+}
+
+// SetReload sets how /admin reload re-reads and applies the configuration
+func (b *Bot) SetReload(reload func() error) {
+	b.reload = reload
+}
+
+// SetCommandSync sets how the commands are registered again when Discord
+// invalidates a gateway session
+func (b *Bot) SetCommandSync(sync func() error) {
+	b.syncCommands = sync
+}
+
+// SetAudit records every prompt and response to an audit log
+func (b *Bot) SetAudit(log *audit.Log) {
+	b.audit = log
+}
+
+// SetBackend keeps chat sessions, guild settings, memories and usage in a
+// backend other instances of the bot share
+func (b *Bot) SetBackend(backend store.Backend) {
+	b.backend = backend
+}
+
+// state returns where chat sessions, guild settings, memories and usage are
+// kept: the shared backend, or else the database
+func (b *Bot) state() store.Backend {
+	if b.backend != nil {
+		return b.backend
+	}
+	return b.store
+}
+
+// NewDiscordSession wraps the discordgo sessions of the gateway shards this
+// process runs for use by the bot, making REST calls through the first
+func NewDiscordSession(shards ...*discordgo.Session) Session {
+	return discordSession{Session: shards[0], shards: shards}
+}
+
+// AddHandlers registers the bot's event handlers on a discordgo session,
+// once for each gateway shard. Events are handed over in the order Discord
+// sent them, each handled in a goroutine of its own, with messages taking
+// their place in their channel's queue first so they're answered in order.
+func (b *Bot) AddHandlers(s *discordgo.Session) {
+	s.SyncEvents = true
+
+	// Log the shard's connection and keep its metrics
+	trackShard(s)
+
+	// Add message handler
+	s.AddHandler(func(_ *discordgo.Session, m *discordgo.MessageCreate) {
+		t := b.takeTicket(m.ChannelID)
+		go func() {
+			defer b.releaseTicket(t)
+			b.track(func() { b.handleMessage(m, t) }, func() { b.session.ChannelMessageSend(m.ChannelID, b.trGuild(m.GuildID, panicMessage)) })
+		}()
+	})
+
+	// Add slash command handler
+	s.AddHandler(func(_ *discordgo.Session, i *discordgo.InteractionCreate) {
+		go b.track(func() { b.HandleInteraction(i) }, func() { b.notifyInteractionPanic(i) })
+	})
+
+	// Show the presence on new gateway sessions, and register the commands
+	// again when Discord invalidated the previous one
+	var identified atomic.Bool
+	s.AddHandler(func(s *discordgo.Session, _ *discordgo.Ready) {
+		reidentified := identified.Swap(true)
+		go b.track(func() { b.handleReady(s, s.ShardID, reidentified) }, nil)
+	})
+
+	// Check the bot's permissions in each server
+	s.AddHandler(func(_ *discordgo.Session, g *discordgo.GuildCreate) {
+		go b.track(func() { b.handleGuildCreate(g) }, nil)
+	})
+
+	// Forget sessions of deleted threads
+	s.AddHandler(func(_ *discordgo.Session, t *discordgo.ThreadDelete) {
+		go b.track(func() { b.handleThreadDelete(t) }, nil)
+	})
+
+	// Run the AI actions servers map to emoji reactions
+	s.AddHandler(func(_ *discordgo.Session, r *discordgo.MessageReactionAdd) {
+		go b.track(func() { b.handleReactionAdd(r) }, nil)
+	})
+
+	// Welcome new members, in servers that set it up
+	s.AddHandler(func(_ *discordgo.Session, m *discordgo.GuildMemberAdd) {
+		go b.track(func() { b.handleGuildMemberAdd(m) }, nil)
+	})
+
+	// Answer edited messages again, in their channel's queue
+	s.AddHandler(func(_ *discordgo.Session, m *discordgo.MessageUpdate) {
+		t := b.takeTicket(m.ChannelID)
+		go func() {
+			defer b.releaseTicket(t)
+			b.track(func() { b.handleMessageUpdate(m, t) }, nil)
+		}()
+	})
+
+	// Remove deleted messages from the search index, along with the replies
+	// to them, including messages deleted in bulk by moderators
+	s.AddHandler(func(_ *discordgo.Session, m *discordgo.MessageDelete) {
+		go b.track(func() { b.handleMessageDelete(m.ID) }, nil)
+	})
+	s.AddHandler(func(_ *discordgo.Session, m *discordgo.MessageDeleteBulk) {
+		go b.track(func() {
+			for _, messageID := range m.Messages {
+				b.handleMessageDelete(messageID)
+			}
+		}, nil)
+	})
+}
+
+// track runs an event handler unless the bot is shutting down, counting it
+// as in flight until it returns. A panicking handler is recovered and notify,
+// if set, tells the user something went wrong.
+func (b *Bot) track(handler func(), notify func()) {
+	b.inflightMu.Lock()
+	if b.closing {
+		b.inflightMu.Unlock()
+		return
+	}
+	b.inflight.Add(1)
+	b.inflightMu.Unlock()
+
+	defer b.inflight.Done()
+	defer recoverPanic(notify)
+	handler()
+}
+
+// Shutdown stops taking new events and waits up to timeout for in-flight
+// handlers to finish, then indexes any queued messages. It reports whether
+// every handler finished in time.
+func (b *Bot) Shutdown(timeout time.Duration) bool {
+	b.inflightMu.Lock()
+	b.closing = true
+	b.inflightMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.inflight.Wait()
+		close(done)
+	}()
+
+	drained := true
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		drained = false
+	}
+
+	// Don't lose messages waiting to be indexed
+	b.flushIndexQueue()
+	return drained
+}
+
+// HandleMessage answers a message posted in a channel the bot can read,
+// after the messages of the channel it handled before
+func (b *Bot) HandleMessage(m *discordgo.MessageCreate) {
+	t := b.takeTicket(m.ChannelID)
+	defer b.releaseTicket(t)
+	b.handleMessage(m, t)
+}
+
+// handleMessage answers a message once the earlier messages of its channel,
+// queued ahead of its ticket, were handled. Checks that don't answer, and
+// gathering rapid-fire messages, don't wait for them.
+func (b *Bot) handleMessage(m *discordgo.MessageCreate, t *ticket) {
+	// Ignore bot's own messages
+	if m.Author.ID == b.session.BotUserID() {
+		return
+	}
+
+	// Index messages of channels that opted in to /recall
+	if m.GuildID != "" && b.isIndexedChannel(m.ChannelID) {
+		b.indexMessage(m.Message)
+	}
+
+	// Score messages of channels with moderation on, without holding up the answer
+	if m.GuildID != "" {
+		if settings := b.moderatedChannel(m.ChannelID); settings != nil {
+			go func() {
+				defer recoverPanic(nil)
+				b.moderateMessage(m.Message, settings)
+			}()
+		}
+	}
+
+	// Let plugins filter messages, then only answer the bots and webhooks
+	// that are allowed, and break loops
+	if !b.pluginsAccept(m.Message) || !b.answersAuthor(m) {
+		return
+	}
+
+	// Answer messages following a short one of their author's along with it
+	if b.joinBurst(m) {
+		return
+	}
+
+	// Follow the server's settings on which messages to answer, and how many,
+	// once the author stopped adding to a short message
+	settings := b.guildSettings(m.GuildID)
+	if !b.triggers(m, settings) {
+		return
+	}
+	m = b.debounce(m)
+	t.wait()
+	if b.rateLimited(m, settings) {
+		return
+	}
+
+	// Refuse during maintenance, and once the server's monthly quota is used up
+	if b.maintenance.Load() {
+		b.session.ChannelMessageSend(m.ChannelID, b.trGuild(m.GuildID, maintenanceMessage))
+		return
+	}
+	if b.quotaExhausted(m.GuildID) {
+		b.session.ChannelMessageSend(m.ChannelID, b.trGuild(m.GuildID, quotaExhaustedMessage))
+		return
+	}
+
+	// "!edit <instruction>" with an image attached asks an image-output model
+	// for an edited image, when enabled
+	if instruction, ok := strings.CutPrefix(m.Content, imageEditPrefix); ok &&
+		b.config().ImageEditing && hasImageAttachment(m.Attachments) {
+		b.editImage(m, strings.TrimSpace(instruction))
+		return
+	}
+
+	// Asking to explain an attached source file gets a walkthrough of it,
+	// function by function, rather than the generic attachment handling
+	if attachment := codeAttachment(m.Attachments); attachment != nil && explainIntent.MatchString(m.Content) {
+		b.explainFileMessage(m, attachment)
+		return
+	}
+
+	// Refuse attachments over the server's limits, and ask before sending
+	// costly ones
+	if !b.checkAttachments(m, settings) {
+		return
+	}
+	b.answerMessage(m, settings)
+}
+
+// answerMessage answers a message in its channel or the author's thread,
+// once HandleMessage decided to
+func (b *Bot) answerMessage(m *discordgo.MessageCreate, settings store.GuildSettings) {
+	defer b.forgetProbed(m.Attachments)
+	parts := b.promptParts(m.Message)
+
+	// Ignore empty messages and no attachments
+	if len(parts) == 0 {
+		return
+	}
+	metrics.MessagesHandled.Inc()
+
+	// Pick the channel to answer in, which may be the author's thread
+	channelID := b.replyChannel(m)
+	b.forwardToThread(m, channelID)
+
+	// Send message to Gemini, typing until it answers
+	chat := b.chatFor(channelID, m.GuildID)
+	unlock := b.lockSession(chat)
+	defer unlock()
+	variant, persona := b.personaVariant(m.GuildID, channelID)
+	if variant != "" {
+		settings.Persona = persona
+	}
+	parts = b.withFollowUps(withGuildSettings(settings, m.Content, withVerbosity(settings.Verbosity, b.withPersona(channelID, b.withCampaign(channelID, parts)))))
+	b.warnLargePrompt(m, channelID, chat, parts)
+	before := chat.History()
+	stopTyping := b.keepTyping(channelID)
+	ctx, finish := b.startGeneration(b.answerContext(m.GuildID, m.ChannelID, settings.Verbosity), m.Message, channelID)
+	reply, latency, err := b.answer(ctx, chat, m.Message, parts)
+	finish()
+	stopTyping()
+	if errors.Is(err, context.Canceled) {
+		// Whoever asked stopped the answer
+		return
+	}
+	if errors.Is(err, ai.ErrBusy) {
+		// Too many requests are queued, show the message wasn't answered
+		if err := b.session.MessageReactionAdd(m.ChannelID, m.ID, "⏳"); err != nil {
+			messageLogger(m).Error("Error adding busy reaction", "error", err)
+		}
+		return
+	}
+	if errors.Is(err, ai.ErrUnavailable) {
+		// The provider is down, say so without the error's details
+		b.session.ChannelMessageSend(channelID, b.trGuild(m.GuildID, "The AI is temporarily unavailable, please try again in a few minutes."))
+		return
+	}
+	if err != nil {
+		b.session.ChannelMessageSend(channelID, b.trGuild(m.GuildID, "Sorry, an error occurred: %v", err))
+		return
+	}
+
+	// Send response, remembering it so an edit of the message can update it
+	var followUps []string
+	if b.config().FollowUpButtons {
+		followUps = takeFollowUps(chat, reply)
+	}
+	answer := store.Answer{PromptID: m.ID, ChannelID: channelID, CreatedAt: time.Now()}
+	if m.EditedTimestamp != nil {
+		answer.EditedAt = *m.EditedTimestamp
+	}
+	answer.ReplyIDs = b.sendResponse(channelID, b.expiryNotice(chat)+b.responseText(m.GuildID, reply), responseFooter(reply, latency), withSpoilers(settings, reply), variant, followUps)
+	b.rememberFeedbackExchange(answer.ReplyIDs, m.Author.ID, m.Content, reply.Text)
+	b.rememberAnswer(answer, chat, before)
+	b.recordTurns(chat, before, m.Message, channelID)
+	b.advanceCampaign(m.Message, channelID, reply.Text)
+	b.titleThread(m, channelID, reply.Text)
+	b.summarizeThread(m, channelID, chat)
+
+	// Summarize older turns once the history grows past its token budget
+	b.compactHistory(chat, m.Author.ID, m.GuildID)
+	b.saveSession(chat)
+}
+
+// promptParts returns the parts sent to the model for a message: its
+// attachments, relevant knowledge base excerpts, what the bot remembers about
+// the author and the text itself
+func (b *Bot) promptParts(m *discordgo.Message) []genai.Part {
+	// Mentions and custom emojis are read by name, stickers described
+	userMessage, emojiParts := b.promptEmojis(m)
+	userMessage = b.promptMentions(m, userMessage)
+	// Prepare parts for Gemini
+	var parts []genai.Part
+
+	// Check for attachments
+	parts = append(parts, b.uploadAttachments(m.Author.ID, m.GuildID, m.Attachments)...)
+	parts = append(parts, emojiParts...)
+
+	// Add relevant knowledge base excerpts
+	if m.GuildID != "" && userMessage != "" {
+		if knowledge := b.knowledgeContext(m.Author.ID, m.GuildID, userMessage); knowledge != "" {
+			parts = append(parts, genai.Text(knowledge))
+		}
+	}
+
+	// Add what the bot remembers about the author
+	if userMessage != "" {
+		if memories := b.memoryContext(m.Author.ID, m.Author.Username); memories != "" {
+			parts = append(parts, genai.Text(memories))
+		}
+	}
+
+	// The title of a forum post isn't part of its opening message
+	if b.openingPost(m) {
+		parts = append(parts, genai.Text("Forum post title: "+b.forumPost(m.ChannelID).Name))
+	}
+
+	// Add text message to parts if not empty
+	if userMessage != "" {
+		parts = append(parts, genai.Text(userMessage))
+	}
+	return parts
+}
+
+// answer sends a message's parts to a chat session with ctx, recording the
+// exchange in the usage and audit logs, and returns the reply and how long it
+// took
+func (b *Bot) answer(ctx context.Context, chat ai.Chat, m *discordgo.Message, parts []genai.Part) (*ai.Reply, time.Duration, error) {
+	parts, err := b.beforePrompt(m.Author.ID, m.GuildID, b.scrubParts(m.GuildID, parts))
+	if err != nil {
+		return nil, 0, err
+	}
+	start := time.Now()
+	reply, err := b.sendChatMessage(ctx, chat, m.Author.ID, parts...)
+	b.auditExchange(m.Author.ID, m.GuildID, parts, reply, err)
+	if err != nil {
+		if !errors.Is(err, ai.ErrBusy) && !errors.Is(err, ai.ErrUnavailable) && !errors.Is(err, context.Canceled) {
+			messageLogger(&discordgo.MessageCreate{Message: m}).Error("Gemini error", "error", err)
+		}
+		return nil, 0, err
+	}
+	latency := time.Since(start)
+	reply.Text = b.fixMentions(m.GuildID, b.afterResponse(m.Author.ID, m.GuildID, b.fixEmojis(m.GuildID, reply.Text)))
+	b.touchChat(chat, m.Author.ID, m.GuildID)
+	b.recordUsage(m.Author.ID, m.GuildID, reply)
+	messageLogger(&discordgo.MessageCreate{Message: m}).Info("Answered message",
+		"model", reply.Model,
+		"latency", latency,
+		"prompt_tokens", reply.PromptTokens,
+		"response_tokens", reply.ResponseTokens,
+	)
+	return reply, latency, nil
+}
+
+// HandleInteraction routes slash commands, context-menu commands,
+// autocomplete requests, components and modals to their handlers
+func (b *Bot) HandleInteraction(i *discordgo.InteractionCreate) {
+	// Refuse requests to the model during maintenance, and once the server's
+	// monthly quota is used up
+	if usesAI(i) && b.maintenance.Load() {
+		b.respondEphemeral(i, tr(i, maintenanceMessage))
+		return
+	}
+	if usesAI(i) && b.quotaExhausted(i.GuildID) {
+		b.respondEphemeral(i, tr(i, quotaExhaustedMessage))
+		return
+	}
+
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		switch i.ApplicationCommandData().Name {
+		case "help":
+			b.helpCommand(i)
+		case "ask":
+			b.askCommand(i)
+		case "clear":
+			b.clearChatHistory(i)
+		case "stop":
+			b.stopCommand(i)
+		case "translate":
+			b.translateText(i)
+		case "json":
+			b.jsonCommand(i)
+		case "code":
+			b.codeCommand(i)
+		case "math":
+			b.mathCommand(i)
+		case "prompt":
+			b.promptCommand(i)
+		case "schedule":
+			b.scheduleCommand(i)
+		case "remindme":
+			b.remindMeCommand(i)
+		case "event":
+			b.eventCommand(i)
+		case "moderation":
+			b.moderationCommand(i)
+		case "welcome":
+			b.welcomeCommand(i)
+		case "reactions":
+			b.reactionsCommand(i)
+		case "export":
+			b.exportCommand(i)
+		case "tldr":
+			b.tldrCommand(i)
+		case "highlights":
+			b.highlightsCommand(i)
+		case "minutes":
+			b.minutesCommand(i)
+		case "topic":
+			b.topicCommand(i)
+		case "poll":
+			b.pollCommand(i)
+		case "announce":
+			b.announceCommand(i)
+		case "quiz":
+			b.quizCommand(i)
+		case "character":
+			b.characterCommand(i)
+		case "dm":
+			b.dmCommand(i)
+		case "review":
+			b.reviewCommand(i)
+		case "ocr":
+			b.ocrCommand(i)
+		case "extract":
+			b.extractCommand(i)
+		case "checkpoint":
+			b.checkpointCommand(i)
+		case "chat":
+			b.chatCommand(i)
+		case "settings":
+			b.settingsCommand(i)
+		case "script":
+			b.scriptCommand(i)
+		case "imagine":
+			b.imagine(i)
+		case "speak":
+			b.speakCommand(i)
+		case "voice":
+			b.voiceCommand(i)
+		case "kb":
+			b.kbCommand(i)
+		case "memory":
+			b.memoryCommand(i)
+		case "recall":
+			b.recallCommand(i)
+		case "index":
+			b.indexCommand(i)
+		case "usage":
+			b.usageCommand(i)
+		case "tokens":
+			b.tokensCommand(i)
+		case "stats":
+			b.statsCommand(i)
+		case "provider":
+			b.providerCommand(i)
+		case "compare":
+			b.compareCommand(i)
+		case "abtest":
+			b.abtestCommand(i)
+		case "feedback":
+			b.feedbackCommand(i)
+		case "admin":
+			b.adminCommand(i)
+		case "mydata":
+			b.myDataCommand(i)
+		case "forgetme":
+			b.forgetMeCommand(i)
+		case askCommandName:
+			b.askAboutMessage(i)
+		case translateCommandName:
+			b.translateMessage(i)
+		case explainCommandName:
+			b.explainMessage(i)
+		case explainFileCommandName:
+			b.explainFileCommand(i)
+		case ocrCommandName:
+			b.ocrMessage(i)
+		default:
+			b.handlePluginCommand(i)
+		}
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		switch i.ApplicationCommandData().Name {
+		case "translate":
+			b.autocompleteLanguage(i)
+		case "prompt":
+			b.autocompletePromptTemplate(i)
+		case "character":
+			b.autocompleteCharacter(i)
+		}
+	case discordgo.InteractionMessageComponent:
+		customID := i.MessageComponentData().CustomID
+		switch {
+		case strings.HasPrefix(customID, translateSelectPrefix):
+			b.retranslateMessage(i)
+		case customID == speakButtonID:
+			b.speakButton(i)
+		case customID == codeExplainButtonID:
+			b.explainCodeButton(i)
+		case customID == helpSelectID:
+			b.helpSelect(i)
+		case strings.HasPrefix(customID, settingsPrefix):
+			b.settingsComponent(i)
+		case strings.HasPrefix(customID, pollPrefix):
+			b.pollComponent(i)
+		case strings.HasPrefix(customID, quizPrefix):
+			b.quizComponent(i)
+		case strings.HasPrefix(customID, announcePrefix):
+			b.announceComponent(i)
+		case strings.HasPrefix(customID, renameUndoPrefix):
+			b.undoRename(i)
+		case strings.HasPrefix(customID, stopPrefix):
+			b.stopButton(i)
+		case strings.HasPrefix(customID, followUpPrefix):
+			b.followUpButton(i)
+		case strings.HasPrefix(customID, attachmentsConfirmPrefix), strings.HasPrefix(customID, attachmentsCancelPrefix):
+			b.attachmentsComponent(i)
+		case strings.HasPrefix(customID, feedbackPrefix):
+			b.feedbackButton(i)
+		}
+	case discordgo.InteractionModalSubmit:
+		customID := i.ModalSubmitData().CustomID
+		switch {
+		case strings.HasPrefix(customID, askModalPrefix):
+			b.answerAskModal(i)
+		case customID == settingsModalID:
+			b.settingsModal(i)
+		case strings.HasPrefix(customID, pollModalPrefix):
+			b.pollModal(i)
+		case strings.HasPrefix(customID, announceModalPrefix):
+			b.announceModal(i)
+		case customID == characterModalID:
+			b.characterModal(i)
+		case customID == reviewModalID:
+			b.reviewModal(i)
+		}
+	}
+}
+
+func (b *Bot) clearChatHistory(i *discordgo.InteractionCreate) {
+	// Restart the chat session to effectively clear the history
+	b.resetChat(i.ChannelID, i.GuildID)
+
+	// Respond to the slash command
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: tr(i, "Chat history has been cleared!"),
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to clear command", "error", err)
+	}
+}
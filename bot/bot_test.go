@@ -0,0 +1,257 @@
+package bot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+)
+
+func TestHandleMessageIgnoresOwnMessages(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello"}}}
+	b, session := newTestBot(t, client)
+
+	m := userMessage("hi")
+	m.Author.ID = botUserID
+	b.HandleMessage(m)
+
+	if len(session.messages) != 0 {
+		t.Errorf("sent %q, want nothing", session.messages)
+	}
+}
+
+func TestHandleMessageReplies(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello"}}}
+	b, session := newTestBot(t, client)
+
+	b.HandleMessage(userMessage("hi"))
+
+	if len(session.messages) != 1 || session.messages[0] != "hello" {
+		t.Errorf("sent %q, want [hello]", session.messages)
+	}
+	sent := client.chats[0].sent
+	if len(sent) != 1 || sent[0][len(sent[0])-1] != genai.Text("hi") {
+		t.Errorf("chat received %v, want the message text last", sent)
+	}
+}
+
+func TestHandleMessageEmptyReplyInServerLanguage(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{replies: []*ai.Reply{{}}})
+	session.guilds = []*discordgo.Guild{{ID: "guild", PreferredLocale: string(discordgo.German)}}
+
+	b.HandleMessage(userMessage("hi"))
+
+	if len(session.messages) != 1 || session.messages[0] != "Ich konnte keine Antwort erzeugen." {
+		t.Errorf("sent %q, want the empty reply explained in German", session.messages)
+	}
+}
+
+func TestHandleMessageSplitsLongReplies(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: strings.Repeat("a", 4500)}}}
+	b, session := newTestBot(t, client)
+
+	b.HandleMessage(userMessage("hi"))
+
+	if len(session.messages) != 3 {
+		t.Fatalf("sent %d messages, want 3", len(session.messages))
+	}
+	for _, message := range session.messages {
+		if len(message) > 2000 {
+			t.Errorf("sent a message of %d characters", len(message))
+		}
+	}
+}
+
+func TestHandleMessageAttachesVeryLongReplies(t *testing.T) {
+	answer := "Here is the plan.\n\n" + strings.Repeat("a", 9000)
+	client := &fakeAI{replies: []*ai.Reply{{Text: answer}}}
+	b, session := newTestBot(t, client)
+	b.config().MaxResponseChunks = 4
+
+	b.HandleMessage(userMessage("hi"))
+
+	want := "Here is the plan.\n\n📎 *The full answer is attached as `response.md`.*"
+	if len(session.messages) != 1 || session.messages[0] != want {
+		t.Errorf("sent %q, want [%q]", session.messages, want)
+	}
+	if file := string(session.files["channel/response.md"]); file != answer {
+		t.Errorf("attached %d characters, want the %d of the answer", len(file), len(answer))
+	}
+}
+
+func TestHandleMessageSendsEmbeds(t *testing.T) {
+	reply := &ai.Reply{Text: strings.Repeat("a", 5000), Model: "gemini-test", PromptTokens: 3, ResponseTokens: 4}
+	b, session := newTestBot(t, &fakeAI{replies: []*ai.Reply{reply}})
+	b.config().EmbedResponses = true
+
+	b.HandleMessage(userMessage("hi"))
+
+	if len(session.embeds) != 2 {
+		t.Fatalf("sent %d embeds, want 2", len(session.embeds))
+	}
+	if first := session.embeds[0]; len(first.Description) != embedDescriptionLimit || first.Footer != nil {
+		t.Errorf("first embed has %d characters and footer %v, want a full one without footer", len(first.Description), first.Footer)
+	}
+	footer := session.embeds[1].Footer
+	if footer == nil || !strings.HasPrefix(footer.Text, "gemini-test · ") || !strings.HasSuffix(footer.Text, " · 3 prompt + 4 response tokens") {
+		t.Errorf("footer = %v, want the model, latency and tokens", footer)
+	}
+}
+
+func TestHandleMessageReportsErrors(t *testing.T) {
+	client := &fakeAI{err: errors.New("quota exceeded")}
+	b, session := newTestBot(t, client)
+
+	b.HandleMessage(userMessage("hi"))
+
+	want := "Sorry, an error occurred: quota exceeded"
+	if len(session.messages) != 1 || session.messages[0] != want {
+		t.Errorf("sent %q, want [%q]", session.messages, want)
+	}
+}
+
+func TestClearResetsChat(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello"}}}
+	b, session := newTestBot(t, client)
+	before := b.chatFor("channel", "")
+
+	b.HandleInteraction(&discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:      discordgo.InteractionApplicationCommand,
+		ChannelID: "channel",
+		Data:      discordgo.ApplicationCommandInteractionData{Name: "clear"},
+	}})
+
+	if b.chatFor("channel", "") == before {
+		t.Error("chat was not replaced")
+	}
+	if len(session.responses) != 1 || session.responses[0].Data.Content != "Chat history has been cleared!" {
+		t.Errorf("responded %v", session.responses)
+	}
+}
+
+func TestMemoryToolCallIsStored(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{
+		{FunctionCalls: []genai.FunctionCall{{Name: "remember_fact", Args: map[string]any{"fact": "Prefers Go"}}}},
+		{Text: "Noted!"},
+	}}
+	b, session := newTestBot(t, client)
+
+	b.HandleMessage(userMessage("I prefer Go"))
+
+	if len(session.messages) != 1 || session.messages[0] != "Noted!" {
+		t.Errorf("sent %q, want [Noted!]", session.messages)
+	}
+	memories, err := b.store.Memories("user")
+	if err != nil {
+		t.Fatalf("Memories: %v", err)
+	}
+	if len(memories) != 1 || memories[0].Fact != "Prefers Go" {
+		t.Errorf("memories = %v, want [Prefers Go]", memories)
+	}
+	response, ok := client.chats[0].sent[1][0].(genai.FunctionResponse)
+	if !ok || response.Response["result"] != "remembered" {
+		t.Errorf("tool response = %v", client.chats[0].sent[1])
+	}
+}
+
+func TestAutoThreadKeepsSeparateChats(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello"}}}
+	b, session := newTestBot(t, client)
+	b.config().AutoThread = true
+
+	b.HandleMessage(userMessage("hi"))
+
+	if session.threadsStart != 1 {
+		t.Fatalf("started %d threads, want 1", session.threadsStart)
+	}
+	if b.chatFor("message", "") == b.chatFor("channel", "") {
+		t.Error("thread shares the channel's chat")
+	}
+}
+
+func TestSendChatMessageSumsTokens(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{
+		{FunctionCalls: []genai.FunctionCall{{Name: "remember_fact", Args: map[string]any{"fact": "Likes tea"}}}, PromptTokens: 10, ResponseTokens: 2},
+		{Text: "Noted!", PromptTokens: 15, ResponseTokens: 3},
+	}}
+	b, _ := newTestBot(t, client)
+
+	reply, err := b.sendChatMessage(b.ctx, b.chatFor("channel", ""), "user", genai.Text("I like tea"))
+	if err != nil {
+		t.Fatalf("sendChatMessage: %v", err)
+	}
+	if reply.PromptTokens != 25 || reply.ResponseTokens != 5 {
+		t.Errorf("tokens = %d/%d, want 25/5", reply.PromptTokens, reply.ResponseTokens)
+	}
+}
+
+func TestShutdownDrainsHandlers(t *testing.T) {
+	b, _ := newTestBot(t, &fakeAI{})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	go b.track(func() {
+		close(started)
+		<-release
+	}, nil)
+	<-started
+
+	if b.Shutdown(10 * time.Millisecond) {
+		t.Error("Shutdown reported drained with a handler in flight")
+	}
+
+	// New events are dropped once shutting down
+	ran := false
+	b.track(func() { ran = true }, nil)
+	if ran {
+		t.Error("handler ran after Shutdown")
+	}
+
+	close(release)
+	if !b.Shutdown(time.Second) {
+		t.Error("Shutdown didn't drain after the handler finished")
+	}
+}
+
+func TestTrackRecoversPanics(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+
+	b.track(func() { panic("boom") }, func() { b.session.ChannelMessageSend("channel", panicMessage) })
+
+	if len(session.messages) != 1 || session.messages[0] != panicMessage {
+		t.Errorf("sent %q, want the panic message", session.messages)
+	}
+	// The handler is no longer counted as in flight
+	if !b.Shutdown(time.Second) {
+		t.Error("Shutdown didn't drain after a panic")
+	}
+}
+
+func TestInteractionPanicNotifiesUser(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+	i := &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{ChannelID: "channel"}}
+
+	b.track(func() { panic("boom") }, func() { b.notifyInteractionPanic(i) })
+
+	if len(session.responses) != 1 || session.responses[0].Data.Content != panicMessage {
+		t.Errorf("responded %v, want the panic message", session.responses)
+	}
+}
+
+func TestHandleMessageReactsWhenBusy(t *testing.T) {
+	client := &fakeAI{err: ai.ErrBusy}
+	b, session := newTestBot(t, client)
+
+	b.HandleMessage(userMessage("hi"))
+
+	if len(session.messages) != 0 {
+		t.Errorf("sent %q, want nothing", session.messages)
+	}
+	if len(session.reactions) != 1 || session.reactions[0] != "⏳" {
+		t.Errorf("reactions = %q, want [⏳]", session.reactions)
+	}
+}
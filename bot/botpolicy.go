@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"slices"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Replies to bots in a channel further apart than this start a new streak
+const botLoopWindow = time.Minute
+
+// botStreak counts the replies sent to bots in a channel since a human last
+// posted there
+type botStreak struct {
+	replies int
+	last    time.Time
+	broken  bool
+}
+
+// fromBot reports whether a message was posted by a bot or a webhook
+func fromBot(m *discordgo.Message) bool {
+	return m.Author.Bot || m.WebhookID != ""
+}
+
+// answersAuthor applies the policy for messages from bots and webhooks:
+// only allowlisted ones are answered, and only until the replies to bots in
+// a channel look like a loop between two bots
+func (b *Bot) answersAuthor(m *discordgo.MessageCreate) bool {
+	cfg := b.config()
+
+	b.botStreaksMu.Lock()
+	defer b.botStreaksMu.Unlock()
+
+	// A human posting ends any streak
+	if !fromBot(m.Message) {
+		delete(b.botStreaks, m.ChannelID)
+		return true
+	}
+	if !slices.Contains(cfg.AllowedBots, m.Author.ID) && (m.WebhookID == "" || !slices.Contains(cfg.AllowedBots, m.WebhookID)) {
+		return false
+	}
+	if cfg.BotLoopLimit == 0 {
+		return true
+	}
+
+	now := time.Now()
+	streak, ok := b.botStreaks[m.ChannelID]
+	if !ok || now.Sub(streak.last) > botLoopWindow {
+		streak = &botStreak{}
+		b.botStreaks[m.ChannelID] = streak
+	}
+	if streak.replies >= cfg.BotLoopLimit {
+		if !streak.broken {
+			streak.broken = true
+			messageLogger(m).Warn("Breaking reply loop with a bot", "replies", streak.replies)
+		}
+		return false
+	}
+	streak.replies++
+	streak.last = now
+	return true
+}
@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+// botMessage returns a message posted by another bot, or through a webhook
+// when webhookID is set
+func botMessage(authorID, webhookID string) *discordgo.MessageCreate {
+	m := userMessage("hello bot")
+	m.Author = &discordgo.User{ID: authorID, Username: "otherbot", Bot: true}
+	m.WebhookID = webhookID
+	return m
+}
+
+func TestBotMessagePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		message *discordgo.MessageCreate
+		want    bool
+	}{
+		{"human", userMessage("hi"), true},
+		{"bot", botMessage("otherbot", ""), false},
+		{"webhook", botMessage("hook-user", "hook"), false},
+		{"allowed bot", botMessage("friendly", ""), true},
+		{"allowed webhook", botMessage("hook-user", "friendly-hook"), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, session := newTestBot(t, &fakeAI{replies: []*ai.Reply{{Text: "hello"}}})
+			b.config().AllowedBots = []string{"friendly", "friendly-hook"}
+
+			b.HandleMessage(test.message)
+			if answered := len(session.messages) > 0; answered != test.want {
+				t.Errorf("answered = %v, want %v", answered, test.want)
+			}
+		})
+	}
+}
+
+func TestBotLoopIsBroken(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{replies: []*ai.Reply{{Text: "hello"}}})
+	b.config().AllowedBots = []string{"friendly"}
+	b.config().BotLoopLimit = 2
+
+	for range 3 {
+		b.HandleMessage(botMessage("friendly", ""))
+	}
+	if len(session.messages) != 2 {
+		t.Errorf("answered %d bot messages in a row, want 2", len(session.messages))
+	}
+
+	// A human posting lets the bot talk to bots again
+	b.HandleMessage(userMessage("hi"))
+	b.HandleMessage(botMessage("friendly", ""))
+	if len(session.messages) != 4 {
+		t.Errorf("sent %d messages, want 4", len(session.messages))
+	}
+}
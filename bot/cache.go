@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/metrics"
+)
+
+// cachedResponse is the answer to a one-off prompt, kept until it expires
+type cachedResponse struct {
+	key     string
+	reply   *ai.Reply
+	expires time.Time
+}
+
+// responseCacheKey identifies a one-off prompt by the provider, model and
+// safety level answering it in a guild and its text, with whitespace
+// collapsed. Prompts with attachments and all prompts while the cache is
+// off aren't cached.
+func (b *Bot) responseCacheKey(guildID string, parts []genai.Part) (string, bool) {
+	if b.config().ResponseCacheTTL <= 0 {
+		return "", false
+	}
+	var texts []string
+	for _, part := range parts {
+		text, ok := part.(genai.Text)
+		if !ok {
+			return "", false
+		}
+		texts = append(texts, strings.Join(strings.Fields(string(text)), " "))
+	}
+
+	provider, _ := b.provider(guildID)
+	settings := b.guildSettings(guildID)
+	model := settings.Model
+	if model == "" {
+		model = b.modelName()
+	}
+	sum := sha256.Sum256([]byte(strings.Join(append([]string{provider, model, b.safetyLevel(settings, "")}, texts...), "\x00")))
+	return hex.EncodeToString(sum[:]), true
+}
+
+// cachedReply returns the cached answer to a prompt, or nil when there is
+// none or it expired
+func (b *Bot) cachedReply(key string) *ai.Reply {
+	b.responsesMu.Lock()
+	defer b.responsesMu.Unlock()
+
+	element, ok := b.responses[key]
+	if !ok {
+		metrics.ResponseCacheLookups.WithLabelValues("miss").Inc()
+		return nil
+	}
+	cached := element.Value.(*cachedResponse)
+	if time.Now().After(cached.expires) {
+		b.responseOrder.Remove(element)
+		delete(b.responses, key)
+		metrics.ResponseCacheLookups.WithLabelValues("miss").Inc()
+		return nil
+	}
+	b.responseOrder.MoveToFront(element)
+	metrics.ResponseCacheLookups.WithLabelValues("hit").Inc()
+	return cached.reply
+}
+
+// cacheReply caches the answer to a prompt, dropping the least recently
+// used answers once the cache is full
+func (b *Bot) cacheReply(key string, reply *ai.Reply) {
+	cfg := b.config()
+	b.responsesMu.Lock()
+	defer b.responsesMu.Unlock()
+
+	cached := &cachedResponse{key: key, reply: reply, expires: time.Now().Add(cfg.ResponseCacheTTL)}
+	if element, ok := b.responses[key]; ok {
+		element.Value = cached
+		b.responseOrder.MoveToFront(element)
+	} else {
+		b.responses[key] = b.responseOrder.PushFront(cached)
+	}
+	for b.responseOrder.Len() > max(cfg.ResponseCacheSize, 1) {
+		oldest := b.responseOrder.Back()
+		b.responseOrder.Remove(oldest)
+		delete(b.responses, oldest.Value.(*cachedResponse).key)
+	}
+}
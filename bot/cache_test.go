@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/store"
+)
+
+func TestResponseCache(t *testing.T) {
+	fake := &fakeAI{text: "Paris"}
+	b, _ := newTestBot(t, fake)
+
+	// Off by default
+	b.generate("alice", "guild", genai.Text("What is the capital of France?"))
+	b.generate("bob", "guild", genai.Text("What is the capital of France?"))
+	if len(fake.prompts) != 2 {
+		t.Fatalf("prompts with the cache off = %d, want 2", len(fake.prompts))
+	}
+
+	cfg := *b.config()
+	cfg.ResponseCacheTTL = time.Hour
+	cfg.ResponseCacheSize = 2
+	b.SetConfig(&cfg)
+	fake.prompts = nil
+
+	steps := []struct {
+		name   string
+		guild  string
+		parts  []genai.Part
+		cached bool
+	}{
+		{"first ask", "guild", []genai.Part{genai.Text("What is the capital of France?")}, false},
+		{"same question", "guild", []genai.Part{genai.Text("What is  the capital of France?\n")}, true},
+		{"same question in another server", "other", []genai.Part{genai.Text("What is the capital of France?")}, true},
+		{"with an attachment", "guild", []genai.Part{genai.FileData{URI: "file"}, genai.Text("What is the capital of France?")}, false},
+		{"another question", "guild", []genai.Part{genai.Text("What is the capital of Spain?")}, false},
+		{"a third one", "guild", []genai.Part{genai.Text("What is the capital of Italy?")}, false},
+		// The least recently used question was dropped
+		{"first question again", "guild", []genai.Part{genai.Text("What is the capital of France?")}, false},
+		{"most recent question", "guild", []genai.Part{genai.Text("What is the capital of Italy?")}, true},
+	}
+	for _, step := range steps {
+		before := len(fake.prompts)
+		answer, err := b.generate("alice", step.guild, step.parts...)
+		if err != nil || answer != "Paris" {
+			t.Fatalf("%s: generate = %q, %v", step.name, answer, err)
+		}
+		if cached := len(fake.prompts) == before; cached != step.cached {
+			t.Errorf("%s: cached %v, want %v", step.name, cached, step.cached)
+		}
+	}
+
+	// A server's own model gets its own answers
+	if err := b.saveGuildSettings("guild", &store.GuildSettings{GuildID: "guild", Trigger: triggerAll, Model: "gemini-1.5-flash"}); err != nil {
+		t.Fatal(err)
+	}
+	before := len(fake.prompts)
+	b.generate("alice", "guild", genai.Text("What is the capital of Italy?"))
+	if len(fake.prompts) == before {
+		t.Error("answer cached for the default model was reused for the server's model")
+	}
+
+	// Expired answers are asked again
+	b.responsesMu.Lock()
+	for _, element := range b.responses {
+		element.Value.(*cachedResponse).expires = time.Now().Add(-time.Second)
+	}
+	b.responsesMu.Unlock()
+	before = len(fake.prompts)
+	b.generate("alice", "other", genai.Text("What is the capital of Italy?"))
+	if len(fake.prompts) == before {
+		t.Error("expired answer was reused")
+	}
+
+	// Empty answers, such as blocked ones, aren't cached
+	fake.text = ""
+	before = len(fake.prompts)
+	b.generate("alice", "other", genai.Text("Something blocked"))
+	b.generate("alice", "other", genai.Text("Something blocked"))
+	if len(fake.prompts) != before+2 {
+		t.Errorf("prompts for an empty answer = %d, want 2", len(fake.prompts)-before)
+	}
+}
@@ -0,0 +1,328 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/store"
+)
+
+// campaignProfile is the conversation profile a channel's campaign is played
+// in, so it keeps a history of its own
+const campaignProfile = "campaign"
+
+// Most party members and items a campaign keeps track of
+const maxCampaignEntries = 25
+
+// campaignUpdate is the model's new state of a campaign after a turn
+type campaignUpdate struct {
+	Party     []string `json:"party"`
+	Inventory []string `json:"inventory"`
+	Scene     string   `json:"scene"`
+}
+
+// dmCommand handles /dm, in which the bot runs a tabletop campaign as its
+// dungeon master, keeping the party, inventory and scene in the store
+func (b *Bot) dmCommand(i *discordgo.InteractionCreate) {
+	subcommand := i.ApplicationCommandData().Options[0]
+	if subcommand.Name == "start" {
+		b.startCampaign(i, commandOption(subcommand.Options, "setting").StringValue())
+		return
+	}
+
+	campaign, err := b.store.Campaign(i.ChannelID)
+	if err != nil {
+		interactionLogger(i).Error("Error loading campaign", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if campaign == nil {
+		b.respondEphemeral(i, tr(i, "There's no campaign in this channel, start one with `/dm start`."))
+		return
+	}
+	switch subcommand.Name {
+	case "join":
+		b.joinCampaign(i, campaign, commandOption(subcommand.Options, "character").StringValue())
+	case "state":
+		err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Embeds: []*discordgo.MessageEmbed{campaignEmbed(campaign)}},
+		})
+		if err != nil {
+			interactionLogger(i).Error("Error responding to dm command", "error", err)
+		}
+	case "recap":
+		b.recapCampaign(i, campaign)
+	case "end":
+		b.endCampaign(i, campaign)
+	}
+}
+
+// startCampaign starts a campaign in the channel, in a conversation profile
+// of its own, and narrates its opening scene
+func (b *Bot) startCampaign(i *discordgo.InteractionCreate, setting string) {
+	if campaign, err := b.store.Campaign(i.ChannelID); err == nil && campaign != nil {
+		b.respondEphemeral(i, tr(i, "A campaign is already running in this channel, see `/dm state` or end it with `/dm end`."))
+		return
+	}
+
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to dm command", "error", err)
+		return
+	}
+
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"opening": {Type: genai.TypeString, Description: "Narration opening the campaign, ending by asking the players what they do"},
+			"scene":   {Type: genai.TypeString, Description: "Where the party is and what is happening, in two or three sentences"},
+		},
+		Required: []string{"opening", "scene"},
+	}
+	prompt := "You are the dungeon master of a new tabletop roleplaying campaign played in a Discord channel. " +
+		"Write its opening in a few vivid paragraphs.\n\nSetting: " + setting
+	text, err := b.generateJSON(interactionUserID(i), i.GuildID, schema, genai.Text(prompt))
+	var opening struct {
+		Opening string `json:"opening"`
+		Scene   string `json:"scene"`
+	}
+	if err == nil {
+		err = json.Unmarshal([]byte(text), &opening)
+	}
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+
+	campaign := store.Campaign{
+		ChannelID: i.ChannelID,
+		GuildID:   i.GuildID,
+		Setting:   setting,
+		Scene:     strings.TrimSpace(opening.Scene),
+		StartedBy: interactionUserID(i),
+		UpdatedAt: time.Now(),
+	}
+	err = b.store.StartCampaign(campaign)
+	if err == nil {
+		err = b.store.SaveChatProfile(store.ChatProfile{ChannelID: i.ChannelID, Name: campaignProfile}, maxChatProfiles)
+	}
+	if err == nil {
+		err = b.store.SetActiveChatProfile(i.ChannelID, campaignProfile)
+	}
+	if errors.Is(err, store.ErrProfilesFull) {
+		b.store.EndCampaign(i.ChannelID)
+		b.editInteractionResponse(i, tr(i, "This channel already has %d conversations, delete one with `/chat delete` first.", maxChatProfiles))
+		return
+	}
+	if err != nil {
+		interactionLogger(i).Error("Error starting campaign", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	// A new campaign doesn't remember the previous one
+	b.forgetProfileChat(i.ChannelID, campaignProfile)
+	interactionLogger(i).Info("Started campaign")
+
+	b.editInteractionResponseLong(i, tr(i, "🎲 **A new campaign begins.** Join the party with `/dm join`, then say what you do.")+"\n\n"+opening.Opening, 0)
+}
+
+// joinCampaign adds a member's character to the party, replacing the one
+// they had
+func (b *Bot) joinCampaign(i *discordgo.InteractionCreate, campaign *store.Campaign, character string) {
+	player := interactionUser(i).Username
+	line := player + ": " + strings.ReplaceAll(strings.TrimSpace(character), "\n", " ")
+	party := []string{line}
+	for _, member := range campaign.Party {
+		if !strings.HasPrefix(member, player+": ") {
+			party = append(party, member)
+		}
+	}
+	if len(party) > maxCampaignEntries {
+		b.respondEphemeral(i, tr(i, "The party is full."))
+		return
+	}
+	campaign.Party, campaign.UpdatedAt = party, time.Now()
+	if err := b.store.UpdateCampaign(*campaign); err != nil {
+		interactionLogger(i).Error("Error saving campaign", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	b.respond(i, tr(i, "⚔️ %s joins the party.", line))
+}
+
+// recapCampaign posts the story of a campaign so far
+func (b *Bot) recapCampaign(i *discordgo.InteractionCreate, campaign *store.Campaign) {
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to dm command", "error", err)
+		return
+	}
+
+	var transcript strings.Builder
+	for _, turn := range b.channelConversation(i.ChannelID, i.GuildID) {
+		name := turn.Author
+		if turn.Role == "model" {
+			name = "Dungeon master"
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", name, turn.Text)
+	}
+	prompt := "Write a short \"previously on\" recap of this tabletop campaign for its players, in the past tense, " +
+		"from its start to the current scene.\n\n" + campaignState(campaign) + "\n\nTranscript:\n" + transcript.String()
+	recap, err := b.generate(interactionUserID(i), i.GuildID, genai.Text(prompt))
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	b.editInteractionResponseLong(i, "📜 **Previously…**\n"+recap, 0)
+}
+
+// endCampaign ends a channel's campaign, going back to its default
+// conversation. Only whoever started it or a moderator can.
+func (b *Bot) endCampaign(i *discordgo.InteractionCreate, campaign *store.Campaign) {
+	if interactionUserID(i) != campaign.StartedBy && (i.Member == nil || i.Member.Permissions&discordgo.PermissionManageMessages == 0) {
+		b.respondEphemeral(i, tr(i, "Only whoever started the campaign or a moderator can end it."))
+		return
+	}
+	_, err := b.store.EndCampaign(i.ChannelID)
+	if err == nil {
+		_, err = b.store.DeleteChatProfile(i.ChannelID, campaignProfile)
+	}
+	if err != nil {
+		interactionLogger(i).Error("Error ending campaign", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	b.forgetProfileChat(i.ChannelID, campaignProfile)
+	interactionLogger(i).Info("Ended campaign", "turns", campaign.Turns)
+	b.respond(i, tr(i, "🏁 The campaign ended after %d turns.", campaign.Turns))
+}
+
+// withCampaign prepends the dungeon master's instructions and the state of
+// the channel's campaign to a message's parts
+func (b *Bot) withCampaign(channelID string, parts []genai.Part) []genai.Part {
+	campaign, err := b.store.Campaign(channelID)
+	if err != nil {
+		slog.Error("Error loading campaign", "channel", channelID, "error", err)
+	}
+	if campaign == nil {
+		return parts
+	}
+	instructions := "You are the dungeon master of the tabletop roleplaying campaign played in this channel. " +
+		"Narrate the world, play every non-player character and resolve what the players do fairly, " +
+		"rolling dice when the outcome is uncertain, then ask them what they do next. Stay consistent with the campaign's state.\n\n" +
+		campaignState(campaign)
+	return append([]genai.Part{genai.Text(instructions)}, parts...)
+}
+
+// advanceCampaign has the model update the state of the channel's campaign
+// after a turn: a player's message and the dungeon master's answer
+func (b *Bot) advanceCampaign(m *discordgo.Message, channelID string, answer string) {
+	campaign, err := b.store.Campaign(channelID)
+	if err != nil || campaign == nil || answer == "" {
+		return
+	}
+
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"party": {
+				Type:        genai.TypeArray,
+				Description: "Party members as \"player: character, class, condition\"",
+				Items:       &genai.Schema{Type: genai.TypeString},
+			},
+			"inventory": {
+				Type:        genai.TypeArray,
+				Description: "Items the party carries, with quantities",
+				Items:       &genai.Schema{Type: genai.TypeString},
+			},
+			"scene": {Type: genai.TypeString, Description: "Where the party is and what is happening, in two or three sentences"},
+		},
+		Required: []string{"party", "inventory", "scene"},
+	}
+	prompt := fmt.Sprintf("Update the state of a tabletop campaign after its latest turn. Keep party members and items "+
+		"the turn didn't change, add or remove the ones it did, and describe the current scene.\n\n"+
+		"State before the turn:\n%s\n\n%s wrote: %s\n\nThe dungeon master answered: %s",
+		campaignState(campaign), m.Author.Username, m.Content, answer)
+	text, err := b.generateJSON(m.Author.ID, m.GuildID, schema, genai.Text(prompt))
+	var update campaignUpdate
+	if err == nil {
+		err = json.Unmarshal([]byte(text), &update)
+	}
+	if err != nil {
+		messageLogger(&discordgo.MessageCreate{Message: m}).Warn("Error updating campaign", "error", err)
+		return
+	}
+
+	campaign.Party = campaignEntries(update.Party)
+	campaign.Inventory = campaignEntries(update.Inventory)
+	if scene := strings.TrimSpace(update.Scene); scene != "" {
+		campaign.Scene = scene
+	}
+	campaign.Turns++
+	campaign.UpdatedAt = time.Now()
+	if err := b.store.UpdateCampaign(*campaign); err != nil {
+		messageLogger(&discordgo.MessageCreate{Message: m}).Error("Error saving campaign", "error", err)
+	}
+}
+
+// campaignEntries cleans up the party members or items of a campaign update
+func campaignEntries(entries []string) []string {
+	var cleaned []string
+	for _, entry := range entries {
+		if entry = strings.TrimSpace(strings.ReplaceAll(entry, "\n", " ")); entry != "" && len(cleaned) < maxCampaignEntries {
+			cleaned = append(cleaned, entry)
+		}
+	}
+	return cleaned
+}
+
+// campaignState describes the state of a campaign for the model
+func campaignState(c *store.Campaign) string {
+	list := func(entries []string) string {
+		if len(entries) == 0 {
+			return "(none)"
+		}
+		return "- " + strings.Join(entries, "\n- ")
+	}
+	return fmt.Sprintf("Setting: %s\nParty:\n%s\nInventory:\n%s\nCurrent scene: %s\nTurns played: %d",
+		c.Setting, list(c.Party), list(c.Inventory), c.Scene, c.Turns)
+}
+
+// campaignEmbed shows the state of a campaign
+func campaignEmbed(c *store.Campaign) *discordgo.MessageEmbed {
+	list := func(entries []string, empty string) string {
+		if len(entries) == 0 {
+			return empty
+		}
+		return truncate("• "+strings.Join(entries, "\n• "), 1024)
+	}
+	scene := c.Scene
+	if scene == "" {
+		scene = "Not set yet"
+	}
+	return &discordgo.MessageEmbed{
+		Title:       "🎲 Campaign state",
+		Description: truncate(c.Setting, 4096),
+		Color:       embedColor,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Party", Value: list(c.Party, "Nobody yet, join with `/dm join`")},
+			{Name: "Inventory", Value: list(c.Inventory, "Empty")},
+			{Name: "Scene", Value: truncate(scene, 1024)},
+		},
+		Footer: &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%d turns played", c.Turns)},
+	}
+}
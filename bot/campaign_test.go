@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+// dmInteraction is a /dm subcommand run in "channel"
+func dmInteraction(userID string, permissions int64, subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	i := promptInteraction(userID, permissions, subcommand, options...)
+	i.ChannelID = "channel"
+	data := i.Data.(discordgo.ApplicationCommandInteractionData)
+	data.Name = "dm"
+	i.Data = data
+	return i
+}
+
+func TestCampaign(t *testing.T) {
+	client := &fakeAI{
+		text: `{"opening": "You wake in a dungeon.",
+			"party": ["alice: Mira, elven ranger"], "inventory": ["Rusty key"], "scene": "The cell door is open"}`,
+		replies: []*ai.Reply{{Text: "The key turns. What do you do?"}},
+	}
+	b, session := newTestBot(t, client)
+
+	session.responses = nil
+	b.HandleInteraction(dmInteraction("alice", 0, "state"))
+	if len(session.responses) != 1 || !strings.Contains(session.responses[0].Data.Content, "no campaign") {
+		t.Fatalf("responded %v, want no campaign", session.responses)
+	}
+
+	b.HandleInteraction(dmInteraction("alice", 0, "start", stringOption("setting", "A haunted keep")))
+	if len(session.edits) != 1 || !strings.Contains(*session.edits[0].Content, "You wake in a dungeon.") {
+		t.Fatalf("edits = %v, want the opening", session.edits)
+	}
+	session.responses = nil
+	b.HandleInteraction(dmInteraction("bob", 0, "start", stringOption("setting", "Space")))
+	if len(session.responses) != 1 || !strings.Contains(session.responses[0].Data.Content, "already running") {
+		t.Errorf("responded %v, want a refusal", session.responses)
+	}
+
+	session.responses = nil
+	b.HandleInteraction(dmInteraction("alice", 0, "join", stringOption("character", "Mira, elven ranger")))
+	if len(session.responses) != 1 || session.responses[0].Data.Content != "⚔️ alice: Mira, elven ranger joins the party." {
+		t.Errorf("responded %v, want alice to join", session.responses)
+	}
+
+	// Each turn is played with the campaign's state, then updates it
+	b.HandleMessage(userMessage("I try the key on the door"))
+	chat := b.chatFor("channel", "guild")
+	if prompt := partsText(chat.History()[0].Parts); !strings.Contains(prompt, "dungeon master") || !strings.Contains(prompt, "alice: Mira, elven ranger") {
+		t.Errorf("prompt %q, want the campaign's state", prompt)
+	}
+	campaign, err := b.store.Campaign("channel")
+	if err != nil || campaign == nil || campaign.Turns != 1 || campaign.Scene != "The cell door is open" || len(campaign.Inventory) != 1 {
+		t.Fatalf("campaign = %+v, %v, want it updated after the turn", campaign, err)
+	}
+
+	session.responses = nil
+	b.HandleInteraction(dmInteraction("alice", 0, "state"))
+	if len(session.responses) != 1 || len(session.responses[0].Data.Embeds) != 1 || session.responses[0].Data.Embeds[0].Fields[1].Value != "• Rusty key" {
+		t.Errorf("responded %v, want the state embed", session.responses)
+	}
+
+	// Only the starter or a moderator ends it, going back to the default
+	// conversation
+	session.responses = nil
+	b.HandleInteraction(dmInteraction("bob", 0, "end"))
+	b.HandleInteraction(dmInteraction("mod", discordgo.PermissionManageMessages, "end"))
+	if len(session.responses) != 2 || !strings.Contains(session.responses[0].Data.Content, "Only whoever started") ||
+		session.responses[1].Data.Content != "🏁 The campaign ended after 1 turns." {
+		t.Errorf("responded %v, want bob refused and the mod to end it", session.responses)
+	}
+	if profile := b.activeProfile("channel"); profile != nil {
+		t.Errorf("active profile %q, want the default conversation", profile.Name)
+	}
+}
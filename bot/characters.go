@@ -0,0 +1,314 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/store"
+)
+
+const (
+	// Roleplay characters each server may save
+	maxCharacters = 50
+
+	// Custom ID of the /character create form
+	characterModalID = "character-modal"
+)
+
+// characterCard is the JSON form of /character export, for moderators
+// reviewing a character
+type characterCard struct {
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	Greeting        string `json:"greeting"`
+	ExampleDialogue string `json:"example_dialogue,omitempty"`
+	AuthorID        string `json:"author_id,omitempty"`
+	GuildID         string `json:"guild_id"`
+}
+
+// characterCommand handles the /character subcommands, which create, list,
+// delete and export the server's roleplay characters and start roleplays
+// with them
+func (b *Bot) characterCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Characters only work in servers."))
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	switch subcommand.Name {
+	case "create":
+		b.openCharacterModal(i)
+	case "chat":
+		b.startCharacterChat(i, commandOption(subcommand.Options, "name").StringValue())
+	case "list":
+		b.listCharacters(i)
+	case "delete":
+		b.deleteCharacter(i, commandOption(subcommand.Options, "name").StringValue())
+	case "export":
+		b.exportCharacter(i, commandOption(subcommand.Options, "name").StringValue())
+	}
+}
+
+// openCharacterModal opens the form describing a new character
+func (b *Bot) openCharacterModal(i *discordgo.InteractionCreate) {
+	input := func(id, label, placeholder string, style discordgo.TextInputStyle, required bool, maxLength int) discordgo.MessageComponent {
+		return discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.TextInput{CustomID: id, Label: label, Placeholder: placeholder, Style: style, Required: required, MaxLength: maxLength},
+		}}
+	}
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: characterModalID,
+			Title:    "New character",
+			Components: []discordgo.MessageComponent{
+				input("name", "Name", "Saving an existing name replaces it", discordgo.TextInputShort, true, 32),
+				input("description", "Description", "Who they are, how they talk and behave", discordgo.TextInputParagraph, true, 1000),
+				input("greeting", "Greeting", "The first message they send", discordgo.TextInputParagraph, true, 500),
+				input("example", "Example dialogue", "A short exchange showing their voice", discordgo.TextInputParagraph, false, 1500),
+			},
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error opening character modal", "error", err)
+	}
+}
+
+// characterModal saves the character submitted with the /character create
+// form. Only its author or members with the Manage Server permission may
+// replace an existing one.
+func (b *Bot) characterModal(i *discordgo.InteractionCreate) {
+	data := i.ModalSubmitData()
+	character := store.Character{
+		GuildID:         i.GuildID,
+		Name:            strings.TrimSpace(modalTextValue(data, "name")),
+		Description:     strings.TrimSpace(modalTextValue(data, "description")),
+		Greeting:        strings.TrimSpace(modalTextValue(data, "greeting")),
+		ExampleDialogue: strings.TrimSpace(modalTextValue(data, "example")),
+		AuthorID:        interactionUserID(i),
+	}
+	if character.Name == "" || character.Description == "" || character.Greeting == "" {
+		b.respondEphemeral(i, tr(i, "A character needs a name, a description and a greeting."))
+		return
+	}
+
+	existing, err := b.store.Character(i.GuildID, character.Name)
+	if err != nil {
+		interactionLogger(i).Error("Error loading character", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if existing != nil && !canManageCharacter(i, existing) {
+		b.respondEphemeral(i, tr(i, "The character **%s** belongs to someone else. You need the Manage Server permission to change it.", existing.Name))
+		return
+	}
+
+	err = b.store.SaveCharacter(character, maxCharacters)
+	if errors.Is(err, store.ErrCharactersFull) {
+		b.respondEphemeral(i, tr(i, "This server already has %d characters, delete one with `/character delete` first.", maxCharacters))
+		return
+	}
+	if err != nil {
+		interactionLogger(i).Error("Error saving character", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	interactionLogger(i).Info("Saved character", "name", character.Name)
+	b.respondEphemeral(i, tr(i, "Saved the character **%s**. Start a roleplay with `/character chat name:%s`.", character.Name, character.Name))
+}
+
+// startCharacterChat starts a thread where the bot plays a character. The
+// thread gets a conversation profile of its own, whose persona is the
+// character, so it keeps a separate history that /export can hand to
+// moderators.
+func (b *Bot) startCharacterChat(i *discordgo.InteractionCreate, name string) {
+	character, err := b.store.Character(i.GuildID, strings.TrimSpace(name))
+	if err != nil {
+		interactionLogger(i).Error("Error loading character", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if character == nil {
+		b.respondEphemeral(i, tr(i, "There's no character named **%s**. See `/character list`.", name))
+		return
+	}
+	if b.isThread(i.ChannelID) {
+		b.respondEphemeral(i, tr(i, "Use this command in a channel, the roleplay gets a thread of its own."))
+		return
+	}
+
+	user := interactionUser(i)
+	opener, err := b.session.ChannelMessageSendComplex(i.ChannelID, &discordgo.MessageSend{
+		Content:         fmt.Sprintf("🎭 <@%s> started a roleplay with **%s**.", user.ID, character.Name),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	var thread *discordgo.Channel
+	if err == nil {
+		// Thread names are limited to 100 characters
+		thread, err = b.session.MessageThreadStartComplex(i.ChannelID, opener.ID, &discordgo.ThreadStart{
+			Name:                truncate(character.Name+" – "+user.Username, 100),
+			AutoArchiveDuration: 1440,
+		})
+	}
+	if err == nil {
+		profile := store.ChatProfile{ChannelID: thread.ID, Name: strings.ToLower(character.Name), Persona: characterPersona(character)}
+		err = b.store.SaveChatProfile(profile, maxChatProfiles)
+		if err == nil {
+			err = b.store.SetActiveChatProfile(thread.ID, profile.Name)
+		}
+	}
+	if err != nil {
+		interactionLogger(i).Error("Error starting roleplay", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+
+	// Like threads started for auto-thread mode, the thread is the bot's,
+	// so every message in it is answered
+	b.chatsMu.Lock()
+	b.threadChats[thread.ID] = b.aiFor(i.GuildID).NewChat()
+	b.chatsMu.Unlock()
+
+	if _, err := b.session.ChannelMessageSend(thread.ID, truncate(fmt.Sprintf("**%s:** %s", character.Name, character.Greeting), 2000)); err != nil {
+		interactionLogger(i).Error("Error sending character greeting", "error", err)
+	}
+	interactionLogger(i).Info("Started roleplay", "character", character.Name, "thread", thread.ID)
+	b.respondEphemeral(i, tr(i, "Started the roleplay in <#%s>.", thread.ID))
+}
+
+// characterPersona is the persona the bot takes on to play a character
+func characterPersona(c *store.Character) string {
+	persona := fmt.Sprintf("Roleplay as %s and stay in character, writing only %s's lines. "+
+		"If asked for something against the rules of the server or harmful, step out of character to decline.\n"+
+		"Character description: %s\nYou opened the roleplay with: %s", c.Name, c.Name, c.Description, c.Greeting)
+	if c.ExampleDialogue != "" {
+		persona += "\nExample of how " + c.Name + " talks:\n" + c.ExampleDialogue
+	}
+	return persona
+}
+
+// listCharacters lists the server's characters
+func (b *Bot) listCharacters(i *discordgo.InteractionCreate) {
+	characters, err := b.store.Characters(i.GuildID)
+	if err != nil {
+		interactionLogger(i).Error("Error loading characters", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if len(characters) == 0 {
+		b.respondEphemeral(i, tr(i, "This server has no characters yet. Create one with `/character create`."))
+		return
+	}
+	var lines []string
+	for _, c := range characters {
+		lines = append(lines, fmt.Sprintf("**%s** %s", c.Name, truncate(strings.ReplaceAll(c.Description, "\n", " "), 100)))
+	}
+	b.respondEphemeral(i, truncate(strings.Join(lines, "\n"), 2000))
+}
+
+// deleteCharacter deletes one of the server's characters, which only its
+// author or members with the Manage Server permission may do. Roleplays
+// already started keep going.
+func (b *Bot) deleteCharacter(i *discordgo.InteractionCreate, name string) {
+	character, err := b.store.Character(i.GuildID, strings.TrimSpace(name))
+	if err == nil && character != nil && canManageCharacter(i, character) {
+		_, err = b.store.DeleteCharacter(i.GuildID, character.Name)
+	}
+	switch {
+	case err != nil:
+		interactionLogger(i).Error("Error deleting character", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+	case character == nil:
+		b.respondEphemeral(i, tr(i, "There's no character named **%s**. See `/character list`.", name))
+	case !canManageCharacter(i, character):
+		b.respondEphemeral(i, tr(i, "The character **%s** belongs to someone else. You need the Manage Server permission to change it.", character.Name))
+	default:
+		interactionLogger(i).Info("Deleted character", "name", character.Name)
+		b.respondEphemeral(i, tr(i, "Deleted the character **%s**.", character.Name))
+	}
+}
+
+// exportCharacter attaches a character's card as JSON, with who wrote it,
+// so moderators can review it
+func (b *Bot) exportCharacter(i *discordgo.InteractionCreate, name string) {
+	character, err := b.store.Character(i.GuildID, strings.TrimSpace(name))
+	if err != nil {
+		interactionLogger(i).Error("Error loading character", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if character == nil {
+		b.respondEphemeral(i, tr(i, "There's no character named **%s**. See `/character list`.", name))
+		return
+	}
+
+	data, err := json.MarshalIndent(characterCard{
+		Name:            character.Name,
+		Description:     character.Description,
+		Greeting:        character.Greeting,
+		ExampleDialogue: character.ExampleDialogue,
+		AuthorID:        character.AuthorID,
+		GuildID:         character.GuildID,
+	}, "", "  ")
+	if err != nil {
+		interactionLogger(i).Error("Error encoding character", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	err = b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: tr(i, "Character card of **%s**. Use `/export` in a roleplay's thread for its conversation.", character.Name),
+			Files:   []*discordgo.File{{Name: "character.json", ContentType: "application/json", Reader: bytes.NewReader(data)}},
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error sending character card", "error", err)
+	}
+}
+
+// autocompleteCharacter suggests the server's characters matching the name
+// typed so far
+func (b *Bot) autocompleteCharacter(i *discordgo.InteractionCreate) {
+	typed := ""
+	if option := commandOption(i.ApplicationCommandData().Options[0].Options, "name"); option != nil {
+		typed = strings.ToLower(strings.TrimSpace(option.StringValue()))
+	}
+
+	characters, err := b.store.Characters(i.GuildID)
+	if err != nil {
+		interactionLogger(i).Error("Error loading characters", "error", err)
+	}
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, c := range characters {
+		if strings.Contains(strings.ToLower(c.Name), typed) && len(choices) < 25 {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: c.Name, Value: c.Name})
+		}
+	}
+
+	err = b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to character autocomplete", "error", err)
+	}
+}
+
+// canManageCharacter reports whether an interaction comes from a
+// character's author or a member with the Manage Server permission
+func canManageCharacter(i *discordgo.InteractionCreate, c *store.Character) bool {
+	if c.AuthorID != "" && c.AuthorID == interactionUserID(i) {
+		return true
+	}
+	return i.Member != nil && i.Member.Permissions&discordgo.PermissionManageServer != 0
+}
@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+// characterInteraction is a /character subcommand run in "channel"
+func characterInteraction(userID string, permissions int64, subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	i := promptInteraction(userID, permissions, subcommand, options...)
+	i.ChannelID = "channel"
+	data := i.Data.(discordgo.ApplicationCommandInteractionData)
+	data.Name = "character"
+	i.Data = data
+	return i
+}
+
+// characterForm is the /character create form submitted by a member
+func characterForm(userID string, values map[string]string) *discordgo.InteractionCreate {
+	data := discordgo.ModalSubmitInteractionData{CustomID: characterModalID}
+	for id, value := range values {
+		data.Components = append(data.Components, &discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			&discordgo.TextInput{CustomID: id, Value: value},
+		}})
+	}
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:      discordgo.InteractionModalSubmit,
+		GuildID:   "guild",
+		ChannelID: "channel",
+		Member:    &discordgo.Member{User: &discordgo.User{ID: userID, Username: userID}},
+		Data:      data,
+	}}
+}
+
+func TestCharacterCommand(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "You shall not pass!"}}}
+	b, session := newTestBot(t, client)
+	gandalf := map[string]string{"name": "Gandalf", "description": "A wise old wizard", "greeting": "A wizard is never late."}
+
+	steps := []struct {
+		interaction *discordgo.InteractionCreate
+		want        string
+	}{
+		{characterForm("alice", gandalf), "Saved the character **Gandalf**. Start a roleplay with `/character chat name:Gandalf`."},
+		{characterForm("bob", gandalf), "The character **Gandalf** belongs to someone else. You need the Manage Server permission to change it."},
+		{characterForm("bob", map[string]string{"name": "Pirate"}), "A character needs a name, a description and a greeting."},
+		{characterInteraction("alice", 0, "list"), "**Gandalf** A wise old wizard"},
+		{characterInteraction("bob", 0, "delete", stringOption("name", "gandalf")),
+			"The character **Gandalf** belongs to someone else. You need the Manage Server permission to change it."},
+		{characterInteraction("bob", 0, "chat", stringOption("name", "Saruman")), "There's no character named **Saruman**. See `/character list`."},
+	}
+	for _, step := range steps {
+		session.responses = nil
+		b.HandleInteraction(step.interaction)
+		if len(session.responses) != 1 || session.responses[0].Data.Content != step.want {
+			t.Errorf("responded %v, want %q", session.responses, step.want)
+		}
+	}
+
+	// Chatting starts a thread playing the character, which greets first
+	session.responses = nil
+	b.HandleInteraction(characterInteraction("bob", 0, "chat", stringOption("name", "gandalf")))
+	if session.threadsStart != 1 || len(session.messages) != 2 || session.messages[1] != "**Gandalf:** A wizard is never late." {
+		t.Fatalf("started %d threads and sent %q, want a thread with the greeting", session.threadsStart, session.messages)
+	}
+	threadID := "sent-0"
+	if len(session.responses) != 1 || session.responses[0].Data.Content != "Started the roleplay in <#"+threadID+">." {
+		t.Errorf("responded %v, want the thread linked", session.responses)
+	}
+
+	m := userMessage("Can I pass?")
+	m.ChannelID = threadID
+	b.HandleMessage(m)
+	chat := b.chatFor(threadID, "guild")
+	if chat == b.chatFor("channel", "guild") || len(chat.History()) != 2 {
+		t.Fatalf("thread chat has %d entries, want a chat of its own", len(chat.History()))
+	}
+	if prompt := partsText(chat.History()[0].Parts); !strings.Contains(prompt, "Roleplay as Gandalf") || !strings.Contains(prompt, "A wise old wizard") {
+		t.Errorf("prompt %q, want the character's persona", prompt)
+	}
+
+	// A moderator can delete anyone's character
+	session.responses = nil
+	b.HandleInteraction(characterInteraction("mod", discordgo.PermissionManageServer, "delete", stringOption("name", "GANDALF")))
+	if len(session.responses) != 1 || session.responses[0].Data.Content != "Deleted the character **Gandalf**." {
+		t.Errorf("responded %v, want the character deleted", session.responses)
+	}
+}
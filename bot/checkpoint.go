@@ -0,0 +1,172 @@
+package bot
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+)
+
+const (
+	// Checkpoints kept per conversation
+	maxCheckpoints = 25
+
+	// Checkpoint the history replaced by /checkpoint load is saved as, so
+	// loading can be undone
+	previousCheckpoint = "previous"
+)
+
+// checkpoint is a saved copy of a chat's history
+type checkpoint struct {
+	history []*genai.Content
+	saved   time.Time
+}
+
+// conversation returns the chat answering in a channel, the key its
+// checkpoints are saved under, and whether other channels share it. Profiles
+// and bot-started threads have their own chat; the shared chats get a key
+// per provider and guild, so servers don't see each other's checkpoints.
+func (b *Bot) conversation(channelID string, guildID string) (ai.Chat, string, bool) {
+	name, _ := b.provider(guildID)
+	profile := b.activeProfile(channelID)
+	chat := b.chatFor(channelID, guildID)
+	if profile != nil {
+		return chat, "profile:" + profileChatKey(name, channelID, profile.Name), false
+	}
+
+	b.chatsMu.Lock()
+	defer b.chatsMu.Unlock()
+
+	if _, ok := b.threadChats[channelID]; ok {
+		return chat, "thread:" + channelID, false
+	}
+	return chat, name + ":" + guildID, true
+}
+
+// checkpointCommand handles /checkpoint, saving a chat's history under a
+// name and later restoring it to explore a different direction
+func (b *Bot) checkpointCommand(i *discordgo.InteractionCreate) {
+	subcommand := i.ApplicationCommandData().Options[0]
+	chat, key, _ := b.conversation(i.ChannelID, i.GuildID)
+
+	switch subcommand.Name {
+	case "save":
+		name := strings.TrimSpace(commandOption(subcommand.Options, "name").StringValue())
+		history := chat.History()
+		if len(history) == 0 {
+			b.respondEphemeral(i, tr(i, "There's no conversation here to save yet."))
+			return
+		}
+		if !b.saveCheckpoint(key, name, history) {
+			b.respondEphemeral(i, tr(i, "This conversation already has %d checkpoints, load or overwrite one of them.", maxCheckpoints))
+			return
+		}
+		interactionLogger(i).Info("Saved checkpoint", "name", name, "entries", len(history))
+		b.respondEphemeral(i, tr(i, "Saved checkpoint **%s** (%d messages). Use `/checkpoint load name:%s` to come back to it.", name, len(history), name))
+	case "load":
+		name := strings.TrimSpace(commandOption(subcommand.Options, "name").StringValue())
+		saved, ok := b.loadCheckpoint(key, name)
+		if !ok {
+			b.respondEphemeral(i, tr(i, "There's no checkpoint named **%s** here, see `/checkpoint list`.", name))
+			return
+		}
+		content := tr(i, "Loaded checkpoint **%s** (%d messages).", name, len(saved.history))
+		unlock := b.lockSession(chat)
+		defer unlock()
+		// Keep the conversation being replaced, unless it is empty or is the
+		// checkpoint being loaded
+		if current := chat.History(); len(current) > 0 && name != previousCheckpoint {
+			b.saveCheckpoint(key, previousCheckpoint, current)
+			content += " " + tr(i, "The conversation it replaced was saved as **%s**.", previousCheckpoint)
+		}
+		chat.SetHistory(saved.history)
+		b.forgetLastTurn(chat)
+		b.saveSession(chat)
+		interactionLogger(i).Info("Loaded checkpoint", "name", name, "entries", len(saved.history))
+		b.respondEphemeral(i, content)
+	case "list":
+		checkpoints := b.checkpointList(key)
+		if len(checkpoints) == 0 {
+			b.respondEphemeral(i, tr(i, "There are no checkpoints here. Save one with `/checkpoint save`."))
+			return
+		}
+		var lines []string
+		for _, name := range checkpoints {
+			saved, _ := b.loadCheckpoint(key, name)
+			lines = append(lines, tr(i, "**%s**: %d messages, saved <t:%d:R>", name, len(saved.history), saved.saved.Unix()))
+		}
+		b.respondEphemeral(i, truncate(strings.Join(lines, "\n"), 2000))
+	}
+}
+
+// saveCheckpoint saves a copy of a history under a name, replacing any
+// checkpoint of that name. It returns false when the conversation already
+// has as many checkpoints as it can keep.
+func (b *Bot) saveCheckpoint(key string, name string, history []*genai.Content) bool {
+	b.checkpointsMu.Lock()
+	defer b.checkpointsMu.Unlock()
+
+	saved, ok := b.checkpoints[key]
+	if !ok {
+		saved = map[string]checkpoint{}
+		b.checkpoints[key] = saved
+	}
+	// The automatic checkpoint doesn't count towards the limit
+	count := len(saved)
+	if _, ok := saved[previousCheckpoint]; ok {
+		count--
+	}
+	if _, exists := saved[name]; !exists && name != previousCheckpoint && count >= maxCheckpoints {
+		return false
+	}
+	// History entries are never modified, only replaced, so copying the
+	// slice is enough
+	saved[name] = checkpoint{history: append([]*genai.Content(nil), history...), saved: time.Now()}
+	return true
+}
+
+// loadCheckpoint returns a conversation's checkpoint by name
+func (b *Bot) loadCheckpoint(key string, name string) (checkpoint, bool) {
+	b.checkpointsMu.Lock()
+	defer b.checkpointsMu.Unlock()
+
+	saved, ok := b.checkpoints[key][name]
+	return saved, ok
+}
+
+// checkpointList returns the names of a conversation's checkpoints
+func (b *Bot) checkpointList(key string) []string {
+	b.checkpointsMu.Lock()
+	defer b.checkpointsMu.Unlock()
+
+	var names []string
+	for name := range b.checkpoints[key] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// forgetCheckpoints deletes the checkpoints of a thread's conversation
+func (b *Bot) forgetCheckpoints(threadID string) {
+	b.checkpointsMu.Lock()
+	defer b.checkpointsMu.Unlock()
+
+	delete(b.checkpoints, "thread:"+threadID)
+}
+
+// forgetUserCheckpoints deletes the checkpoints of a user's threads
+func (b *Bot) forgetUserCheckpoints(userID string) {
+	b.chatsMu.Lock()
+	defer b.chatsMu.Unlock()
+
+	for key, threadID := range b.userThreads {
+		if strings.HasSuffix(key, ":"+userID) {
+			b.forgetCheckpoints(threadID)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+)
+
+// checkpointInteraction is a /checkpoint subcommand run by "alice" in "channel"
+func checkpointInteraction(subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	i := promptInteraction("alice", 0, subcommand, options...)
+	i.ChannelID = "channel"
+	data := i.Data.(discordgo.ApplicationCommandInteractionData)
+	data.Name = "checkpoint"
+	i.Data = data
+	return i
+}
+
+func TestCheckpointCommand(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "first answer"}, {Text: "second answer"}}}
+	b, session := newTestBot(t, client)
+	chat := b.chatFor("channel", "guild")
+
+	steps := []struct {
+		message     string
+		interaction *discordgo.InteractionCreate
+		want        string
+		entries     int
+	}{
+		{"", checkpointInteraction("save", stringOption("name", "start")), "There's no conversation here to save yet.", 0},
+		{"hi", checkpointInteraction("save", stringOption("name", "start")),
+			"Saved checkpoint **start** (2 messages). Use `/checkpoint load name:start` to come back to it.", 2},
+		{"what if", checkpointInteraction("load", stringOption("name", "start")),
+			"Loaded checkpoint **start** (2 messages). The conversation it replaced was saved as **previous**.", 2},
+		{"", checkpointInteraction("load", stringOption("name", "missing")), "There's no checkpoint named **missing** here, see `/checkpoint list`.", 2},
+		{"", checkpointInteraction("load", stringOption("name", "previous")),
+			"Loaded checkpoint **previous** (4 messages).", 4},
+	}
+	for _, step := range steps {
+		if step.message != "" {
+			b.HandleMessage(userMessage(step.message))
+		}
+		session.responses = nil
+		b.HandleInteraction(step.interaction)
+		if len(session.responses) != 1 || session.responses[0].Data.Content != step.want {
+			t.Errorf("responded %v, want %q", session.responses, step.want)
+		}
+		if got := len(chat.History()); got != step.entries {
+			t.Errorf("history has %d entries, want %d", got, step.entries)
+		}
+	}
+
+	session.responses = nil
+	b.HandleInteraction(checkpointInteraction("list"))
+	if len(session.responses) != 1 || !strings.Contains(session.responses[0].Data.Content, "**previous**: 4 messages") ||
+		!strings.Contains(session.responses[0].Data.Content, "**start**: 2 messages") {
+		t.Errorf("responded %v, want both checkpoints listed", session.responses)
+	}
+
+	// Other servers sharing the chat don't see the checkpoints
+	other := checkpointInteraction("list")
+	other.GuildID = "other"
+	session.responses = nil
+	b.HandleInteraction(other)
+	if len(session.responses) != 1 || !strings.HasPrefix(session.responses[0].Data.Content, "There are no checkpoints here.") {
+		t.Errorf("responded %v in another server, want no checkpoints", session.responses)
+	}
+}
+
+func TestCheckpointLimit(t *testing.T) {
+	b, _ := newTestBot(t, &fakeAI{})
+	history := []*genai.Content{genai.NewUserContent(genai.Text("hi"))}
+
+	for n := range maxCheckpoints {
+		if !b.saveCheckpoint("key", fmt.Sprint(n), history) {
+			t.Fatalf("saving checkpoint %d failed", n)
+		}
+	}
+	if !b.saveCheckpoint("key", previousCheckpoint, history) {
+		t.Error("saving the automatic checkpoint failed at the limit")
+	}
+	if !b.saveCheckpoint("key", "0", history) {
+		t.Error("overwriting a checkpoint failed at the limit")
+	}
+	if b.saveCheckpoint("key", "one too many", history) {
+		t.Error("saved a checkpoint over the limit")
+	}
+}
@@ -0,0 +1,163 @@
+package bot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Custom ID of the "Explain" button attached to /code results
+const codeExplainButtonID = "code-explain"
+
+// codeLanguage is a language /code can write, with its code block tag and
+// file extension
+type codeLanguage struct {
+	name      string
+	tag       string
+	extension string
+}
+
+// Languages offered by /code, at most 25 as Discord limits choices
+var codeLanguages = []codeLanguage{
+	{"Go", "go", "go"},
+	{"Python", "python", "py"},
+	{"JavaScript", "javascript", "js"},
+	{"TypeScript", "typescript", "ts"},
+	{"Java", "java", "java"},
+	{"Kotlin", "kotlin", "kt"},
+	{"C", "c", "c"},
+	{"C++", "cpp", "cpp"},
+	{"C#", "cs", "cs"},
+	{"Rust", "rust", "rs"},
+	{"Ruby", "ruby", "rb"},
+	{"PHP", "php", "php"},
+	{"Swift", "swift", "swift"},
+	{"Dart", "dart", "dart"},
+	{"Haskell", "haskell", "hs"},
+	{"Lua", "lua", "lua"},
+	{"R", "r", "r"},
+	{"SQL", "sql", "sql"},
+	{"Bash", "bash", "sh"},
+	{"PowerShell", "powershell", "ps1"},
+	{"HTML", "html", "html"},
+	{"CSS", "css", "css"},
+	{"YAML", "yaml", "yaml"},
+}
+
+// First fenced code block of a reply
+var fencedCode = regexp.MustCompile("(?s)```[^\\n`]*\\n(.*?)\\n?```")
+
+// codeLanguageChoices returns the /code language choices
+func codeLanguageChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(codeLanguages))
+	for _, language := range codeLanguages {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: language.name, Value: language.tag})
+	}
+	return choices
+}
+
+// codeCommand handles /code, answering with only code in a code block, or a
+// file when it doesn't fit in a message
+func (b *Bot) codeCommand(i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	prompt := commandOption(options, "prompt").StringValue()
+	language := codeLanguage{name: "the most suitable language", extension: "txt"}
+	if option := commandOption(options, "language"); option != nil {
+		for _, known := range codeLanguages {
+			if known.tag == option.StringValue() {
+				language = known
+			}
+		}
+	}
+
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to code command", "error", err)
+		return
+	}
+
+	instructions := fmt.Sprintf("Write %s code for the following request. Reply with only the code, "+
+		"without explanations or Markdown code fences; put any necessary notes in code comments.\n\n%s", language.name, prompt)
+	text, err := b.generate(interactionUserID(i), i.GuildID, genai.Text(instructions))
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	code := extractCode(text)
+	if code == "" {
+		b.editInteractionResponse(i, tr(i, "I couldn't generate any code."))
+		return
+	}
+
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					CustomID: codeExplainButtonID,
+					Label:    "Explain",
+					Style:    discordgo.SecondaryButton,
+					Emoji:    &discordgo.ComponentEmoji{Name: "💡"},
+				},
+			},
+		},
+	}
+	content := "```" + language.tag + "\n" + code + "\n```"
+	edit := &discordgo.WebhookEdit{Content: &content, Components: &components}
+	if len([]rune(content)) > 2000 {
+		name := "code." + language.extension
+		note := fmt.Sprintf("📎 The code is attached as `%s`.", name)
+		edit.Content = &note
+		edit.Files = []*discordgo.File{{Name: name, ContentType: "text/plain", Reader: strings.NewReader(code + "\n")}}
+	}
+	if _, err := b.session.InteractionResponseEdit(i.Interaction, edit); err != nil {
+		interactionLogger(i).Error("Error editing interaction response", "error", err)
+	}
+}
+
+// extractCode returns the code of a reply, dropping the code fences models
+// add despite being asked not to
+func extractCode(text string) string {
+	if match := fencedCode.FindStringSubmatch(text); match != nil {
+		return strings.TrimSpace(match[1])
+	}
+	return strings.TrimSpace(text)
+}
+
+// explainCodeButton handles the "Explain" button of a /code result,
+// explaining the code privately to whoever pressed it
+func (b *Bot) explainCodeButton(i *discordgo.InteractionCreate) {
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to explain button", "error", err)
+		return
+	}
+
+	// Long code is attached as a file rather than in the message
+	code := extractCode(i.Message.Content)
+	if len(i.Message.Attachments) > 0 {
+		data, err := downloadAttachment(i.Message.Attachments[0])
+		if err != nil {
+			interactionLogger(i).Error("Error downloading code", "error", err)
+			b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+		code = string(data)
+	}
+
+	prompt := "Explain what the following code does, step by step and concisely.\n\n```\n" + code + "\n```"
+	explanation, err := b.generate(interactionUserID(i), i.GuildID, genai.Text(prompt))
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if explanation == "" {
+		explanation = "I couldn't generate an explanation."
+	}
+	b.editInteractionResponseLong(i, explanation, discordgo.MessageFlagsEphemeral)
+}
@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestExtractCode(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"fmt.Println(1)", "fmt.Println(1)"},
+		{"```go\nfmt.Println(1)\n```", "fmt.Println(1)"},
+		{"Here you go:\n```\nprint(1)\n```\nEnjoy!", "print(1)"},
+		{"\n  x = 1\n", "x = 1"},
+	}
+	for _, test := range tests {
+		if got := extractCode(test.text); got != test.want {
+			t.Errorf("extractCode(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestCodeCommand(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{text: "```go\nfmt.Println(1)\n```"})
+
+	i := commandInteraction("code")
+	i.Data = discordgo.ApplicationCommandInteractionData{Name: "code", Options: []*discordgo.ApplicationCommandInteractionDataOption{
+		stringOption("prompt", "print one"), stringOption("language", "go"),
+	}}
+	b.HandleInteraction(i)
+
+	if len(session.edits) != 1 {
+		t.Fatalf("edits = %v, want one", session.edits)
+	}
+	edit := session.edits[0]
+	if want := "```go\nfmt.Println(1)\n```"; *edit.Content != want {
+		t.Errorf("content = %q, want %q", *edit.Content, want)
+	}
+	button := (*edit.Components)[0].(discordgo.ActionsRow).Components[0].(discordgo.Button)
+	if button.CustomID != codeExplainButtonID {
+		t.Errorf("button = %+v, want the Explain button", button)
+	}
+}
+
+func TestCodeCommandAttachesLongCode(t *testing.T) {
+	code := strings.Repeat("print(1)\n", 300)
+	b, session := newTestBot(t, &fakeAI{text: code})
+
+	i := commandInteraction("code")
+	i.Data = discordgo.ApplicationCommandInteractionData{Name: "code", Options: []*discordgo.ApplicationCommandInteractionDataOption{
+		stringOption("prompt", "print one a lot"), stringOption("language", "python"),
+	}}
+	b.HandleInteraction(i)
+
+	edit := session.edits[0]
+	if want := "📎 The code is attached as `code.py`."; *edit.Content != want || len(edit.Files) != 1 {
+		t.Fatalf("content = %q with %d files, want %q with the code", *edit.Content, len(edit.Files), want)
+	}
+	if data, _ := io.ReadAll(edit.Files[0].Reader); string(data) != strings.TrimSpace(code)+"\n" {
+		t.Errorf("attached %d bytes, want the code", len(data))
+	}
+}
+
+func TestExplainCodeButton(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{text: "It prints one."})
+
+	b.HandleInteraction(&discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:    discordgo.InteractionMessageComponent,
+		GuildID: "guild",
+		Member:  &discordgo.Member{User: &discordgo.User{ID: "user"}},
+		Message: &discordgo.Message{Content: "```go\nfmt.Println(1)\n```"},
+		Data:    discordgo.MessageComponentInteractionData{CustomID: codeExplainButtonID},
+	}})
+
+	if session.responses[0].Data.Flags != discordgo.MessageFlagsEphemeral {
+		t.Errorf("response flags = %v, want ephemeral", session.responses[0].Data.Flags)
+	}
+	if len(session.edits) != 1 || *session.edits[0].Content != "It prints one." {
+		t.Errorf("edits = %v, want the explanation", session.edits)
+	}
+}
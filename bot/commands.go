@@ -0,0 +1,1232 @@
+package bot
+
+import "github.com/bwmarrin/discordgo"
+
+// Commands are the slash and context-menu commands to register on startup
+var Commands = []*discordgo.ApplicationCommand{
+	{
+		Name:        "help",
+		Description: "Browse what the bot can do, its commands and this server's settings",
+	},
+	{
+		Name:        "ask",
+		Description: "Ask Gemini AI a one-off question",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "question",
+				Description: "Your question",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "length",
+				Description: "How long the answer should be, the server's setting by default",
+				Choices:     verbosityChoices(),
+			},
+		},
+	},
+	{
+		Name:        "clear",
+		Description: "Clear the chat history with Gemini AI",
+	},
+	{
+		Name:        "stop",
+		Description: "Stop the answers you're waiting for in this channel",
+	},
+	{
+		Name:        "translate",
+		Description: "Translate text with Gemini AI",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "text",
+				Description: "Text to translate",
+				Required:    true,
+			},
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "to",
+				Description:  "Language to translate into",
+				Required:     true,
+				Autocomplete: true,
+			},
+		},
+	},
+	{
+		Name:        "json",
+		Description: "Answer a prompt with JSON from Gemini AI",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "prompt",
+				Description: "What to answer",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "schema",
+				Description: `JSON Schema the answer must match, like {"type":"object","properties":{...}}`,
+			},
+		},
+	},
+	{
+		Name:        "code",
+		Description: "Write code with Gemini AI",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "prompt",
+				Description: "What the code should do",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "language",
+				Description: "Language to write it in",
+				Choices:     codeLanguageChoices(),
+			},
+		},
+	},
+	{
+		Name:        "math",
+		Description: "Answer a math question with a computed result, not the AI's own arithmetic",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "question",
+				Description: "The problem to solve, like \"compound interest on 1200 at 4 percent over 7 years\"",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "prompt",
+		Description: "Reusable prompt templates of this server",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "save",
+				Description: "Save a template, using {input}, {user} and {date} as placeholders",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "name",
+						Description: "Name to run it by",
+						Required:    true,
+						MaxLength:   32,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "template",
+						Description: "The prompt, such as \"Summarize: {input}\"",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "run",
+				Description: "Run a template",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "name",
+						Description:  "Template to run",
+						Required:     true,
+						Autocomplete: true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "input",
+						Description: "Text filling in {input}",
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List the server's templates",
+			},
+		},
+	},
+	{
+		Name:        "remindme",
+		Description: "Have the bot remind you of something later",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "in",
+				Description: "When, like \"2 hours\", \"tomorrow at 9am\" or \"next Friday 17:00 UTC\"",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "about",
+				Description: "What to remind you of",
+				Required:    true,
+				MaxLength:   1500,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "dm",
+				Description: "Send the reminder in a DM instead of pinging you here",
+			},
+		},
+	},
+	{
+		Name:        "event",
+		Description: "Server events drafted by Gemini AI (Manage Events)",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "draft",
+				Description: "Write an event's title and description from a prompt and create it",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "prompt",
+						Description: "What the event is and when, like \"movie night Friday 20:00 UTC, we watch Alien\"",
+						Required:    true,
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         "channel",
+						Description:  "Voice or stage channel hosting the event, or leave out for elsewhere",
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildVoice, discordgo.ChannelTypeGuildStageVoice},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "remind",
+						Description: "Minutes before the start to post a reminder here, 30 by default, 0 for none",
+						MinValue:    &minEventReminderMinutes,
+						MaxValue:    maxEventReminderMinutes,
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        "schedule",
+		Description: "Recurring channel digests posted by the bot (Manage Server)",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "add",
+				Description: "Summarize a channel into another one on a schedule",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         "source",
+						Description:  "Channel to summarize",
+						Required:     true,
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         "target",
+						Description:  "Channel to post the digest to",
+						Required:     true,
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "cron",
+						Description: "When to run in UTC, like \"0 9 * * *\" for 9:00 every day, or @daily and @weekly",
+						Required:    true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "hours",
+						Description: "How many hours of messages to summarize, 24 by default",
+						MinValue:    &minDigestHours,
+						MaxValue:    maxDigestHours,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "instructions",
+						Description: "Extra instructions for the summary",
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List the server's scheduled jobs",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "remove",
+				Description: "Remove a scheduled job",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "id",
+						Description: "Job number, from /schedule list",
+						Required:    true,
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        "imagine",
+		Description: "Generate images with Gemini AI",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "prompt",
+				Description: "Description of the image to generate",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "count",
+				Description: "Number of images to generate (1-4)",
+				MinValue:    &minImageCount,
+				MaxValue:    maxImageCount,
+			},
+		},
+	},
+	{
+		Name:        "speak",
+		Description: "Read text aloud with Gemini AI",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "text",
+				Description: "Text to read aloud",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "voice",
+		Description: "Talk with Gemini AI in a voice channel",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "join",
+				Description: "Join your voice channel and answer what is said there",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "leave",
+				Description: "Leave the voice channel",
+			},
+		},
+	},
+	{
+		Name:        "kb",
+		Description: "Server knowledge base answered by Gemini AI",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "ask",
+				Description: "Ask a question answered from the knowledge base",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "question",
+						Description: "Your question",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "add",
+				Description: "Add a document or web page to the knowledge base (Manage Server)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionAttachment,
+						Name:        "file",
+						Description: "Document to add",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "url",
+						Description: "Web page or document URL to add",
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "remove",
+				Description: "Remove a document from the knowledge base (Manage Server)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "source",
+						Description: "File name or URL of the document",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List the knowledge base's documents (Manage Server)",
+			},
+		},
+	},
+	{
+		Name:        "memory",
+		Description: "See and manage what Gemini AI remembers about you",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List what I remember about you",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "forget",
+				Description: "Forget one thing I remember about you",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "id",
+						Description: "ID shown by /memory list",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "wipe",
+				Description: "Forget everything I remember about you",
+			},
+		},
+	},
+	{
+		Name:        "recall",
+		Description: "Search past messages of indexed channels",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "query",
+				Description: "What to look for",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "answer",
+				Description: "Have Gemini AI answer from the messages found",
+			},
+		},
+	},
+	{
+		Name:        "index",
+		Description: "Make this channel's messages searchable with /recall",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "enable",
+				Description: "Index this channel, including its recent history (Manage Channels)",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "disable",
+				Description: "Stop indexing this channel and delete its index (Manage Channels)",
+			},
+		},
+	},
+	{
+		Name:        "moderation",
+		Description: "Have the bot flag toxic messages of this channel to moderators",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "enable",
+				Description: "Score this channel's messages and report harmful ones (Manage Channels)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         "log",
+						Description:  "Mod-log channel to report flagged messages to",
+						Required:     true,
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "threshold",
+						Description: "Score out of 100 at which messages are flagged, 70 by default",
+						MinValue:    &minModerationThreshold,
+						MaxValue:    maxModerationThreshold,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        "delete",
+						Description: "Also delete flagged messages (Manage Server)",
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "disable",
+				Description: "Stop moderating this channel (Manage Channels)",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "status",
+				Description: "Show this channel's moderation settings",
+			},
+		},
+	},
+	{
+		Name:        "welcome",
+		Description: "Greet new members with a personalized message (Manage Server)",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "setup",
+				Description: "Describe the server and choose where welcomes go, turning them on",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "about",
+						Description: "What the server is about and its rules, for the bot to draw on",
+						Required:    true,
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         "channel",
+						Description:  "Channel to post welcomes in, DMs when left out",
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "template",
+						Description: "How to write them, like \"One upbeat sentence, then point to #rules\"",
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "enable",
+				Description: "Turn welcome messages back on",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "disable",
+				Description: "Turn welcome messages off, keeping their settings",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "preview",
+				Description: "Show the welcome you would get",
+			},
+		},
+	},
+	{
+		Name:        "reactions",
+		Description: "Emoji reactions that run AI actions on messages",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "set",
+				Description: "Make reacting with an emoji run an action (Manage Server)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "emoji",
+						Description: "The emoji",
+						Required:    true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "action",
+						Description: "What reacting with it does",
+						Required:    true,
+						Choices:     reactionActionChoices(),
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "remove",
+				Description: "Stop an emoji from running an action (Manage Server)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "emoji",
+						Description: "The emoji",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "defaults",
+				Description: "Use 📌 to summarize, 🌐 to translate and ❓ to explain (Manage Server)",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List the reactions that run actions",
+			},
+		},
+	},
+	{
+		Name:        "settings",
+		Description: "Show and change how the bot behaves in this server (Manage Server)",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "length",
+				Description: "How long answers are in this server",
+				Choices:     verbosityChoices(),
+			},
+		},
+	},
+	{
+		Name:        "script",
+		Description: "Shape prompts and answers with a Starlark script (Manage Server)",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "set",
+				Description: "Upload the script, replacing the current one",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionAttachment,
+						Name:        "file",
+						Description: ".star file defining before_prompt(parts) or after_response(text)",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "show",
+				Description: "Download the current script",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "test",
+				Description: "Show what the script makes of a prompt and an answer",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "text",
+						Description: "Text to run through both functions",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "remove",
+				Description: "Remove the script",
+			},
+		},
+	},
+	{
+		Name:        "chat",
+		Description: "Keep several conversations in this channel, each with its own history and persona",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "switch",
+				Description: "Switch to a conversation, starting it if it's new (\"default\" is the usual one)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "name",
+						Description: "Name of the conversation, such as \"coding\"",
+						Required:    true,
+						MaxLength:   32,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "persona",
+						Description: "How the bot should act in it, such as \"a dungeon master running our campaign\"",
+						MaxLength:   1000,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List this channel's conversations",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "delete",
+				Description: "Delete a conversation",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "name",
+						Description: "Name of the conversation",
+						Required:    true,
+						MaxLength:   32,
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        "checkpoint",
+		Description: "Save the conversation and come back to it later",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "save",
+				Description: "Save the conversation so far under a name",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "name",
+						Description: "Name to load it by",
+						Required:    true,
+						MaxLength:   32,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "load",
+				Description: "Go back to a saved conversation, saving the current one as \"previous\"",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "name",
+						Description: "Name it was saved under",
+						Required:    true,
+						MaxLength:   32,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List the saved checkpoints of this conversation",
+			},
+		},
+	},
+	{
+		Name:        "export",
+		Description: "Export this channel's conversation with the bot as a file",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "format",
+				Description: "File format, Markdown by default",
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "Markdown", Value: "md"},
+					{Name: "JSON", Value: "json"},
+				},
+			},
+		},
+	},
+	{
+		Name:        "poll",
+		Description: "Have Gemini AI write a poll about a topic and post it",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "topic",
+				Description: "What the poll is about",
+				Required:    true,
+				MaxLength:   500,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "edit",
+				Description: "Show you the poll to edit before it's posted",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "hours",
+				Description: "How long the poll stays open, a day by default",
+				MinValue:    &minPollHours,
+				MaxValue:    maxPollHours,
+			},
+		},
+	},
+	{
+		Name:        "announce",
+		Description: "Have Gemini AI draft an announcement to approve before it's posted",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "topic",
+				Description: "What the announcement is about",
+				Required:    true,
+				MaxLength:   1000,
+			},
+			{
+				Type:         discordgo.ApplicationCommandOptionChannel,
+				Name:         "channel",
+				Description:  "Channel to post the announcement in",
+				Required:     true,
+				ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+			},
+		},
+	},
+	{
+		Name:        "quiz",
+		Description: "Play a trivia quiz written by Gemini AI",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "start",
+				Description: "Start a quiz in this channel",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "topic",
+						Description: "What the questions are about",
+						Required:    true,
+						MaxLength:   200,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "questions",
+						Description: "Number of questions, 5 by default",
+						MinValue:    &minQuizQuestions,
+						MaxValue:    maxQuizQuestions,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "stop",
+				Description: "End this channel's quiz and show the scores",
+			},
+		},
+	},
+	{
+		Name:        "character",
+		Description: "Roleplay with the server's characters",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "create",
+				Description: "Create or change a character",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "chat",
+				Description: "Start a thread where the bot plays a character",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "name",
+						Description:  "Character to roleplay with",
+						Required:     true,
+						Autocomplete: true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List the server's characters",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "delete",
+				Description: "Delete a character you created (or any, with Manage Server)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "name",
+						Description:  "Character to delete",
+						Required:     true,
+						Autocomplete: true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "export",
+				Description: "Download a character's card for review",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "name",
+						Description:  "Character to export",
+						Required:     true,
+						Autocomplete: true,
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        "dm",
+		Description: "Have the bot run a tabletop campaign in this channel as dungeon master",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "start",
+				Description: "Start a campaign in this channel",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "setting",
+						Description: "World and premise of the campaign",
+						Required:    true,
+						MaxLength:   1000,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "join",
+				Description: "Join the party, or change your character",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "character",
+						Description: "Your character, e.g. \"Mira, elven ranger\"",
+						Required:    true,
+						MaxLength:   200,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "state",
+				Description: "Show the party, inventory and current scene",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "recap",
+				Description: "Recap the story so far",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "end",
+				Description: "End this channel's campaign",
+			},
+		},
+	},
+	{
+		Name:        "review",
+		Description: "Review a diff for bugs, style and security issues",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionAttachment,
+				Name:        "file",
+				Description: ".diff or .patch file to review, or leave out to paste a diff",
+			},
+		},
+	},
+	{
+		Name:        "ocr",
+		Description: "Extract the text of an image verbatim",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionAttachment,
+				Name:        "image",
+				Description: "Image to read the text of",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "extract",
+		Description: "Extract the full text of a PDF or document as a file, not a summary",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionAttachment,
+				Name:        "file",
+				Description: "PDF or document to extract the text of",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "format",
+				Description: "File format, Markdown by default",
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "Markdown", Value: "md"},
+					{Name: "Plain text", Value: "txt"},
+				},
+			},
+		},
+	},
+	{
+		Name:        "tldr",
+		Description: "Summarize this forum post or thread",
+	},
+	{
+		Name:        "minutes",
+		Description: "Write the minutes of a recorded call and post them to a notes channel",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionAttachment,
+				Name:        "recording",
+				Description: "Audio or video recording of the call",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "url",
+				Description: "Link to the recording, instead of uploading it",
+			},
+			{
+				Type:         discordgo.ApplicationCommandOptionChannel,
+				Name:         "channel",
+				Description:  "Notes channel to post the minutes to, this one by default",
+				ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+			},
+		},
+	},
+	{
+		Name:        "highlights",
+		Description: "Recap the most reacted messages of a channel over a period, with links to them",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "since",
+				Description: "How far back to look, like \"12h\", \"3d\" or \"1w\", up to a month",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "min_reactions",
+				Description: "Reactions a message needs to be a highlight, 3 by default",
+				MinValue:    &minHighlightReactions,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "emoji",
+				Description: "Only count reactions with this emoji, like ⭐",
+			},
+			{
+				Type:         discordgo.ApplicationCommandOptionChannel,
+				Name:         "channel",
+				Description:  "Channel to recap, this one by default",
+				ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+			},
+		},
+	},
+	{
+		Name:        "topic",
+		Description: "Have Gemini AI sum up this channel as its topic, or this thread as its name",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "suggest",
+				Description: "Apply a topic or name written from the recent messages, with a button to undo it",
+			},
+		},
+	},
+	{
+		Name:        "stats",
+		Description: "Show the bot's uptime, servers, load and usage today",
+	},
+	{
+		Name:        "usage",
+		Description: "Show your and this server's Gemini AI usage",
+	},
+	{
+		Name:        "tokens",
+		Description: "Count the tokens of a text and estimate its cost as a prompt",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "text",
+				Description: "Text to count",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "compare",
+		Description: "Ask several models the same prompt and compare their answers (Manage Server)",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "prompt",
+				Description: "Prompt sent to every model",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "models",
+				Description: "Models separated by commas, such as gemini-1.5-pro, gemini-1.5-flash",
+				Required:    true,
+				MaxLength:   300,
+			},
+		},
+	},
+	{
+		Name:        "abtest",
+		Description: "Test two personas against each other with members' votes (Manage Server)",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "start",
+				Description: "Alternate between two personas for a while, replacing the last test",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "persona_a",
+						Description: "How the bot acts as persona A",
+						Required:    true,
+						MaxLength:   1000,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "persona_b",
+						Description: "How the bot acts as persona B",
+						Required:    true,
+						MaxLength:   1000,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "days",
+						Description: "Days the test runs, 7 by default",
+						MinValue:    &minPersonaTestDays,
+						MaxValue:    maxPersonaTestDays,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "stop",
+				Description: "End the running test and show its results",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "report",
+				Description: "Show the votes of the latest test and which persona members preferred",
+			},
+		},
+	},
+	{
+		Name:        "feedback",
+		Description: "Show how members rate the bot's answers (Manage Server)",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "report",
+				Description: "Show the share of 👍 week by week",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "export",
+				Description: "Download the latest votes with their prompts and answers as JSON Lines",
+			},
+		},
+	},
+	{
+		Name:        "provider",
+		Description: "Show or choose the AI provider answering in this server",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "name",
+				Description: "Provider to switch to (Manage Server)",
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "Gemini", Value: ProviderGemini},
+					{Name: "OpenAI-compatible", Value: ProviderOpenAI},
+				},
+			},
+		},
+	},
+	{
+		Name:        "mydata",
+		Description: "Get everything the bot stores about you in a DM",
+	},
+	{
+		Name:        "forgetme",
+		Description: "Delete everything the bot stores about you",
+	},
+	{
+		Name:        "admin",
+		Description: "Bot owner tools",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "reload",
+				Description: "Reload the configuration",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "stats",
+				Description: "Show runtime statistics",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "model",
+				Description: "Switch the default provider's chat model everywhere",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "name",
+						Description: "Model name, such as gemini-1.5-flash-latest",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "leave",
+				Description: "Make the bot leave a server",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "server",
+						Description: "ID of the server to leave",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "broadcast",
+				Description: "Post a maintenance notice in every server",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "message",
+						Description: "Notice to post",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "maintenance",
+				Description: "Stop or resume answering with AI everywhere",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "mode",
+						Description: "Whether maintenance mode is on",
+						Required:    true,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "on", Value: "on"},
+							{Name: "off", Value: "off"},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name: askCommandName,
+		Type: discordgo.MessageApplicationCommand,
+	},
+	{
+		Name: translateCommandName,
+		Type: discordgo.MessageApplicationCommand,
+	},
+	{
+		Name: explainCommandName,
+		Type: discordgo.MessageApplicationCommand,
+	},
+	{
+		Name: explainFileCommandName,
+		Type: discordgo.MessageApplicationCommand,
+	},
+	{
+		Name: ocrCommandName,
+		Type: discordgo.MessageApplicationCommand,
+	},
+}
@@ -0,0 +1,136 @@
+package bot
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+)
+
+const (
+	// Most models /compare asks at once
+	maxCompareModels = 4
+
+	// Characters all the embeds of a message may hold together
+	embedsTotalLimit = 6000
+
+	// Color of the embed of a model that failed to answer
+	errorColor = 0xed4245
+)
+
+// comparison is the answer of one model to /compare
+type comparison struct {
+	model   string
+	reply   *ai.Reply
+	latency time.Duration
+	err     error
+}
+
+// parseModels reads the comma-separated models of /compare, without
+// duplicates
+func parseModels(text string) []string {
+	var models []string
+	for _, model := range strings.Split(text, ",") {
+		model = strings.TrimSpace(model)
+		if model != "" && !slices.Contains(models, model) {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// compareCommand handles /compare, asking several models the same prompt
+// at once and showing their answers side by side with their latency and
+// tokens, to help choose the server's model
+func (b *Bot) compareCommand(i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	prompt := commandOption(options, "prompt").StringValue()
+	models := parseModels(commandOption(options, "models").StringValue())
+
+	if i.Member != nil && i.Member.Permissions&discordgo.PermissionManageServer == 0 {
+		b.respondEphemeral(i, tr(i, "You need the Manage Server permission to compare models."))
+		return
+	}
+	if len(models) < 2 || len(models) > maxCompareModels {
+		b.respondEphemeral(i, tr(i, "Give between 2 and %d models separated by commas, like `gemini-1.5-pro, gemini-1.5-flash`.", maxCompareModels))
+		return
+	}
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to compare command", "error", err)
+		return
+	}
+
+	results := make([]comparison, len(models))
+	var wg sync.WaitGroup
+	for n, model := range models {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[n] = b.compareModel(i, model, prompt)
+		}()
+	}
+	wg.Wait()
+
+	// The embeds share the room of a message
+	size := min(embedDescriptionLimit, (embedsTotalLimit-500)/len(results))
+	var embeds []*discordgo.MessageEmbed
+	for _, result := range results {
+		embed := &discordgo.MessageEmbed{Title: truncate(result.model, 256), Color: embedColor}
+		if result.err != nil {
+			embed.Color = errorColor
+			embed.Description = tr(i, "Sorry, an error occurred: %v", result.err)
+		} else {
+			embed.Description = truncate(result.reply.Text, size)
+			if embed.Description == "" {
+				embed.Description = tr(i, "I couldn't generate a response.")
+			}
+			embed.Footer = &discordgo.MessageEmbedFooter{Text: responseFooter(result.reply, result.latency)}
+		}
+		embeds = append(embeds, embed)
+	}
+
+	content := "> " + truncate(strings.ReplaceAll(prompt, "\n", " "), 300)
+	_, err := b.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content, Embeds: &embeds})
+	if err != nil {
+		interactionLogger(i).Error("Error sending comparison", "error", err)
+		return
+	}
+	interactionLogger(i).Info("Compared models", "models", strings.Join(models, ","))
+}
+
+// compareModel asks one model a /compare prompt, recording the exchange in
+// the usage and audit logs
+func (b *Bot) compareModel(i *discordgo.InteractionCreate, model string, prompt string) comparison {
+	userID := interactionUserID(i)
+	parts, err := b.beforePrompt(userID, i.GuildID, b.scrubParts(i.GuildID, []genai.Part{genai.Text(prompt)}))
+	if err != nil {
+		return comparison{model: model, err: err}
+	}
+	ctx := ai.WithRequestOptions(b.ctx, ai.RequestOptions{
+		Model:  model,
+		Safety: b.safetyLevel(b.guildSettings(i.GuildID), i.ChannelID),
+	})
+
+	start := time.Now()
+	reply, err := b.aiFor(i.GuildID).Generate(ctx, parts...)
+	latency := time.Since(start)
+	b.auditExchange(userID, i.GuildID, parts, reply, err)
+	if err != nil {
+		interactionLogger(i).Warn("Error comparing model", "model", model, "error", err)
+		return comparison{model: model, err: err}
+	}
+	b.recordUsage(userID, i.GuildID, reply)
+	reply.Text = b.afterResponse(userID, i.GuildID, reply.Text)
+	interactionLogger(i).Info("Compared model",
+		"model", model,
+		"latency", latency,
+		"prompt_tokens", reply.PromptTokens,
+		"response_tokens", reply.ResponseTokens,
+	)
+	return comparison{model: model, reply: reply, latency: latency}
+}
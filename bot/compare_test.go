@@ -0,0 +1,64 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// compareInteraction runs /compare with a prompt and models
+func compareInteraction(permissions int64, models string) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:    discordgo.InteractionApplicationCommand,
+		GuildID: "guild",
+		Member:  &discordgo.Member{User: &discordgo.User{ID: "alice", Username: "alice"}, Permissions: permissions},
+		Data: discordgo.ApplicationCommandInteractionData{
+			Name:    "compare",
+			Options: []*discordgo.ApplicationCommandInteractionDataOption{stringOption("prompt", "Name a color"), stringOption("models", models)},
+		},
+	}}
+}
+
+func TestParseModels(t *testing.T) {
+	got := parseModels(" gemini-pro, gemini-flash,,gemini-pro ")
+	if want := []string{"gemini-pro", "gemini-flash"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseModels = %q, want %q", got, want)
+	}
+}
+
+func TestCompareCommand(t *testing.T) {
+	fake := &fakeAI{text: "Blue"}
+	b, session := newTestBot(t, fake)
+
+	b.compareCommand(compareInteraction(0, "gemini-pro, gemini-flash"))
+	b.compareCommand(compareInteraction(discordgo.PermissionManageServer, "gemini-pro"))
+	for n, want := range []string{
+		"You need the Manage Server permission to compare models.",
+		"Give between 2 and 4 models separated by commas, like `gemini-1.5-pro, gemini-1.5-flash`.",
+	} {
+		if got := session.responses[n].Data.Content; got != want {
+			t.Errorf("response %d = %q, want %q", n, got, want)
+		}
+	}
+	if len(fake.prompts) != 0 {
+		t.Fatalf("sent %d prompts for refused comparisons", len(fake.prompts))
+	}
+
+	b.compareCommand(compareInteraction(discordgo.PermissionManageServer, "gemini-pro, gemini-flash"))
+	if len(fake.prompts) != 2 {
+		t.Fatalf("sent %d prompts, want one per model", len(fake.prompts))
+	}
+	if len(session.edits) != 1 || session.edits[0].Embeds == nil {
+		t.Fatalf("edits = %v, want the comparison", session.edits)
+	}
+	embeds := *session.edits[0].Embeds
+	if len(embeds) != 2 || embeds[0].Title != "gemini-pro" || embeds[1].Title != "gemini-flash" {
+		t.Fatalf("embeds = %+v, want one per model in order", embeds)
+	}
+	for _, embed := range embeds {
+		if embed.Description != "Blue" || embed.Footer == nil {
+			t.Errorf("embed %q = %q with footer %v, want the answer and its stats", embed.Title, embed.Description, embed.Footer)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package bot
+
+import (
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// Messages shorter than this, in characters and without attachments,
+	// wait for more with MESSAGE_DEBOUNCE, as they're likely the start of a
+	// thought typed over several messages
+	shortMessageLength = 100
+
+	// Most messages merged into one prompt, answered as soon as they're in
+	maxBurstMessages = 10
+)
+
+// burst is a member's rapid-fire messages in a channel, answered together
+// once they stop coming
+type burst struct {
+	messages []*discordgo.Message
+
+	// Receives whenever a message is added
+	arrived chan struct{}
+}
+
+// burstKey identifies the burst of a message's author in its channel
+func burstKey(m *discordgo.Message) string {
+	return m.ChannelID + ":" + m.Author.ID
+}
+
+// joinBurst adds a message to its author's burst in its channel, reporting
+// whether there was one to add it to, in which case it's answered along
+// with the others
+func (b *Bot) joinBurst(m *discordgo.MessageCreate) bool {
+	b.burstsMu.Lock()
+	defer b.burstsMu.Unlock()
+
+	pending, ok := b.bursts[burstKey(m.Message)]
+	if !ok || len(pending.messages) >= maxBurstMessages {
+		return false
+	}
+	pending.messages = append(pending.messages, m.Message)
+	select {
+	case pending.arrived <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// debounce holds a short message until its author sent nothing more in the
+// channel for MESSAGE_DEBOUNCE, and returns the messages they sent merged
+// into one. Other messages, and every message when MESSAGE_DEBOUNCE is 0,
+// are returned as they are.
+func (b *Bot) debounce(m *discordgo.MessageCreate) *discordgo.MessageCreate {
+	window := b.config().MessageDebounce
+	if window == 0 || len(m.Attachments) > 0 || len([]rune(m.Content)) >= shortMessageLength {
+		return m
+	}
+
+	key := burstKey(m.Message)
+	pending := &burst{messages: []*discordgo.Message{m.Message}, arrived: make(chan struct{}, 1)}
+	b.burstsMu.Lock()
+	if _, ok := b.bursts[key]; ok {
+		// Another message of the author's started one in the meantime,
+		// too late for this one to join
+		b.burstsMu.Unlock()
+		return m
+	}
+	b.bursts[key] = pending
+	b.burstsMu.Unlock()
+
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+wait:
+	for {
+		select {
+		case <-timer.C:
+			break wait
+		case <-b.ctx.Done():
+			break wait
+		case <-pending.arrived:
+			b.burstsMu.Lock()
+			full := len(pending.messages) >= maxBurstMessages
+			b.burstsMu.Unlock()
+			if full {
+				break wait
+			}
+			timer.Reset(window)
+		}
+	}
+
+	b.burstsMu.Lock()
+	delete(b.bursts, key)
+	messages := pending.messages
+	b.burstsMu.Unlock()
+	if len(messages) > 1 {
+		messageLogger(m).Info("Merged rapid-fire messages", "messages", len(messages))
+	}
+	return &discordgo.MessageCreate{Message: mergeMessages(messages)}
+}
+
+// mergeMessages returns messages as a single one, their texts a line each
+// and with all their attachments, that is answered as the last one
+func mergeMessages(messages []*discordgo.Message) *discordgo.Message {
+	merged := *messages[len(messages)-1]
+	var lines []string
+	merged.Attachments = nil
+	for _, m := range messages {
+		if m.Content != "" {
+			lines = append(lines, m.Content)
+		}
+		merged.Attachments = append(merged.Attachments, m.Attachments...)
+	}
+	merged.Content = strings.Join(lines, "\n")
+	return &merged
+}
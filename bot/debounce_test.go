@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+func TestDebounce(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "Sure, here goes."}}}
+	b, session := newTestBot(t, client)
+	b.config().MessageDebounce = 50 * time.Millisecond
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.HandleMessage(userMessage("hey"))
+	}()
+	// Wait for the first message to be held
+	for {
+		b.burstsMu.Lock()
+		_, held := b.bursts["channel:user"]
+		b.burstsMu.Unlock()
+		if held {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for _, text := range []string{"can you", "explain goroutines"} {
+		m := userMessage(text)
+		m.ID = text
+		b.HandleMessage(m)
+	}
+	wg.Wait()
+
+	if len(client.chats) != 1 || len(client.chats[0].sent) != 1 {
+		t.Fatalf("chats = %v, want a single prompt", client.chats)
+	}
+	if text := partsText(client.chats[0].sent[0]); !strings.Contains(text, "hey\ncan you\nexplain goroutines") {
+		t.Errorf("prompt = %q, want the messages merged", text)
+	}
+	if len(session.messages) != 1 {
+		t.Errorf("messages = %q, want one answer", session.messages)
+	}
+
+	// Long messages are answered right away
+	b.HandleMessage(userMessage(strings.Repeat("Explain how the Go scheduler multiplexes goroutines onto threads. ", 2)))
+	if len(client.chats[0].sent) != 2 {
+		t.Errorf("sent %d prompts, want the long message answered at once", len(client.chats[0].sent))
+	}
+}
+
+func TestMergeMessages(t *testing.T) {
+	attachment := &discordgo.MessageAttachment{ID: "file"}
+	merged := mergeMessages([]*discordgo.Message{
+		{ID: "1", Content: "look at this"},
+		{ID: "2", Attachments: []*discordgo.MessageAttachment{attachment}},
+		{ID: "3", Content: "what is it?"},
+	})
+	if merged.ID != "3" || merged.Content != "look at this\nwhat is it?" || len(merged.Attachments) != 1 {
+		t.Errorf("merged = %+v", merged)
+	}
+}
@@ -0,0 +1,59 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/diagram"
+)
+
+const (
+	// Most diagrams of an answer rendered
+	maxDiagrams = 4
+
+	// How long rendering the diagrams of an answer may take
+	diagramTimeout = 30 * time.Second
+)
+
+// diagramFiles renders the Mermaid and Graphviz diagrams of an answer to
+// PNG files when RENDER_DIAGRAMS is on, skipping those that fail to render
+// and those whose tool isn't installed
+func (b *Bot) diagramFiles(text string, spoiler bool) []*discordgo.File {
+	cfg := b.config()
+	if !cfg.RenderDiagrams {
+		return nil
+	}
+	diagrams := diagram.Find(text, maxDiagrams)
+	if len(diagrams) == 0 {
+		return nil
+	}
+
+	renderer := &diagram.Renderer{Mermaid: strings.Fields(cfg.MermaidCommand), Graphviz: strings.Fields(cfg.GraphvizCommand)}
+	ctx, cancel := context.WithTimeout(b.ctx, diagramTimeout)
+	defer cancel()
+	var files []*discordgo.File
+	for n, d := range diagrams {
+		image, err := renderer.Render(ctx, d)
+		if errors.Is(err, diagram.ErrNoRenderer) {
+			slog.Debug("No renderer for diagram", "language", d.Language)
+			continue
+		}
+		if err != nil {
+			slog.Warn("Error rendering diagram", "language", d.Language, "error", err)
+			continue
+		}
+		name := fmt.Sprintf("diagram-%d.png", n+1)
+		if spoiler {
+			name = "SPOILER_" + name
+		}
+		files = append(files, &discordgo.File{Name: name, ContentType: "image/png", Reader: bytes.NewReader(image)})
+	}
+	return files
+}
@@ -0,0 +1,24 @@
+package bot
+
+import "testing"
+
+func TestResponseDiagrams(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+	answer := "The flow:\n```dot\ndigraph { request -> answer }\n```"
+
+	b.sendResponse("channel", answer, "", false, "", nil)
+	if len(session.files) != 0 {
+		t.Fatalf("files = %v, want none while rendering is off", session.files)
+	}
+
+	// A stand-in for dot echoing the source
+	b.config().RenderDiagrams = true
+	b.config().GraphvizCommand = "sh -c cat"
+	b.sendResponse("channel", answer, "", false, "", nil)
+	if image := session.files["channel/diagram-1.png"]; string(image) != "digraph { request -> answer }" {
+		t.Errorf("files = %v, want the diagram rendered and attached", session.files)
+	}
+	if len(session.messages) != 2 || session.messages[1] != answer {
+		t.Errorf("sent %q, want the answer with its code block", session.messages)
+	}
+}
@@ -0,0 +1,203 @@
+package bot
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/store"
+)
+
+const (
+	// How long after answering a message an edit of it is still answered again
+	answerEditWindow = 24 * time.Hour
+
+	// How long the bot remembers which messages answered a message, so its
+	// reply can be deleted along with it
+	answerRetention = 7 * 24 * time.Hour
+)
+
+// lastTurn is the chat history before a chat's latest answered message, so
+// an edit of that message can replace the turn instead of adding one, and
+// the number of entries the history had after it
+type lastTurn struct {
+	promptID string
+	history  []*genai.Content
+	entries  int
+}
+
+// rememberAnswer records which messages carry the answer to a prompt, and the
+// chat's history from before it was answered
+func (b *Bot) rememberAnswer(answer store.Answer, chat ai.Chat, before []*genai.Content) {
+	if len(answer.ReplyIDs) == 0 {
+		return
+	}
+
+	b.lastTurnsMu.Lock()
+	b.lastTurns[chat] = lastTurn{promptID: answer.PromptID, history: before, entries: len(chat.History())}
+	b.lastTurnsMu.Unlock()
+
+	if err := b.store.SaveAnswer(answer); err != nil {
+		slog.Error("Error saving answer", "message", answer.PromptID, "error", err)
+		return
+	}
+	if _, err := b.store.DeleteAnswersBefore(time.Now().Add(-answerRetention)); err != nil {
+		slog.Error("Error deleting old answers", "error", err)
+	}
+}
+
+// HandleMessageUpdate answers an edited message again, after the messages of
+// its channel it was queued behind
+func (b *Bot) HandleMessageUpdate(m *discordgo.MessageUpdate) {
+	t := b.takeTicket(m.ChannelID)
+	defer b.releaseTicket(t)
+	b.handleMessageUpdate(m, t)
+}
+
+// handleMessageUpdate answers an edited message again once the earlier
+// messages of its channel were handled, editing the bot's earlier reply in
+// place so it doesn't go stale. Edits go through the same checks as new
+// messages, so they can't get around rate limits.
+func (b *Bot) handleMessageUpdate(m *discordgo.MessageUpdate, t *ticket) {
+	// Updates without an author or edit time, such as embeds being added, and
+	// edits by bots aren't answered again
+	if m.Author == nil || m.Author.Bot || m.Author.ID == b.session.BotUserID() || m.EditedTimestamp == nil {
+		return
+	}
+
+	// The answer to a message edited right away may still be on its way
+	t.wait()
+	answer, err := b.store.Answer(m.ID)
+	if err != nil {
+		slog.Error("Error looking up answer", "message", m.ID, "error", err)
+		return
+	}
+	// Discord edit times have millisecond precision, like the stored ones
+	if answer == nil || time.Since(answer.CreatedAt) > answerEditWindow || !m.EditedTimestamp.Truncate(time.Millisecond).After(answer.EditedAt) {
+		return
+	}
+	created := &discordgo.MessageCreate{Message: m.Message}
+	logger := messageLogger(created)
+	if !b.pluginsAccept(m.Message) || !b.answersAuthor(created) {
+		return
+	}
+
+	// Leave the answer as it is during maintenance, once the server's
+	// monthly quota is used up and while the author is over the rate limit
+	settings := b.guildSettings(m.GuildID)
+	if b.maintenance.Load() || b.quotaExhausted(m.GuildID) || b.rateLimited(created, settings) {
+		return
+	}
+
+	parts := b.promptParts(m.Message)
+	if len(parts) == 0 {
+		return
+	}
+
+	// Replace the turn when the message is still the latest one in its chat,
+	// otherwise tell the model which message changed
+	chat := b.chatFor(answer.ChannelID, m.GuildID)
+	unlock := b.lockSession(chat)
+	defer unlock()
+	b.lastTurnsMu.Lock()
+	turn, latest := b.lastTurns[chat]
+	b.lastTurnsMu.Unlock()
+	var before []*genai.Content
+	if latest && turn.promptID == m.ID && len(chat.History()) == turn.entries {
+		chat.SetHistory(turn.history)
+		before = turn.history
+	} else {
+		before = chat.History()
+		parts = append([]genai.Part{genai.Text("The user edited an earlier message, answer its new version:")}, parts...)
+	}
+
+	variant, persona := b.personaVariant(m.GuildID, answer.ChannelID)
+	if variant != "" {
+		settings.Persona = persona
+	}
+	parts = b.withFollowUps(withGuildSettings(settings, m.Content, withVerbosity(settings.Verbosity, b.withPersona(answer.ChannelID, b.withCampaign(answer.ChannelID, parts)))))
+	stopTyping := b.keepTyping(answer.ChannelID)
+	reply, latency, err := b.answer(b.answerContext(m.GuildID, m.ChannelID, settings.Verbosity), chat, m.Message, parts)
+	stopTyping()
+	if errors.Is(err, ai.ErrBusy) {
+		if err := b.session.MessageReactionAdd(m.ChannelID, m.ID, "⏳"); err != nil {
+			logger.Error("Error adding busy reaction", "error", err)
+		}
+		return
+	}
+	text, footer, spoiler := b.trGuild(m.GuildID, "Sorry, an error occurred: %v", err), "", false
+	var followUps []string
+	if err != nil {
+		// Errors aren't voted on
+		variant = ""
+	}
+	if errors.Is(err, ai.ErrUnavailable) {
+		text = b.trGuild(m.GuildID, "The AI is temporarily unavailable, please try again in a few minutes.")
+	}
+	if err == nil {
+		if b.config().FollowUpButtons {
+			followUps = takeFollowUps(chat, reply)
+		}
+		text, footer, spoiler = b.responseText(m.GuildID, reply), responseFooter(reply, latency), withSpoilers(settings, reply)
+	}
+
+	answer.ReplyIDs = b.updateResponse(answer.ChannelID, answer.ReplyIDs, text, footer, spoiler, variant, followUps)
+	if err == nil {
+		b.rememberFeedbackExchange(answer.ReplyIDs, m.Author.ID, m.Content, text)
+	}
+	answer.EditedAt = *m.EditedTimestamp
+	b.rememberAnswer(*answer, chat, before)
+	b.recordTurns(chat, before, m.Message, answer.ChannelID)
+	logger.Info("Updated answer to edited message", "message", m.ID)
+
+	if err == nil {
+		b.compactHistory(chat, m.Author.ID, m.GuildID)
+		b.saveSession(chat)
+	}
+}
+
+// deleteAnswer deletes the bot's reply to a deleted message, and the
+// message's turn from its chat when it was the latest one
+func (b *Bot) deleteAnswer(promptID string) {
+	answer, err := b.store.Answer(promptID)
+	if err != nil {
+		slog.Error("Error looking up answer", "message", promptID, "error", err)
+		return
+	}
+	if answer == nil {
+		return
+	}
+
+	for _, replyID := range answer.ReplyIDs {
+		if err := b.session.ChannelMessageDelete(answer.ChannelID, replyID); err != nil {
+			slog.Error("Error deleting reply to deleted message", "channel", answer.ChannelID, "message", replyID, "error", err)
+		}
+	}
+	if err := b.store.DeleteAnswer(promptID); err != nil {
+		slog.Error("Error deleting answer", "message", promptID, "error", err)
+	}
+
+	b.lastTurnsMu.Lock()
+	defer b.lastTurnsMu.Unlock()
+	for chat, turn := range b.lastTurns {
+		if turn.promptID == promptID {
+			if len(chat.History()) == turn.entries {
+				chat.SetHistory(turn.history)
+			}
+			delete(b.lastTurns, chat)
+		}
+	}
+	slog.Info("Deleted reply to deleted message", "channel", answer.ChannelID, "message", promptID)
+}
+
+// forgetLastTurn drops the history kept for editing a chat's latest turn
+func (b *Bot) forgetLastTurn(chat ai.Chat) {
+	b.lastTurnsMu.Lock()
+	defer b.lastTurnsMu.Unlock()
+
+	delete(b.lastTurns, chat)
+}
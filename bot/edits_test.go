@@ -0,0 +1,158 @@
+package bot
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/store"
+)
+
+// editedMessage returns an update of a user message whose content was edited
+func editedMessage(m *discordgo.MessageCreate, content string) *discordgo.MessageUpdate {
+	edited := *m.Message
+	edited.Content = content
+	editedAt := time.Now()
+	edited.EditedTimestamp = &editedAt
+	return &discordgo.MessageUpdate{Message: &edited}
+}
+
+func TestEditedMessageUpdatesAnswer(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "first answer"}, {Text: "second answer"}}}
+	b, session := newTestBot(t, client)
+
+	m := userMessage("what is 2+2?")
+	b.HandleMessage(m)
+	b.HandleMessageUpdate(editedMessage(m, "what is 2+3?"))
+
+	if want := []string{"second answer"}; !slices.Equal(session.messages, want) {
+		t.Errorf("messages = %q, want %q", session.messages, want)
+	}
+	// The edited turn replaces the original one
+	chat := client.chats[0]
+	if len(chat.history) != 2 || chat.history[0].Parts[len(chat.history[0].Parts)-1] != genai.Text("what is 2+3?") {
+		t.Errorf("history = %v, want only the edited turn", chat.history)
+	}
+}
+
+func TestEditedEarlierMessage(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "one"}, {Text: "two"}, {Text: "one again"}}}
+	b, session := newTestBot(t, client)
+
+	first := userMessage("first")
+	b.HandleMessage(first)
+	second := userMessage("second")
+	second.ID = "second"
+	b.HandleMessage(second)
+	b.HandleMessageUpdate(editedMessage(first, "first, edited"))
+
+	if want := []string{"one again", "two"}; !slices.Equal(session.messages, want) {
+		t.Errorf("messages = %q, want %q", session.messages, want)
+	}
+	sent := client.chats[0].sent[2]
+	if sent[0] != genai.Text("The user edited an earlier message, answer its new version:") {
+		t.Errorf("sent %v, want the edit noted first", sent)
+	}
+}
+
+func TestEditedMessageShortensAnswer(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: strings.Repeat("a", 4500)}, {Text: "short"}}}
+	b, session := newTestBot(t, client)
+
+	m := userMessage("hi")
+	b.HandleMessage(m)
+	b.HandleMessageUpdate(editedMessage(m, "hi there"))
+
+	if session.messages[0] != "short" {
+		t.Errorf("first message = %q, want short", session.messages[0])
+	}
+	if want := []string{"sent-1", "sent-2"}; !slices.Equal(session.deleted, want) {
+		t.Errorf("deleted %q, want %q", session.deleted, want)
+	}
+}
+
+func TestEditedMessageRateLimited(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "first answer"}, {Text: "second answer"}}}
+	b, session := newTestBot(t, client)
+	if err := b.store.SetGuildSettings(store.GuildSettings{GuildID: "guild", RateLimit: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Edits count toward the author's limit like new messages
+	m := userMessage("what is 2+2?")
+	b.HandleMessage(m)
+	b.HandleMessageUpdate(editedMessage(m, "what is 2+3?"))
+
+	if len(session.messages) != 2 || session.messages[0] != "first answer" || !strings.Contains(session.messages[1], "slow down") {
+		t.Errorf("messages = %q, want the answer left as it was and a warning", session.messages)
+	}
+	if len(client.chats[0].sent) != 1 {
+		t.Errorf("sent %d messages to the model, want the edit refused", len(client.chats[0].sent))
+	}
+}
+
+func TestIgnoredMessageUpdates(t *testing.T) {
+	tests := []struct {
+		name   string
+		update func(m *discordgo.MessageCreate) *discordgo.MessageUpdate
+	}{
+		{"embeds added", func(m *discordgo.MessageCreate) *discordgo.MessageUpdate {
+			return &discordgo.MessageUpdate{Message: m.Message}
+		}},
+		{"unanswered message", func(m *discordgo.MessageCreate) *discordgo.MessageUpdate {
+			update := editedMessage(m, "edited")
+			update.ID = "other"
+			return update
+		}},
+		{"edited before answering", func(m *discordgo.MessageCreate) *discordgo.MessageUpdate {
+			update := editedMessage(m, "edited")
+			editedAt := time.Now().Add(-time.Hour)
+			update.EditedTimestamp = &editedAt
+			return update
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeAI{replies: []*ai.Reply{{Text: "hello"}, {Text: "regenerated"}}}
+			b, session := newTestBot(t, client)
+
+			m := userMessage("hi")
+			editedAt := time.Now().Add(-time.Minute)
+			m.EditedTimestamp = &editedAt
+			b.HandleMessage(m)
+			b.HandleMessageUpdate(test.update(m))
+
+			if want := []string{"hello"}; !slices.Equal(session.messages, want) {
+				t.Errorf("messages = %q, want %q", session.messages, want)
+			}
+		})
+	}
+}
+
+func TestDeletedMessageDeletesAnswer(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: strings.Repeat("a", 2500)}}}
+	b, session := newTestBot(t, client)
+
+	m := userMessage("hi")
+	b.HandleMessage(m)
+	b.handleMessageDelete(m.ID)
+
+	if want := []string{"sent-0", "sent-1"}; !slices.Equal(session.deleted, want) {
+		t.Errorf("deleted %q, want %q", session.deleted, want)
+	}
+	if history := client.chats[0].history; len(history) != 0 {
+		t.Errorf("history = %v, want the deleted turn removed", history)
+	}
+
+	// Deleting it again, or a message that wasn't answered, deletes nothing
+	b.handleMessageDelete(m.ID)
+	b.handleMessageDelete("other")
+	if len(session.deleted) != 2 {
+		t.Errorf("deleted %q, want nothing more", session.deleted)
+	}
+}
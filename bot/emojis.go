@@ -0,0 +1,148 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// Most emoji and sticker images attached to a prompt with EMOJI_IMAGES
+	maxEmojiImages = 4
+
+	// Largest emoji or sticker image downloaded
+	maxEmojiImageSize = 1 << 20
+)
+
+var (
+	// Where emoji and sticker images are downloaded from, replaced in tests
+	emojiCDN = discordgo.EndpointCDN
+
+	// A custom emoji as Discord writes it in messages, like <:party:123> or
+	// <a:party:123> when animated
+	messageEmoji = regexp.MustCompile(`<(a?):(\w{2,32}):(\d+)>`)
+
+	// Custom emojis in the model's answers, whole or broken, like <:party:>,
+	// <:party or <a:party:123 without its closing bracket, and :shortcodes:
+	answerEmoji = regexp.MustCompile(`<a?:(\w{2,32})(?::\d*)?>?|:(\w{2,32}):`)
+
+	// Fenced code blocks and inline code, where emojis are left as they are
+	emojiCode = regexp.MustCompile("(?s)```.*?```|`[^`\n]+`")
+)
+
+// promptEmojis returns a message's content with its custom emojis written as
+// :name:, so the model reads their names rather than their markup, and the
+// parts describing its stickers. With EMOJI_IMAGES, images of the first
+// emojis and stickers are attached for the model to see them.
+func (b *Bot) promptEmojis(m *discordgo.Message) (string, []genai.Part) {
+	var parts []genai.Part
+	images, limit := 0, 0
+	if b.config().EmojiImages {
+		limit = maxEmojiImages
+	}
+	seen := map[string]bool{}
+	content := messageEmoji.ReplaceAllStringFunc(m.Content, func(markup string) string {
+		match := messageEmoji.FindStringSubmatch(markup)
+		name, id := match[2], match[3]
+		if !seen[id] && images < limit {
+			seen[id] = true
+			extension := ".png"
+			if match[1] == "a" {
+				extension = ".gif"
+			}
+			if part := b.emojiImage(m.GuildID, emojiCDN+"emojis/"+id+extension, name); part != nil {
+				parts = append(parts, genai.Text(fmt.Sprintf("Custom emoji :%s: looks like this:", name)), part)
+				images++
+			}
+		}
+		return ":" + name + ":"
+	})
+
+	for _, sticker := range m.StickerItems {
+		parts = append(parts, genai.Text(fmt.Sprintf("[Sticker: %s]", sticker.Name)))
+		// Lottie stickers are animations in JSON the model can't see
+		if sticker.FormatType == discordgo.StickerFormatTypeLottie || images >= limit {
+			continue
+		}
+		extension := ".png"
+		if sticker.FormatType == discordgo.StickerFormatTypeGIF {
+			extension = ".gif"
+		}
+		if part := b.emojiImage(m.GuildID, emojiCDN+"stickers/"+sticker.ID+extension, sticker.Name); part != nil {
+			parts = append(parts, part)
+			images++
+		}
+	}
+	return content, parts
+}
+
+// emojiImage downloads the image of an emoji or sticker and uploads it for
+// the model, returning nil when it can't
+func (b *Bot) emojiImage(guildID, url, name string) genai.Part {
+	data, contentType, err := fetchDocument(url, maxEmojiImageSize)
+	if err != nil {
+		slog.Warn("Error downloading emoji image", "emoji", name, "error", err)
+		return nil
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = "image/png"
+		if strings.HasSuffix(url, ".gif") {
+			contentType = "image/gif"
+		}
+	}
+	part, err := b.aiFor(guildID).UploadFile(b.ctx, data, contentType, name)
+	if err != nil {
+		slog.Warn("Error uploading emoji image", "emoji", name, "error", err)
+		return nil
+	}
+	return part
+}
+
+// fixEmojis rewrites the custom emojis of an answer, outside code, so they
+// render: markup of the server's emojis is kept or its ID corrected, the
+// :name: of one becomes its markup, and the rest, including broken markup,
+// is written as :name:
+func (b *Bot) fixEmojis(guildID, text string) string {
+	if !strings.Contains(text, ":") {
+		return text
+	}
+	emojis := map[string]*discordgo.Emoji{}
+	if guildID != "" {
+		if guild, err := b.session.Guild(guildID); err == nil {
+			for _, emoji := range guild.Emojis {
+				emojis[emoji.Name] = emoji
+			}
+		}
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, span := range emojiCode.FindAllStringIndex(text, -1) {
+		out.WriteString(fixEmojiMarkup(text[last:span[0]], emojis))
+		out.WriteString(text[span[0]:span[1]])
+		last = span[1]
+	}
+	out.WriteString(fixEmojiMarkup(text[last:], emojis))
+	return out.String()
+}
+
+// fixEmojiMarkup rewrites the custom emojis of text without code, given the
+// server's emojis by name
+func fixEmojiMarkup(text string, emojis map[string]*discordgo.Emoji) string {
+	return answerEmoji.ReplaceAllStringFunc(text, func(found string) string {
+		match := answerEmoji.FindStringSubmatch(found)
+		name := match[1] + match[2]
+		if emoji, ok := emojis[name]; ok && emoji.Available {
+			return emoji.MessageFormat()
+		}
+		if match[2] != "" {
+			// Other shortcodes may be standard emojis, left as they are
+			return found
+		}
+		return ":" + name + ":"
+	})
+}
@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+func TestEmojisInPrompts(t *testing.T) {
+	var downloaded []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloaded = append(downloaded, r.URL.Path)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("not really an image"))
+	}))
+	defer server.Close()
+	defer func(cdn string) { emojiCDN = cdn }(emojiCDN)
+	emojiCDN = server.URL + "/"
+	allowLocalFetch(t)
+
+	client := &fakeAI{replies: []*ai.Reply{{Text: "Nice <:party:999>! :party: <a:dance: `<:party:1>` :smile:"}}}
+	b, session := newTestBot(t, client)
+	b.config().EmojiImages = true
+	session.guilds = []*discordgo.Guild{{ID: "guild", Emojis: []*discordgo.Emoji{{ID: "111", Name: "party", Available: true}}}}
+
+	m := userMessage("we shipped <:party:111> <a:dance:222> <:party:111>")
+	m.StickerItems = []*discordgo.StickerItem{
+		{ID: "333", Name: "Wave", FormatType: discordgo.StickerFormatTypePNG},
+		{ID: "444", Name: "Cat", FormatType: discordgo.StickerFormatTypeLottie},
+	}
+	b.HandleMessage(m)
+
+	prompt := partsText(client.chats[0].sent[0])
+	if !strings.Contains(prompt, "we shipped :party: :dance: :party:") || strings.Contains(prompt, "<:party:111>") {
+		t.Errorf("prompt = %q, want emojis by name", prompt)
+	}
+	if !strings.Contains(prompt, "[Sticker: Wave]") || !strings.Contains(prompt, "[Sticker: Cat]") || !strings.Contains(prompt, "[uploaded dance]") {
+		t.Errorf("prompt = %q, want the stickers and emoji images", prompt)
+	}
+	if want := []string{"/emojis/111.png", "/emojis/222.gif", "/stickers/333.png"}; strings.Join(downloaded, " ") != strings.Join(want, " ") {
+		t.Errorf("downloaded %q, want %q", downloaded, want)
+	}
+
+	// Answers only use the server's emojis, and never broken markup
+	if want := "Nice <:party:111>! <:party:111> :dance: `<:party:1>` :smile:"; len(session.messages) != 1 || !strings.HasPrefix(session.messages[0], want) {
+		t.Errorf("messages = %q, want %q", session.messages, want)
+	}
+}
+
+func TestFixEmojis(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+	session.guilds = []*discordgo.Guild{{ID: "guild", Emojis: []*discordgo.Emoji{
+		{ID: "111", Name: "party", Available: true},
+		{ID: "222", Name: "dance", Animated: true, Available: true},
+		{ID: "333", Name: "gone"},
+	}}}
+
+	for text, want := range map[string]string{
+		"<:party:111>":           "<:party:111>",
+		"<:dance:222>":           "<a:dance:222>",
+		"<:party:> and <:party":  "<:party:111> and <:party:111>",
+		"<:wave:123>":            ":wave:",
+		"<a:wave:":               ":wave:",
+		":gone: :party:":         ":gone: <:party:111>",
+		"at 12:30:45 on <t:1:R>": "at 12:30:45 on <t:1:R>",
+		"```\n<:wave:123>\n```":  "```\n<:wave:123>\n```",
+		"no emojis here":         "no emojis here",
+	} {
+		if got := b.fixEmojis("guild", text); got != want {
+			t.Errorf("fixEmojis(%q) = %q, want %q", text, got, want)
+		}
+	}
+	if got := b.fixEmojis("", "<:party:111>"); got != ":party:" {
+		t.Errorf("fixEmojis in DMs = %q, want the emoji by name", got)
+	}
+}
@@ -0,0 +1,244 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/store"
+)
+
+const (
+	// Minutes before an event its reminder is posted by default
+	defaultEventReminderMinutes = 30
+
+	// Upper bound of the /event draft remind option, a day
+	maxEventReminderMinutes = 24 * 60
+
+	// How long an event lasts when the prompt doesn't say
+	defaultEventLength = time.Hour
+
+	// Discord's limits on event names and descriptions
+	maxEventNameLength        = 100
+	maxEventDescriptionLength = 1000
+)
+
+// Lower bound of the /event draft remind option, 0 for no reminder (the API
+// takes a pointer)
+var minEventReminderMinutes = 0.0
+
+// eventDraft is the event the model writes from a /event draft prompt
+type eventDraft struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Start       string `json:"start"`
+	End         string `json:"end"`
+	Location    string `json:"location"`
+}
+
+// eventCommand handles the /event subcommands. Creating events needs the
+// Manage Events permission.
+func (b *Bot) eventCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Events only work in servers."))
+		return
+	}
+	if i.Member == nil || i.Member.Permissions&discordgo.PermissionManageEvents == 0 {
+		b.respondEphemeral(i, tr(i, "You need the Manage Events permission to create events."))
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	switch subcommand.Name {
+	case "draft":
+		b.draftEvent(i, subcommand.Options)
+	}
+}
+
+// draftEvent has the model write an event's name, description and time from
+// a prompt, creates it as a scheduled event of the server, in a voice or
+// stage channel or elsewhere, and saves a reminder to post in the channel
+// before it starts
+func (b *Bot) draftEvent(i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	prompt := commandOption(options, "prompt").StringValue()
+	remind := defaultEventReminderMinutes
+	if option := commandOption(options, "remind"); option != nil {
+		remind = int(option.IntValue())
+	}
+	var channel *discordgo.Channel
+	if option := commandOption(options, "channel"); option != nil {
+		channel = option.ChannelValue(nil)
+		if looked, err := b.session.Channel(channel.ID); err == nil {
+			channel = looked
+		}
+	}
+
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to event command", "error", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	draft, err := b.writeEventDraft(i, prompt, now)
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	start, err := time.Parse(time.RFC3339, draft.Start)
+	if err != nil || !start.After(now) {
+		b.editInteractionResponse(i, tr(i, "I couldn't tell when this event starts. Say when in the prompt, like `Friday at 18:00 UTC`."))
+		return
+	}
+	end, err := time.Parse(time.RFC3339, draft.End)
+	if err != nil || !end.After(start) {
+		end = start.Add(defaultEventLength)
+	}
+
+	params := &discordgo.GuildScheduledEventParams{
+		Name:               cleanTitle(draft.Name, maxEventNameLength),
+		Description:        truncate(strings.TrimSpace(draft.Description), maxEventDescriptionLength),
+		ScheduledStartTime: &start,
+		ScheduledEndTime:   &end,
+		PrivacyLevel:       discordgo.GuildScheduledEventPrivacyLevelGuildOnly,
+	}
+	switch {
+	case channel != nil && channel.Type == discordgo.ChannelTypeGuildStageVoice:
+		params.ChannelID, params.EntityType = channel.ID, discordgo.GuildScheduledEventEntityTypeStageInstance
+	case channel != nil:
+		params.ChannelID, params.EntityType = channel.ID, discordgo.GuildScheduledEventEntityTypeVoice
+	default:
+		location := cleanTitle(draft.Location, maxEventNameLength)
+		if location == "" {
+			location = "Discord"
+		}
+		params.EntityType = discordgo.GuildScheduledEventEntityTypeExternal
+		params.EntityMetadata = &discordgo.GuildScheduledEventEntityMetadata{Location: location}
+	}
+	if params.Name == "" {
+		params.Name = truncate(prompt, maxEventNameLength)
+	}
+
+	event, err := b.session.GuildScheduledEventCreate(i.GuildID, params)
+	if err != nil {
+		interactionLogger(i).Error("Error creating event", "error", err)
+		b.editInteractionResponse(i, tr(i, "I couldn't create the event, check that I have the Manage Events permission: %v", err))
+		return
+	}
+	interactionLogger(i).Info("Created event", "event", event.ID, "start", start)
+
+	content := tr(i, "Created **%s** for <t:%d:F>: %s", event.Name, start.Unix(), eventLink(event))
+	remindAt := start.Add(-time.Duration(remind) * time.Minute)
+	if remind > 0 && remindAt.After(now) {
+		reminder := store.EventReminder{GuildID: i.GuildID, EventID: event.ID, ChannelID: i.ChannelID, CreatedBy: interactionUserID(i), RemindAt: remindAt}
+		if _, err := b.store.AddEventReminder(reminder); err != nil {
+			interactionLogger(i).Error("Error saving event reminder", "error", err)
+		} else {
+			content += "\n" + tr(i, "I'll post a reminder here %d minutes before it starts.", remind)
+		}
+	}
+	b.editInteractionResponse(i, content)
+}
+
+// writeEventDraft asks the model for the name, description, time and place
+// of an event described by a prompt, relative to now
+func (b *Bot) writeEventDraft(i *discordgo.InteractionCreate, prompt string, now time.Time) (eventDraft, error) {
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"name":        {Type: genai.TypeString, Description: "A short, catchy event title of at most 100 characters"},
+			"description": {Type: genai.TypeString, Description: "An inviting description of the event of at most 1000 characters, saying what to expect and what to bring"},
+			"start":       {Type: genai.TypeString, Description: "When the event starts as an RFC 3339 timestamp in UTC, like 2024-05-01T18:00:00Z, or an empty string if the prompt doesn't say"},
+			"end":         {Type: genai.TypeString, Description: "When the event ends as an RFC 3339 timestamp in UTC, or an empty string if the prompt doesn't say"},
+			"location":    {Type: genai.TypeString, Description: "Where the event takes place if the prompt says, else an empty string"},
+		},
+		Required: []string{"name", "description", "start", "end", "location"},
+	}
+	text := fmt.Sprintf("It is now %s (%s, UTC). Draft a Discord server event from the organizer's request below, "+
+		"in the language of the request. Times without a time zone are in UTC.\n\n%s", now.Format(time.RFC3339), now.Weekday(), prompt)
+	reply, err := b.generateJSON(interactionUserID(i), i.GuildID, schema, genai.Text(text))
+	if err != nil {
+		return eventDraft{}, err
+	}
+	var draft eventDraft
+	if err := json.Unmarshal([]byte(reply), &draft); err != nil {
+		return eventDraft{}, fmt.Errorf("error parsing event: %v", err)
+	}
+	return draft, nil
+}
+
+// sendEventReminders posts the event reminders due at now, written by the
+// model from the event as it is then. Reminders of events that were
+// cancelled, deleted or already started are dropped, and ones that can't be
+// sent are retried on the next tick until their event starts.
+func (b *Bot) sendEventReminders(now time.Time) {
+	reminders, err := b.store.DueEventReminders(now)
+	if err != nil {
+		slog.Error("Error loading event reminders", "error", err)
+		return
+	}
+	for _, r := range reminders {
+		logger := slog.With("event", r.EventID, "guild", r.GuildID)
+		if b.postEventReminder(r, now, logger) {
+			continue
+		}
+		if err := b.store.DeleteEventReminder(r.ID); err != nil {
+			logger.Error("Error deleting event reminder", "error", err)
+		}
+	}
+}
+
+// postEventReminder posts an event's reminder, reporting whether it should
+// be retried
+func (b *Bot) postEventReminder(r store.EventReminder, now time.Time, logger *slog.Logger) bool {
+	event, err := b.session.GuildScheduledEvent(r.GuildID, r.EventID, true)
+	if err != nil {
+		logger.Warn("Dropped reminder of an event that can't be found", "error", err)
+		return false
+	}
+	if event.Status != discordgo.GuildScheduledEventStatusScheduled || !event.ScheduledStartTime.After(now) {
+		logger.Info("Dropped reminder of an event that isn't upcoming", "status", event.Status)
+		return false
+	}
+	if b.maintenance.Load() || b.quotaExhausted(r.GuildID) {
+		// Posted without the model's words rather than not at all
+		return b.sendEventReminder(r, event, b.trGuild(r.GuildID, "**%s** is coming up!", event.Name), logger)
+	}
+
+	prompt := fmt.Sprintf("Write a short, friendly reminder of two or three sentences for a Discord server that the event below starts soon, "+
+		"in the language of its description, making members want to join. Don't mention the exact time or add a link.\n\n"+
+		"Event: %s\nDescription: %s\nInterested members: %d", event.Name, event.Description, event.UserCount)
+	text, err := b.generate(r.CreatedBy, r.GuildID, genai.Text(prompt))
+	if err != nil || strings.TrimSpace(text) == "" {
+		logger.Warn("Error writing event reminder", "error", err)
+		text = b.trGuild(r.GuildID, "**%s** is coming up!", event.Name)
+	}
+	return b.sendEventReminder(r, event, text, logger)
+}
+
+// sendEventReminder posts a reminder's text with when its event starts and
+// a link to it, reporting whether it should be retried
+func (b *Bot) sendEventReminder(r store.EventReminder, event *discordgo.GuildScheduledEvent, text string, logger *slog.Logger) bool {
+	content := fmt.Sprintf("⏰ %s\n%s", truncate(strings.TrimSpace(text), 1500),
+		b.trGuild(r.GuildID, "Starts <t:%d:R>: %s", event.ScheduledStartTime.Unix(), eventLink(event)))
+	_, err := b.session.ChannelMessageSendComplex(r.ChannelID, &discordgo.MessageSend{
+		Content:         content,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		logger.Warn("Error sending event reminder, retrying", "error", err)
+		return true
+	}
+	logger.Info("Sent event reminder")
+	return false
+}
+
+// eventLink returns the link opening a scheduled event
+func eventLink(event *discordgo.GuildScheduledEvent) string {
+	return fmt.Sprintf("https://discord.com/events/%s/%s", event.GuildID, event.ID)
+}
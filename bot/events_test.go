@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// eventInteraction is a /event command of a member with permissions, in
+// channel "channel"
+func eventInteraction(permissions int64, subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	i := promptInteraction("alice", permissions, subcommand, options...)
+	data := i.Data.(discordgo.ApplicationCommandInteractionData)
+	data.Name = "event"
+	i.Data = data
+	i.ChannelID = "channel"
+	return i
+}
+
+func TestDraftEvent(t *testing.T) {
+	start := time.Now().UTC().Add(2 * time.Hour).Truncate(time.Second)
+	client := &fakeAI{text: fmt.Sprintf(`{"name": "Movie night", "description": "We watch Alien.", "start": %q, "end": "", "location": ""}`,
+		start.Format(time.RFC3339))}
+	b, session := newTestBot(t, client)
+	session.channels["stage"] = &discordgo.Channel{ID: "stage", Type: discordgo.ChannelTypeGuildStageVoice}
+	manager := int64(discordgo.PermissionManageEvents)
+
+	b.HandleInteraction(eventInteraction(0, "draft", stringOption("prompt", "movie night in two hours")))
+	if got := session.responses[0].Data.Content; got != "You need the Manage Events permission to create events." {
+		t.Errorf("responded %q, want the permission required", got)
+	}
+
+	b.HandleInteraction(eventInteraction(manager, "draft", stringOption("prompt", "movie night in two hours"), channelOption("channel", "stage")))
+	event := session.events["event-0"]
+	if event == nil || event.Name != "Movie night" || event.Description != "We watch Alien." || !event.ScheduledStartTime.Equal(start) {
+		t.Fatalf("events = %+v, want the drafted event", session.events)
+	}
+	if event.ChannelID != "stage" || event.EntityType != discordgo.GuildScheduledEventEntityTypeStageInstance || !event.ScheduledEndTime.Equal(start.Add(time.Hour)) {
+		t.Errorf("event = %+v, want an hour on the stage", event)
+	}
+	if got := *session.edits[0].Content; !strings.Contains(got, "https://discord.com/events/guild/event-0") || !strings.Contains(got, "30 minutes before") {
+		t.Errorf("edit = %q, want the event's link and reminder", got)
+	}
+
+	// The reminder is written when it's due
+	client.text = "Grab popcorn, Alien starts soon!"
+	b.sendEventReminders(start.Add(-29 * time.Minute))
+	if len(session.messages) != 1 || !strings.HasPrefix(session.messages[0], "⏰ Grab popcorn, Alien starts soon!\nStarts <t:") {
+		t.Fatalf("messages = %q, want the reminder", session.messages)
+	}
+	if !strings.Contains(partsText(client.prompts[1]), "Event: Movie night") {
+		t.Errorf("prompt = %q, want the event", partsText(client.prompts[1]))
+	}
+	b.sendEventReminders(start.Add(-28 * time.Minute))
+	if len(session.messages) != 1 {
+		t.Errorf("messages = %q, want the reminder posted once", session.messages)
+	}
+
+	// Reminders of cancelled events are dropped
+	client.text = fmt.Sprintf(`{"name": "Game night", "description": "Board games.", "start": %q, "end": "", "location": "Café"}`, start.Format(time.RFC3339))
+	b.HandleInteraction(eventInteraction(manager, "draft", stringOption("prompt", "game night at the café")))
+	if event := session.events["event-1"]; event == nil || event.EntityType != discordgo.GuildScheduledEventEntityTypeExternal || event.EntityMetadata.Location != "Café" {
+		t.Fatalf("event = %+v, want an event at the café", event)
+	}
+	session.events["event-1"].Status = discordgo.GuildScheduledEventStatusCanceled
+	b.sendEventReminders(start)
+	if len(session.messages) != 1 {
+		t.Errorf("messages = %q, want no reminder of a cancelled event", session.messages)
+	}
+	if reminders, err := b.store.DueEventReminders(start); err != nil || len(reminders) != 0 {
+		t.Errorf("DueEventReminders = %+v, %v, want none left", reminders, err)
+	}
+
+	client.text = `{"name": "Someday", "description": "", "start": "", "end": "", "location": ""}`
+	b.HandleInteraction(eventInteraction(manager, "draft", stringOption("prompt", "someday")))
+	if got := *session.edits[len(session.edits)-1].Content; !strings.HasPrefix(got, "I couldn't tell when this event starts.") {
+		t.Errorf("edit = %q, want the start asked for", got)
+	}
+}
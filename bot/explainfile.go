@@ -0,0 +1,218 @@
+package bot
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+)
+
+const (
+	// Name of the message command explaining a code file
+	explainFileCommandName = "Explain code file"
+
+	// Largest source file explained, in bytes
+	maxExplainBytes = 256_000
+
+	// Lines of a source file explained at once, and most parts explained
+	explainChunkLines = 300
+	maxExplainChunks  = 8
+)
+
+var (
+	// Messages asking about an attached file, answered with a walkthrough of it
+	explainIntent = regexp.MustCompile(`(?i)\bexplain\b`)
+
+	// First fenced code block of a message, with its language tag
+	taggedCode = regexp.MustCompile("(?s)```([^\\n`]*)\\n(.*?)\\n?```")
+)
+
+// Extensions of source files in languages /code doesn't write, or other
+// extensions of those it does, with the code block tag of their language
+var sourceExtensions = map[string]string{
+	"h": "c", "cc": "cpp", "hpp": "cpp", "cxx": "cpp",
+	"jsx": "javascript", "mjs": "javascript", "cjs": "javascript", "tsx": "typescript",
+	"pyw": "python", "kts": "kotlin", "bash": "bash", "zsh": "bash", "htm": "html",
+	"yml": "yaml", "scala": "scala", "ex": "elixir", "exs": "elixir", "erl": "erlang",
+	"clj": "clojure", "ml": "ocaml", "fs": "fsharp", "pl": "perl", "vue": "vue", "zig": "zig",
+}
+
+// sourceFile is a code file to explain
+type sourceFile struct {
+	name     string
+	language codeLanguage
+	code     string
+}
+
+// sourceLanguage returns the language of a source file from its extension
+func sourceLanguage(filename string) (codeLanguage, bool) {
+	extension := strings.ToLower(strings.TrimPrefix(path.Ext(filename), "."))
+	if extension == "" {
+		return codeLanguage{}, false
+	}
+	tag, ok := sourceExtensions[extension]
+	for _, language := range codeLanguages {
+		if language.extension == extension || language.tag == extension || language.tag == tag {
+			return language, true
+		}
+	}
+	if ok {
+		return codeLanguage{name: tag, tag: tag, extension: extension}, true
+	}
+	return codeLanguage{}, false
+}
+
+// codeAttachment returns the first attached source file, or nil when there
+// is none
+func codeAttachment(attachments []*discordgo.MessageAttachment) *discordgo.MessageAttachment {
+	for _, attachment := range attachments {
+		if _, ok := sourceLanguage(attachment.Filename); ok {
+			return attachment
+		}
+	}
+	return nil
+}
+
+// readSourceFile downloads an attached source file
+func readSourceFile(attachment *discordgo.MessageAttachment) (*sourceFile, error) {
+	if attachment.Size > maxExplainBytes {
+		return nil, fmt.Errorf("%s is larger than %d KB", attachment.Filename, maxExplainBytes/1000)
+	}
+	data, err := downloadAttachment(attachment)
+	if err != nil {
+		return nil, err
+	}
+	language, _ := sourceLanguage(attachment.Filename)
+	return &sourceFile{name: attachment.Filename, language: language, code: string(data)}, nil
+}
+
+// explainFileMessage answers a message asking to explain its attached source
+// file with a walkthrough of it, keeping the exchange in the chat history
+func (b *Bot) explainFileMessage(m *discordgo.MessageCreate, attachment *discordgo.MessageAttachment) {
+	stopTyping := b.keepTyping(m.ChannelID)
+	file, err := readSourceFile(attachment)
+	var walkthrough string
+	if err == nil {
+		walkthrough, err = b.explainSource(m.Author.ID, m.GuildID, file)
+	}
+	stopTyping()
+	if err != nil {
+		messageLogger(m).Error("Error explaining file", "file", attachment.Filename, "error", err)
+		b.session.ChannelMessageSend(m.ChannelID, b.trGuild(m.GuildID, "Sorry, an error occurred: %v", err))
+		return
+	}
+
+	chat := b.chatFor(m.ChannelID, m.GuildID)
+	unlock := b.lockSession(chat)
+	recordExplanation(chat, file.name, m.Content, walkthrough)
+	unlock()
+	b.sendResponse(m.ChannelID, walkthrough, "", false, "", nil)
+	messageLogger(m).Info("Explained file", "file", file.name, "language", file.language.name)
+}
+
+// explainFileCommand handles the "Explain code file" message command,
+// privately walking through the message's source file or code block
+func (b *Bot) explainFileCommand(i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	message := data.Resolved.Messages[data.TargetID]
+
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to explain file command", "error", err)
+		return
+	}
+
+	var file *sourceFile
+	var err error
+	if attachment := codeAttachment(message.Attachments); attachment != nil {
+		file, err = readSourceFile(attachment)
+	} else if match := taggedCode.FindStringSubmatch(message.Content); match != nil {
+		language, _ := sourceLanguage("snippet." + strings.TrimSpace(match[1]))
+		file = &sourceFile{name: "a code snippet", language: language, code: match[2]}
+	} else {
+		b.editInteractionResponse(i, tr(i, "That message has no source file or code block to explain."))
+		return
+	}
+	if err == nil {
+		var walkthrough string
+		walkthrough, err = b.explainSource(interactionUserID(i), i.GuildID, file)
+		if err == nil {
+			b.editInteractionResponseLong(i, walkthrough, discordgo.MessageFlagsEphemeral)
+			return
+		}
+	}
+	interactionLogger(i).Error("Error explaining file", "error", err)
+	b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+}
+
+// explainSource walks through a source file function by function. Large files
+// are explained a few hundred lines at a time, after an overview of the whole.
+func (b *Bot) explainSource(userID string, guildID string, file *sourceFile) (string, error) {
+	language := "code"
+	if file.language.name != "" {
+		language = file.language.name + " code"
+	}
+	chunks := chunkLines(file.code, explainChunkLines)
+	truncated := len(chunks) > maxExplainChunks
+	chunks = chunks[:min(len(chunks), maxExplainChunks)]
+
+	instructions := fmt.Sprintf("Walk through this %s from %s. Explain each function, method or type in turn, "+
+		"under a bold heading with its name: what it does, its inputs and outputs, and anything subtle. "+
+		"Be concise and don't repeat the code.", language, file.name)
+	if len(chunks) == 1 {
+		instructions = fmt.Sprintf("Start with a short overview of what %s does. ", file.name) + instructions
+		return b.generate(userID, guildID, genai.Text(instructions+"\n\n```"+file.language.tag+"\n"+chunks[0].code+"\n```"))
+	}
+
+	var walkthroughs []string
+	for n, chunk := range chunks {
+		prompt := fmt.Sprintf("%s This is part %d of %d, lines %d to %d.\n\n```%s\n%s\n```",
+			instructions, n+1, len(chunks), chunk.start, chunk.end, file.language.tag, chunk.code)
+		text, err := b.generate(userID, guildID, genai.Text(prompt))
+		if err != nil {
+			return "", err
+		}
+		walkthroughs = append(walkthroughs, fmt.Sprintf("**Lines %d–%d**\n%s", chunk.start, chunk.end, strings.TrimSpace(text)))
+	}
+	overview, err := b.generate(userID, guildID, genai.Text(fmt.Sprintf(
+		"In a short paragraph, give an overview of what %s does and how it's organized, from these walkthroughs of its parts:\n\n%s",
+		file.name, strings.Join(walkthroughs, "\n\n"))))
+	if err != nil {
+		return "", err
+	}
+	walkthrough := strings.TrimSpace(overview) + "\n\n" + strings.Join(walkthroughs, "\n\n")
+	if truncated {
+		walkthrough += fmt.Sprintf("\n\n*Only the first %d lines were explained.*", maxExplainChunks*explainChunkLines)
+	}
+	return walkthrough, nil
+}
+
+// codeChunk is a run of lines of a source file, numbered from 1
+type codeChunk struct {
+	start, end int
+	code       string
+}
+
+// chunkLines splits code into runs of at most size lines
+func chunkLines(code string, size int) []codeChunk {
+	lines := strings.Split(strings.TrimRight(code, "\n"), "\n")
+	var chunks []codeChunk
+	for start := 0; start < len(lines); start += size {
+		end := min(start+size, len(lines))
+		chunks = append(chunks, codeChunk{start: start + 1, end: end, code: strings.Join(lines[start:end], "\n")})
+	}
+	return chunks
+}
+
+// recordExplanation appends a request to explain a file and the walkthrough
+// to the chat history, so follow-up questions have context
+func recordExplanation(chat ai.Chat, filename string, request string, walkthrough string) {
+	chat.SetHistory(append(chat.History(),
+		&genai.Content{Role: "user", Parts: []genai.Part{genai.Text(fmt.Sprintf("[Attached %s to explain] %s", filename, request))}},
+		&genai.Content{Role: "model", Parts: []genai.Part{genai.Text(walkthrough)}},
+	))
+}
@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSourceLanguage(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"main.go", "Go"},
+		{"App.TSX", "TypeScript"},
+		{"util.h", "C"},
+		{"build.scala", "scala"},
+		{"snippet.python", "Python"},
+		{"notes.txt", ""},
+		{"Makefile", ""},
+	}
+	for _, test := range tests {
+		if language, _ := sourceLanguage(test.filename); language.name != test.want {
+			t.Errorf("sourceLanguage(%q) = %q, want %q", test.filename, language.name, test.want)
+		}
+	}
+}
+
+func TestChunkLines(t *testing.T) {
+	chunks := chunkLines("a\nb\nc\nd\ne\n", 2)
+	if len(chunks) != 3 || chunks[1].start != 3 || chunks[1].end != 4 || chunks[1].code != "c\nd" || chunks[2].code != "e" {
+		t.Errorf("chunkLines = %+v, want three runs of at most two lines", chunks)
+	}
+}
+
+func TestExplainFileMessage(t *testing.T) {
+	code := strings.Repeat("x := 1\n", explainChunkLines+10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(code))
+	}))
+	defer server.Close()
+
+	client := &fakeAI{text: "It sets x."}
+	b, session := newTestBot(t, client)
+	m := userMessage("<@bot> can you explain this?")
+	m.Attachments = []*discordgo.MessageAttachment{{Filename: "main.go", URL: server.URL, Size: len(code)}}
+	b.HandleMessage(m)
+
+	// Two parts are explained, then the whole file is summed up
+	if len(client.prompts) != 3 || !strings.Contains(partsText(client.prompts[1]), "part 2 of 2, lines 301 to 310") {
+		t.Fatalf("sent %d prompts, want the file explained in two parts and an overview", len(client.prompts))
+	}
+	if len(session.messages) != 1 || !strings.HasPrefix(session.messages[0], "It sets x.\n\n**Lines 1–300**\nIt sets x.") {
+		t.Errorf("sent %q, want the overview and the walkthrough of each part", session.messages)
+	}
+	if history := b.chatFor("channel", "guild").History(); len(history) != 2 || !strings.Contains(partsText(history[0].Parts), "[Attached main.go to explain]") {
+		t.Errorf("history has %d entries, want the explanation recorded", len(history))
+	}
+}
+
+func TestExplainFileCommand(t *testing.T) {
+	client := &fakeAI{text: "Prints hello."}
+	b, session := newTestBot(t, client)
+
+	explain := func(content string) *discordgo.InteractionCreate {
+		i := commandInteraction(explainFileCommandName)
+		i.Data = discordgo.ApplicationCommandInteractionData{
+			Name:     explainFileCommandName,
+			TargetID: "target",
+			Resolved: &discordgo.ApplicationCommandInteractionDataResolved{
+				Messages: map[string]*discordgo.Message{"target": {ID: "target", Content: content}},
+			},
+		}
+		return i
+	}
+	b.HandleInteraction(explain("no code here"))
+	if len(session.edits) != 1 || !strings.Contains(*session.edits[0].Content, "no source file or code block") {
+		t.Errorf("edits = %v, want a refusal", session.edits)
+	}
+
+	session.edits = nil
+	b.HandleInteraction(explain("look:\n```py\nprint('hello')\n```"))
+	if len(session.edits) != 1 || *session.edits[0].Content != "Prints hello." {
+		t.Errorf("edits = %v, want the walkthrough", session.edits)
+	}
+	if prompt := partsText(client.prompts[0]); !strings.Contains(prompt, "Python code from a code snippet") || !strings.Contains(prompt, "print('hello')") {
+		t.Errorf("prompt %q, want the snippet as Python", prompt)
+	}
+}
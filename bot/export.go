@@ -0,0 +1,197 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+)
+
+// History entries whose metadata is remembered for /export
+const maxTurnInfo = 5000
+
+// turnInfo is what the history itself doesn't say about an entry: where and
+// when it was written, by whom, and what the user attached
+type turnInfo struct {
+	ChannelID   string
+	AuthorID    string
+	Author      string
+	Time        time.Time
+	Text        string
+	Attachments []exportedAttachment
+}
+
+// conversationExport is the JSON form of /export
+type conversationExport struct {
+	ChannelID  string         `json:"channel_id"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Messages   []exportedTurn `json:"messages"`
+}
+
+// exportedTurn is one message of an exported conversation
+type exportedTurn struct {
+	Role        string               `json:"role"`
+	Author      string               `json:"author,omitempty"`
+	AuthorID    string               `json:"author_id,omitempty"`
+	Time        *time.Time           `json:"time,omitempty"`
+	Text        string               `json:"text"`
+	Attachments []exportedAttachment `json:"attachments,omitempty"`
+}
+
+type exportedAttachment struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// recordTurns remembers who wrote the entries a message added to a chat's
+// history after before, and when
+func (b *Bot) recordTurns(chat ai.Chat, before []*genai.Content, m *discordgo.Message, channelID string) {
+	history := chat.History()
+	if len(history) <= len(before) {
+		return
+	}
+
+	written := m.Timestamp
+	if m.EditedTimestamp != nil {
+		written = *m.EditedTimestamp
+	}
+	if written.IsZero() {
+		written = time.Now()
+	}
+	prompt := turnInfo{ChannelID: channelID, AuthorID: m.Author.ID, Author: m.Author.Username, Time: written, Text: m.Content}
+	for _, attachment := range m.Attachments {
+		prompt.Attachments = append(prompt.Attachments, exportedAttachment{Name: attachment.Filename, URL: attachment.URL})
+	}
+
+	b.turnsMu.Lock()
+	defer b.turnsMu.Unlock()
+
+	b.rememberTurn(history[len(before)], prompt)
+	for _, content := range history[len(before)+1:] {
+		b.rememberTurn(content, turnInfo{ChannelID: channelID, Time: time.Now()})
+	}
+}
+
+// rememberTurn stores an entry's metadata, forgetting the oldest once the
+// cache is full. The caller holds turnsMu.
+func (b *Bot) rememberTurn(content *genai.Content, info turnInfo) {
+	if _, ok := b.turns[content]; !ok {
+		b.turnOrder = append(b.turnOrder, content)
+	}
+	b.turns[content] = info
+	if len(b.turnOrder) > maxTurnInfo {
+		delete(b.turns, b.turnOrder[0])
+		b.turnOrder = b.turnOrder[1:]
+	}
+}
+
+// exportCommand handles /export, attaching the channel's conversation with
+// the bot as Markdown or JSON
+func (b *Bot) exportCommand(i *discordgo.InteractionCreate) {
+	format := "md"
+	if option := commandOption(i.ApplicationCommandData().Options, "format"); option != nil {
+		format = option.StringValue()
+	}
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to export command", "error", err)
+		return
+	}
+
+	turns := b.channelConversation(i.ChannelID, i.GuildID)
+	if len(turns) == 0 {
+		b.editInteractionResponse(i, tr(i, "There's no conversation with me in this channel to export."))
+		return
+	}
+
+	var data []byte
+	if format == "json" {
+		var err error
+		data, err = json.MarshalIndent(conversationExport{ChannelID: i.ChannelID, ExportedAt: time.Now().UTC(), Messages: turns}, "", "  ")
+		if err != nil {
+			interactionLogger(i).Error("Error encoding conversation", "error", err)
+			b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+	} else {
+		data = []byte(conversationMarkdown(i.ChannelID, turns))
+	}
+
+	content := fmt.Sprintf("Exported %d messages.", len(turns))
+	_, err := b.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &content,
+		Files: []*discordgo.File{{
+			Name:   "conversation." + format,
+			Reader: bytes.NewReader(data),
+		}},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error sending conversation export", "error", err)
+		return
+	}
+	interactionLogger(i).Info("Exported conversation", "format", format, "messages", len(turns))
+}
+
+// channelConversation returns the conversation held in a channel. Threads
+// the bot started and conversation profiles have their own chat, exported
+// whole; other channels share a chat, of which only the turns written in the
+// channel are exported.
+func (b *Bot) channelConversation(channelID string, guildID string) []exportedTurn {
+	chat, _, shared := b.conversation(channelID, guildID)
+
+	b.turnsMu.Lock()
+	defer b.turnsMu.Unlock()
+
+	var turns []exportedTurn
+	for _, content := range chat.History() {
+		info, known := b.turns[content]
+		if shared && (!known || info.ChannelID != channelID) {
+			continue
+		}
+
+		turn := exportedTurn{Role: content.Role, Text: strings.TrimSpace(partsText(content.Parts))}
+		if known {
+			turn.Time = &info.Time
+			if info.AuthorID != "" {
+				// The prompt sent to the model also holds memories and
+				// knowledge base excerpts, export what the user wrote
+				turn.Author, turn.AuthorID, turn.Text, turn.Attachments = info.Author, info.AuthorID, info.Text, info.Attachments
+			}
+		}
+		// Function calls and their results have no text
+		if turn.Text == "" && len(turn.Attachments) == 0 {
+			continue
+		}
+		turns = append(turns, turn)
+	}
+	return turns
+}
+
+// conversationMarkdown renders an exported conversation as Markdown
+func conversationMarkdown(channelID string, turns []exportedTurn) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Conversation in channel %s\n\nExported %s\n", channelID, time.Now().UTC().Format("2006-01-02 15:04 UTC"))
+	for _, turn := range turns {
+		name := turn.Author
+		switch {
+		case turn.Role == "model":
+			name = "Assistant"
+		case name == "":
+			name = "User"
+		}
+		sb.WriteString("\n## " + name)
+		if turn.Time != nil {
+			sb.WriteString(" · " + turn.Time.UTC().Format("2006-01-02 15:04 UTC"))
+		}
+		sb.WriteString("\n\n" + turn.Text + "\n")
+		for _, attachment := range turn.Attachments {
+			fmt.Fprintf(&sb, "\n📎 [%s](%s)\n", attachment.Name, attachment.URL)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+// exportInteraction is /export run in "channel" with the given format
+func exportInteraction(format string) *discordgo.InteractionCreate {
+	i := commandInteraction("export")
+	i.ChannelID = "channel"
+	i.Data = discordgo.ApplicationCommandInteractionData{Name: "export", Options: []*discordgo.ApplicationCommandInteractionDataOption{stringOption("format", format)}}
+	return i
+}
+
+// exportedFile returns the file attached to the last interaction response edit
+func exportedFile(t *testing.T, session *fakeSession) (string, []byte) {
+	t.Helper()
+
+	if len(session.edits) == 0 || len(session.edits[len(session.edits)-1].Files) != 1 {
+		t.Fatalf("no exported file in %+v", session.edits)
+	}
+	file := session.edits[len(session.edits)-1].Files[0]
+	data, err := io.ReadAll(file.Reader)
+	if err != nil {
+		t.Fatalf("reading export: %v", err)
+	}
+	return file.Name, data
+}
+
+func TestExportCommand(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello there"}, {Text: "elsewhere"}}}
+	b, session := newTestBot(t, client)
+
+	m := userMessage("hi")
+	m.Attachments = []*discordgo.MessageAttachment{{Filename: "notes.txt", URL: "https://cdn.example/notes.txt", ContentType: "text/plain"}}
+	b.HandleMessage(m)
+	// Channels outside bot threads share a chat, but only this one is exported
+	other := userMessage("somewhere else")
+	other.ChannelID = "other"
+	b.HandleMessage(other)
+
+	b.HandleInteraction(exportInteraction("json"))
+	name, data := exportedFile(t, session)
+	if name != "conversation.json" {
+		t.Errorf("exported file %q, want conversation.json", name)
+	}
+	var export conversationExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		t.Fatalf("decoding export: %v", err)
+	}
+	if len(export.Messages) != 2 {
+		t.Fatalf("exported %d messages, want 2: %+v", len(export.Messages), export.Messages)
+	}
+	prompt, answer := export.Messages[0], export.Messages[1]
+	if prompt.Role != "user" || prompt.Author != "alice" || prompt.Text != "hi" || prompt.Time == nil {
+		t.Errorf("exported prompt %+v", prompt)
+	}
+	if len(prompt.Attachments) != 1 || prompt.Attachments[0].URL != "https://cdn.example/notes.txt" {
+		t.Errorf("exported attachments %+v", prompt.Attachments)
+	}
+	if answer.Role != "model" || answer.Text != "hello there" {
+		t.Errorf("exported answer %+v", answer)
+	}
+
+	b.HandleInteraction(exportInteraction("md"))
+	name, data = exportedFile(t, session)
+	if name != "conversation.md" {
+		t.Errorf("exported file %q, want conversation.md", name)
+	}
+	for _, want := range []string{"## alice", "hi", "## Assistant", "hello there", "📎 [notes.txt](https://cdn.example/notes.txt)"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Markdown export missing %q:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), "elsewhere") {
+		t.Errorf("Markdown export includes another channel:\n%s", data)
+	}
+}
+
+func TestExportCommandEmpty(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+
+	b.HandleInteraction(exportInteraction("md"))
+	if len(session.edits) != 1 || len(session.edits[0].Files) != 0 || !strings.Contains(*session.edits[0].Content, "no conversation") {
+		t.Errorf("edits %+v, want a note that there's nothing to export", session.edits)
+	}
+}
@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// Pages of a PDF transcribed per request, so long documents aren't cut
+	// off by the model's output limit
+	extractPagesPerRequest = 10
+
+	// Most pages transcribed when a PDF's pages can't be counted and the
+	// server sets no limit
+	maxExtractPages = 500
+
+	// What the model writes once it transcribed the last page
+	extractEndMarker = "<<END OF DOCUMENT>>"
+)
+
+// extractFormats are the files /extract can write, by format choice
+var extractFormats = map[string]struct {
+	contentType  string
+	instructions string
+}{
+	"txt": {"text/plain", "as plain text, without any Markdown"},
+	"md":  {"text/markdown", "as Markdown, keeping headings, lists and tables, with tables as Markdown tables"},
+}
+
+// extractCommand handles /extract, transcribing the full text of a PDF or
+// other document into a .txt or .md file rather than summarizing it. The
+// document is uploaded once and PDFs are transcribed a few pages per
+// request, so the text of long documents isn't cut off.
+func (b *Bot) extractCommand(i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	attachment := data.Resolved.Attachments[commandOption(data.Options, "file").Value.(string)]
+	format := "md"
+	if option := commandOption(data.Options, "format"); option != nil {
+		format = option.StringValue()
+	}
+
+	contentType, _, _ := mime.ParseMediaType(attachment.ContentType)
+	if contentType != "application/pdf" && !strings.HasPrefix(contentType, "text/") {
+		b.respondEphemeral(i, tr(i, "%s isn't a PDF or text document.", attachment.Filename))
+		return
+	}
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to extract command", "error", err)
+		return
+	}
+
+	document, err := downloadAttachment(attachment)
+	if err != nil {
+		interactionLogger(i).Warn("Error reading document", "file", attachment.Filename, "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, I couldn't read %s: %v", attachment.Filename, err))
+		return
+	}
+	pages := 0
+	if contentType == "application/pdf" {
+		pages = pdfPages(document)
+		if _, limit := b.attachmentLimits(b.guildSettings(i.GuildID)); limit > 0 && pages > limit {
+			b.editInteractionResponse(i, tr(i, "%s has %d pages, more than the %d this server allows.", attachment.Filename, pages, limit))
+			return
+		}
+	}
+
+	part, err := b.aiFor(i.GuildID).UploadFile(b.ctx, document, contentType, attachment.Filename)
+	if err != nil {
+		interactionLogger(i).Error("Error uploading document", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	text, err := b.extractText(i, part, contentType, pages, extractFormats[format].instructions)
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if text == "" {
+		b.editInteractionResponse(i, tr(i, "I couldn't find any text in %s.", attachment.Filename))
+		return
+	}
+
+	name := strings.TrimSuffix(attachment.Filename, path.Ext(attachment.Filename)) + "." + format
+	content := tr(i, "📄 The full text of **%s** is attached (%d characters).", attachment.Filename, len([]rune(text)))
+	_, err = b.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:         &content,
+		Files:           []*discordgo.File{{Name: name, ContentType: extractFormats[format].contentType, Reader: strings.NewReader(text + "\n")}},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error sending extracted text", "error", err)
+		return
+	}
+	interactionLogger(i).Info("Extracted document", "file", attachment.Filename, "pages", pages, "characters", len([]rune(text)))
+}
+
+// extractText transcribes an uploaded document. A PDF is transcribed
+// extractPagesPerRequest pages at a time, up to its pages when they could be
+// counted, else until the model says it reached the end; other documents in
+// one request.
+func (b *Bot) extractText(i *discordgo.InteractionCreate, part genai.Part, contentType string, pages int, instructions string) (string, error) {
+	prompt := "Transcribe the full text of this document " + instructions + ", exactly as written and in its original language. " +
+		"Don't summarize, translate, correct or leave anything out, and add no commentary of your own."
+	if contentType != "application/pdf" {
+		text, err := b.generate(interactionUserID(i), i.GuildID, part, genai.Text(prompt))
+		return strings.TrimSpace(text), err
+	}
+
+	last := pages
+	if last == 0 {
+		last = maxExtractPages
+		if _, limit := b.attachmentLimits(b.guildSettings(i.GuildID)); limit > 0 {
+			last = limit
+		}
+	}
+	var sections []string
+	for page := 1; page <= last; page += extractPagesPerRequest {
+		end := min(page+extractPagesPerRequest-1, last)
+		if page > 1 {
+			b.editInteractionResponse(i, tr(i, "Transcribing pages %d to %d…", page, end))
+		}
+		request := fmt.Sprintf("%s\n\nTranscribe only pages %d to %d. If the document ends before page %d, stop at its last page "+
+			"and then write %s on a line of its own; if it has no page %d, answer only %s.", prompt, page, end, end, extractEndMarker, page, extractEndMarker)
+		text, err := b.generate(interactionUserID(i), i.GuildID, part, genai.Text(request))
+		if err != nil {
+			return "", err
+		}
+		text, _, ended := strings.Cut(text, extractEndMarker)
+		if text = strings.TrimSpace(text); text != "" {
+			sections = append(sections, text)
+		}
+		if ended {
+			break
+		}
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
@@ -0,0 +1,62 @@
+package bot
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestExtractCommand(t *testing.T) {
+	document := "%PDF-1.4\n" + strings.Repeat("<< /Type /Page >>\n", 12)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(document))
+	}))
+	defer server.Close()
+
+	client := &fakeAI{text: "# Report\n\nSome text."}
+	b, session := newTestBot(t, client)
+	extract := func(name, contentType string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+		i := commandInteraction("extract")
+		i.Data = discordgo.ApplicationCommandInteractionData{
+			Name:    "extract",
+			Options: append([]*discordgo.ApplicationCommandInteractionDataOption{{Name: "file", Type: discordgo.ApplicationCommandOptionAttachment, Value: "file"}}, options...),
+			Resolved: &discordgo.ApplicationCommandInteractionDataResolved{Attachments: map[string]*discordgo.MessageAttachment{
+				"file": {ID: "file", Filename: name, ContentType: contentType, URL: server.URL},
+			}},
+		}
+		return i
+	}
+
+	// Twelve pages take two requests of ten pages
+	b.HandleInteraction(extract("report.pdf", "application/pdf"))
+	if len(client.prompts) != 2 || !strings.Contains(partsText(client.prompts[1]), "Transcribe only pages 11 to 12.") {
+		t.Fatalf("prompts = %q, want the pages in two batches", client.prompts)
+	}
+	edit := session.edits[len(session.edits)-1]
+	if len(edit.Files) != 1 || edit.Files[0].Name != "report.md" {
+		t.Fatalf("edit = %+v, want the text attached as report.md", edit)
+	}
+	if text, _ := io.ReadAll(edit.Files[0].Reader); string(text) != "# Report\n\nSome text.\n\n# Report\n\nSome text.\n" {
+		t.Errorf("file = %q, want the text of both batches", text)
+	}
+
+	// Without a page count the model says where the document ends
+	document = "%PDF-1.4\ncompressed"
+	client.text, client.prompts = "Plain text.\n<<END OF DOCUMENT>>", nil
+	b.HandleInteraction(extract("notes.pdf", "application/pdf", stringOption("format", "txt")))
+	if len(client.prompts) != 1 {
+		t.Errorf("sent %d prompts, want the extraction to stop at the end", len(client.prompts))
+	}
+	if edit := session.edits[len(session.edits)-1]; len(edit.Files) != 1 || edit.Files[0].Name != "notes.txt" || edit.Files[0].ContentType != "text/plain" {
+		t.Errorf("edit = %+v, want notes.txt", edit)
+	}
+
+	b.HandleInteraction(extract("cat.png", "image/png"))
+	if got := session.responses[len(session.responses)-1].Data.Content; got != "cat.png isn't a PDF or text document." {
+		t.Errorf("response = %q, want the image refused", got)
+	}
+}
@@ -0,0 +1,463 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/config"
+	"go-discord-bot/store"
+)
+
+// botUserID is the ID of the bot user in tests
+const botUserID = "bot"
+
+// fakeSession records what the bot sends to Discord. Methods the tests don't
+// expect to be called panic through the nil embedded Session.
+type fakeSession struct {
+	Session
+
+	mu           sync.Mutex
+	messages     []string
+	reactions    []string
+	responses    []*discordgo.InteractionResponse
+	edits        []*discordgo.WebhookEdit
+	channels     map[string]*discordgo.Channel
+	threadsStart int
+	guilds       []*discordgo.Guild
+	left         []string
+	files        map[string][]byte
+	deleted      []string
+	pinned       []string
+	typing       int
+	embeds       []*discordgo.MessageEmbed
+	mentions     []*discordgo.MessageAllowedMentions
+	presences    []discordgo.UpdateStatusData
+	polls        []*Poll
+
+	// Scheduled events of the guild, by ID
+	events map[string]*discordgo.GuildScheduledEvent
+
+	// Message history of channels, newest first
+	history map[string][]*discordgo.Message
+
+	// Permissions of users in every channel, by default viewing and posting
+	permissions map[string]int64
+}
+
+func newFakeSession() *fakeSession {
+	return &fakeSession{channels: map[string]*discordgo.Channel{}, files: map[string][]byte{}, history: map[string][]*discordgo.Message{}, events: map[string]*discordgo.GuildScheduledEvent{}}
+}
+
+func (s *fakeSession) BotUserID() string {
+	return botUserID
+}
+
+func (s *fakeSession) Channel(channelID string, _ ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if channel, ok := s.channels[channelID]; ok {
+		return channel, nil
+	}
+	return &discordgo.Channel{ID: channelID, Type: discordgo.ChannelTypeGuildText}, nil
+}
+
+func (s *fakeSession) ChannelTyping(string, ...discordgo.RequestOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.typing++
+	return nil
+}
+
+func (s *fakeSession) ChannelMessages(channelID string, limit int, beforeID, _, _ string, _ ...discordgo.RequestOption) ([]*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := s.history[channelID]
+	if beforeID != "" {
+		for n, m := range history {
+			if m.ID == beforeID {
+				history = history[n+1:]
+				break
+			}
+		}
+	}
+	return history[:min(limit, len(history))], nil
+}
+
+func (s *fakeSession) ChannelMessage(channelID, messageID string, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range s.history[channelID] {
+		if m.ID == messageID {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown message %q", messageID)
+}
+
+func (s *fakeSession) ChannelMessageSend(channelID string, content string, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, content)
+	return &discordgo.Message{ID: fmt.Sprintf("sent-%d", len(s.messages)-1), ChannelID: channelID, Content: content}, nil
+}
+
+func (s *fakeSession) ChannelMessageEditComplex(edit *discordgo.MessageEdit, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	if _, err := fmt.Sscanf(edit.ID, "sent-%d", &n); err != nil || n >= len(s.messages) {
+		return nil, fmt.Errorf("unknown message %q", edit.ID)
+	}
+	s.messages[n] = *edit.Content
+	for _, file := range edit.Files {
+		data, err := io.ReadAll(file.Reader)
+		if err != nil {
+			return nil, err
+		}
+		s.files[edit.Channel+"/"+file.Name] = data
+	}
+	return &discordgo.Message{ID: edit.ID, ChannelID: edit.Channel, Content: *edit.Content}, nil
+}
+
+func (s *fakeSession) ChannelMessageDelete(_, messageID string, _ ...discordgo.RequestOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleted = append(s.deleted, messageID)
+	return nil
+}
+
+func (s *fakeSession) ChannelMessagePin(_, messageID string, _ ...discordgo.RequestOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pinned = append(s.pinned, messageID)
+	return nil
+}
+
+func (s *fakeSession) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	for _, file := range data.Files {
+		if _, err := s.ChannelFileSend(channelID, file.Name, file.Reader); err != nil {
+			return nil, err
+		}
+	}
+	s.mu.Lock()
+	s.embeds = append(s.embeds, data.Embeds...)
+	s.mentions = append(s.mentions, data.AllowedMentions)
+	s.mu.Unlock()
+	return s.ChannelMessageSend(channelID, data.Content)
+}
+
+func (s *fakeSession) ChannelPollSend(channelID string, poll *Poll) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.polls = append(s.polls, poll)
+	return &discordgo.Message{ID: fmt.Sprintf("poll-%d", len(s.polls)), ChannelID: channelID}, nil
+}
+
+func (s *fakeSession) ChannelFileSend(channelID, name string, r io.Reader, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[channelID+"/"+name] = data
+	return &discordgo.Message{ID: "sent", ChannelID: channelID}, nil
+}
+
+func (s *fakeSession) UserChannelCreate(recipientID string, _ ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	return &discordgo.Channel{ID: "dm-" + recipientID, Type: discordgo.ChannelTypeDM}, nil
+}
+
+func (s *fakeSession) MessageThreadStartComplex(channelID, messageID string, data *discordgo.ThreadStart, _ ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.threadsStart++
+	thread := &discordgo.Channel{ID: messageID, ParentID: channelID, Name: data.Name, Type: discordgo.ChannelTypeGuildPublicThread}
+	s.channels[thread.ID] = thread
+	return thread, nil
+}
+
+func (s *fakeSession) ChannelEdit(channelID string, data *discordgo.ChannelEdit, _ ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channel, ok := s.channels[channelID]
+	if !ok {
+		channel = &discordgo.Channel{ID: channelID, Type: discordgo.ChannelTypeGuildText}
+		s.channels[channelID] = channel
+	}
+	if data.Name != "" {
+		channel.Name = data.Name
+	}
+	if data.Topic != "" {
+		channel.Topic = strings.TrimSpace(data.Topic)
+	}
+	return channel, nil
+}
+
+func (s *fakeSession) MessageReactionAdd(_, _, emojiID string, _ ...discordgo.RequestOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reactions = append(s.reactions, emojiID)
+	return nil
+}
+
+func (s *fakeSession) InteractionRespond(_ *discordgo.Interaction, resp *discordgo.InteractionResponse, _ ...discordgo.RequestOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses = append(s.responses, resp)
+	return nil
+}
+
+func (s *fakeSession) InteractionResponseEdit(_ *discordgo.Interaction, edit *discordgo.WebhookEdit, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.edits = append(s.edits, edit)
+	return &discordgo.Message{ID: "response"}, nil
+}
+
+func (s *fakeSession) UpdateStatusComplex(data discordgo.UpdateStatusData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.presences = append(s.presences, data)
+	return nil
+}
+
+func (s *fakeSession) Guilds() []*discordgo.Guild {
+	return s.guilds
+}
+
+func (s *fakeSession) Guild(guildID string, _ ...discordgo.RequestOption) (*discordgo.Guild, error) {
+	for _, guild := range s.guilds {
+		if guild.ID == guildID {
+			return guild, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown guild %q", guildID)
+}
+
+func (s *fakeSession) GuildScheduledEvent(_, eventID string, _ bool, _ ...discordgo.RequestOption) (*discordgo.GuildScheduledEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event, ok := s.events[eventID]; ok {
+		return event, nil
+	}
+	return nil, fmt.Errorf("unknown event %q", eventID)
+}
+
+func (s *fakeSession) GuildScheduledEventCreate(guildID string, params *discordgo.GuildScheduledEventParams, _ ...discordgo.RequestOption) (*discordgo.GuildScheduledEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event := &discordgo.GuildScheduledEvent{
+		ID:                 fmt.Sprintf("event-%d", len(s.events)),
+		GuildID:            guildID,
+		ChannelID:          params.ChannelID,
+		Name:               params.Name,
+		Description:        params.Description,
+		ScheduledStartTime: *params.ScheduledStartTime,
+		ScheduledEndTime:   params.ScheduledEndTime,
+		Status:             discordgo.GuildScheduledEventStatusScheduled,
+		EntityType:         params.EntityType,
+	}
+	if params.EntityMetadata != nil {
+		event.EntityMetadata = *params.EntityMetadata
+	}
+	s.events[event.ID] = event
+	return event, nil
+}
+
+func (s *fakeSession) GuildLeave(guildID string, _ ...discordgo.RequestOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.left = append(s.left, guildID)
+	return nil
+}
+
+func (s *fakeSession) UserChannelPermissions(userID string, _ string, _ ...discordgo.RequestOption) (int64, error) {
+	if permissions, ok := s.permissions[userID]; ok {
+		return permissions, nil
+	}
+	return discordgo.PermissionViewChannel | discordgo.PermissionSendMessages, nil
+}
+
+// fakeAI answers every request from canned values. Methods the tests don't
+// expect to be called panic through the nil embedded Client.
+type fakeAI struct {
+	ai.Client
+
+	// Replies returned by chats, in order; the last one repeats
+	replies []*ai.Reply
+	err     error
+
+	text   string
+	vector []float32
+
+	// Speech returned by Speak, which is unsupported when unset
+	audio []byte
+
+	// Tokens counted for any parts, 1 when unset
+	tokens int
+
+	// Prompts sent to Generate, which may be called at once
+	mu      sync.Mutex
+	prompts [][]genai.Part
+
+	chats []*fakeChat
+}
+
+func (f *fakeAI) NewChat() ai.Chat {
+	chat := &fakeChat{ai: f}
+	f.chats = append(f.chats, chat)
+	return chat
+}
+
+func (f *fakeAI) Generate(_ context.Context, parts ...genai.Part) (*ai.Reply, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.prompts = append(f.prompts, parts)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &ai.Reply{Text: f.text}, nil
+}
+
+func (f *fakeAI) GenerateJSON(ctx context.Context, _ *genai.Schema, parts ...genai.Part) (*ai.Reply, error) {
+	return f.Generate(ctx, parts...)
+}
+
+func (f *fakeAI) GenerateStream(ctx context.Context, onText func(text string), parts ...genai.Part) (*ai.Reply, error) {
+	reply, err := f.Generate(ctx, parts...)
+	if err == nil && reply.Text != "" {
+		onText(reply.Text)
+	}
+	return reply, err
+}
+
+func (f *fakeAI) EditImage(_ context.Context, images []ai.Image, instruction string) (*ai.Reply, []ai.Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.prompts = append(f.prompts, []genai.Part{genai.Text(instruction)})
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+	return &ai.Reply{Text: f.text, PromptTokens: 20, ResponseTokens: 4}, images, nil
+}
+
+func (f *fakeAI) Speak(context.Context, string) ([]byte, error) {
+	if f.audio == nil {
+		return nil, ai.ErrUnsupported
+	}
+	return f.audio, nil
+}
+
+func (f *fakeAI) CountTokens(context.Context, ...genai.Part) (int, error) {
+	return max(f.tokens, 1), nil
+}
+
+func (f *fakeAI) UploadFile(_ context.Context, _ []byte, _ string, displayName string) (genai.Part, error) {
+	return genai.Text("[uploaded " + displayName + "]"), nil
+}
+
+func (f *fakeAI) EmbedDocuments(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for n := range texts {
+		vectors[n] = f.vector
+	}
+	return vectors, nil
+}
+
+func (f *fakeAI) EmbedQuery(context.Context, string) ([]float32, error) {
+	return f.vector, nil
+}
+
+// fakeChat records the messages sent to it
+type fakeChat struct {
+	ai      *fakeAI
+	sent    [][]genai.Part
+	history []*genai.Content
+}
+
+func (c *fakeChat) Send(_ context.Context, parts ...genai.Part) (*ai.Reply, error) {
+	c.sent = append(c.sent, parts)
+	if c.ai.err != nil {
+		return nil, c.ai.err
+	}
+	reply := c.ai.replies[min(len(c.sent), len(c.ai.replies))-1]
+	c.history = append(c.history,
+		&genai.Content{Role: "user", Parts: parts},
+		&genai.Content{Role: "model", Parts: []genai.Part{genai.Text(reply.Text)}},
+	)
+	return reply, nil
+}
+
+func (c *fakeChat) History() []*genai.Content {
+	return c.history
+}
+
+func (c *fakeChat) SetHistory(history []*genai.Content) {
+	c.history = history
+}
+
+// newTestBot returns a bot using fakes and a fresh database
+func newTestBot(t *testing.T, client ai.Client) (*Bot, *fakeSession) {
+	t.Helper()
+
+	st, err := store.Open(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	cfg := &config.Config{DefaultProvider: ProviderGemini, ImagineDailyLimit: 10, HistoryTokenBudget: 100000}
+	session := newFakeSession()
+	return New(context.Background(), cfg, session, client, st), session
+}
+
+// userMessage returns a message sent by a user in a server channel
+func userMessage(content string) *discordgo.MessageCreate {
+	return &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:        "message",
+		ChannelID: "channel",
+		GuildID:   "guild",
+		Content:   content,
+		Author:    &discordgo.User{ID: "user", Username: "alice"},
+	}}
+}
+
+// allowLocalFetch lets fetchDocument reach test servers on the loopback
+// address for the rest of the test
+func allowLocalFetch(t *testing.T) {
+	fetchableAddress = func(net.IP) bool { return true }
+	t.Cleanup(func() { fetchableAddress = publicAddress })
+}
@@ -0,0 +1,262 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/store"
+)
+
+const (
+	// Custom ID prefix of the 👍/👎 buttons on answers, followed by "up" or
+	// "down", and by the variant that wrote the answer during a persona test
+	feedbackPrefix = "feedback:"
+
+	// Number of recent answers whose prompt is remembered for their votes
+	maxFeedbackExchanges = 500
+
+	// Weeks of votes /feedback report shows, and most votes /feedback export
+	// attaches
+	feedbackReportWeeks = 8
+	maxFeedbackExport   = 5000
+)
+
+// feedbackExchange is the prompt, its author and the response of an answer
+// with 👍/👎 buttons, kept for the votes on it
+type feedbackExchange struct {
+	askerID  string
+	prompt   string
+	response string
+}
+
+// exportedFeedback is a vote in /feedback export, a line of JSON each
+type exportedFeedback struct {
+	Prompt   string    `json:"prompt"`
+	Response string    `json:"response"`
+	Vote     string    `json:"vote"`
+	Time     time.Time `json:"time"`
+}
+
+// feedbackButtons returns the 👍/👎 buttons of an answer, with the variant of
+// the persona test that wrote it if any
+func feedbackButtons(variant string) []discordgo.MessageComponent {
+	suffix := ""
+	if variant != "" {
+		suffix = ":" + variant
+	}
+	return []discordgo.MessageComponent{
+		discordgo.Button{
+			CustomID: feedbackPrefix + "up" + suffix,
+			Style:    discordgo.SecondaryButton,
+			Emoji:    &discordgo.ComponentEmoji{Name: "👍"},
+		},
+		discordgo.Button{
+			CustomID: feedbackPrefix + "down" + suffix,
+			Style:    discordgo.SecondaryButton,
+			Emoji:    &discordgo.ComponentEmoji{Name: "👎"},
+		},
+	}
+}
+
+// rememberFeedbackExchange keeps the prompt, who asked it and the response
+// of an answer sent as the messages replyIDs, for the votes on its last
+// message, which has the buttons. The oldest are forgotten once the cache
+// is full.
+func (b *Bot) rememberFeedbackExchange(replyIDs []string, askerID string, prompt string, response string) {
+	if len(replyIDs) == 0 {
+		return
+	}
+	messageID := replyIDs[len(replyIDs)-1]
+
+	b.feedbackMu.Lock()
+	defer b.feedbackMu.Unlock()
+
+	// An edited answer keeps its place
+	if _, ok := b.feedback[messageID]; !ok {
+		b.feedbackOrder = append(b.feedbackOrder, messageID)
+	}
+	b.feedback[messageID] = feedbackExchange{askerID: askerID, prompt: prompt, response: response}
+	if len(b.feedbackOrder) > maxFeedbackExchanges {
+		delete(b.feedback, b.feedbackOrder[0])
+		b.feedbackOrder = b.feedbackOrder[1:]
+	}
+}
+
+// feedbackButton handles the 👍/👎 buttons of answers, saving the member's
+// vote with the prompt, its author and the response, so /mydata and
+// /forgetme cover it for both of them, and counting it for the persona test
+// that wrote the answer
+func (b *Bot) feedbackButton(i *discordgo.InteractionCreate) {
+	direction, variant, _ := strings.Cut(strings.TrimPrefix(i.MessageComponentData().CustomID, feedbackPrefix), ":")
+	up := direction == "up"
+
+	b.feedbackMu.Lock()
+	exchange, ok := b.feedback[i.Message.ID]
+	b.feedbackMu.Unlock()
+	if !ok {
+		// Forgotten since, the response is at least the message's text
+		exchange.response = i.Message.Content
+		if exchange.response == "" && len(i.Message.Embeds) > 0 {
+			exchange.response = i.Message.Embeds[0].Description
+		}
+	}
+
+	err := b.store.RecordFeedback(store.Feedback{
+		GuildID:   i.GuildID,
+		ChannelID: i.ChannelID,
+		MessageID: i.Message.ID,
+		UserID:    interactionUserID(i),
+		Up:        up,
+		Prompt:    exchange.prompt,
+		Response:  exchange.response,
+		CreatedAt: time.Now(),
+		AskerID:   exchange.askerID,
+	})
+	if err == nil && variant != "" {
+		err = b.recordPersonaVote(i, variant, up)
+	}
+	if err != nil {
+		interactionLogger(i).Error("Error saving feedback", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	interactionLogger(i).Info("Saved feedback", "up", up)
+	b.respondEphemeral(i, tr(i, "Thanks for your feedback!"))
+}
+
+// feedbackCommand handles /feedback report and export, which show admins
+// how members rate the bot's answers
+func (b *Bot) feedbackCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Feedback is only collected in servers."))
+		return
+	}
+	if i.Member == nil || i.Member.Permissions&discordgo.PermissionManageServer == 0 {
+		b.respondEphemeral(i, tr(i, "You need the Manage Server permission to see feedback."))
+		return
+	}
+
+	switch i.ApplicationCommandData().Options[0].Name {
+	case "report":
+		b.feedbackReport(i)
+	case "export":
+		b.feedbackExport(i)
+	}
+}
+
+// feedbackReport shows the share of 👍 in the votes of the last weeks, week
+// by week, so trends stand out
+func (b *Bot) feedbackReport(i *discordgo.InteractionCreate) {
+	// Weeks start on the day of the week it is, so the last one is complete
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	start := today.AddDate(0, 0, 1-7*feedbackReportWeeks)
+	days, err := b.store.FeedbackByDay(i.GuildID, start)
+	if err != nil {
+		interactionLogger(i).Error("Error loading feedback", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if len(days) == 0 {
+		b.respondEphemeral(i, tr(i, "No one voted on the bot's answers in the last %d weeks.", feedbackReportWeeks))
+		return
+	}
+
+	weeks := make([]store.FeedbackDay, feedbackReportWeeks)
+	var total store.FeedbackDay
+	for _, day := range days {
+		date, err := time.Parse(time.DateOnly, day.Day)
+		if err != nil {
+			continue
+		}
+		n := int(date.Sub(start) / (7 * 24 * time.Hour))
+		if n < 0 || n >= len(weeks) {
+			continue
+		}
+		week := &weeks[n]
+		week.Up += day.Up
+		week.Down += day.Down
+		total.Up += day.Up
+		total.Down += day.Down
+	}
+
+	var lines []string
+	for n, week := range weeks {
+		votes := tr(i, "no votes")
+		if week.Up+week.Down > 0 {
+			votes = fmt.Sprintf("%s %d 👍 %d 👎", satisfactionBar(week), week.Up, week.Down)
+		}
+		lines = append(lines, fmt.Sprintf("`%s` %s", start.AddDate(0, 0, 7*n).Format("Jan 02"), votes))
+	}
+	embed := &discordgo.MessageEmbed{
+		Title: tr(i, "Feedback of the last %d weeks", feedbackReportWeeks),
+		Description: tr(i, "**%d%%** of %d votes were 👍.", 100*total.Up/(total.Up+total.Down), total.Up+total.Down) +
+			"\n\n" + strings.Join(lines, "\n"),
+		Color: embedColor,
+	}
+	err = b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{embed},
+			Flags:  discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to feedback command", "error", err)
+	}
+}
+
+// satisfactionBar draws the share of 👍 in a week's votes out of ten blocks,
+// followed by the percentage
+func satisfactionBar(week store.FeedbackDay) string {
+	share := 100 * week.Up / (week.Up + week.Down)
+	return strings.Repeat("▰", share/10) + strings.Repeat("▱", 10-share/10) + fmt.Sprintf(" %3d%%", share)
+}
+
+// feedbackExport attaches the guild's latest votes with their prompts and
+// responses as JSON Lines, for tuning the persona and prompts
+func (b *Bot) feedbackExport(i *discordgo.InteractionCreate) {
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to feedback command", "error", err)
+		return
+	}
+	feedback, err := b.store.GuildFeedback(i.GuildID, maxFeedbackExport)
+	if err != nil {
+		interactionLogger(i).Error("Error loading feedback", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if len(feedback) == 0 {
+		b.editInteractionResponse(i, tr(i, "No one voted on the bot's answers yet."))
+		return
+	}
+
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	for _, f := range feedback {
+		vote := "down"
+		if f.Up {
+			vote = "up"
+		}
+		if err := encoder.Encode(exportedFeedback{Prompt: f.Prompt, Response: f.Response, Vote: vote, Time: f.CreatedAt.UTC()}); err != nil {
+			interactionLogger(i).Error("Error encoding feedback", "error", err)
+			b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+	}
+
+	content := tr(i, "Exported the latest %d votes.", len(feedback))
+	_, err = b.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &content,
+		Files:   []*discordgo.File{{Name: "feedback.jsonl", ContentType: "application/jsonl", Reader: &data}},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error sending feedback export", "error", err)
+		return
+	}
+	interactionLogger(i).Info("Exported feedback", "votes", len(feedback))
+}
@@ -0,0 +1,64 @@
+package bot
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// feedbackInteraction runs a /feedback subcommand
+func feedbackInteraction(permissions int64, subcommand string) *discordgo.InteractionCreate {
+	i := promptInteraction("alice", permissions, subcommand)
+	data := i.Data.(discordgo.ApplicationCommandInteractionData)
+	data.Name = "feedback"
+	i.Data = data
+	return i
+}
+
+func TestFeedback(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+
+	if got := responseButtons(false, false, ""); len(got) != 0 {
+		t.Errorf("buttons = %v, want none without feedback", got)
+	}
+	b.rememberFeedbackExchange([]string{"sent-0", "answer"}, "alice", "Name a color", "Blue")
+	b.HandleInteraction(personaVoteInteraction("bob", feedbackPrefix+"down"))
+	b.HandleInteraction(personaVoteInteraction("carol", feedbackPrefix+"up"))
+	if len(session.responses) != 2 || session.responses[1].Data.Content != "Thanks for your feedback!" {
+		t.Fatalf("responses = %v, want thanks for each vote", session.responses)
+	}
+
+	session.responses = nil
+	b.HandleInteraction(feedbackInteraction(0, "report"))
+	b.HandleInteraction(feedbackInteraction(discordgo.PermissionManageServer, "report"))
+	if len(session.responses) != 2 || !strings.Contains(session.responses[0].Data.Content, "Manage Server") {
+		t.Fatalf("responses = %v, want a refusal then the report", session.responses)
+	}
+	report := session.responses[1].Data.Embeds[0]
+	if !strings.HasPrefix(report.Description, "**50%** of 2 votes were 👍.") || !strings.Contains(report.Description, "▰▰▰▰▰▱▱▱▱▱  50% 1 👍 1 👎") {
+		t.Errorf("report = %q, want half of the votes up this week", report.Description)
+	}
+
+	b.HandleInteraction(feedbackInteraction(discordgo.PermissionManageServer, "export"))
+	if len(session.edits) != 1 || len(session.edits[0].Files) != 1 {
+		t.Fatalf("edits = %v, want the export attached", session.edits)
+	}
+	data, err := io.ReadAll(session.edits[0].Files[0].Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("export = %q, want a line per vote", data)
+	}
+	var vote exportedFeedback
+	if err := json.Unmarshal([]byte(lines[0]), &vote); err != nil {
+		t.Fatal(err)
+	}
+	if vote.Prompt != "Name a color" || vote.Response != "Blue" {
+		t.Errorf("vote = %+v, want the prompt and response of the answer", vote)
+	}
+}
@@ -0,0 +1,173 @@
+package bot
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+)
+
+const (
+	// Custom ID of a suggested follow-up question's button, followed by its
+	// position; the question is the button's label
+	followUpPrefix = "followup:"
+
+	// Most follow-up questions suggested under an answer
+	maxFollowUps = 3
+
+	// Longest label Discord allows on a button, and so the longest follow-up
+	// question suggested
+	maxButtonLabelLength = 80
+
+	// Starts the line the model ends its answer with, listing the follow-up
+	// questions as a JSON array
+	followUpMarker = "FOLLOW-UPS:"
+)
+
+// followUpInstruction asks the model to suggest follow-up questions after its
+// answer, in a form takeFollowUps reads back
+const followUpInstruction = "After your answer, on a last line of its own, write " + followUpMarker +
+	" followed by a JSON array of up to three short questions the member might ask you next, " +
+	"each under 80 characters and in the language of your answer. Write nothing after that line."
+
+// withFollowUps adds the instruction to suggest follow-up questions to a
+// message's parts, when FOLLOW_UP_BUTTONS is on
+func (b *Bot) withFollowUps(parts []genai.Part) []genai.Part {
+	if !b.config().FollowUpButtons {
+		return parts
+	}
+	return append(parts, genai.Text(followUpInstruction))
+}
+
+// takeFollowUps removes the follow-up questions the model suggested from the
+// end of its reply, and from the chat's history, and returns them. Replies
+// without them are left as they are.
+func takeFollowUps(chat ai.Chat, reply *ai.Reply) []string {
+	text, questions := splitFollowUps(reply.Text)
+	if text == reply.Text {
+		return nil
+	}
+	reply.Text = text
+
+	history := chat.History()
+	if len(history) > 0 && history[len(history)-1].Role == "model" {
+		last := *history[len(history)-1]
+		last.Parts = []genai.Part{genai.Text(text)}
+		chat.SetHistory(append(history[:len(history)-1:len(history)-1], &last))
+	}
+	return questions
+}
+
+// splitFollowUps splits the follow-up questions off the end of an answer,
+// keeping those short enough to be a button's label
+func splitFollowUps(text string) (string, []string) {
+	index := strings.LastIndex(text, followUpMarker)
+	if index < 0 || strings.Contains(text[index:], "\n\n") {
+		return text, nil
+	}
+	var suggested []string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(text[index+len(followUpMarker):])), &suggested); err != nil {
+		return text, nil
+	}
+
+	var questions []string
+	for _, question := range suggested {
+		question = strings.TrimSpace(question)
+		if question != "" && len([]rune(question)) <= maxButtonLabelLength && len(questions) < maxFollowUps {
+			questions = append(questions, question)
+		}
+	}
+	return strings.TrimSpace(text[:index]), questions
+}
+
+// followUpButtons returns the row of buttons asking the suggested follow-up
+// questions, none without any
+func followUpButtons(questions []string) []discordgo.MessageComponent {
+	if len(questions) == 0 {
+		return nil
+	}
+	buttons := make([]discordgo.MessageComponent, len(questions))
+	for n, question := range questions {
+		buttons[n] = discordgo.Button{CustomID: followUpPrefix + strconv.Itoa(n), Label: question, Style: discordgo.SecondaryButton}
+	}
+	return []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}}
+}
+
+// followUpButton handles the button of a suggested follow-up question,
+// posting it as the member's question and answering it as their next message
+func (b *Bot) followUpButton(i *discordgo.InteractionCreate) {
+	var question string
+	if i.Message != nil {
+		question = buttonLabel(i.Message.Components, i.MessageComponentData().CustomID)
+	}
+	if question == "" {
+		b.respondEphemeral(i, tr(i, "This suggestion isn't available anymore."))
+		return
+	}
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to follow-up button", "error", err)
+		return
+	}
+
+	// The answer needs a message to reply to, and to start a thread on
+	user := interactionUser(i)
+	asked, err := b.session.ChannelMessageSendComplex(i.ChannelID, &discordgo.MessageSend{
+		Content:         b.trGuild(i.GuildID, "<@%s> asked: %s", user.ID, question),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error sending follow-up question", "error", err)
+		return
+	}
+	interactionLogger(i).Info("Asked follow-up question")
+
+	m := &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:        asked.ID,
+		ChannelID: i.ChannelID,
+		GuildID:   i.GuildID,
+		Content:   question,
+		Author:    user,
+		Member:    i.Member,
+		Timestamp: time.Now(),
+	}}
+	t := b.takeTicket(i.ChannelID)
+	defer b.releaseTicket(t)
+	t.wait()
+	settings := b.guildSettings(i.GuildID)
+	if b.rateLimited(m, settings) {
+		return
+	}
+	b.answerMessage(m, settings)
+}
+
+// buttonLabel returns the label of the button with a custom ID among a
+// message's components, empty when there's none
+func buttonLabel(components []discordgo.MessageComponent, customID string) string {
+	for _, component := range components {
+		switch component := component.(type) {
+		case *discordgo.ActionsRow:
+			if label := buttonLabel(component.Components, customID); label != "" {
+				return label
+			}
+		case discordgo.ActionsRow:
+			if label := buttonLabel(component.Components, customID); label != "" {
+				return label
+			}
+		case *discordgo.Button:
+			if component.CustomID == customID {
+				return component.Label
+			}
+		case discordgo.Button:
+			if component.CustomID == customID {
+				return component.Label
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+func TestFollowUps(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{
+		{Text: "Goroutines are cheap threads.\nFOLLOW-UPS: [\"How do channels work?\", \"What is a WaitGroup?\"]"},
+		{Text: "Channels pass values between goroutines."},
+	}}
+	b, session := newTestBot(t, client)
+	b.config().FollowUpButtons = true
+
+	b.HandleMessage(userMessage("what is a goroutine?"))
+	chat := client.chats[0]
+	if text := partsText(chat.sent[0]); !strings.Contains(text, followUpMarker) {
+		t.Errorf("prompt = %q, want follow-ups asked for", text)
+	}
+	if len(session.messages) != 1 || session.messages[0] != "Goroutines are cheap threads." {
+		t.Errorf("messages = %q, want the answer without its follow-ups", session.messages)
+	}
+	if text := partsText(chat.history[1].Parts); text != "Goroutines are cheap threads." {
+		t.Errorf("history = %q, want the follow-ups left out", text)
+	}
+
+	// Clicking one asks it as the member's next message
+	click := settingsInteraction(0, discordgo.MessageComponentInteractionData{CustomID: followUpPrefix + "0"})
+	click.Message = &discordgo.Message{ID: "sent-0", Components: followUpButtons([]string{"How do channels work?", "What is a WaitGroup?"})}
+	b.HandleInteraction(click)
+	if len(session.messages) != 3 || session.messages[1] != "<@admin> asked: How do channels work?" {
+		t.Fatalf("messages = %q, want the question posted and answered", session.messages)
+	}
+	if len(chat.sent) != 2 || !strings.Contains(partsText(chat.sent[1]), "How do channels work?") {
+		t.Errorf("sent = %v, want the question sent in the same conversation", chat.sent)
+	}
+}
+
+func TestSplitFollowUps(t *testing.T) {
+	long := strings.Repeat("why ", 25) + "?"
+	text, questions := splitFollowUps("Use a mutex.\n\nFOLLOW-UPS: [\"What is a RWMutex?\", \"" + long + "\", \"\", \"Is sync.Map faster?\", \"When to use atomics?\"]")
+	if text != "Use a mutex." || len(questions) != 3 || questions[0] != "What is a RWMutex?" || questions[1] != "Is sync.Map faster?" {
+		t.Errorf("split = %q, %q", text, questions)
+	}
+
+	// Answers mentioning the marker keep it
+	answer := "Lines starting with FOLLOW-UPS: are parsed.\n\nThat's all."
+	if text, questions := splitFollowUps(answer); text != answer || questions != nil {
+		t.Errorf("split = %q, %q, want the answer as it is", text, questions)
+	}
+}
@@ -0,0 +1,96 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+// forumPost returns the forum post a channel is, or nil when it isn't a
+// post in a forum channel
+func (b *Bot) forumPost(channelID string) *discordgo.Channel {
+	channel, err := b.session.Channel(channelID)
+	if err != nil || !channel.IsThread() || channel.ParentID == "" {
+		return nil
+	}
+	parent, err := b.session.Channel(channel.ParentID)
+	if err != nil || parent.Type != discordgo.ChannelTypeGuildForum {
+		return nil
+	}
+	return channel
+}
+
+// openingPost reports whether a message opens a forum post. A post shares
+// the ID of its opening message, like threads started on a message.
+func (b *Bot) openingPost(m *discordgo.Message) bool {
+	return m.GuildID != "" && m.ID == m.ChannelID && b.forumPost(m.ChannelID) != nil
+}
+
+// adoptForumPost gives a forum post a chat of its own the first time the
+// bot answers there, so each post is a separate conversation
+func (b *Bot) adoptForumPost(channelID string, guildID string) {
+	b.chatsMu.Lock()
+	_, ok := b.threadChats[channelID]
+	b.chatsMu.Unlock()
+	if ok || b.forumPost(channelID) == nil {
+		return
+	}
+
+	client := b.aiFor(guildID)
+	b.chatsMu.Lock()
+	defer b.chatsMu.Unlock()
+	if _, ok := b.threadChats[channelID]; !ok {
+		b.threadChats[channelID] = client.NewChat()
+	}
+}
+
+// tldrCommand handles /tldr, summarizing the forum post or thread it is
+// used in for everyone there
+func (b *Bot) tldrCommand(i *discordgo.InteractionCreate) {
+	channel, err := b.session.Channel(i.ChannelID)
+	if err != nil || !channel.IsThread() {
+		b.respondEphemeral(i, tr(i, "Use this command in a forum post or a thread."))
+		return
+	}
+
+	err = b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to tldr command", "error", err)
+		return
+	}
+
+	messages, err := b.channelMessagesSince(i.ChannelID, time.Time{})
+	if err != nil {
+		interactionLogger(i).Error("Error reading thread history", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if len(messages) == 0 {
+		b.editInteractionResponse(i, tr(i, "There's nothing to summarize here yet."))
+		return
+	}
+
+	kind := "thread"
+	if b.forumPost(i.ChannelID) != nil {
+		kind = "forum post"
+	}
+	var transcript strings.Builder
+	for _, m := range messages {
+		fmt.Fprintf(&transcript, "%s: %s\n", m.Author.Username, m.Content)
+	}
+	prompt := fmt.Sprintf("Write a TL;DR of the following Discord %s titled %q in three to five sentences, "+
+		"covering what it asks or is about, the main answers and any conclusion.\n\n%s", kind, channel.Name,
+		b.untrusted(interactionUserID(i), i.GuildID, "the "+kind+"'s messages", transcript.String()))
+	summary, err := b.generate(interactionUserID(i), i.GuildID, genai.Text(prompt))
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	b.editInteractionResponseLong(i, "📌 **TL;DR**\n"+summary, 0)
+}
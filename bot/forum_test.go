@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/store"
+)
+
+// addForum adds a forum channel with two posts to a fake session
+func addForum(session *fakeSession) {
+	session.channels["forum"] = &discordgo.Channel{ID: "forum", Type: discordgo.ChannelTypeGuildForum}
+	session.channels["post"] = &discordgo.Channel{ID: "post", ParentID: "forum", Name: "Help with Go", Type: discordgo.ChannelTypeGuildPublicThread}
+	session.channels["other-post"] = &discordgo.Channel{ID: "other-post", ParentID: "forum", Name: "Rust question", Type: discordgo.ChannelTypeGuildPublicThread}
+}
+
+// openingPost returns the message opening a forum post
+func openingPost(postID, content string) *discordgo.MessageCreate {
+	m := userMessage(content)
+	m.ID, m.ChannelID = postID, postID
+	return m
+}
+
+func TestForumPostsHaveTheirOwnChats(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello"}}}
+	b, session := newTestBot(t, client)
+	addForum(session)
+
+	b.HandleMessage(openingPost("post", "How do I read a file?"))
+	b.HandleMessage(openingPost("other-post", "What's a lifetime?"))
+	b.HandleMessage(userMessage("hi"))
+
+	if len(client.chats) != 3 {
+		t.Fatalf("chats = %d, want one per post and the channel's", len(client.chats))
+	}
+	// The opening message is sent with the post's title
+	if parts := client.chats[0].sent[0]; !slices.Contains(parts, genai.Part(genai.Text("Forum post title: Help with Go"))) {
+		t.Errorf("parts = %v, want the post title", parts)
+	}
+
+	// Clearing one post leaves the other alone
+	b.HandleInteraction(&discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:      discordgo.InteractionApplicationCommand,
+		ChannelID: "post",
+		GuildID:   "guild",
+		Member:    &discordgo.Member{User: &discordgo.User{ID: "user"}},
+		Data:      discordgo.ApplicationCommandInteractionData{Name: "clear"},
+	}})
+	if b.chatFor("post", "guild") == client.chats[0] || b.chatFor("other-post", "guild") != client.chats[1] {
+		t.Error("/clear in a post didn't replace only that post's chat")
+	}
+}
+
+func TestForumAutoAnswer(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello"}}}
+	b, session := newTestBot(t, client)
+	addForum(session)
+	if err := b.saveGuildSettings("guild", &store.GuildSettings{GuildID: "guild", Trigger: triggerMention}); err != nil {
+		t.Fatal(err)
+	}
+
+	b.HandleMessage(openingPost("post", "How do I read a file?"))
+	if len(session.messages) != 0 {
+		t.Errorf("sent %q without FORUM_AUTO_ANSWER, want nothing", session.messages)
+	}
+
+	b.config().ForumAutoAnswer = true
+	b.HandleMessage(openingPost("other-post", "What's a lifetime?"))
+	reply := userMessage("and what about borrowing?")
+	reply.ID, reply.ChannelID = "reply", "post"
+	b.HandleMessage(reply)
+	if len(session.messages) != 1 || session.messages[0] != "hello" {
+		t.Errorf("sent %q, want an answer to the opening message only", session.messages)
+	}
+}
+
+func TestTldrCommand(t *testing.T) {
+	client := &fakeAI{text: "Use os.ReadFile."}
+	b, session := newTestBot(t, client)
+	addForum(session)
+	now := time.Now()
+	session.history["post"] = []*discordgo.Message{
+		{ID: "2", Content: "os.ReadFile works", Author: &discordgo.User{Username: "bob"}, Timestamp: now},
+		{ID: "post", Content: "How do I read a file?", Author: &discordgo.User{Username: "alice"}, Timestamp: now.Add(-time.Minute)},
+	}
+
+	tldr := commandInteraction("tldr")
+	tldr.ChannelID = "post"
+	b.HandleInteraction(tldr)
+	if len(session.edits) != 1 || *session.edits[0].Content != "📌 **TL;DR**\nUse os.ReadFile." {
+		t.Fatalf("edits = %v, want the TL;DR", session.edits)
+	}
+	prompt := string(client.prompts[0][0].(genai.Text))
+	if !strings.Contains(prompt, `forum post titled "Help with Go"`) || !strings.Contains(prompt, "alice: How do I read a file?\nbob: os.ReadFile works") {
+		t.Errorf("prompt = %q, want the title and the messages in order", prompt)
+	}
+
+	// Outside threads there's nothing to summarize
+	b.HandleInteraction(commandInteraction("tldr"))
+	if got := session.responses[len(session.responses)-1].Data.Content; got != "Use this command in a forum post or a thread." {
+		t.Errorf("/tldr in a channel responded %q", got)
+	}
+}
@@ -0,0 +1,292 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/i18n"
+)
+
+const (
+	// Custom ID of the /help page picker
+	helpSelectID = "help-page"
+
+	// Slash commands described per /help page
+	helpCommandsPerPage = 5
+)
+
+// What the context-menu commands do, since Discord doesn't let them have a
+// description
+var contextMenuHelp = map[string]string{
+	askCommandName:         "Ask a question about the message and its attachments",
+	translateCommandName:   "Translate the message, with a menu to pick another language",
+	explainCommandName:     "Explain the message in simple terms",
+	explainFileCommandName: "Walk through the message's source file or code block, function by function",
+	ocrCommandName:         "Transcribe the text of the message's images verbatim, keeping its layout",
+}
+
+// helpPage is one page of /help
+type helpPage struct {
+	value string
+	label string
+	embed func(b *Bot, i *discordgo.InteractionCreate) *discordgo.MessageEmbed
+}
+
+// helpPages returns the pages of /help: an overview, the server's settings,
+// the slash commands a few at a time and the message commands, all
+// generated from Commands
+func helpPages() []helpPage {
+	pages := []helpPage{
+		{value: "overview", label: "Overview", embed: (*Bot).helpOverview},
+		{value: "server", label: "This server", embed: (*Bot).helpServer},
+	}
+
+	var slash, menus []*discordgo.ApplicationCommand
+	for _, command := range Commands {
+		if commandType(command) == discordgo.ChatApplicationCommand {
+			slash = append(slash, command)
+		} else {
+			menus = append(menus, command)
+		}
+	}
+	for start := 0; start < len(slash); start += helpCommandsPerPage {
+		commands := slash[start:min(start+helpCommandsPerPage, len(slash))]
+		label := fmt.Sprintf("Commands: /%s – /%s", commands[0].Name, commands[len(commands)-1].Name)
+		pages = append(pages, helpPage{
+			value: fmt.Sprintf("commands-%d", start/helpCommandsPerPage+1),
+			label: label,
+			embed: func(_ *Bot, i *discordgo.InteractionCreate) *discordgo.MessageEmbed {
+				return commandsEmbed(interactionLocale(i), label, commands)
+			},
+		})
+	}
+	if len(menus) > 0 {
+		pages = append(pages, helpPage{value: "menus", label: "Message commands", embed: func(_ *Bot, i *discordgo.InteractionCreate) *discordgo.MessageEmbed {
+			return menusEmbed(interactionLocale(i), menus)
+		}})
+	}
+	return pages
+}
+
+// helpCommand handles /help, showing the overview with a menu to browse
+// the other pages
+func (b *Bot) helpCommand(i *discordgo.InteractionCreate) {
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: b.helpResponse(i, "overview"),
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to help command", "error", err)
+	}
+}
+
+// helpSelect shows the /help page picked in the menu
+func (b *Bot) helpSelect(i *discordgo.InteractionCreate) {
+	data := i.MessageComponentData()
+	if len(data.Values) == 0 {
+		return
+	}
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: b.helpResponse(i, data.Values[0]),
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to help select", "error", err)
+	}
+}
+
+// helpResponse renders a /help page with the page picker, falling back to
+// the overview for unknown pages
+func (b *Bot) helpResponse(i *discordgo.InteractionCreate, value string) *discordgo.InteractionResponseData {
+	pages := helpPages()
+	current := pages[0]
+	for _, page := range pages {
+		if page.value == value {
+			current = page
+		}
+	}
+
+	options := make([]discordgo.SelectMenuOption, 0, len(pages))
+	for _, page := range pages {
+		options = append(options, discordgo.SelectMenuOption{
+			Label:   page.label,
+			Value:   page.value,
+			Default: page.value == current.value,
+		})
+	}
+	embed := current.embed(b, i)
+	embed.Color = embedColor
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: tr(i, "Pick another page below")}
+	return &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{CustomID: helpSelectID, Placeholder: tr(i, "Browse the help"), Options: options},
+			}},
+		},
+		Flags: discordgo.MessageFlagsEphemeral,
+	}
+}
+
+// helpOverview describes what the bot does and when it answers
+func (b *Bot) helpOverview(*discordgo.InteractionCreate) *discordgo.MessageEmbed {
+	cfg := b.config()
+	var triggers []string
+	if cfg.AutoThread {
+		triggers = append(triggers, "• **Messages**: I answer messages in channels I can read, in a thread of your own, and in DMs")
+	} else {
+		triggers = append(triggers, "• **Messages**: I answer messages in channels I can read and in DMs, with attachments such as images and PDFs")
+	}
+	if cfg.ForumAutoAnswer {
+		triggers = append(triggers, "• **Forum posts**: each post is a conversation of its own, and I answer the opening message; `/tldr` sums one up")
+	} else {
+		triggers = append(triggers, "• **Forum posts**: each post is a conversation of its own; `/tldr` sums one up")
+	}
+	triggers = append(triggers,
+		"• **Edits**: editing a message I answered in the last day updates my answer",
+		"• **Slash commands**: type `/` to see them, or browse them in this menu",
+		"• **Message commands**: right-click a message (or long-press it) and pick **Apps**",
+		"• **Reactions**: servers can map emoji to actions with `/reactions`")
+	if cfg.ImageEditing {
+		triggers = append(triggers, "• **Image edits**: send an image with `!edit <instruction>`")
+	}
+
+	description := "I'm a chat assistant. I keep the conversation going in each channel, remember what you ask me to, " +
+		"and can search the server's knowledge base, generate images and speak answers aloud.\n\n" +
+		"**When I answer**\n" + strings.Join(triggers, "\n")
+	return &discordgo.MessageEmbed{Title: "Help", Description: description}
+}
+
+// helpServer describes the settings of the server and channel /help is used in
+func (b *Bot) helpServer(i *discordgo.InteractionCreate) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{Title: "This server"}
+	if i.GuildID == "" {
+		embed.Description = "Use `/help` in a server to see its settings."
+		return embed
+	}
+
+	provider, _ := b.provider(i.GuildID)
+	usage := "Not tracked"
+	if guildUsage, err := b.state().GuildUsage(i.GuildID, monthStart(time.Now())); err != nil {
+		slog.Error("Error loading guild usage", "guild", i.GuildID, "error", err)
+	} else if limit := b.config().MonthlyGuildTokenCap; limit > 0 {
+		usage = fmt.Sprintf("%d of %d tokens this month", guildUsage.Tokens(), limit)
+	} else {
+		usage = fmt.Sprintf("%d tokens this month, no limit", guildUsage.Tokens())
+	}
+
+	welcome := "Off"
+	if settings, err := b.store.WelcomeSettings(i.GuildID); err != nil {
+		slog.Error("Error loading welcome settings", "guild", i.GuildID, "error", err)
+	} else if settings != nil && settings.Enabled {
+		welcome = "By DM"
+		if settings.ChannelID != "" {
+			welcome = "In <#" + settings.ChannelID + ">"
+		}
+	}
+
+	reactions := "None"
+	if actions, err := b.store.ReactionActions(i.GuildID); err != nil {
+		slog.Error("Error loading reaction actions", "guild", i.GuildID, "error", err)
+	} else if len(actions) > 0 {
+		var pairs []string
+		for _, action := range actions {
+			pairs = append(pairs, emojiText(action.Emoji)+" "+action.Action)
+		}
+		reactions = strings.Join(pairs, ", ")
+	}
+
+	digests := 0
+	if jobs, err := b.store.ScheduledJobs(i.GuildID); err != nil {
+		slog.Error("Error loading scheduled jobs", "guild", i.GuildID, "error", err)
+	} else {
+		digests = len(jobs)
+	}
+
+	conversation := defaultProfile
+	if profile := b.activeProfile(i.ChannelID); profile != nil {
+		conversation = profile.Name
+	}
+	var channel []string
+	channel = append(channel, "Conversation: `"+conversation+"`")
+	if b.isIndexedChannel(i.ChannelID) {
+		channel = append(channel, "Indexed for `/recall`")
+	}
+	if b.moderatedChannel(i.ChannelID) != nil {
+		channel = append(channel, "Moderated")
+	}
+
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "AI provider", Value: provider, Inline: true},
+		{Name: "Usage", Value: usage, Inline: true},
+		{Name: "Welcome messages", Value: welcome, Inline: true},
+		{Name: "Reaction actions", Value: truncate(reactions, 1024)},
+		{Name: "Scheduled digests", Value: fmt.Sprint(digests), Inline: true},
+		{Name: "This channel", Value: strings.Join(channel, "\n"), Inline: true},
+	}
+	return embed
+}
+
+// commandsEmbed describes slash commands with their subcommands and options,
+// in the given language where there are translations
+func commandsEmbed(locale discordgo.Locale, title string, commands []*discordgo.ApplicationCommand) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{Title: title}
+	for _, command := range commands {
+		var lines []string
+		lines = append(lines, i18n.Translate(locale, command.Description))
+		for _, option := range command.Options {
+			switch option.Type {
+			case discordgo.ApplicationCommandOptionSubCommand:
+				lines = append(lines, fmt.Sprintf("`/%s %s`%s — %s", i18n.Name(locale, command.Name), option.Name, optionsUsage(option.Options), i18n.Translate(locale, option.Description)))
+			default:
+				lines = append(lines, optionHelp(locale, option))
+			}
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "/" + i18n.Name(locale, command.Name),
+			Value: truncate(strings.Join(lines, "\n"), 1024),
+		})
+	}
+	return embed
+}
+
+// optionsUsage lists a subcommand's options as in " name:<…> [count:<…>]"
+func optionsUsage(options []*discordgo.ApplicationCommandOption) string {
+	var usage string
+	for _, option := range options {
+		if option.Required {
+			usage += fmt.Sprintf(" %s:<…>", option.Name)
+		} else {
+			usage += fmt.Sprintf(" [%s:<…>]", option.Name)
+		}
+	}
+	return usage
+}
+
+// optionHelp describes a command option
+func optionHelp(locale discordgo.Locale, option *discordgo.ApplicationCommandOption) string {
+	line := fmt.Sprintf("• `%s`", option.Name)
+	if !option.Required {
+		line += " " + i18n.Translate(locale, "(optional)")
+	}
+	return line + " — " + i18n.Translate(locale, option.Description)
+}
+
+// menusEmbed describes the context-menu commands
+func menusEmbed(locale discordgo.Locale, commands []*discordgo.ApplicationCommand) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       i18n.Translate(locale, "Message commands"),
+		Description: i18n.Translate(locale, "Right-click a message (or long-press it on mobile), then pick **Apps**."),
+	}
+	for _, command := range commands {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  i18n.Name(locale, command.Name),
+			Value: i18n.Translate(locale, contextMenuHelp[command.Name]),
+		})
+	}
+	return embed
+}
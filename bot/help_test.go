@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// helpSelectInteraction picks a /help page in the menu
+func helpSelectInteraction(page string) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:      discordgo.InteractionMessageComponent,
+		GuildID:   "guild",
+		ChannelID: "channel",
+		Member:    &discordgo.Member{User: &discordgo.User{ID: "user", Username: "alice"}},
+		Data:      discordgo.MessageComponentInteractionData{CustomID: helpSelectID, Values: []string{page}},
+	}}
+}
+
+func TestHelpCommand(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+
+	b.HandleInteraction(commandInteraction("help"))
+	if len(session.responses) != 1 {
+		t.Fatalf("responses = %v, want the help", session.responses)
+	}
+	data := session.responses[0].Data
+	if len(data.Embeds) != 1 || data.Embeds[0].Title != "Help" || data.Flags != discordgo.MessageFlagsEphemeral {
+		t.Fatalf("help = %+v, want the overview", data)
+	}
+	menu := data.Components[0].(discordgo.ActionsRow).Components[0].(discordgo.SelectMenu)
+	if len(menu.Options) > 25 || !menu.Options[0].Default {
+		t.Errorf("menu options = %+v, want at most 25 with the overview picked", menu.Options)
+	}
+
+	// Every command is described on exactly one page
+	described := map[string]int{}
+	for _, option := range menu.Options {
+		session.responses = nil
+		b.HandleInteraction(helpSelectInteraction(option.Value))
+		if len(session.responses) != 1 || session.responses[0].Type != discordgo.InteractionResponseUpdateMessage {
+			t.Fatalf("picking %s responded %v, want the message updated", option.Value, session.responses)
+		}
+		for _, field := range session.responses[0].Data.Embeds[0].Fields {
+			if field.Value == "" {
+				t.Errorf("page %s has an empty field %q", option.Value, field.Name)
+			}
+			described[field.Name]++
+		}
+	}
+	for _, command := range Commands {
+		name := command.Name
+		if commandType(command) == discordgo.ChatApplicationCommand {
+			name = "/" + name
+		}
+		if described[name] != 1 {
+			t.Errorf("%s is described %d times, want once", name, described[name])
+		}
+	}
+}
+
+func TestHelpServerPage(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+	b.HandleInteraction(chatInteraction("switch", stringOption("name", "coding")))
+
+	session.responses = nil
+	b.HandleInteraction(helpSelectInteraction("server"))
+	embed := session.responses[0].Data.Embeds[0]
+	fields := map[string]string{}
+	for _, field := range embed.Fields {
+		fields[field.Name] = field.Value
+	}
+	if fields["AI provider"] != ProviderGemini || fields["Welcome messages"] != "Off" || fields["This channel"] != "Conversation: `coding`" {
+		t.Errorf("server page fields = %v", fields)
+	}
+}
+
+func TestHelpSkipsQuota(t *testing.T) {
+	if usesAI(helpSelectInteraction("overview")) || usesAI(commandInteraction("help")) {
+		t.Error("usesAI = true for /help, which never calls the model")
+	}
+}
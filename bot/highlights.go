@@ -0,0 +1,186 @@
+package bot
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// Reactions a message needs by default to be a highlight
+	defaultHighlightReactions = 3
+
+	// Most messages a recap highlights, the most reacted ones are kept
+	maxHighlights = 10
+
+	// Longest period /highlights looks back over, a month
+	maxHighlightHours = 30 * 24
+)
+
+// Fewest reactions the /highlights min_reactions option takes (the API
+// takes a pointer)
+var minHighlightReactions = 1.0
+
+// Periods like "12h", "3d" or "2w", as the /highlights since option takes
+var highlightPeriod = regexp.MustCompile(`^(\d+)\s*([hdw])$`)
+
+// highlight is a message of a channel and the reactions it got
+type highlight struct {
+	message   *discordgo.Message
+	reactions int
+}
+
+// parseHighlightPeriod returns the hours of a period like "12h", "3d" or
+// "2w", 0 when it isn't one
+func parseHighlightPeriod(text string) int {
+	match := highlightPeriod.FindStringSubmatch(strings.ToLower(strings.TrimSpace(text)))
+	if match == nil {
+		return 0
+	}
+	count, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+	switch match[2] {
+	case "d":
+		count *= 24
+	case "w":
+		count *= 7 * 24
+	}
+	return count
+}
+
+// messageReactions counts a message's reactions, only those with an emoji
+// when one is given
+func messageReactions(m *discordgo.Message, emoji string) int {
+	var count int
+	for _, reaction := range m.Reactions {
+		if reaction.Emoji != nil && (emoji == "" || reaction.Emoji.APIName() == emoji) {
+			count += reaction.Count
+		}
+	}
+	return count
+}
+
+// topHighlights returns the messages with at least threshold reactions, most
+// reacted first and, among equally reacted ones, oldest first
+func topHighlights(messages []*discordgo.Message, threshold int, emoji string) []highlight {
+	var highlights []highlight
+	for _, m := range messages {
+		if reactions := messageReactions(m, emoji); reactions >= threshold {
+			highlights = append(highlights, highlight{message: m, reactions: reactions})
+		}
+	}
+	slices.SortStableFunc(highlights, func(a, b highlight) int { return b.reactions - a.reactions })
+	return highlights[:min(len(highlights), maxHighlights)]
+}
+
+// highlightsCommand handles /highlights, collecting the most reacted messages
+// of a channel over a period and having the model write a "best of" recap
+// of them, posted as an embed with their jump links
+func (b *Bot) highlightsCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Highlights only work in servers."))
+		return
+	}
+	options := i.ApplicationCommandData().Options
+	since := commandOption(options, "since").StringValue()
+	hours := parseHighlightPeriod(since)
+	if hours == 0 || hours > maxHighlightHours {
+		b.respondEphemeral(i, tr(i, "`%s` isn't a period I understand. Use hours, days or weeks up to a month, like `12h`, `3d` or `2w`.", since))
+		return
+	}
+	threshold := defaultHighlightReactions
+	if option := commandOption(options, "min_reactions"); option != nil {
+		threshold = int(option.IntValue())
+	}
+	var emoji string
+	if option := commandOption(options, "emoji"); option != nil {
+		emoji = reactionEmoji(option.StringValue())
+	}
+	channelID := i.ChannelID
+	if option := commandOption(options, "channel"); option != nil {
+		channelID = option.ChannelValue(nil).ID
+	}
+
+	// Members can't have the bot recap channels they can't read
+	permissions, err := b.session.UserChannelPermissions(interactionUserID(i), channelID)
+	if err != nil || permissions&discordgo.PermissionViewChannel == 0 {
+		b.respondEphemeral(i, tr(i, "You can't read <#%s>.", channelID))
+		return
+	}
+
+	err = b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to highlights command", "error", err)
+		return
+	}
+
+	start := time.Now().Add(-time.Duration(hours) * time.Hour)
+	messages, err := b.channelMessagesSince(channelID, start)
+	if err != nil {
+		interactionLogger(i).Error("Error reading channel history", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	highlights := topHighlights(messages, threshold, emoji)
+	if len(highlights) == 0 {
+		b.editInteractionResponse(i, tr(i, "No message in <#%s> got %d reactions or more since <t:%d:f>.", channelID, threshold, start.Unix()))
+		return
+	}
+
+	var transcript strings.Builder
+	for n, h := range highlights {
+		fmt.Fprintf(&transcript, "%d. %s (%d reactions): %s\n", n+1, h.message.Author.Username, h.reactions, truncate(h.message.Content, 1000))
+	}
+	prompt := fmt.Sprintf("Write a short, lively \"best of\" recap of the Discord messages below, the ones members reacted to most "+
+		"over the last %s, in the language of the messages. Say in a few sentences what made them stand out, "+
+		"referring to them by their number like [1], without quoting them in full.\n\n%s", hoursText("", hours),
+		b.untrusted(interactionUserID(i), i.GuildID, "the channel's messages", transcript.String()))
+	recap, err := b.generate(interactionUserID(i), i.GuildID, genai.Text(prompt))
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+
+	embeds := []*discordgo.MessageEmbed{highlightsEmbed(i, channelID, start, recap, highlights)}
+	content := ""
+	_, err = b.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:         &content,
+		Embeds:          &embeds,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error sending highlights", "error", err)
+		return
+	}
+	interactionLogger(i).Info("Posted highlights", "highlighted_channel", channelID, "hours", hours, "highlights", len(highlights))
+}
+
+// highlightsEmbed shows the recap of a channel's highlights, with a field
+// linking to each of them by its number
+func highlightsEmbed(i *discordgo.InteractionCreate, channelID string, start time.Time, recap string, highlights []highlight) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       tr(i, "✨ Highlights"),
+		Description: truncate(tr(i, "<#%s> since <t:%d:f>", channelID, start.Unix())+"\n\n"+recap, embedDescriptionLimit),
+		Color:       embedColor,
+	}
+	for n, h := range highlights {
+		m := h.message
+		link := fmt.Sprintf("https://discord.com/channels/%s/%s/%s", i.GuildID, channelID, m.ID)
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  truncate(fmt.Sprintf("[%d] %s · %d", n+1, m.Author.Username, h.reactions), 256),
+			Value: fmt.Sprintf("%s\n[%s](%s)", truncate(strings.ReplaceAll(m.Content, "\n", " "), 200), tr(i, "Jump to message"), link),
+		})
+	}
+	return embed
+}
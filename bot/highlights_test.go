@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+// reacted returns a message with reactions of emojis, by how many reacted
+func reacted(id, author, content string, at time.Time, reactions map[string]int) *discordgo.Message {
+	m := &discordgo.Message{ID: id, Content: content, Author: &discordgo.User{Username: author}, Timestamp: at}
+	for emoji, count := range reactions {
+		m.Reactions = append(m.Reactions, &discordgo.MessageReactions{Emoji: &discordgo.Emoji{Name: emoji}, Count: count})
+	}
+	return m
+}
+
+func TestHighlightsCommand(t *testing.T) {
+	client := &fakeAI{text: "The cat photo [1] won the day."}
+	b, session := newTestBot(t, client)
+	now := time.Now()
+	session.history["channel"] = []*discordgo.Message{
+		reacted("4", "carol", "meh", now.Add(-time.Hour), map[string]int{"👍": 1}),
+		reacted("3", "bob", "the build is green", now.Add(-2*time.Hour), map[string]int{"🎉": 2, "⭐": 1}),
+		reacted("2", "alice", "look at my cat", now.Add(-3*time.Hour), map[string]int{"⭐": 5}),
+		reacted("1", "dave", "last week's joke", now.Add(-8*24*time.Hour), map[string]int{"😂": 9}),
+	}
+	highlights := func(options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+		i := commandInteraction("highlights")
+		i.ChannelID = "channel"
+		i.Data = discordgo.ApplicationCommandInteractionData{Name: "highlights", Options: options}
+		return i
+	}
+
+	b.HandleInteraction(highlights(stringOption("since", "1w")))
+	if len(session.edits) != 1 || len(*session.edits[0].Embeds) != 1 {
+		t.Fatalf("edits = %v, want the highlights embed", session.edits)
+	}
+	embed := (*session.edits[0].Embeds)[0]
+	if !strings.Contains(embed.Description, "The cat photo [1] won the day.") || len(embed.Fields) != 2 {
+		t.Fatalf("embed = %+v, want the recap and the two messages with 3 reactions or more", embed)
+	}
+	if field := embed.Fields[0]; field.Name != "[1] alice · 5" || !strings.Contains(field.Value, "(https://discord.com/channels/guild/channel/2)") {
+		t.Errorf("first highlight = %+v, want the most reacted message with its jump link", field)
+	}
+	prompt := string(client.prompts[0][0].(genai.Text))
+	if !strings.Contains(prompt, "1. alice (5 reactions): look at my cat\n2. bob (3 reactions): the build is green") || strings.Contains(prompt, "joke") {
+		t.Errorf("prompt = %q, want the highlights of the week, most reacted first", prompt)
+	}
+
+	// Thresholds and emojis narrow the highlights down
+	b.HandleInteraction(highlights(stringOption("since", "1d"), integerOption("min_reactions", 1), stringOption("emoji", "🎉")))
+	if embed := (*session.edits[1].Embeds)[0]; len(embed.Fields) != 1 || embed.Fields[0].Name != "[1] bob · 2" {
+		t.Errorf("fields = %+v, want the message with 🎉 reactions only", embed.Fields)
+	}
+	b.HandleInteraction(highlights(stringOption("since", "1d"), integerOption("min_reactions", 10)))
+	if got := *session.edits[2].Content; !strings.HasPrefix(got, "No message in <#channel> got 10 reactions or more") {
+		t.Errorf("edit = %q, want no highlights", got)
+	}
+
+	b.HandleInteraction(highlights(stringOption("since", "forever")))
+	if got := session.responses[len(session.responses)-1].Data.Content; !strings.Contains(got, "isn't a period I understand") {
+		t.Errorf("response = %q, want the period rejected", got)
+	}
+}
+
+func TestParseHighlightPeriod(t *testing.T) {
+	for text, want := range map[string]int{"12h": 12, "3d": 72, "2W": 336, " 1 d ": 24, "1y": 0, "d": 0, "": 0} {
+		if got := parseHighlightPeriod(text); got != want {
+			t.Errorf("parseHighlightPeriod(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
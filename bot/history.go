@@ -0,0 +1,98 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+)
+
+// Most recent history entries (user and model turns) always kept verbatim
+const recentHistoryEntries = 6
+
+// compactHistory replaces the older turns of a chat with a summary once its
+// history grows past the token budget, so long conversations keep their
+// context without every request getting more expensive
+func (b *Bot) compactHistory(chat ai.Chat, userID string, guildID string) {
+	history := chat.History()
+	if len(history) <= recentHistoryEntries {
+		return
+	}
+
+	// Count the tokens of the whole history
+	var parts []genai.Part
+	for _, content := range history {
+		parts = append(parts, content.Parts...)
+	}
+	tokens, err := b.aiFor(guildID).CountTokens(b.ctx, parts...)
+	if err != nil {
+		slog.Error("Error counting history tokens", "error", err)
+		return
+	}
+	budget := b.config().HistoryTokenBudget
+	if tokens <= budget {
+		return
+	}
+
+	// Keep the recent turns starting with a user turn so roles keep alternating
+	split := len(history) - recentHistoryEntries
+	for split > 0 && history[split].Role != "user" {
+		split--
+	}
+	if split == 0 {
+		return
+	}
+	older, recent := history[:split], history[split:]
+
+	summary, err := b.summarizeHistory(userID, guildID, older)
+	if err != nil {
+		slog.Error("Error summarizing history", "error", err)
+		return
+	}
+
+	chat.SetHistory(append(summary, recent...))
+	slog.Info("Summarized chat history", "entries", len(older), "tokens", tokens, "budget", budget)
+}
+
+// summarizeHistory condenses chat history into a pair of turns carrying its
+// summary, which a chat can continue from
+func (b *Bot) summarizeHistory(userID string, guildID string, history []*genai.Content) ([]*genai.Content, error) {
+	summary, err := b.generate(userID, guildID, genai.Text("Summarize the following conversation between a user and an assistant. "+
+		"Keep names, facts, decisions and open questions needed to continue it, and be concise.\n\n"+historyTranscript(history)))
+	if err != nil {
+		return nil, err
+	}
+	return []*genai.Content{
+		{Role: "user", Parts: []genai.Part{genai.Text("Summary of our conversation so far:\n" + summary)}},
+		{Role: "model", Parts: []genai.Part{genai.Text("Got it, I'll keep that in mind.")}},
+	}, nil
+}
+
+// historyTranscript renders chat history as plain text, noting attachments
+// by type since they can't be summarized directly
+func historyTranscript(history []*genai.Content) string {
+	var b strings.Builder
+	for _, content := range history {
+		fmt.Fprintf(&b, "%s: %s\n", content.Role, partsText(content.Parts))
+	}
+	return b.String()
+}
+
+// partsText renders message parts as plain text, noting attachments by type
+func partsText(parts []genai.Part) string {
+	var b strings.Builder
+	for _, part := range parts {
+		switch p := part.(type) {
+		case genai.Text:
+			b.WriteString(string(p))
+		case genai.FileData:
+			fmt.Fprintf(&b, "[attached %s file] ", p.MIMEType)
+		case genai.Blob:
+			fmt.Fprintf(&b, "[attached %s file] ", p.MIMEType)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,133 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+)
+
+// Messages starting with this prefix and carrying an image are edit requests
+const imageEditPrefix = "!edit"
+
+// editImage sends the attached images and the user's instruction to an
+// image-output model of the server's provider and replies with the
+// generated images
+func (b *Bot) editImage(m *discordgo.MessageCreate, instruction string) {
+	stopTyping := b.keepTyping(m.ChannelID)
+
+	var images []ai.Image
+	for _, attachment := range m.Attachments {
+		if !strings.HasPrefix(attachment.ContentType, "image/") {
+			continue
+		}
+		data, err := downloadAttachment(attachment)
+		if err != nil {
+			messageLogger(m).Error("Error downloading attachment", "file", attachment.Filename, "error", err)
+			continue
+		}
+		images = append(images, ai.Image{MIMEType: attachment.ContentType, Data: data})
+	}
+
+	// Edit with the server's provider, keeping the exchange in the chat's
+	// history under its lock so follow-up messages have context
+	chat := b.chatFor(m.ChannelID, m.GuildID)
+	unlock := b.lockSession(chat)
+	defer unlock()
+	text, edited, err := b.sendImageEdit(m, images, instruction)
+	stopTyping()
+	if err != nil {
+		b.session.ChannelMessageSend(m.ChannelID, b.trGuild(m.GuildID, "Sorry, an error occurred: %v", err))
+		messageLogger(m).Error("Gemini image edit error", "error", err)
+		return
+	}
+
+	var files []*discordgo.File
+	for _, image := range edited {
+		files = append(files, &discordgo.File{
+			Name:        fmt.Sprintf("edited-%d.%s", len(files)+1, strings.TrimPrefix(image.MIMEType, "image/")),
+			ContentType: image.MIMEType,
+			Reader:      bytes.NewReader(image.Data),
+		})
+	}
+
+	recordImageEdit(chat, instruction, text, len(files))
+	b.touchChat(chat, m.Author.ID, m.GuildID)
+	b.saveSession(chat)
+
+	if len(files) == 0 {
+		if text == "" {
+			text = "I couldn't generate an edited image."
+		}
+		b.sendLongMessage(m.ChannelID, text)
+		return
+	}
+
+	// Send the images with the first chunk of text, the rest after it
+	chunks := splitMessage(text)
+	first := ""
+	if len(chunks) > 0 {
+		first, chunks = chunks[0], chunks[1:]
+	}
+	_, err = b.session.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content:         first,
+		Files:           files,
+		Reference:       m.Reference(),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		messageLogger(m).Error("Error sending edited image", "error", err)
+		return
+	}
+	for _, chunk := range chunks {
+		b.sendLongMessage(m.ChannelID, chunk)
+	}
+}
+
+// sendImageEdit sends images and an edit instruction to the default
+// provider, which edits images for every server like /imagine generates
+// them, recording the exchange in the usage and audit logs like answer,
+// and returns the model's text and the edited images
+func (b *Bot) sendImageEdit(m *discordgo.MessageCreate, images []ai.Image, instruction string) (string, []ai.Image, error) {
+	parts, err := b.beforePrompt(m.Author.ID, m.GuildID, b.scrubParts(m.GuildID, []genai.Part{genai.Text(instruction)}))
+	if err != nil {
+		return "", nil, err
+	}
+	reply, edited, err := b.ai.EditImage(b.ctx, images, partsText(parts))
+	b.auditExchange(m.Author.ID, m.GuildID, parts, reply, err)
+	if err != nil {
+		return "", nil, err
+	}
+	b.recordUsage(m.Author.ID, m.GuildID, reply)
+	return b.fixMentions(m.GuildID, b.afterResponse(m.Author.ID, m.GuildID, reply.Text)), edited, nil
+}
+
+// recordImageEdit appends an image edit request and its outcome to the chat
+// history; the images themselves are summarized as text
+func recordImageEdit(chat ai.Chat, instruction string, text string, images int) {
+	reply := text
+	if images > 0 {
+		reply = strings.TrimSpace(fmt.Sprintf("%s\n[Sent %d edited image(s)]", text, images))
+	}
+	if reply == "" {
+		reply = "[No edited image was generated]"
+	}
+	chat.SetHistory(append(chat.History(),
+		&genai.Content{Role: "user", Parts: []genai.Part{genai.Text("[Attached an image to edit] " + instruction)}},
+		&genai.Content{Role: "model", Parts: []genai.Part{genai.Text(reply)}},
+	))
+}
+
+// hasImageAttachment reports whether any of the attachments is an image
+func hasImageAttachment(attachments []*discordgo.MessageAttachment) bool {
+	for _, attachment := range attachments {
+		if strings.HasPrefix(attachment.ContentType, "image/") {
+			return true
+		}
+	}
+	return false
+}
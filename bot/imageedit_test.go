@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/audit"
+)
+
+func TestEditImage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("png"))
+	}))
+	defer server.Close()
+
+	client := &fakeAI{text: "Here it is, in blue, @everyone."}
+	b, session := newTestBot(t, client)
+	b.config().ImageEditing = true
+	b.SetAudit(audit.New(b.store.AuditSink(), audit.Options{}))
+
+	m := userMessage("!edit make it blue")
+	m.Attachments = []*discordgo.MessageAttachment{{ID: "cat", Filename: "cat.png", ContentType: "image/png", URL: server.URL}}
+	b.HandleMessage(m)
+
+	if len(client.prompts) != 1 || partsText(client.prompts[0]) != "make it blue" {
+		t.Fatalf("prompts = %q, want the instruction", client.prompts)
+	}
+	if _, ok := session.files["channel/edited-1.png"]; !ok || len(session.messages) != 1 || session.messages[0] != "Here it is, in blue, @\u200beveryone." {
+		t.Errorf("sent %q with files %v, want the edited image and mentions disarmed", session.messages, session.files)
+	}
+	if allowed := session.mentions[0]; allowed == nil || len(allowed.Parse) != 0 || allowed.RepliedUser {
+		t.Errorf("allowed mentions = %+v, want none", allowed)
+	}
+
+	// The exchange counts toward usage, is audited and kept in the history
+	usage, err := b.store.GuildUsage("guild", time.Now())
+	if err != nil {
+		t.Fatalf("GuildUsage: %v", err)
+	}
+	if usage.Requests != 1 || usage.Tokens() != 24 {
+		t.Errorf("usage = %+v, want 1 request and 24 tokens", usage)
+	}
+	if entries, _ := b.store.AuditEntries(time.Time{}); len(entries) != 1 || entries[0].Response != "Here it is, in blue, @everyone." {
+		t.Errorf("entries = %+v, want the edit audited", entries)
+	}
+	if history := b.chatFor("channel", "guild").History(); len(history) != 2 {
+		t.Errorf("history = %v, want the edit recorded", history)
+	}
+}
+
+func TestEditImageUsesDefaultProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("png"))
+	}))
+	defer server.Close()
+
+	gemini := &fakeAI{text: "edited"}
+	openAI := &fakeAI{err: ai.ErrUnsupported}
+	b, session := newTestBot(t, gemini)
+	b.config().ImageEditing = true
+	b.AddProvider(ProviderOpenAI, openAI)
+	b.HandleInteraction(providerInteraction(ProviderOpenAI, discordgo.PermissionManageServer))
+
+	m := userMessage("!edit make it blue")
+	m.Attachments = []*discordgo.MessageAttachment{{ID: "cat", Filename: "cat.png", ContentType: "image/png", URL: server.URL}}
+	b.HandleMessage(m)
+
+	if len(gemini.prompts) != 1 || len(openAI.prompts) != 0 {
+		t.Errorf("default prompts = %q, openai prompts = %q, want the edit sent to the default provider", gemini.prompts, openAI.prompts)
+	}
+	if _, ok := session.files["channel/edited-1.png"]; !ok {
+		t.Errorf("files = %v, want the edited image", session.files)
+	}
+}
@@ -0,0 +1,142 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/metrics"
+)
+
+// Upper bound of the /imagine count option
+const maxImageCount = 4
+
+// Lower bound of the /imagine count option (the API takes a pointer)
+var minImageCount = 1.0
+
+// dailyUsage counts how many images a user generated on a given day
+type dailyUsage struct {
+	day   string
+	count int
+}
+
+// imagine handles /imagine, generating images with Imagen and uploading
+// them back to the channel as attachments
+func (b *Bot) imagine(i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	prompt := commandOption(options, "prompt").StringValue()
+	count := 1
+	if option := commandOption(options, "count"); option != nil {
+		count = int(option.IntValue())
+	}
+
+	// Enforce the daily limit before spending any API quota
+	userID := interactionUserID(i)
+	remaining, ok := b.reserveImagineQuota(userID, count)
+	if !ok {
+		metrics.RateLimitRejections.WithLabelValues("imagine_daily").Inc()
+		err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("That would go over your daily image limit (%d left today).", remaining),
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			interactionLogger(i).Error("Error responding to imagine command", "error", err)
+		}
+		return
+	}
+
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to imagine command", "error", err)
+		b.refundImagineQuota(userID, count)
+		return
+	}
+
+	// Channels not marked NSFW get Imagen's strictest safety filter
+	images, err := b.ai.GenerateImages(b.ctx, prompt, count, !b.isNSFWChannel(i.ChannelID))
+	if err != nil {
+		interactionLogger(i).Error("Imagen error", "error", err)
+		b.refundImagineQuota(userID, count)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+
+	var files []*discordgo.File
+	for n, image := range images {
+		extension := strings.TrimPrefix(image.MIMEType, "image/")
+		files = append(files, &discordgo.File{
+			Name:        fmt.Sprintf("imagine-%d.%s", n+1, extension),
+			ContentType: image.MIMEType,
+			Reader:      bytes.NewReader(image.Data),
+		})
+	}
+
+	// Images removed by the safety filter don't count towards the limit
+	b.refundImagineQuota(userID, count-len(files))
+	if len(files) == 0 {
+		b.editInteractionResponse(i, tr(i, "No images were generated, the prompt may have been blocked by safety filters."))
+		return
+	}
+
+	content := truncate("**Prompt:** "+prompt, 2000)
+	_, err = b.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &content,
+		Files:   files,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error sending generated images", "error", err)
+		b.refundImagineQuota(userID, len(files))
+	}
+}
+
+// reserveImagineQuota records n images against the user's daily limit,
+// returning false (and the images left today) if that would exceed it
+func (b *Bot) reserveImagineQuota(userID string, n int) (int, bool) {
+	limit := b.config().ImagineDailyLimit
+	today := time.Now().UTC().Format(time.DateOnly)
+
+	b.imagineMu.Lock()
+	defer b.imagineMu.Unlock()
+
+	usage, ok := b.imagineUsage[userID]
+	if !ok || usage.day != today {
+		usage = &dailyUsage{day: today}
+		b.imagineUsage[userID] = usage
+	}
+	if usage.count+n > limit {
+		return limit - usage.count, false
+	}
+	usage.count += n
+	return limit - usage.count, true
+}
+
+// refundImagineQuota gives back images that were reserved but not generated
+func (b *Bot) refundImagineQuota(userID string, n int) {
+	b.imagineMu.Lock()
+	defer b.imagineMu.Unlock()
+
+	if usage, ok := b.imagineUsage[userID]; ok {
+		usage.count = max(usage.count-n, 0)
+	}
+}
+
+// isNSFWChannel reports whether a channel (or a thread's parent channel) is
+// marked as age-restricted
+func (b *Bot) isNSFWChannel(channelID string) bool {
+	channel, err := b.session.Channel(channelID)
+	if err != nil {
+		return false
+	}
+	if channel.IsThread() && channel.ParentID != "" {
+		return b.isNSFWChannel(channel.ParentID)
+	}
+	return channel.NSFW
+}
@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/latex"
+)
+
+// modalTextValue returns the value of the text input with the given custom ID
+func modalTextValue(data discordgo.ModalSubmitInteractionData, customID string) string {
+	for _, component := range data.Components {
+		row, ok := component.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, rowComponent := range row.Components {
+			input, ok := rowComponent.(*discordgo.TextInput)
+			if ok && input.CustomID == customID {
+				return input.Value
+			}
+		}
+	}
+	return ""
+}
+
+// editInteractionResponse replaces the content of a deferred interaction
+// response, without pinging anyone it mentions
+func (b *Bot) editInteractionResponse(i *discordgo.InteractionCreate, content string) {
+	_, err := b.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:         &content,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error editing interaction response", "error", err)
+	}
+}
+
+// interactionUser returns the user who triggered an interaction, who lives
+// on Member in guilds and on User in DMs
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// interactionUserID returns the ID of the user who triggered an interaction
+func interactionUserID(i *discordgo.InteractionCreate) string {
+	return interactionUser(i).ID
+}
+
+// editInteractionResponseLong replaces the content of a deferred interaction
+// response, sending whatever doesn't fit as follow-up messages with the same
+// flags. With MATH_UNICODE its LaTeX math is written with Unicode symbols.
+func (b *Bot) editInteractionResponseLong(i *discordgo.InteractionCreate, content string, flags discordgo.MessageFlags) {
+	if b.config().MathUnicode {
+		content = latex.Convert(content)
+	}
+	b.editInteractionResponseChunks(i, splitMessage(content), flags)
+}
+
+// editInteractionResponseChunks replaces the content of a deferred
+// interaction response with the first of chunks, already split to fit in
+// messages, sending the others as follow-up messages with the same flags
+func (b *Bot) editInteractionResponseChunks(i *discordgo.InteractionCreate, chunks []string, flags discordgo.MessageFlags) {
+	if len(chunks) == 0 {
+		return
+	}
+	b.editInteractionResponse(i, chunks[0])
+	for _, chunk := range chunks[1:] {
+		_, err := b.session.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+			Content:         chunk,
+			Flags:           flags,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err != nil {
+			interactionLogger(i).Error("Error sending follow-up message", "error", err)
+			return
+		}
+	}
+}
+
+// deferEphemeral acknowledges an interaction with a private "thinking" state
+// so the real answer can be sent once Gemini responds
+func (b *Bot) deferEphemeral(i *discordgo.InteractionCreate) error {
+	return b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+// commandOption returns the named slash command option, or nil if it wasn't given
+func commandOption(options []*discordgo.ApplicationCommandInteractionDataOption, name string) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, option := range options {
+		if option.Name == name {
+			return option
+		}
+	}
+	return nil
+}
+
+// respond answers an interaction with a message the whole channel sees
+func (b *Bot) respond(i *discordgo.InteractionCreate, content string) {
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to interaction", "error", err)
+	}
+}
+
+// respondEphemeral replies to an interaction with a private message
+func (b *Bot) respondEphemeral(i *discordgo.InteractionCreate, content string) {
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to interaction", "error", err)
+	}
+}
@@ -0,0 +1,205 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Schema types by their JSON Schema name
+var schemaTypes = map[string]genai.Type{
+	"string":  genai.TypeString,
+	"number":  genai.TypeNumber,
+	"integer": genai.TypeInteger,
+	"boolean": genai.TypeBoolean,
+	"array":   genai.TypeArray,
+	"object":  genai.TypeObject,
+}
+
+// jsonSchema is the subset of JSON Schema that Gemini response schemas support
+type jsonSchema struct {
+	Type        string                 `json:"type"`
+	Format      string                 `json:"format"`
+	Description string                 `json:"description"`
+	Nullable    bool                   `json:"nullable"`
+	Enum        []string               `json:"enum"`
+	Items       *jsonSchema            `json:"items"`
+	Properties  map[string]*jsonSchema `json:"properties"`
+	Required    []string               `json:"required"`
+}
+
+// jsonCommand handles /json, answering a prompt with pretty-printed JSON,
+// matching a schema when one is given
+func (b *Bot) jsonCommand(i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	prompt := commandOption(options, "prompt").StringValue()
+	var schema *genai.Schema
+	if option := commandOption(options, "schema"); option != nil {
+		var err error
+		if schema, err = parseSchema(option.StringValue()); err != nil {
+			b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+	}
+
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to json command", "error", err)
+		return
+	}
+
+	// OpenAI-compatible JSON mode requires the prompt to ask for JSON
+	text, err := b.generateJSON(interactionUserID(i), i.GuildID, schema, genai.Text(prompt+"\n\nAnswer in JSON."))
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+
+	var value any
+	err = json.Unmarshal([]byte(text), &value)
+	if err == nil && schema != nil {
+		err = validateJSON(value, schema, "$")
+	}
+	if err != nil {
+		interactionLogger(i).Warn("Model returned invalid JSON", "error", err)
+		b.editInteractionResponse(i, truncate(tr(i, "Sorry, the model returned invalid JSON: %v", err)+"\n```\n"+text, 1996)+"\n```")
+		return
+	}
+
+	// Indent the text rather than re-encoding the value, to keep key order
+	var pretty bytes.Buffer
+	json.Indent(&pretty, []byte(text), "", "  ")
+	content := "```json\n" + pretty.String() + "\n```"
+	if len([]rune(content)) <= 2000 {
+		b.editInteractionResponse(i, content)
+		return
+	}
+	note := "📎 The JSON is attached as `response.json`."
+	_, err = b.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &note,
+		Files:   []*discordgo.File{{Name: "response.json", ContentType: "application/json", Reader: &pretty}},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error editing interaction response", "error", err)
+	}
+}
+
+// parseSchema reads a response schema written as JSON Schema
+func parseSchema(text string) (*genai.Schema, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.DisallowUnknownFields()
+	var parsed jsonSchema
+	if err := decoder.Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("error parsing schema: %v", err)
+	}
+	return parsed.toGenai("$")
+}
+
+// toGenai converts a schema and the schemas nested in it, path locating it
+// for errors
+func (s *jsonSchema) toGenai(path string) (*genai.Schema, error) {
+	schemaType, ok := schemaTypes[s.Type]
+	if !ok {
+		return nil, fmt.Errorf("error parsing schema: %s has type %q, want one of string, number, integer, boolean, array or object", path, s.Type)
+	}
+	schema := &genai.Schema{
+		Type:        schemaType,
+		Format:      s.Format,
+		Description: s.Description,
+		Nullable:    s.Nullable,
+		Enum:        s.Enum,
+		Required:    s.Required,
+	}
+	if s.Items != nil {
+		items, err := s.Items.toGenai(path + "[]")
+		if err != nil {
+			return nil, err
+		}
+		schema.Items = items
+	}
+	if len(s.Properties) > 0 {
+		schema.Properties = map[string]*genai.Schema{}
+		for name, property := range s.Properties {
+			converted, err := property.toGenai(path + "." + name)
+			if err != nil {
+				return nil, err
+			}
+			schema.Properties[name] = converted
+		}
+	}
+	return schema, nil
+}
+
+// validateJSON checks that a decoded JSON value matches a schema, path
+// locating the value for errors
+func validateJSON(value any, schema *genai.Schema, path string) error {
+	if value == nil {
+		if schema.Nullable {
+			return nil
+		}
+		return fmt.Errorf("%s is null", path)
+	}
+
+	switch schema.Type {
+	case genai.TypeString:
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s isn't a string", path)
+		}
+		if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, text) {
+			return fmt.Errorf("%s is %q, not one of %q", path, text, schema.Enum)
+		}
+	case genai.TypeNumber:
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s isn't a number", path)
+		}
+	case genai.TypeInteger:
+		if number, ok := value.(float64); !ok || number != math.Trunc(number) {
+			return fmt.Errorf("%s isn't an integer", path)
+		}
+	case genai.TypeBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s isn't a boolean", path)
+		}
+	case genai.TypeArray:
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s isn't an array", path)
+		}
+		if schema.Items == nil {
+			return nil
+		}
+		for n, item := range items {
+			if err := validateJSON(item, schema.Items, fmt.Sprintf("%s[%d]", path, n)); err != nil {
+				return err
+			}
+		}
+	case genai.TypeObject:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s isn't an object", path)
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s is missing %q", path, name)
+			}
+		}
+		for name, property := range schema.Properties {
+			if field, ok := object[name]; ok {
+				if err := validateJSON(field, property, path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
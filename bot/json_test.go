@@ -0,0 +1,102 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+// jsonInteraction is a /json command with the given options
+func jsonInteraction(options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	i := commandInteraction("json")
+	i.Data = discordgo.ApplicationCommandInteractionData{Name: "json", Options: options}
+	return i
+}
+
+func TestJSONCommand(t *testing.T) {
+	schema := `{"type":"object","properties":{"name":{"type":"string"},"age":{"type":"integer"}},"required":["name"]}`
+	tests := []struct {
+		name    string
+		options []*discordgo.ApplicationCommandInteractionDataOption
+		reply   string
+		want    string
+	}{
+		{"any JSON", []*discordgo.ApplicationCommandInteractionDataOption{stringOption("prompt", "a person")},
+			`{"name":"Ada","age":36}`, "```json\n{\n  \"name\": \"Ada\",\n  \"age\": 36\n}\n```"},
+		{"matching schema", []*discordgo.ApplicationCommandInteractionDataOption{stringOption("prompt", "a person"), stringOption("schema", schema)},
+			`{"name":"Ada"}`, "```json\n{\n  \"name\": \"Ada\"\n}\n```"},
+		{"not matching schema", []*discordgo.ApplicationCommandInteractionDataOption{stringOption("prompt", "a person"), stringOption("schema", schema)},
+			`{"age":36.5}`, "Sorry, the model returned invalid JSON: $ is missing \"name\"\n```\n{\"age\":36.5}\n```"},
+		{"not JSON", []*discordgo.ApplicationCommandInteractionDataOption{stringOption("prompt", "a person")},
+			`Ada`, "Sorry, the model returned invalid JSON: invalid character 'A' looking for beginning of value\n```\nAda\n```"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, session := newTestBot(t, &fakeAI{text: test.reply})
+
+			b.HandleInteraction(jsonInteraction(test.options...))
+
+			if len(session.edits) != 1 || *session.edits[0].Content != test.want {
+				t.Errorf("edits = %v, want %q", session.edits, test.want)
+			}
+		})
+	}
+}
+
+func TestJSONCommandRejectsBadSchemas(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+
+	b.HandleInteraction(jsonInteraction(stringOption("prompt", "a person"), stringOption("schema", `{"type":"object","title":"Person"}`)))
+
+	want := `Sorry, an error occurred: error parsing schema: json: unknown field "title"`
+	if len(session.responses) != 1 || session.responses[0].Data.Content != want {
+		t.Errorf("responded %v, want %q", session.responses, want)
+	}
+}
+
+func TestParseSchema(t *testing.T) {
+	schema, err := parseSchema(`{"type":"array","items":{"type":"string","enum":["a","b"]}}`)
+	if err != nil || schema.Type != genai.TypeArray || schema.Items.Type != genai.TypeString || len(schema.Items.Enum) != 2 {
+		t.Errorf("parseSchema = %+v, %v", schema, err)
+	}
+
+	_, err = parseSchema(`{"type":"object","properties":{"tags":{"type":"list"}}}`)
+	if err == nil || !strings.Contains(err.Error(), `$.tags has type "list"`) {
+		t.Errorf("parseSchema with an unknown type = %v", err)
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"tags":  {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString, Enum: []string{"go", "rust"}}},
+			"count": {Type: genai.TypeInteger, Nullable: true},
+			"ok":    {Type: genai.TypeBoolean},
+		},
+		Required: []string{"tags"},
+	}
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{map[string]any{"tags": []any{"go"}, "count": nil, "ok": true}, ""},
+		{map[string]any{"tags": []any{"go", "zig"}}, `$.tags[1] is "zig", not one of ["go" "rust"]`},
+		{map[string]any{"tags": []any{}, "count": 1.5}, "$.count isn't an integer"},
+		{map[string]any{"tags": []any{}, "ok": "yes"}, "$.ok isn't a boolean"},
+		{map[string]any{}, `$ is missing "tags"`},
+		{[]any{}, "$ isn't an object"},
+		{nil, "$ is null"},
+	}
+	for _, test := range tests {
+		got := ""
+		if err := validateJSON(test.value, schema, "$"); err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("validateJSON(%v) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// Size of knowledge base chunks and the overlap between them, in characters
+	kbChunkSize    = 1500
+	kbChunkOverlap = 200
+
+	// Chunks retrieved for each question
+	kbResultCount = 4
+
+	// Minimum similarity for a chunk to be added to chat messages
+	kbChatMinScore = 0.6
+
+	// Largest document /kb add will fetch from a URL
+	maxKBDocumentSize = 20 << 20
+)
+
+// kbChunk is a knowledge base chunk returned by a search
+type kbChunk struct {
+	Source  string
+	Content string
+	Score   float64
+}
+
+// kbCommand handles the /kb subcommands
+func (b *Bot) kbCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "The knowledge base only works in servers."))
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	switch subcommand.Name {
+	case "ask":
+		b.kbAsk(i, commandOption(subcommand.Options, "question").StringValue())
+	case "add", "remove", "list":
+		if i.Member == nil || i.Member.Permissions&discordgo.PermissionManageServer == 0 {
+			b.respondEphemeral(i, tr(i, "You need the Manage Server permission to change the knowledge base."))
+			return
+		}
+		switch subcommand.Name {
+		case "add":
+			b.kbAdd(i, subcommand.Options)
+		case "remove":
+			b.kbRemove(i, commandOption(subcommand.Options, "source").StringValue())
+		case "list":
+			b.kbList(i)
+		}
+	}
+}
+
+// kbAdd adds an attached document or a web page to the knowledge base
+func (b *Bot) kbAdd(i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to kb command", "error", err)
+		return
+	}
+
+	var source, mimeType string
+	var data []byte
+	var err error
+	if option := commandOption(options, "file"); option != nil {
+		attachment := i.ApplicationCommandData().Resolved.Attachments[option.Value.(string)]
+		source, mimeType = attachment.Filename, attachment.ContentType
+		data, err = downloadAttachment(attachment)
+	} else if option := commandOption(options, "url"); option != nil {
+		source = option.StringValue()
+		data, mimeType, err = fetchDocument(source, maxKBDocumentSize)
+	} else {
+		b.editInteractionResponse(i, tr(i, "Attach a file or give a URL to add."))
+		return
+	}
+	if err != nil {
+		interactionLogger(i).Error("Error reading document", "source", source, "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, I couldn't read %s: %v", source, err))
+		return
+	}
+
+	text, err := b.documentText(i, data, mimeType)
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	// Web pages and files may hide instructions for the model answering
+	// from them, they're stripped once here
+	text, found := neutralizeInjections(text)
+	if len(found) > 0 {
+		b.reportInjection(interactionUserID(i), i.GuildID, source, text, found)
+	}
+	chunks := chunkText(text, kbChunkSize, kbChunkOverlap)
+	if len(chunks) == 0 {
+		b.editInteractionResponse(i, tr(i, "That document has no text to add."))
+		return
+	}
+
+	vectors, err := b.ai.EmbedDocuments(b.ctx, chunks)
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if err := b.store.AddKBSource(i.GuildID, source, chunks, vectors); err != nil {
+		interactionLogger(i).Error("Error storing knowledge base chunks", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, I couldn't save that document."))
+		return
+	}
+	b.editInteractionResponse(i, tr(i, "Added **%s** to the knowledge base (%d chunks).", source, len(chunks)))
+}
+
+// kbAsk answers a question from the knowledge base, citing its sources
+func (b *Bot) kbAsk(i *discordgo.InteractionCreate, question string) {
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to kb command", "error", err)
+		return
+	}
+
+	chunks, err := b.searchKnowledge(i.GuildID, question, kbResultCount)
+	if err != nil {
+		interactionLogger(i).Error("Error searching knowledge base", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if len(chunks) == 0 {
+		b.editInteractionResponse(i, tr(i, "The knowledge base is empty, add documents with `/kb add`."))
+		return
+	}
+
+	prompt := fmt.Sprintf("Answer the question using only the excerpts below. "+
+		"If they don't contain the answer, say so.\n\n%s\n\nQuestion: %s",
+		b.untrusted(interactionUserID(i), i.GuildID, "the server's knowledge base", formatKBChunks(chunks)), question)
+	answer, err := b.generate(interactionUserID(i), i.GuildID, genai.Text(prompt))
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+
+	// List each source once, in order of relevance
+	var sources []string
+	for _, chunk := range chunks {
+		if !slices.Contains(sources, chunk.Source) {
+			sources = append(sources, chunk.Source)
+		}
+	}
+	b.editInteractionResponseLong(i, fmt.Sprintf("> %s\n\n%s\n\n-# Sources: %s",
+		question, answer, strings.Join(sources, ", ")), 0)
+}
+
+// kbRemove deletes every chunk of a source from the knowledge base
+func (b *Bot) kbRemove(i *discordgo.InteractionCreate, source string) {
+	removed, err := b.store.RemoveKBSource(i.GuildID, source)
+	if err != nil {
+		interactionLogger(i).Error("Error removing knowledge base source", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, I couldn't remove that source."))
+		return
+	}
+	if !removed {
+		b.respondEphemeral(i, tr(i, "There is no source named **%s**.", source))
+		return
+	}
+	b.respondEphemeral(i, tr(i, "Removed **%s** from the knowledge base.", source))
+}
+
+// kbList lists the knowledge base's sources
+func (b *Bot) kbList(i *discordgo.InteractionCreate) {
+	sources, err := b.store.KBSources(i.GuildID)
+	if err != nil {
+		interactionLogger(i).Error("Error listing knowledge base", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, I couldn't list the knowledge base."))
+		return
+	}
+
+	var lines []string
+	for _, source := range sources {
+		lines = append(lines, tr(i, "- %s (%d chunks)", source.Name, source.Chunks))
+	}
+	if len(lines) == 0 {
+		b.respondEphemeral(i, tr(i, "The knowledge base is empty."))
+		return
+	}
+	b.respondEphemeral(i, truncate(strings.Join(lines, "\n"), 2000))
+}
+
+// knowledgeContext returns knowledge base excerpts relevant to a chat message
+// of userID, or an empty string if the guild has none
+func (b *Bot) knowledgeContext(userID string, guildID string, message string) string {
+	chunks, err := b.searchKnowledge(guildID, message, kbResultCount)
+	if err != nil {
+		slog.Error("Error searching knowledge base", "guild", guildID, "error", err)
+		return ""
+	}
+	var relevant []kbChunk
+	for _, chunk := range chunks {
+		if chunk.Score >= kbChatMinScore {
+			relevant = append(relevant, chunk)
+		}
+	}
+	if len(relevant) == 0 {
+		return ""
+	}
+	return "Excerpts from this server's knowledge base that may help answer the next message:\n\n" +
+		b.untrusted(userID, guildID, "the server's knowledge base", formatKBChunks(relevant))
+}
+
+// searchKnowledge returns the guild's chunks most similar to the query
+func (b *Bot) searchKnowledge(guildID string, query string, limit int) ([]kbChunk, error) {
+	stored, err := b.store.KBChunks(guildID)
+	if err != nil {
+		return nil, err
+	}
+	// Don't spend an embedding request on guilds without a knowledge base
+	if len(stored) == 0 {
+		return nil, nil
+	}
+
+	queryVector, err := b.ai.EmbedQuery(b.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make([]kbChunk, len(stored))
+	for n, chunk := range stored {
+		chunks[n] = kbChunk{
+			Source:  chunk.Source,
+			Content: chunk.Content,
+			Score:   cosineSimilarity(queryVector, chunk.Vector),
+		}
+	}
+	sort.Slice(chunks, func(a, b int) bool { return chunks[a].Score > chunks[b].Score })
+	return chunks[:min(limit, len(chunks))], nil
+}
+
+// formatKBChunks renders chunks as numbered excerpts for a prompt
+func formatKBChunks(chunks []kbChunk) string {
+	var b strings.Builder
+	for n, chunk := range chunks {
+		fmt.Fprintf(&b, "[%d] From %s:\n%s\n\n", n+1, chunk.Source, chunk.Content)
+	}
+	return b.String()
+}
+
+// fetchClient downloads documents from links members give, connecting only
+// to public addresses so links can't reach the bot's own host or network,
+// however they're resolved or redirected
+var fetchClient = &http.Client{
+	Timeout: time.Minute,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 30 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !fetchableAddress(ip) {
+					return fmt.Errorf("%s isn't a public address", host)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("too many redirects")
+		}
+		return fetchableURL(req.URL)
+	},
+}
+
+// fetchableAddress reports whether fetchDocument may connect to an address,
+// replaced in tests to reach local servers
+var fetchableAddress = publicAddress
+
+// publicAddress reports whether an IP address is reachable from the
+// internet, rather than loopback, private, link-local (like the cloud
+// metadata address 169.254.169.254) or otherwise special
+func publicAddress(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified() && !sharedAddresses.Contains(ip)
+}
+
+// Carrier-grade NAT addresses, private to a provider's network
+var sharedAddresses = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// fetchableURL returns an error for links fetchDocument won't follow, those
+// that aren't on the web
+func fetchableURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("only http and https links can be read, not %q", u.Scheme)
+	}
+	return nil
+}
+
+// fetchDocument downloads a document of at most limit bytes from a public
+// web address
+func fetchDocument(link string, limit int) ([]byte, string, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := fetchableURL(u); err != nil {
+		return nil, "", err
+	}
+	resp, err := fetchClient.Get(u.String())
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > limit {
+		return nil, "", fmt.Errorf("file is larger than %d MB", limit>>20)
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// documentText returns the plain text of a document, asking Gemini to
+// extract it from formats such as PDF and HTML
+func (b *Bot) documentText(i *discordgo.InteractionCreate, data []byte, mimeType string) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	switch mediaType {
+	case "text/plain", "text/markdown", "text/csv", "application/json":
+		return string(data), nil
+	}
+
+	part, err := b.aiFor(i.GuildID).UploadFile(b.ctx, data, mediaType, "")
+	if err != nil {
+		return "", err
+	}
+	return b.generate(interactionUserID(i), i.GuildID, part, genai.Text("Extract all the text of this document as plain text, "+
+		"leaving out navigation and other page chrome. Reply with only the text."))
+}
+
+// chunkText splits text into chunks of at most size characters that overlap
+// by overlap characters, preferring to break at whitespace
+func chunkText(text string, size int, overlap int) []string {
+	runes := []rune(strings.TrimSpace(text))
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := min(start+size, len(runes))
+		if end < len(runes) {
+			// Back up to the last whitespace in the second half of the chunk
+			for cut := end; cut > start+size/2; cut-- {
+				if runes[cut] == ' ' || runes[cut] == '\n' {
+					end = cut
+					break
+				}
+			}
+		}
+		if chunk := strings.TrimSpace(string(runes[start:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if end == len(runes) {
+			break
+		}
+		start = max(end-overlap, start+1)
+	}
+	return chunks
+}
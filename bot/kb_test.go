@@ -0,0 +1,112 @@
+package bot
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunkText(t *testing.T) {
+	text := strings.Repeat("lorem ipsum dolor sit amet ", 200)
+	chunks := chunkText(text, 1500, 200)
+	if len(chunks) < 4 {
+		t.Fatalf("chunkText returned %d chunks, want at least 4", len(chunks))
+	}
+	for n, chunk := range chunks {
+		if utf8.RuneCountInString(chunk) > 1500 {
+			t.Errorf("chunk %d has %d characters", n, utf8.RuneCountInString(chunk))
+		}
+		if strings.HasPrefix(chunk, " ") || strings.HasSuffix(chunk, " ") {
+			t.Errorf("chunk %d isn't trimmed", n)
+		}
+	}
+	// Consecutive chunks overlap
+	for n := 1; n < len(chunks); n++ {
+		tail := chunks[n-1][len(chunks[n-1])-50:]
+		if !strings.Contains(chunks[n], tail) {
+			t.Errorf("chunk %d doesn't overlap the previous one", n)
+		}
+	}
+}
+
+func TestChunkTextShort(t *testing.T) {
+	if chunks := chunkText("  short  ", 1500, 200); len(chunks) != 1 || chunks[0] != "short" {
+		t.Errorf("chunkText = %q, want [short]", chunks)
+	}
+	if chunks := chunkText("   ", 1500, 200); len(chunks) != 0 {
+		t.Errorf("chunkText of blank text = %q, want none", chunks)
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b []float32
+		want float64
+	}{
+		{[]float32{1, 0}, []float32{1, 0}, 1},
+		{[]float32{1, 0}, []float32{0, 1}, 0},
+		{[]float32{1, 0}, []float32{-1, 0}, -1},
+		{[]float32{1, 0}, []float32{1, 0, 0}, 0},
+		{[]float32{0, 0}, []float32{1, 0}, 0},
+	}
+	for _, test := range tests {
+		if got := cosineSimilarity(test.a, test.b); got != test.want {
+			t.Errorf("cosineSimilarity(%v, %v) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestFetchDocument(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	// Links to the bot's own host, other schemes and redirects elsewhere are
+	// refused
+	for _, link := range []string{server.URL, "file:///etc/passwd", "gopher://example.com/"} {
+		if _, _, err := fetchDocument(link, 100); err == nil {
+			t.Errorf("fetchDocument(%q) succeeded, want it refused", link)
+		}
+	}
+	allowLocalFetch(t)
+	if data, _, err := fetchDocument(server.URL, 100); err != nil || string(data) != "hello" {
+		t.Errorf("fetchDocument = %q, %v, want the document", data, err)
+	}
+	fetchableAddress = func(ip net.IP) bool { return ip.IsLoopback() }
+	if _, _, err := fetchDocument(server.URL+"/moved", 100); err == nil || !strings.Contains(err.Error(), "169.254.169.254 isn't a public address") {
+		t.Errorf("fetchDocument of a redirect = %v, want it refused", err)
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	for _, test := range []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:2800:21f:cb07:6820:80da:af6b:8b2c", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+	} {
+		if got := publicAddress(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("publicAddress(%s) = %v, want %v", test.ip, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package bot
+
+import "testing"
+
+func TestResponseMath(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+	answer := "The area is $\\pi r^2$, see `$x$`."
+
+	b.sendResponse("channel", answer, "", false, "", nil)
+	b.config().MathUnicode = true
+	b.sendResponse("channel", answer, "", false, "", nil)
+
+	want := []string{answer, "The area is π r², see `$x$`."}
+	if len(session.messages) != 2 || session.messages[0] != want[0] || session.messages[1] != want[1] {
+		t.Errorf("sent %q, want %q", session.messages, want)
+	}
+}
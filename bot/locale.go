@@ -0,0 +1,41 @@
+package bot
+
+import (
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/i18n"
+)
+
+// interactionLocale returns the language of the user of an interaction, or
+// of their server when Discord doesn't say
+func interactionLocale(i *discordgo.InteractionCreate) discordgo.Locale {
+	if i.Locale == "" && i.GuildLocale != nil {
+		return *i.GuildLocale
+	}
+	return i.Locale
+}
+
+// tr translates text into the language of the user of an interaction,
+// formatting it with args like fmt.Sprintf when there are any
+func tr(i *discordgo.InteractionCreate, text string, args ...any) string {
+	return i18n.Translate(interactionLocale(i), text, args...)
+}
+
+// guildLocale returns a server's preferred language, used for messages that
+// don't answer a command, or English in DMs
+func (b *Bot) guildLocale(guildID string) discordgo.Locale {
+	if guildID == "" {
+		return ""
+	}
+	guild, err := b.session.Guild(guildID)
+	if err != nil {
+		return ""
+	}
+	return discordgo.Locale(guild.PreferredLocale)
+}
+
+// trGuild translates text into a server's preferred language, formatting
+// it with args like fmt.Sprintf when there are any
+func (b *Bot) trGuild(guildID string, text string, args ...any) string {
+	return i18n.Translate(b.guildLocale(guildID), text, args...)
+}
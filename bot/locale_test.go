@@ -0,0 +1,166 @@
+package bot
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/i18n"
+)
+
+// Slash command names as Discord allows them
+var slashName = regexp.MustCompile(`^[-_\p{Ll}\p{Lo}\p{N}]{1,32}$`)
+
+func TestCommandTranslations(t *testing.T) {
+	var check func(command string, options []*discordgo.ApplicationCommandOption)
+	translated := func(command, text string) {
+		for _, language := range i18n.Languages() {
+			if got := i18n.Translate(discordgo.Locale(language), text); got == text || len([]rune(got)) > 100 {
+				t.Errorf("%s: %q in %s is %q, want a translation of at most 100 characters", command, text, language, got)
+			}
+		}
+	}
+	check = func(command string, options []*discordgo.ApplicationCommandOption) {
+		for _, option := range options {
+			translated(command, option.Description)
+			check(command, option.Options)
+		}
+	}
+	for _, command := range Commands {
+		if commandType(command) == discordgo.ChatApplicationCommand {
+			translated(command.Name, command.Description)
+			for _, language := range i18n.Languages() {
+				if name := i18n.Name(discordgo.Locale(language), command.Name); !slashName.MatchString(name) {
+					t.Errorf("%s in %s is %q, not a valid command name", command.Name, language, name)
+				}
+			}
+		} else {
+			translated(command.Name, contextMenuHelp[command.Name])
+		}
+		check(command.Name, command.Options)
+	}
+}
+
+func TestInteractionLocale(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+
+	i := commandInteraction("clear")
+	i.ChannelID = "channel"
+	i.Locale = discordgo.German
+	b.HandleInteraction(i)
+	if len(session.responses) != 1 || session.responses[0].Data.Content != "Der Chatverlauf wurde gelöscht!" {
+		t.Errorf("responses = %v, want a German confirmation", session.responses)
+	}
+
+	// The server's language when Discord doesn't give the user's
+	french := discordgo.French
+	i = commandInteraction("clear")
+	i.GuildLocale = &french
+	if got := tr(i, "Sorry, an error occurred: %v", "quota"); got != "Désolé, une erreur s'est produite : quota" {
+		t.Errorf("tr = %q, want French", got)
+	}
+}
+
+// Functions sending what they are passed to users of an interaction, which
+// must be translated first
+var interactionReplies = map[string]bool{"respondEphemeral": true, "editInteractionResponse": true}
+
+func TestRepliesTranslated(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			switch name := calledName(call); {
+			case interactionReplies[name] && len(call.Args) == 2:
+				// Replies are translated, or built from translated text
+				if untranslated(call.Args[1]) {
+					t.Errorf("%s: %s is passed English text, translate it with tr", fset.Position(call.Pos()), name)
+				}
+			case (name == "tr" || name == "trGuild") && len(call.Args) >= 2:
+				// What is translated has a translation in every language
+				if text, ok := stringLiteral(call.Args[1]); ok {
+					for _, language := range i18n.Languages() {
+						if !i18n.Has(discordgo.Locale(language), text) {
+							t.Errorf("%s: %q has no %s translation", fset.Position(call.Pos()), text, language)
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+}
+
+// calledName returns the name of the function or method a call calls
+func calledName(call *ast.CallExpr) string {
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		return fun.Name
+	case *ast.SelectorExpr:
+		return fun.Sel.Name
+	}
+	return ""
+}
+
+// Markdown code fences, which aren't text to translate
+var codeFence = regexp.MustCompile("```[a-z]*")
+
+// untranslated reports whether an expression is English text: a string
+// literal with words, text concatenated with one, or formatted from one
+func untranslated(expr ast.Expr) bool {
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		text, _ := strconv.Unquote(expr.Value)
+		return expr.Kind == token.STRING && strings.ContainsFunc(codeFence.ReplaceAllString(text, ""), unicode.IsLetter)
+	case *ast.BinaryExpr:
+		return untranslated(expr.X) || untranslated(expr.Y)
+	case *ast.CallExpr:
+		switch calledName(expr) {
+		case "Sprintf", "Sprint":
+			return true
+		case "truncate", "TrimSpace":
+			return untranslated(expr.Args[0])
+		}
+	}
+	return false
+}
+
+// stringLiteral returns the text of a string literal, or of literals
+// concatenated
+func stringLiteral(expr ast.Expr) (string, bool) {
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		if expr.Kind != token.STRING {
+			return "", false
+		}
+		text, err := strconv.Unquote(expr.Value)
+		return text, err == nil
+	case *ast.BinaryExpr:
+		x, ok := stringLiteral(expr.X)
+		y, ok2 := stringLiteral(expr.Y)
+		return x + y, ok && ok2 && expr.Op == token.ADD
+	}
+	return "", false
+}
@@ -0,0 +1,18 @@
+package bot
+
+import (
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// messageLogger returns a logger carrying the guild, channel and author of a message
+func messageLogger(m *discordgo.MessageCreate) *slog.Logger {
+	return withShard(slog.With("guild", m.GuildID, "channel", m.ChannelID, "user", m.Author.ID), m.GuildID)
+}
+
+// interactionLogger returns a logger carrying the guild, channel and user of
+// an interaction
+func interactionLogger(i *discordgo.InteractionCreate) *slog.Logger {
+	return withShard(slog.With("guild", i.GuildID, "channel", i.ChannelID, "user", interactionUserID(i)), i.GuildID)
+}
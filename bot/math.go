@@ -0,0 +1,136 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/script"
+)
+
+// Times the model may write a program for /math, fixing the previous one
+// after it fails
+const maxMathAttempts = 2
+
+// What /math asks of the model, before the question
+const mathInstructions = "Solve the math question below. Don't compute anything in your head: write a program that does."
+
+// mathSolution is the model's plan for a /math question: how to solve it,
+// and a program computing the answer
+type mathSolution struct {
+	Reasoning string `json:"reasoning"`
+	Program   string `json:"program"`
+}
+
+// mathSchema is the JSON the model answers /math with
+var mathSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"reasoning": {
+			Type: genai.TypeString,
+			Description: "How to solve the problem, step by step in Markdown, in the language of the question. " +
+				"Say what each step computes without doing the arithmetic yourself: the program computes every number.",
+		},
+		"program": {
+			Type: genai.TypeString,
+			Description: "A Starlark program (a Python subset without imports, classes or exceptions; ints are exact and unbounded, " +
+				"and a math module has sqrt, pow, round, floor, log, exp, sin, cos, pi, e…) computing the answer, printing the intermediate " +
+				"values of the steps with labels and assigning the final answer, with its unit if any, to a variable named result",
+		},
+	},
+	Required: []string{"reasoning", "program"},
+}
+
+// mathCommand handles /math, answering a math question with a computed
+// result rather than the model's own arithmetic: the model explains how to
+// solve it and writes a program that the sandbox runs, and both the
+// reasoning and the computed result are shown. A failing program is sent
+// back to the model to fix once.
+func (b *Bot) mathCommand(i *discordgo.InteractionCreate) {
+	question := commandOption(i.ApplicationCommandData().Options, "question").StringValue()
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to math command", "error", err)
+		return
+	}
+
+	prompt := mathInstructions + "\n\n" + question
+	var solution mathSolution
+	var computation script.Computation
+	for attempt := 1; attempt <= maxMathAttempts; attempt++ {
+		solution, err = b.solveMath(i, prompt)
+		if err != nil {
+			interactionLogger(i).Error("Gemini error", "error", err)
+			b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+		computation, err = script.Compute(extractCode(solution.Program))
+		if err == nil {
+			break
+		}
+		interactionLogger(i).Info("Math program failed", "attempt", attempt, "error", err)
+		prompt = fmt.Sprintf("%s\n\n%s\n\nYour previous program failed with this error, fix it:\n%v\n\n%s",
+			mathInstructions, question, err, solution.Program)
+	}
+
+	embeds := []*discordgo.MessageEmbed{mathEmbed(i, question, solution, computation, err)}
+	content := ""
+	_, editErr := b.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:         &content,
+		Embeds:          &embeds,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if editErr != nil {
+		interactionLogger(i).Error("Error sending math answer", "error", editErr)
+		return
+	}
+	interactionLogger(i).Info("Answered math question", "computed", err == nil)
+}
+
+// solveMath asks the model for the reasoning and program of a /math prompt
+func (b *Bot) solveMath(i *discordgo.InteractionCreate, prompt string) (mathSolution, error) {
+	text, err := b.generateJSON(interactionUserID(i), i.GuildID, mathSchema, genai.Text(prompt))
+	if err != nil {
+		return mathSolution{}, err
+	}
+	var solution mathSolution
+	if err := json.Unmarshal([]byte(text), &solution); err != nil {
+		return mathSolution{}, fmt.Errorf("error parsing solution: %v", err)
+	}
+	return solution, nil
+}
+
+// mathEmbed shows the reasoning of a /math answer with the result its
+// program computed, or why it couldn't be computed, and the program itself
+func mathEmbed(i *discordgo.InteractionCreate, question string, solution mathSolution, computation script.Computation, err error) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       "🧮 " + cleanTitle(question, 200),
+		Description: truncate(strings.TrimSpace(solution.Reasoning), embedDescriptionLimit),
+		Color:       embedColor,
+		Footer:      &discordgo.MessageEmbedFooter{Text: tr(i, "The result was computed by running the program, not by the AI.")},
+	}
+	if err != nil {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  tr(i, "Result"),
+			Value: truncate(tr(i, "⚠️ I couldn't compute the result, so the reasoning above isn't verified: %v", err), 1024),
+		})
+		embed.Footer = nil
+	} else {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: tr(i, "Result"), Value: fieldCodeBlock("", computation.Result)})
+		if computation.Output != "" {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: tr(i, "Intermediate values"), Value: fieldCodeBlock("", computation.Output)})
+		}
+	}
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: tr(i, "Program"), Value: fieldCodeBlock("python", extractCode(solution.Program))})
+	return embed
+}
+
+// fieldCodeBlock puts text in a code block fitting in an embed field
+func fieldCodeBlock(tag string, text string) string {
+	return "```" + tag + "\n" + truncate(strings.ReplaceAll(text, "```", "'''"), 1000) + "\n```"
+}
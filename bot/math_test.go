@@ -0,0 +1,46 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestMathCommand(t *testing.T) {
+	client := &fakeAI{text: `{"reasoning": "1. Grow the principal by 4% a year for 7 years.\n2. Subtract the principal.", ` +
+		`"program": "principal = 1200\ntotal = principal * math.pow(1.04, 7)\nprint(\"total\", int(math.round(total)))\nresult = \"%d\" % int(math.round(total - principal))"}`}
+	b, session := newTestBot(t, client)
+	question := func(text string) *discordgo.InteractionCreate {
+		i := commandInteraction("math")
+		i.Data = discordgo.ApplicationCommandInteractionData{Name: "math", Options: []*discordgo.ApplicationCommandInteractionDataOption{stringOption("question", text)}}
+		return i
+	}
+
+	b.HandleInteraction(question("Compound interest on 1200 at 4% over 7 years?"))
+	if len(session.edits) != 1 || len(*session.edits[0].Embeds) != 1 {
+		t.Fatalf("edits = %v, want the answer embed", session.edits)
+	}
+	embed := (*session.edits[0].Embeds)[0]
+	if !strings.HasPrefix(embed.Description, "1. Grow the principal") || len(embed.Fields) != 3 {
+		t.Fatalf("embed = %+v, want the reasoning, result, intermediate values and program", embed)
+	}
+	if embed.Fields[0].Value != "```\n379\n```" || embed.Fields[1].Value != "```\ntotal 1579\n```" {
+		t.Errorf("fields = %+v, want the computed values", embed.Fields)
+	}
+	if embed.Footer == nil || !strings.Contains(embed.Footer.Text, "computed by running the program") {
+		t.Errorf("footer = %+v, want the result marked as computed", embed.Footer)
+	}
+
+	// A failing program is sent back to be fixed once, then shown as unverified
+	client.text = `{"reasoning": "Divide by zero.", "program": "result = 1 / 0"}`
+	client.prompts = nil
+	b.HandleInteraction(question("1/0?"))
+	if len(client.prompts) != 2 || !strings.Contains(partsText(client.prompts[1]), "failed with this error, fix it:\nfloating-point division by zero") {
+		t.Fatalf("prompts = %q, want the error sent back once", client.prompts)
+	}
+	embed = (*session.edits[1].Embeds)[0]
+	if !strings.Contains(embed.Fields[0].Value, "I couldn't compute the result") || embed.Footer != nil {
+		t.Errorf("embed = %+v, want the result marked as unverified", embed)
+	}
+}
@@ -0,0 +1,153 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/store"
+)
+
+const (
+	// Facts remembered per user
+	maxUserMemories = 50
+
+	// Rounds of tool calls answered before giving up on a chat message
+	maxToolRounds = 5
+)
+
+// MemoryTool lets the model store durable facts about the user it is talking to
+var MemoryTool = &genai.Tool{
+	FunctionDeclarations: []*genai.FunctionDeclaration{{
+		Name: "remember_fact",
+		Description: "Store a durable fact about the user who sent the current message, such as a preference, " +
+			"their timezone or what they work on, so it can be recalled in future conversations. " +
+			"Only use it for facts the user would expect you to remember, never for secrets.",
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"fact": {
+					Type:        genai.TypeString,
+					Description: "The fact, as a short sentence such as \"Prefers Python\"",
+				},
+			},
+			Required: []string{"fact"},
+		},
+	}},
+}
+
+// sendChatMessage sends a message to a chat on behalf of a user, answering
+// any memory tool calls until the model replies with text. The reply's token
+// counts cover every round.
+func (b *Bot) sendChatMessage(ctx context.Context, chat ai.Chat, userID string, parts ...genai.Part) (*ai.Reply, error) {
+	reply, err := chat.Send(ctx, parts...)
+	for round := 0; err == nil && round < maxToolRounds && len(reply.FunctionCalls) > 0; round++ {
+		var responses []genai.Part
+		for _, call := range reply.FunctionCalls {
+			responses = append(responses, genai.FunctionResponse{
+				Name:     call.Name,
+				Response: b.handleToolCall(userID, call),
+			})
+		}
+		previous := reply
+		reply, err = chat.Send(ctx, responses...)
+		if err == nil {
+			reply.PromptTokens += previous.PromptTokens
+			reply.ResponseTokens += previous.ResponseTokens
+		}
+	}
+	return reply, err
+}
+
+// handleToolCall runs a tool call for a user and returns its result
+func (b *Bot) handleToolCall(userID string, call genai.FunctionCall) map[string]any {
+	switch call.Name {
+	case "remember_fact":
+		fact, _ := call.Args["fact"].(string)
+		fact = strings.TrimSpace(fact)
+		if fact == "" {
+			return map[string]any{"error": "fact is empty"}
+		}
+		err := b.state().AddMemory(userID, fact, maxUserMemories)
+		if errors.Is(err, store.ErrMemoryFull) {
+			return map[string]any{"error": fmt.Sprintf("memory is full (%d facts), the user can remove some with /memory forget", maxUserMemories)}
+		}
+		if err != nil {
+			slog.Error("Error storing memory", "user", userID, "error", err)
+			return map[string]any{"error": err.Error()}
+		}
+		return map[string]any{"result": "remembered"}
+	}
+	return map[string]any{"error": "unknown function " + call.Name}
+}
+
+// memoryContext returns the facts remembered about a user for a prompt, or
+// an empty string if there are none
+func (b *Bot) memoryContext(userID string, username string) string {
+	memories, err := b.state().Memories(userID)
+	if err != nil {
+		slog.Error("Error loading memories", "user", userID, "error", err)
+		return ""
+	}
+	if len(memories) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "What you remember about %s, who sent the next message:\n", username)
+	for _, memory := range memories {
+		fmt.Fprintf(&sb, "- %s\n", memory.Fact)
+	}
+	return sb.String()
+}
+
+// memoryCommand handles /memory list, /memory forget and /memory wipe
+func (b *Bot) memoryCommand(i *discordgo.InteractionCreate) {
+	userID := interactionUserID(i)
+	subcommand := i.ApplicationCommandData().Options[0]
+
+	switch subcommand.Name {
+	case "list":
+		memories, err := b.state().Memories(userID)
+		if err != nil {
+			interactionLogger(i).Error("Error loading memories", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, I couldn't load your memories."))
+			return
+		}
+		if len(memories) == 0 {
+			b.respondEphemeral(i, tr(i, "I don't remember anything about you."))
+			return
+		}
+		var lines []string
+		for _, memory := range memories {
+			lines = append(lines, fmt.Sprintf("`%d` %s", memory.ID, memory.Fact))
+		}
+		b.respondEphemeral(i, truncate(strings.Join(lines, "\n"), 2000))
+	case "forget":
+		id := commandOption(subcommand.Options, "id").IntValue()
+		removed, err := b.state().DeleteMemory(userID, id)
+		if err != nil {
+			interactionLogger(i).Error("Error forgetting memory", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, I couldn't forget that."))
+			return
+		}
+		if !removed {
+			b.respondEphemeral(i, tr(i, "You have no memory with ID %d.", id))
+			return
+		}
+		b.respondEphemeral(i, tr(i, "Forgotten."))
+	case "wipe":
+		if err := b.state().DeleteMemories(userID); err != nil {
+			interactionLogger(i).Error("Error wiping memories", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, I couldn't wipe your memories."))
+			return
+		}
+		b.respondEphemeral(i, tr(i, "Everything I remembered about you has been forgotten."))
+	}
+}
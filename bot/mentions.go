@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	// User, role and channel mentions as Discord writes them, like <@123>,
+	// <@!123>, <@&123> or <#123>
+	mentionMarkup = regexp.MustCompile(`<(@!?|@&|#)(\d+)>`)
+
+	// Mentions pinging everyone in a channel
+	massMention = regexp.MustCompile(`@(everyone|here)`)
+
+	// Role mentions in answers
+	roleMention = regexp.MustCompile(`<@&(\d+)>`)
+)
+
+// promptMentions writes the user, role and channel mentions of a message's
+// content as readable names, like @alice, @Moderators or #general, so the
+// model reads who and what they are rather than IDs
+func (b *Bot) promptMentions(m *discordgo.Message, content string) string {
+	if !strings.Contains(content, "<") {
+		return content
+	}
+	var roles []*discordgo.Role
+	return mentionMarkup.ReplaceAllStringFunc(content, func(markup string) string {
+		match := mentionMarkup.FindStringSubmatch(markup)
+		kind, id := match[1], match[2]
+		switch kind {
+		case "#":
+			if channel, err := b.session.Channel(id); err == nil && channel.Name != "" {
+				return "#" + channel.Name
+			}
+			return "#unknown-channel"
+		case "@&":
+			if roles == nil && m.GuildID != "" {
+				if guild, err := b.session.Guild(m.GuildID); err == nil {
+					roles = guild.Roles
+				}
+			}
+			for _, role := range roles {
+				if role.ID == id {
+					return "@" + role.Name
+				}
+			}
+			return "@unknown-role"
+		default:
+			for _, user := range m.Mentions {
+				if user.ID == id {
+					return "@" + user.Username
+				}
+			}
+			return "@unknown-user"
+		}
+	})
+}
+
+// fixMentions disarms the mass and role mentions of text the model wrote:
+// @everyone and @here get a zero-width space so they can't ping, and role
+// mentions become the role's name. Answers are sent allowing no mentions
+// anyway, this keeps them from looking like pings.
+func (b *Bot) fixMentions(guildID, text string) string {
+	text = massMention.ReplaceAllString(text, "@\u200b$1")
+	if !strings.Contains(text, "<@&") {
+		return text
+	}
+	var roles []*discordgo.Role
+	if guildID != "" {
+		if guild, err := b.session.Guild(guildID); err == nil {
+			roles = guild.Roles
+		}
+	}
+	return roleMention.ReplaceAllStringFunc(text, func(markup string) string {
+		id := roleMention.FindStringSubmatch(markup)[1]
+		for _, role := range roles {
+			if role.ID == id {
+				return "@" + massMention.ReplaceAllString(role.Name, "@\u200b$1")
+			}
+		}
+		return "@role"
+	})
+}
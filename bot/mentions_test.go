@@ -0,0 +1,43 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+)
+
+func TestMentionsInPrompts(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "Sure! @everyone, <@&202> and @here: <@101> asked."}}}
+	b, session := newTestBot(t, client)
+	session.guilds = []*discordgo.Guild{{ID: "guild", Roles: []*discordgo.Role{{ID: "202", Name: "Moderators"}}}}
+	session.channels["303"] = &discordgo.Channel{ID: "303", Name: "rules"}
+
+	m := userMessage("<@101> read <#303> and ask <@&202>, not <@!404> in <#505>")
+	m.Mentions = []*discordgo.User{{ID: "101", Username: "bob"}}
+	b.HandleMessage(m)
+
+	prompt := partsText(client.chats[0].sent[0])
+	if !strings.Contains(prompt, "@bob read #rules and ask @Moderators, not @unknown-user in #unknown-channel") {
+		t.Errorf("prompt = %q, want mentions by name", prompt)
+	}
+
+	// Answers can't ping everyone or a role, and allow no mentions
+	if want := "Sure! @\u200beveryone, @Moderators and @\u200bhere: <@101> asked."; len(session.messages) != 1 || !strings.HasPrefix(session.messages[0], want) {
+		t.Errorf("messages = %q, want %q", session.messages, want)
+	}
+	if allowed := session.mentions[0]; allowed == nil || len(allowed.Parse) != 0 || len(allowed.Users) != 0 || len(allowed.Roles) != 0 {
+		t.Errorf("allowed mentions = %+v, want none", allowed)
+	}
+}
+
+func TestGeneratedMentions(t *testing.T) {
+	b, _ := newTestBot(t, &fakeAI{text: "Hey @everyone, ping <@&606>"})
+	text, err := b.generate("user", "guild", genai.Text("announce it"))
+	if err != nil || text != "Hey @\u200beveryone, ping @role" {
+		t.Errorf("generate = %q, %v, want mentions disarmed", text, err)
+	}
+}
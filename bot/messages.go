@@ -0,0 +1,148 @@
+package bot
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+// How often the typing indicator is refreshed, since Discord shows it for
+// about 10 seconds
+const typingInterval = 8 * time.Second
+
+// keepTyping shows the typing indicator in a channel until stop is called,
+// so long generations don't leave the channel looking idle
+func (b *Bot) keepTyping(channelID string) (stop func()) {
+	if err := b.session.ChannelTyping(channelID); err != nil {
+		slog.Debug("Error sending typing indicator", "channel", channelID, "error", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(typingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-b.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := b.session.ChannelTyping(channelID); err != nil {
+					slog.Debug("Error sending typing indicator", "channel", channelID, "error", err)
+				}
+			}
+		}
+	}()
+	return sync.OnceFunc(func() { close(done) })
+}
+
+// sendLongMessage sends text to a channel, split to fit Discord's message
+// limit, without pinging anyone it mentions
+func (b *Bot) sendLongMessage(channelID string, text string) {
+	for _, chunk := range splitMessage(text) {
+		_, err := b.session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+			Content:         chunk,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err != nil {
+			slog.Error("Error sending message", "channel", channelID, "error", err)
+			return
+		}
+	}
+}
+
+// uploadAttachments uploads supported attachments to the guild's AI
+// provider and returns them as parts, skipping any that fail. Instructions
+// found in text files are neutralized and reported for userID's request.
+func (b *Bot) uploadAttachments(userID string, guildID string, attachments []*discordgo.MessageAttachment) []genai.Part {
+	var parts []genai.Part
+	for _, attachment := range attachments {
+		// Determine file type using MIME types
+		isSupported := strings.HasPrefix(attachment.ContentType, "image/") ||
+			strings.HasPrefix(attachment.ContentType, "video/") ||
+			strings.HasPrefix(attachment.ContentType, "audio/") ||
+			strings.Contains(attachment.ContentType, "pdf") ||
+			strings.Contains(attachment.ContentType, "text/") ||
+			strings.Contains(attachment.ContentType, "application/")
+		if !isSupported {
+			continue
+		}
+
+		data, err := b.attachmentData(attachment)
+		if err != nil {
+			slog.Error("Error downloading attachment", "file", attachment.Filename, "error", err)
+			continue
+		}
+		// Text files may hide instructions for the model
+		if strings.HasPrefix(attachment.ContentType, "text/") {
+			text, found := neutralizeInjections(string(data))
+			if len(found) > 0 {
+				b.reportInjection(userID, guildID, "attached file "+attachment.Filename, text, found)
+				data = []byte(text)
+			}
+		}
+		part, err := b.aiFor(guildID).UploadFile(b.ctx, data, attachment.ContentType, attachment.Filename)
+		if err != nil {
+			slog.Error("Error uploading attachment", "file", attachment.Filename, "error", err)
+			continue
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// downloadAttachment reads the contents of a Discord attachment
+func downloadAttachment(attachment *discordgo.MessageAttachment) ([]byte, error) {
+	// Download the file
+	fileResp, err := http.Get(attachment.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading file: %v", err)
+	}
+	defer fileResp.Body.Close()
+
+	// Read file bytes
+	fileBytes, err := io.ReadAll(fileResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file bytes: %v", err)
+	}
+	return fileBytes, nil
+}
+
+// splitMessage splits text into chunks of at most 2000 characters,
+// Discord's message length limit, without cutting characters in half
+func splitMessage(text string) []string {
+	return splitText(text, 2000)
+}
+
+// splitText splits text into chunks of at most size characters, without
+// cutting characters in half
+func splitText(text string, size int) []string {
+	var chunks []string
+	runes := []rune(text)
+	for len(runes) > 0 {
+		chunkSize := size
+		if len(runes) < chunkSize {
+			chunkSize = len(runes)
+		}
+		chunks = append(chunks, string(runes[:chunkSize]))
+		runes = runes[chunkSize:]
+	}
+	return chunks
+}
+
+// truncate shortens text to at most limit characters, marking the cut with "..."
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-3]) + "..."
+}
@@ -0,0 +1,99 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		text   string
+		chunks int
+	}{
+		{"", 0},
+		{"hello", 1},
+		{strings.Repeat("a", 2000), 1},
+		{strings.Repeat("a", 2001), 2},
+		{strings.Repeat("é", 4000), 2},
+	}
+	for _, test := range tests {
+		chunks := splitMessage(test.text)
+		if len(chunks) != test.chunks {
+			t.Errorf("splitMessage(%d characters) returned %d chunks, want %d",
+				utf8.RuneCountInString(test.text), len(chunks), test.chunks)
+		}
+		if strings.Join(chunks, "") != test.text {
+			t.Errorf("splitMessage(%d characters) lost text", utf8.RuneCountInString(test.text))
+		}
+		for _, chunk := range chunks {
+			if !utf8.ValidString(chunk) {
+				t.Errorf("splitMessage returned invalid UTF-8 %q", chunk)
+			}
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		text  string
+		limit int
+		want  string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 5, "hello"},
+		{"hello world", 8, "hello..."},
+		{"ééééé", 4, "é..."},
+	}
+	for _, test := range tests {
+		if got := truncate(test.text, test.limit); got != test.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", test.text, test.limit, got, test.want)
+		}
+	}
+}
+
+func TestResponsePreview(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Intro.\n\nDetails.", "Intro."},
+		{strings.Repeat("a", 400), strings.Repeat("a", 297) + "..."},
+		{"```go\n" + strings.Repeat("x", 400), "```go\n" + strings.Repeat("x", 291) + "...\n```"},
+	}
+	for _, test := range tests {
+		want := test.want + "\n\n📎 *The full answer is attached as `response.md`.*"
+		if got := responsePreview(test.text); got != want {
+			t.Errorf("responsePreview(%.20q) = %q, want %q", test.text, got, want)
+		}
+	}
+}
+
+func TestKeepTyping(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+
+	stop := b.keepTyping("channel")
+	stop()
+	stop()
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.typing != 1 {
+		t.Errorf("typed %d times, want once before stopping", session.typing)
+	}
+}
+
+func TestSendLongMessage(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+
+	// Long text is split, and nothing it mentions is pinged
+	b.sendLongMessage("channel", "<@user> asked: @everyone "+strings.Repeat("word ", 500))
+	if len(session.messages) != 2 || len(session.mentions) != 2 {
+		t.Fatalf("messages = %d, mentions = %v, want two messages", len(session.messages), session.mentions)
+	}
+	for _, allowed := range session.mentions {
+		if allowed == nil || len(allowed.Parse) != 0 || len(allowed.Users) != 0 {
+			t.Errorf("allowed mentions = %+v, want none", allowed)
+		}
+	}
+}
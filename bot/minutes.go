@@ -0,0 +1,209 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// Largest recording /minutes downloads from a link
+	maxRecordingSize = 100 << 20
+
+	// Most entries kept in each list of the minutes
+	maxMinutesEntries = 15
+)
+
+// meetingMinutes is what the model writes of a recorded call
+type meetingMinutes struct {
+	Title       string   `json:"title"`
+	Summary     string   `json:"summary"`
+	Attendees   []string `json:"attendees"`
+	Decisions   []string `json:"decisions"`
+	ActionItems []string `json:"action_items"`
+}
+
+// minutesSchema is the JSON the model answers /minutes with
+var minutesSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"title":   {Type: genai.TypeString, Description: "What the call was about, in at most eight words"},
+		"summary": {Type: genai.TypeString, Description: "The call in two to four sentences"},
+		"attendees": {
+			Type:        genai.TypeArray,
+			Description: "People who spoke or were mentioned by name as attending",
+			Items:       &genai.Schema{Type: genai.TypeString},
+		},
+		"decisions": {
+			Type:        genai.TypeArray,
+			Description: "Decisions that were made, one sentence each",
+			Items:       &genai.Schema{Type: genai.TypeString},
+		},
+		"action_items": {
+			Type:        genai.TypeArray,
+			Description: "Tasks as \"owner: task (due date)\", leaving out what wasn't said",
+			Items:       &genai.Schema{Type: genai.TypeString},
+		},
+	},
+	Required: []string{"title", "summary", "attendees", "decisions", "action_items"},
+}
+
+// minutesCommand handles /minutes, having the model listen to an uploaded
+// or linked recording of a call and posting its minutes, with attendees,
+// decisions and action items, to a notes channel
+func (b *Bot) minutesCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Meeting minutes only work in servers."))
+		return
+	}
+	options := i.ApplicationCommandData().Options
+	// Links make the bot fetch a page on the member's behalf
+	if commandOption(options, "url") != nil && (i.Member == nil || i.Member.Permissions&discordgo.PermissionManageServer == 0) {
+		b.respondEphemeral(i, tr(i, "You need the Manage Server permission to take minutes from a link."))
+		return
+	}
+	notesID := i.ChannelID
+	if option := commandOption(options, "channel"); option != nil {
+		notesID = option.ChannelValue(nil).ID
+	}
+
+	// Members can't have the bot post where they can't
+	permissions, err := b.session.UserChannelPermissions(interactionUserID(i), notesID)
+	if err != nil || permissions&discordgo.PermissionSendMessages == 0 {
+		b.respondEphemeral(i, tr(i, "You can't post in <#%s>.", notesID))
+		return
+	}
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to minutes command", "error", err)
+		return
+	}
+
+	var name, contentType string
+	var data []byte
+	if option := commandOption(options, "recording"); option != nil {
+		attachment := i.ApplicationCommandData().Resolved.Attachments[option.Value.(string)]
+		name, contentType = attachment.Filename, attachment.ContentType
+		data, err = downloadAttachment(attachment)
+	} else if option := commandOption(options, "url"); option != nil {
+		link := strings.TrimSpace(option.StringValue())
+		name = recordingName(link)
+		data, contentType, err = fetchDocument(link, maxRecordingSize)
+	} else {
+		b.editInteractionResponse(i, tr(i, "Attach a recording or give a link to one."))
+		return
+	}
+	if err != nil {
+		interactionLogger(i).Warn("Error reading recording", "recording", name, "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, I couldn't read %s: %v", name, err))
+		return
+	}
+	// Links often serve recordings as binary data, their extension tells more
+	contentType, _, _ = mime.ParseMediaType(contentType)
+	if !recordingType(contentType) {
+		contentType, _, _ = mime.ParseMediaType(mime.TypeByExtension(path.Ext(name)))
+	}
+	if !recordingType(contentType) {
+		b.editInteractionResponse(i, tr(i, "%s isn't an audio or video recording.", name))
+		return
+	}
+	minutes, _ := b.attachmentLimits(b.guildSettings(i.GuildID))
+	if duration, ok := mediaDuration(data); ok && minutes > 0 && duration.Minutes() > float64(minutes) {
+		b.editInteractionResponse(i, tr(i, "%s is longer than the %d minutes this server allows.", name, minutes))
+		return
+	}
+
+	part, err := b.aiFor(i.GuildID).UploadFile(b.ctx, data, contentType, name)
+	if err != nil {
+		interactionLogger(i).Error("Error uploading recording", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	prompt := "Listen to this recording of a community call and write its minutes in the language spoken in it. " +
+		"Only include what was actually said; leave a list empty rather than guess."
+	text, err := b.generateJSON(interactionUserID(i), i.GuildID, minutesSchema, part, genai.Text(prompt))
+	var notes meetingMinutes
+	if err == nil {
+		err = json.Unmarshal([]byte(text), &notes)
+	}
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+
+	message, err := b.session.ChannelMessageSendComplex(notesID, &discordgo.MessageSend{
+		Embeds:          []*discordgo.MessageEmbed{b.minutesEmbed(i, name, notes)},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error sending minutes", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	interactionLogger(i).Info("Posted meeting minutes", "notes_channel", notesID, "recording", name)
+	b.editInteractionResponse(i, tr(i, "Posted the minutes in <#%s>: %s", notesID,
+		fmt.Sprintf("https://discord.com/channels/%s/%s/%s", i.GuildID, notesID, message.ID)))
+}
+
+// minutesEmbed shows the minutes of a call, in the server's language
+func (b *Bot) minutesEmbed(i *discordgo.InteractionCreate, recording string, notes meetingMinutes) *discordgo.MessageEmbed {
+	title := cleanTitle(notes.Title, 200)
+	if title == "" {
+		title = recording
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       "📝 " + title,
+		Description: truncate(strings.TrimSpace(notes.Summary), embedDescriptionLimit),
+		Color:       embedColor,
+		Footer:      &discordgo.MessageEmbedFooter{Text: truncate(b.trGuild(i.GuildID, "From %s, shared by %s", recording, interactionUser(i).Username), 2048)},
+	}
+	for _, section := range []struct {
+		name    string
+		entries []string
+	}{
+		{b.trGuild(i.GuildID, "Attendees"), notes.Attendees},
+		{b.trGuild(i.GuildID, "Decisions"), notes.Decisions},
+		{b.trGuild(i.GuildID, "Action items"), notes.ActionItems},
+	} {
+		value := minutesList(section.entries)
+		if value == "" {
+			value = b.trGuild(i.GuildID, "None noted")
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: section.name, Value: value})
+	}
+	return embed
+}
+
+// minutesList lists the entries of a section of the minutes as bullet
+// points within an embed field
+func minutesList(entries []string) string {
+	var lines []string
+	for _, entry := range entries {
+		if entry = strings.TrimSpace(strings.ReplaceAll(entry, "\n", " ")); entry != "" && len(lines) < maxMinutesEntries {
+			lines = append(lines, "• "+entry)
+		}
+	}
+	return truncate(strings.Join(lines, "\n"), 1024)
+}
+
+// recordingType reports whether a media type is audio or video
+func recordingType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/")
+}
+
+// recordingName returns the file name of a recording's link, or the link
+// itself when it has none
+func recordingName(link string) string {
+	if parsed, err := url.Parse(link); err == nil {
+		if name := path.Base(parsed.Path); name != "." && name != "/" {
+			return name
+		}
+	}
+	return link
+}
@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestMinutesCommand(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("not really audio"))
+	}))
+	defer server.Close()
+	allowLocalFetch(t)
+
+	client := &fakeAI{text: `{"title": "Community call", "summary": "Release planning.", "attendees": ["Alice", "Bob"], ` +
+		`"decisions": ["Ship v2 on Friday"], "action_items": ["Bob: write the changelog (Thursday)"]}`}
+	b, session := newTestBot(t, client)
+	minutes := func(options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+		i := commandInteraction("minutes")
+		i.ChannelID = "channel"
+		i.Member.Permissions = discordgo.PermissionManageServer
+		i.Data = discordgo.ApplicationCommandInteractionData{Name: "minutes", Options: options}
+		return i
+	}
+
+	b.HandleInteraction(minutes(stringOption("url", server.URL+"/calls/june.mp3"), &discordgo.ApplicationCommandInteractionDataOption{
+		Name: "channel", Type: discordgo.ApplicationCommandOptionChannel, Value: "notes",
+	}))
+	if len(session.embeds) != 1 {
+		t.Fatalf("edits = %v, want the minutes posted", session.edits)
+	}
+	embed := session.embeds[0]
+	if embed.Title != "📝 Community call" || embed.Description != "Release planning." || len(embed.Fields) != 3 {
+		t.Fatalf("embed = %+v", embed)
+	}
+	if embed.Fields[1].Value != "• Ship v2 on Friday" || embed.Fields[2].Value != "• Bob: write the changelog (Thursday)" {
+		t.Errorf("fields = %+v, want the decisions and action items", embed.Fields)
+	}
+	if got := *session.edits[0].Content; !strings.HasPrefix(got, "Posted the minutes in <#notes>") {
+		t.Errorf("edit = %q, want a link to the minutes", got)
+	}
+	if !strings.Contains(partsText(client.prompts[0]), "[uploaded june.mp3]") {
+		t.Errorf("prompt = %q, want the recording", partsText(client.prompts[0]))
+	}
+
+	// Links that aren't recordings are refused
+	b.HandleInteraction(minutes(stringOption("url", server.URL+"/notes.txt")))
+	if got := *session.edits[1].Content; got != "notes.txt isn't an audio or video recording." {
+		t.Errorf("edit = %q, want the link refused", got)
+	}
+	b.HandleInteraction(minutes())
+	if got := *session.edits[2].Content; got != "Attach a recording or give a link to one." {
+		t.Errorf("edit = %q, want a recording asked for", got)
+	}
+	if len(session.embeds) != 1 {
+		t.Errorf("posted %d minutes, want one", len(session.embeds))
+	}
+
+	// Only managers can have the bot fetch links
+	i := minutes(stringOption("url", server.URL+"/calls/june.mp3"))
+	i.Member.Permissions = 0
+	b.HandleInteraction(i)
+	if got := session.responses[len(session.responses)-1].Data.Content; got != "You need the Manage Server permission to take minutes from a link." {
+		t.Errorf("response = %q, want the link refused", got)
+	}
+	if len(session.edits) != 3 {
+		t.Errorf("edits = %d, want the link not fetched", len(session.edits))
+	}
+}
@@ -0,0 +1,223 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/store"
+)
+
+const (
+	// Score at which messages are flagged unless /moderation enable sets another
+	defaultModerationThreshold = 70
+
+	// Color of the embeds posted to mod-log channels
+	moderationColor = 0xed4245
+)
+
+// Bounds of the /moderation threshold option (the API takes pointers)
+var (
+	minModerationThreshold = 1.0
+	maxModerationThreshold = 100.0
+)
+
+// Actions the model may suggest to moderators
+var moderationActions = []string{"none", "warn", "delete", "timeout", "ban"}
+
+// moderationVerdict is the model's assessment of a message
+type moderationVerdict struct {
+	Toxicity        int    `json:"toxicity"`
+	Harassment      int    `json:"harassment"`
+	Reasoning       string `json:"reasoning"`
+	SuggestedAction string `json:"suggested_action"`
+}
+
+// score is the verdict's highest score
+func (v *moderationVerdict) score() int {
+	return max(v.Toxicity, v.Harassment)
+}
+
+// moderationCommand handles /moderation enable, disable and status for the
+// current channel
+func (b *Bot) moderationCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Moderation only works in servers."))
+		return
+	}
+	if i.Member == nil || i.Member.Permissions&discordgo.PermissionManageChannels == 0 {
+		b.respondEphemeral(i, tr(i, "You need the Manage Channels permission to change moderation."))
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	switch subcommand.Name {
+	case "enable":
+		settings := store.ModeratedChannel{
+			ChannelID:    i.ChannelID,
+			GuildID:      i.GuildID,
+			LogChannelID: commandOption(subcommand.Options, "log").ChannelValue(nil).ID,
+			Threshold:    defaultModerationThreshold,
+		}
+		if option := commandOption(subcommand.Options, "threshold"); option != nil {
+			settings.Threshold = int(option.IntValue())
+		}
+		if option := commandOption(subcommand.Options, "delete"); option != nil {
+			settings.AutoDelete = option.BoolValue()
+		}
+		b.enableModeration(i, settings)
+	case "disable":
+		deleted, err := b.store.DeleteModeratedChannel(i.ChannelID)
+		if err != nil {
+			interactionLogger(i).Error("Error disabling moderation", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+		if !deleted {
+			b.respondEphemeral(i, tr(i, "Moderation isn't on in <#%s>.", i.ChannelID))
+			return
+		}
+		interactionLogger(i).Info("Disabled moderation")
+		b.respondEphemeral(i, tr(i, "Stopped moderating <#%s>.", i.ChannelID))
+	case "status":
+		settings, err := b.store.ModeratedChannel(i.ChannelID)
+		if err != nil {
+			interactionLogger(i).Error("Error loading moderation settings", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+		if settings == nil {
+			b.respondEphemeral(i, tr(i, "Moderation is off in <#%s>. Turn it on with `/moderation enable`.", i.ChannelID))
+			return
+		}
+		b.respondEphemeral(i, moderationStatus(i, settings))
+	}
+}
+
+// enableModeration saves a channel's moderation settings. Deleting flagged
+// messages also needs the Manage Server permission.
+func (b *Bot) enableModeration(i *discordgo.InteractionCreate, settings store.ModeratedChannel) {
+	if settings.AutoDelete && i.Member.Permissions&discordgo.PermissionManageServer == 0 {
+		b.respondEphemeral(i, tr(i, "You need the Manage Server permission to have flagged messages deleted automatically."))
+		return
+	}
+	if err := b.store.SetModeratedChannel(settings); err != nil {
+		interactionLogger(i).Error("Error enabling moderation", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	interactionLogger(i).Info("Enabled moderation", "log_channel", settings.LogChannelID, "threshold", settings.Threshold, "auto_delete", settings.AutoDelete)
+	b.respondEphemeral(i, moderationStatus(i, &settings))
+}
+
+// moderationStatus describes a channel's moderation settings to the user of
+// an interaction
+func moderationStatus(i *discordgo.InteractionCreate, settings *store.ModeratedChannel) string {
+	if settings.AutoDelete {
+		return tr(i, "Moderating <#%s>: messages scoring %d or more out of 100 for toxicity or harassment are reported to <#%s> and deleted.",
+			settings.ChannelID, settings.Threshold, settings.LogChannelID)
+	}
+	return tr(i, "Moderating <#%s>: messages scoring %d or more out of 100 for toxicity or harassment are reported to <#%s>. They aren't deleted.",
+		settings.ChannelID, settings.Threshold, settings.LogChannelID)
+}
+
+// moderatedChannel returns a channel's moderation settings, or nil when
+// moderation is off
+func (b *Bot) moderatedChannel(channelID string) *store.ModeratedChannel {
+	settings, err := b.store.ModeratedChannel(channelID)
+	if err != nil {
+		slog.Error("Error loading moderation settings", "channel", channelID, "error", err)
+	}
+	return settings
+}
+
+// moderateMessage scores a message and reports it to the mod-log channel,
+// deleting it if the channel asks for that, when it crosses the threshold
+func (b *Bot) moderateMessage(m *discordgo.Message, settings *store.ModeratedChannel) {
+	if m.Author == nil || m.Author.Bot || strings.TrimSpace(m.Content) == "" || b.maintenance.Load() || b.quotaExhausted(m.GuildID) {
+		return
+	}
+	logger := slog.With("guild", m.GuildID, "channel", m.ChannelID, "user", m.Author.ID, "message", m.ID)
+
+	verdict, err := b.scoreMessage(m)
+	if err != nil {
+		logger.Error("Error scoring message for moderation", "error", err)
+		return
+	}
+	if verdict.score() < settings.Threshold {
+		return
+	}
+
+	action := "None, this is for moderators to review"
+	if settings.AutoDelete {
+		action = "Deleted automatically"
+		if err := b.session.ChannelMessageDelete(m.ChannelID, m.ID); err != nil {
+			logger.Warn("Error deleting flagged message", "error", err)
+			action = fmt.Sprintf("Couldn't delete it: %v", err)
+		}
+	}
+
+	_, err = b.session.ChannelMessageSendComplex(settings.LogChannelID, &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{{
+			Title:       "Flagged message",
+			URL:         fmt.Sprintf("https://discord.com/channels/%s/%s/%s", m.GuildID, m.ChannelID, m.ID),
+			Description: truncate(m.Content, 1000),
+			Color:       moderationColor,
+			Fields: []*discordgo.MessageEmbedField{
+				{Name: "Author", Value: fmt.Sprintf("<@%s>", m.Author.ID), Inline: true},
+				{Name: "Channel", Value: fmt.Sprintf("<#%s>", m.ChannelID), Inline: true},
+				{Name: "Scores", Value: fmt.Sprintf("Toxicity %d, harassment %d", verdict.Toxicity, verdict.Harassment), Inline: true},
+				{Name: "Reasoning", Value: truncate(verdict.Reasoning, 1000)},
+				{Name: "Suggested action", Value: verdict.SuggestedAction, Inline: true},
+				{Name: "Action taken", Value: action, Inline: true},
+			},
+		}},
+	})
+	if err != nil {
+		logger.Error("Error reporting flagged message", "error", err)
+		return
+	}
+	logger.Info("Flagged message", "toxicity", verdict.Toxicity, "harassment", verdict.Harassment, "deleted", action == "Deleted automatically")
+}
+
+// scoreMessage asks Gemini how toxic and harassing a message is. The request
+// is attributed to the message's author, so /mydata and /forgetme cover it.
+func (b *Bot) scoreMessage(m *discordgo.Message) (*moderationVerdict, error) {
+	score := func(description string) *genai.Schema {
+		return &genai.Schema{Type: genai.TypeInteger, Description: description}
+	}
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"toxicity":   score("From 0 (harmless) to 100 (extremely toxic): insults, slurs, hateful or obscene language"),
+			"harassment": score("From 0 (harmless) to 100 (severe): threats, bullying or attacks aimed at other people"),
+			"reasoning": {
+				Type:        genai.TypeString,
+				Description: "One or two sentences explaining the scores",
+			},
+			"suggested_action": {
+				Type:        genai.TypeString,
+				Description: "What moderators should do",
+				Enum:        moderationActions,
+			},
+		},
+		Required: []string{"toxicity", "harassment", "reasoning", "suggested_action"},
+	}
+	prompt := "You help the moderators of a Discord server. Score the following message for toxicity and harassment. " +
+		"Banter between friends and strong opinions aren't harmful by themselves.\n\n" +
+		fmt.Sprintf("Message from %s:\n%s", m.Author.Username, b.untrusted(m.Author.ID, m.GuildID, "the message to score", m.Content))
+	text, err := b.generateJSON(m.Author.ID, m.GuildID, schema, genai.Text(prompt))
+	if err != nil {
+		return nil, err
+	}
+
+	var verdict moderationVerdict
+	if err := json.Unmarshal([]byte(text), &verdict); err != nil {
+		return nil, fmt.Errorf("error parsing moderation verdict: %v", err)
+	}
+	return &verdict, nil
+}
@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/store"
+)
+
+// moderationInteraction is a /moderation subcommand sent in "channel"
+func moderationInteraction(permissions int64, subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	i := promptInteraction("alice", permissions, subcommand, options...)
+	i.ChannelID = "channel"
+	data := i.Data.(discordgo.ApplicationCommandInteractionData)
+	data.Name = "moderation"
+	i.Data = data
+	return i
+}
+
+func TestModerationCommand(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+	mod := int64(discordgo.PermissionManageChannels)
+	admin := mod | discordgo.PermissionManageServer
+
+	steps := []struct {
+		interaction *discordgo.InteractionCreate
+		want        string
+	}{
+		{moderationInteraction(0, "status"), "You need the Manage Channels permission to change moderation."},
+		{moderationInteraction(mod, "status"), "Moderation is off in <#channel>. Turn it on with `/moderation enable`."},
+		{moderationInteraction(mod, "enable", channelOption("log", "modlog")),
+			"Moderating <#channel>: messages scoring 70 or more out of 100 for toxicity or harassment are reported to <#modlog>. They aren't deleted."},
+		{moderationInteraction(mod, "enable", channelOption("log", "modlog"), &discordgo.ApplicationCommandInteractionDataOption{Name: "delete", Type: discordgo.ApplicationCommandOptionBoolean, Value: true}),
+			"You need the Manage Server permission to have flagged messages deleted automatically."},
+		{moderationInteraction(admin, "enable", channelOption("log", "modlog"), integerOption("threshold", 50), &discordgo.ApplicationCommandInteractionDataOption{Name: "delete", Type: discordgo.ApplicationCommandOptionBoolean, Value: true}),
+			"Moderating <#channel>: messages scoring 50 or more out of 100 for toxicity or harassment are reported to <#modlog> and deleted."},
+		{moderationInteraction(mod, "status"), "Moderating <#channel>: messages scoring 50"},
+		{moderationInteraction(mod, "disable"), "Stopped moderating <#channel>."},
+		{moderationInteraction(mod, "disable"), "Moderation isn't on in <#channel>."},
+	}
+	for _, step := range steps {
+		session.responses = nil
+		b.HandleInteraction(step.interaction)
+		if len(session.responses) != 1 || !strings.HasPrefix(session.responses[0].Data.Content, step.want) {
+			t.Errorf("responded %v, want %q", session.responses, step.want)
+		}
+	}
+}
+
+func TestModerateMessage(t *testing.T) {
+	tests := []struct {
+		name       string
+		verdict    string
+		autoDelete bool
+		flagged    bool
+		deleted    bool
+	}{
+		{"harmless", `{"toxicity": 5, "harassment": 0, "reasoning": "Friendly", "suggested_action": "none"}`, true, false, false},
+		{"flagged", `{"toxicity": 40, "harassment": 80, "reasoning": "Targets a member", "suggested_action": "timeout"}`, false, true, false},
+		{"deleted", `{"toxicity": 90, "harassment": 10, "reasoning": "Slurs", "suggested_action": "delete"}`, true, true, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, session := newTestBot(t, &fakeAI{text: test.verdict})
+			settings := &store.ModeratedChannel{ChannelID: "channel", GuildID: "guild", LogChannelID: "modlog", Threshold: 70, AutoDelete: test.autoDelete}
+
+			b.moderateMessage(userMessage("you're the worst").Message, settings)
+			if flagged := len(session.embeds) == 1; flagged != test.flagged {
+				t.Fatalf("flagged = %v, want %v", flagged, test.flagged)
+			}
+			if deleted := len(session.deleted) == 1 && session.deleted[0] == "message"; deleted != test.deleted {
+				t.Errorf("deleted = %q, want deleted %v", session.deleted, test.deleted)
+			}
+			if !test.flagged {
+				return
+			}
+			embed := session.embeds[0]
+			if embed.Description != "you're the worst" || embed.URL != "https://discord.com/channels/guild/channel/message" {
+				t.Errorf("embed = %+v, want the message and its link", embed)
+			}
+			var fields []string
+			for _, field := range embed.Fields {
+				fields = append(fields, field.Name+": "+field.Value)
+			}
+			if got := strings.Join(fields, "\n"); !strings.Contains(got, "Author: <@user>") || !strings.Contains(got, "Suggested action: ") {
+				t.Errorf("fields = %q", got)
+			}
+		})
+	}
+}
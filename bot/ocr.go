@@ -0,0 +1,157 @@
+package bot
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// Name of the message command extracting the text of images
+	ocrCommandName = "Extract text (OCR)"
+
+	// Most images of a message transcribed at once
+	maxOCRImages = 4
+
+	// What the model answers for images without text
+	ocrNoText = "NO_TEXT"
+)
+
+// ocrPrompt asks for a transcription rather than the summary the model
+// tends to give when asked about an image
+const ocrPrompt = "Transcribe all the text in this image exactly as written, character for character, " +
+	"in its original language. Keep its line breaks, and use spaces to keep its indentation and the alignment " +
+	"of columns and tables. Don't summarize, translate, correct, describe or explain anything, and add no " +
+	"commentary or formatting of your own. If the image has no text, answer only " + ocrNoText + "."
+
+// imageAttachments returns the first few images among attachments
+func imageAttachments(attachments []*discordgo.MessageAttachment) []*discordgo.MessageAttachment {
+	var images []*discordgo.MessageAttachment
+	for _, attachment := range attachments {
+		if strings.HasPrefix(attachment.ContentType, "image/") && len(images) < maxOCRImages {
+			images = append(images, attachment)
+		}
+	}
+	return images
+}
+
+// ocrCommand handles /ocr, posting the text of an image verbatim
+func (b *Bot) ocrCommand(i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	attachment := data.Resolved.Attachments[commandOption(data.Options, "image").Value.(string)]
+
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to ocr command", "error", err)
+		return
+	}
+	images := imageAttachments([]*discordgo.MessageAttachment{attachment})
+	if len(images) == 0 {
+		b.editInteractionResponse(i, tr(i, "Attach an image to read its text."))
+		return
+	}
+	b.respondWithText(i, images, 0)
+}
+
+// ocrMessage handles the "Extract text (OCR)" message command, privately
+// transcribing the text of the message's images
+func (b *Bot) ocrMessage(i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	message := data.Resolved.Messages[data.TargetID]
+
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to ocr command", "error", err)
+		return
+	}
+	images := imageAttachments(message.Attachments)
+	if len(images) == 0 {
+		b.editInteractionResponse(i, tr(i, "That message has no image to read text from."))
+		return
+	}
+	b.respondWithText(i, images, discordgo.MessageFlagsEphemeral)
+}
+
+// respondWithText answers a deferred interaction with the text of images,
+// each in a code block keeping its layout, under the image's name when
+// there are several
+func (b *Bot) respondWithText(i *discordgo.InteractionCreate, images []*discordgo.MessageAttachment, flags discordgo.MessageFlags) {
+	var chunks []string
+	for _, image := range images {
+		header := ""
+		if len(images) > 1 {
+			header = "**" + image.Filename + "**\n"
+		}
+		text, err := b.transcribe(interactionUserID(i), i.GuildID, image)
+		if err != nil {
+			interactionLogger(i).Error("Error extracting text", "file", image.Filename, "error", err)
+			b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+		if text == "" {
+			chunks = append(chunks, header+tr(i, "*No text found.*"))
+			continue
+		}
+		blocks := codeBlocks(text, 2000-len([]rune(header)))
+		blocks[0] = header + blocks[0]
+		chunks = append(chunks, blocks...)
+	}
+	b.editInteractionResponseChunks(i, chunks, flags)
+	interactionLogger(i).Info("Extracted text", "images", len(images))
+}
+
+// transcribe returns the text of an image verbatim, "" when it has none
+func (b *Bot) transcribe(userID string, guildID string, image *discordgo.MessageAttachment) (string, error) {
+	data, err := downloadAttachment(image)
+	if err != nil {
+		return "", err
+	}
+	part, err := b.aiFor(guildID).UploadFile(b.ctx, data, image.ContentType, image.Filename)
+	if err != nil {
+		return "", err
+	}
+	text, err := b.generate(userID, guildID, part, genai.Text(ocrPrompt))
+	if err != nil {
+		return "", err
+	}
+
+	// Drop code fences the model adds, keeping the indentation of the text
+	if match := fencedCode.FindStringSubmatch(text); match != nil {
+		text = match[1]
+	}
+	text = strings.Trim(text, "\n")
+	if strings.TrimSpace(text) == ocrNoText {
+		return "", nil
+	}
+	return text, nil
+}
+
+// codeBlocks puts text in code blocks of at most size characters, fences
+// included, splitting it between lines where it can
+func codeBlocks(text string, size int) []string {
+	// Fences in the text would end the block early
+	text = strings.ReplaceAll(text, "```", "``\u200b`")
+	room := size - len("```\n\n```")
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line == "" {
+			lines = append(lines, line)
+			continue
+		}
+		lines = append(lines, splitText(line, room)...)
+	}
+
+	var blocks []string
+	start, length := 0, -1
+	for n, line := range lines {
+		if n > start && length+1+len([]rune(line)) > room {
+			blocks = append(blocks, "```\n"+strings.Join(lines[start:n], "\n")+"\n```")
+			start, length = n, -1
+		}
+		length += 1 + len([]rune(line))
+	}
+	return append(blocks, "```\n"+strings.Join(lines[start:], "\n")+"\n```")
+}
@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestCodeBlocks(t *testing.T) {
+	blocks := codeBlocks("Name    Qty\nApple   3\n\nPear    12", 2000)
+	if len(blocks) != 1 || blocks[0] != "```\nName    Qty\nApple   3\n\nPear    12\n```" {
+		t.Errorf("codeBlocks = %q, want the text in one block as laid out", blocks)
+	}
+
+	blocks = codeBlocks(strings.Repeat("0123456789\n", 30)+"see ```", 100)
+	for _, block := range blocks {
+		if len([]rune(block)) > 100 || !strings.HasPrefix(block, "```\n") || !strings.HasSuffix(block, "\n```") ||
+			strings.Count(block, "```") != 2 {
+			t.Fatalf("block %q is too long or not a single code block", block)
+		}
+	}
+	if len(blocks) != 4 {
+		t.Errorf("got %d blocks, want 4", len(blocks))
+	}
+}
+
+func TestOCRMessage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("png"))
+	}))
+	defer server.Close()
+
+	client := &fakeAI{text: "```\nTOTAL\n  Coffee   $3.50\n```"}
+	b, session := newTestBot(t, client)
+	ocr := func(attachments ...*discordgo.MessageAttachment) *discordgo.InteractionCreate {
+		i := commandInteraction(ocrCommandName)
+		i.Data = discordgo.ApplicationCommandInteractionData{
+			Name:     ocrCommandName,
+			TargetID: "target",
+			Resolved: &discordgo.ApplicationCommandInteractionDataResolved{
+				Messages: map[string]*discordgo.Message{"target": {ID: "target", Attachments: attachments}},
+			},
+		}
+		return i
+	}
+
+	b.HandleInteraction(ocr(&discordgo.MessageAttachment{Filename: "notes.txt", ContentType: "text/plain", URL: server.URL}))
+	if len(session.edits) != 1 || !strings.Contains(*session.edits[0].Content, "no image") {
+		t.Errorf("edits = %v, want a refusal", session.edits)
+	}
+
+	session.edits = nil
+	b.HandleInteraction(ocr(&discordgo.MessageAttachment{Filename: "receipt.png", ContentType: "image/png", URL: server.URL}))
+	if len(session.edits) != 1 || *session.edits[0].Content != "```\nTOTAL\n  Coffee   $3.50\n```" {
+		t.Errorf("edits = %v, want the text verbatim in a code block", session.edits)
+	}
+	if prompt := partsText(client.prompts[0]); !strings.Contains(prompt, "[uploaded receipt.png]") || !strings.Contains(prompt, "exactly as written") {
+		t.Errorf("prompt %q, want the image and a request to transcribe it", prompt)
+	}
+
+	session.edits = nil
+	client.text = ocrNoText
+	b.HandleInteraction(ocr(&discordgo.MessageAttachment{Filename: "cat.jpg", ContentType: "image/jpeg", URL: server.URL}))
+	if len(session.edits) != 1 || *session.edits[0].Content != "*No text found.*" {
+		t.Errorf("edits = %v, want no text found", session.edits)
+	}
+}
@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/config"
+)
+
+// How recently the bot must have joined a guild for missing permissions to
+// be reported to its admins, rather than only logged on every start
+const newGuildWindow = 10 * time.Minute
+
+// requiredPermissions are the server permissions the bot's features rely
+// on, with the names Discord shows for them and, for the ones only some
+// features need, what they are for
+var requiredPermissions = []struct {
+	permission int64
+	name       string
+	feature    string
+}{
+	{discordgo.PermissionViewChannel, "View Channels", ""},
+	{discordgo.PermissionSendMessages, "Send Messages", ""},
+	{discordgo.PermissionSendMessagesInThreads, "Send Messages in Threads", ""},
+	{discordgo.PermissionCreatePublicThreads, "Create Public Threads", ""},
+	{discordgo.PermissionEmbedLinks, "Embed Links", ""},
+	{discordgo.PermissionAttachFiles, "Attach Files", ""},
+	{discordgo.PermissionReadMessageHistory, "Read Message History", ""},
+	{discordgo.PermissionAddReactions, "Add Reactions", ""},
+	{discordgo.PermissionVoiceConnect, "Connect", "voice chat"},
+	{discordgo.PermissionVoiceSpeak, "Speak", "voice chat"},
+	{discordgo.PermissionManageMessages, "Manage Messages", "pinned thread summaries and moderation"},
+	{discordgo.PermissionManageThreads, "Manage Threads", "thread titles"},
+	{discordgo.PermissionManageChannels, "Manage Channels", "channel topics"},
+	{discordgo.PermissionManageEvents, "Manage Events", "event drafts"},
+}
+
+// Intents returns the gateway events the bot subscribes to. Message Content,
+// and Server Members when welcome messages are on, are privileged and must
+// be enabled for the bot in the Discord developer portal.
+func Intents(cfg *config.Config) discordgo.Intent {
+	intents := discordgo.IntentsGuilds |
+		discordgo.IntentsGuildMessages |
+		discordgo.IntentsDirectMessages |
+		discordgo.IntentMessageContent |
+		discordgo.IntentsGuildMessageReactions |
+		discordgo.IntentsGuildVoiceStates
+	if cfg.WelcomeMessages {
+		intents |= discordgo.IntentsGuildMembers
+	}
+	return intents
+}
+
+// handleGuildCreate checks the bot's permissions in a guild as it becomes
+// available, logging the missing ones, and telling the guild's admins when
+// the bot just joined
+func (b *Bot) handleGuildCreate(g *discordgo.GuildCreate) {
+	if g.Guild == nil || g.Unavailable {
+		return
+	}
+	missing := missingPermissions(g.Guild, b.session.BotUserID())
+	if len(missing) == 0 {
+		return
+	}
+	logger := slog.With("guild", g.ID)
+	logger.Warn("Missing permissions", "permissions", missing)
+	if time.Since(g.JoinedAt) > newGuildWindow {
+		return
+	}
+
+	notice := "⚠️ I'm missing permissions I need in this server: **" + strings.Join(missing, "**, **") + "**. " +
+		"Some of my features won't work until a server admin grants them to my role."
+	// Post in the system channel, or tell the owner when that fails
+	if g.SystemChannelID != "" {
+		if _, err := b.session.ChannelMessageSend(g.SystemChannelID, notice); err == nil {
+			return
+		}
+	}
+	dm, err := b.session.UserChannelCreate(g.OwnerID)
+	if err == nil {
+		_, err = b.session.ChannelMessageSend(dm.ID, notice)
+	}
+	if err != nil {
+		logger.Error("Error reporting missing permissions", "error", err)
+	}
+}
+
+// missingPermissions returns the names of the required permissions a user
+// lacks in a guild, with the features needing them, going by the roles the
+// guild was sent with. Nothing is reported when the user's member isn't
+// among them.
+func missingPermissions(guild *discordgo.Guild, userID string) []string {
+	var member *discordgo.Member
+	for _, m := range guild.Members {
+		if m.User != nil && m.User.ID == userID {
+			member = m
+		}
+	}
+	if member == nil || guild.OwnerID == userID {
+		return nil
+	}
+
+	var granted int64
+	for _, role := range guild.Roles {
+		// The @everyone role shares the guild's ID
+		if role.ID == guild.ID || slices.Contains(member.Roles, role.ID) {
+			granted |= role.Permissions
+		}
+	}
+	if granted&discordgo.PermissionAdministrator != 0 {
+		return nil
+	}
+
+	var missing []string
+	for _, required := range requiredPermissions {
+		switch {
+		case granted&required.permission != 0:
+		case required.feature != "":
+			missing = append(missing, required.name+" (for "+required.feature+")")
+		default:
+			missing = append(missing, required.name)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/config"
+)
+
+// testGuild is a guild where the bot has the "bot" role, granting permissions
+func testGuild(permissions int64, joined time.Time) *discordgo.Guild {
+	return &discordgo.Guild{
+		ID:              "guild",
+		OwnerID:         "owner",
+		SystemChannelID: "system",
+		JoinedAt:        joined,
+		Roles: []*discordgo.Role{
+			{ID: "guild", Permissions: discordgo.PermissionViewChannel | discordgo.PermissionReadMessageHistory},
+			{ID: "bot-role", Permissions: permissions},
+			{ID: "moderator", Permissions: discordgo.PermissionAdministrator},
+		},
+		Members: []*discordgo.Member{{User: &discordgo.User{ID: botUserID}, Roles: []string{"bot-role"}}},
+	}
+}
+
+func TestMissingPermissions(t *testing.T) {
+	all := int64(0)
+	for _, required := range requiredPermissions {
+		all |= required.permission
+	}
+	tests := []struct {
+		name        string
+		permissions int64
+		want        []string
+	}{
+		{"everything", all, nil},
+		{"administrator", discordgo.PermissionAdministrator, nil},
+		{"from @everyone and the bot's role",
+			discordgo.PermissionSendMessages | discordgo.PermissionSendMessagesInThreads | discordgo.PermissionCreatePublicThreads | discordgo.PermissionAddReactions |
+				discordgo.PermissionVoiceConnect | discordgo.PermissionVoiceSpeak | discordgo.PermissionManageMessages | discordgo.PermissionManageThreads | discordgo.PermissionManageEvents,
+			[]string{"Embed Links", "Attach Files", "Manage Channels (for channel topics)"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := missingPermissions(testGuild(test.permissions, time.Now()), botUserID); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("missingPermissions = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	// A guild sent without the bot's member isn't judged
+	guild := testGuild(0, time.Now())
+	guild.Members = nil
+	if got := missingPermissions(guild, botUserID); got != nil {
+		t.Errorf("missingPermissions without the member = %q, want none", got)
+	}
+}
+
+func TestHandleGuildCreate(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+
+	// Guilds joined long ago are only logged about, on every start
+	b.handleGuildCreate(&discordgo.GuildCreate{Guild: testGuild(discordgo.PermissionSendMessages, time.Now().Add(-24*time.Hour))})
+	if len(session.messages) != 0 {
+		t.Errorf("sent %q for a guild joined yesterday, want nothing", session.messages)
+	}
+
+	b.handleGuildCreate(&discordgo.GuildCreate{Guild: testGuild(discordgo.PermissionSendMessages, time.Now())})
+	if len(session.messages) != 1 || !strings.Contains(session.messages[0], "**Embed Links**, **Attach Files**") {
+		t.Errorf("sent %q for a guild just joined, want the missing permissions", session.messages)
+	}
+}
+
+func TestIntents(t *testing.T) {
+	cfg := &config.Config{}
+	if Intents(cfg)&discordgo.IntentMessageContent == 0 || Intents(cfg)&discordgo.IntentsGuildMembers != 0 {
+		t.Errorf("Intents = %b, want message content without server members", Intents(cfg))
+	}
+	cfg.WelcomeMessages = true
+	if Intents(cfg)&discordgo.IntentsGuildMembers == 0 {
+		t.Errorf("Intents with welcome messages = %b, want server members", Intents(cfg))
+	}
+}
@@ -0,0 +1,186 @@
+package bot
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/store"
+)
+
+// Days a persona test runs unless /abtest start sets another length
+const defaultPersonaTestDays = 7
+
+// Bounds of the /abtest start days option (the API takes pointers)
+var (
+	minPersonaTestDays = 1.0
+	maxPersonaTestDays = 30.0
+)
+
+// personaVariant returns the variant of a guild's running persona test that
+// answers in a channel and its persona, or "" when no test runs. Each
+// conversation keeps a persona for a day and the personas swap daily, with
+// channels split between them, so both get answers from every channel.
+func (b *Bot) personaVariant(guildID string, channelID string) (variant string, persona string) {
+	if guildID == "" {
+		return "", ""
+	}
+	test, err := b.store.PersonaTest(guildID)
+	if err != nil {
+		slog.Error("Error loading persona test", "guild", guildID, "error", err)
+		return "", ""
+	}
+	if test == nil || !test.Running(time.Now()) {
+		return "", ""
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(channelID))
+	day := int(time.Since(test.StartedAt) / (24 * time.Hour))
+	variant = store.VariantA
+	if (int(h.Sum32()%2)+day)%2 == 1 {
+		variant = store.VariantB
+	}
+	return variant, test.Persona(variant)
+}
+
+// recordPersonaVote counts a member's 👍 or 👎 on an answer written by a
+// variant of the guild's persona test, unless the test ended or the answer
+// is older than it
+func (b *Bot) recordPersonaVote(i *discordgo.InteractionCreate, variant string, up bool) error {
+	test, err := b.store.PersonaTest(i.GuildID)
+	if err != nil || test == nil || !test.Running(time.Now()) || i.Message.Timestamp.Before(test.StartedAt) {
+		return err
+	}
+	return b.store.RecordPersonaVote(i.GuildID, i.Message.ID, interactionUserID(i), variant, up)
+}
+
+// abtestCommand handles /abtest start, stop and report, which let admins
+// compare two personas
+func (b *Bot) abtestCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Persona tests only work in servers."))
+		return
+	}
+	if i.Member == nil || i.Member.Permissions&discordgo.PermissionManageServer == 0 {
+		b.respondEphemeral(i, tr(i, "You need the Manage Server permission to run persona tests."))
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	switch subcommand.Name {
+	case "start":
+		days := defaultPersonaTestDays
+		if option := commandOption(subcommand.Options, "days"); option != nil {
+			days = int(option.IntValue())
+		}
+		now := time.Now()
+		test := store.PersonaTest{
+			GuildID:   i.GuildID,
+			PersonaA:  strings.TrimSpace(commandOption(subcommand.Options, "persona_a").StringValue()),
+			PersonaB:  strings.TrimSpace(commandOption(subcommand.Options, "persona_b").StringValue()),
+			StartedBy: interactionUserID(i),
+			StartedAt: now,
+			EndsAt:    now.Add(time.Duration(days) * 24 * time.Hour),
+		}
+		if err := b.store.StartPersonaTest(test); err != nil {
+			interactionLogger(i).Error("Error starting persona test", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+		interactionLogger(i).Info("Started persona test", "days", days)
+		b.respondEphemeral(i, tr(i, "Started a persona test until <t:%d:F>. Answers alternate between the two personas, "+
+			"with 👍/👎 buttons to vote on them. See the results with `/abtest report`.", test.EndsAt.Unix()))
+	case "stop":
+		ended, err := b.store.EndPersonaTest(i.GuildID, time.Now())
+		if err != nil {
+			interactionLogger(i).Error("Error ending persona test", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+		if !ended {
+			b.respondEphemeral(i, tr(i, "No persona test is running."))
+			return
+		}
+		interactionLogger(i).Info("Ended persona test")
+		b.personaTestReport(i)
+	case "report":
+		b.personaTestReport(i)
+	}
+}
+
+// personaTestReport shows how members voted on the answers of each persona
+// of the guild's latest test, and which one they preferred
+func (b *Bot) personaTestReport(i *discordgo.InteractionCreate) {
+	test, err := b.store.PersonaTest(i.GuildID)
+	if err == nil && test == nil {
+		b.respondEphemeral(i, tr(i, "This server hasn't run a persona test yet. Start one with `/abtest start`."))
+		return
+	}
+	var votes map[string]store.PersonaVotes
+	if err == nil {
+		votes, err = b.store.PersonaTestVotes(i.GuildID)
+	}
+	if err != nil {
+		interactionLogger(i).Error("Error loading persona test", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+
+	status := tr(i, "Running until <t:%d:F>", test.EndsAt.Unix())
+	if !test.Running(time.Now()) {
+		status = tr(i, "Ended <t:%d:R>", test.EndsAt.Unix())
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       tr(i, "Persona test"),
+		Description: status + "\n" + personaTestVerdict(i, votes),
+		Color:       embedColor,
+	}
+	for _, variant := range []string{store.VariantA, store.VariantB} {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  tr(i, "Persona %s: %s", strings.ToUpper(variant), personaVoteSummary(i, votes[variant])),
+			Value: truncate(test.Persona(variant), 1024),
+		})
+	}
+	err = b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{embed},
+			Flags:  discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to abtest command", "error", err)
+	}
+}
+
+// personaVoteSummary describes the votes of a persona, like "8 👍 2 👎 (80%)"
+func personaVoteSummary(i *discordgo.InteractionCreate, votes store.PersonaVotes) string {
+	total := votes.Up + votes.Down
+	if total == 0 {
+		return tr(i, "no votes")
+	}
+	return fmt.Sprintf("%d 👍 %d 👎 (%d%%)", votes.Up, votes.Down, 100*votes.Up/total)
+}
+
+// personaTestVerdict says which persona members preferred: the one whose
+// answers got the larger share of 👍
+func personaTestVerdict(i *discordgo.InteractionCreate, votes map[string]store.PersonaVotes) string {
+	a, b := votes[store.VariantA], votes[store.VariantB]
+	if a.Up+a.Down == 0 || b.Up+b.Down == 0 {
+		return tr(i, "Both personas need votes before one can be preferred.")
+	}
+	// Compare a.Up/(a.Up+a.Down) with b.Up/(b.Up+b.Down) without dividing
+	shareA, shareB := a.Up*(b.Up+b.Down), b.Up*(a.Up+a.Down)
+	switch {
+	case shareA > shareB:
+		return tr(i, "Members preferred **persona A**.")
+	case shareB > shareA:
+		return tr(i, "Members preferred **persona B**.")
+	}
+	return tr(i, "Members liked both personas equally.")
+}
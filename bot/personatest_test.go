@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/store"
+)
+
+// abtestInteraction is an /abtest subcommand run by a member
+func abtestInteraction(permissions int64, subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	i := promptInteraction("alice", permissions, subcommand, options...)
+	data := i.Data.(discordgo.ApplicationCommandInteractionData)
+	data.Name = "abtest"
+	i.Data = data
+	return i
+}
+
+// personaVoteInteraction presses a 👍/👎 button of an answer
+func personaVoteInteraction(userID string, customID string) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:    discordgo.InteractionMessageComponent,
+		GuildID: "guild",
+		Member:  &discordgo.Member{User: &discordgo.User{ID: userID}},
+		Message: &discordgo.Message{ID: "answer", Timestamp: time.Now()},
+		Data:    discordgo.MessageComponentInteractionData{CustomID: customID},
+	}}
+}
+
+func TestPersonaTest(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+
+	if variant, _ := b.personaVariant("guild", "channel"); variant != "" {
+		t.Errorf("variant = %q without a test", variant)
+	}
+	b.HandleInteraction(abtestInteraction(0, "start", stringOption("persona_a", "Be formal"), stringOption("persona_b", "Be playful")))
+	b.HandleInteraction(abtestInteraction(discordgo.PermissionManageServer, "start",
+		stringOption("persona_a", "Be formal"), stringOption("persona_b", "Be playful")))
+	if len(session.responses) != 2 || !strings.Contains(session.responses[0].Data.Content, "Manage Server") ||
+		!strings.HasPrefix(session.responses[1].Data.Content, "Started a persona test") {
+		t.Fatalf("responses = %v, want a refusal then the test started", session.responses)
+	}
+
+	// A channel keeps its persona on a given day
+	variant, persona := b.personaVariant("guild", "channel")
+	if again, _ := b.personaVariant("guild", "channel"); variant == "" || again != variant {
+		t.Fatalf("variants = %q then %q, want the same one", variant, again)
+	}
+	if want := map[string]string{store.VariantA: "Be formal", store.VariantB: "Be playful"}[variant]; persona != want {
+		t.Errorf("persona of %s = %q, want %q", variant, persona, want)
+	}
+	if got := responseButtons(false, true, variant); len(got) != 1 {
+		t.Errorf("buttons = %v, want a row with 👍 and 👎", got)
+	}
+
+	// Votes count once per member and answer
+	session.responses = nil
+	for _, vote := range []struct{ user, customID string }{
+		{"bob", feedbackPrefix + "down:a"}, {"bob", feedbackPrefix + "up:a"}, {"carol", feedbackPrefix + "down:b"},
+	} {
+		b.HandleInteraction(personaVoteInteraction(vote.user, vote.customID))
+	}
+	if len(session.responses) != 3 || session.responses[2].Data.Content != "Thanks for your feedback!" {
+		t.Errorf("responses = %v, want thanks for each vote", session.responses)
+	}
+
+	session.responses = nil
+	b.HandleInteraction(abtestInteraction(discordgo.PermissionManageServer, "stop"))
+	if len(session.responses) != 1 || len(session.responses[0].Data.Embeds) != 1 {
+		t.Fatalf("responses = %v, want the report", session.responses)
+	}
+	report := session.responses[0].Data.Embeds[0]
+	if !strings.Contains(report.Description, "Members preferred **persona A**.") ||
+		report.Fields[0].Name != "Persona A: 1 👍 0 👎 (100%)" || report.Fields[1].Name != "Persona B: 0 👍 1 👎 (0%)" {
+		t.Errorf("report = %q %+v %+v, want persona A preferred", report.Description, report.Fields[0], report.Fields[1])
+	}
+	if variant, _ := b.personaVariant("guild", "channel"); variant != "" {
+		t.Errorf("variant = %q after the test ended", variant)
+	}
+	// Votes after the test ended are only feedback
+	b.HandleInteraction(personaVoteInteraction("dave", feedbackPrefix+"up:b"))
+	votes, err := b.store.PersonaTestVotes("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if votes[store.VariantB].Up != 0 {
+		t.Errorf("votes of B = %+v, want the late vote left out", votes[store.VariantB])
+	}
+}
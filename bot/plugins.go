@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/plugins"
+)
+
+// SetPlugins runs plugins' hooks on messages, prompts and responses, and
+// answers their commands
+func (b *Bot) SetPlugins(list []plugins.Plugin) {
+	b.plugins = list
+	b.pluginCommands = map[string]pluginCommand{}
+	for _, p := range list {
+		slog.Info("Loaded plugin", "plugin", p.Name())
+		if provider, ok := p.(plugins.CommandProvider); ok {
+			for _, command := range provider.Commands() {
+				b.pluginCommands[command.Name] = pluginCommand{Command: command, plugin: p.Name()}
+			}
+		}
+	}
+}
+
+// pluginCommand is a slash command of a plugin
+type pluginCommand struct {
+	plugins.Command
+	plugin string
+}
+
+// pluginsAccept runs the plugins' message hooks, reporting whether they let
+// the bot handle a message
+func (b *Bot) pluginsAccept(m *discordgo.Message) bool {
+	for _, p := range b.plugins {
+		if hook, ok := p.(plugins.MessageHook); ok && !hook.OnMessage(b.ctx, m) {
+			slog.Debug("Plugin ignored message", "plugin", p.Name(), "message", m.ID)
+			return false
+		}
+	}
+	return true
+}
+
+// beforePrompt runs the plugins' prompt hooks, then the guild's script, on
+// the parts about to be sent on behalf of a user, returning the parts they
+// leave
+func (b *Bot) beforePrompt(userID string, guildID string, parts []genai.Part) ([]genai.Part, error) {
+	prompt := &plugins.Prompt{UserID: userID, GuildID: guildID, Parts: parts}
+	for _, p := range b.plugins {
+		if hook, ok := p.(plugins.PromptHook); ok {
+			if err := hook.BeforePrompt(b.ctx, prompt); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.scriptPrompt(guildID, prompt.Parts), nil
+}
+
+// afterResponse runs the guild's script, then the plugins' response hooks,
+// on the text the model answered a user with, returning the text they leave
+func (b *Bot) afterResponse(userID string, guildID string, text string) string {
+	text = b.scriptResponse(guildID, text)
+	response := &plugins.Response{UserID: userID, GuildID: guildID, Text: text}
+	for _, p := range b.plugins {
+		if hook, ok := p.(plugins.ResponseHook); ok {
+			hook.AfterResponse(b.ctx, response)
+		}
+	}
+	return response.Text
+}
+
+// handlePluginCommand answers a command a plugin added, if there is one by
+// that name
+func (b *Bot) handlePluginCommand(i *discordgo.InteractionCreate) {
+	command, ok := b.pluginCommands[i.ApplicationCommandData().Name]
+	if !ok {
+		return
+	}
+	data, err := command.Handle(b.ctx, i)
+	if err != nil {
+		interactionLogger(i).Error("Error in plugin command", "plugin", command.plugin, "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	err = b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to plugin command", "plugin", command.plugin, "error", err)
+	}
+}
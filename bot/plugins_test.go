@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/plugins"
+)
+
+// testPlugin implements every hook
+type testPlugin struct{}
+
+func (testPlugin) Name() string {
+	return "test"
+}
+
+func (testPlugin) OnMessage(_ context.Context, m *discordgo.Message) bool {
+	return m.Content != "ignore me"
+}
+
+func (testPlugin) BeforePrompt(_ context.Context, p *plugins.Prompt) error {
+	if strings.Contains(partsText(p.Parts), "forbidden") {
+		return errors.New("that topic is off limits")
+	}
+	p.Parts = append([]genai.Part{genai.Text("Server rules: be kind.")}, p.Parts...)
+	return nil
+}
+
+func (testPlugin) AfterResponse(_ context.Context, r *plugins.Response) {
+	r.Text = strings.ToUpper(r.Text)
+}
+
+func (testPlugin) Commands() []plugins.Command {
+	return []plugins.Command{{
+		ApplicationCommand: &discordgo.ApplicationCommand{Name: "ping", Description: "Ping"},
+		Handle: func(context.Context, *discordgo.InteractionCreate) (*discordgo.InteractionResponseData, error) {
+			return &discordgo.InteractionResponseData{Content: "pong"}, nil
+		},
+	}}
+}
+
+func TestPlugins(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello"}}}
+	b, session := newTestBot(t, client)
+	b.SetPlugins([]plugins.Plugin{testPlugin{}})
+
+	b.HandleMessage(userMessage("ignore me"))
+	if len(client.chats) != 0 {
+		t.Fatalf("chats = %d, want the message ignored", len(client.chats))
+	}
+
+	b.HandleMessage(userMessage("hi"))
+	if sent := client.chats[0].sent; len(sent) != 1 || !strings.HasPrefix(partsText(sent[0]), "Server rules: be kind.") {
+		t.Errorf("sent %v, want the rules before the prompt", sent)
+	}
+	if len(session.messages) != 1 || session.messages[0] != "HELLO" {
+		t.Errorf("messages = %q, want the answer the plugin changed", session.messages)
+	}
+
+	b.HandleMessage(userMessage("Tell me about forbidden things"))
+	if len(session.messages) != 2 || !strings.Contains(session.messages[1], "that topic is off limits") {
+		t.Errorf("messages = %q, want the prompt refused", session.messages)
+	}
+
+	b.HandleInteraction(commandInteraction("ping"))
+	if len(session.responses) != 1 || session.responses[0].Data.Content != "pong" {
+		t.Errorf("responses = %v, want the plugin's command answered", session.responses)
+	}
+}
@@ -0,0 +1,272 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// Custom IDs of the draft's buttons and the edit modal all start with
+	// pollPrefix, and end with ":<hours>" the poll stays open for
+	pollPrefix       = "poll-"
+	pollPostPrefix   = "poll-post:"
+	pollEditPrefix   = "poll-edit:"
+	pollModalPrefix  = "poll-modal:"
+	pollQuestionID   = "question"
+	pollAnswersID    = "answers"
+	defaultPollHours = 24
+
+	// Discord's limits on polls: answers, hours open and text lengths
+	minPollAnswers        = 2
+	maxPollAnswers        = 10
+	maxPollHours          = 768
+	maxPollQuestionLength = 300
+	maxPollAnswerLength   = 55
+)
+
+// Lower bound of the /poll hours option (the API takes a pointer)
+var minPollHours = 1.0
+
+// Poll is a native Discord poll, which discordgo's messages can't carry yet
+type Poll struct {
+	Question         PollMedia    `json:"question"`
+	Answers          []PollAnswer `json:"answers"`
+	Duration         int          `json:"duration"`
+	AllowMultiselect bool         `json:"allow_multiselect"`
+}
+
+// PollMedia is the text of a poll's question or of one of its answers
+type PollMedia struct {
+	Text string `json:"text"`
+}
+
+// PollAnswer is one of the answers of a poll
+type PollAnswer struct {
+	PollMedia PollMedia `json:"poll_media"`
+}
+
+// pollDraft is the question and answers the model suggests for a poll
+type pollDraft struct {
+	Question string   `json:"question"`
+	Answers  []string `json:"answers"`
+}
+
+// pollCommand handles /poll, having the model write a poll about a topic
+// and posting it, or showing it to its author to edit first
+func (b *Bot) pollCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID != "" && b.guildSettings(i.GuildID).PollsDisabled {
+		b.respondEphemeral(i, tr(i, "Polls are turned off in this server."))
+		return
+	}
+	options := i.ApplicationCommandData().Options
+	topic := commandOption(options, "topic").StringValue()
+	hours := defaultPollHours
+	if option := commandOption(options, "hours"); option != nil {
+		hours = int(option.IntValue())
+	}
+	edit := false
+	if option := commandOption(options, "edit"); option != nil {
+		edit = option.BoolValue()
+	}
+
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to poll command", "error", err)
+		return
+	}
+	draft, err := b.writePoll(interactionUserID(i), i.GuildID, topic)
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+
+	if !edit {
+		b.postPoll(i, draft, hours)
+		return
+	}
+	embeds := []*discordgo.MessageEmbed{pollEmbed(draft)}
+	components := pollDraftComponents(hours)
+	_, err = b.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Embeds: &embeds, Components: &components})
+	if err != nil {
+		interactionLogger(i).Error("Error showing poll draft", "error", err)
+	}
+}
+
+// writePoll asks the model for a poll question about a topic with its answers
+func (b *Bot) writePoll(userID string, guildID string, topic string) (*pollDraft, error) {
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"question": {
+				Type:        genai.TypeString,
+				Description: fmt.Sprintf("The poll's question, at most %d characters", maxPollQuestionLength),
+			},
+			"answers": {
+				Type:        genai.TypeArray,
+				Description: fmt.Sprintf("%d to %d distinct answers, each at most %d characters", minPollAnswers, maxPollAnswers, maxPollAnswerLength),
+				Items:       &genai.Schema{Type: genai.TypeString},
+			},
+		},
+		Required: []string{"question", "answers"},
+	}
+	prompt := fmt.Sprintf("Write a poll for a Discord server about the following topic: a clear, neutral question and "+
+		"%d to %d short answers covering the likely opinions.\n\nTopic: %s", minPollAnswers, maxPollAnswers, topic)
+	text, err := b.generateJSON(userID, guildID, schema, genai.Text(prompt))
+	if err != nil {
+		return nil, err
+	}
+
+	var draft pollDraft
+	if err := json.Unmarshal([]byte(text), &draft); err != nil {
+		return nil, fmt.Errorf("error parsing poll: %v", err)
+	}
+	return cleanPoll(draft.Question, draft.Answers)
+}
+
+// cleanPoll trims a poll's question and answers to Discord's limits,
+// dropping empty and repeated answers
+func cleanPoll(question string, answers []string) (*pollDraft, error) {
+	draft := &pollDraft{Question: truncate(strings.TrimSpace(question), maxPollQuestionLength)}
+	seen := map[string]bool{}
+	for _, answer := range answers {
+		answer = truncate(strings.TrimSpace(answer), maxPollAnswerLength)
+		if answer == "" || seen[strings.ToLower(answer)] || len(draft.Answers) == maxPollAnswers {
+			continue
+		}
+		seen[strings.ToLower(answer)] = true
+		draft.Answers = append(draft.Answers, answer)
+	}
+	if draft.Question == "" || len(draft.Answers) < minPollAnswers {
+		return nil, fmt.Errorf("a poll needs a question and %d to %d answers", minPollAnswers, maxPollAnswers)
+	}
+	return draft, nil
+}
+
+// postPoll posts a poll in the channel of an interaction, which was deferred
+// or is a button on the poll's draft, and tells its author it was posted
+func (b *Bot) postPoll(i *discordgo.InteractionCreate, draft *pollDraft, hours int) {
+	poll := &Poll{Question: PollMedia{Text: draft.Question}, Duration: hours}
+	for _, answer := range draft.Answers {
+		poll.Answers = append(poll.Answers, PollAnswer{PollMedia: PollMedia{Text: answer}})
+	}
+
+	content := tr(i, "Posted the poll.")
+	if _, err := b.session.ChannelPollSend(i.ChannelID, poll); err != nil {
+		interactionLogger(i).Error("Error posting poll", "error", err)
+		content = tr(i, "Sorry, an error occurred: %v", err)
+	} else {
+		interactionLogger(i).Info("Posted poll", "answers", len(poll.Answers), "hours", hours)
+	}
+
+	if i.Type == discordgo.InteractionApplicationCommand {
+		b.editInteractionResponse(i, content)
+		return
+	}
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{Content: content, Embeds: []*discordgo.MessageEmbed{}, Components: []discordgo.MessageComponent{}},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error updating poll draft", "error", err)
+	}
+}
+
+// pollComponent handles the buttons of a poll's draft, posting it or
+// opening the form to edit it. The draft is read back from its embed.
+func (b *Bot) pollComponent(i *discordgo.InteractionCreate) {
+	customID := i.MessageComponentData().CustomID
+	draft := pollFromEmbed(i.Message)
+	if draft == nil {
+		interactionLogger(i).Warn("Poll draft without its embed", "custom_id", customID)
+		return
+	}
+
+	if hours, ok := strings.CutPrefix(customID, pollPostPrefix); ok {
+		b.postPoll(i, draft, pollHours(hours))
+		return
+	}
+	hours, ok := strings.CutPrefix(customID, pollEditPrefix)
+	if !ok {
+		return
+	}
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: pollModalPrefix + hours,
+			Title:    "Edit the poll",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.TextInput{CustomID: pollQuestionID, Label: "Question", Value: draft.Question,
+						Style: discordgo.TextInputShort, Required: true, MaxLength: maxPollQuestionLength},
+				}},
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.TextInput{CustomID: pollAnswersID, Label: "Answers, one per line", Value: strings.Join(draft.Answers, "\n"),
+						Style: discordgo.TextInputParagraph, Required: true, MaxLength: maxPollAnswers * (maxPollAnswerLength + 1)},
+				}},
+			},
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error opening poll modal", "error", err)
+	}
+}
+
+// pollModal posts a poll as its author edited it
+func (b *Bot) pollModal(i *discordgo.InteractionCreate) {
+	data := i.ModalSubmitData()
+	draft, err := cleanPoll(modalTextValue(data, pollQuestionID), strings.Split(modalTextValue(data, pollAnswersID), "\n"))
+	if err != nil {
+		b.respondEphemeral(i, tr(i, "A poll needs a question and %d to %d different answers.", minPollAnswers, maxPollAnswers))
+		return
+	}
+	b.postPoll(i, draft, pollHours(strings.TrimPrefix(data.CustomID, pollModalPrefix)))
+}
+
+// pollEmbed shows a poll's draft, the question as its title and an answer
+// per line
+func pollEmbed(draft *pollDraft) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       draft.Question,
+		Description: strings.Join(draft.Answers, "\n"),
+		Color:       embedColor,
+		Footer:      &discordgo.MessageEmbedFooter{Text: "Draft poll, only you can see it"},
+	}
+}
+
+// pollFromEmbed reads a poll's draft back from the message showing it
+func pollFromEmbed(m *discordgo.Message) *pollDraft {
+	if m == nil || len(m.Embeds) == 0 {
+		return nil
+	}
+	draft, err := cleanPoll(m.Embeds[0].Title, strings.Split(m.Embeds[0].Description, "\n"))
+	if err != nil {
+		return nil
+	}
+	return draft
+}
+
+// pollDraftComponents returns the buttons posting and editing a draft
+func pollDraftComponents(hours int) []discordgo.MessageComponent {
+	suffix := strconv.Itoa(hours)
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{CustomID: pollPostPrefix + suffix, Label: "Post", Style: discordgo.PrimaryButton},
+			discordgo.Button{CustomID: pollEditPrefix + suffix, Label: "Edit", Style: discordgo.SecondaryButton},
+		}},
+	}
+}
+
+// pollHours parses the hours a poll stays open from a custom ID, falling
+// back to the default
+func pollHours(value string) int {
+	hours, err := strconv.Atoi(value)
+	if err != nil || hours < 1 || hours > maxPollHours {
+		return defaultPollHours
+	}
+	return hours
+}
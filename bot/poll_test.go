@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/store"
+)
+
+// pollInteraction is /poll about a topic with the given options
+func pollInteraction(options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	i := commandInteraction("poll")
+	i.ChannelID = "channel"
+	i.Data = discordgo.ApplicationCommandInteractionData{
+		Name:    "poll",
+		Options: append([]*discordgo.ApplicationCommandInteractionDataOption{stringOption("topic", "pizza")}, options...),
+	}
+	return i
+}
+
+func TestPollCommand(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{text: `{"question": "Best pizza topping?", "answers": ["Cheese", "Pineapple", " cheese ", ""]}`})
+
+	b.HandleInteraction(pollInteraction())
+	if len(session.polls) != 1 {
+		t.Fatalf("polls = %v, want one", session.polls)
+	}
+	want := &Poll{
+		Question: PollMedia{Text: "Best pizza topping?"},
+		Answers:  []PollAnswer{{PollMedia: PollMedia{Text: "Cheese"}}, {PollMedia: PollMedia{Text: "Pineapple"}}},
+		Duration: defaultPollHours,
+	}
+	if !reflect.DeepEqual(session.polls[0], want) {
+		t.Errorf("poll = %+v, want %+v", session.polls[0], want)
+	}
+	if len(session.edits) != 1 || *session.edits[0].Content != "Posted the poll." {
+		t.Errorf("edits = %v, want the poll confirmed", session.edits)
+	}
+}
+
+func TestPollCommandEdit(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{text: `{"question": "Best pizza topping?", "answers": ["Cheese", "Pineapple"]}`})
+
+	hours := &discordgo.ApplicationCommandInteractionDataOption{Name: "hours", Type: discordgo.ApplicationCommandOptionInteger, Value: float64(48)}
+	edit := &discordgo.ApplicationCommandInteractionDataOption{Name: "edit", Type: discordgo.ApplicationCommandOptionBoolean, Value: true}
+	b.HandleInteraction(pollInteraction(hours, edit))
+	if len(session.polls) != 0 || len(session.edits) != 1 || session.edits[0].Embeds == nil {
+		t.Fatalf("polls = %v, edits = %v, want a draft", session.polls, session.edits)
+	}
+	draft := &discordgo.Message{Embeds: *session.edits[0].Embeds}
+
+	// Edit opens a form with the draft filled in
+	session.responses = nil
+	component := settingsInteraction(0, discordgo.MessageComponentInteractionData{CustomID: pollEditPrefix + "48"})
+	component.Message = draft
+	b.HandleInteraction(component)
+	if len(session.responses) != 1 || session.responses[0].Data.CustomID != pollModalPrefix+"48" {
+		t.Fatalf("responses = %v, want the poll form", session.responses)
+	}
+
+	form := discordgo.ModalSubmitInteractionData{CustomID: pollModalPrefix + "48", Components: []discordgo.MessageComponent{
+		&discordgo.ActionsRow{Components: []discordgo.MessageComponent{&discordgo.TextInput{CustomID: pollQuestionID, Value: "Pizza tonight?"}}},
+		&discordgo.ActionsRow{Components: []discordgo.MessageComponent{&discordgo.TextInput{CustomID: pollAnswersID, Value: "Yes\nNo\nMaybe"}}},
+	}}
+	b.HandleInteraction(settingsInteraction(0, form))
+	if len(session.polls) != 1 {
+		t.Fatalf("polls = %v, want the edited poll", session.polls)
+	}
+	if poll := session.polls[0]; poll.Question.Text != "Pizza tonight?" || len(poll.Answers) != 3 || poll.Duration != 48 {
+		t.Errorf("poll = %+v, want the edited question, three answers and 48 hours", poll)
+	}
+
+	// A form with a single answer is refused
+	session.responses = nil
+	form.Components[1] = &discordgo.ActionsRow{Components: []discordgo.MessageComponent{&discordgo.TextInput{CustomID: pollAnswersID, Value: "Yes"}}}
+	b.HandleInteraction(settingsInteraction(0, form))
+	if len(session.polls) != 1 || len(session.responses) != 1 || !strings.Contains(session.responses[0].Data.Content, "2 to 10") {
+		t.Errorf("responses = %v, want a refusal", session.responses)
+	}
+
+	// Post posts the draft as it is
+	component = settingsInteraction(0, discordgo.MessageComponentInteractionData{CustomID: pollPostPrefix + "48"})
+	component.Message = draft
+	b.HandleInteraction(component)
+	if len(session.polls) != 2 || session.polls[1].Question.Text != "Best pizza topping?" {
+		t.Errorf("polls = %v, want the draft posted", session.polls)
+	}
+}
+
+func TestPollCommandDisabled(t *testing.T) {
+	client := &fakeAI{text: `{"question": "Best pizza topping?", "answers": ["Cheese", "Pineapple"]}`}
+	b, session := newTestBot(t, client)
+	if err := b.saveGuildSettings("guild", &store.GuildSettings{GuildID: "guild", Trigger: triggerAll, PollsDisabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	b.HandleInteraction(pollInteraction())
+	if len(session.polls) != 0 || len(client.prompts) != 0 {
+		t.Errorf("polls = %v, prompts = %v, want none", session.polls, client.prompts)
+	}
+	if len(session.responses) != 1 || !strings.Contains(session.responses[0].Data.Content, "turned off") {
+		t.Errorf("responses = %v, want a refusal", session.responses)
+	}
+}
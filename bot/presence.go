@@ -0,0 +1,99 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// presenceCheckInterval is how often the presence is refreshed when the
+// statuses don't rotate, to pick up a new configuration
+const presenceCheckInterval = time.Minute
+
+// maintenanceStatus is shown as the presence in maintenance mode
+const maintenanceStatus = "Maintenance"
+
+// activityPrefixes are the words a status may start with to pick the kind of
+// activity Discord shows, which it then writes in front of the rest
+var activityPrefixes = []struct {
+	prefix string
+	kind   discordgo.ActivityType
+}{
+	{"playing ", discordgo.ActivityTypeGame},
+	{"listening to ", discordgo.ActivityTypeListening},
+	{"watching ", discordgo.ActivityTypeWatching},
+	{"competing in ", discordgo.ActivityTypeCompeting},
+}
+
+// RunPresence shows the configured statuses as the bot's presence, moving
+// to the next one every status interval, until ctx is done
+func (b *Bot) RunPresence(ctx context.Context) {
+	for {
+		b.updatePresence()
+		wait := b.config().StatusInterval
+		if wait <= 0 {
+			wait = presenceCheckInterval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		if b.config().StatusInterval > 0 {
+			b.presenceMu.Lock()
+			b.presenceIndex++
+			b.presenceMu.Unlock()
+		}
+	}
+}
+
+// updatePresence shows the current status as the bot's presence, unless it
+// already is
+func (b *Bot) updatePresence() {
+	b.presenceMu.Lock()
+	defer b.presenceMu.Unlock()
+
+	status, data := b.currentPresence()
+	if status == b.presence {
+		return
+	}
+	if err := b.session.UpdateStatusComplex(data); err != nil {
+		slog.Warn("Error updating presence", "status", status, "error", err)
+		return
+	}
+	b.presence = status
+}
+
+// currentPresence returns the status the bot should show, with {model}
+// replaced by the default provider's model, or that the bot is down for
+// maintenance, and the presence showing it. presenceMu must be held.
+func (b *Bot) currentPresence() (string, discordgo.UpdateStatusData) {
+	status, online := maintenanceStatus, discordgo.StatusDoNotDisturb
+	if !b.maintenance.Load() {
+		status, online = "", discordgo.StatusOnline
+		if statuses := b.config().Statuses; len(statuses) > 0 {
+			status = strings.ReplaceAll(statuses[b.presenceIndex%len(statuses)], "{model}", b.modelName())
+		}
+	}
+	data := discordgo.UpdateStatusData{Status: string(online)}
+	if status != "" {
+		data.Activities = []*discordgo.Activity{presenceActivity(status)}
+	}
+	return status, data
+}
+
+// presenceActivity returns the activity showing a status: "playing",
+// "listening to", "watching" or "competing in" followed by a name, or a
+// custom status otherwise
+func presenceActivity(status string) *discordgo.Activity {
+	lower := strings.ToLower(status)
+	for _, activity := range activityPrefixes {
+		if strings.HasPrefix(lower, activity.prefix) {
+			return &discordgo.Activity{Name: status[len(activity.prefix):], Type: activity.kind}
+		}
+	}
+	return &discordgo.Activity{Name: "Custom Status", Type: discordgo.ActivityTypeCustom, State: status}
+}
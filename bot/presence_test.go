@@ -0,0 +1,47 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestPresenceActivity(t *testing.T) {
+	tests := []struct {
+		status string
+		want   discordgo.Activity
+	}{
+		{"gemini-1.5-pro", discordgo.Activity{Name: "Custom Status", Type: discordgo.ActivityTypeCustom, State: "gemini-1.5-pro"}},
+		{"Listening to /help", discordgo.Activity{Name: "/help", Type: discordgo.ActivityTypeListening}},
+		{"playing chess", discordgo.Activity{Name: "chess", Type: discordgo.ActivityTypeGame}},
+		{"watching the chat", discordgo.Activity{Name: "the chat", Type: discordgo.ActivityTypeWatching}},
+		{"competing in trivia", discordgo.Activity{Name: "trivia", Type: discordgo.ActivityTypeCompeting}},
+	}
+	for _, test := range tests {
+		got := presenceActivity(test.status)
+		if got.Name != test.want.Name || got.Type != test.want.Type || got.State != test.want.State {
+			t.Errorf("presenceActivity(%q) = %+v, want %+v", test.status, got, test.want)
+		}
+	}
+}
+
+func TestPresenceFollowsModel(t *testing.T) {
+	client := &switchableAI{fakeAI: &fakeAI{}, model: "gemini-pro"}
+	b, session := newTestBot(t, client)
+	cfg := *b.config()
+	cfg.OwnerID = "owner"
+	cfg.Statuses = []string{"{model}", "listening to /help"}
+	b.SetConfig(&cfg)
+
+	// Setting the same status again is skipped
+	b.updatePresence()
+	b.HandleInteraction(adminInteraction("owner", "model", stringOption("name", "gemini-flash")))
+
+	var got []string
+	for _, presence := range session.presences {
+		got = append(got, presence.Activities[0].State)
+	}
+	if len(got) != 2 || got[0] != "gemini-pro" || got[1] != "gemini-flash" {
+		t.Errorf("presences = %q, want gemini-pro then gemini-flash", got)
+	}
+}
@@ -0,0 +1,312 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/audit"
+)
+
+// userExport is the /mydata export, everything the bot stores about a user
+type userExport struct {
+	UserID     string    `json:"user_id"`
+	ExportedAt time.Time `json:"exported_at"`
+
+	Memories        []exportedMemory    `json:"memories"`
+	Usage           []exportedUsage     `json:"usage"`
+	IndexedMessages []exportedMessage   `json:"indexed_messages"`
+	Conversations   []string            `json:"thread_conversations"`
+	PromptTemplates []exportedTemplate  `json:"prompt_templates"`
+	Reminders       []exportedReminder  `json:"reminders"`
+	Feedback        []exportedVote      `json:"feedback"`
+	QuizAnswers     []exportedAnswer    `json:"quiz_answers"`
+	PersonaVotes    []exportedVote      `json:"persona_test_votes"`
+	Characters      []exportedCharacter `json:"characters"`
+	Campaigns       []exportedCampaign  `json:"campaigns"`
+	AuditLog        []audit.Entry       `json:"audit_log,omitempty"`
+}
+
+type exportedMemory struct {
+	ID   int64  `json:"id"`
+	Fact string `json:"fact"`
+}
+
+type exportedUsage struct {
+	Day            string `json:"day"`
+	GuildID        string `json:"guild_id,omitempty"`
+	Requests       int    `json:"requests"`
+	PromptTokens   int    `json:"prompt_tokens"`
+	ResponseTokens int    `json:"response_tokens"`
+}
+
+type exportedMessage struct {
+	MessageID string    `json:"message_id"`
+	GuildID   string    `json:"guild_id"`
+	ChannelID string    `json:"channel_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportedTemplate struct {
+	GuildID  string `json:"guild_id"`
+	Name     string `json:"name"`
+	Template string `json:"template"`
+}
+
+type exportedReminder struct {
+	ChannelID string    `json:"channel_id"`
+	Text      string    `json:"text"`
+	DueAt     time.Time `json:"due_at"`
+}
+
+// exportedVote is a 👍 or 👎 on an answer, given by the user or, for
+// feedback, given by someone on the answer to the user's prompt
+type exportedVote struct {
+	GuildID   string    `json:"guild_id"`
+	ChannelID string    `json:"channel_id,omitempty"`
+	MessageID string    `json:"message_id"`
+	Vote      string    `json:"vote"`
+	Given     bool      `json:"given_by_you"`
+	Variant   string    `json:"variant,omitempty"`
+	Prompt    string    `json:"prompt,omitempty"`
+	Response  string    `json:"response,omitempty"`
+	Time      time.Time `json:"time,omitzero"`
+}
+
+type exportedAnswer struct {
+	ChannelID string `json:"channel_id"`
+	Question  int    `json:"question"`
+	Correct   bool   `json:"correct"`
+}
+
+type exportedCharacter struct {
+	GuildID         string `json:"guild_id"`
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	Greeting        string `json:"greeting"`
+	ExampleDialogue string `json:"example_dialogue,omitempty"`
+}
+
+type exportedCampaign struct {
+	GuildID   string    `json:"guild_id"`
+	ChannelID string    `json:"channel_id"`
+	Setting   string    `json:"setting"`
+	Party     []string  `json:"party"`
+	Inventory []string  `json:"inventory"`
+	Scene     string    `json:"scene"`
+	Turns     int       `json:"turns"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// voteName names a 👍 or 👎 in exports
+func voteName(up bool) string {
+	if up {
+		return "up"
+	}
+	return "down"
+}
+
+// userThreadChats returns the chat sessions of a user's auto-threads
+func (b *Bot) userThreadChats(userID string) []ai.Chat {
+	b.chatsMu.Lock()
+	defer b.chatsMu.Unlock()
+
+	var chats []ai.Chat
+	for key, threadID := range b.userThreads {
+		if chat, ok := b.threadChats[threadID]; ok && strings.HasSuffix(key, ":"+userID) {
+			chats = append(chats, chat)
+		}
+	}
+	return chats
+}
+
+// myDataCommand handles /mydata, sending the user an export of everything
+// the bot stores about them in a DM
+func (b *Bot) myDataCommand(i *discordgo.InteractionCreate) {
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to mydata command", "error", err)
+		return
+	}
+
+	user := interactionUser(i)
+	export, err := b.exportUser(user)
+	if err != nil {
+		interactionLogger(i).Error("Error exporting user data", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		interactionLogger(i).Error("Error encoding user data", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+
+	dm, err := b.session.UserChannelCreate(user.ID)
+	if err == nil {
+		_, err = b.session.ChannelFileSend(dm.ID, "mydata.json", bytes.NewReader(data))
+	}
+	if err != nil {
+		interactionLogger(i).Warn("Error sending user data", "error", err)
+		b.editInteractionResponse(i, tr(i, "I couldn't send you a DM. Allow direct messages from server members and try again."))
+		return
+	}
+	interactionLogger(i).Info("Exported user data")
+	b.editInteractionResponse(i, tr(i, "I sent everything I store about you to your DMs."))
+}
+
+// exportUser collects everything stored about a user
+func (b *Bot) exportUser(user *discordgo.User) (*userExport, error) {
+	stored, err := b.store.UserData(user.ID, user.Username)
+	if err != nil {
+		return nil, err
+	}
+	if b.backend != nil {
+		// A shared backend keeps its own memories and usage
+		if stored.Memories, err = b.backend.Memories(user.ID); err != nil {
+			return nil, err
+		}
+		if stored.Usage, err = b.backend.UsageDays(user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	export := &userExport{
+		UserID:          user.ID,
+		ExportedAt:      time.Now().UTC(),
+		Memories:        []exportedMemory{},
+		Usage:           []exportedUsage{},
+		IndexedMessages: []exportedMessage{},
+		Conversations:   []string{},
+		PromptTemplates: []exportedTemplate{},
+		Reminders:       []exportedReminder{},
+		Feedback:        []exportedVote{},
+		QuizAnswers:     []exportedAnswer{},
+		PersonaVotes:    []exportedVote{},
+		Characters:      []exportedCharacter{},
+		Campaigns:       []exportedCampaign{},
+	}
+	for _, m := range stored.Memories {
+		export.Memories = append(export.Memories, exportedMemory{ID: m.ID, Fact: m.Fact})
+	}
+	for _, u := range stored.Usage {
+		export.Usage = append(export.Usage, exportedUsage{
+			Day:            u.Day,
+			GuildID:        u.GuildID,
+			Requests:       u.Requests,
+			PromptTokens:   u.PromptTokens,
+			ResponseTokens: u.ResponseTokens,
+		})
+	}
+	for _, m := range stored.Messages {
+		export.IndexedMessages = append(export.IndexedMessages, exportedMessage{
+			MessageID: m.MessageID,
+			GuildID:   m.GuildID,
+			ChannelID: m.ChannelID,
+			Content:   m.Content,
+			CreatedAt: m.CreatedAt,
+		})
+	}
+	for _, t := range stored.PromptTemplates {
+		export.PromptTemplates = append(export.PromptTemplates, exportedTemplate{GuildID: t.GuildID, Name: t.Name, Template: t.Template})
+	}
+	for _, r := range stored.Reminders {
+		export.Reminders = append(export.Reminders, exportedReminder{ChannelID: r.ChannelID, Text: r.Text, DueAt: r.DueAt.UTC()})
+	}
+	for _, f := range stored.Feedback {
+		export.Feedback = append(export.Feedback, exportedVote{
+			GuildID:   f.GuildID,
+			ChannelID: f.ChannelID,
+			MessageID: f.MessageID,
+			Vote:      voteName(f.Up),
+			Given:     f.UserID == user.ID,
+			Prompt:    f.Prompt,
+			Response:  f.Response,
+			Time:      f.CreatedAt.UTC(),
+		})
+	}
+	for _, a := range stored.QuizAnswers {
+		export.QuizAnswers = append(export.QuizAnswers, exportedAnswer{ChannelID: a.ChannelID, Question: a.Number + 1, Correct: a.Correct})
+	}
+	for _, v := range stored.PersonaVotes {
+		export.PersonaVotes = append(export.PersonaVotes, exportedVote{GuildID: v.GuildID, MessageID: v.MessageID, Vote: voteName(v.Up), Given: true, Variant: v.Variant})
+	}
+	for _, c := range stored.Characters {
+		export.Characters = append(export.Characters, exportedCharacter{
+			GuildID:         c.GuildID,
+			Name:            c.Name,
+			Description:     c.Description,
+			Greeting:        c.Greeting,
+			ExampleDialogue: c.ExampleDialogue,
+		})
+	}
+	for _, c := range stored.Campaigns {
+		export.Campaigns = append(export.Campaigns, exportedCampaign{
+			GuildID:   c.GuildID,
+			ChannelID: c.ChannelID,
+			Setting:   c.Setting,
+			Party:     c.Party,
+			Inventory: c.Inventory,
+			Scene:     c.Scene,
+			Turns:     c.Turns,
+			UpdatedAt: c.UpdatedAt.UTC(),
+		})
+	}
+	for _, chat := range b.userThreadChats(user.ID) {
+		if history := chat.History(); len(history) > 0 {
+			export.Conversations = append(export.Conversations, historyTranscript(history))
+		}
+	}
+	if b.audit != nil {
+		if export.AuditLog, err = b.audit.UserEntries(user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return export, nil
+}
+
+// forgetMeCommand handles /forgetme, deleting the user's memories, indexed
+// messages, reminders, thread conversations and audit entries
+func (b *Bot) forgetMeCommand(i *discordgo.InteractionCreate) {
+	user := interactionUser(i)
+	if err := b.forgetUser(user); err != nil {
+		interactionLogger(i).Error("Error forgetting user", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	interactionLogger(i).Info("Forgot user")
+	b.respondEphemeral(i, tr(i, "I deleted your memories, indexed messages, reminders, thread conversations and audit log entries. "+
+		"Your usage still counts towards server limits, and prompt templates you saved stay in their servers, without your name on them. "+
+		"Shared channel conversations aren't per user, use `/clear` to reset them."))
+}
+
+// forgetUser deletes everything stored about a user
+func (b *Bot) forgetUser(user *discordgo.User) error {
+	if err := b.store.ForgetUser(user.ID, user.Username); err != nil {
+		return err
+	}
+	// The database forgot their memories and usage, a shared backend has
+	// its own
+	if b.backend != nil {
+		if err := b.backend.AnonymizeUser(user.ID); err != nil {
+			return err
+		}
+	}
+	for _, chat := range b.userThreadChats(user.ID) {
+		chat.SetHistory(nil)
+		b.forgetLastTurn(chat)
+		b.deleteSession(b.sessionKey(chat))
+	}
+	b.forgetUserCheckpoints(user.ID)
+	if b.audit != nil {
+		if _, err := b.audit.Forget(user.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package bot
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/audit"
+	"go-discord-bot/store"
+)
+
+// commandInteraction is a slash command without options sent by "user" in
+// the test guild
+func commandInteraction(name string) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:    discordgo.InteractionApplicationCommand,
+		GuildID: "guild",
+		Member:  &discordgo.Member{User: &discordgo.User{ID: "user", Username: "alice"}},
+		Data:    discordgo.ApplicationCommandInteractionData{Name: name},
+	}}
+}
+
+func TestMyDataAndForgetMe(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello", PromptTokens: 3, ResponseTokens: 2}}}
+	b, session := newTestBot(t, client)
+	b.SetAudit(audit.New(b.store.AuditSink(), audit.Options{}))
+	if err := b.store.AddMemory("user", "likes Go", maxUserMemories); err != nil {
+		t.Fatalf("AddMemory: %v", err)
+	}
+	b.HandleMessage(userMessage("hi"))
+	reminder := store.Reminder{UserID: "user", ChannelID: "channel", Text: "stretch", DueAt: time.Now().Add(time.Hour), CreatedAt: time.Now()}
+	if _, err := b.store.AddReminder(reminder, maxReminders); err != nil {
+		t.Fatalf("AddReminder: %v", err)
+	}
+
+	b.rememberFeedbackExchange([]string{"answer"}, "user", "Name a color", "Blue")
+	b.HandleInteraction(personaVoteInteraction("someone", feedbackPrefix+"up"))
+
+	b.HandleInteraction(commandInteraction("mydata"))
+	var export userExport
+	if err := json.Unmarshal(session.files["dm-user/mydata.json"], &export); err != nil {
+		t.Fatalf("decoding export: %v", err)
+	}
+	if len(export.Memories) != 1 || export.Memories[0].Fact != "likes Go" {
+		t.Errorf("exported memories %+v", export.Memories)
+	}
+	if len(export.Usage) != 1 || export.Usage[0].Requests != 1 {
+		t.Errorf("exported usage %+v", export.Usage)
+	}
+	if len(export.Reminders) != 1 || export.Reminders[0].Text != "stretch" {
+		t.Errorf("exported reminders %+v", export.Reminders)
+	}
+	if len(export.AuditLog) != 1 || export.AuditLog[0].Response != "hello" {
+		t.Errorf("exported audit log %+v", export.AuditLog)
+	}
+	if len(export.Feedback) != 1 || export.Feedback[0].Given || export.Feedback[0].Prompt != "Name a color" {
+		t.Errorf("exported feedback %+v, want the vote on the user's prompt", export.Feedback)
+	}
+
+	b.HandleInteraction(commandInteraction("forgetme"))
+	if memories, err := b.store.Memories("user"); err != nil || len(memories) != 0 {
+		t.Errorf("Memories after /forgetme = %v, %v", memories, err)
+	}
+	if reminders, err := b.store.UserReminders("user"); err != nil || len(reminders) != 0 {
+		t.Errorf("reminders after /forgetme = %v, %v", reminders, err)
+	}
+	if entries, err := b.store.AuditEntries(time.Time{}); err != nil || len(entries) != 0 {
+		t.Errorf("audit entries after /forgetme = %v, %v", entries, err)
+	}
+	if feedback, err := b.store.GuildFeedback("guild", 10); err != nil || len(feedback) != 0 {
+		t.Errorf("feedback after /forgetme = %v, %v", feedback, err)
+	}
+	// The server's usage still counts
+	if usage, err := b.store.GuildUsage("guild", time.Now()); err != nil || usage.Tokens() != 5 {
+		t.Errorf("GuildUsage after /forgetme = %+v, %v", usage, err)
+	}
+}
@@ -0,0 +1,224 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Bitrates of MPEG-1 and MPEG-2 Layer III audio by the bitrate index of a
+// frame header, in kbps
+var (
+	mpeg1Layer3Bitrates = [15]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320}
+	mpeg2Layer3Bitrates = [15]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160}
+)
+
+var (
+	// Page objects of a PDF, and the page counts of its page trees
+	pdfPageObject = regexp.MustCompile(`/Type\s*/Page\b`)
+	pdfPageCount  = regexp.MustCompile(`/Count\s+(\d+)`)
+)
+
+// mediaDuration reads the length of an audio or video file from its
+// headers, in the WAV, MP4 (and MOV or M4A), Ogg, WebM (Matroska) and MP3
+// formats
+func mediaDuration(data []byte) (time.Duration, bool) {
+	switch {
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return wavDuration(data)
+	case len(data) >= 8 && (string(data[4:8]) == "ftyp" || string(data[4:8]) == "moov" || string(data[4:8]) == "wide"):
+		return mp4Duration(data)
+	case len(data) >= 4 && string(data[:4]) == "OggS":
+		return oggDuration(data)
+	case len(data) >= 4 && bytes.Equal(data[:4], []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		return matroskaDuration(data)
+	case len(data) >= 3 && (string(data[:3]) == "ID3" || data[0] == 0xff && data[1]&0xe0 == 0xe0):
+		return mp3Duration(data)
+	}
+	return 0, false
+}
+
+// seconds converts a number of seconds to a duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// wavDuration reads the length of a WAV file from its byte rate and the
+// size of its data chunk
+func wavDuration(data []byte) (time.Duration, bool) {
+	var byteRate uint32
+	for offset := 12; offset+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		body := data[offset+8:]
+		switch string(data[offset : offset+4]) {
+		case "fmt ":
+			if len(body) >= 12 {
+				byteRate = binary.LittleEndian.Uint32(body[8:12])
+			}
+		case "data":
+			if byteRate == 0 {
+				return 0, false
+			}
+			return seconds(float64(size) / float64(byteRate)), true
+		}
+		// Chunks are padded to an even size
+		offset += 8 + size + size%2
+	}
+	return 0, false
+}
+
+// mp4Duration reads the length of an MP4 or QuickTime file from its movie
+// header box
+func mp4Duration(data []byte) (time.Duration, bool) {
+	moov, ok := mp4Box(data, "moov")
+	if !ok {
+		return 0, false
+	}
+	mvhd, ok := mp4Box(moov, "mvhd")
+	if !ok || len(mvhd) == 0 {
+		return 0, false
+	}
+	var timescale, duration uint64
+	switch {
+	case mvhd[0] == 0 && len(mvhd) >= 20:
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	case mvhd[0] == 1 && len(mvhd) >= 32:
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	}
+	if timescale == 0 {
+		return 0, false
+	}
+	return seconds(float64(duration) / float64(timescale)), true
+}
+
+// mp4Box returns the contents of the first box of a type among the boxes in
+// data, cut short when data ends first
+func mp4Box(data []byte, boxType string) ([]byte, bool) {
+	for len(data) >= 8 {
+		size, header := uint64(binary.BigEndian.Uint32(data[:4])), uint64(8)
+		switch size {
+		case 0:
+			// The box runs to the end of the file
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, false
+			}
+			size, header = binary.BigEndian.Uint64(data[8:16]), 16
+		}
+		if size < header {
+			return nil, false
+		}
+		if string(data[4:8]) == boxType {
+			return data[header:min(size, uint64(len(data)))], true
+		}
+		if size >= uint64(len(data)) {
+			return nil, false
+		}
+		data = data[size:]
+	}
+	return nil, false
+}
+
+// oggDuration reads the length of an Ogg Opus or Vorbis file from the
+// granule position of its last page
+func oggDuration(data []byte) (time.Duration, bool) {
+	head := data[:min(len(data), 4096)]
+	rate := 0
+	if bytes.Contains(head, []byte("OpusHead")) {
+		// Opus granule positions always count 48 kHz samples
+		rate = 48000
+	} else if i := bytes.Index(head, []byte("\x01vorbis")); i >= 0 && i+16 <= len(head) {
+		rate = int(binary.LittleEndian.Uint32(head[i+12 : i+16]))
+	}
+	last := bytes.LastIndex(data, []byte("OggS"))
+	if rate == 0 || last < 0 || last+14 > len(data) {
+		return 0, false
+	}
+	granule := int64(binary.LittleEndian.Uint64(data[last+6 : last+14]))
+	if granule <= 0 {
+		return 0, false
+	}
+	return seconds(float64(granule) / float64(rate)), true
+}
+
+// matroskaDuration reads the length of a WebM or Matroska file from the
+// Duration and TimecodeScale elements of its segment info, which come near
+// the start of the file
+func matroskaDuration(data []byte) (time.Duration, bool) {
+	head := data[:min(len(data), 64*1024)]
+
+	// Nanoseconds per unit of the duration, a millisecond unless set
+	scale := 1_000_000.0
+	if i := bytes.Index(head, []byte{0x2a, 0xd7, 0xb1}); i >= 0 && i+4 <= len(head) && head[i+3]&0x80 != 0 {
+		size := int(head[i+3] &^ 0x80)
+		if size > 0 && size <= 8 && i+4+size <= len(head) {
+			var value uint64
+			for _, c := range head[i+4 : i+4+size] {
+				value = value<<8 | uint64(c)
+			}
+			scale = float64(value)
+		}
+	}
+
+	i := bytes.Index(head, []byte{0x44, 0x89})
+	if i < 0 || i+3 > len(head) {
+		return 0, false
+	}
+	var units float64
+	switch {
+	case head[i+2] == 0x84 && i+7 <= len(head):
+		units = float64(math.Float32frombits(binary.BigEndian.Uint32(head[i+3 : i+7])))
+	case head[i+2] == 0x88 && i+11 <= len(head):
+		units = math.Float64frombits(binary.BigEndian.Uint64(head[i+3 : i+11]))
+	default:
+		return 0, false
+	}
+	duration := time.Duration(units * scale)
+	return duration, duration > 0
+}
+
+// mp3Duration estimates the length of an MP3 file from the bitrate of its
+// first frame, assuming the bitrate is constant
+func mp3Duration(data []byte) (time.Duration, bool) {
+	offset := 0
+	if len(data) >= 10 && string(data[:3]) == "ID3" {
+		// Skip the ID3v2 tag, whose size is stored 7 bits a byte
+		offset = 10 + (int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f))
+	}
+	if offset+4 > len(data) || data[offset] != 0xff || data[offset+1]&0xe0 != 0xe0 {
+		return 0, false
+	}
+	version := data[offset+1] >> 3 & 0x03
+	layer := data[offset+1] >> 1 & 0x03
+	index := data[offset+2] >> 4
+	if layer != 1 || index == 0 || index == 15 {
+		return 0, false
+	}
+	kbps := mpeg2Layer3Bitrates[index]
+	if version == 3 {
+		kbps = mpeg1Layer3Bitrates[index]
+	}
+	return seconds(float64((len(data)-offset)*8) / float64(kbps*1000)), true
+}
+
+// pdfPages counts the pages of a PDF, or returns 0 when they can't be
+// counted, as in files whose objects are compressed
+func pdfPages(data []byte) int {
+	if pages := len(pdfPageObject.FindAllIndex(data, -1)); pages > 0 {
+		return pages
+	}
+	// The root of the page tree counts every page
+	pages := 0
+	for _, match := range pdfPageCount.FindAllSubmatch(data, -1) {
+		if n, err := strconv.Atoi(string(match[1])); err == nil {
+			pages = max(pages, n)
+		}
+	}
+	return pages
+}
@@ -0,0 +1,168 @@
+package bot
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+// wavFile returns a WAV file of silence lasting seconds, at 8000 bytes a
+// second
+func wavFile(seconds int) []byte {
+	data := make([]byte, 8000*seconds)
+	header := make([]byte, 44)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+len(data)))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1)
+	binary.LittleEndian.PutUint16(header[22:], 1)
+	binary.LittleEndian.PutUint32(header[24:], 8000)
+	binary.LittleEndian.PutUint32(header[28:], 8000)
+	binary.LittleEndian.PutUint16(header[32:], 1)
+	binary.LittleEndian.PutUint16(header[34:], 8)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(len(data)))
+	return append(header, data...)
+}
+
+// mp4BoxOf returns an MP4 box of a type with contents
+func mp4BoxOf(boxType string, contents ...[]byte) []byte {
+	size := 8
+	for _, c := range contents {
+		size += len(c)
+	}
+	box := binary.BigEndian.AppendUint32(nil, uint32(size))
+	box = append(box, boxType...)
+	for _, c := range contents {
+		box = append(box, c...)
+	}
+	return box
+}
+
+func TestMediaDuration(t *testing.T) {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], 90_500)
+	mp4 := append(mp4BoxOf("ftyp", []byte("isom\x00\x00\x02\x00")), mp4BoxOf("moov", mp4BoxOf("mvhd", mvhd))...)
+
+	// A 128 kbps MPEG-1 Layer III frame header, then 16 KB
+	mp3 := append([]byte{0xff, 0xfb, 0x90, 0x64}, make([]byte, 16_000-4)...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want time.Duration
+		ok   bool
+	}{
+		{"wav", wavFile(3), 3 * time.Second, true},
+		{"mp4", mp4, 90500 * time.Millisecond, true},
+		{"mp3", mp3, time.Second, true},
+		{"text", []byte("hello"), 0, false},
+	}
+	for _, test := range tests {
+		got, ok := mediaDuration(test.data)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%s: mediaDuration = %v, %v, want %v, %v", test.name, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestPDFPages(t *testing.T) {
+	pdf := "%PDF-1.4\n1 0 obj << /Type /Pages /Kids [2 0 R 3 0 R] /Count 2 >> endobj\n" +
+		"2 0 obj << /Type /Page >> endobj\n3 0 obj << /Type/Page >> endobj\n"
+	if pages := pdfPages([]byte(pdf)); pages != 2 {
+		t.Errorf("pdfPages = %d, want 2", pages)
+	}
+	if pages := pdfPages([]byte("%PDF-1.5 << /Count 12 >> << /Count 40 >>")); pages != 40 {
+		t.Errorf("pdfPages of a compressed PDF = %d, want the page tree's count", pages)
+	}
+}
+
+func TestParseAttachmentLimits(t *testing.T) {
+	tests := []struct {
+		text           string
+		minutes, pages int
+		ok             bool
+	}{
+		{"", 0, 0, true},
+		{"10 minutes, 50 pages", 10, 50, true},
+		{"20 pages", 0, 20, true},
+		{"5min", 5, 0, true},
+		{"an hour", 0, 0, false},
+		{"0 pages", 0, 0, false},
+	}
+	for _, test := range tests {
+		minutes, pages, ok := parseAttachmentLimits(test.text)
+		if minutes != test.minutes || pages != test.pages || ok != test.ok {
+			t.Errorf("parseAttachmentLimits(%q) = %d, %d, %v, want %d, %d, %v", test.text, minutes, pages, ok, test.minutes, test.pages, test.ok)
+		}
+	}
+}
+
+func TestAttachmentGuardrails(t *testing.T) {
+	audio := wavFile(120)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(audio)
+	}))
+	defer server.Close()
+
+	fake := &fakeAI{replies: []*ai.Reply{{Text: "Nice song"}}}
+	b, session := newTestBot(t, fake)
+	message := func() *discordgo.MessageCreate {
+		m := userMessage("what's this?")
+		m.Author = &discordgo.User{ID: "admin", Username: "admin"}
+		m.Attachments = []*discordgo.MessageAttachment{{ID: "song", Filename: "song.wav", ContentType: "audio/wav", URL: server.URL}}
+		return m
+	}
+
+	// Two minutes is over a limit of one
+	b.config().MaxMediaMinutes = 1
+	b.HandleMessage(message())
+	if len(session.messages) != 1 || !strings.Contains(session.messages[0], "song.wav is 2 minutes long") || len(fake.chats) != 0 {
+		t.Fatalf("sent %q, want the attachment refused", session.messages)
+	}
+
+	// Within the limits but over the tokens needing confirmation
+	session.messages = nil
+	b.config().MaxMediaMinutes = 0
+	b.config().AttachmentConfirmTokens = 1000
+	b.HandleMessage(message())
+	if len(session.messages) != 1 || !strings.Contains(session.messages[0], "about 3872 tokens") || len(fake.chats) != 0 {
+		t.Fatalf("sent %q, want a confirmation asked", session.messages)
+	}
+
+	stranger := settingsInteraction(0, discordgo.MessageComponentInteractionData{CustomID: attachmentsConfirmPrefix + "message"})
+	stranger.Member.User.ID = "bob"
+	b.HandleInteraction(stranger)
+	if len(session.responses) != 1 || !strings.Contains(session.responses[0].Data.Content, "Only whoever sent") {
+		t.Fatalf("responses to someone else = %v, want a refusal", session.responses)
+	}
+
+	session.messages, session.responses = nil, nil
+	b.HandleInteraction(settingsInteraction(0, discordgo.MessageComponentInteractionData{CustomID: attachmentsConfirmPrefix + "message"}))
+	if len(session.responses) != 1 || session.responses[0].Type != discordgo.InteractionResponseUpdateMessage {
+		t.Errorf("responses = %v, want the confirmation closed", session.responses)
+	}
+	if len(session.messages) != 1 || session.messages[0] != "Nice song" ||
+		!strings.Contains(partsText(fake.chats[0].sent[0]), "[uploaded song.wav]") {
+		t.Errorf("sent %q, want the message answered with its attachment", session.messages)
+	}
+
+	// Each confirmation is answered once
+	session.responses = nil
+	b.HandleInteraction(settingsInteraction(0, discordgo.MessageComponentInteractionData{CustomID: attachmentsConfirmPrefix + "message"}))
+	if len(session.responses) != 1 || !strings.Contains(session.responses[0].Data.Content, "expired") {
+		t.Errorf("responses to a second press = %v, want it expired", session.responses)
+	}
+	if len(b.probed) != 0 {
+		t.Errorf("%d probed attachments kept after answering", len(b.probed))
+	}
+}
@@ -0,0 +1,187 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/store"
+)
+
+const (
+	// Conversation profiles per channel
+	maxChatProfiles = 10
+
+	// Name /chat uses for a channel's usual conversation
+	defaultProfile = "default"
+)
+
+// profileChatKey is the key of a conversation profile's chat, one per
+// provider so switching providers starts it afresh like the shared chats
+func profileChatKey(provider string, channelID string, profile string) string {
+	return provider + ":" + channelID + ":" + profile
+}
+
+// activeProfile returns the conversation profile the bot answers with in a
+// channel, or nil for its default conversation
+func (b *Bot) activeProfile(channelID string) *store.ChatProfile {
+	profile, err := b.store.ActiveChatProfile(channelID)
+	if err != nil {
+		slog.Error("Error loading conversation profile", "channel", channelID, "error", err)
+	}
+	return profile
+}
+
+// withPersona prepends the persona of the channel's active conversation
+// profile to a message's parts
+func (b *Bot) withPersona(channelID string, parts []genai.Part) []genai.Part {
+	profile := b.activeProfile(channelID)
+	if profile == nil || profile.Persona == "" {
+		return parts
+	}
+	persona := genai.Text(fmt.Sprintf("In this conversation (%q), act as follows: %s", profile.Name, profile.Persona))
+	return append([]genai.Part{persona}, parts...)
+}
+
+// chatCommand handles /chat, switching between named conversations of a
+// channel that each keep their own history and persona
+func (b *Bot) chatCommand(i *discordgo.InteractionCreate) {
+	subcommand := i.ApplicationCommandData().Options[0]
+
+	switch subcommand.Name {
+	case "switch":
+		name := strings.ToLower(strings.TrimSpace(commandOption(subcommand.Options, "name").StringValue()))
+		var persona string
+		if option := commandOption(subcommand.Options, "persona"); option != nil {
+			persona = strings.TrimSpace(option.StringValue())
+		}
+		b.switchProfile(i, name, persona)
+	case "list":
+		b.listProfiles(i)
+	case "delete":
+		name := strings.ToLower(strings.TrimSpace(commandOption(subcommand.Options, "name").StringValue()))
+		if name == defaultProfile {
+			b.respondEphemeral(i, tr(i, "The default conversation can't be deleted, use `/clear` to reset it."))
+			return
+		}
+		found, err := b.store.DeleteChatProfile(i.ChannelID, name)
+		if err != nil {
+			interactionLogger(i).Error("Error deleting conversation profile", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+		if !found {
+			b.respondEphemeral(i, tr(i, "There's no conversation named `%s` here. See `/chat list`.", name))
+			return
+		}
+		b.forgetProfileChat(i.ChannelID, name)
+		interactionLogger(i).Info("Deleted conversation profile", "name", name)
+		b.respondEphemeral(i, tr(i, "Deleted the conversation `%s`.", name))
+	}
+}
+
+// switchProfile makes a conversation profile the channel's active one,
+// creating it or replacing its persona when one is given
+func (b *Bot) switchProfile(i *discordgo.InteractionCreate, name string, persona string) {
+	if name == defaultProfile {
+		if persona != "" {
+			b.respondEphemeral(i, tr(i, "The default conversation can't have a persona, switch to a named one instead."))
+			return
+		}
+		if err := b.store.SetActiveChatProfile(i.ChannelID, ""); err != nil {
+			interactionLogger(i).Error("Error switching conversation profile", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+		interactionLogger(i).Info("Switched conversation profile", "name", name)
+		b.respond(i, tr(i, "Switched to the default conversation."))
+		return
+	}
+
+	profile, err := b.store.ChatProfile(i.ChannelID, name)
+	if err == nil && (profile == nil || persona != "") {
+		profile = &store.ChatProfile{ChannelID: i.ChannelID, Name: name, Persona: persona}
+		err = b.store.SaveChatProfile(*profile, maxChatProfiles)
+	}
+	if errors.Is(err, store.ErrProfilesFull) {
+		b.respondEphemeral(i, tr(i, "This channel already has %d conversations, delete one with `/chat delete` first.", maxChatProfiles))
+		return
+	}
+	if err == nil {
+		err = b.store.SetActiveChatProfile(i.ChannelID, name)
+	}
+	if err != nil {
+		interactionLogger(i).Error("Error switching conversation profile", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+
+	interactionLogger(i).Info("Switched conversation profile", "name", name)
+	content := tr(i, "Switched to the conversation `%s`.", name)
+	if profile.Persona != "" {
+		content += "\n" + tr(i, "**Persona:** %s", profile.Persona)
+	}
+	b.respond(i, truncate(content, 2000))
+}
+
+// listProfiles lists a channel's conversation profiles, marking the active one
+func (b *Bot) listProfiles(i *discordgo.InteractionCreate) {
+	profiles, err := b.store.ChatProfiles(i.ChannelID)
+	if err != nil {
+		interactionLogger(i).Error("Error loading conversation profiles", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	active := defaultProfile
+	if profile := b.activeProfile(i.ChannelID); profile != nil {
+		active = profile.Name
+	}
+
+	lines := []string{profileLine(i, store.ChatProfile{Name: defaultProfile}, active)}
+	for _, profile := range profiles {
+		lines = append(lines, profileLine(i, profile, active))
+	}
+	b.respondEphemeral(i, truncate(strings.Join(lines, "\n"), 2000))
+}
+
+// profileLine describes a conversation profile in /chat list
+func profileLine(i *discordgo.InteractionCreate, profile store.ChatProfile, active string) string {
+	line := "`" + profile.Name + "`"
+	if profile.Persona != "" {
+		line += " " + truncate(profile.Persona, 100)
+	}
+	if profile.Name == active {
+		line += " " + tr(i, "(active)")
+	}
+	return line
+}
+
+// forgetProfileChat drops the chats of a deleted conversation profile
+func (b *Bot) forgetProfileChat(channelID string, profile string) {
+	b.chatsMu.Lock()
+	defer b.chatsMu.Unlock()
+
+	for provider := range b.providers {
+		key := profileChatKey(provider, channelID, profile)
+		if chat, ok := b.profileChats[key]; ok {
+			b.forgetLastTurn(chat)
+			delete(b.profileChats, key)
+		}
+		b.deleteSession("profile:" + key)
+	}
+}
+
+// forgetProfileChats drops the chats of every conversation profile of a
+// deleted channel or thread. The caller holds chatsMu.
+func (b *Bot) forgetProfileChats(channelID string) {
+	for key, chat := range b.profileChats {
+		if _, rest, _ := strings.Cut(key, ":"); strings.HasPrefix(rest, channelID+":") {
+			b.forgetLastTurn(chat)
+			delete(b.profileChats, key)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+)
+
+// chatInteraction is a /chat subcommand run by "alice" in "channel"
+func chatInteraction(subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	i := checkpointInteraction(subcommand, options...)
+	data := i.Data.(discordgo.ApplicationCommandInteractionData)
+	data.Name = "chat"
+	i.Data = data
+	return i
+}
+
+func TestChatCommand(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello"}}}
+	b, session := newTestBot(t, client)
+
+	b.HandleMessage(userMessage("hi"))
+	shared := b.chatFor("channel", "guild")
+
+	steps := []struct {
+		interaction *discordgo.InteractionCreate
+		want        string
+	}{
+		{chatInteraction("switch", stringOption("name", "DnD"), stringOption("persona", "A dramatic dungeon master")),
+			"Switched to the conversation `dnd`.\n**Persona:** A dramatic dungeon master"},
+		{chatInteraction("switch", stringOption("name", "default"), stringOption("persona", "Pirate")),
+			"The default conversation can't have a persona, switch to a named one instead."},
+		{chatInteraction("list"), "`default`\n`dnd` A dramatic dungeon master (active)"},
+		{chatInteraction("delete", stringOption("name", "coding")), "There's no conversation named `coding` here. See `/chat list`."},
+	}
+	for _, step := range steps {
+		session.responses = nil
+		b.HandleInteraction(step.interaction)
+		if len(session.responses) != 1 || session.responses[0].Data.Content != step.want {
+			t.Errorf("responded %v, want %q", session.responses, step.want)
+		}
+	}
+
+	// The profile has its own history, and its persona comes with every message
+	b.HandleMessage(userMessage("roll for initiative"))
+	profile := b.chatFor("channel", "guild")
+	if profile == shared || len(shared.History()) != 2 || len(profile.History()) != 2 {
+		t.Fatalf("shared chat has %d entries and the profile's %d, want separate chats of 2", len(shared.History()), len(profile.History()))
+	}
+	prompt := partsText(profile.History()[0].Parts)
+	if !strings.HasPrefix(prompt, `In this conversation ("dnd"), act as follows: A dramatic dungeon master`) || !strings.HasSuffix(prompt, "roll for initiative") {
+		t.Errorf("prompt %q, want the persona and the message", prompt)
+	}
+
+	// Switching back returns to the shared chat, and back again to the profile's
+	b.HandleInteraction(chatInteraction("switch", stringOption("name", "default")))
+	if b.chatFor("channel", "guild") != shared {
+		t.Error("switching to default didn't return to the shared chat")
+	}
+	b.HandleInteraction(chatInteraction("switch", stringOption("name", "dnd")))
+	if b.chatFor("channel", "guild") != profile {
+		t.Error("switching back to the profile lost its chat")
+	}
+
+	// Deleting the active profile goes back to the default conversation
+	session.responses = nil
+	b.HandleInteraction(chatInteraction("delete", stringOption("name", "dnd")))
+	if len(session.responses) != 1 || session.responses[0].Data.Content != "Deleted the conversation `dnd`." {
+		t.Errorf("responded %v, want the profile deleted", session.responses)
+	}
+	if b.chatFor("channel", "guild") != shared {
+		t.Error("deleting the active profile didn't return to the shared chat")
+	}
+}
+
+func TestWithPersona(t *testing.T) {
+	b, _ := newTestBot(t, &fakeAI{})
+	parts := []genai.Part{genai.Text("hi")}
+
+	if got := b.withPersona("channel", parts); len(got) != 1 {
+		t.Errorf("withPersona without a profile = %v, want the parts unchanged", got)
+	}
+	b.HandleInteraction(chatInteraction("switch", stringOption("name", "plain")))
+	if got := b.withPersona("channel", parts); len(got) != 1 {
+		t.Errorf("withPersona of a profile without a persona = %v, want the parts unchanged", got)
+	}
+}
@@ -0,0 +1,185 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/store"
+)
+
+// Prompt templates each server may save
+const maxPromptTemplates = 100
+
+// Placeholders such as {input} in prompt templates
+var templatePlaceholder = regexp.MustCompile(`\{(\w+)\}`)
+
+// Placeholders prompt templates may use, and what they are replaced with
+var templatePlaceholders = map[string]func(i *discordgo.InteractionCreate, input string) string{
+	"input": func(_ *discordgo.InteractionCreate, input string) string { return input },
+	"user":  func(i *discordgo.InteractionCreate, _ string) string { return interactionUser(i).Username },
+	"date":  func(*discordgo.InteractionCreate, string) string { return time.Now().UTC().Format("2006-01-02") },
+}
+
+// promptCommand handles the /prompt subcommands, which save, list and run
+// the server's prompt templates
+func (b *Bot) promptCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Prompt templates only work in servers."))
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	switch subcommand.Name {
+	case "save":
+		b.savePromptTemplate(i, commandOption(subcommand.Options, "name").StringValue(), commandOption(subcommand.Options, "template").StringValue())
+	case "list":
+		b.listPromptTemplates(i)
+	case "run":
+		input := ""
+		if option := commandOption(subcommand.Options, "input"); option != nil {
+			input = option.StringValue()
+		}
+		b.runPromptTemplate(i, commandOption(subcommand.Options, "name").StringValue(), input)
+	}
+}
+
+// savePromptTemplate saves a prompt template. Only its author or members with
+// the Manage Server permission may replace an existing one.
+func (b *Bot) savePromptTemplate(i *discordgo.InteractionCreate, name string, template string) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, match := range templatePlaceholder.FindAllStringSubmatch(template, -1) {
+		if _, ok := templatePlaceholders[match[1]]; !ok {
+			b.respondEphemeral(i, tr(i, "Unknown placeholder `{%s}`. Templates can use `{input}`, `{user}` and `{date}`.", match[1]))
+			return
+		}
+	}
+
+	userID := interactionUserID(i)
+	existing, err := b.store.PromptTemplate(i.GuildID, name)
+	if err != nil {
+		interactionLogger(i).Error("Error loading prompt template", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if existing != nil && existing.AuthorID != userID && (i.Member == nil || i.Member.Permissions&discordgo.PermissionManageServer == 0) {
+		b.respondEphemeral(i, tr(i, "The template `%s` belongs to someone else. You need the Manage Server permission to replace it.", name))
+		return
+	}
+
+	err = b.store.SavePromptTemplate(store.PromptTemplate{GuildID: i.GuildID, Name: name, Template: template, AuthorID: userID}, maxPromptTemplates)
+	if errors.Is(err, store.ErrTemplatesFull) {
+		b.respondEphemeral(i, tr(i, "This server already has %d prompt templates.", maxPromptTemplates))
+		return
+	}
+	if err != nil {
+		interactionLogger(i).Error("Error saving prompt template", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	interactionLogger(i).Info("Saved prompt template", "name", name)
+	b.respondEphemeral(i, tr(i, "Saved the template `%s`. Run it with `/prompt run name:%s`.", name, name))
+}
+
+// listPromptTemplates lists the server's prompt templates
+func (b *Bot) listPromptTemplates(i *discordgo.InteractionCreate) {
+	templates, err := b.store.PromptTemplates(i.GuildID)
+	if err != nil {
+		interactionLogger(i).Error("Error loading prompt templates", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if len(templates) == 0 {
+		b.respondEphemeral(i, tr(i, "This server has no prompt templates yet. Save one with `/prompt save`."))
+		return
+	}
+	var lines []string
+	for _, t := range templates {
+		lines = append(lines, fmt.Sprintf("`%s` %s", t.Name, truncate(strings.ReplaceAll(t.Template, "\n", " "), 100)))
+	}
+	b.respondEphemeral(i, truncate(strings.Join(lines, "\n"), 2000))
+}
+
+// runPromptTemplate fills in a prompt template and answers it
+func (b *Bot) runPromptTemplate(i *discordgo.InteractionCreate, name string, input string) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	template, err := b.store.PromptTemplate(i.GuildID, name)
+	if err != nil {
+		interactionLogger(i).Error("Error loading prompt template", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if template == nil {
+		b.respondEphemeral(i, tr(i, "There's no template named `%s`. See `/prompt list`.", name))
+		return
+	}
+
+	err = b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to prompt command", "error", err)
+		return
+	}
+
+	answer, err := b.generate(interactionUserID(i), i.GuildID, genai.Text(fillTemplate(i, template.Template, input)))
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if answer == "" {
+		answer = tr(i, "I couldn't generate a response.")
+	}
+	b.editInteractionResponseLong(i, answer, 0)
+}
+
+// fillTemplate replaces a template's placeholders. Input given to a template
+// without an {input} placeholder is added after it.
+func fillTemplate(i *discordgo.InteractionCreate, template string, input string) string {
+	prompt := templatePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		if fill, ok := templatePlaceholders[placeholder[1:len(placeholder)-1]]; ok {
+			return fill(i, input)
+		}
+		return placeholder
+	})
+	if input != "" && !strings.Contains(template, "{input}") {
+		prompt += "\n\n" + input
+	}
+	return prompt
+}
+
+// autocompletePromptTemplate suggests the server's templates matching the
+// name typed so far
+func (b *Bot) autocompletePromptTemplate(i *discordgo.InteractionCreate) {
+	typed := ""
+	if option := commandOption(i.ApplicationCommandData().Options[0].Options, "name"); option != nil {
+		typed = strings.ToLower(strings.TrimSpace(option.StringValue()))
+	}
+
+	templates, err := b.store.PromptTemplates(i.GuildID)
+	if err != nil {
+		interactionLogger(i).Error("Error loading prompt templates", "error", err)
+	}
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, t := range templates {
+		if strings.Contains(t.Name, typed) && len(choices) < 25 {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: t.Name, Value: t.Name})
+		}
+	}
+
+	err = b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to prompt template autocomplete", "error", err)
+	}
+}
@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// promptInteraction is a /prompt subcommand sent by a server member
+func promptInteraction(userID string, permissions int64, subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:    discordgo.InteractionApplicationCommand,
+		GuildID: "guild",
+		Member:  &discordgo.Member{User: &discordgo.User{ID: userID, Username: userID}, Permissions: permissions},
+		Data: discordgo.ApplicationCommandInteractionData{
+			Name: "prompt",
+			Options: []*discordgo.ApplicationCommandInteractionDataOption{
+				{Name: subcommand, Type: discordgo.ApplicationCommandOptionSubCommand, Options: options},
+			},
+		},
+	}}
+}
+
+func TestPromptCommand(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{text: "Done: shipped the release"})
+
+	steps := []struct {
+		interaction *discordgo.InteractionCreate
+		want        string
+	}{
+		{promptInteraction("alice", 0, "save", stringOption("name", "Standup"), stringOption("template", "Summarize: {input}")),
+			"Saved the template `standup`. Run it with `/prompt run name:standup`."},
+		{promptInteraction("alice", 0, "save", stringOption("name", "bad"), stringOption("template", "Hi {name}")),
+			"Unknown placeholder `{name}`. Templates can use `{input}`, `{user}` and `{date}`."},
+		{promptInteraction("bob", 0, "save", stringOption("name", "standup"), stringOption("template", "Mine: {input}")),
+			"The template `standup` belongs to someone else. You need the Manage Server permission to replace it."},
+		{promptInteraction("carol", discordgo.PermissionManageServer, "save", stringOption("name", "standup"), stringOption("template", "Summarize briefly: {input}")),
+			"Saved the template `standup`. Run it with `/prompt run name:standup`."},
+		{promptInteraction("bob", 0, "list"), "`standup` Summarize briefly: {input}"},
+		{promptInteraction("bob", 0, "run", stringOption("name", "missing")), "There's no template named `missing`. See `/prompt list`."},
+	}
+	for _, step := range steps {
+		session.responses = nil
+		b.HandleInteraction(step.interaction)
+		if len(session.responses) != 1 || session.responses[0].Data.Content != step.want {
+			t.Errorf("responded %v, want %q", session.responses, step.want)
+		}
+	}
+
+	b.HandleInteraction(promptInteraction("bob", 0, "run", stringOption("name", "standup"), stringOption("input", "release notes")))
+	if len(session.edits) != 1 || *session.edits[0].Content != "Done: shipped the release" {
+		t.Errorf("edits = %v, want the answer", session.edits)
+	}
+}
+
+func TestFillTemplate(t *testing.T) {
+	i := promptInteraction("alice", 0, "run")
+	date := time.Now().UTC().Format("2006-01-02")
+	tests := []struct {
+		template string
+		input    string
+		want     string
+	}{
+		{"Summarize: {input}", "notes", "Summarize: notes"},
+		{"Greet {user} on {date}", "", "Greet alice on " + date},
+		{"Translate to French", "hello", "Translate to French\n\nhello"},
+		{"Keep {unknown}", "", "Keep {unknown}"},
+	}
+	for _, test := range tests {
+		if got := fillTemplate(i, test.template, test.input); got != test.want {
+			t.Errorf("fillTemplate(%q, %q) = %q, want %q", test.template, test.input, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+// Names of the AI providers guilds can choose between
+const (
+	ProviderGemini = "gemini"
+	ProviderOpenAI = "openai"
+)
+
+// AddProvider makes an AI provider available to guilds under a name
+func (b *Bot) AddProvider(name string, client ai.Client) {
+	b.providers[name] = client
+}
+
+// provider returns the name and client of the AI provider a guild uses,
+// falling back to the default provider
+func (b *Bot) provider(guildID string) (string, ai.Client) {
+	if guildID != "" {
+		name, err := b.store.GuildProvider(guildID)
+		if err != nil {
+			slog.Error("Error loading guild provider", "guild", guildID, "error", err)
+		}
+		if client, ok := b.providers[name]; ok {
+			return name, client
+		}
+	}
+	return b.defaultProvider, b.ai
+}
+
+// aiFor returns the AI client answering in a guild. Embeddings, images and
+// speech always use the default provider, so stored vectors stay comparable.
+func (b *Bot) aiFor(guildID string) ai.Client {
+	_, client := b.provider(guildID)
+	return client
+}
+
+// providerCommand handles /provider, showing the server's AI provider or
+// switching it
+func (b *Bot) providerCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Providers can only be chosen in servers."))
+		return
+	}
+	current, _ := b.provider(i.GuildID)
+
+	option := commandOption(i.ApplicationCommandData().Options, "name")
+	if option == nil {
+		var available []string
+		for name := range b.providers {
+			available = append(available, "`"+name+"`")
+		}
+		slices.Sort(available)
+		b.respondEphemeral(i, tr(i, "This server uses `%s`. Available providers: %s.", current, strings.Join(available, ", ")))
+		return
+	}
+
+	if i.Member == nil || i.Member.Permissions&discordgo.PermissionManageServer == 0 {
+		b.respondEphemeral(i, tr(i, "You need the Manage Server permission to change the provider."))
+		return
+	}
+	name := option.StringValue()
+	if _, ok := b.providers[name]; !ok {
+		b.respondEphemeral(i, tr(i, "The `%s` provider isn't configured on this bot.", name))
+		return
+	}
+	if err := b.store.SetGuildProvider(i.GuildID, name); err != nil {
+		interactionLogger(i).Error("Error setting guild provider", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, I couldn't change the provider."))
+		return
+	}
+	interactionLogger(i).Info("Changed guild provider", "from", current, "to", name)
+	b.respondEphemeral(i, tr(i, "This server now uses `%s`. Existing threads keep their provider until cleared with `/clear`.", name))
+}
@@ -0,0 +1,64 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+// providerInteraction is a /provider command from a guild member
+func providerInteraction(name string, permissions int64) *discordgo.InteractionCreate {
+	data := discordgo.ApplicationCommandInteractionData{Name: "provider"}
+	if name != "" {
+		data.Options = []*discordgo.ApplicationCommandInteractionDataOption{
+			{Name: "name", Type: discordgo.ApplicationCommandOptionString, Value: name},
+		}
+	}
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:    discordgo.InteractionApplicationCommand,
+		GuildID: "guild",
+		Member:  &discordgo.Member{User: &discordgo.User{ID: "user"}, Permissions: permissions},
+		Data:    data,
+	}}
+}
+
+func TestProviderCommandSwitchesGuildChat(t *testing.T) {
+	gemini := &fakeAI{replies: []*ai.Reply{{Text: "from gemini"}}}
+	openAI := &fakeAI{replies: []*ai.Reply{{Text: "from openai"}}}
+	b, session := newTestBot(t, gemini)
+	b.AddProvider(ProviderOpenAI, openAI)
+
+	b.HandleInteraction(providerInteraction(ProviderOpenAI, discordgo.PermissionManageServer))
+	b.HandleMessage(userMessage("hi"))
+
+	if len(session.messages) != 1 || session.messages[0] != "from openai" {
+		t.Errorf("sent %q, want the OpenAI provider's reply", session.messages)
+	}
+	if len(gemini.chats) > 0 && len(gemini.chats[0].sent) > 0 {
+		t.Error("the default provider's chat was used")
+	}
+}
+
+func TestProviderCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		option      string
+		permissions int64
+		want        string
+	}{
+		{"show", "", 0, "This server uses `gemini`. Available providers: `gemini`."},
+		{"no permission", ProviderGemini, 0, "You need the Manage Server permission to change the provider."},
+		{"not configured", ProviderOpenAI, discordgo.PermissionManageServer, "The `openai` provider isn't configured on this bot."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, session := newTestBot(t, &fakeAI{})
+			b.HandleInteraction(providerInteraction(test.option, test.permissions))
+			if len(session.responses) != 1 || session.responses[0].Data.Content != test.want {
+				t.Errorf("responded %v, want %q", session.responses, test.want)
+			}
+		})
+	}
+}
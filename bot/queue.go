@@ -0,0 +1,55 @@
+package bot
+
+import "sync"
+
+// ticket is a message's place in the queue of its channel, whose messages
+// are answered in the order they were sent while other channels' are
+// answered at the same time
+type ticket struct {
+	channelID string
+
+	// Closed once the previous message of the channel was handled, nil for
+	// the first one, and once this one was
+	prev chan struct{}
+	done chan struct{}
+
+	release sync.Once
+}
+
+// takeTicket queues a message of a channel behind the ones before it. The
+// gateway hands messages over in order, so their tickets are taken before
+// their handlers start.
+func (b *Bot) takeTicket(channelID string) *ticket {
+	b.queuesMu.Lock()
+	defer b.queuesMu.Unlock()
+
+	t := &ticket{channelID: channelID, prev: b.queues[channelID], done: make(chan struct{})}
+	b.queues[channelID] = t.done
+	return t
+}
+
+// wait blocks until every earlier message of the ticket's channel was
+// handled
+func (t *ticket) wait() {
+	if t.prev != nil {
+		<-t.prev
+	}
+}
+
+// releaseTicket lets the next message of a channel go on once this one and
+// the earlier ones were handled, whether they were answered or not. It may
+// be called more than once.
+func (b *Bot) releaseTicket(t *ticket) {
+	t.release.Do(func() {
+		go func() {
+			t.wait()
+			close(t.done)
+
+			b.queuesMu.Lock()
+			defer b.queuesMu.Unlock()
+			if b.queues[t.channelID] == t.done {
+				delete(b.queues, t.channelID)
+			}
+		}()
+	})
+}
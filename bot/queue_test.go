@@ -0,0 +1,48 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTickets(t *testing.T) {
+	b, _ := newTestBot(t, &fakeAI{})
+
+	first := b.takeTicket("channel")
+	second := b.takeTicket("channel")
+	other := b.takeTicket("other")
+
+	// Other channels don't wait
+	other.wait()
+	b.releaseTicket(other)
+
+	waited := make(chan struct{})
+	go func() {
+		second.wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("second message went ahead of the first")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	b.releaseTicket(first)
+	b.releaseTicket(first)
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("second message still waiting after the first was handled")
+	}
+
+	b.releaseTicket(second)
+	for {
+		b.queuesMu.Lock()
+		left := len(b.queues)
+		b.queuesMu.Unlock()
+		if left == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,403 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/store"
+)
+
+const (
+	// Custom IDs of the quiz buttons all start with quizPrefix. Answers are
+	// "quiz-answer:<question>:<option>" and the next button
+	// "quiz-next:<question>", so buttons of earlier questions can be told apart.
+	quizPrefix       = "quiz-"
+	quizAnswerPrefix = "quiz-answer:"
+	quizNextPrefix   = "quiz-next:"
+
+	// Number of questions of a quiz when none is asked for, and at most
+	defaultQuizQuestions = 5
+	maxQuizQuestions     = 10
+
+	// Options of each question, which are labeled with letters
+	minQuizOptions = 2
+	maxQuizOptions = 4
+
+	// Members shown on a quiz's leaderboard
+	quizLeaderboardSize = 10
+)
+
+// Lower bound of the /quiz start questions option (the API takes a pointer)
+var minQuizQuestions = 1.0
+
+// quizLetters label the options of a question
+var quizLetters = []string{"A", "B", "C", "D"}
+
+// quizCommand handles /quiz: start has the model write a quiz about a topic
+// and asks its first question, stop ends the channel's quiz early
+func (b *Bot) quizCommand(i *discordgo.InteractionCreate) {
+	subcommand := i.ApplicationCommandData().Options[0]
+
+	switch subcommand.Name {
+	case "start":
+		count := defaultQuizQuestions
+		if option := commandOption(subcommand.Options, "questions"); option != nil {
+			count = int(option.IntValue())
+		}
+		b.startQuiz(i, commandOption(subcommand.Options, "topic").StringValue(), count)
+	case "stop":
+		quiz, err := b.store.Quiz(i.ChannelID)
+		if err != nil {
+			interactionLogger(i).Error("Error loading quiz", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+		if quiz == nil {
+			b.respondEphemeral(i, tr(i, "There's no quiz going on in this channel."))
+			return
+		}
+		if !canRunQuiz(i, quiz) {
+			b.respondEphemeral(i, tr(i, "Only whoever started the quiz or a moderator can do that."))
+			return
+		}
+		b.closeQuizQuestion(quiz)
+		b.finishQuiz(i, quiz, discordgo.InteractionResponseChannelMessageWithSource)
+	}
+}
+
+// startQuiz writes a quiz about a topic, saves it and asks its first question
+func (b *Bot) startQuiz(i *discordgo.InteractionCreate, topic string, count int) {
+	if quiz, err := b.store.Quiz(i.ChannelID); err == nil && quiz != nil {
+		b.respondEphemeral(i, tr(i, "A quiz is already going on in this channel, finish it or end it with `/quiz stop`."))
+		return
+	}
+
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to quiz command", "error", err)
+		return
+	}
+
+	questions, err := b.writeQuiz(interactionUserID(i), i.GuildID, topic, count)
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	quiz := store.Quiz{
+		ChannelID: i.ChannelID,
+		GuildID:   i.GuildID,
+		Topic:     topic,
+		StartedBy: interactionUserID(i),
+		Questions: questions,
+		StartedAt: time.Now(),
+	}
+	if err := b.store.StartQuiz(quiz); err != nil {
+		if !errors.Is(err, store.ErrQuizRunning) {
+			interactionLogger(i).Error("Error saving quiz", "error", err)
+		}
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	interactionLogger(i).Info("Started quiz", "questions", len(questions))
+
+	b.editInteractionResponse(i, tr(i, "🧠 Quiz time! %d questions about **%s**, answer with the buttons. <@%s> moves on to the next question.",
+		len(questions), topic, quiz.StartedBy))
+	if err := b.askQuizQuestion(&quiz, 0); err != nil {
+		interactionLogger(i).Error("Error asking quiz question", "error", err)
+	}
+}
+
+// writeQuiz asks the model for multiple-choice questions about a topic,
+// dropping the ones that can't be asked with buttons
+func (b *Bot) writeQuiz(userID string, guildID string, topic string, count int) ([]store.QuizQuestion, error) {
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"questions": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"question": {Type: genai.TypeString},
+						"options": {
+							Type:        genai.TypeArray,
+							Description: fmt.Sprintf("%d to %d short options, exactly one of them right", minQuizOptions, maxQuizOptions),
+							Items:       &genai.Schema{Type: genai.TypeString},
+						},
+						"answer": {Type: genai.TypeInteger, Description: "Index of the right option, from 0"},
+					},
+					Required: []string{"question", "options", "answer"},
+				},
+			},
+		},
+		Required: []string{"questions"},
+	}
+	prompt := fmt.Sprintf("Write a trivia quiz of %d multiple-choice questions about the following topic, "+
+		"from easy to hard, each with %d options of which exactly one is right.\n\nTopic: %s", count, maxQuizOptions, topic)
+	text, err := b.generateJSON(userID, guildID, schema, genai.Text(prompt))
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Questions []struct {
+			Question string   `json:"question"`
+			Options  []string `json:"options"`
+			Answer   int      `json:"answer"`
+		} `json:"questions"`
+	}
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
+		return nil, fmt.Errorf("error parsing quiz: %v", err)
+	}
+	var questions []store.QuizQuestion
+	for _, q := range result.Questions {
+		options := make([]string, 0, len(q.Options))
+		for _, option := range q.Options {
+			if option = strings.TrimSpace(strings.ReplaceAll(option, "\n", " ")); option != "" {
+				options = append(options, option)
+			}
+		}
+		if strings.TrimSpace(q.Question) == "" || len(options) != len(q.Options) ||
+			len(options) < minQuizOptions || len(options) > maxQuizOptions || q.Answer < 0 || q.Answer >= len(options) {
+			continue
+		}
+		questions = append(questions, store.QuizQuestion{Question: strings.TrimSpace(q.Question), Options: options, Answer: q.Answer})
+		if len(questions) == count {
+			break
+		}
+	}
+	if len(questions) == 0 {
+		return nil, errors.New("no usable quiz questions")
+	}
+	return questions, nil
+}
+
+// askQuizQuestion posts a question of a quiz with its answer buttons and
+// makes it the current one
+func (b *Bot) askQuizQuestion(quiz *store.Quiz, number int) error {
+	q := quiz.Questions[number]
+	var description strings.Builder
+	description.WriteString(q.Question + "\n")
+	answers := make([]discordgo.MessageComponent, len(q.Options))
+	for n, option := range q.Options {
+		fmt.Fprintf(&description, "\n**%s.** %s", quizLetters[n], option)
+		answers[n] = discordgo.Button{
+			CustomID: fmt.Sprintf("%s%d:%d", quizAnswerPrefix, number, n),
+			Label:    quizLetters[n],
+			Style:    discordgo.PrimaryButton,
+		}
+	}
+	nextLabel := "Next question"
+	if number == len(quiz.Questions)-1 {
+		nextLabel = "Finish quiz"
+	}
+
+	message, err := b.session.ChannelMessageSendComplex(quiz.ChannelID, &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{{
+			Title:       fmt.Sprintf("Question %d of %d", number+1, len(quiz.Questions)),
+			Description: truncate(description.String(), 4096),
+			Color:       embedColor,
+		}},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: answers},
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{CustomID: quizNextPrefix + strconv.Itoa(number), Label: nextLabel, Style: discordgo.SecondaryButton},
+			}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	quiz.Current, quiz.MessageID = number, message.ID
+	return b.store.SetQuizQuestion(quiz.ChannelID, number, message.ID)
+}
+
+// quizComponent handles the buttons of a quiz question: answering it, or
+// moving on to the next one
+func (b *Bot) quizComponent(i *discordgo.InteractionCreate) {
+	customID := i.MessageComponentData().CustomID
+	quiz, err := b.store.Quiz(i.ChannelID)
+	if err != nil {
+		interactionLogger(i).Error("Error loading quiz", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+
+	if rest, ok := strings.CutPrefix(customID, quizAnswerPrefix); ok {
+		number, option, _ := strings.Cut(rest, ":")
+		b.answerQuiz(i, quiz, number, option)
+		return
+	}
+	number, ok := strings.CutPrefix(customID, quizNextPrefix)
+	if !ok {
+		return
+	}
+	if quiz == nil || strconv.Itoa(quiz.Current) != number {
+		b.respondEphemeral(i, tr(i, "This question is closed."))
+		return
+	}
+	if !canRunQuiz(i, quiz) {
+		b.respondEphemeral(i, tr(i, "Only whoever started the quiz or a moderator can do that."))
+		return
+	}
+
+	// Reveal the answer on the question's message, then ask the next one
+	err = b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{quizAnswerEmbed(i.Message, quiz.Questions[quiz.Current])},
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error closing quiz question", "error", err)
+	}
+	if quiz.Current+1 < len(quiz.Questions) {
+		if err := b.askQuizQuestion(quiz, quiz.Current+1); err != nil {
+			interactionLogger(i).Error("Error asking quiz question", "error", err)
+		}
+		return
+	}
+	b.finishQuiz(i, quiz, 0)
+}
+
+// answerQuiz records a member's answer to a quiz question, telling them
+// privately whether it's right
+func (b *Bot) answerQuiz(i *discordgo.InteractionCreate, quiz *store.Quiz, number string, option string) {
+	if quiz == nil || strconv.Itoa(quiz.Current) != number {
+		b.respondEphemeral(i, tr(i, "This question is closed."))
+		return
+	}
+	q := quiz.Questions[quiz.Current]
+	picked, err := strconv.Atoi(option)
+	if err != nil || picked < 0 || picked >= len(q.Options) {
+		return
+	}
+
+	correct := picked == q.Answer
+	recorded, err := b.store.AnswerQuiz(quiz.ChannelID, quiz.Current, interactionUserID(i), correct)
+	if err != nil {
+		interactionLogger(i).Error("Error recording quiz answer", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	switch {
+	case !recorded:
+		b.respondEphemeral(i, tr(i, "You already answered this question."))
+	case correct:
+		b.respondEphemeral(i, tr(i, "✅ Correct!"))
+	default:
+		b.respondEphemeral(i, tr(i, "❌ Not quite, the answer is **%s. %s**.", quizLetters[q.Answer], q.Options[q.Answer]))
+	}
+}
+
+// closeQuizQuestion reveals the answer of a quiz's current question on its
+// message and removes its buttons, for quizzes ended early
+func (b *Bot) closeQuizQuestion(quiz *store.Quiz) {
+	if quiz.MessageID == "" {
+		return
+	}
+	message, err := b.session.ChannelMessage(quiz.ChannelID, quiz.MessageID)
+	if err != nil {
+		return
+	}
+	content := message.Content
+	embeds := []*discordgo.MessageEmbed{quizAnswerEmbed(message, quiz.Questions[quiz.Current])}
+	_, err = b.session.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:         quiz.MessageID,
+		Channel:    quiz.ChannelID,
+		Content:    &content,
+		Embeds:     &embeds,
+		Components: &[]discordgo.MessageComponent{},
+	})
+	if err != nil {
+		slog.Warn("Error closing quiz question", "channel", quiz.ChannelID, "error", err)
+	}
+}
+
+// finishQuiz posts a quiz's leaderboard and deletes it. The leaderboard
+// answers the interaction with responseType, or is sent to the channel when
+// it is 0 because the interaction was already answered.
+func (b *Bot) finishQuiz(i *discordgo.InteractionCreate, quiz *store.Quiz, responseType discordgo.InteractionResponseType) {
+	scores, err := b.store.QuizScores(quiz.ChannelID)
+	if err != nil {
+		interactionLogger(i).Error("Error loading quiz scores", "error", err)
+	}
+	if err := b.store.EndQuiz(quiz.ChannelID); err != nil {
+		interactionLogger(i).Error("Error ending quiz", "error", err)
+	}
+	interactionLogger(i).Info("Finished quiz", "players", len(scores))
+
+	embed := quizLeaderboard(quiz, scores)
+	if responseType == 0 {
+		if _, err := b.session.ChannelMessageSendComplex(quiz.ChannelID, &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}}); err != nil {
+			interactionLogger(i).Error("Error posting quiz leaderboard", "error", err)
+		}
+		return
+	}
+	err = b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: responseType,
+		Data: &discordgo.InteractionResponseData{Embeds: []*discordgo.MessageEmbed{embed}},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error posting quiz leaderboard", "error", err)
+	}
+}
+
+// quizLeaderboard shows the scores of a quiz, best first
+func quizLeaderboard(quiz *store.Quiz, scores []store.QuizScore) *discordgo.MessageEmbed {
+	var lines []string
+	for n, score := range scores {
+		if n == quizLeaderboardSize {
+			lines = append(lines, fmt.Sprintf("…and %d more", len(scores)-n))
+			break
+		}
+		medal := fmt.Sprintf("%d.", n+1)
+		if n < 3 {
+			medal = []string{"🥇", "🥈", "🥉"}[n]
+		}
+		lines = append(lines, fmt.Sprintf("%s <@%s>: **%d**/%d", medal, score.UserID, score.Correct, len(quiz.Questions)))
+	}
+	if len(lines) == 0 {
+		lines = []string{"Nobody answered."}
+	}
+	return &discordgo.MessageEmbed{
+		Title:       truncate("🏆 Quiz results: "+quiz.Topic, 256),
+		Description: strings.Join(lines, "\n"),
+		Color:       embedColor,
+	}
+}
+
+// quizAnswerEmbed returns the embed of a question's message with the right
+// answer added
+func quizAnswerEmbed(m *discordgo.Message, q store.QuizQuestion) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{Description: q.Question, Color: embedColor}
+	if m != nil && len(m.Embeds) > 0 {
+		copied := *m.Embeds[0]
+		embed = &copied
+	}
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "Answer", Value: truncate(fmt.Sprintf("**%s.** %s", quizLetters[q.Answer], q.Options[q.Answer]), 1024)},
+	}
+	return embed
+}
+
+// canRunQuiz reports whether an interaction comes from whoever started a
+// quiz or from a member who can manage messages, who move it on or stop it
+func canRunQuiz(i *discordgo.InteractionCreate, quiz *store.Quiz) bool {
+	if interactionUserID(i) == quiz.StartedBy {
+		return true
+	}
+	return i.Member != nil && i.Member.Permissions&discordgo.PermissionManageMessages != 0
+}
@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// quizButton is a member pressing a quiz button in the test channel
+func quizButton(userID, customID string) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:      discordgo.InteractionMessageComponent,
+		GuildID:   "guild",
+		ChannelID: "channel",
+		Member:    &discordgo.Member{User: &discordgo.User{ID: userID}},
+		Message:   &discordgo.Message{ID: "question"},
+		Data:      discordgo.MessageComponentInteractionData{CustomID: customID},
+	}}
+}
+
+func TestQuiz(t *testing.T) {
+	client := &fakeAI{text: `{"questions": [
+		{"question": "Who made Go?", "options": ["Google", "Mozilla", "Apple", "Sun"], "answer": 0},
+		{"question": "Broken", "options": ["Only one"], "answer": 0},
+		{"question": "Go's mascot?", "options": ["Crab", "Gopher"], "answer": 1}
+	]}`}
+	b, session := newTestBot(t, client)
+
+	start := commandInteraction("quiz")
+	start.ChannelID = "channel"
+	start.Data = discordgo.ApplicationCommandInteractionData{Name: "quiz", Options: []*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "start", Type: discordgo.ApplicationCommandOptionSubCommand, Options: []*discordgo.ApplicationCommandInteractionDataOption{stringOption("topic", "Go")}},
+	}}
+	b.HandleInteraction(start)
+	if len(session.embeds) != 1 || session.embeds[0].Title != "Question 1 of 2" || !strings.Contains(session.embeds[0].Description, "**A.** Google") {
+		t.Fatalf("embeds = %v, want the first of two questions", session.embeds)
+	}
+
+	// Starting another quiz in the channel is refused
+	session.responses = nil
+	b.HandleInteraction(start)
+	if len(session.responses) != 1 || !strings.Contains(session.responses[0].Data.Content, "already going on") {
+		t.Errorf("responses = %v, want a refusal", session.responses)
+	}
+
+	answers := []struct {
+		interaction *discordgo.InteractionCreate
+		want        string
+	}{
+		{quizButton("bob", quizAnswerPrefix+"0:0"), "Correct"},
+		{quizButton("bob", quizAnswerPrefix+"0:1"), "already answered"},
+		{quizButton("carol", quizAnswerPrefix+"0:2"), "the answer is **A. Google**"},
+		{quizButton("carol", quizAnswerPrefix+"1:1"), "closed"},
+		{quizButton("bob", quizNextPrefix+"0"), "Only whoever started the quiz"},
+	}
+	for _, answer := range answers {
+		session.responses = nil
+		b.HandleInteraction(answer.interaction)
+		if len(session.responses) != 1 || !strings.Contains(session.responses[0].Data.Content, answer.want) {
+			t.Errorf("responses to %s = %v, want %q", answer.interaction.MessageComponentData().CustomID, session.responses, answer.want)
+		}
+	}
+
+	// The starter moves on, revealing the answer
+	session.responses = nil
+	b.HandleInteraction(quizButton("user", quizNextPrefix+"0"))
+	if len(session.responses) != 1 || session.responses[0].Type != discordgo.InteractionResponseUpdateMessage ||
+		session.responses[0].Data.Embeds[0].Fields[0].Value != "**A.** Google" {
+		t.Errorf("responses = %v, want the answer revealed", session.responses)
+	}
+	if len(session.embeds) != 2 || session.embeds[1].Title != "Question 2 of 2" {
+		t.Fatalf("embeds = %v, want the second question", session.embeds)
+	}
+
+	b.HandleInteraction(quizButton("carol", quizAnswerPrefix+"1:1"))
+	b.HandleInteraction(quizButton("user", quizNextPrefix+"1"))
+	if len(session.embeds) != 3 {
+		t.Fatalf("embeds = %v, want the leaderboard", session.embeds)
+	}
+	if leaderboard := session.embeds[2].Description; leaderboard != "🥇 <@bob>: **1**/2\n🥈 <@carol>: **1**/2" {
+		t.Errorf("leaderboard = %q", leaderboard)
+	}
+	if quiz, err := b.store.Quiz("channel"); err != nil || quiz != nil {
+		t.Errorf("quiz after the last question = %+v, %v, want none", quiz, err)
+	}
+}
@@ -0,0 +1,288 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/store"
+)
+
+// Messages remembered as acted on, so a popular reaction runs its action once
+const maxReactedMessages = 1000
+
+// reactionAction is an AI action emoji reactions can trigger
+type reactionAction struct {
+	name        string
+	emoji       string // suggested by /reactions defaults
+	description string
+}
+
+// Actions reactions can trigger
+var reactionActions = []reactionAction{
+	{"summarize", "📌", "posts a TL;DR in a thread"},
+	{"translate", "🌐", "translates it into the server's language"},
+	{"explain", "❓", "explains it in simple terms"},
+}
+
+// reactionActionChoices returns the actions as choices of a command option
+func reactionActionChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, len(reactionActions))
+	for n, action := range reactionActions {
+		choices[n] = &discordgo.ApplicationCommandOptionChoice{Name: action.name, Value: action.name}
+	}
+	return choices
+}
+
+// Custom emojis as typed in a command option, like <:gopher:123>
+var customEmoji = regexp.MustCompile(`^<a?:(\w+):(\d+)>$`)
+
+// reactionEmoji normalizes an emoji typed in a command option to the form
+// reaction events use: the emoji itself, or "name:id" for custom emojis
+func reactionEmoji(text string) string {
+	text = strings.TrimSpace(text)
+	if match := customEmoji.FindStringSubmatch(text); match != nil {
+		return match[1] + ":" + match[2]
+	}
+	return text
+}
+
+// emojiText formats a reaction emoji for a message
+func emojiText(emoji string) string {
+	if name, id, ok := strings.Cut(emoji, ":"); ok {
+		return fmt.Sprintf("<:%s:%s>", name, id)
+	}
+	return emoji
+}
+
+// reactionsCommand handles the /reactions subcommands, which map emojis to
+// AI actions in the server. Changing them needs the Manage Server permission.
+func (b *Bot) reactionsCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Reaction actions only work in servers."))
+		return
+	}
+	subcommand := i.ApplicationCommandData().Options[0]
+	if subcommand.Name != "list" && (i.Member == nil || i.Member.Permissions&discordgo.PermissionManageServer == 0) {
+		b.respondEphemeral(i, tr(i, "You need the Manage Server permission to change reaction actions."))
+		return
+	}
+
+	switch subcommand.Name {
+	case "set":
+		emoji := reactionEmoji(commandOption(subcommand.Options, "emoji").StringValue())
+		action := commandOption(subcommand.Options, "action").StringValue()
+		if emoji == "" || strings.ContainsAny(emoji, " \n") {
+			b.respondEphemeral(i, tr(i, "Give a single emoji."))
+			return
+		}
+		if err := b.store.SetReactionAction(store.ReactionAction{GuildID: i.GuildID, Emoji: emoji, Action: action}); err != nil {
+			interactionLogger(i).Error("Error saving reaction action", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+		interactionLogger(i).Info("Set reaction action", "emoji", emoji, "action", action)
+		b.respondEphemeral(i, tr(i, "Reacting with %s now runs %s.", emojiText(emoji), action))
+	case "remove":
+		emoji := reactionEmoji(commandOption(subcommand.Options, "emoji").StringValue())
+		deleted, err := b.store.DeleteReactionAction(i.GuildID, emoji)
+		if err != nil {
+			interactionLogger(i).Error("Error removing reaction action", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+		if !deleted {
+			b.respondEphemeral(i, tr(i, "%s doesn't run any action.", emojiText(emoji)))
+			return
+		}
+		interactionLogger(i).Info("Removed reaction action", "emoji", emoji)
+		b.respondEphemeral(i, tr(i, "Reacting with %s no longer runs an action.", emojiText(emoji)))
+	case "defaults":
+		for _, action := range reactionActions {
+			err := b.store.SetReactionAction(store.ReactionAction{GuildID: i.GuildID, Emoji: action.emoji, Action: action.name})
+			if err != nil {
+				interactionLogger(i).Error("Error saving reaction action", "error", err)
+				b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+				return
+			}
+		}
+		interactionLogger(i).Info("Set default reaction actions")
+		b.listReactionActions(i)
+	case "list":
+		b.listReactionActions(i)
+	}
+}
+
+// listReactionActions lists the server's reaction actions
+func (b *Bot) listReactionActions(i *discordgo.InteractionCreate) {
+	actions, err := b.store.ReactionActions(i.GuildID)
+	if err != nil {
+		interactionLogger(i).Error("Error loading reaction actions", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if len(actions) == 0 {
+		b.respondEphemeral(i, tr(i, "No reactions run actions in this server. `/reactions defaults` sets up 📌 summarize, 🌐 translate and ❓ explain."))
+		return
+	}
+	descriptions := map[string]string{}
+	for _, action := range reactionActions {
+		descriptions[action.name] = action.description
+	}
+	var lines []string
+	for _, r := range actions {
+		lines = append(lines, fmt.Sprintf("%s **%s**: %s", emojiText(r.Emoji), r.Action, tr(i, descriptions[r.Action])))
+	}
+	b.respondEphemeral(i, strings.Join(lines, "\n"))
+}
+
+// handleReactionAdd runs the action the server maps a reaction's emoji to,
+// once per message, for members who may post in the channel
+func (b *Bot) handleReactionAdd(r *discordgo.MessageReactionAdd) {
+	if r.GuildID == "" || r.UserID == b.session.BotUserID() || (r.Member != nil && r.Member.User != nil && r.Member.User.Bot) {
+		return
+	}
+	action, err := b.store.ReactionActionFor(r.GuildID, r.Emoji.APIName())
+	if err != nil {
+		slog.Error("Error loading reaction action", "guild", r.GuildID, "error", err)
+		return
+	}
+	if action == "" {
+		return
+	}
+	logger := slog.With("guild", r.GuildID, "channel", r.ChannelID, "user", r.UserID, "message", r.MessageID, "action", action)
+
+	// Members who can't post in a channel can't make the bot post there either
+	permissions, err := b.session.UserChannelPermissions(r.UserID, r.ChannelID)
+	if err != nil {
+		logger.Error("Error checking permissions", "error", err)
+		return
+	}
+	if permissions&discordgo.PermissionSendMessages == 0 {
+		logger.Info("Ignored reaction from a member who can't post here")
+		return
+	}
+	if !b.markReacted(r.MessageID+":"+action) || b.maintenance.Load() || b.quotaExhausted(r.GuildID) {
+		return
+	}
+
+	message, err := b.session.ChannelMessage(r.ChannelID, r.MessageID)
+	if err != nil {
+		logger.Error("Error fetching message", "error", err)
+		return
+	}
+	if message.Content == "" && len(message.Attachments) == 0 {
+		return
+	}
+	// Messages from the REST API don't carry the guild ID
+	message.GuildID = r.GuildID
+
+	switch action {
+	case "summarize":
+		err = b.summarizeReaction(message, r.UserID)
+	case "translate":
+		err = b.translateReaction(message, r.UserID)
+	case "explain":
+		err = b.explainReaction(message, r.UserID)
+	}
+	if err != nil {
+		logger.Error("Error running reaction action", "error", err)
+		return
+	}
+	logger.Info("Ran reaction action")
+}
+
+// markReacted records that a message was acted on, returning false if it
+// already was
+func (b *Bot) markReacted(key string) bool {
+	b.reactedMu.Lock()
+	defer b.reactedMu.Unlock()
+
+	if b.reacted[key] {
+		return false
+	}
+	b.reacted[key] = true
+	b.reactedOrder = append(b.reactedOrder, key)
+	if len(b.reactedOrder) > maxReactedMessages {
+		delete(b.reacted, b.reactedOrder[0])
+		b.reactedOrder = b.reactedOrder[1:]
+	}
+	return true
+}
+
+// summarizeReaction posts a TL;DR of a message in its thread, or as a reply
+// where there can't be one
+func (b *Bot) summarizeReaction(message *discordgo.Message, userID string) error {
+	parts := b.uploadAttachments(userID, message.GuildID, message.Attachments)
+	prompt := fmt.Sprintf("Write a TL;DR of the following Discord message from %s (and any attached files) in one to three sentences.\n\n%s",
+		message.Author.Username, b.untrusted(userID, message.GuildID, "a message by "+message.Author.Username, message.Content))
+	summary, err := b.generate(userID, message.GuildID, append(parts, genai.Text(prompt))...)
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("📌 **TL;DR**, requested by <@%s>:\n%s", userID, summary)
+
+	threadID, err := b.messageThread(message, "TL;DR")
+	if err != nil {
+		slog.Warn("Error starting thread, replying instead", "message", message.ID, "error", err)
+		return b.replyQuietly(message, "", text)
+	}
+	return b.replyQuietly(message, threadID, text)
+}
+
+// translateReaction replies to a message with its translation into the
+// server's language
+func (b *Bot) translateReaction(message *discordgo.Message, userID string) error {
+	if message.Content == "" {
+		return nil
+	}
+	language := "English"
+	if guild, err := b.session.Guild(message.GuildID); err == nil {
+		language = localeLanguage(discordgo.Locale(guild.PreferredLocale))
+	}
+	result, err := b.detectAndTranslate(userID, message.GuildID, message.Content, language)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(result.DetectedLanguage, language) {
+		return b.replyQuietly(message, "", fmt.Sprintf("🌐 That message is already in %s.", language))
+	}
+	return b.replyQuietly(message, "", fmt.Sprintf("🌐 **%s → %s**, requested by <@%s>:\n%s", result.DetectedLanguage, language, userID, result.Translation))
+}
+
+// explainReaction replies to a message with a simple explanation of it
+func (b *Bot) explainReaction(message *discordgo.Message, userID string) error {
+	explanation, err := b.generate(userID, message.GuildID, b.explainParts(userID, message.GuildID, message)...)
+	if err != nil {
+		return err
+	}
+	return b.replyQuietly(message, "", fmt.Sprintf("❓ **Explained**, requested by <@%s>:\n%s", userID, explanation))
+}
+
+// replyQuietly sends text without pinging anyone, in a thread when threadID
+// is set and as a reply to the message otherwise
+func (b *Bot) replyQuietly(message *discordgo.Message, threadID string, text string) error {
+	channelID := threadID
+	var reference *discordgo.MessageReference
+	if channelID == "" {
+		channelID = message.ChannelID
+		reference = message.Reference()
+	}
+	for n, chunk := range splitMessage(text) {
+		send := &discordgo.MessageSend{
+			Content:         chunk,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		}
+		if n == 0 {
+			send.Reference = reference
+		}
+		if _, err := b.session.ChannelMessageSendComplex(channelID, send); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// reactionsInteraction is a /reactions subcommand sent by a server member
+func reactionsInteraction(permissions int64, subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	i := promptInteraction("alice", permissions, subcommand, options...)
+	data := i.Data.(discordgo.ApplicationCommandInteractionData)
+	data.Name = "reactions"
+	i.Data = data
+	return i
+}
+
+func TestReactionsCommand(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+	admin := int64(discordgo.PermissionManageServer)
+
+	steps := []struct {
+		interaction *discordgo.InteractionCreate
+		want        string
+	}{
+		{reactionsInteraction(0, "list"), "No reactions run actions in this server."},
+		{reactionsInteraction(0, "defaults"), "You need the Manage Server permission to change reaction actions."},
+		{reactionsInteraction(admin, "set", stringOption("emoji", "<:gopher:123>"), stringOption("action", "explain")),
+			"Reacting with <:gopher:123> now runs explain."},
+		{reactionsInteraction(admin, "set", stringOption("emoji", "two words"), stringOption("action", "explain")), "Give a single emoji."},
+		{reactionsInteraction(admin, "defaults"),
+			"<:gopher:123> **explain**: explains it in simple terms\n❓ **explain**: explains it in simple terms\n📌 **summarize**: posts a TL;DR in a thread\n🌐 **translate**: translates it into the server's language"},
+		{reactionsInteraction(admin, "remove", stringOption("emoji", "📌")), "Reacting with 📌 no longer runs an action."},
+		{reactionsInteraction(admin, "remove", stringOption("emoji", "📌")), "📌 doesn't run any action."},
+	}
+	for _, step := range steps {
+		session.responses = nil
+		b.HandleInteraction(step.interaction)
+		if len(session.responses) != 1 || !strings.HasPrefix(session.responses[0].Data.Content, step.want) {
+			t.Errorf("responded %v, want %q", session.responses, step.want)
+		}
+	}
+}
+
+func TestReactionEmoji(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"📌", "📌"},
+		{" 🌐 ", "🌐"},
+		{"<:gopher:123>", "gopher:123"},
+		{"<a:dance:456>", "dance:456"},
+	}
+	for _, test := range tests {
+		if got := reactionEmoji(test.text); got != test.want {
+			t.Errorf("reactionEmoji(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+// reaction is a reaction added by a user to "message" in "channel"
+func reaction(userID string, emoji string) *discordgo.MessageReactionAdd {
+	return &discordgo.MessageReactionAdd{MessageReaction: &discordgo.MessageReaction{
+		UserID:    userID,
+		MessageID: "message",
+		ChannelID: "channel",
+		GuildID:   "guild",
+		Emoji:     discordgo.Emoji{Name: emoji},
+	}}
+}
+
+func TestHandleReactionAdd(t *testing.T) {
+	tests := []struct {
+		name     string
+		reaction *discordgo.MessageReactionAdd
+		reply    string
+		want     []string
+	}{
+		{"unmapped", reaction("bob", "👍"), "", nil},
+		{"bot", reaction(botUserID, "📌"), "", nil},
+		{"muted", reaction("muted", "📌"), "", nil},
+		{"summarize", reaction("bob", "📌"), "Alice shipped the release.", []string{"📌 **TL;DR**, requested by <@bob>:\nAlice shipped the release."}},
+		{"explain", reaction("bob", "❓"), "Computers got a new toy.", []string{"❓ **Explained**, requested by <@bob>:\nComputers got a new toy."}},
+		{"translate", reaction("bob", "🌐"), `{"detected_language": "German", "translation": "Hello"}`, []string{"🌐 **German → English**, requested by <@bob>:\nHello"}},
+		{"already translated", reaction("bob", "🌐"), `{"detected_language": "English", "translation": "Hello"}`, []string{"🌐 That message is already in English."}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, session := newTestBot(t, &fakeAI{text: test.reply})
+			session.permissions = map[string]int64{"muted": discordgo.PermissionViewChannel}
+			session.history["channel"] = []*discordgo.Message{{
+				ID:        "message",
+				ChannelID: "channel",
+				Content:   "Hallo, wir haben das Release ausgeliefert",
+				Author:    &discordgo.User{ID: "alice", Username: "alice"},
+			}}
+			b.HandleInteraction(reactionsInteraction(discordgo.PermissionManageServer, "defaults"))
+
+			b.handleReactionAdd(test.reaction)
+			// A second reaction with the same action is ignored
+			b.handleReactionAdd(test.reaction)
+			if strings.Join(session.messages, "|") != strings.Join(test.want, "|") {
+				t.Errorf("messages = %q, want %q", session.messages, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/store"
+)
+
+const (
+	// Messages shorter than this ("ok", "lol") aren't worth indexing
+	minIndexedMessageLength = 15
+
+	// Pending messages are embedded in batches of this size, or after this delay
+	indexBatchSize  = 50
+	indexBatchDelay = 30 * time.Second
+
+	// Messages of a channel's history indexed when indexing is enabled
+	maxBackfillMessages = 1000
+
+	// Messages returned by /recall
+	recallResultCount = 5
+)
+
+// indexedMessage is a past message returned by a search
+type indexedMessage struct {
+	GuildID, ChannelID, MessageID string
+	Author, Content               string
+	CreatedAt                     time.Time
+	Score                         float64
+}
+
+// link returns the message's jump link
+func (m indexedMessage) link() string {
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", m.GuildID, m.ChannelID, m.MessageID)
+}
+
+// indexCommand handles /index enable and /index disable
+func (b *Bot) indexCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Message indexing only works in servers."))
+		return
+	}
+	if i.Member == nil || i.Member.Permissions&discordgo.PermissionManageChannels == 0 {
+		b.respondEphemeral(i, tr(i, "You need the Manage Channels permission to change indexing."))
+		return
+	}
+
+	switch i.ApplicationCommandData().Options[0].Name {
+	case "enable":
+		if err := b.store.EnableIndexing(i.ChannelID, i.GuildID); err != nil {
+			interactionLogger(i).Error("Error enabling indexing", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, I couldn't enable indexing."))
+			return
+		}
+		b.respondEphemeral(i, tr(i, "Indexing <#%s>, its recent history will be searchable with `/recall` shortly.", i.ChannelID))
+		go func() {
+			defer recoverPanic(nil)
+			b.backfillChannel(i.ChannelID, i.GuildID)
+		}()
+	case "disable":
+		if err := b.store.DisableIndexing(i.ChannelID); err != nil {
+			interactionLogger(i).Error("Error disabling indexing", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, I couldn't disable indexing."))
+			return
+		}
+		b.respondEphemeral(i, tr(i, "Stopped indexing <#%s> and removed its index.", i.ChannelID))
+	}
+}
+
+// isIndexedChannel reports whether indexing is enabled for a channel
+func (b *Bot) isIndexedChannel(channelID string) bool {
+	exists, err := b.store.IsIndexed(channelID)
+	if err != nil {
+		slog.Error("Error checking indexed channel", "channel", channelID, "error", err)
+	}
+	return exists
+}
+
+// indexMessage queues a message from an indexed channel to be embedded
+func (b *Bot) indexMessage(m *discordgo.Message) {
+	if m.Author == nil || m.Author.Bot || utf8.RuneCountInString(m.Content) < minIndexedMessageLength {
+		return
+	}
+
+	b.indexMu.Lock()
+	defer b.indexMu.Unlock()
+
+	b.indexQueue = append(b.indexQueue, m)
+	if len(b.indexQueue) >= indexBatchSize {
+		go b.flushIndexQueue()
+	} else if b.indexTimer == nil {
+		b.indexTimer = time.AfterFunc(indexBatchDelay, b.flushIndexQueue)
+	}
+}
+
+// flushIndexQueue embeds and stores every queued message
+func (b *Bot) flushIndexQueue() {
+	defer recoverPanic(nil)
+
+	b.indexMu.Lock()
+	messages := b.indexQueue
+	b.indexQueue = nil
+	if b.indexTimer != nil {
+		b.indexTimer.Stop()
+		b.indexTimer = nil
+	}
+	b.indexMu.Unlock()
+
+	if len(messages) > 0 {
+		if err := b.storeIndexedMessages(messages); err != nil {
+			slog.Error("Error indexing messages", "error", err)
+		}
+	}
+}
+
+// storeIndexedMessages embeds messages and stores them in the index
+func (b *Bot) storeIndexedMessages(messages []*discordgo.Message) error {
+	texts := make([]string, len(messages))
+	for n, m := range messages {
+		texts[n] = m.Author.Username + ": " + m.Content
+	}
+	vectors, err := b.ai.EmbedDocuments(b.ctx, texts)
+	if err != nil {
+		return err
+	}
+
+	indexed := make([]store.IndexedMessage, len(messages))
+	for n, m := range messages {
+		indexed[n] = store.IndexedMessage{
+			MessageID: m.ID,
+			GuildID:   m.GuildID,
+			ChannelID: m.ChannelID,
+			Author:    m.Author.Username,
+			AuthorID:  m.Author.ID,
+			Content:   m.Content,
+			CreatedAt: m.Timestamp,
+			Vector:    vectors[n],
+		}
+	}
+	return b.store.IndexMessages(indexed)
+}
+
+// backfillChannel indexes a channel's recent history
+func (b *Bot) backfillChannel(channelID string, guildID string) {
+	var messages []*discordgo.Message
+	before := ""
+	for len(messages) < maxBackfillMessages {
+		page, err := b.session.ChannelMessages(channelID, 100, before, "", "")
+		if err != nil {
+			slog.Error("Error reading channel history", "channel", channelID, "error", err)
+			break
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, m := range page {
+			// Messages from the REST API don't carry the guild ID
+			m.GuildID = guildID
+			if m.Author != nil && !m.Author.Bot && utf8.RuneCountInString(m.Content) >= minIndexedMessageLength {
+				messages = append(messages, m)
+			}
+		}
+		before = page[len(page)-1].ID
+	}
+
+	if err := b.storeIndexedMessages(messages); err != nil {
+		slog.Error("Error indexing channel history", "channel", channelID, "error", err)
+		return
+	}
+	slog.Info("Indexed channel history", "guild", guildID, "channel", channelID, "messages", len(messages))
+}
+
+// recallCommand handles /recall, linking the past messages most relevant to
+// a query and optionally answering it from them
+func (b *Bot) recallCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Recall only works in servers."))
+		return
+	}
+	options := i.ApplicationCommandData().Options
+	query := commandOption(options, "query").StringValue()
+	answer := false
+	if option := commandOption(options, "answer"); option != nil {
+		answer = option.BoolValue()
+	}
+
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to recall command", "error", err)
+		return
+	}
+
+	messages, err := b.searchMessages(i.GuildID, interactionUserID(i), query, recallResultCount)
+	if err != nil {
+		interactionLogger(i).Error("Error searching messages", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if len(messages) == 0 {
+		b.editInteractionResponse(i, tr(i, "I couldn't find anything, is indexing enabled with `/index enable`?"))
+		return
+	}
+
+	var sb strings.Builder
+	for _, m := range messages {
+		fmt.Fprintf(&sb, "- **%s** (%s): %s %s\n", m.Author, m.CreatedAt.Format(time.DateOnly), truncate(m.Content, 150), m.link())
+	}
+	results := sb.String()
+
+	if answer {
+		var excerpts strings.Builder
+		for _, m := range messages {
+			fmt.Fprintf(&excerpts, "[%s, %s] %s\n", m.Author, m.CreatedAt.Format(time.DateOnly), m.Content)
+		}
+		prompt := fmt.Sprintf("Using only these past Discord messages, answer the question briefly. "+
+			"If they don't answer it, say so.\n\n%s\n\nQuestion: %s",
+			b.untrusted(interactionUserID(i), i.GuildID, "past messages of the server", excerpts.String()), query)
+		text, err := b.generate(interactionUserID(i), i.GuildID, genai.Text(prompt))
+		if err != nil {
+			interactionLogger(i).Error("Gemini error", "error", err)
+		} else {
+			results = text + "\n\n" + results
+		}
+	}
+	b.editInteractionResponseLong(i, results, discordgo.MessageFlagsEphemeral)
+}
+
+// searchMessages returns the indexed messages of a guild most similar to a
+// query, leaving out channels the user can't see
+func (b *Bot) searchMessages(guildID string, userID string, query string, limit int) ([]indexedMessage, error) {
+	indexed, err := b.store.IndexedMessages(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	var stored []store.IndexedMessage
+	visible := map[string]bool{}
+	for _, m := range indexed {
+		canView, checked := visible[m.ChannelID]
+		if !checked {
+			permissions, err := b.session.UserChannelPermissions(userID, m.ChannelID)
+			canView = err == nil && permissions&discordgo.PermissionViewChannel != 0
+			visible[m.ChannelID] = canView
+		}
+		if canView {
+			stored = append(stored, m)
+		}
+	}
+	if len(stored) == 0 {
+		return nil, nil
+	}
+
+	queryVector, err := b.ai.EmbedQuery(b.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]indexedMessage, len(stored))
+	for n, m := range stored {
+		messages[n] = indexedMessage{
+			GuildID:   m.GuildID,
+			ChannelID: m.ChannelID,
+			MessageID: m.MessageID,
+			Author:    m.Author,
+			Content:   m.Content,
+			CreatedAt: m.CreatedAt,
+			Score:     cosineSimilarity(queryVector, m.Vector),
+		}
+	}
+	sort.Slice(messages, func(a, b int) bool { return messages[a].Score > messages[b].Score })
+	return messages[:min(limit, len(messages))], nil
+}
+
+// handleMessageDelete removes deleted messages from the index and deletes
+// the bot's reply to them
+func (b *Bot) handleMessageDelete(messageID string) {
+	if err := b.store.DeleteIndexedMessage(messageID); err != nil {
+		slog.Error("Error removing deleted message from index", "message", messageID, "error", err)
+	}
+	b.deleteAnswer(messageID)
+}
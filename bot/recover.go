@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Sent to the user when handling their message or command panicked
+const panicMessage = "Sorry, something went wrong while handling that."
+
+// recoverPanic recovers a panic in the calling goroutine, logging it with
+// its stack trace and calling notify, if set. It must be deferred.
+func recoverPanic(notify func()) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	slog.Error("Recovered from panic", "panic", r, "stack", string(debug.Stack()))
+
+	if notify != nil {
+		// Telling the user must not panic again
+		defer func() {
+			if r := recover(); r != nil {
+				slog.Error("Panic while reporting panic", "panic", r)
+			}
+		}()
+		notify()
+	}
+}
+
+// notifyInteractionPanic tells the user an interaction failed, as a response
+// if it wasn't acknowledged yet or as a follow-up message otherwise
+func (b *Bot) notifyInteractionPanic(i *discordgo.InteractionCreate) {
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: tr(i, panicMessage),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err == nil {
+		return
+	}
+	_, err = b.session.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: tr(i, panicMessage),
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error reporting failed interaction", "error", err)
+	}
+}
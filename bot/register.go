@@ -0,0 +1,126 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// CommandRegistrar manages application commands, as *discordgo.Session does
+type CommandRegistrar interface {
+	ApplicationCommands(appID, guildID string, options ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error)
+	ApplicationCommandCreate(appID, guildID string, cmd *discordgo.ApplicationCommand, options ...discordgo.RequestOption) (*discordgo.ApplicationCommand, error)
+	ApplicationCommandEdit(appID, guildID, cmdID string, cmd *discordgo.ApplicationCommand, options ...discordgo.RequestOption) (*discordgo.ApplicationCommand, error)
+	ApplicationCommandDelete(appID, guildID, cmdID string, options ...discordgo.RequestOption) error
+}
+
+// SyncCommands makes the commands registered for an application match
+// commands: new ones are created, changed ones edited and ones no longer
+// wanted deleted, while unchanged ones are left alone. Commands are global
+// when guildID is empty, and only in that guild otherwise, where changes
+// show up at once.
+func SyncCommands(r CommandRegistrar, appID string, guildID string, commands []*discordgo.ApplicationCommand) error {
+	existing, err := r.ApplicationCommands(appID, guildID)
+	if err != nil {
+		return fmt.Errorf("error listing commands: %v", err)
+	}
+	registered := map[string]*discordgo.ApplicationCommand{}
+	for _, command := range existing {
+		registered[commandKey(command)] = command
+	}
+
+	var created, updated, unchanged, deleted int
+	for _, command := range commands {
+		key := commandKey(command)
+		current, ok := registered[key]
+		delete(registered, key)
+		switch {
+		case !ok:
+			if _, err := r.ApplicationCommandCreate(appID, guildID, command); err != nil {
+				return fmt.Errorf("error creating command %s: %v", command.Name, err)
+			}
+			created++
+		case !sameCommand(current, command):
+			if _, err := r.ApplicationCommandEdit(appID, guildID, current.ID, command); err != nil {
+				return fmt.Errorf("error updating command %s: %v", command.Name, err)
+			}
+			updated++
+		default:
+			unchanged++
+		}
+	}
+	for _, stale := range registered {
+		if err := r.ApplicationCommandDelete(appID, guildID, stale.ID); err != nil {
+			return fmt.Errorf("error deleting command %s: %v", stale.Name, err)
+		}
+		deleted++
+	}
+
+	slog.Info("Synced commands", "guild", guildID, "created", created, "updated", updated, "unchanged", unchanged, "deleted", deleted)
+	return nil
+}
+
+// commandKey identifies a command: a slash command and a context-menu
+// command may share a name
+func commandKey(command *discordgo.ApplicationCommand) string {
+	return fmt.Sprintf("%d:%s", commandType(command), command.Name)
+}
+
+// commandType returns a command's type, which defaults to a slash command
+func commandType(command *discordgo.ApplicationCommand) discordgo.ApplicationCommandType {
+	if command.Type == 0 {
+		return discordgo.ChatApplicationCommand
+	}
+	return command.Type
+}
+
+// commandDefinition is the part of a command its registration sets, which
+// Discord returns along with IDs and versions
+type commandDefinition struct {
+	Type                     discordgo.ApplicationCommandType      `json:"type"`
+	NameLocalizations        map[discordgo.Locale]string           `json:"name_localizations,omitempty"`
+	Description              string                                `json:"description"`
+	DescriptionLocalizations map[discordgo.Locale]string           `json:"description_localizations,omitempty"`
+	Options                  []*discordgo.ApplicationCommandOption `json:"options"`
+	DefaultMemberPermissions *int64                                `json:"default_member_permissions"`
+	DMPermission             *bool                                 `json:"dm_permission"`
+	NSFW                     *bool                                 `json:"nsfw"`
+}
+
+// localizationsOf returns a command's localizations, with nil and empty
+// ones the same
+func localizationsOf(localizations *map[discordgo.Locale]string) map[discordgo.Locale]string {
+	if localizations == nil {
+		return nil
+	}
+	return *localizations
+}
+
+// sameCommand reports whether a registered command already matches the
+// wanted one
+func sameCommand(registered *discordgo.ApplicationCommand, wanted *discordgo.ApplicationCommand) bool {
+	definition := func(command *discordgo.ApplicationCommand) string {
+		data, _ := json.Marshal(commandDefinition{
+			Type:                     commandType(command),
+			NameLocalizations:        localizationsOf(command.NameLocalizations),
+			Description:              command.Description,
+			DescriptionLocalizations: localizationsOf(command.DescriptionLocalizations),
+			Options:                  command.Options,
+			DefaultMemberPermissions: command.DefaultMemberPermissions,
+			DMPermission:             command.DMPermission,
+			NSFW:                     command.NSFW,
+		})
+		return string(data)
+	}
+	// Discord fills in defaults the wanted command leaves unset
+	current := *registered
+	if wanted.DMPermission == nil && current.DMPermission != nil && *current.DMPermission {
+		current.DMPermission = nil
+	}
+	if wanted.NSFW == nil && current.NSFW != nil && !*current.NSFW {
+		current.NSFW = nil
+	}
+	return definition(&current) == definition(wanted)
+}
@@ -0,0 +1,110 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeRegistrar holds registered commands by ID and records the changes made
+type fakeRegistrar struct {
+	commands map[string]*discordgo.ApplicationCommand
+	guildID  string
+	changes  []string
+	nextID   int
+}
+
+func (r *fakeRegistrar) ApplicationCommands(_, guildID string, _ ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error) {
+	r.guildID = guildID
+	var commands []*discordgo.ApplicationCommand
+	for _, command := range r.commands {
+		commands = append(commands, command)
+	}
+	return commands, nil
+}
+
+func (r *fakeRegistrar) ApplicationCommandCreate(_, _ string, cmd *discordgo.ApplicationCommand, _ ...discordgo.RequestOption) (*discordgo.ApplicationCommand, error) {
+	r.nextID++
+	registered := *cmd
+	registered.ID = fmt.Sprintf("new-%d", r.nextID)
+	r.commands[registered.ID] = &registered
+	r.changes = append(r.changes, "create "+cmd.Name)
+	return &registered, nil
+}
+
+func (r *fakeRegistrar) ApplicationCommandEdit(_, _, cmdID string, cmd *discordgo.ApplicationCommand, _ ...discordgo.RequestOption) (*discordgo.ApplicationCommand, error) {
+	if _, ok := r.commands[cmdID]; !ok {
+		return nil, errors.New("unknown command")
+	}
+	registered := *cmd
+	registered.ID = cmdID
+	r.commands[cmdID] = &registered
+	r.changes = append(r.changes, "edit "+cmd.Name)
+	return &registered, nil
+}
+
+func (r *fakeRegistrar) ApplicationCommandDelete(_, _, cmdID string, _ ...discordgo.RequestOption) error {
+	r.changes = append(r.changes, "delete "+r.commands[cmdID].Name)
+	delete(r.commands, cmdID)
+	return nil
+}
+
+func TestSyncCommands(t *testing.T) {
+	allowDMs := true
+	r := &fakeRegistrar{commands: map[string]*discordgo.ApplicationCommand{
+		// As Discord returns them, with defaults filled in
+		"1": {ID: "1", Type: discordgo.ChatApplicationCommand, Name: "clear", Description: "Clear the chat history", DMPermission: &allowDMs, Version: "7"},
+		"2": {ID: "2", Type: discordgo.ChatApplicationCommand, Name: "translate", Description: "Old description"},
+		"3": {ID: "3", Type: discordgo.ChatApplicationCommand, Name: "removed", Description: "No longer wanted"},
+		"4": {ID: "4", Type: discordgo.MessageApplicationCommand, Name: "Explain"},
+	}}
+	wanted := []*discordgo.ApplicationCommand{
+		{Name: "clear", Description: "Clear the chat history"},
+		{Name: "translate", Description: "Translate text"},
+		{Name: "Explain", Type: discordgo.MessageApplicationCommand},
+		// A slash command may share a context-menu command's name
+		{Name: "Explain", Description: "Explain something"},
+	}
+
+	if err := SyncCommands(r, "app", "dev-guild", wanted); err != nil {
+		t.Fatalf("SyncCommands: %v", err)
+	}
+	sort.Strings(r.changes)
+	if want := []string{"create Explain", "delete removed", "edit translate"}; !reflect.DeepEqual(r.changes, want) {
+		t.Errorf("changes = %q, want %q", r.changes, want)
+	}
+	if r.guildID != "dev-guild" {
+		t.Errorf("synced guild %q, want dev-guild", r.guildID)
+	}
+
+	// Nothing changes the second time
+	r.changes = nil
+	if err := SyncCommands(r, "app", "dev-guild", wanted); err != nil {
+		t.Fatalf("SyncCommands again: %v", err)
+	}
+	if len(r.changes) != 0 {
+		t.Errorf("changes when in sync = %q, want none", r.changes)
+	}
+
+	// Nor when Discord returns empty localizations for ones without any
+	r.commands["1"].NameLocalizations = &map[discordgo.Locale]string{}
+	if err := SyncCommands(r, "app", "dev-guild", wanted); err != nil {
+		t.Fatalf("SyncCommands with empty localizations: %v", err)
+	}
+	if len(r.changes) != 0 {
+		t.Errorf("changes with empty localizations = %q, want none", r.changes)
+	}
+
+	// New translations update the command
+	wanted[0].DescriptionLocalizations = &map[discordgo.Locale]string{discordgo.German: "Den Chatverlauf löschen"}
+	if err := SyncCommands(r, "app", "dev-guild", wanted); err != nil {
+		t.Fatalf("SyncCommands with translations: %v", err)
+	}
+	if want := []string{"edit clear"}; !reflect.DeepEqual(r.changes, want) {
+		t.Errorf("changes with translations = %q, want %q", r.changes, want)
+	}
+}
@@ -0,0 +1,159 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/store"
+)
+
+const (
+	// Pending reminders each user may have
+	maxReminders = 25
+
+	// Furthest ahead a reminder may be set
+	maxReminderDelay = 365 * 24 * time.Hour
+
+	// How long an undeliverable reminder is retried before it is dropped
+	reminderRetryWindow = 24 * time.Hour
+)
+
+// remindMeCommand handles /remindme, having Gemini work out when the
+// natural-language time is and saving a reminder for then
+func (b *Bot) remindMeCommand(i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	when := commandOption(options, "in").StringValue()
+	text := commandOption(options, "about").StringValue()
+	dm := i.GuildID == ""
+	if option := commandOption(options, "dm"); option != nil && option.BoolValue() {
+		dm = true
+	}
+
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to remindme command", "error", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	due, err := b.parseReminderTime(i, when, now)
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	switch {
+	case due.IsZero():
+		b.editInteractionResponse(i, tr(i, "I couldn't tell when `%s` is. Try something like `in 2 hours` or `tomorrow at 9:00 UTC`.", when))
+		return
+	case !due.After(now):
+		b.editInteractionResponse(i, tr(i, "<t:%d:F> has already passed.", due.Unix()))
+		return
+	case due.Sub(now) > maxReminderDelay:
+		b.editInteractionResponse(i, tr(i, "Reminders can be set at most a year ahead."))
+		return
+	}
+
+	user := interactionUser(i)
+	reminder := store.Reminder{UserID: user.ID, GuildID: i.GuildID, ChannelID: i.ChannelID, Text: text, DueAt: due, CreatedAt: now}
+	if dm {
+		channel, err := b.session.UserChannelCreate(user.ID)
+		if err != nil {
+			interactionLogger(i).Warn("Error opening DM channel", "error", err)
+			b.editInteractionResponse(i, tr(i, "I couldn't open a DM with you. Allow direct messages from server members and try again."))
+			return
+		}
+		reminder.ChannelID = channel.ID
+	}
+
+	_, err = b.store.AddReminder(reminder, maxReminders)
+	if errors.Is(err, store.ErrRemindersFull) {
+		b.editInteractionResponse(i, tr(i, "You already have %d pending reminders.", maxReminders))
+		return
+	}
+	if err != nil {
+		interactionLogger(i).Error("Error saving reminder", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	interactionLogger(i).Info("Set reminder", "due", due)
+	if dm {
+		b.editInteractionResponse(i, tr(i, "I'll remind you in a DM on <t:%d:F> (<t:%d:R>).", due.Unix(), due.Unix()))
+		return
+	}
+	b.editInteractionResponse(i, tr(i, "I'll remind you here on <t:%d:F> (<t:%d:R>).", due.Unix(), due.Unix()))
+}
+
+// parseReminderTime asks Gemini when a natural-language time such as "in
+// two hours" or "next Friday at noon" is, relative to now. It returns the
+// zero time when the text isn't a time.
+func (b *Bot) parseReminderTime(i *discordgo.InteractionCreate, when string, now time.Time) (time.Time, error) {
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"time": {
+				Type:        genai.TypeString,
+				Description: "The time as an RFC 3339 timestamp in UTC, like 2024-05-01T09:00:00Z, or an empty string if the text isn't a time",
+			},
+		},
+		Required: []string{"time"},
+	}
+	prompt := fmt.Sprintf("It is now %s (%s, UTC). When is the following time a user gave for a reminder? "+
+		"Times without a time zone are in UTC.\n\n%s", now.Format(time.RFC3339), now.Weekday(), when)
+	text, err := b.generateJSON(interactionUserID(i), i.GuildID, schema, genai.Text(prompt))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var result struct {
+		Time string `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
+		return time.Time{}, fmt.Errorf("error parsing reminder time: %v", err)
+	}
+	if result.Time == "" {
+		return time.Time{}, nil
+	}
+	due, err := time.Parse(time.RFC3339, result.Time)
+	if err != nil {
+		// The model answered something other than a timestamp
+		return time.Time{}, nil
+	}
+	return due.UTC(), nil
+}
+
+// sendDueReminders sends the reminders due at now. A reminder that can't be
+// sent is retried on the next tick, and dropped once it is a day late.
+func (b *Bot) sendDueReminders(now time.Time) {
+	reminders, err := b.store.DueReminders(now)
+	if err != nil {
+		slog.Error("Error loading reminders", "error", err)
+		return
+	}
+	for _, r := range reminders {
+		logger := slog.With("reminder", r.ID, "user", r.UserID, "guild", r.GuildID)
+		_, err := b.session.ChannelMessageSendComplex(r.ChannelID, &discordgo.MessageSend{
+			// Cut to fit in a message, or sending would fail on every tick
+			Content: truncate(fmt.Sprintf("⏰ <@%s> you asked me <t:%d:R> to remind you: %s", r.UserID, r.CreatedAt.Unix(), r.Text), 2000),
+			// Only ping the user, whatever the reminder says
+			AllowedMentions: &discordgo.MessageAllowedMentions{Users: []string{r.UserID}},
+		})
+		if err != nil && now.Sub(r.DueAt) < reminderRetryWindow {
+			logger.Warn("Error sending reminder, retrying", "error", err)
+			continue
+		}
+		if err != nil {
+			logger.Error("Dropped reminder that couldn't be sent", "error", err)
+		} else {
+			logger.Info("Sent reminder")
+		}
+		if err := b.store.DeleteReminder(r.ID); err != nil {
+			logger.Error("Error deleting reminder", "error", err)
+		}
+	}
+}
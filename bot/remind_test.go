@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/store"
+)
+
+// remindInteraction is a /remindme command sent by "user" in the test guild
+func remindInteraction(when string, about string, dm bool) *discordgo.InteractionCreate {
+	i := commandInteraction("remindme")
+	i.ChannelID = "channel"
+	i.Data = discordgo.ApplicationCommandInteractionData{
+		Name: "remindme",
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{
+			stringOption("in", when),
+			stringOption("about", about),
+			{Name: "dm", Type: discordgo.ApplicationCommandOptionBoolean, Value: dm},
+		},
+	}
+	return i
+}
+
+func TestRemindMeCommand(t *testing.T) {
+	client := &fakeAI{}
+	b, session := newTestBot(t, client)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	later := now.Add(2 * time.Hour)
+	tests := []struct {
+		when  string
+		reply string
+		dm    bool
+		want  string
+	}{
+		{"2 hours", later.Format(time.RFC3339), false, fmt.Sprintf("I'll remind you here on <t:%d:F>", later.Unix())},
+		{"in 2h", later.Format(time.RFC3339), true, fmt.Sprintf("I'll remind you in a DM on <t:%d:F>", later.Unix())},
+		{"whenever", "", false, "I couldn't tell when `whenever` is."},
+		{"soonish", "not a time", false, "I couldn't tell when `soonish` is."},
+		{"yesterday", now.Add(-24 * time.Hour).Format(time.RFC3339), false, "has already passed."},
+		{"in 2 years", now.AddDate(2, 0, 0).Format(time.RFC3339), false, "Reminders can be set at most a year ahead."},
+	}
+	for _, test := range tests {
+		client.text = fmt.Sprintf(`{"time": %q}`, test.reply)
+		session.edits = nil
+		b.HandleInteraction(remindInteraction(test.when, "stretch", test.dm))
+		if len(session.edits) != 1 || !strings.Contains(*session.edits[0].Content, test.want) {
+			t.Errorf("/remindme in:%q edited %v, want %q", test.when, session.edits, test.want)
+		}
+	}
+
+	reminders, err := b.store.UserReminders("user")
+	if err != nil || len(reminders) != 2 || reminders[0].ChannelID != "channel" || reminders[1].ChannelID != "dm-user" {
+		t.Fatalf("UserReminders = %+v, %v, want one here and one in a DM", reminders, err)
+	}
+
+	// Nothing is due yet, then both are sent and deleted
+	b.sendDueReminders(now)
+	if len(session.messages) != 0 {
+		t.Errorf("messages before the reminders are due = %q", session.messages)
+	}
+	b.sendDueReminders(later)
+	want := fmt.Sprintf("⏰ <@user> you asked me <t:%d:R> to remind you: stretch", reminders[0].CreatedAt.Unix())
+	if len(session.messages) != 2 || session.messages[0] != want {
+		t.Errorf("messages = %q, want two %q", session.messages, want)
+	}
+	if reminders, err := b.store.UserReminders("user"); err != nil || len(reminders) != 0 {
+		t.Errorf("UserReminders after sending = %+v, %v", reminders, err)
+	}
+}
+
+func TestLongReminderFitsInAMessage(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+	now := time.Now().UTC()
+	reminder := store.Reminder{UserID: "user", GuildID: "guild", ChannelID: "channel", Text: strings.Repeat("a", 2500), DueAt: now, CreatedAt: now}
+	if _, err := b.store.AddReminder(reminder, maxReminders); err != nil {
+		t.Fatal(err)
+	}
+
+	b.sendDueReminders(now.Add(time.Minute))
+	if len(session.messages) != 1 || len([]rune(session.messages[0])) != 2000 {
+		t.Errorf("messages = %q, want the reminder cut to 2000 characters", session.messages)
+	}
+}
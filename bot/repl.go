@@ -0,0 +1,307 @@
+package bot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/store"
+)
+
+const (
+	// IDs of the REPL's user, its DM channel with the bot and the bot
+	replUserID    = "repl-user"
+	replChannelID = "repl"
+	replBotID     = "repl-bot"
+
+	// Conversation profile /persona sets in the REPL
+	replPersonaProfile = "repl-persona"
+)
+
+// errNoDiscord is returned by REPL session calls that need Discord
+var errNoDiscord = errors.New("not available without Discord")
+
+// replSession is a Session for running the bot locally, writing what it
+// sends to out instead of Discord. There are no servers, so messages are
+// handled as DMs, and calls that need Discord, such as interaction
+// responses and threads, fail.
+type replSession struct {
+	mu       sync.Mutex
+	out      io.Writer
+	messages int
+}
+
+// NewREPLSession returns a session for running the bot without Discord,
+// writing the messages it sends to out
+func NewREPLSession(out io.Writer) Session {
+	return &replSession{out: out}
+}
+
+// print writes a message the bot sent, numbering it so answers split over
+// several messages can be told apart, and returns it
+func (s *replSession) print(channelID string, content string, extra ...string) *discordgo.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages++
+	id := fmt.Sprintf("repl-message-%d", s.messages)
+	fmt.Fprintf(s.out, "\n[bot #%d, %d characters]\n%s\n", s.messages, len([]rune(content)), content)
+	for _, line := range extra {
+		fmt.Fprintln(s.out, line)
+	}
+	return &discordgo.Message{ID: id, ChannelID: channelID, Content: content, Author: &discordgo.User{ID: replBotID, Bot: true}}
+}
+
+func (s *replSession) BotUserID() string {
+	return replBotID
+}
+
+func (s *replSession) VoiceState(guildID, userID string) (*discordgo.VoiceState, error) {
+	return nil, errNoDiscord
+}
+
+func (s *replSession) Channel(channelID string, _ ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	return &discordgo.Channel{ID: channelID, Type: discordgo.ChannelTypeDM}, nil
+}
+
+func (s *replSession) ChannelTyping(string, ...discordgo.RequestOption) error {
+	return nil
+}
+
+func (s *replSession) ChannelMessage(string, string, ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return nil, errNoDiscord
+}
+
+func (s *replSession) ChannelMessages(string, int, string, string, string, ...discordgo.RequestOption) ([]*discordgo.Message, error) {
+	return nil, nil
+}
+
+func (s *replSession) ChannelMessageSend(channelID string, content string, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return s.print(channelID, content), nil
+}
+
+func (s *replSession) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	var extra []string
+	for _, embed := range data.Embeds {
+		extra = append(extra, replEmbed(embed))
+	}
+	for _, file := range data.Files {
+		extra = append(extra, fmt.Sprintf("[attached %s]", file.Name))
+	}
+	return s.print(channelID, data.Content, extra...), nil
+}
+
+func (s *replSession) ChannelMessageEditComplex(edit *discordgo.MessageEdit, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	var content string
+	if edit.Content != nil {
+		content = *edit.Content
+	}
+	var extra []string
+	if edit.Embeds != nil {
+		for _, embed := range *edit.Embeds {
+			extra = append(extra, replEmbed(embed))
+		}
+	}
+	message := s.print(edit.Channel, content, extra...)
+	message.ID = edit.ID
+	return message, nil
+}
+
+func (s *replSession) ChannelMessageDelete(channelID, messageID string, _ ...discordgo.RequestOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.out, "[deleted %s]\n", messageID)
+	return nil
+}
+
+func (s *replSession) ChannelMessagePin(_, messageID string, _ ...discordgo.RequestOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.out, "[pinned %s]\n", messageID)
+	return nil
+}
+
+func (s *replSession) MessageReactionAdd(_, messageID, emojiID string, _ ...discordgo.RequestOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.out, "[reacted %s to %s]\n", emojiID, messageID)
+	return nil
+}
+
+func (s *replSession) ChannelFileSend(channelID, name string, r io.Reader, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.print(channelID, "", fmt.Sprintf("[attached %s, %d bytes]", name, len(data))), nil
+}
+
+func (s *replSession) MessageThreadStartComplex(string, string, *discordgo.ThreadStart, ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	return nil, errNoDiscord
+}
+
+func (s *replSession) ChannelEdit(channelID string, data *discordgo.ChannelEdit, _ ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.out, "[renamed %q, topic %q]\n", data.Name, data.Topic)
+	return &discordgo.Channel{ID: channelID, Name: data.Name, Topic: data.Topic}, nil
+}
+
+func (s *replSession) UserChannelPermissions(string, string, ...discordgo.RequestOption) (int64, error) {
+	return discordgo.PermissionAll, nil
+}
+
+func (s *replSession) ChannelVoiceJoin(string, string, bool, bool) (*discordgo.VoiceConnection, error) {
+	return nil, errNoDiscord
+}
+
+func (s *replSession) UserChannelCreate(string, ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	return &discordgo.Channel{ID: replChannelID, Type: discordgo.ChannelTypeDM}, nil
+}
+
+func (s *replSession) ChannelPollSend(channelID string, poll *Poll) (*discordgo.Message, error) {
+	extra := []string{"[poll] " + poll.Question.Text}
+	for _, answer := range poll.Answers {
+		extra = append(extra, "  - "+answer.PollMedia.Text)
+	}
+	return s.print(channelID, "", extra...), nil
+}
+
+func (s *replSession) UpdateStatusComplex(discordgo.UpdateStatusData) error {
+	return nil
+}
+
+func (s *replSession) Guilds() []*discordgo.Guild {
+	return nil
+}
+
+func (s *replSession) Guild(string, ...discordgo.RequestOption) (*discordgo.Guild, error) {
+	return nil, errNoDiscord
+}
+
+func (s *replSession) GuildLeave(string, ...discordgo.RequestOption) error {
+	return errNoDiscord
+}
+
+func (s *replSession) GuildScheduledEvent(string, string, bool, ...discordgo.RequestOption) (*discordgo.GuildScheduledEvent, error) {
+	return nil, errNoDiscord
+}
+
+func (s *replSession) GuildScheduledEventCreate(string, *discordgo.GuildScheduledEventParams, ...discordgo.RequestOption) (*discordgo.GuildScheduledEvent, error) {
+	return nil, errNoDiscord
+}
+
+func (s *replSession) InteractionRespond(*discordgo.Interaction, *discordgo.InteractionResponse, ...discordgo.RequestOption) error {
+	return errNoDiscord
+}
+
+func (s *replSession) InteractionResponseEdit(*discordgo.Interaction, *discordgo.WebhookEdit, ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return nil, errNoDiscord
+}
+
+func (s *replSession) FollowupMessageCreate(*discordgo.Interaction, bool, *discordgo.WebhookParams, ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return nil, errNoDiscord
+}
+
+// replEmbed renders an embed as text
+func replEmbed(embed *discordgo.MessageEmbed) string {
+	lines := []string{"[embed] " + embed.Title}
+	if embed.Description != "" {
+		lines = append(lines, embed.Description)
+	}
+	for _, field := range embed.Fields {
+		lines = append(lines, field.Name+": "+field.Value)
+	}
+	if embed.Footer != nil {
+		lines = append(lines, "("+embed.Footer.Text+")")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// replHelp describes the REPL's commands
+const replHelp = `Type a message to send it to the bot, ending a line with \ to continue it on the next.
+  /persona <text>  answer with a persona, or without one when empty
+  /clear           start the conversation over
+  /history         show the conversation so far
+  /quit            exit`
+
+// RunREPL chats with the bot on in and out without Discord, handling each
+// line of in like a DM from a local user, until in ends or /quit. It runs
+// the same pipeline as Discord messages: sessions, personas, tools and
+// splitting long answers.
+func (b *Bot) RunREPL(in io.Reader, out io.Writer) error {
+	fmt.Fprintln(out, replHelp)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var lines []string
+	messages := 0
+	for {
+		if len(lines) == 0 {
+			fmt.Fprint(out, "\n> ")
+		}
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+		line := scanner.Text()
+		if continued, ok := strings.CutSuffix(line, `\`); ok {
+			lines = append(lines, continued)
+			continue
+		}
+		content := strings.TrimSpace(strings.Join(append(lines, line), "\n"))
+		lines = nil
+
+		command, argument, _ := strings.Cut(content, " ")
+		switch command {
+		case "":
+			continue
+		case "/quit":
+			return nil
+		case "/help":
+			fmt.Fprintln(out, replHelp)
+			continue
+		case "/clear":
+			b.resetChat(replChannelID, "")
+			fmt.Fprintln(out, "Started a new conversation.")
+			continue
+		case "/history":
+			for _, entry := range b.chatFor(replChannelID, "").History() {
+				fmt.Fprintf(out, "[%s] %s\n", entry.Role, partsText(entry.Parts))
+			}
+			continue
+		case "/persona":
+			if err := b.setREPLPersona(strings.TrimSpace(argument)); err != nil {
+				fmt.Fprintln(out, "Error setting the persona:", err)
+			}
+			continue
+		}
+
+		messages++
+		b.HandleMessage(&discordgo.MessageCreate{Message: &discordgo.Message{
+			ID:        fmt.Sprintf("repl-prompt-%d", messages),
+			ChannelID: replChannelID,
+			Content:   content,
+			Author:    &discordgo.User{ID: replUserID, Username: "you"},
+			Timestamp: time.Now(),
+		}})
+	}
+}
+
+// setREPLPersona makes the REPL answer with a persona, in a conversation of
+// its own, or in the default conversation when persona is empty
+func (b *Bot) setREPLPersona(persona string) error {
+	if persona == "" {
+		return b.store.SetActiveChatProfile(replChannelID, "")
+	}
+	err := b.store.SaveChatProfile(store.ChatProfile{ChannelID: replChannelID, Name: replPersonaProfile, Persona: persona}, maxChatProfiles)
+	if err != nil {
+		return err
+	}
+	return b.store.SetActiveChatProfile(replChannelID, replPersonaProfile)
+}
@@ -0,0 +1,32 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"go-discord-bot/ai"
+)
+
+func TestRunREPL(t *testing.T) {
+	b, _ := newTestBot(t, &fakeAI{replies: []*ai.Reply{{Text: "Hi there"}}})
+	var out strings.Builder
+	b.session = NewREPLSession(&out)
+
+	input := "hello \\\nworld\n/persona a pirate\nahoy\n/history\n/quit\nnever sent\n"
+	if err := b.RunREPL(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("RunREPL: %v", err)
+	}
+
+	// Messages are answered like DMs, the second one with the persona in its
+	// own conversation
+	got := out.String()
+	if strings.Count(got, "[bot #") != 2 || !strings.Contains(got, "[bot #1, 8 characters]\nHi there") {
+		t.Errorf("output %q, want two answers", got)
+	}
+	if !strings.Contains(got, `act as follows: a pirate`) || strings.Contains(got, "hello") {
+		t.Errorf("output %q, want the history of the persona's conversation", got)
+	}
+	if history := b.chatFor(replChannelID, "").History(); len(history) != 2 || !strings.Contains(partsText(history[0].Parts), "ahoy") {
+		t.Errorf("history has %d entries, want the persona's conversation", len(history))
+	}
+}
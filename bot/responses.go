@@ -0,0 +1,187 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/latex"
+)
+
+const (
+	// Longest description an embed may have
+	embedDescriptionLimit = 4096
+
+	// Color of the stripe along answers sent as embeds
+	embedColor = 0x4285f4
+
+	// Marks both ends of text hidden until clicked
+	spoilerTag = "||"
+)
+
+// sendResponse sends an AI answer to a channel and returns the IDs of the
+// messages sent. See updateResponse for how it is rendered.
+func (b *Bot) sendResponse(channelID string, text string, footer string, spoiler bool, variant string, followUps []string) []string {
+	return b.updateResponse(channelID, nil, text, footer, spoiler, variant, followUps)
+}
+
+// updateResponse replaces an answer sent earlier as the messages replyIDs
+// with text, editing them in place, sending more messages if it got longer
+// and deleting the extra ones if it got shorter. It returns the IDs of the
+// messages now carrying the answer.
+//
+// With EMBED_RESPONSES the answer is sent as embeds, the last one showing
+// footer. A 🔊 button is added to the last message when TTS_BUTTON is
+// enabled, and answers longer than MAX_RESPONSE_CHUNKS messages are attached
+// as a file instead. With RENDER_DIAGRAMS, images of the Mermaid and Graphviz
+// diagrams in the answer are attached to the last message too, and with
+// MATH_UNICODE its LaTeX math is written with Unicode symbols. With spoiler,
+// every message and the files are hidden behind spoiler tags. With
+// FEEDBACK_BUTTONS, and for answers a variant of a persona test wrote, 👍/👎
+// buttons are added to vote on the answer. The suggested followUps questions
+// get a button each, under the others. Answers ping no one.
+func (b *Bot) updateResponse(channelID string, replyIDs []string, text string, footer string, spoiler bool, variant string, followUps []string) []string {
+	cfg := b.config()
+	if cfg.MathUnicode {
+		text = latex.Convert(text)
+	}
+	size := 2000
+	if cfg.EmbedResponses {
+		size = embedDescriptionLimit
+	}
+	if spoiler {
+		size -= 2 * len(spoilerTag)
+	}
+	chunks := splitText(text, size)
+	var files []*discordgo.File
+	if limit := cfg.MaxResponseChunks; limit > 0 && len(chunks) > limit {
+		chunks = []string{responsePreview(text)}
+		name := "response.md"
+		if spoiler {
+			// Discord blurs attachments named like this
+			name = "SPOILER_" + name
+		}
+		files = []*discordgo.File{{Name: name, ContentType: "text/markdown", Reader: strings.NewReader(text)}}
+	}
+	files = append(files, b.diagramFiles(text, spoiler)...)
+	if spoiler {
+		for n, chunk := range chunks {
+			chunks[n] = spoilerTag + chunk + spoilerTag
+		}
+	}
+
+	var sent []string
+	for n, chunk := range chunks {
+		last := n == len(chunks)-1
+
+		// Only the last chunk carries the files, the buttons and the footer
+		components := []discordgo.MessageComponent{}
+		if last {
+			components = append(responseButtons(cfg.TTSButton, cfg.FeedbackButtons || variant != "", variant), followUpButtons(followUps)...)
+		}
+		var chunkFiles []*discordgo.File
+		if last {
+			chunkFiles = files
+		}
+		content := chunk
+		embeds := []*discordgo.MessageEmbed{}
+		if cfg.EmbedResponses {
+			content = ""
+			embed := &discordgo.MessageEmbed{Description: chunk, Color: embedColor}
+			if last && footer != "" {
+				embed.Footer = &discordgo.MessageEmbedFooter{Text: footer}
+			}
+			embeds = append(embeds, embed)
+		}
+
+		var message *discordgo.Message
+		var err error
+		if n < len(replyIDs) {
+			// Replace any file or embed of the previous answer
+			edit := discordgo.NewMessageEdit(channelID, replyIDs[n]).SetContent(content)
+			edit.Components = &components
+			edit.Embeds = &embeds
+			edit.Files = chunkFiles
+			edit.Attachments = &[]*discordgo.MessageAttachment{}
+			edit.AllowedMentions = &discordgo.MessageAllowedMentions{}
+			message, err = b.session.ChannelMessageEditComplex(edit)
+		} else {
+			message, err = b.session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+				Content:         content,
+				Embeds:          embeds,
+				Components:      components,
+				Files:           chunkFiles,
+				AllowedMentions: &discordgo.MessageAllowedMentions{},
+			})
+		}
+		if err != nil {
+			slog.Error("Error sending response", "channel", channelID, "error", err)
+			continue
+		}
+		sent = append(sent, message.ID)
+		if cfg.TTSButton && last {
+			b.rememberSpokenResponse(message.ID, text)
+		}
+	}
+
+	for _, messageID := range replyIDs[min(len(chunks), len(replyIDs)):] {
+		if err := b.session.ChannelMessageDelete(channelID, messageID); err != nil {
+			slog.Error("Error deleting response", "channel", channelID, "message", messageID, "error", err)
+		}
+	}
+	return sent
+}
+
+// responseButtons returns the buttons of an answer: 🔊 with tts, and 👍/👎
+// with feedback, for the variant of the persona test that wrote it if any
+func responseButtons(tts bool, feedback bool, variant string) []discordgo.MessageComponent {
+	var buttons []discordgo.MessageComponent
+	if tts {
+		buttons = append(buttons, speakButton())
+	}
+	if feedback {
+		buttons = append(buttons, feedbackButtons(variant)...)
+	}
+	if len(buttons) == 0 {
+		return []discordgo.MessageComponent{}
+	}
+	return []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}}
+}
+
+// responseText returns the text to send for a reply in a server, or what
+// to say in its language when the reply is empty
+func (b *Bot) responseText(guildID string, reply *ai.Reply) string {
+	if reply.Text == "" {
+		return b.trGuild(guildID, "I couldn't generate a response.")
+	}
+	return reply.Text
+}
+
+// responseFooter describes the model, latency and token usage of a reply,
+// for the footer of embed responses
+func responseFooter(reply *ai.Reply, latency time.Duration) string {
+	var details []string
+	if reply.Model != "" {
+		details = append(details, reply.Model)
+	}
+	details = append(details,
+		fmt.Sprintf("%.1fs", latency.Seconds()),
+		fmt.Sprintf("%d prompt + %d response tokens", reply.PromptTokens, reply.ResponseTokens))
+	return strings.Join(details, " · ")
+}
+
+// responsePreview is the message sent with an answer attached as a file: its
+// first paragraph, shortened, and a note pointing at the file
+func responsePreview(text string) string {
+	preview, _, _ := strings.Cut(text, "\n\n")
+	preview = truncate(preview, 300)
+	// Close a code block the cut left open
+	if strings.Count(preview, "```")%2 == 1 {
+		preview += "\n```"
+	}
+	return preview + "\n\n📎 *The full answer is attached as `response.md`.*"
+}
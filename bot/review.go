@@ -0,0 +1,357 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// Largest diff /review accepts, in bytes
+	maxReviewBytes = 200_000
+
+	// Most files whose findings /review posts, one embed each
+	maxReviewFiles = 20
+)
+
+// Kinds of review findings, most serious first, with how they're shown
+var reviewCategories = []struct {
+	name  string
+	label string
+	color int
+}{
+	{"security", "🔒 **Security**", 0xed4245},
+	{"bug", "🐞 **Bug**", 0xfaa61a},
+	{"style", "🎨 **Style**", embedColor},
+}
+
+// codeReview is the model's review of a diff
+type codeReview struct {
+	Summary string       `json:"summary"`
+	Files   []reviewFile `json:"files"`
+}
+
+// reviewFile holds the findings about one file of a diff
+type reviewFile struct {
+	Path     string          `json:"path"`
+	Findings []reviewFinding `json:"findings"`
+}
+
+// reviewFinding is a problem found in a diff
+type reviewFinding struct {
+	Category string `json:"category"`
+	// Line in the new version of the file, 0 when it applies to the whole file
+	Line    int    `json:"line"`
+	Comment string `json:"comment"`
+}
+
+// Custom ID of the form a diff is pasted in
+const reviewModalID = "review-modal"
+
+// reviewCommand handles /review, reviewing an attached diff, or opening a
+// form to paste one in as slash command options can't hold newlines
+func (b *Bot) reviewCommand(i *discordgo.InteractionCreate) {
+	option := commandOption(i.ApplicationCommandData().Options, "file")
+	if option == nil {
+		err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseModal,
+			Data: &discordgo.InteractionResponseData{
+				CustomID: reviewModalID,
+				Title:    "Code review",
+				Components: []discordgo.MessageComponent{
+					discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    "diff",
+							Label:       "Diff",
+							Placeholder: "Output of git diff",
+							Style:       discordgo.TextInputParagraph,
+							Required:    true,
+							MaxLength:   4000,
+						},
+					}},
+				},
+			},
+		})
+		if err != nil {
+			interactionLogger(i).Error("Error opening review modal", "error", err)
+		}
+		return
+	}
+
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to review command", "error", err)
+		return
+	}
+	attachment := i.ApplicationCommandData().Resolved.Attachments[option.Value.(string)]
+	if ext := path.Ext(attachment.Filename); ext != ".diff" && ext != ".patch" {
+		b.editInteractionResponse(i, tr(i, "Attach a `.diff` or `.patch` file."))
+		return
+	}
+	if attachment.Size > maxReviewBytes {
+		b.editInteractionResponse(i, tr(i, "That diff is too large to review, the limit is %d KB.", maxReviewBytes/1000))
+		return
+	}
+	data, err := downloadAttachment(attachment)
+	if err != nil {
+		interactionLogger(i).Error("Error downloading diff", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	b.review(i, string(data))
+}
+
+// reviewModal reviews the diff pasted in the /review form
+func (b *Bot) reviewModal(i *discordgo.InteractionCreate) {
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to review form", "error", err)
+		return
+	}
+	b.review(i, modalTextValue(i.ModalSubmitData(), "diff"))
+}
+
+// review answers a deferred interaction with a review of a diff, posting the
+// findings for each file in a thread
+func (b *Bot) review(i *discordgo.InteractionCreate, diff string) {
+	files := diffFiles(diff)
+	if len(files) == 0 {
+		b.editInteractionResponse(i, tr(i, "Attach a `.diff` or `.patch` file or paste a unified diff, like the output of `git diff`."))
+		return
+	}
+
+	review, err := b.reviewDiff(i, diff)
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+
+	var embeds []*discordgo.MessageEmbed
+	findings := 0
+	for _, file := range review.Files {
+		if embed, n := reviewEmbed(file); n > 0 {
+			embeds = append(embeds, embed)
+			findings += n
+		}
+	}
+	header := tr(i, "🔍 **Code review** of %d files: %d findings.", len(files), findings)
+	if review.Summary != "" {
+		header += "\n" + review.Summary
+	}
+	content := truncate(header, 2000)
+	message, err := b.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+	if err != nil {
+		interactionLogger(i).Error("Error editing interaction response", "error", err)
+		return
+	}
+	interactionLogger(i).Info("Reviewed diff", "files", len(files), "findings", findings)
+	if len(embeds) == 0 {
+		return
+	}
+
+	// Findings go in a thread on the review, or below it where threads
+	// aren't available (DMs, reviews already inside a thread)
+	channelID := i.ChannelID
+	if i.GuildID != "" && !b.isThread(i.ChannelID) {
+		thread, err := b.session.MessageThreadStartComplex(i.ChannelID, message.ID, &discordgo.ThreadStart{
+			Name:                truncate("Review: "+strings.Join(files, ", "), 100),
+			AutoArchiveDuration: 1440,
+		})
+		if err != nil {
+			interactionLogger(i).Error("Error starting thread", "error", err)
+		} else {
+			channelID = thread.ID
+		}
+	}
+	for _, embed := range embeds[:min(len(embeds), maxReviewFiles)] {
+		if _, err := b.session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}}); err != nil {
+			interactionLogger(i).Error("Error sending review findings", "error", err)
+			return
+		}
+	}
+	if len(embeds) > maxReviewFiles {
+		if _, err := b.session.ChannelMessageSend(channelID, tr(i, "Only the findings for the first %d files are shown.", maxReviewFiles)); err != nil {
+			interactionLogger(i).Error("Error sending review findings", "error", err)
+		}
+	}
+}
+
+// reviewDiff asks the model for a review of a diff
+func (b *Bot) reviewDiff(i *discordgo.InteractionCreate, diff string) (*codeReview, error) {
+	categories := make([]string, 0, len(reviewCategories))
+	for _, category := range reviewCategories {
+		categories = append(categories, category.name)
+	}
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"summary": {Type: genai.TypeString, Description: "What the change does and the overall verdict, in one to three sentences"},
+			"files": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"path": {Type: genai.TypeString, Description: "Path of the file in the diff"},
+						"findings": {
+							Type: genai.TypeArray,
+							Items: &genai.Schema{
+								Type: genai.TypeObject,
+								Properties: map[string]*genai.Schema{
+									"category": {Type: genai.TypeString, Enum: categories},
+									"line":     {Type: genai.TypeInteger, Description: "Line in the new version of the file, 0 for the whole file"},
+									"comment":  {Type: genai.TypeString, Description: "The problem and how to fix it, concisely"},
+								},
+								Required: []string{"category", "line", "comment"},
+							},
+						},
+					},
+					Required: []string{"path", "findings"},
+				},
+			},
+		},
+		Required: []string{"summary", "files"},
+	}
+	prompt := "Review this diff as a careful senior engineer. Report bugs, security issues and style problems " +
+		"in the lines it changes, leaving out what's fine and nitpicks a formatter would fix. " +
+		"Only list files with findings.\n\n```diff\n" + diff + "\n```"
+	text, err := b.generateJSON(interactionUserID(i), i.GuildID, schema, genai.Text(prompt))
+	if err != nil {
+		return nil, err
+	}
+	var review codeReview
+	if err := json.Unmarshal([]byte(text), &review); err != nil {
+		return nil, err
+	}
+	review.Summary = strings.TrimSpace(review.Summary)
+	return &review, nil
+}
+
+// diffFiles returns the paths of the files a unified diff changes
+func diffFiles(diff string) []string {
+	var files []string
+	lines := strings.Split(strings.ReplaceAll(diff, "\r\n", "\n"), "\n")
+	// Lines left in the current hunk, whose changes can look like file
+	// headers
+	var removed, added int
+	for n := 0; n < len(lines); n++ {
+		line := lines[n]
+		if removed > 0 || added > 0 {
+			switch {
+			case strings.HasPrefix(line, "-"):
+				removed--
+			case strings.HasPrefix(line, "+"):
+				added--
+			case strings.HasPrefix(line, `\`):
+			default:
+				removed--
+				added--
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "@@ ") {
+			removed, added = hunkLengths(line)
+			continue
+		}
+		// File headers are a --- line followed by a +++ one
+		before, beforeOK := strings.CutPrefix(line, "--- ")
+		if !beforeOK || n+1 == len(lines) {
+			continue
+		}
+		after, afterOK := strings.CutPrefix(lines[n+1], "+++ ")
+		if !afterOK {
+			continue
+		}
+		n++
+		// Deleted files are only named on the --- line
+		file := diffPath(after)
+		if file == "" {
+			file = diffPath(before)
+		}
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// hunkLengths returns how many lines a hunk header like "@@ -1,3 +1,4 @@"
+// says the hunk removes and adds, counting unchanged lines in both
+func hunkLengths(header string) (int, int) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 {
+		return 0, 0
+	}
+	return hunkLength(fields[1], "-"), hunkLength(fields[2], "+")
+}
+
+// hunkLength parses one side of a hunk header, where a missing length means
+// a single line
+func hunkLength(side string, prefix string) int {
+	side, ok := strings.CutPrefix(side, prefix)
+	if !ok {
+		return 0
+	}
+	_, length, found := strings.Cut(side, ",")
+	if !found {
+		return 1
+	}
+	n, err := strconv.Atoi(length)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// diffPath returns the path of a ---/+++ line of a diff, without its a/ or
+// b/ prefix and timestamp, or "" for /dev/null
+func diffPath(name string) string {
+	name, _, _ = strings.Cut(name, "\t")
+	if name == "/dev/null" {
+		return ""
+	}
+	if trimmed, ok := strings.CutPrefix(name, "a/"); ok {
+		return trimmed
+	}
+	if trimmed, ok := strings.CutPrefix(name, "b/"); ok {
+		return trimmed
+	}
+	return name
+}
+
+// reviewEmbed lists the findings about a file, most serious first, colored
+// by the most serious one, and returns how many it lists
+func reviewEmbed(file reviewFile) (*discordgo.MessageEmbed, int) {
+	var lines []string
+	color := 0
+	for _, category := range reviewCategories {
+		for _, finding := range file.Findings {
+			if finding.Category != category.name {
+				continue
+			}
+			if color == 0 {
+				color = category.color
+			}
+			line := category.label
+			if finding.Line > 0 {
+				line += fmt.Sprintf(" (line %d)", finding.Line)
+			}
+			lines = append(lines, line+": "+strings.TrimSpace(finding.Comment))
+		}
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       truncate(file.Path, 256),
+		Description: truncate(strings.Join(lines, "\n"), 4096),
+		Color:       color,
+	}
+	return embed, len(lines)
+}
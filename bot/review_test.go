@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const testDiff = `diff --git a/db.go b/db.go
+--- a/db.go
++++ b/db.go
+@@ -1,3 +1,3 @@
+--- an SQL comment that was removed
++++ not a header either
+-query := "SELECT 1"
++query := "SELECT * FROM users WHERE name = '" + name + "'"
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1 +0,0 @@
+-package old
+`
+
+func TestDiffFiles(t *testing.T) {
+	if files := diffFiles(testDiff); !slices.Equal(files, []string{"db.go", "old.go"}) {
+		t.Errorf("diffFiles = %q, want db.go and old.go", files)
+	}
+	if files := diffFiles("just some text\n--- not a diff"); len(files) != 0 {
+		t.Errorf("diffFiles = %q, want none", files)
+	}
+}
+
+func TestReview(t *testing.T) {
+	client := &fakeAI{text: `{"summary": "Builds queries by hand.", "files": [
+		{"path": "db.go", "findings": [
+			{"category": "style", "line": 0, "comment": "Name the query."},
+			{"category": "security", "line": 2, "comment": "SQL injection, use a placeholder."}
+		]},
+		{"path": "old.go", "findings": []}
+	]}`}
+	b, session := newTestBot(t, client)
+
+	// Without a file, the diff is pasted in a form
+	command := commandInteraction("review")
+	command.Data = discordgo.ApplicationCommandInteractionData{Name: "review"}
+	b.HandleInteraction(command)
+	if len(session.responses) != 1 || session.responses[0].Type != discordgo.InteractionResponseModal {
+		t.Fatalf("responded %v, want the form", session.responses)
+	}
+
+	form := func(diff string) *discordgo.InteractionCreate {
+		return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+			Type:      discordgo.InteractionModalSubmit,
+			GuildID:   "guild",
+			ChannelID: "channel",
+			Member:    &discordgo.Member{User: &discordgo.User{ID: "alice"}},
+			Data: discordgo.ModalSubmitInteractionData{CustomID: reviewModalID, Components: []discordgo.MessageComponent{
+				&discordgo.ActionsRow{Components: []discordgo.MessageComponent{&discordgo.TextInput{CustomID: "diff", Value: diff}}},
+			}},
+		}}
+	}
+	b.HandleInteraction(form("not a diff"))
+	if len(session.edits) != 1 || !strings.Contains(*session.edits[0].Content, "paste a unified diff") {
+		t.Errorf("edits = %v, want the diff refused", session.edits)
+	}
+
+	session.edits = nil
+	b.HandleInteraction(form(testDiff))
+	if len(session.edits) != 1 || *session.edits[0].Content != "🔍 **Code review** of 2 files: 2 findings.\nBuilds queries by hand." {
+		t.Errorf("edits = %v, want the review's summary", session.edits)
+	}
+	if session.threadsStart != 1 || len(session.embeds) != 1 {
+		t.Fatalf("started %d threads and sent %d embeds, want one file's findings in a thread", session.threadsStart, len(session.embeds))
+	}
+	embed := session.embeds[0]
+	want := "🔒 **Security** (line 2): SQL injection, use a placeholder.\n🎨 **Style**: Name the query."
+	if embed.Title != "db.go" || embed.Description != want || embed.Color != 0xed4245 {
+		t.Errorf("embed = %+v, want the most serious findings first", embed)
+	}
+}
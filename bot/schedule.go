@@ -0,0 +1,279 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/cron"
+	"go-discord-bot/i18n"
+	"go-discord-bot/store"
+)
+
+const (
+	// Scheduled jobs each server may have
+	maxScheduledJobs = 25
+
+	// How often the scheduler looks for due jobs and reminders
+	schedulerInterval = time.Minute
+
+	// Most messages a digest summarizes, the newest ones are kept
+	maxDigestMessages = 1000
+
+	// Upper bound of the /schedule hours option, a week
+	maxDigestHours = 168
+)
+
+// Lower bound of the /schedule hours option (the API takes a pointer)
+var minDigestHours = 1.0
+
+// RunScheduler runs scheduled jobs and sends reminders, of members and of
+// events, as they come due, and expires idle chats, until ctx is done
+func (b *Bot) RunScheduler(ctx context.Context) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		b.runDueJobs(now)
+		b.sendDueReminders(now)
+		b.sendEventReminders(now)
+		b.expireIdleChats(now)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDueJobs runs the jobs due at now. Each is rescheduled before it runs, so
+// a failing job waits for its next run instead of retrying every minute.
+func (b *Bot) runDueJobs(now time.Time) {
+	jobs, err := b.store.DueScheduledJobs(now)
+	if err != nil {
+		slog.Error("Error loading scheduled jobs", "error", err)
+		return
+	}
+	for _, job := range jobs {
+		logger := slog.With("job", job.ID, "guild", job.GuildID)
+		schedule, err := cron.Parse(job.Spec)
+		if err != nil {
+			logger.Error("Error parsing scheduled job", "error", err)
+			continue
+		}
+		if err := b.store.SetScheduledJobNextRun(job.ID, schedule.Next(now.UTC())); err != nil {
+			logger.Error("Error rescheduling job", "error", err)
+			continue
+		}
+		if b.maintenance.Load() {
+			logger.Warn("Skipped scheduled job during maintenance")
+			continue
+		}
+		if b.quotaExhausted(job.GuildID) {
+			logger.Warn("Skipped scheduled job, the server's quota is exhausted")
+			continue
+		}
+		b.runDigest(job, now)
+	}
+}
+
+// runDigest summarizes the job's source channel over its window and posts
+// the summary to its target channel
+func (b *Bot) runDigest(job store.ScheduledJob, now time.Time) {
+	logger := slog.With("job", job.ID, "guild", job.GuildID)
+	messages, err := b.channelMessagesSince(job.SourceChannelID, now.Add(-time.Duration(job.Hours)*time.Hour))
+	if err != nil {
+		logger.Error("Error reading channel history", "channel", job.SourceChannelID, "error", err)
+		return
+	}
+	header := fmt.Sprintf("📰 **Digest of <#%s>, last %s**\n\n", job.SourceChannelID, hoursText("", job.Hours))
+	if len(messages) == 0 {
+		b.session.ChannelMessageSend(job.TargetChannelID, header+"Nothing was said.")
+		logger.Info("Ran scheduled job", "messages", 0)
+		return
+	}
+
+	var transcript strings.Builder
+	for _, m := range messages {
+		fmt.Fprintf(&transcript, "%s: %s\n", m.Author.Username, m.Content)
+	}
+	prompt := fmt.Sprintf("Summarize the following Discord messages from the last %s as a digest for people who missed them. "+
+		"Cover the main topics, decisions and open questions.", hoursText("", job.Hours))
+	if job.Instructions != "" {
+		prompt += "\n\n" + job.Instructions
+	}
+	transcriptText := b.untrusted(job.CreatedBy, job.GuildID, "the channel's messages", transcript.String())
+	summary, err := b.generate(job.CreatedBy, job.GuildID, genai.Text(prompt+"\n\n"+transcriptText))
+	if err != nil {
+		logger.Error("Error summarizing channel", "error", err)
+		return
+	}
+	b.sendLongMessage(job.TargetChannelID, header+summary)
+	logger.Info("Ran scheduled job", "messages", len(messages))
+}
+
+// channelMessagesSince returns the messages users wrote in a channel since a
+// time, oldest first
+func (b *Bot) channelMessagesSince(channelID string, since time.Time) ([]*discordgo.Message, error) {
+	var messages []*discordgo.Message
+	before := ""
+	for len(messages) < maxDigestMessages {
+		page, err := b.session.ChannelMessages(channelID, 100, before, "", "")
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		done := false
+		for _, m := range page {
+			if m.Timestamp.Before(since) {
+				done = true
+				break
+			}
+			if m.Author != nil && !m.Author.Bot && m.Content != "" && len(messages) < maxDigestMessages {
+				messages = append(messages, m)
+			}
+		}
+		if done {
+			break
+		}
+		before = page[len(page)-1].ID
+	}
+	// Pages come newest first
+	slices.Reverse(messages)
+	return messages, nil
+}
+
+// hoursText describes a number of hours, in days when it is a whole number
+// of them, in the language of locale
+func hoursText(locale discordgo.Locale, hours int) string {
+	switch {
+	case hours == 1:
+		return i18n.Translate(locale, "hour")
+	case hours == 24:
+		return i18n.Translate(locale, "day")
+	case hours%24 == 0:
+		return i18n.Translate(locale, "%d days", hours/24)
+	}
+	return i18n.Translate(locale, "%d hours", hours)
+}
+
+// scheduleCommand handles the /schedule subcommands, which add, list and
+// remove the server's scheduled jobs. They need the Manage Server permission.
+func (b *Bot) scheduleCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Scheduled jobs only work in servers."))
+		return
+	}
+	if i.Member == nil || i.Member.Permissions&discordgo.PermissionManageServer == 0 {
+		b.respondEphemeral(i, tr(i, "You need the Manage Server permission to schedule jobs."))
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	switch subcommand.Name {
+	case "add":
+		job := store.ScheduledJob{
+			GuildID:         i.GuildID,
+			SourceChannelID: commandOption(subcommand.Options, "source").ChannelValue(nil).ID,
+			TargetChannelID: commandOption(subcommand.Options, "target").ChannelValue(nil).ID,
+			Spec:            strings.TrimSpace(commandOption(subcommand.Options, "cron").StringValue()),
+			Hours:           24,
+			CreatedBy:       interactionUserID(i),
+		}
+		if option := commandOption(subcommand.Options, "hours"); option != nil {
+			job.Hours = int(option.IntValue())
+		}
+		if option := commandOption(subcommand.Options, "instructions"); option != nil {
+			job.Instructions = option.StringValue()
+		}
+		b.addScheduledJob(i, job)
+	case "list":
+		b.listScheduledJobs(i)
+	case "remove":
+		b.removeScheduledJob(i, commandOption(subcommand.Options, "id").IntValue())
+	}
+}
+
+// addScheduledJob validates and saves a new scheduled job
+func (b *Bot) addScheduledJob(i *discordgo.InteractionCreate, job store.ScheduledJob) {
+	schedule, err := cron.Parse(job.Spec)
+	if err != nil {
+		b.respondEphemeral(i, tr(i, "That schedule isn't valid: %v\nUse five fields in UTC, like `0 9 * * *` for every day at 9:00, or `@daily` and `@weekly`.", err))
+		return
+	}
+	job.NextRun = schedule.Next(time.Now().UTC())
+	if job.NextRun.IsZero() {
+		b.respondEphemeral(i, tr(i, "That schedule never runs."))
+		return
+	}
+
+	// Members can't have the bot summarize channels they can't read
+	permissions, err := b.session.UserChannelPermissions(job.CreatedBy, job.SourceChannelID)
+	if err != nil || permissions&discordgo.PermissionViewChannel == 0 {
+		b.respondEphemeral(i, tr(i, "You can't read <#%s>.", job.SourceChannelID))
+		return
+	}
+
+	id, err := b.store.AddScheduledJob(job, maxScheduledJobs)
+	if errors.Is(err, store.ErrSchedulesFull) {
+		b.respondEphemeral(i, tr(i, "This server already has %d scheduled jobs.", maxScheduledJobs))
+		return
+	}
+	if err != nil {
+		interactionLogger(i).Error("Error saving scheduled job", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	interactionLogger(i).Info("Added scheduled job", "job", id, "spec", job.Spec)
+	b.respondEphemeral(i, tr(i, "Scheduled job #%d will summarize the last %s of <#%s> into <#%s> at `%s` (UTC), next <t:%d:f>.",
+		id, hoursText(interactionLocale(i), job.Hours), job.SourceChannelID, job.TargetChannelID, job.Spec, job.NextRun.Unix()))
+}
+
+// listScheduledJobs lists the server's scheduled jobs
+func (b *Bot) listScheduledJobs(i *discordgo.InteractionCreate) {
+	jobs, err := b.store.ScheduledJobs(i.GuildID)
+	if err != nil {
+		interactionLogger(i).Error("Error loading scheduled jobs", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if len(jobs) == 0 {
+		b.respondEphemeral(i, tr(i, "This server has no scheduled jobs. Add one with `/schedule add`."))
+		return
+	}
+	var lines []string
+	for _, job := range jobs {
+		line := tr(i, "`#%d` <#%s> → <#%s> at `%s`, last %s, next <t:%d:R>",
+			job.ID, job.SourceChannelID, job.TargetChannelID, job.Spec, hoursText(interactionLocale(i), job.Hours), job.NextRun.Unix())
+		if job.Instructions != "" {
+			line += ": " + truncate(strings.ReplaceAll(job.Instructions, "\n", " "), 80)
+		}
+		lines = append(lines, line)
+	}
+	b.respondEphemeral(i, truncate(strings.Join(lines, "\n"), 2000))
+}
+
+// removeScheduledJob deletes one of the server's scheduled jobs
+func (b *Bot) removeScheduledJob(i *discordgo.InteractionCreate, id int64) {
+	deleted, err := b.store.DeleteScheduledJob(i.GuildID, id)
+	if err != nil {
+		interactionLogger(i).Error("Error deleting scheduled job", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if !deleted {
+		b.respondEphemeral(i, tr(i, "There's no scheduled job #%d. See `/schedule list`.", id))
+		return
+	}
+	interactionLogger(i).Info("Removed scheduled job", "job", id)
+	b.respondEphemeral(i, tr(i, "Removed scheduled job #%d.", id))
+}
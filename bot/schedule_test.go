@@ -0,0 +1,150 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/store"
+)
+
+// scheduleInteraction is a /schedule subcommand sent by a server member
+func scheduleInteraction(permissions int64, subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	i := promptInteraction("alice", permissions, subcommand, options...)
+	data := i.Data.(discordgo.ApplicationCommandInteractionData)
+	data.Name = "schedule"
+	i.Data = data
+	return i
+}
+
+// channelOption is a channel command option
+func channelOption(name string, channelID string) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Name: name, Type: discordgo.ApplicationCommandOptionChannel, Value: channelID}
+}
+
+// integerOption is an integer command option, which Discord sends as a float
+func integerOption(name string, value int) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Name: name, Type: discordgo.ApplicationCommandOptionInteger, Value: float64(value)}
+}
+
+func TestScheduleCommand(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+	manager := int64(discordgo.PermissionManageServer)
+
+	steps := []struct {
+		interaction *discordgo.InteractionCreate
+		want        string
+	}{
+		{scheduleInteraction(0, "list"), "You need the Manage Server permission to schedule jobs."},
+		{scheduleInteraction(manager, "list"), "This server has no scheduled jobs. Add one with `/schedule add`."},
+		{scheduleInteraction(manager, "add", channelOption("source", "general"), channelOption("target", "digest"), stringOption("cron", "0 25 * * *")),
+			"That schedule isn't valid: error parsing \"0 25 * * *\": hour field \"25\" is outside 0-23"},
+		{scheduleInteraction(manager, "add", channelOption("source", "general"), channelOption("target", "digest"), stringOption("cron", "0 0 31 2 *")),
+			"That schedule never runs."},
+		{scheduleInteraction(manager, "add", channelOption("source", "general"), channelOption("target", "digest"), stringOption("cron", "0 9 * * *")),
+			"Scheduled job #1 will summarize the last day of <#general> into <#digest> at `0 9 * * *` (UTC)"},
+		{scheduleInteraction(manager, "add", channelOption("source", "dev"), channelOption("target", "digest"), stringOption("cron", "@weekly"),
+			integerOption("hours", 168), stringOption("instructions", "Bullet points")),
+			"Scheduled job #2 will summarize the last 7 days of <#dev> into <#digest> at `@weekly` (UTC)"},
+		{scheduleInteraction(manager, "list"), "`#1` <#general> → <#digest> at `0 9 * * *`, last day, next <t:"},
+		{scheduleInteraction(manager, "remove", integerOption("id", 1)), "Removed scheduled job #1."},
+		{scheduleInteraction(manager, "remove", integerOption("id", 1)), "There's no scheduled job #1. See `/schedule list`."},
+	}
+	for _, step := range steps {
+		session.responses = nil
+		b.HandleInteraction(step.interaction)
+		if len(session.responses) != 1 || !strings.HasPrefix(session.responses[0].Data.Content, step.want) {
+			t.Errorf("responded %v, want %q", session.responses, step.want)
+		}
+	}
+
+	jobs, err := b.store.ScheduledJobs("guild")
+	if err != nil || len(jobs) != 1 || jobs[0].Hours != 168 || jobs[0].Instructions != "Bullet points" {
+		t.Errorf("ScheduledJobs = %+v, %v, want the weekly job", jobs, err)
+	}
+}
+
+func TestRunDueJobs(t *testing.T) {
+	client := &fakeAI{text: "People planned the release."}
+	b, session := newTestBot(t, client)
+
+	now := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	for n := range 150 {
+		// Newest first, one message a minute going back past the window
+		session.history["general"] = append(session.history["general"], &discordgo.Message{
+			ID:        fmt.Sprintf("m%d", n),
+			Content:   fmt.Sprintf("message %d", n),
+			Author:    &discordgo.User{Username: "alice", Bot: n == 0},
+			Timestamp: now.Add(-time.Duration(n) * time.Minute),
+		})
+	}
+	jobs := []store.ScheduledJob{
+		{GuildID: "guild", SourceChannelID: "general", TargetChannelID: "digest", Spec: "0 9 * * *", Hours: 2, CreatedBy: "alice", NextRun: now},
+		{GuildID: "guild", SourceChannelID: "empty", TargetChannelID: "digest", Spec: "0 9 * * *", Hours: 1, CreatedBy: "alice", NextRun: now},
+		{GuildID: "guild", SourceChannelID: "later", TargetChannelID: "digest", Spec: "0 10 * * *", Hours: 1, CreatedBy: "alice", NextRun: now.Add(time.Hour)},
+	}
+	for _, job := range jobs {
+		if _, err := b.store.AddScheduledJob(job, maxScheduledJobs); err != nil {
+			t.Fatalf("AddScheduledJob: %v", err)
+		}
+	}
+
+	b.runDueJobs(now)
+	want := []string{
+		"📰 **Digest of <#general>, last 2 hours**\n\nPeople planned the release.",
+		"📰 **Digest of <#empty>, last hour**\n\nNothing was said.",
+	}
+	if strings.Join(session.messages, "|") != strings.Join(want, "|") {
+		t.Errorf("messages = %q, want %q", session.messages, want)
+	}
+
+	// The digest covers the two hour window, oldest first, without bots
+	prompt := string(client.prompts[0][0].(genai.Text))
+	if !strings.Contains(prompt, "alice: message 120\n") || strings.Contains(prompt, "message 121") ||
+		strings.Contains(prompt, "message 0\n") || strings.Index(prompt, "message 2\n") < strings.Index(prompt, "message 3\n") {
+		t.Errorf("prompt = %q, want messages 120 to 1, oldest first", prompt)
+	}
+
+	// Jobs that ran are due again tomorrow, the others are left alone
+	got, err := b.store.ScheduledJobs("guild")
+	if err != nil {
+		t.Fatalf("ScheduledJobs: %v", err)
+	}
+	for n, job := range got {
+		want := now.Add(24 * time.Hour)
+		if n == 2 {
+			want = now.Add(time.Hour)
+		}
+		if !job.NextRun.Equal(want) {
+			t.Errorf("job %d next runs at %v, want %v", job.ID, job.NextRun, want)
+		}
+	}
+
+	session.messages = nil
+	b.runDueJobs(now.Add(time.Minute))
+	if len(session.messages) != 0 {
+		t.Errorf("messages after rescheduling = %q, want none", session.messages)
+	}
+}
+
+func TestHoursText(t *testing.T) {
+	tests := []struct {
+		hours int
+		want  string
+	}{
+		{1, "hour"},
+		{12, "12 hours"},
+		{24, "day"},
+		{48, "2 days"},
+		{36, "36 hours"},
+	}
+	for _, test := range tests {
+		if got := hoursText("", test.hours); got != test.want {
+			t.Errorf("hoursText(%d) = %q, want %q", test.hours, got, test.want)
+		}
+	}
+}
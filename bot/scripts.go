@@ -0,0 +1,226 @@
+package bot
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/script"
+	"go-discord-bot/store"
+)
+
+// guildScript returns the compiled script of a guild, or nil when it has
+// none or it doesn't compile. Scripts are compiled once and cached, nil
+// included.
+func (b *Bot) guildScript(guildID string) *script.Script {
+	if guildID == "" {
+		return nil
+	}
+	b.scriptsMu.Lock()
+	defer b.scriptsMu.Unlock()
+
+	if s, ok := b.scripts[guildID]; ok {
+		return s
+	}
+	saved, err := b.store.GuildScript(guildID)
+	if err != nil {
+		slog.Error("Error loading script", "guild", guildID, "error", err)
+		return nil
+	}
+	var s *script.Script
+	if saved != nil {
+		if s, err = script.Compile(saved.Source); err != nil {
+			slog.Warn("Error compiling script", "guild", guildID, "error", err)
+		}
+	}
+	b.scripts[guildID] = s
+	return s
+}
+
+// scriptPrompt runs a guild's before_prompt on the texts of a prompt,
+// keeping its other parts, such as files, ahead of them. The prompt is kept
+// as it was when the script fails.
+func (b *Bot) scriptPrompt(guildID string, parts []genai.Part) []genai.Part {
+	s := b.guildScript(guildID)
+	if s == nil {
+		return parts
+	}
+	var others []genai.Part
+	var texts []string
+	for _, part := range parts {
+		if text, ok := part.(genai.Text); ok {
+			texts = append(texts, string(text))
+		} else {
+			others = append(others, part)
+		}
+	}
+	texts, err := s.BeforePrompt(texts)
+	if err != nil {
+		slog.Warn("Error in script's before_prompt", "guild", guildID, "error", err)
+		return parts
+	}
+	for _, text := range texts {
+		others = append(others, genai.Text(text))
+	}
+	return others
+}
+
+// scriptResponse runs a guild's after_response on the text of an answer,
+// which is kept as it was when the script fails
+func (b *Bot) scriptResponse(guildID string, text string) string {
+	s := b.guildScript(guildID)
+	if s == nil {
+		return text
+	}
+	changed, err := s.AfterResponse(text)
+	if err != nil {
+		slog.Warn("Error in script's after_response", "guild", guildID, "error", err)
+		return text
+	}
+	return changed
+}
+
+// scriptCommand handles the /script subcommands, which need the Manage
+// Server permission
+func (b *Bot) scriptCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Scripts only work in servers."))
+		return
+	}
+	if i.Member == nil || i.Member.Permissions&discordgo.PermissionManageServer == 0 {
+		b.respondEphemeral(i, tr(i, "You need the Manage Server permission to manage the server's script."))
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	switch subcommand.Name {
+	case "set":
+		b.scriptSet(i, commandOption(subcommand.Options, "file"))
+	case "show":
+		b.scriptShow(i)
+	case "test":
+		b.scriptTest(i, commandOption(subcommand.Options, "text").StringValue())
+	case "remove":
+		b.scriptRemove(i)
+	}
+}
+
+// scriptSet saves an uploaded script once it compiles
+func (b *Bot) scriptSet(i *discordgo.InteractionCreate, option *discordgo.ApplicationCommandInteractionDataOption) {
+	attachment := i.ApplicationCommandData().Resolved.Attachments[option.Value.(string)]
+	if attachment.Size > script.MaxSourceBytes {
+		b.respondEphemeral(i, tr(i, "Scripts can be up to %d KB.", script.MaxSourceBytes>>10))
+		return
+	}
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to script command", "error", err)
+		return
+	}
+	data, err := downloadAttachment(attachment)
+	if err != nil {
+		interactionLogger(i).Error("Error downloading script", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	source := string(data)
+	compiled, err := script.Compile(source)
+	if err != nil {
+		b.editInteractionResponse(i, tr(i, "The script wasn't saved, it failed with:")+"\n```\n"+truncate(err.Error(), 1800)+"\n```")
+		return
+	}
+	if err := b.store.SetGuildScript(store.GuildScript{GuildID: i.GuildID, Source: source, UpdatedAt: time.Now()}); err != nil {
+		interactionLogger(i).Error("Error saving script", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	b.scriptsMu.Lock()
+	b.scripts[i.GuildID] = compiled
+	b.scriptsMu.Unlock()
+	interactionLogger(i).Info("Saved script", "bytes", len(source))
+	b.editInteractionResponse(i, tr(i, "Saved the script, it now runs on every prompt and answer in this server. Try it with `/script test`."))
+}
+
+// scriptShow attaches the guild's script
+func (b *Bot) scriptShow(i *discordgo.InteractionCreate) {
+	saved, err := b.store.GuildScript(i.GuildID)
+	if err != nil {
+		interactionLogger(i).Error("Error loading script", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if saved == nil {
+		b.respondEphemeral(i, tr(i, "This server has no script, upload one with `/script set`."))
+		return
+	}
+	err = b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: tr(i, "The server's script, uploaded <t:%d:R>:", saved.UpdatedAt.Unix()),
+			Files:   []*discordgo.File{{Name: "script.star", ContentType: "text/plain", Reader: strings.NewReader(saved.Source)}},
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to script command", "error", err)
+	}
+}
+
+// scriptTest shows what the guild's script makes of a text, as a prompt and
+// as an answer, with the errors it fails with
+func (b *Bot) scriptTest(i *discordgo.InteractionCreate, text string) {
+	s := b.guildScript(i.GuildID)
+	if s == nil {
+		b.respondEphemeral(i, tr(i, "This server has no script, upload one with `/script set`."))
+		return
+	}
+	prompt := "```\n"
+	if texts, err := s.BeforePrompt([]string{text}); err != nil {
+		prompt += err.Error()
+	} else {
+		prompt += strings.Join(texts, "\n\n")
+	}
+	answer := "```\n"
+	if changed, err := s.AfterResponse(text); err != nil {
+		answer += err.Error()
+	} else {
+		answer += changed
+	}
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{{
+				Title: tr(i, "Script test"),
+				Fields: []*discordgo.MessageEmbedField{
+					{Name: tr(i, "As a prompt"), Value: truncate(prompt, 1000) + "\n```"},
+					{Name: tr(i, "As an answer"), Value: truncate(answer, 1000) + "\n```"},
+				},
+			}},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to script command", "error", err)
+	}
+}
+
+// scriptRemove deletes the guild's script
+func (b *Bot) scriptRemove(i *discordgo.InteractionCreate) {
+	deleted, err := b.store.DeleteGuildScript(i.GuildID)
+	if err != nil {
+		interactionLogger(i).Error("Error deleting script", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if !deleted {
+		b.respondEphemeral(i, tr(i, "This server has no script, upload one with `/script set`."))
+		return
+	}
+	b.scriptsMu.Lock()
+	delete(b.scripts, i.GuildID)
+	b.scriptsMu.Unlock()
+	interactionLogger(i).Info("Removed script")
+	b.respondEphemeral(i, tr(i, "Removed the script, prompts and answers are no longer changed."))
+}
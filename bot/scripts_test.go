@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/store"
+)
+
+func TestScripts(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "I'm Gemini."}, {Text: "Still Gemini."}}}
+	b, session := newTestBot(t, client)
+	source := `
+def before_prompt(parts):
+    return ["Server rules: be kind."] + parts
+
+def after_response(text):
+    return text.replace("Gemini", "our bot")
+`
+	if err := b.store.SetGuildScript(store.GuildScript{GuildID: "guild", Source: source, UpdatedAt: time.Now()}); err != nil {
+		t.Fatalf("SetGuildScript: %v", err)
+	}
+
+	b.HandleMessage(userMessage("who are you?"))
+	if sent := client.chats[0].sent; len(sent) != 1 || !strings.HasPrefix(partsText(sent[0]), "Server rules: be kind.") {
+		t.Errorf("sent %v, want the rules before the prompt", sent)
+	}
+	if len(session.messages) != 1 || session.messages[0] != "I'm our bot." {
+		t.Errorf("messages = %q, want the answer the script changed", session.messages)
+	}
+
+	// Only members who can manage the server change its script
+	remove := commandInteraction("script")
+	remove.Data = discordgo.ApplicationCommandInteractionData{
+		Name:    "script",
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{{Name: "remove", Type: discordgo.ApplicationCommandOptionSubCommand}},
+	}
+	b.HandleInteraction(remove)
+	if len(session.responses) != 1 || !strings.Contains(session.responses[0].Data.Content, "Manage Server") {
+		t.Fatalf("responses = %v, want the member refused", session.responses)
+	}
+
+	remove.Member.Permissions = discordgo.PermissionManageServer
+	b.HandleInteraction(remove)
+	if len(session.responses) != 2 || !strings.Contains(session.responses[1].Data.Content, "Removed the script") {
+		t.Fatalf("responses = %v, want the script removed", session.responses)
+	}
+	b.HandleMessage(userMessage("and now?"))
+	if len(session.messages) != 2 || session.messages[1] != "Still Gemini." {
+		t.Errorf("messages = %q, want the answer unchanged", session.messages)
+	}
+}
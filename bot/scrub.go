@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"regexp"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// piiPatterns match personal information redacted from messages in servers
+// that ask for it, with what replaces it. Tokens and invites come first so
+// the looser patterns don't take parts of them.
+var piiPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`\b(?:mfa\.[\w-]{84}|[\w-]{24,28}\.[\w-]{6,7}\.[\w-]{27,38})\b`), "[redacted token]"},
+	{regexp.MustCompile(`(?i)\b(?:https?://)?(?:www\.)?(?:discord\.(?:gg|io|me|li)|discord(?:app)?\.com/invite)/[\w-]+`), "[redacted invite]"},
+	{regexp.MustCompile(`\b[\w.%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`), "[redacted email]"},
+	{regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{2,5}\)|\b\d{2,5})[\s.-]?\d{3,4}[\s.-]?\d{3,4}\b`), "[redacted phone number]"},
+}
+
+// scrubPII redacts emails, phone numbers, Discord tokens and invite links
+// from text
+func scrubPII(text string) string {
+	for _, p := range piiPatterns {
+		text = p.pattern.ReplaceAllString(text, p.replacement)
+	}
+	return text
+}
+
+// scrubParts redacts personal information from the text of parts about to
+// be sent to the model, when their guild asks for it
+func (b *Bot) scrubParts(guildID string, parts []genai.Part) []genai.Part {
+	if guildID == "" || !b.guildSettings(guildID).ScrubPII {
+		return parts
+	}
+	scrubbed := make([]genai.Part, len(parts))
+	for n, part := range parts {
+		if text, ok := part.(genai.Text); ok {
+			part = genai.Text(scrubPII(string(text)))
+		}
+		scrubbed[n] = part
+	}
+	return scrubbed
+}
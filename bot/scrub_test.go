@@ -0,0 +1,51 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/store"
+)
+
+func TestScrubPII(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"mail me at jane.doe+bot@example.co.uk please", "mail me at [redacted email] please"},
+		{"call +1 (555) 123-4567 or 555.123.4567", "call [redacted phone number] or [redacted phone number]"},
+		{"my number is 07700 900123", "my number is [redacted phone number]"},
+		{"token MTA4NzY1NDMyMTA5ODc2NTQzMjE.GabcDe.abcdefghijklmnopqrstuvwxyz0123456789 leaked", "token [redacted token] leaked"},
+		{"join https://discord.gg/abc123 or discord.com/invite/xyz", "join [redacted invite] or [redacted invite]"},
+		// Dates, times and Discord IDs aren't phone numbers
+		{"on 2024-01-31 at 10:30, ask <@123456789012345678>", "on 2024-01-31 at 10:30, ask <@123456789012345678>"},
+		{"nothing to hide", "nothing to hide"},
+	}
+	for _, test := range tests {
+		if got := scrubPII(test.text); got != test.want {
+			t.Errorf("scrubPII(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestScrubParts(t *testing.T) {
+	fake := &fakeAI{replies: []*ai.Reply{{Text: "Hi"}, {Text: "Hi"}}}
+	b, _ := newTestBot(t, fake)
+
+	// Messages are sent as written unless the server asks otherwise
+	b.HandleMessage(userMessage("I'm jane@example.com"))
+	if err := b.saveGuildSettings("guild", &store.GuildSettings{GuildID: "guild", Trigger: triggerAll, ScrubPII: true}); err != nil {
+		t.Fatal(err)
+	}
+	b.HandleMessage(userMessage("I'm jane@example.com"))
+
+	sent := fake.chats[0].sent
+	if text := sent[0][len(sent[0])-1]; text != genai.Text("I'm jane@example.com") {
+		t.Errorf("first message sent %v, want it as written", text)
+	}
+	if text := sent[1][len(sent[1])-1]; text != genai.Text("I'm [redacted email]") {
+		t.Errorf("second message sent %v, want the email redacted", text)
+	}
+}
@@ -0,0 +1,156 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Session is the subset of the Discord API the bot uses, so handlers can be
+// tested against a fake
+type Session interface {
+	// BotUserID returns the bot's own user ID
+	BotUserID() string
+
+	// VoiceState returns a member's voice state in a guild
+	VoiceState(guildID, userID string) (*discordgo.VoiceState, error)
+
+	Channel(channelID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	ChannelTyping(channelID string, options ...discordgo.RequestOption) error
+	ChannelMessage(channelID, messageID string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string, options ...discordgo.RequestOption) ([]*discordgo.Message, error)
+	ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageEditComplex(m *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageDelete(channelID, messageID string, options ...discordgo.RequestOption) error
+	ChannelMessagePin(channelID, messageID string, options ...discordgo.RequestOption) error
+	MessageReactionAdd(channelID, messageID, emojiID string, options ...discordgo.RequestOption) error
+	ChannelFileSend(channelID, name string, r io.Reader, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	MessageThreadStartComplex(channelID, messageID string, data *discordgo.ThreadStart, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	ChannelEdit(channelID string, data *discordgo.ChannelEdit, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	UserChannelPermissions(userID, channelID string, fetchOptions ...discordgo.RequestOption) (int64, error)
+	ChannelVoiceJoin(gID, cID string, mute, deaf bool) (*discordgo.VoiceConnection, error)
+	UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+
+	// ChannelPollSend posts a native poll in a channel
+	ChannelPollSend(channelID string, poll *Poll) (*discordgo.Message, error)
+
+	// UpdateStatusComplex sets the bot's presence on every gateway shard
+	UpdateStatusComplex(data discordgo.UpdateStatusData) error
+
+	// Guilds returns the guilds the bot is in
+	Guilds() []*discordgo.Guild
+	Guild(guildID string, options ...discordgo.RequestOption) (*discordgo.Guild, error)
+	GuildLeave(guildID string, options ...discordgo.RequestOption) error
+	GuildScheduledEvent(guildID, eventID string, userCount bool, options ...discordgo.RequestOption) (*discordgo.GuildScheduledEvent, error)
+	GuildScheduledEventCreate(guildID string, event *discordgo.GuildScheduledEventParams, options ...discordgo.RequestOption) (*discordgo.GuildScheduledEvent, error)
+
+	InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error
+	InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error)
+}
+
+// discordSession adapts discordgo sessions to Session, answering lookups
+// from the state cache where possible. With several gateway shards, REST
+// calls go through the first and lookups through the shard owning the guild.
+type discordSession struct {
+	*discordgo.Session
+
+	shards []*discordgo.Session
+}
+
+// shard returns the session receiving a guild's events, or the first one
+// when this process doesn't run that guild's shard
+func (s discordSession) shard(guildID string) *discordgo.Session {
+	for _, shard := range s.shards {
+		if shard.ShardID == ShardOf(guildID, shard.ShardCount) {
+			return shard
+		}
+	}
+	return s.Session
+}
+
+// BotUserID returns the bot's own user ID
+func (s discordSession) BotUserID() string {
+	return s.State.User.ID
+}
+
+// VoiceState returns a member's voice state in a guild
+func (s discordSession) VoiceState(guildID, userID string) (*discordgo.VoiceState, error) {
+	return s.shard(guildID).State.VoiceState(guildID, userID)
+}
+
+// ChannelVoiceJoin joins a voice channel over the gateway of the guild's shard
+func (s discordSession) ChannelVoiceJoin(guildID, channelID string, mute, deaf bool) (*discordgo.VoiceConnection, error) {
+	return s.shard(guildID).ChannelVoiceJoin(guildID, channelID, mute, deaf)
+}
+
+// UpdateStatusComplex sets the bot's presence on every shard, returning the
+// errors of the shards it couldn't be set on
+func (s discordSession) UpdateStatusComplex(data discordgo.UpdateStatusData) error {
+	var errs []error
+	for _, shard := range s.shards {
+		if err := shard.UpdateStatusComplex(data); err != nil {
+			errs = append(errs, fmt.Errorf("shard %d: %w", shard.ShardID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ChannelPollSend posts a native poll in a channel, which discordgo can't
+// send yet
+func (s discordSession) ChannelPollSend(channelID string, poll *Poll) (*discordgo.Message, error) {
+	endpoint := discordgo.EndpointChannelMessages(channelID)
+	body, err := s.RequestWithBucketID("POST", endpoint, map[string]*Poll{"poll": poll}, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	var message discordgo.Message
+	if err := json.Unmarshal(body, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// Guilds returns the guilds the bot is in on every shard, from the state cache
+func (s discordSession) Guilds() []*discordgo.Guild {
+	var guilds []*discordgo.Guild
+	for _, shard := range s.shards {
+		shard.State.RLock()
+		guilds = append(guilds, shard.State.Guilds...)
+		shard.State.RUnlock()
+	}
+	return guilds
+}
+
+// Channel returns a channel from the state cache, fetching it if it isn't cached
+func (s discordSession) Channel(channelID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	for _, shard := range s.shards {
+		if channel, err := shard.State.Channel(channelID); err == nil {
+			return channel, nil
+		}
+	}
+	return s.Session.Channel(channelID, options...)
+}
+
+// Guild returns a guild from the state cache, fetching it if it isn't cached
+func (s discordSession) Guild(guildID string, options ...discordgo.RequestOption) (*discordgo.Guild, error) {
+	if guild, err := s.shard(guildID).State.Guild(guildID); err == nil {
+		return guild, nil
+	}
+	return s.Session.Guild(guildID, options...)
+}
+
+// UserChannelPermissions computes a member's permissions in a channel from
+// the state of the channel's shard, fetching what isn't cached
+func (s discordSession) UserChannelPermissions(userID, channelID string, options ...discordgo.RequestOption) (int64, error) {
+	for _, shard := range s.shards {
+		if _, err := shard.State.Channel(channelID); err == nil {
+			return shard.UserChannelPermissions(userID, channelID, options...)
+		}
+	}
+	return s.Session.UserChannelPermissions(userID, channelID, options...)
+}
@@ -0,0 +1,376 @@
+package bot
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/store"
+)
+
+const (
+	// How long a conversation stays locked when the instance answering there
+	// stops without releasing it, and how often others try to take the lock
+	sessionLockTTL   = 2 * time.Minute
+	sessionLockRetry = 200 * time.Millisecond
+)
+
+// How often the instance answering in a conversation renews its lock, well
+// before it expires (replaced in tests)
+var sessionLockRefresh = sessionLockTTL / 3
+
+// chatActivity is when a chat last answered a message and for whom, so the
+// summary of an idle chat is billed like the conversation it ends
+type chatActivity struct {
+	at      time.Time
+	userID  string
+	guildID string
+}
+
+// touchChat records that a chat answered a user's message
+func (b *Bot) touchChat(chat ai.Chat, userID string, guildID string) {
+	b.sessionsMu.Lock()
+	defer b.sessionsMu.Unlock()
+
+	b.chatActivity[chat] = chatActivity{at: time.Now(), userID: userID, guildID: guildID}
+}
+
+// expireIdleChats replaces the history of chats idle for longer than the
+// configured timeout with a summary of it, freeing the memory it held. The
+// next answer in each of them says a fresh conversation started.
+func (b *Bot) expireIdleChats(now time.Time) {
+	timeout := b.config().SessionIdleTimeout
+	if timeout <= 0 {
+		return
+	}
+
+	b.sessionsMu.Lock()
+	idle := map[ai.Chat]chatActivity{}
+	for chat, activity := range b.chatActivity {
+		if now.Sub(activity.at) >= timeout {
+			idle[chat] = activity
+			delete(b.chatActivity, chat)
+		}
+	}
+	b.sessionsMu.Unlock()
+
+	for chat, activity := range idle {
+		// Chats replaced by /clear, or of deleted threads and profiles, are
+		// already gone
+		history := chat.History()
+		if !b.isLiveChat(chat) || len(history) == 0 {
+			continue
+		}
+
+		summary, err := b.summarizeHistory(activity.userID, activity.guildID, history)
+		if err != nil {
+			slog.Error("Error summarizing idle chat", "guild", activity.guildID, "error", err)
+			summary = nil
+		}
+
+		b.sessionsMu.Lock()
+		// Leave chats alone that answered while the summary was written
+		if _, active := b.chatActivity[chat]; !active && len(chat.History()) == len(history) {
+			chat.SetHistory(summary)
+			b.forgetLastTurn(chat)
+			b.expiredChats[chat] = summary != nil
+			slog.Info("Expired idle chat", "guild", activity.guildID, "entries", len(history), "idle", now.Sub(activity.at).Round(time.Minute))
+		}
+		b.sessionsMu.Unlock()
+	}
+}
+
+// isLiveChat reports whether a chat is still one the bot answers in
+func (b *Bot) isLiveChat(chat ai.Chat) bool {
+	b.chatsMu.Lock()
+	defer b.chatsMu.Unlock()
+
+	for _, chats := range []map[string]ai.Chat{b.sharedChats, b.threadChats, b.profileChats} {
+		for _, live := range chats {
+			if live == chat {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expiryNotice returns the note starting an answer in a chat that expired
+// since it last answered, once, or "" when it didn't
+func (b *Bot) expiryNotice(chat ai.Chat) string {
+	b.sessionsMu.Lock()
+	defer b.sessionsMu.Unlock()
+
+	summarized, expired := b.expiredChats[chat]
+	if !expired {
+		return ""
+	}
+	delete(b.expiredChats, chat)
+	notice := "-# Started a fresh conversation after a while without messages"
+	if summarized {
+		notice += ", keeping a summary of the last one"
+	}
+	return notice + ".\n"
+}
+
+// savedContent is an entry of a chat's history as its session is saved, with
+// one of the fields of each part set
+type savedContent struct {
+	Role  string      `json:"role"`
+	Parts []savedPart `json:"parts"`
+}
+
+type savedPart struct {
+	Text     string                  `json:"text,omitempty"`
+	Blob     *genai.Blob             `json:"blob,omitempty"`
+	File     *genai.FileData         `json:"file,omitempty"`
+	Call     *genai.FunctionCall     `json:"call,omitempty"`
+	Response *genai.FunctionResponse `json:"response,omitempty"`
+}
+
+// encodeHistory encodes a chat's history for its saved session
+func encodeHistory(history []*genai.Content) ([]byte, error) {
+	saved := make([]savedContent, 0, len(history))
+	for _, content := range history {
+		entry := savedContent{Role: content.Role, Parts: []savedPart{}}
+		for _, part := range content.Parts {
+			switch p := part.(type) {
+			case genai.Text:
+				entry.Parts = append(entry.Parts, savedPart{Text: string(p)})
+			case genai.Blob:
+				entry.Parts = append(entry.Parts, savedPart{Blob: &p})
+			case genai.FileData:
+				entry.Parts = append(entry.Parts, savedPart{File: &p})
+			case genai.FunctionCall:
+				entry.Parts = append(entry.Parts, savedPart{Call: &p})
+			case genai.FunctionResponse:
+				entry.Parts = append(entry.Parts, savedPart{Response: &p})
+			}
+		}
+		saved = append(saved, entry)
+	}
+	return json.Marshal(saved)
+}
+
+// decodeHistory decodes the history of a saved session
+func decodeHistory(data []byte) ([]*genai.Content, error) {
+	var saved []savedContent
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	history := make([]*genai.Content, 0, len(saved))
+	for _, entry := range saved {
+		content := &genai.Content{Role: entry.Role}
+		for _, part := range entry.Parts {
+			switch {
+			case part.Blob != nil:
+				content.Parts = append(content.Parts, *part.Blob)
+			case part.File != nil:
+				content.Parts = append(content.Parts, *part.File)
+			case part.Call != nil:
+				content.Parts = append(content.Parts, *part.Call)
+			case part.Response != nil:
+				content.Parts = append(content.Parts, *part.Response)
+			default:
+				content.Parts = append(content.Parts, genai.Text(part.Text))
+			}
+		}
+		history = append(history, content)
+	}
+	return history, nil
+}
+
+// sessionKey returns the key a chat's session is saved under, which names
+// the shared chat of a provider, a thread or a conversation profile, or ""
+// for a chat the bot no longer answers in
+func (b *Bot) sessionKey(chat ai.Chat) string {
+	b.chatsMu.Lock()
+	defer b.chatsMu.Unlock()
+
+	for name, live := range b.sharedChats {
+		if live == chat {
+			return "shared:" + name
+		}
+	}
+	for threadID, live := range b.threadChats {
+		if live == chat {
+			return "thread:" + threadID
+		}
+	}
+	for key, live := range b.profileChats {
+		if live == chat {
+			return "profile:" + key
+		}
+	}
+	return ""
+}
+
+// saveSession saves a chat's history, so it carries on after a restart and
+// other instances sharing the backend can pick it up. It expires with the
+// idle timeout.
+func (b *Bot) saveSession(chat ai.Chat) {
+	key := b.sessionKey(chat)
+	if key == "" {
+		return
+	}
+	data, err := encodeHistory(chat.History())
+	if err == nil {
+		err = b.state().SaveSession(key, data, b.config().SessionIdleTimeout)
+	}
+	if err != nil {
+		slog.Error("Error saving session", "session", key, "error", err)
+	}
+}
+
+// restoredChat starts a chat with the history saved under key, if there is
+// one
+func (b *Bot) restoredChat(client ai.Client, key string) ai.Chat {
+	chat := client.NewChat()
+	if history, _ := b.loadSession(key); history != nil {
+		chat.SetHistory(history)
+	}
+	return chat
+}
+
+// loadSession returns the history saved under key, or nil when there's none
+func (b *Bot) loadSession(key string) ([]*genai.Content, error) {
+	data, err := b.state().Session(key)
+	if err != nil {
+		slog.Error("Error loading session", "session", key, "error", err)
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+	history, err := decodeHistory(data)
+	if err != nil {
+		slog.Error("Error decoding session", "session", key, "error", err)
+		return nil, err
+	}
+	return history, nil
+}
+
+// chatLock is the lock of a chat, and how many answers hold it or wait for
+// it so it's forgotten once none do
+type chatLock struct {
+	sync.Mutex
+	users int
+}
+
+// lockChat takes the lock of a chat, waiting while another answer is given
+// in it, such as in another channel sharing the provider's chat, through the
+// API or for an edit. It returns the function that releases the lock.
+func (b *Bot) lockChat(chat ai.Chat) func() {
+	b.sessionsMu.Lock()
+	lock := b.chatLocks[chat]
+	if lock == nil {
+		lock = &chatLock{}
+		b.chatLocks[chat] = lock
+	}
+	lock.users++
+	b.sessionsMu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		b.sessionsMu.Lock()
+		defer b.sessionsMu.Unlock()
+		if lock.users--; lock.users == 0 {
+			delete(b.chatLocks, chat)
+		}
+	}
+}
+
+// lockSession takes the lock of a chat, and of its conversation when the
+// backend is shared with other instances, waiting while one of them answers
+// there, and reloads the history they may have changed. It returns the
+// function that releases the locks, once the answer's session is saved.
+func (b *Bot) lockSession(chat ai.Chat) func() {
+	unlockChat := b.lockChat(chat)
+	key := b.sessionKey(chat)
+	if b.backend == nil || key == "" {
+		return unlockChat
+	}
+	unlock := unlockChat
+	if locker, ok := b.backend.(store.Locker); ok {
+		if token := waitSessionLock(locker, key); token != "" {
+			stopRefreshing := keepSessionLock(locker, key, token)
+			unlock = func() {
+				stopRefreshing()
+				if err := locker.UnlockSession(key, token); err != nil {
+					slog.Error("Error unlocking session", "session", key, "error", err)
+				}
+				unlockChat()
+			}
+		}
+	}
+	if history, err := b.loadSession(key); err == nil {
+		chat.SetHistory(history)
+	}
+	return unlock
+}
+
+// waitSessionLock takes the lock of a conversation, trying again while
+// another instance holds it. It gives up, returning "", when the backend
+// fails or the lock outlasts its TTL, answering without it rather than not
+// at all.
+func waitSessionLock(locker store.Locker, key string) string {
+	deadline := time.Now().Add(sessionLockTTL)
+	for {
+		token, err := locker.LockSession(key, sessionLockTTL)
+		if err != nil {
+			slog.Error("Error locking session", "session", key, "error", err)
+			return ""
+		}
+		if token != "" {
+			return token
+		}
+		if time.Now().After(deadline) {
+			slog.Warn("Timed out waiting for session lock", "session", key)
+			return ""
+		}
+		time.Sleep(sessionLockRetry)
+	}
+}
+
+// keepSessionLock renews the lock of a conversation while an answer takes,
+// so a slow one isn't joined by another instance once the TTL runs out. It
+// returns the function that stops renewing it.
+func keepSessionLock(locker store.Locker, key string, token string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(sessionLockRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			held, err := locker.RefreshSession(key, token, sessionLockTTL)
+			if err != nil {
+				slog.Error("Error renewing session lock", "session", key, "error", err)
+			} else if !held {
+				slog.Warn("Lost session lock", "session", key)
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// deleteSession forgets the history saved under key
+func (b *Bot) deleteSession(key string) {
+	if err := b.state().DeleteSession(key); err != nil {
+		slog.Error("Error deleting session", "session", key, "error", err)
+	}
+}
@@ -0,0 +1,215 @@
+package bot
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/store"
+)
+
+// withIdleTimeout sets the bot's session idle timeout
+func withIdleTimeout(b *Bot, timeout time.Duration) {
+	cfg := *b.config()
+	cfg.SessionIdleTimeout = timeout
+	b.SetConfig(&cfg)
+}
+
+func TestExpireIdleChats(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello"}}, text: "They said hi."}
+	b, session := newTestBot(t, client)
+	withIdleTimeout(b, time.Hour)
+
+	b.HandleMessage(userMessage("hi"))
+	chat := b.chatFor("channel", "guild")
+
+	// Chats answered recently are kept
+	b.expireIdleChats(time.Now().Add(30 * time.Minute))
+	if len(chat.History()) != 2 || len(client.prompts) != 0 {
+		t.Fatalf("history after 30 minutes = %d entries, %d summaries, want it untouched", len(chat.History()), len(client.prompts))
+	}
+
+	b.expireIdleChats(time.Now().Add(2 * time.Hour))
+	history := chat.History()
+	if len(history) != 2 || !strings.HasSuffix(partsText(history[0].Parts), "They said hi.") {
+		t.Fatalf("history after 2 hours = %v, want the summary", history)
+	}
+
+	// The next answer says the conversation started afresh, once
+	b.HandleMessage(userMessage("again"))
+	b.HandleMessage(userMessage("and again"))
+	if len(session.messages) != 3 {
+		t.Fatalf("sent %q, want 3 answers", session.messages)
+	}
+	if want := "-# Started a fresh conversation after a while without messages, keeping a summary of the last one.\nhello"; session.messages[1] != want {
+		t.Errorf("answer after expiry = %q, want %q", session.messages[1], want)
+	}
+	if session.messages[2] != "hello" {
+		t.Errorf("second answer after expiry = %q, want no notice", session.messages[2])
+	}
+}
+
+func TestExpireIdleChatsSkipsClearedAndDisabled(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello"}}, text: "summary"}
+	b, _ := newTestBot(t, client)
+
+	b.HandleMessage(userMessage("hi"))
+	chat := b.chatFor("channel", "guild")
+
+	// Off when the timeout is 0
+	b.expireIdleChats(time.Now().Add(48 * time.Hour))
+	if len(chat.History()) != 2 || len(client.prompts) != 0 {
+		t.Errorf("expired a chat with the timeout off")
+	}
+
+	// Chats replaced by /clear aren't summarized
+	withIdleTimeout(b, time.Hour)
+	b.HandleInteraction(commandInteraction("clear"))
+	b.expireIdleChats(time.Now().Add(2 * time.Hour))
+	if len(client.prompts) != 0 {
+		t.Errorf("summarized a cleared chat: %v", client.prompts)
+	}
+}
+
+func TestSavedSessions(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello"}}}
+	b, session := newTestBot(t, client)
+	b.HandleMessage(userMessage("hi"))
+
+	// A bot started on the same database carries on the conversation
+	restarted := New(context.Background(), b.config(), session, client, b.store)
+	history := restarted.chatFor("channel", "guild").History()
+	if len(history) != 2 || partsText(history[0].Parts) != partsText(b.chatFor("channel", "guild").History()[0].Parts) ||
+		partsText(history[1].Parts) != "hello" {
+		t.Fatalf("restored history = %v, want the prompt and answer", history)
+	}
+
+	// Clearing the conversation deletes its session
+	restarted.resetChat("channel", "guild")
+	if history := New(context.Background(), b.config(), session, client, b.store).chatFor("channel", "guild").History(); len(history) != 0 {
+		t.Errorf("history after /clear = %v, want none", history)
+	}
+}
+
+// lockingStore is a shared backend recording the locks taken on it
+type lockingStore struct {
+	*store.Store
+	locks     []string
+	unlocked  []string
+	refreshed atomic.Int32
+}
+
+func (s *lockingStore) LockSession(key string, _ time.Duration) (string, error) {
+	s.locks = append(s.locks, key)
+	return "token", nil
+}
+
+func (s *lockingStore) RefreshSession(key string, token string, _ time.Duration) (bool, error) {
+	s.refreshed.Add(1)
+	return true, nil
+}
+
+func (s *lockingStore) UnlockSession(key string, token string) error {
+	s.unlocked = append(s.unlocked, key+" "+token)
+	return nil
+}
+
+func TestSharedSessions(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello"}}}
+	first, session := newTestBot(t, client)
+	backend := &lockingStore{Store: first.store}
+	first.SetBackend(backend)
+	second := New(context.Background(), first.config(), session, client, first.store)
+	second.SetBackend(backend)
+
+	// Each instance answers with the history the other one saved
+	second.chatFor("channel", "guild")
+	first.HandleMessage(userMessage("hi"))
+	second.HandleMessage(userMessage("again"))
+	if history := second.chatFor("channel", "guild").History(); len(history) != 4 {
+		t.Errorf("history = %v, want both exchanges", history)
+	}
+	if want := []string{"shared:gemini", "shared:gemini"}; !slices.Equal(backend.locks, want) {
+		t.Errorf("locked %q, want %q", backend.locks, want)
+	}
+	if want := []string{"shared:gemini token", "shared:gemini token"}; !slices.Equal(backend.unlocked, want) {
+		t.Errorf("unlocked %q, want %q", backend.unlocked, want)
+	}
+}
+
+func TestSessionLockRefresh(t *testing.T) {
+	b, _ := newTestBot(t, &fakeAI{})
+	backend := &lockingStore{Store: b.store}
+	b.SetBackend(backend)
+	refresh := sessionLockRefresh
+	sessionLockRefresh = 10 * time.Millisecond
+	t.Cleanup(func() { sessionLockRefresh = refresh })
+
+	// The lock is renewed while an answer takes, and no longer once released
+	unlock := b.lockSession(b.chatFor("channel", "guild"))
+	time.Sleep(50 * time.Millisecond)
+	unlock()
+	refreshed := backend.refreshed.Load()
+	if refreshed == 0 {
+		t.Error("the lock wasn't renewed while held")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if got := backend.refreshed.Load(); got != refreshed {
+		t.Errorf("renewed %d times after release", got-refreshed)
+	}
+}
+
+func TestLockSession(t *testing.T) {
+	b, _ := newTestBot(t, &fakeAI{})
+
+	// Channels share the provider's chat, so an answer in one waits for the
+	// answer in another even without a shared backend
+	chat := b.chatFor("channel", "guild")
+	if other := b.chatFor("other", "guild"); other != chat {
+		t.Fatalf("chatFor(other) = %p, want the shared chat %p", other, chat)
+	}
+	unlock := b.lockSession(chat)
+	locked := make(chan struct{})
+	go func() {
+		b.lockSession(b.chatFor("other", "guild"))()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("the chat was locked twice at once")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+
+	if len(b.chatLocks) != 0 {
+		t.Errorf("chatLocks = %v, want them forgotten once released", b.chatLocks)
+	}
+}
+
+func TestHistoryEncoding(t *testing.T) {
+	history := []*genai.Content{
+		{Role: "user", Parts: []genai.Part{genai.Text("What's in this?"), genai.Blob{MIMEType: "image/png", Data: []byte{1, 2}}}},
+		{Role: "model", Parts: []genai.Part{genai.FunctionCall{Name: "remember", Args: map[string]any{"fact": "likes cats"}}}},
+		{Role: "user", Parts: []genai.Part{genai.FunctionResponse{Name: "remember", Response: map[string]any{"ok": true}}}},
+		{Role: "model", Parts: []genai.Part{genai.Text("A cat.")}},
+	}
+	data, err := encodeHistory(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeHistory(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, history) {
+		t.Errorf("decodeHistory(encodeHistory(history)) = %v, want %v", got, history)
+	}
+}
@@ -0,0 +1,598 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/i18n"
+	"go-discord-bot/metrics"
+	"go-discord-bot/store"
+)
+
+// Trigger modes: which messages the bot answers in a server
+const (
+	// Every message in the channels it may answer in
+	triggerAll = "all"
+	// Messages mentioning or replying to the bot, and those in its threads
+	triggerMention = "mention"
+	// None, the server only uses slash commands
+	triggerCommands = "commands"
+)
+
+const (
+	// Custom IDs of the /settings components all start with settingsPrefix
+	settingsPrefix       = "settings-"
+	settingsTriggerID    = "settings-trigger"
+	settingsSafetyID     = "settings-safety"
+	settingsNSFWSafetyID = "settings-nsfw-safety"
+	settingsChannelsID   = "settings-channels"
+	settingsEditID       = "settings-edit"
+	settingsSpoilersID   = "settings-spoilers"
+	settingsScrubID      = "settings-scrub"
+	settingsPollsID      = "settings-polls"
+	settingsResetID      = "settings-reset"
+	settingsModalID      = "settings-modal"
+
+	// Safety levels blocking nothing and following the bot's default, as
+	// select values can't be empty
+	safetyOff     = "off"
+	safetyDefault = "default"
+
+	// Safety levels of guilds that set none: stricter outside NSFW channels
+	defaultSafety     = "medium"
+	defaultNSFWSafety = safetyOff
+
+	// Highest per-member rate limit, in messages a minute
+	maxRateLimit = 60
+
+	// Once the rate windows of this many members are tracked, expired ones
+	// are dropped
+	maxRateWindows = 1000
+)
+
+// triggerLabels describe the trigger modes in /settings
+var triggerLabels = map[string]string{
+	triggerAll:      "Every message",
+	triggerMention:  "Mentions and replies only",
+	triggerCommands: "Slash commands only",
+}
+
+// rateWindow counts a member's answered messages in the current minute
+type rateWindow struct {
+	start  time.Time
+	count  int
+	warned bool
+}
+
+// guildSettings returns a guild's settings, or the defaults for DMs and
+// guilds that never changed them
+func (b *Bot) guildSettings(guildID string) store.GuildSettings {
+	defaults := store.GuildSettings{GuildID: guildID, Trigger: triggerAll}
+	if guildID == "" {
+		return defaults
+	}
+
+	b.settingsMu.Lock()
+	defer b.settingsMu.Unlock()
+
+	if settings, ok := b.settings[guildID]; ok {
+		return settings
+	}
+	settings, err := b.state().GuildSettings(guildID)
+	if err != nil {
+		slog.Error("Error loading server settings", "guild", guildID, "error", err)
+		return defaults
+	}
+	if settings == nil {
+		settings = &defaults
+	}
+	// Other instances may change the settings kept in a shared backend
+	if b.backend == nil {
+		b.settings[guildID] = *settings
+	}
+	return *settings
+}
+
+// saveGuildSettings stores a guild's settings, or resets them when settings
+// is nil
+func (b *Bot) saveGuildSettings(guildID string, settings *store.GuildSettings) error {
+	var err error
+	if settings == nil {
+		err = b.state().DeleteGuildSettings(guildID)
+	} else {
+		err = b.state().SetGuildSettings(*settings)
+	}
+
+	b.settingsMu.Lock()
+	delete(b.settings, guildID)
+	b.settingsMu.Unlock()
+	return err
+}
+
+// requestContext returns the context of requests made for a guild's
+// channel, which use the guild's model and the safety level of the channel.
+// Requests made outside a channel, such as one-off prompts, use the level
+// of channels not marked NSFW.
+func (b *Bot) requestContext(guildID string, channelID string) context.Context {
+	settings := b.guildSettings(guildID)
+	safety := b.safetyLevel(settings, channelID)
+	if settings.Model == "" && safety == "" {
+		return b.ctx
+	}
+	return ai.WithRequestOptions(b.ctx, ai.RequestOptions{Model: settings.Model, Safety: safety})
+}
+
+// safetyLevel returns the level responses are blocked at in a channel, ""
+// to block nothing: the guild's NSFW level in channels marked NSFW and
+// their threads, and its other level everywhere else, each falling back to
+// the bot's default
+func (b *Bot) safetyLevel(settings store.GuildSettings, channelID string) string {
+	level, fallback := settings.Safety, defaultSafety
+	if channelID != "" && b.isNSFWChannel(channelID) {
+		level, fallback = settings.NSFWSafety, defaultNSFWSafety
+	}
+	if level == "" {
+		level = fallback
+	}
+	if level == safetyOff {
+		return ""
+	}
+	return level
+}
+
+// withSpoilers reports whether a guild hides a reply behind spoiler tags,
+// which it does for answers the model rated possibly harmful but didn't
+// block when the guild asks for it
+func withSpoilers(settings store.GuildSettings, reply *ai.Reply) bool {
+	return settings.Spoilers && reply.Text != "" && len(reply.SafetyFlags) > 0
+}
+
+// withGuildSettings prepends a guild's persona and answer language to a
+// message's parts. Without a language set for the guild, the answer is in
+// the language the message's text is written in, when it can be told.
+func withGuildSettings(settings store.GuildSettings, text string, parts []genai.Part) []genai.Part {
+	var instructions []string
+	if settings.Persona != "" {
+		instructions = append(instructions, "In this server, act as follows: "+settings.Persona)
+	}
+	if settings.Language != "" {
+		instructions = append(instructions, fmt.Sprintf("Always answer in %s.", settings.Language))
+	} else if language := i18n.DetectLanguage(text); language != "" {
+		instructions = append(instructions, fmt.Sprintf("The message is in %s, answer in %s unless asked otherwise.", language, language))
+	}
+	if len(instructions) == 0 {
+		return parts
+	}
+	return append([]genai.Part{genai.Text(strings.Join(instructions, "\n"))}, parts...)
+}
+
+// triggers reports whether a guild's trigger mode and allowed channels let
+// the bot answer a message
+func (b *Bot) triggers(m *discordgo.MessageCreate, settings store.GuildSettings) bool {
+	if m.GuildID == "" {
+		return true
+	}
+
+	switch settings.Trigger {
+	case triggerCommands:
+		return false
+	case triggerMention:
+		autoAnswered := b.config().ForumAutoAnswer && b.openingPost(m.Message)
+		if !b.addressed(m) && !autoAnswered {
+			return false
+		}
+	}
+
+	if len(settings.AllowedChannels) == 0 || slices.Contains(settings.AllowedChannels, m.ChannelID) {
+		return true
+	}
+	// Threads follow the channel they were started in
+	channel, err := b.session.Channel(m.ChannelID)
+	return err == nil && channel.ParentID != "" && slices.Contains(settings.AllowedChannels, channel.ParentID)
+}
+
+// addressed reports whether a message mentions or replies to the bot, or
+// was posted in one of its threads
+func (b *Bot) addressed(m *discordgo.MessageCreate) bool {
+	botID := b.session.BotUserID()
+	for _, user := range m.Mentions {
+		if user.ID == botID {
+			return true
+		}
+	}
+	if m.ReferencedMessage != nil && m.ReferencedMessage.Author != nil && m.ReferencedMessage.Author.ID == botID {
+		return true
+	}
+
+	b.chatsMu.Lock()
+	defer b.chatsMu.Unlock()
+	_, ok := b.threadChats[m.ChannelID]
+	return ok
+}
+
+// rateLimited counts a message towards its author's rate limit in the
+// guild, reporting whether they are over it. The first message over the
+// limit in a minute gets a warning, later ones are ignored silently.
+func (b *Bot) rateLimited(m *discordgo.MessageCreate, settings store.GuildSettings) bool {
+	limited, warn, wait := b.countRate(m.GuildID, m.Author.ID, settings.RateLimit)
+	if !limited {
+		return false
+	}
+	if warn {
+		b.session.ChannelMessageSend(m.ChannelID, b.trGuild(m.GuildID, "<@%s> slow down a little, this server's limit is %d a minute per member. Try again in %d seconds.",
+			m.Author.ID, settings.RateLimit, int(wait.Seconds())+1))
+	}
+	return true
+}
+
+// countRate counts a request towards a user's limit of requests a minute in
+// a guild, no limit when 0. It reports whether they are over it, whether
+// it's the first time this minute and how long until the minute is over.
+func (b *Bot) countRate(guildID string, userID string, limit int) (bool, bool, time.Duration) {
+	if limit == 0 {
+		return false, false, 0
+	}
+
+	now := time.Now()
+	key := guildID + ":" + userID
+	b.rateMu.Lock()
+	if len(b.rateWindows) >= maxRateWindows {
+		for key, window := range b.rateWindows {
+			if now.Sub(window.start) >= time.Minute {
+				delete(b.rateWindows, key)
+			}
+		}
+	}
+	window := b.rateWindows[key]
+	if window == nil || now.Sub(window.start) >= time.Minute {
+		window = &rateWindow{start: now}
+		b.rateWindows[key] = window
+	}
+	window.count++
+	limited, first := window.count > limit, !window.warned
+	if limited {
+		window.warned = true
+	}
+	wait := window.start.Add(time.Minute).Sub(now)
+	b.rateMu.Unlock()
+
+	if limited {
+		metrics.RateLimitRejections.WithLabelValues("member").Inc()
+	}
+	return limited, limited && first, wait
+}
+
+// settingsCommand handles /settings, showing the server's settings with
+// menus to change them, after setting the answer length when given. It
+// needs the Manage Server permission.
+func (b *Bot) settingsCommand(i *discordgo.InteractionCreate) {
+	if !b.canChangeSettings(i) {
+		return
+	}
+	settings := b.guildSettings(i.GuildID)
+	if option := commandOption(i.ApplicationCommandData().Options, "length"); option != nil {
+		settings.Verbosity = option.StringValue()
+		if settings.Verbosity == verbosityNormal {
+			settings.Verbosity = ""
+		}
+		if err := b.saveGuildSettings(i.GuildID, &settings); err != nil {
+			interactionLogger(i).Error("Error saving server settings", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+		interactionLogger(i).Info("Changed server settings", "verbosity", settings.Verbosity)
+	}
+	data := b.settingsResponse(settings)
+	data.Flags = discordgo.MessageFlagsEphemeral
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to settings command", "error", err)
+	}
+}
+
+// canChangeSettings checks that an interaction comes from a server member
+// with the Manage Server permission, telling them otherwise
+func (b *Bot) canChangeSettings(i *discordgo.InteractionCreate) bool {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Settings only exist in servers."))
+		return false
+	}
+	if i.Member == nil || i.Member.Permissions&discordgo.PermissionManageServer == 0 {
+		b.respondEphemeral(i, tr(i, "You need the Manage Server permission to change the bot's settings."))
+		return false
+	}
+	return true
+}
+
+// settingsComponent applies a change made with a /settings menu or button
+func (b *Bot) settingsComponent(i *discordgo.InteractionCreate) {
+	if !b.canChangeSettings(i) {
+		return
+	}
+	data := i.MessageComponentData()
+	settings := b.guildSettings(i.GuildID)
+
+	switch data.CustomID {
+	case settingsTriggerID:
+		if len(data.Values) == 0 || triggerLabels[data.Values[0]] == "" {
+			return
+		}
+		settings.Trigger = data.Values[0]
+	case settingsSafetyID, settingsNSFWSafetyID:
+		if len(data.Values) == 0 {
+			return
+		}
+		level := data.Values[0]
+		if level != safetyOff && !slices.Contains(ai.SafetyLevels, level) {
+			level = ""
+		}
+		if data.CustomID == settingsSafetyID {
+			settings.Safety = level
+		} else {
+			settings.NSFWSafety = level
+		}
+	case settingsSpoilersID:
+		settings.Spoilers = !settings.Spoilers
+	case settingsScrubID:
+		settings.ScrubPII = !settings.ScrubPII
+	case settingsPollsID:
+		settings.PollsDisabled = !settings.PollsDisabled
+	case settingsChannelsID:
+		settings.AllowedChannels = data.Values
+	case settingsEditID:
+		b.openSettingsModal(i, settings)
+		return
+	case settingsResetID:
+		b.updateSettings(i, nil)
+		return
+	default:
+		return
+	}
+	b.updateSettings(i, &settings)
+}
+
+// openSettingsModal opens the form for the settings typed in as text
+func (b *Bot) openSettingsModal(i *discordgo.InteractionCreate, settings store.GuildSettings) {
+	rateLimit := ""
+	if settings.RateLimit > 0 {
+		rateLimit = strconv.Itoa(settings.RateLimit)
+	}
+	input := func(id, label, value, placeholder string, style discordgo.TextInputStyle, maxLength int) discordgo.MessageComponent {
+		return discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.TextInput{CustomID: id, Label: label, Value: value, Placeholder: placeholder, Style: style, MaxLength: maxLength},
+		}}
+	}
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: settingsModalID,
+			Title:    "Server settings",
+			Components: []discordgo.MessageComponent{
+				input("persona", "Persona", settings.Persona, "How the bot should act here, empty for none", discordgo.TextInputParagraph, 1000),
+				input("language", "Answer language", settings.Language, "Like French, empty to follow each member", discordgo.TextInputShort, 50),
+				input("model", "Gemini model", settings.Model, b.modelName(), discordgo.TextInputShort, 100),
+				input("rate_limit", "Messages per member per minute", rateLimit, "Empty for no limit", discordgo.TextInputShort, 2),
+				input("attachment_limits", "Attachment limits", formatAttachmentLimits(settings), "Like 10 minutes, 50 pages; empty for the defaults", discordgo.TextInputShort, 50),
+			},
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error opening settings modal", "error", err)
+	}
+}
+
+// settingsModal applies the settings submitted with the /settings form
+func (b *Bot) settingsModal(i *discordgo.InteractionCreate) {
+	if !b.canChangeSettings(i) {
+		return
+	}
+	data := i.ModalSubmitData()
+
+	rateLimit := 0
+	if value := strings.TrimSpace(modalTextValue(data, "rate_limit")); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > maxRateLimit {
+			b.respondEphemeral(i, tr(i, "The rate limit must be a number of messages from 1 to %d, or empty for no limit.", maxRateLimit))
+			return
+		}
+		rateLimit = n
+	}
+	maxMinutes, maxPages, ok := parseAttachmentLimits(modalTextValue(data, "attachment_limits"))
+	if !ok {
+		b.respondEphemeral(i, tr(i, "Write the attachment limits like \"10 minutes, 50 pages\", or leave them empty for the defaults."))
+		return
+	}
+
+	settings := b.guildSettings(i.GuildID)
+	settings.Persona = strings.TrimSpace(modalTextValue(data, "persona"))
+	settings.Language = strings.TrimSpace(modalTextValue(data, "language"))
+	settings.Model = strings.TrimSpace(modalTextValue(data, "model"))
+	settings.RateLimit = rateLimit
+	settings.MaxMediaMinutes, settings.MaxPDFPages = maxMinutes, maxPages
+	b.updateSettings(i, &settings)
+}
+
+// updateSettings saves or, when settings is nil, resets the server's
+// settings and shows the result in the /settings message
+func (b *Bot) updateSettings(i *discordgo.InteractionCreate, settings *store.GuildSettings) {
+	if err := b.saveGuildSettings(i.GuildID, settings); err != nil {
+		interactionLogger(i).Error("Error saving server settings", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	current := b.guildSettings(i.GuildID)
+	interactionLogger(i).Info("Changed server settings",
+		"trigger", current.Trigger,
+		"model", current.Model,
+		"safety", current.Safety,
+		"allowed_channels", len(current.AllowedChannels),
+		"rate_limit", current.RateLimit,
+		"max_media_minutes", current.MaxMediaMinutes,
+		"max_pdf_pages", current.MaxPDFPages,
+		"language", current.Language,
+		"verbosity", current.Verbosity,
+	)
+
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: b.settingsResponse(current),
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error updating settings message", "error", err)
+	}
+}
+
+// settingsResponse shows a guild's settings with the menus changing them
+func (b *Bot) settingsResponse(settings store.GuildSettings) *discordgo.InteractionResponseData {
+	orDefault := func(value, fallback string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	}
+	channels := "All channels"
+	if len(settings.AllowedChannels) > 0 {
+		mentions := make([]string, len(settings.AllowedChannels))
+		for n, channelID := range settings.AllowedChannels {
+			mentions[n] = fmt.Sprintf("<#%s>", channelID)
+		}
+		channels = strings.Join(mentions, " ")
+	}
+	rateLimit := "No limit"
+	if settings.RateLimit > 0 {
+		rateLimit = fmt.Sprintf("%d messages a minute per member", settings.RateLimit)
+	}
+
+	spoilers := "Off"
+	if settings.Spoilers {
+		spoilers = "Possibly harmful answers are hidden"
+	}
+	personalInfo := "Sent as written"
+	if settings.ScrubPII {
+		personalInfo = "Emails, phone numbers, tokens and invites are redacted"
+	}
+	polls := "Members can write polls with /poll"
+	if settings.PollsDisabled {
+		polls = "Off"
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Server settings",
+		Description: "Change them with the menus below. The model and safety level apply when the server uses Gemini.",
+		Color:       embedColor,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Answers", Value: triggerLabels[settings.Trigger], Inline: true},
+			{Name: "Model", Value: orDefault(settings.Model, "Default ("+b.modelName()+")"), Inline: true},
+			{Name: "Safety", Value: safetyLabel(settings.Safety, defaultSafety), Inline: true},
+			{Name: "Safety in NSFW channels", Value: safetyLabel(settings.NSFWSafety, defaultNSFWSafety), Inline: true},
+			{Name: "Spoilers", Value: spoilers, Inline: true},
+			{Name: "Personal info", Value: personalInfo, Inline: true},
+			{Name: "Polls", Value: polls, Inline: true},
+			{Name: "Channels", Value: channels},
+			{Name: "Rate limit", Value: rateLimit, Inline: true},
+			{Name: "Language", Value: orDefault(settings.Language, "Each member's"), Inline: true},
+			{Name: "Answer length", Value: verbosityLabel(settings.Verbosity) + " (change it with `/settings length`)", Inline: true},
+			{Name: "Attachments", Value: b.attachmentLimitsText(settings)},
+			{Name: "Persona", Value: truncate(orDefault(settings.Persona, "None"), 1024)},
+		},
+	}
+
+	triggerOptions := make([]discordgo.SelectMenuOption, 0, len(triggerLabels))
+	for _, mode := range []string{triggerAll, triggerMention, triggerCommands} {
+		triggerOptions = append(triggerOptions, discordgo.SelectMenuOption{
+			Label: triggerLabels[mode], Value: mode, Default: mode == settings.Trigger,
+		})
+	}
+	channelDefaults := make([]discordgo.SelectMenuDefaultValue, len(settings.AllowedChannels))
+	for n, channelID := range settings.AllowedChannels {
+		channelDefaults[n] = discordgo.SelectMenuDefaultValue{ID: channelID, Type: discordgo.SelectMenuDefaultValueChannel}
+	}
+	noChannels := 0
+	spoilersLabel := "Hide harmful answers in spoilers"
+	if settings.Spoilers {
+		spoilersLabel = "Stop using spoilers"
+	}
+	scrubLabel := "Redact personal info"
+	if settings.ScrubPII {
+		scrubLabel = "Stop redacting personal info"
+	}
+	pollsLabel := "Turn off polls"
+	if settings.PollsDisabled {
+		pollsLabel = "Turn on polls"
+	}
+
+	return &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{CustomID: settingsTriggerID, Placeholder: "Which messages to answer", Options: triggerOptions},
+			}},
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{CustomID: settingsSafetyID, Placeholder: "Safety level", Options: safetyOptions(settings.Safety, defaultSafety)},
+			}},
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{CustomID: settingsNSFWSafetyID, Placeholder: "Safety level in NSFW channels", Options: safetyOptions(settings.NSFWSafety, defaultNSFWSafety)},
+			}},
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					MenuType:      discordgo.ChannelSelectMenu,
+					CustomID:      settingsChannelsID,
+					Placeholder:   "Channels to answer in, all when none are picked",
+					ChannelTypes:  []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+					DefaultValues: channelDefaults,
+					MinValues:     &noChannels,
+					MaxValues:     25,
+				},
+			}},
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{CustomID: settingsEditID, Label: "Persona, language, model and limits", Style: discordgo.PrimaryButton},
+				discordgo.Button{CustomID: settingsSpoilersID, Label: spoilersLabel, Style: discordgo.SecondaryButton},
+				discordgo.Button{CustomID: settingsScrubID, Label: scrubLabel, Style: discordgo.SecondaryButton},
+				discordgo.Button{CustomID: settingsPollsID, Label: pollsLabel, Style: discordgo.SecondaryButton},
+				discordgo.Button{CustomID: settingsResetID, Label: "Reset", Style: discordgo.DangerButton},
+			}},
+		},
+	}
+}
+
+// safetyLabel describes a guild's safety level, which falls back to a
+// default when empty
+func safetyLabel(level string, fallback string) string {
+	if level == "" {
+		return safetyLabel(fallback, "") + " (default)"
+	}
+	if level == safetyOff {
+		return "Off"
+	}
+	return "Blocks " + level + " or higher odds of harm"
+}
+
+// safetyOptions returns the options of a safety level menu, picking the
+// guild's level
+func safetyOptions(level string, fallback string) []discordgo.SelectMenuOption {
+	options := []discordgo.SelectMenuOption{
+		{Label: "Default", Description: safetyLabel("", fallback), Value: safetyDefault, Default: level == ""},
+		{Label: "Safety off", Description: "Block nothing", Value: safetyOff, Default: level == safetyOff},
+	}
+	for _, option := range ai.SafetyLevels {
+		options = append(options, discordgo.SelectMenuOption{
+			Label:       "Safety " + option,
+			Description: fmt.Sprintf("Block responses with %s or higher odds of harm", option),
+			Value:       option,
+			Default:     option == level,
+		})
+	}
+	return options
+}
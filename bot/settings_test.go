@@ -0,0 +1,250 @@
+package bot
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/store"
+)
+
+// settingsInteraction is a change made with a /settings component or form
+// by a member with the given permissions
+func settingsInteraction(permissions int64, data discordgo.InteractionData) *discordgo.InteractionCreate {
+	interactionType := discordgo.InteractionMessageComponent
+	if _, ok := data.(discordgo.ModalSubmitInteractionData); ok {
+		interactionType = discordgo.InteractionModalSubmit
+	}
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:      interactionType,
+		GuildID:   "guild",
+		ChannelID: "channel",
+		Member:    &discordgo.Member{User: &discordgo.User{ID: "admin", Username: "admin"}, Permissions: permissions},
+		Data:      data,
+	}}
+}
+
+// settingsForm is the /settings form submitted with the given values
+func settingsForm(values map[string]string) discordgo.ModalSubmitInteractionData {
+	data := discordgo.ModalSubmitInteractionData{CustomID: settingsModalID}
+	for id, value := range values {
+		data.Components = append(data.Components, &discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			&discordgo.TextInput{CustomID: id, Value: value},
+		}})
+	}
+	return data
+}
+
+func TestSettingsCommand(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+
+	i := promptInteraction("bob", 0, "")
+	i.Data = discordgo.ApplicationCommandInteractionData{Name: "settings"}
+	b.HandleInteraction(i)
+	if len(session.responses) != 1 || !strings.Contains(session.responses[0].Data.Content, "Manage Server") {
+		t.Fatalf("responses to a member = %v, want a refusal", session.responses)
+	}
+
+	session.responses = nil
+	i.Member.Permissions = discordgo.PermissionManageServer
+	b.HandleInteraction(i)
+	if len(session.responses) != 1 || len(session.responses[0].Data.Embeds) != 1 || len(session.responses[0].Data.Components) != 5 {
+		t.Fatalf("responses = %v, want the settings with their menus", session.responses)
+	}
+
+	steps := []struct {
+		data discordgo.InteractionData
+		want store.GuildSettings
+	}{
+		{discordgo.MessageComponentInteractionData{CustomID: settingsTriggerID, Values: []string{triggerMention}},
+			store.GuildSettings{GuildID: "guild", Trigger: triggerMention}},
+		{discordgo.MessageComponentInteractionData{CustomID: settingsSafetyID, Values: []string{"medium"}},
+			store.GuildSettings{GuildID: "guild", Trigger: triggerMention, Safety: "medium"}},
+		{discordgo.MessageComponentInteractionData{CustomID: settingsChannelsID, Values: []string{"general", "help"}},
+			store.GuildSettings{GuildID: "guild", Trigger: triggerMention, Safety: "medium", AllowedChannels: []string{"general", "help"}}},
+		{settingsForm(map[string]string{"persona": " A pirate ", "language": "French", "model": "gemini-1.5-flash", "rate_limit": "5", "attachment_limits": "10 minutes, 50 pages"}),
+			store.GuildSettings{GuildID: "guild", Trigger: triggerMention, Safety: "medium", AllowedChannels: []string{"general", "help"},
+				Persona: "A pirate", Language: "French", Model: "gemini-1.5-flash", RateLimit: 5, MaxMediaMinutes: 10, MaxPDFPages: 50}},
+		{discordgo.MessageComponentInteractionData{CustomID: settingsSafetyID, Values: []string{safetyOff}},
+			store.GuildSettings{GuildID: "guild", Trigger: triggerMention, Safety: safetyOff, AllowedChannels: []string{"general", "help"},
+				Persona: "A pirate", Language: "French", Model: "gemini-1.5-flash", RateLimit: 5, MaxMediaMinutes: 10, MaxPDFPages: 50}},
+		{discordgo.MessageComponentInteractionData{CustomID: settingsNSFWSafetyID, Values: []string{"high"}},
+			store.GuildSettings{GuildID: "guild", Trigger: triggerMention, Safety: safetyOff, NSFWSafety: "high", AllowedChannels: []string{"general", "help"},
+				Persona: "A pirate", Language: "French", Model: "gemini-1.5-flash", RateLimit: 5, MaxMediaMinutes: 10, MaxPDFPages: 50}},
+		{discordgo.MessageComponentInteractionData{CustomID: settingsSafetyID, Values: []string{safetyDefault}},
+			store.GuildSettings{GuildID: "guild", Trigger: triggerMention, NSFWSafety: "high", AllowedChannels: []string{"general", "help"},
+				Persona: "A pirate", Language: "French", Model: "gemini-1.5-flash", RateLimit: 5, MaxMediaMinutes: 10, MaxPDFPages: 50}},
+		{discordgo.MessageComponentInteractionData{CustomID: settingsSpoilersID},
+			store.GuildSettings{GuildID: "guild", Trigger: triggerMention, NSFWSafety: "high", AllowedChannels: []string{"general", "help"},
+				Persona: "A pirate", Language: "French", Model: "gemini-1.5-flash", RateLimit: 5, MaxMediaMinutes: 10, MaxPDFPages: 50, Spoilers: true}},
+		{discordgo.MessageComponentInteractionData{CustomID: settingsScrubID},
+			store.GuildSettings{GuildID: "guild", Trigger: triggerMention, NSFWSafety: "high", AllowedChannels: []string{"general", "help"},
+				Persona: "A pirate", Language: "French", Model: "gemini-1.5-flash", RateLimit: 5, MaxMediaMinutes: 10, MaxPDFPages: 50, Spoilers: true, ScrubPII: true}},
+		{discordgo.MessageComponentInteractionData{CustomID: settingsPollsID},
+			store.GuildSettings{GuildID: "guild", Trigger: triggerMention, NSFWSafety: "high", AllowedChannels: []string{"general", "help"},
+				Persona: "A pirate", Language: "French", Model: "gemini-1.5-flash", RateLimit: 5, MaxMediaMinutes: 10, MaxPDFPages: 50, Spoilers: true, ScrubPII: true, PollsDisabled: true}},
+		{discordgo.MessageComponentInteractionData{CustomID: settingsResetID},
+			store.GuildSettings{GuildID: "guild", Trigger: triggerAll}},
+	}
+	for n, step := range steps {
+		session.responses = nil
+		b.HandleInteraction(settingsInteraction(discordgo.PermissionManageServer, step.data))
+		if len(session.responses) != 1 || session.responses[0].Type != discordgo.InteractionResponseUpdateMessage {
+			t.Errorf("step %d: responses = %v, want the updated settings", n, session.responses)
+		}
+		saved, err := b.store.GuildSettings("guild")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved == nil {
+			saved = &store.GuildSettings{GuildID: "guild", Trigger: triggerAll}
+		}
+		if !reflect.DeepEqual(*saved, step.want) || !reflect.DeepEqual(b.guildSettings("guild"), step.want) {
+			t.Errorf("step %d: saved %+v, want %+v", n, saved, step.want)
+		}
+	}
+
+	session.responses = nil
+	b.HandleInteraction(settingsInteraction(discordgo.PermissionManageServer, settingsForm(map[string]string{"rate_limit": "lots"})))
+	if len(session.responses) != 1 || !strings.Contains(session.responses[0].Data.Content, "rate limit must be a number") {
+		t.Errorf("responses to a bad rate limit = %v", session.responses)
+	}
+
+	session.responses = nil
+	b.HandleInteraction(settingsInteraction(discordgo.PermissionManageServer, settingsForm(map[string]string{"attachment_limits": "an hour"})))
+	if len(session.responses) != 1 || !strings.Contains(session.responses[0].Data.Content, "attachment limits") {
+		t.Errorf("responses to bad attachment limits = %v", session.responses)
+	}
+
+	session.responses = nil
+	b.HandleInteraction(settingsInteraction(0, discordgo.MessageComponentInteractionData{CustomID: settingsResetID}))
+	if len(session.responses) != 1 || session.responses[0].Type != discordgo.InteractionResponseChannelMessageWithSource {
+		t.Errorf("responses to a member changing settings = %v, want a refusal", session.responses)
+	}
+}
+
+func TestGuildSettingsTriggers(t *testing.T) {
+	fake := &fakeAI{replies: []*ai.Reply{{Text: "Arr"}}}
+	b, session := newTestBot(t, fake)
+	settings := &store.GuildSettings{GuildID: "guild", Trigger: triggerMention, AllowedChannels: []string{"channel"}, Persona: "A pirate", Language: "French"}
+	if err := b.saveGuildSettings("guild", settings); err != nil {
+		t.Fatal(err)
+	}
+
+	mention := userMessage("<@bot> hello")
+	mention.Mentions = []*discordgo.User{{ID: botUserID}}
+	elsewhere := userMessage("<@bot> hello")
+	elsewhere.Mentions = mention.Mentions
+	elsewhere.ChannelID = "random"
+	dm := userMessage("hello")
+	dm.GuildID = ""
+
+	tests := []struct {
+		name string
+		m    *discordgo.MessageCreate
+		want bool
+	}{
+		{"plain message", userMessage("hello"), false},
+		{"mention", mention, true},
+		{"mention in another channel", elsewhere, false},
+		{"DM", dm, true},
+	}
+	for _, test := range tests {
+		session.messages = nil
+		b.HandleMessage(test.m)
+		if answered := len(session.messages) > 0; answered != test.want {
+			t.Errorf("%s: answered %v, want %v", test.name, answered, test.want)
+		}
+	}
+
+	// The server's persona and language come first in the prompt
+	sent := fake.chats[0].sent[0]
+	if text, ok := sent[0].(genai.Text); !ok || text != "In this server, act as follows: A pirate\nAlways answer in French." {
+		t.Errorf("first part = %v, want the server's instructions", sent[0])
+	}
+}
+
+func TestGuildRateLimit(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{replies: []*ai.Reply{{Text: "Hi"}}})
+	if err := b.saveGuildSettings("guild", &store.GuildSettings{GuildID: "guild", Trigger: triggerAll, RateLimit: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 3 {
+		b.HandleMessage(userMessage("hello"))
+	}
+	if len(session.messages) != 2 || session.messages[0] != "Hi" || !strings.Contains(session.messages[1], "limit is 1 a minute") {
+		t.Errorf("messages = %q, want an answer and a single warning", session.messages)
+	}
+}
+
+func TestAnswerLanguage(t *testing.T) {
+	fake := &fakeAI{replies: []*ai.Reply{{Text: "Hola"}, {Text: "Bonjour"}}}
+	b, _ := newTestBot(t, fake)
+
+	// The message's language when the server sets none
+	b.HandleMessage(userMessage("Hola, ¿qué tal? ¿Me puedes explicar cómo funciona esto?"))
+	if text, ok := fake.chats[0].sent[0][0].(genai.Text); !ok || !strings.Contains(string(text), "answer in Spanish") {
+		t.Errorf("first part = %v, want an instruction to answer in Spanish", fake.chats[0].sent[0][0])
+	}
+
+	// The server's language otherwise
+	if err := b.saveGuildSettings("guild", &store.GuildSettings{GuildID: "guild", Trigger: triggerAll, Language: "French"}); err != nil {
+		t.Fatal(err)
+	}
+	b.HandleMessage(userMessage("Hola, ¿qué tal? ¿Me puedes explicar cómo funciona esto?"))
+	if text, ok := fake.chats[0].sent[1][0].(genai.Text); !ok || text != "Always answer in French." {
+		t.Errorf("first part = %v, want the server's language", fake.chats[0].sent[1][0])
+	}
+}
+
+func TestSafetyLevel(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+	session.channels["nsfw"] = &discordgo.Channel{ID: "nsfw", NSFW: true}
+	session.channels["nsfw-thread"] = &discordgo.Channel{ID: "nsfw-thread", Type: discordgo.ChannelTypeGuildPublicThread, ParentID: "nsfw"}
+	session.channels["general"] = &discordgo.Channel{ID: "general"}
+
+	tests := []struct {
+		name     string
+		settings store.GuildSettings
+		channel  string
+		want     string
+	}{
+		{"defaults", store.GuildSettings{}, "general", defaultSafety},
+		{"defaults in NSFW channel", store.GuildSettings{}, "nsfw", ""},
+		{"defaults in NSFW thread", store.GuildSettings{}, "nsfw-thread", ""},
+		{"no channel", store.GuildSettings{}, "", defaultSafety},
+		{"server level", store.GuildSettings{Safety: "high", NSFWSafety: "low"}, "general", "high"},
+		{"server NSFW level", store.GuildSettings{Safety: "high", NSFWSafety: "low"}, "nsfw", "low"},
+		{"off", store.GuildSettings{Safety: safetyOff}, "general", ""},
+	}
+	for _, test := range tests {
+		if got := b.safetyLevel(test.settings, test.channel); got != test.want {
+			t.Errorf("%s: safetyLevel = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSpoilers(t *testing.T) {
+	fake := &fakeAI{replies: []*ai.Reply{
+		{Text: "Fine", SafetyFlags: []string{"HARASSMENT: MEDIUM"}},
+		{Text: "Borderline", SafetyFlags: []string{"HARASSMENT: MEDIUM"}},
+		{Text: "Harmless"},
+	}}
+	b, session := newTestBot(t, fake)
+
+	// Flagged answers are only hidden when the server asks for it
+	b.HandleMessage(userMessage("hello"))
+	if err := b.saveGuildSettings("guild", &store.GuildSettings{GuildID: "guild", Trigger: triggerAll, Spoilers: true}); err != nil {
+		t.Fatal(err)
+	}
+	b.HandleMessage(userMessage("hello"))
+	b.HandleMessage(userMessage("hello"))
+	if want := []string{"Fine", "||Borderline||", "Harmless"}; !reflect.DeepEqual(session.messages, want) {
+		t.Errorf("messages = %q, want %q", session.messages, want)
+	}
+}
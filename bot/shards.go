@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/metrics"
+)
+
+// shardCount is the number of gateway shards the bot runs on, across every
+// process, for tagging logs with the shard of a guild
+var shardCount atomic.Int64
+
+// SetShardCount records how many gateway shards the bot runs on
+func SetShardCount(count int) {
+	shardCount.Store(int64(count))
+}
+
+// ShardOf returns the gateway shard Discord sends a guild's events to. Direct
+// messages, without a guild, arrive on shard 0.
+func ShardOf(guildID string, count int) int {
+	id, err := strconv.ParseUint(guildID, 10, 64)
+	if err != nil || count <= 1 {
+		return 0
+	}
+	return int((id >> 22) % uint64(count))
+}
+
+// ShardIDs returns the shards a process runs: only shardID when it is set,
+// otherwise all count of them
+func ShardIDs(shardID *int, count int) []int {
+	if shardID != nil {
+		return []int{*shardID}
+	}
+	ids := make([]int, max(count, 1))
+	for n := range ids {
+		ids[n] = n
+	}
+	return ids
+}
+
+// withShard adds the shard of a guild to a logger when the bot is sharded
+func withShard(logger *slog.Logger, guildID string) *slog.Logger {
+	if count := int(shardCount.Load()); count > 1 {
+		return logger.With("shard", ShardOf(guildID, count))
+	}
+	return logger
+}
+
+// trackShard logs a gateway shard's connection and keeps its metrics current
+func trackShard(s *discordgo.Session) {
+	shard := strconv.Itoa(s.ShardID)
+	logger := slog.With("shard", s.ShardID, "shards", s.ShardCount)
+
+	guilds := func() {
+		s.State.RLock()
+		defer s.State.RUnlock()
+		metrics.ShardGuilds.WithLabelValues(shard).Set(float64(len(s.State.Guilds)))
+	}
+
+	s.AddHandler(func(_ *discordgo.Session, _ *discordgo.Connect) {
+		metrics.ShardConnected.WithLabelValues(shard).Set(1)
+	})
+	s.AddHandler(func(_ *discordgo.Session, _ *discordgo.Disconnect) {
+		logger.Warn("Gateway shard disconnected")
+		metrics.ShardConnected.WithLabelValues(shard).Set(0)
+		metrics.ShardDisconnects.WithLabelValues(shard).Inc()
+	})
+
+	// Every Ready after the first starts a new session, since Discord
+	// invalidated the previous one instead of letting it resume
+	var identified atomic.Bool
+	s.AddHandler(func(_ *discordgo.Session, r *discordgo.Ready) {
+		if identified.Swap(true) {
+			logger.Warn("Gateway session was invalidated, shard identified again", "guilds", len(r.Guilds))
+			metrics.ShardReconnects.WithLabelValues(shard, "identify").Inc()
+		} else {
+			logger.Info("Gateway shard ready", "guilds", len(r.Guilds))
+		}
+		metrics.ShardGuilds.WithLabelValues(shard).Set(float64(len(r.Guilds)))
+	})
+	s.AddHandler(func(_ *discordgo.Session, _ *discordgo.Resumed) {
+		logger.Info("Gateway shard resumed")
+		metrics.ShardReconnects.WithLabelValues(shard, "resume").Inc()
+	})
+	s.AddHandler(func(_ *discordgo.Session, _ *discordgo.GuildCreate) { guilds() })
+	s.AddHandler(func(_ *discordgo.Session, _ *discordgo.GuildDelete) { guilds() })
+	s.AddHandler(func(_ *discordgo.Session, _ *discordgo.Event) {
+		metrics.ShardEvents.WithLabelValues(shard).Inc()
+	})
+}
+
+// presenceSetter sets the bot's presence on a gateway connection
+type presenceSetter interface {
+	UpdateStatusComplex(data discordgo.UpdateStatusData) error
+}
+
+// handleReady shows the presence on a shard's new gateway session, which
+// starts without one, and registers the commands again when the session
+// replaced one Discord invalidated
+func (b *Bot) handleReady(shard presenceSetter, shardID int, reidentified bool) {
+	logger := slog.With("shard", shardID)
+
+	b.presenceMu.Lock()
+	status, data := b.currentPresence()
+	b.presenceMu.Unlock()
+	if status != "" {
+		if err := shard.UpdateStatusComplex(data); err != nil {
+			logger.Warn("Error updating presence", "status", status, "error", err)
+		}
+	}
+
+	if !reidentified || b.syncCommands == nil {
+		return
+	}
+	logger.Info("Registering commands again after a new gateway session")
+	if err := b.syncCommands(); err != nil {
+		logger.Error("Error registering commands", "error", err)
+	}
+}
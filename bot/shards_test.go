@@ -0,0 +1,97 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestShardOf(t *testing.T) {
+	tests := []struct {
+		guildID string
+		count   int
+		want    int
+	}{
+		{"81384788765712384", 1, 0},
+		{"81384788765712384", 2, 0},
+		{"81384788765712384", 16, 2},
+		{"175928847303311367", 4, 1},
+		{"", 4, 0},
+		{"guild", 4, 0},
+	}
+	for _, test := range tests {
+		if got := ShardOf(test.guildID, test.count); got != test.want {
+			t.Errorf("ShardOf(%q, %d) = %d, want %d", test.guildID, test.count, got, test.want)
+		}
+	}
+}
+
+func TestShardIDs(t *testing.T) {
+	if got := ShardIDs(nil, 3); !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Errorf("ShardIDs of all 3 = %v", got)
+	}
+	id := 2
+	if got := ShardIDs(&id, 3); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("ShardIDs of shard 2 = %v", got)
+	}
+}
+
+func TestDiscordSessionShards(t *testing.T) {
+	// 81384788765712384 is on shard 0 of 2, 175928847303311367 on shard 1
+	shards := make([]*discordgo.Session, 2)
+	for n := range shards {
+		s, err := discordgo.New("Bot token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.ShardID, s.ShardCount = n, 2
+		shards[n] = s
+	}
+	guilds := []*discordgo.Guild{{ID: "81384788765712384"}, {ID: "175928847303311367"}}
+	for n, guild := range guilds {
+		shards[n].State.GuildAdd(guild)
+		shards[n].State.ChannelAdd(&discordgo.Channel{ID: "channel-" + guild.ID, GuildID: guild.ID})
+	}
+
+	session := NewDiscordSession(shards...).(discordSession)
+	if got := session.Guilds(); len(got) != 2 {
+		t.Errorf("Guilds = %d, want both shards' guilds", len(got))
+	}
+	for n, guild := range guilds {
+		if got := session.shard(guild.ID); got != shards[n] {
+			t.Errorf("guild %s is on shard %d, want %d", guild.ID, got.ShardID, n)
+		}
+		if got, err := session.Guild(guild.ID); err != nil || got != guild {
+			t.Errorf("Guild(%s) = %v, %v", guild.ID, got, err)
+		}
+		if got, err := session.Channel("channel-" + guild.ID); err != nil || got.GuildID != guild.ID {
+			t.Errorf("Channel of guild %s = %v, %v", guild.ID, got, err)
+		}
+	}
+}
+
+func TestHandleReady(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+	b.config().Statuses = []string{"listening to /help"}
+	syncs := 0
+	b.SetCommandSync(func() error {
+		syncs++
+		return nil
+	})
+
+	// A new session shows the presence, even when it was shown before
+	b.updatePresence()
+	b.handleReady(session, 0, false)
+	if len(session.presences) != 2 || session.presences[1].Activities[0].Name != "/help" {
+		t.Errorf("presences = %+v, want /help shown again", session.presences)
+	}
+	if syncs != 0 {
+		t.Errorf("commands registered %d times on the first session, want none", syncs)
+	}
+
+	b.handleReady(session, 0, true)
+	if syncs != 1 {
+		t.Errorf("commands registered %d times after an invalidated session, want once", syncs)
+	}
+}
@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"bytes"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// Custom ID of the 🔊 button attached to responses
+	speakButtonID = "speak"
+
+	// Number of recent responses remembered for the 🔊 button
+	maxSpokenResponses = 500
+)
+
+// speakButton returns the 🔊 button attached to responses
+func speakButton() discordgo.MessageComponent {
+	return discordgo.Button{
+		CustomID: speakButtonID,
+		Label:    "Listen",
+		Style:    discordgo.SecondaryButton,
+		Emoji:    &discordgo.ComponentEmoji{Name: "🔊"},
+	}
+}
+
+// speakCommand handles /speak, reading the given text aloud
+func (b *Bot) speakCommand(i *discordgo.InteractionCreate) {
+	text := commandOption(i.ApplicationCommandData().Options, "text").StringValue()
+	b.sendSpeech(i, text)
+}
+
+// speakButton handles the 🔊 button, reading the response it is attached to aloud
+func (b *Bot) speakButton(i *discordgo.InteractionCreate) {
+	text := i.Message.Content
+	if text == "" && len(i.Message.Embeds) > 0 {
+		text = i.Message.Embeds[0].Description
+	}
+	b.spokenMu.Lock()
+	if full, ok := b.spoken[i.Message.ID]; ok {
+		text = full
+	}
+	b.spokenMu.Unlock()
+	b.sendSpeech(i, text)
+}
+
+// sendSpeech synthesizes text with Gemini TTS and replies with a WAV attachment
+func (b *Bot) sendSpeech(i *discordgo.InteractionCreate, text string) {
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to speak request", "error", err)
+		return
+	}
+
+	audio, err := b.ai.Speak(b.ctx, text)
+	if err != nil {
+		interactionLogger(i).Error("Gemini TTS error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+
+	_, err = b.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Files: []*discordgo.File{{
+			Name:        "speech.wav",
+			ContentType: "audio/wav",
+			Reader:      bytes.NewReader(audio),
+		}},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error sending speech", "error", err)
+	}
+}
+
+// rememberSpokenResponse stores a response for the 🔊 button, forgetting the
+// oldest one once the cache is full
+func (b *Bot) rememberSpokenResponse(messageID string, text string) {
+	b.spokenMu.Lock()
+	defer b.spokenMu.Unlock()
+
+	// An edited response keeps its place
+	if _, ok := b.spoken[messageID]; ok {
+		b.spoken[messageID] = text
+		return
+	}
+	b.spoken[messageID] = text
+	b.spokenOrder = append(b.spokenOrder, messageID)
+	if len(b.spokenOrder) > maxSpokenResponses {
+		delete(b.spoken, b.spokenOrder[0])
+		b.spokenOrder = b.spokenOrder[1:]
+	}
+}
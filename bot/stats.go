@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/metrics"
+)
+
+// statsCommand handles /stats, showing how long the bot has been running,
+// where, and how much it has been asked since
+func (b *Bot) statsCommand(i *discordgo.InteractionCreate) {
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{b.statsEmbed()},
+			Flags:  discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to stats command", "error", err)
+	}
+}
+
+// statsEmbed renders the bot's runtime and usage statistics
+func (b *Bot) statsEmbed() *discordgo.MessageEmbed {
+	guilds := b.session.Guilds()
+	channels := 0
+	for _, guild := range guilds {
+		channels += len(guild.Channels)
+	}
+
+	handled, latency := "Unavailable", "Unavailable"
+	if totals, err := metrics.Read(); err != nil {
+		slog.Error("Error reading metrics", "error", err)
+	} else {
+		handled = fmt.Sprint(totals.MessagesHandled)
+		latency = "No requests yet"
+		if totals.GeminiRequests > 0 {
+			latency = fmt.Sprintf("%s over %d requests", totals.AverageLatency.Round(time.Millisecond), totals.GeminiRequests)
+		}
+	}
+
+	tokens := "Unavailable"
+	if usage, err := b.state().TotalUsage(time.Now()); err != nil {
+		slog.Error("Error loading usage", "error", err)
+	} else {
+		tokens = fmt.Sprintf("%d in %d requests", usage.Tokens(), usage.Requests)
+	}
+
+	model := b.modelName()
+
+	var running, waiting int
+	for _, client := range b.providers {
+		r, w := ai.Queue(client)
+		running += r
+		waiting += w
+	}
+
+	return &discordgo.MessageEmbed{
+		Title: "Stats",
+		Color: embedColor,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Uptime", Value: time.Since(b.started).Round(time.Second).String(), Inline: true},
+			{Name: "Servers", Value: fmt.Sprint(len(guilds)), Inline: true},
+			{Name: "Channels", Value: fmt.Sprint(channels), Inline: true},
+			{Name: "Messages handled", Value: handled, Inline: true},
+			{Name: "Average latency", Value: latency, Inline: true},
+			{Name: "Tokens today (UTC)", Value: tokens, Inline: true},
+			{Name: "Model", Value: model, Inline: true},
+			{Name: "Queue", Value: fmt.Sprintf("%d running, %d waiting", running, waiting), Inline: true},
+		},
+	}
+}
+
+// modelName returns the default provider's chat model, or the provider's
+// name when its model can't be told
+func (b *Bot) modelName() string {
+	if switcher, ok := ai.Unwrap(b.ai).(ai.ModelSwitcher); ok {
+		return switcher.Model()
+	}
+	return b.defaultProvider
+}
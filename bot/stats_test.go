@@ -0,0 +1,43 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+func TestStatsCommand(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello", PromptTokens: 3, ResponseTokens: 2}}}
+	b, session := newTestBot(t, client)
+	session.guilds = []*discordgo.Guild{
+		{ID: "guild", Channels: []*discordgo.Channel{{ID: "channel"}, {ID: "other"}}},
+		{ID: "second", Channels: []*discordgo.Channel{{ID: "general"}}},
+	}
+	b.HandleMessage(userMessage("hi"))
+
+	b.HandleInteraction(commandInteraction("stats"))
+	if len(session.responses) != 1 || len(session.responses[0].Data.Embeds) != 1 {
+		t.Fatalf("responses = %v, want the stats embed", session.responses)
+	}
+	fields := map[string]string{}
+	for _, field := range session.responses[0].Data.Embeds[0].Fields {
+		fields[field.Name] = field.Value
+	}
+	want := map[string]string{
+		"Servers":            "2",
+		"Channels":           "3",
+		"Tokens today (UTC)": "5 in 1 requests",
+		"Model":              ProviderGemini,
+		"Queue":              "0 running, 0 waiting",
+	}
+	for name, value := range want {
+		if fields[name] != value {
+			t.Errorf("%s = %q, want %q", name, fields[name], value)
+		}
+	}
+	if fields["Messages handled"] == "" || fields["Uptime"] == "" {
+		t.Errorf("stats fields = %v, want messages handled and uptime", fields)
+	}
+}
@@ -0,0 +1,135 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// Custom ID of the button stopping an answer, followed by the ID of the
+	// message being answered
+	stopPrefix = "stop:"
+
+	// How long an answer takes before a message with a button stopping it
+	// is posted, so quick answers don't flash one
+	stopButtonDelay = 3 * time.Second
+)
+
+// generation is an answer the model is writing, which whoever asked can
+// stop with the button of its placeholder message or /stop
+type generation struct {
+	userID         string
+	channelID      string
+	replyChannelID string // channel the answer goes to, the author's thread if any
+	cancel         context.CancelFunc
+
+	// Placeholder showing the stop button, once posted
+	mu            sync.Mutex
+	placeholderID string
+	finished      bool
+}
+
+// startGeneration registers the answer to a message being written in
+// channelID, returning the context to request it with, derived from parent,
+// and a function to call once it's done, which removes the placeholder
+// message if one was posted
+func (b *Bot) startGeneration(parent context.Context, m *discordgo.Message, channelID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	g := &generation{userID: m.Author.ID, channelID: m.ChannelID, replyChannelID: channelID, cancel: cancel}
+	b.generationsMu.Lock()
+	b.generations[m.ID] = g
+	b.generationsMu.Unlock()
+
+	timer := time.AfterFunc(stopButtonDelay, func() { b.postStopButton(m.GuildID, m.ID, g) })
+	return ctx, func() {
+		timer.Stop()
+		cancel()
+		b.generationsMu.Lock()
+		delete(b.generations, m.ID)
+		b.generationsMu.Unlock()
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		g.finished = true
+		if g.placeholderID != "" {
+			if err := b.session.ChannelMessageDelete(g.replyChannelID, g.placeholderID); err != nil {
+				slog.Error("Error deleting stop button", "channel", g.replyChannelID, "error", err)
+			}
+		}
+	}
+}
+
+// postStopButton posts the placeholder of an answer taking a while, with a
+// button stopping it, unless it's done already
+func (b *Bot) postStopButton(guildID string, messageID string, g *generation) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.finished {
+		return
+	}
+	message, err := b.session.ChannelMessageSendComplex(g.replyChannelID, &discordgo.MessageSend{
+		Content: b.trGuild(guildID, "-# Still thinking…"),
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{CustomID: stopPrefix + messageID, Label: b.trGuild(guildID, "Stop"), Style: discordgo.DangerButton},
+			}},
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending stop button", "channel", g.replyChannelID, "error", err)
+		return
+	}
+	g.placeholderID = message.ID
+}
+
+// stopButton handles the button stopping an answer, which only whoever
+// asked for it may press
+func (b *Bot) stopButton(i *discordgo.InteractionCreate) {
+	messageID := strings.TrimPrefix(i.MessageComponentData().CustomID, stopPrefix)
+	b.generationsMu.Lock()
+	g, ok := b.generations[messageID]
+	b.generationsMu.Unlock()
+	if !ok {
+		b.respondEphemeral(i, tr(i, "This answer is already done."))
+		return
+	}
+	if g.userID != interactionUserID(i) {
+		b.respondEphemeral(i, tr(i, "Only whoever asked can stop this answer."))
+		return
+	}
+	g.cancel()
+	interactionLogger(i).Info("Stopped answer", "message", messageID)
+
+	// The placeholder is deleted once the request returns
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to stop button", "error", err)
+	}
+}
+
+// stopCommand handles /stop, stopping the answers the member is waiting for
+// in the channel, whether asked there or answered there in a thread
+func (b *Bot) stopCommand(i *discordgo.InteractionCreate) {
+	userID := interactionUserID(i)
+	var stopped int
+	b.generationsMu.Lock()
+	for _, g := range b.generations {
+		if g.userID == userID && (g.channelID == i.ChannelID || g.replyChannelID == i.ChannelID) {
+			g.cancel()
+			stopped++
+		}
+	}
+	b.generationsMu.Unlock()
+
+	if stopped == 0 {
+		b.respondEphemeral(i, tr(i, "You're not waiting for an answer here."))
+		return
+	}
+	interactionLogger(i).Info("Stopped answers", "answers", stopped)
+	b.respondEphemeral(i, tr(i, "Stopped, nothing more will be posted for what you asked."))
+}
@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestStopGeneration(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+	m := userMessage("write me a novel").Message
+
+	ctx, finish := b.startGeneration(b.ctx, m, "channel")
+	b.generationsMu.Lock()
+	g := b.generations[m.ID]
+	b.generationsMu.Unlock()
+	b.postStopButton(m.GuildID, m.ID, g)
+	if len(session.messages) != 1 {
+		t.Fatalf("messages = %q, want the stop button posted", session.messages)
+	}
+
+	// Only the author can stop it
+	stop := settingsInteraction(0, discordgo.MessageComponentInteractionData{CustomID: stopPrefix + m.ID})
+	b.HandleInteraction(stop)
+	if last := session.responses[len(session.responses)-1]; !strings.Contains(last.Data.Content, "Only whoever asked") {
+		t.Fatalf("response = %v, want the member refused", last.Data)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("answer stopped by another member")
+	}
+	stop.Member.User.ID = "user"
+	b.HandleInteraction(stop)
+	if ctx.Err() == nil {
+		t.Fatal("answer not stopped")
+	}
+
+	finish()
+	if len(session.deleted) != 1 || session.deleted[0] != "sent-0" {
+		t.Errorf("deleted = %q, want the stop button removed", session.deleted)
+	}
+	b.HandleInteraction(stop)
+	if last := session.responses[len(session.responses)-1]; !strings.Contains(last.Data.Content, "already done") {
+		t.Errorf("response = %v, want the answer done", last.Data)
+	}
+}
+
+func TestStopCommand(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{})
+	command := commandInteraction("stop")
+	command.ChannelID = "channel"
+
+	b.HandleInteraction(command)
+	if !strings.Contains(session.responses[0].Data.Content, "not waiting") {
+		t.Fatalf("response = %v, want nothing to stop", session.responses[0].Data)
+	}
+
+	// Answers going to the author's thread stop from the channel too
+	ctx, finish := b.startGeneration(b.ctx, userMessage("write me a novel").Message, "thread")
+	defer finish()
+	other := userMessage("and a poem")
+	other.ID, other.Author = "other", &discordgo.User{ID: "bob"}
+	otherCtx, otherFinish := b.startGeneration(b.ctx, other.Message, "channel")
+	defer otherFinish()
+
+	b.HandleInteraction(command)
+	if ctx.Err() == nil || otherCtx.Err() != nil {
+		t.Errorf("stopped = %v, %v, want only the member's answer stopped", ctx.Err(), otherCtx.Err())
+	}
+}
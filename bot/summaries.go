@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+)
+
+// Longest summary pinned in a thread, leaving room for its title and footer
+// within a message
+const maxThreadSummaryLength = 1700
+
+// threadSummary is how far a thread's conversation went and the pinned
+// message summing it up, once posted
+type threadSummary struct {
+	turns     int
+	messageID string
+}
+
+// threadSummaryUpdate is the title and summary the model writes of a thread
+type threadSummaryUpdate struct {
+	Title   string `json:"title"`
+	Summary string `json:"summary"`
+}
+
+// summarizeThread counts an answer in a thread and, every
+// THREAD_SUMMARY_TURNS answers, has the model sum up its conversation in a
+// title and a few lines, pinned for members joining it late. The pinned
+// message is edited as the conversation goes on, or posted again when it
+// was deleted.
+func (b *Bot) summarizeThread(m *discordgo.MessageCreate, threadID string, chat ai.Chat) {
+	every := b.config().ThreadSummaryTurns
+	if every == 0 || !b.isThread(threadID) {
+		return
+	}
+	b.summariesMu.Lock()
+	summary, ok := b.summaries[threadID]
+	if !ok {
+		summary = &threadSummary{}
+		b.summaries[threadID] = summary
+	}
+	summary.turns++
+	turns, messageID := summary.turns, summary.messageID
+	b.summariesMu.Unlock()
+	if turns%every != 0 {
+		return
+	}
+
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"title":   {Type: genai.TypeString, Description: "What the conversation is about, in at most eight words"},
+			"summary": {Type: genai.TypeString, Description: "The points, decisions and open questions so far, as a few short bullet points"},
+		},
+		Required: []string{"title", "summary"},
+	}
+	prompt := "Sum up the Discord thread conversation below for members joining it late, in the language of its messages: " +
+		"a one-line title and a few short bullet points with what was asked, answered and decided, and what is still open.\n\n" +
+		historyTranscript(chat.History())
+	text, err := b.generateJSON(m.Author.ID, m.GuildID, schema, genai.Text(prompt))
+	var update threadSummaryUpdate
+	if err == nil {
+		err = json.Unmarshal([]byte(text), &update)
+	}
+	if err != nil {
+		messageLogger(m).Warn("Error summarizing thread", "error", err)
+		return
+	}
+	title, points := cleanTitle(update.Title, maxThreadNameLength), strings.TrimSpace(update.Summary)
+	if title == "" || points == "" {
+		return
+	}
+	content := fmt.Sprintf("📌 **%s**\n%s\n%s", title, truncate(points, maxThreadSummaryLength),
+		b.trGuild(m.GuildID, "-# Summary after %d answers, updated as the conversation goes on", turns))
+
+	if messageID != "" {
+		_, err := b.session.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID:              messageID,
+			Channel:         threadID,
+			Content:         &content,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err == nil {
+			messageLogger(m).Info("Updated thread summary", "thread", threadID, "turns", turns)
+			return
+		}
+		messageLogger(m).Warn("Error updating thread summary, posting it again", "error", err)
+	}
+
+	message, err := b.session.ChannelMessageSendComplex(threadID, &discordgo.MessageSend{
+		Content:         content,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		messageLogger(m).Error("Error sending thread summary", "error", err)
+		return
+	}
+	if err := b.session.ChannelMessagePin(threadID, message.ID); err != nil {
+		messageLogger(m).Warn("Error pinning thread summary", "error", err)
+	}
+	b.summariesMu.Lock()
+	summary.messageID = message.ID
+	b.summariesMu.Unlock()
+	messageLogger(m).Info("Pinned thread summary", "thread", threadID, "turns", turns)
+}
+
+// forgetThreadSummary forgets the summary of a deleted thread
+func (b *Bot) forgetThreadSummary(threadID string) {
+	b.summariesMu.Lock()
+	defer b.summariesMu.Unlock()
+	delete(b.summaries, threadID)
+}
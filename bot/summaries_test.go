@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+func TestSummarizeThread(t *testing.T) {
+	client := &fakeAI{
+		replies: []*ai.Reply{{Text: "Use a buffered channel."}},
+		text:    `{"title": "Go channels", "summary": "- Buffered channels were suggested"}`,
+	}
+	b, session := newTestBot(t, client)
+	b.config().ThreadSummaryTurns = 2
+	session.channels["thread"] = &discordgo.Channel{ID: "thread", ParentID: "channel", Type: discordgo.ChannelTypeGuildPublicThread}
+
+	ask := func(n int) {
+		m := userMessage(fmt.Sprintf("question %d", n))
+		m.ID, m.ChannelID = fmt.Sprintf("question-%d", n), "thread"
+		b.HandleMessage(m)
+	}
+	ask(1)
+	if len(session.pinned) != 0 || len(client.prompts) != 0 {
+		t.Fatalf("pinned %q after one answer, want nothing yet", session.pinned)
+	}
+	ask(2)
+	if len(session.pinned) != 1 {
+		t.Fatalf("pinned = %q, want the summary pinned after two answers", session.pinned)
+	}
+	if !strings.Contains(partsText(client.prompts[0]), "question 2") {
+		t.Errorf("prompt = %q, want the conversation", partsText(client.prompts[0]))
+	}
+	summaries := len(session.messages)
+	var n int
+	fmt.Sscanf(session.pinned[0], "sent-%d", &n)
+	if summary := session.messages[n]; !strings.HasPrefix(summary, "📌 **Go channels**\n- Buffered channels were suggested") {
+		t.Errorf("summary = %q", summary)
+	}
+
+	// The pinned summary is updated in place
+	client.text = `{"title": "Go channels", "summary": "- Buffered channels were suggested\n- Closing them was explained"}`
+	ask(3)
+	ask(4)
+	if len(session.pinned) != 1 || len(session.messages) != summaries+2 {
+		t.Errorf("pinned = %q, messages = %d, want the summary edited", session.pinned, len(session.messages))
+	}
+	if summary := session.messages[n]; !strings.Contains(summary, "Closing them was explained") || !strings.Contains(summary, "after 4 answers") {
+		t.Errorf("updated summary = %q", summary)
+	}
+
+	// Answers outside threads aren't counted
+	b.HandleMessage(userMessage("hi"))
+	b.summariesMu.Lock()
+	defer b.summariesMu.Unlock()
+	if _, ok := b.summaries["channel"]; ok {
+		t.Error("counted an answer outside a thread")
+	}
+}
@@ -0,0 +1,182 @@
+package bot
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+// chatFor returns the chat of the channel's active conversation profile, the
+// chat of a bot-started thread or forum post, or the shared chat of the
+// guild's provider for any other channel. Chats started since the bot did
+// carry on from their saved sessions.
+func (b *Bot) chatFor(channelID string, guildID string) ai.Chat {
+	b.restoreThreadChat(channelID, guildID)
+	b.adoptForumPost(channelID, guildID)
+	name, client := b.provider(guildID)
+	profile := b.activeProfile(channelID)
+
+	b.chatsMu.Lock()
+	defer b.chatsMu.Unlock()
+
+	if profile != nil {
+		key := profileChatKey(name, channelID, profile.Name)
+		chat, ok := b.profileChats[key]
+		if !ok {
+			chat = b.restoredChat(client, "profile:"+key)
+			b.profileChats[key] = chat
+		}
+		return chat
+	}
+	if chat, ok := b.threadChats[channelID]; ok {
+		return chat
+	}
+	chat, ok := b.sharedChats[name]
+	if !ok {
+		chat = b.restoredChat(client, "shared:"+name)
+		b.sharedChats[name] = chat
+	}
+	return chat
+}
+
+// restoreThreadChat gives a thread the chat of its saved session, when the
+// bot started it before a restart or another instance answered there
+func (b *Bot) restoreThreadChat(channelID string, guildID string) {
+	b.chatsMu.Lock()
+	_, ok := b.threadChats[channelID]
+	b.chatsMu.Unlock()
+	if ok || !b.isThread(channelID) {
+		return
+	}
+	history, _ := b.loadSession("thread:" + channelID)
+	if history == nil {
+		return
+	}
+
+	chat := b.aiFor(guildID).NewChat()
+	chat.SetHistory(history)
+	b.chatsMu.Lock()
+	defer b.chatsMu.Unlock()
+	if _, ok := b.threadChats[channelID]; !ok {
+		b.threadChats[channelID] = chat
+	}
+}
+
+// resetChat starts a fresh chat for the channel's active conversation
+// profile, for a bot-started thread or forum post, or for the shared chat of
+// the guild's provider in any other channel
+func (b *Bot) resetChat(channelID string, guildID string) {
+	b.restoreThreadChat(channelID, guildID)
+	b.adoptForumPost(channelID, guildID)
+	name, client := b.provider(guildID)
+	profile := b.activeProfile(channelID)
+
+	b.chatsMu.Lock()
+	defer b.chatsMu.Unlock()
+
+	if profile != nil {
+		key := profileChatKey(name, channelID, profile.Name)
+		if chat, ok := b.profileChats[key]; ok {
+			b.forgetLastTurn(chat)
+		}
+		b.profileChats[key] = client.NewChat()
+		b.deleteSession("profile:" + key)
+		return
+	}
+	if chat, ok := b.threadChats[channelID]; ok {
+		b.forgetLastTurn(chat)
+		b.threadChats[channelID] = client.NewChat()
+		b.deleteSession("thread:" + channelID)
+		return
+	}
+	if chat, ok := b.sharedChats[name]; ok {
+		b.forgetLastTurn(chat)
+	}
+	b.sharedChats[name] = client.NewChat()
+	b.deleteSession("shared:" + name)
+}
+
+// replyChannel returns the channel a message should be answered in. With
+// AUTO_THREAD enabled, messages in a server channel are answered in the
+// author's thread for that channel, which is started on their first message
+// and named after it once answered.
+func (b *Bot) replyChannel(m *discordgo.MessageCreate) string {
+	if !b.config().AutoThread || m.GuildID == "" || b.isThread(m.ChannelID) {
+		return m.ChannelID
+	}
+
+	key := m.ChannelID + ":" + m.Author.ID
+	b.chatsMu.Lock()
+	threadID, ok := b.userThreads[key]
+	b.chatsMu.Unlock()
+	if ok {
+		return threadID
+	}
+
+	// Thread names are limited to 100 characters
+	thread, err := b.session.MessageThreadStartComplex(m.ChannelID, m.ID, &discordgo.ThreadStart{
+		Name:                truncate("Chat with Gemini – "+m.Author.Username, 100),
+		AutoArchiveDuration: 1440,
+	})
+	if err != nil {
+		messageLogger(m).Error("Error starting thread", "error", err)
+		return m.ChannelID
+	}
+
+	b.chatsMu.Lock()
+	b.threadChats[thread.ID] = b.aiFor(m.GuildID).NewChat()
+	b.userThreads[key] = thread.ID
+	b.chatsMu.Unlock()
+	b.untitledMu.Lock()
+	b.untitled[thread.ID] = true
+	b.untitledMu.Unlock()
+	return thread.ID
+}
+
+// forwardToThread quotes a message sent in the main channel inside the
+// author's existing thread, so the conversation can be followed there
+func (b *Bot) forwardToThread(m *discordgo.MessageCreate, threadID string) {
+	// Threads share the ID of the message they were started on, which
+	// already shows at the top of the thread
+	if threadID == m.ChannelID || threadID == m.ID || m.Content == "" {
+		return
+	}
+	_, err := b.session.ChannelMessageSendComplex(threadID, &discordgo.MessageSend{
+		Content:         truncate(fmt.Sprintf("<@%s>: %s", m.Author.ID, m.Content), 2000),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		messageLogger(m).Error("Error forwarding message to thread", "error", err)
+	}
+}
+
+// handleThreadDelete forgets the chat of a deleted bot-started thread
+func (b *Bot) handleThreadDelete(t *discordgo.ThreadDelete) {
+	b.chatsMu.Lock()
+	defer b.chatsMu.Unlock()
+
+	if chat, ok := b.threadChats[t.ID]; ok {
+		b.forgetLastTurn(chat)
+		delete(b.threadChats, t.ID)
+	}
+	b.deleteSession("thread:" + t.ID)
+	b.forgetCheckpoints(t.ID)
+	b.forgetProfileChats(t.ID)
+	b.forgetThreadSummary(t.ID)
+	for key, threadID := range b.userThreads {
+		if threadID == t.ID {
+			delete(b.userThreads, key)
+		}
+	}
+}
+
+// isThread reports whether a channel is a thread
+func (b *Bot) isThread(channelID string) bool {
+	channel, err := b.session.Channel(channelID)
+	if err != nil {
+		return false
+	}
+	return channel.IsThread()
+}
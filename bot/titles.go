@@ -0,0 +1,253 @@
+package bot
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// Custom ID of the button undoing a rename, followed by the ID of the
+	// renamed channel
+	renameUndoPrefix = "rename-undo:"
+
+	// Renames that can still be undone, the oldest are forgotten past this
+	// many
+	maxUndoableRenames = 100
+
+	// Messages of a channel /topic suggest reads
+	topicMessages = 100
+
+	// Discord's limits on thread names and channel topics
+	maxThreadNameLength = 100
+	maxTopicLength      = 1024
+)
+
+// rename is a change of a thread's name or a channel's topic, kept so it
+// can be undone by whoever asked for it or a member who manages channels
+type rename struct {
+	userID   string
+	topic    bool
+	previous string
+}
+
+// titleThread names a thread AUTO_THREAD started after its opening exchange,
+// once it's answered, and posts the new name with a button undoing it.
+// Threads keep their name when Gemini can't write one.
+func (b *Bot) titleThread(m *discordgo.MessageCreate, threadID string, answer string) {
+	b.untitledMu.Lock()
+	untitled := b.untitled[threadID]
+	delete(b.untitled, threadID)
+	b.untitledMu.Unlock()
+	if !untitled || m.Content == "" {
+		return
+	}
+	thread, err := b.session.Channel(threadID)
+	if err != nil {
+		messageLogger(m).Warn("Error looking up thread to name", "error", err)
+		return
+	}
+
+	prompt := "Write a title of at most six words for a Discord thread starting with the exchange below, in the language of its messages. " +
+		"Reply with the title only, without quotes or a trailing period.\n\n" +
+		fmt.Sprintf("Member: %s\n\nAnswer: %s", m.Content, truncate(answer, 2000))
+	title, err := b.generate(m.Author.ID, m.GuildID, genai.Text(prompt))
+	if err != nil {
+		messageLogger(m).Warn("Error writing thread title", "error", err)
+		return
+	}
+	title = cleanTitle(title, maxThreadNameLength)
+	if title == "" || title == thread.Name {
+		return
+	}
+	change := rename{userID: m.Author.ID, previous: thread.Name}
+	if _, err := b.session.ChannelEdit(threadID, &discordgo.ChannelEdit{Name: title}); err != nil {
+		messageLogger(m).Warn("Error naming thread", "error", err)
+		return
+	}
+	b.rememberRename(threadID, change)
+	messageLogger(m).Info("Named thread", "thread", threadID)
+
+	_, err = b.session.ChannelMessageSendComplex(threadID, &discordgo.MessageSend{
+		Content:    b.trGuild(m.GuildID, "-# Named this thread **%s**.", title),
+		Components: b.undoRenameComponents(m.GuildID, threadID),
+	})
+	if err != nil {
+		messageLogger(m).Error("Error sending thread name", "error", err)
+	}
+}
+
+// topicCommand handles /topic suggest, having the model sum up the recent
+// messages of a channel as its topic, or of a thread as its name, and
+// applying it with a button undoing it. It needs the Manage Channels
+// permission, or Manage Threads in threads.
+func (b *Bot) topicCommand(i *discordgo.InteractionCreate) {
+	channel, err := b.session.Channel(i.ChannelID)
+	if err != nil || i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Use this command in a server channel or thread."))
+		return
+	}
+	thread := channel.IsThread()
+	permission := int64(discordgo.PermissionManageChannels)
+	if thread {
+		permission = discordgo.PermissionManageThreads
+	}
+	if i.Member == nil || i.Member.Permissions&permission == 0 {
+		if thread {
+			b.respondEphemeral(i, tr(i, "You need the Manage Threads permission to rename this thread."))
+		} else {
+			b.respondEphemeral(i, tr(i, "You need the Manage Channels permission to change this channel's topic."))
+		}
+		return
+	}
+
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to topic command", "error", err)
+		return
+	}
+	messages, err := b.session.ChannelMessages(i.ChannelID, topicMessages, "", "", "")
+	if err != nil {
+		interactionLogger(i).Error("Error reading channel history", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	var transcript strings.Builder
+	for _, m := range slices.Backward(messages) {
+		if m.Author != nil && !m.Author.Bot && m.Content != "" {
+			fmt.Fprintf(&transcript, "%s: %s\n", m.Author.Username, m.Content)
+		}
+	}
+	if transcript.Len() == 0 {
+		b.editInteractionResponse(i, tr(i, "There's nothing to go on here yet."))
+		return
+	}
+
+	prompt := "Write a channel topic of one short sentence, at most 200 characters, saying what the Discord channel below is about, in the language of its messages. " +
+		"Reply with the topic only.\n\n"
+	limit := maxTopicLength
+	if thread {
+		prompt = "Write a title of at most six words for the Discord thread below, in the language of its messages. " +
+			"Reply with the title only, without quotes or a trailing period.\n\n"
+		limit = maxThreadNameLength
+	}
+	text, err := b.generate(interactionUserID(i), i.GuildID, genai.Text(prompt+b.untrusted(interactionUserID(i), i.GuildID, "the channel's messages", transcript.String())))
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	text = cleanTitle(text, limit)
+	if text == "" {
+		b.editInteractionResponse(i, tr(i, "Gemini didn't come up with anything, try again later."))
+		return
+	}
+
+	change := rename{userID: interactionUserID(i), topic: !thread, previous: channel.Topic}
+	edit := &discordgo.ChannelEdit{Topic: text}
+	content := tr(i, "Set this channel's topic to:\n> %s", text)
+	if thread {
+		change.previous = channel.Name
+		edit = &discordgo.ChannelEdit{Name: text}
+		content = tr(i, "Named this thread **%s**.", text)
+	}
+	if _, err := b.session.ChannelEdit(i.ChannelID, edit); err != nil {
+		interactionLogger(i).Error("Error changing channel", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	b.rememberRename(i.ChannelID, change)
+	interactionLogger(i).Info("Applied suggested topic", "thread", thread)
+
+	components := b.undoRenameComponents(i.GuildID, i.ChannelID)
+	_, err = b.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content, Components: &components})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to topic command", "error", err)
+	}
+}
+
+// undoRename handles the button undoing a channel's latest rename, which
+// only whoever asked for it or a member who manages channels may press
+func (b *Bot) undoRename(i *discordgo.InteractionCreate) {
+	channelID := strings.TrimPrefix(i.MessageComponentData().CustomID, renameUndoPrefix)
+	userID := interactionUserID(i)
+	manager := i.Member != nil && i.Member.Permissions&(discordgo.PermissionManageChannels|discordgo.PermissionManageThreads) != 0
+
+	b.renamesMu.Lock()
+	change, ok := b.renames[channelID]
+	allowed := ok && (change.userID == userID || manager)
+	if allowed {
+		delete(b.renames, channelID)
+		b.renameOrder = slices.DeleteFunc(b.renameOrder, func(id string) bool { return id == channelID })
+	}
+	b.renamesMu.Unlock()
+
+	if !ok {
+		b.respondEphemeral(i, tr(i, "This can't be undone anymore."))
+		return
+	}
+	if !allowed {
+		b.respondEphemeral(i, tr(i, "Only whoever asked for this change or a member who manages channels can undo it."))
+		return
+	}
+
+	edit := &discordgo.ChannelEdit{Name: change.previous}
+	content := tr(i, "Undone, the thread is named **%s** again.", change.previous)
+	if change.topic {
+		edit = &discordgo.ChannelEdit{Topic: change.previous}
+		content = tr(i, "Undone, the channel's topic is back to what it was.")
+		if change.previous == "" {
+			// Empty topics are left out of the request, so a space
+			// stands for none
+			edit.Topic = " "
+		}
+	}
+	if _, err := b.session.ChannelEdit(channelID, edit); err != nil {
+		interactionLogger(i).Error("Error undoing rename", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	interactionLogger(i).Info("Undid rename", "renamed_channel", channelID)
+
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{Content: content, Components: []discordgo.MessageComponent{}},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error updating rename message", "error", err)
+	}
+}
+
+// rememberRename keeps a channel's latest rename so it can be undone
+func (b *Bot) rememberRename(channelID string, change rename) {
+	b.renamesMu.Lock()
+	defer b.renamesMu.Unlock()
+	if _, ok := b.renames[channelID]; !ok {
+		b.renameOrder = append(b.renameOrder, channelID)
+	}
+	b.renames[channelID] = change
+	if len(b.renameOrder) > maxUndoableRenames {
+		delete(b.renames, b.renameOrder[0])
+		b.renameOrder = b.renameOrder[1:]
+	}
+}
+
+// undoRenameComponents returns the button undoing a channel's rename
+func (b *Bot) undoRenameComponents(guildID string, channelID string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{CustomID: renameUndoPrefix + channelID, Label: b.trGuild(guildID, "Undo"), Style: discordgo.SecondaryButton},
+		}},
+	}
+}
+
+// cleanTitle trims the quotes, markdown and trailing period the model may
+// put around a title or topic, keeping its first line within limit
+func cleanTitle(text string, limit int) string {
+	text, _, _ = strings.Cut(strings.TrimSpace(text), "\n")
+	text = strings.Trim(strings.TrimSpace(text), "\"'*_`“”#")
+	text = strings.TrimSuffix(strings.TrimSpace(text), ".")
+	return truncate(strings.TrimSpace(text), limit)
+}
@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+func TestTitleThread(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "Generics let functions take type parameters."}}, text: "\"Go generics basics.\""}
+	b, session := newTestBot(t, client)
+	b.config().AutoThread = true
+
+	b.HandleMessage(userMessage("how do generics work in Go?"))
+	thread := session.channels["message"]
+	if thread == nil || thread.Name != "Go generics basics" {
+		t.Fatalf("thread = %+v, want it named after the exchange", thread)
+	}
+	if len(session.messages) != 2 || !strings.Contains(session.messages[1], "**Go generics basics**") {
+		t.Errorf("messages = %q, want the new name posted", session.messages)
+	}
+
+	// Later answers keep the name
+	b.HandleMessage(&discordgo.MessageCreate{Message: &discordgo.Message{
+		ID: "second", ChannelID: "message", GuildID: "guild", Content: "and constraints?",
+		Author: &discordgo.User{ID: "user", Username: "alice"},
+	}})
+	if len(client.prompts) != 1 {
+		t.Errorf("prompts = %d, want the thread named once", len(client.prompts))
+	}
+
+	// Only the author or a member managing channels can undo it
+	undo := settingsInteraction(0, discordgo.MessageComponentInteractionData{CustomID: renameUndoPrefix + "message"})
+	b.HandleInteraction(undo)
+	if last := session.responses[len(session.responses)-1]; !strings.Contains(last.Data.Content, "Only whoever asked") {
+		t.Fatalf("response = %v, want the member refused", last.Data)
+	}
+	undo.Member.User.ID = "user"
+	b.HandleInteraction(undo)
+	if thread.Name != "Chat with Gemini – alice" {
+		t.Errorf("thread name = %q, want the name it was started with", thread.Name)
+	}
+	b.HandleInteraction(undo)
+	if last := session.responses[len(session.responses)-1]; !strings.Contains(last.Data.Content, "can't be undone") {
+		t.Errorf("response = %v, want nothing left to undo", last.Data)
+	}
+}
+
+func TestTopicSuggest(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{text: "Help with Go and its tooling."})
+	session.channels["channel"] = &discordgo.Channel{ID: "channel", GuildID: "guild", Type: discordgo.ChannelTypeGuildText}
+	session.history["channel"] = []*discordgo.Message{
+		{ID: "2", Content: "go vet flags it", Author: &discordgo.User{ID: "bob", Username: "bob"}},
+		{ID: "1", Content: "why does my loop variable leak?", Author: &discordgo.User{ID: "user", Username: "alice"}},
+	}
+	command := commandInteraction("topic")
+	command.ChannelID = "channel"
+	command.Data = discordgo.ApplicationCommandInteractionData{
+		Name:    "topic",
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{{Name: "suggest", Type: discordgo.ApplicationCommandOptionSubCommand}},
+	}
+
+	b.HandleInteraction(command)
+	if len(session.responses) != 1 || !strings.Contains(session.responses[0].Data.Content, "Manage Channels") {
+		t.Fatalf("responses = %v, want the member refused", session.responses)
+	}
+
+	command.Member.Permissions = discordgo.PermissionManageChannels
+	b.HandleInteraction(command)
+	if topic := session.channels["channel"].Topic; topic != "Help with Go and its tooling" {
+		t.Fatalf("topic = %q, want the suggestion applied", topic)
+	}
+	if len(session.edits) != 1 || session.edits[0].Components == nil || len(*session.edits[0].Components) != 1 {
+		t.Errorf("edits = %v, want the topic shown with an undo button", session.edits)
+	}
+
+	undo := settingsInteraction(0, discordgo.MessageComponentInteractionData{CustomID: renameUndoPrefix + "channel"})
+	undo.Member.User.ID = "user"
+	b.HandleInteraction(undo)
+	if topic := session.channels["channel"].Topic; topic != "" {
+		t.Errorf("topic = %q, want it cleared again", topic)
+	}
+}
@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+)
+
+// promptCost estimates what a prompt of the given size costs, in US dollars
+func (b *Bot) promptCost(tokens int) float64 {
+	return float64(tokens) * b.config().PromptTokenPrice / 1_000_000
+}
+
+// tokensCommand handles /tokens, counting the tokens of a text for the
+// server's model along with what it would cost as a prompt
+func (b *Bot) tokensCommand(i *discordgo.InteractionCreate) {
+	text := commandOption(i.ApplicationCommandData().Options, "text").StringValue()
+
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to tokens command", "error", err)
+		return
+	}
+	tokens, err := b.aiFor(i.GuildID).CountTokens(b.requestContext(i.GuildID, i.ChannelID), b.scrubParts(i.GuildID, []genai.Part{genai.Text(text)})...)
+	if err != nil {
+		interactionLogger(i).Error("Error counting tokens", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	b.editInteractionResponse(i, tr(i, "That's **%d** tokens, about $%.4f as a prompt.", tokens, b.promptCost(tokens)))
+}
+
+// warnLargePrompt counts the tokens a chat message sends along with the
+// chat's history, posting a warning with the estimated cost when they pass
+// the configured size. Only messages with attachments or a long history
+// are counted, as only they can get that large.
+func (b *Bot) warnLargePrompt(m *discordgo.MessageCreate, channelID string, chat ai.Chat, parts []genai.Part) {
+	limit := b.config().LargePromptTokens
+	history := chat.History()
+	if limit == 0 || (len(m.Attachments) == 0 && len(history) <= recentHistoryEntries) {
+		return
+	}
+
+	var all []genai.Part
+	for _, content := range history {
+		all = append(all, content.Parts...)
+	}
+	tokens, err := b.aiFor(m.GuildID).CountTokens(b.requestContext(m.GuildID, m.ChannelID), append(all, parts...)...)
+	if err != nil {
+		messageLogger(m).Error("Error counting prompt tokens", "error", err)
+		return
+	}
+	if tokens <= limit {
+		return
+	}
+
+	messageLogger(m).Info("Large prompt", "tokens", tokens, "limit", limit)
+	warning := b.trGuild(m.GuildID, "⚠️ With the conversation so far this is a large request: about %d tokens, costing around $%.4f before the answer. Use `/clear` to start over with less context.",
+		tokens, b.promptCost(tokens))
+	if _, err := b.session.ChannelMessageSend(channelID, warning); err != nil {
+		messageLogger(m).Error("Error sending large prompt warning", "error", err)
+	}
+}
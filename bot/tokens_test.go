@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+func TestTokensCommand(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{tokens: 2000})
+	cfg := *b.config()
+	cfg.PromptTokenPrice = 1.25
+	b.SetConfig(&cfg)
+
+	i := promptInteraction("alice", 0, "")
+	i.Data = discordgo.ApplicationCommandInteractionData{Name: "tokens", Options: []*discordgo.ApplicationCommandInteractionDataOption{
+		stringOption("text", "How many tokens is this?"),
+	}}
+	b.HandleInteraction(i)
+	if len(session.edits) != 1 || *session.edits[0].Content != "That's **2000** tokens, about $0.0025 as a prompt." {
+		t.Errorf("edits = %v, want the count and cost", session.edits)
+	}
+}
+
+func TestWarnLargePrompt(t *testing.T) {
+	fake := &fakeAI{tokens: 150000}
+	b, session := newTestBot(t, fake)
+	cfg := *b.config()
+	cfg.LargePromptTokens = 100000
+	cfg.PromptTokenPrice = 1.25
+	b.SetConfig(&cfg)
+
+	long := &fakeChat{ai: fake}
+	for range recentHistoryEntries + 1 {
+		long.history = append(long.history, &genai.Content{Role: "user", Parts: []genai.Part{genai.Text("hi")}})
+	}
+	attachment := userMessage("what's in this?")
+	attachment.Attachments = []*discordgo.MessageAttachment{{Filename: "book.pdf"}}
+
+	tests := []struct {
+		name   string
+		m      *discordgo.MessageCreate
+		chat   *fakeChat
+		tokens int
+		limit  int
+		want   bool
+	}{
+		{"short chat", userMessage("hello"), &fakeChat{ai: fake}, 150000, 100000, false},
+		{"long history", userMessage("hello"), long, 150000, 100000, true},
+		{"attachment", attachment, &fakeChat{ai: fake}, 150000, 100000, true},
+		{"under the limit", attachment, &fakeChat{ai: fake}, 50000, 100000, false},
+		{"warnings off", attachment, &fakeChat{ai: fake}, 150000, 0, false},
+	}
+	for _, test := range tests {
+		session.messages = nil
+		fake.tokens = test.tokens
+		cfg.LargePromptTokens = test.limit
+		b.SetConfig(&cfg)
+		b.warnLargePrompt(test.m, "channel", test.chat, []genai.Part{genai.Text(test.m.Content)})
+		warned := len(session.messages) == 1 && strings.Contains(session.messages[0], "about 150000 tokens, costing around $0.1875")
+		if warned != test.want || (!test.want && len(session.messages) > 0) {
+			t.Errorf("%s: messages = %q, want a warning %v", test.name, session.messages, test.want)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// Names of the message context-menu commands (right-click → Apps)
+	translateCommandName = "Translate"
+	explainCommandName   = "Explain (ELI5)"
+
+	// Language select custom IDs are "translate:<channelID>:<messageID>"
+	translateSelectPrefix = "translate:"
+)
+
+// Languages offered when picking a translation target
+// (select menus are limited to 25 options)
+var languages = []string{
+	"English", "Spanish", "French", "German", "Italian",
+	"Portuguese", "Dutch", "Russian", "Ukrainian", "Polish",
+	"Turkish", "Arabic", "Hebrew", "Hindi", "Bengali",
+	"Chinese (Simplified)", "Chinese (Traditional)", "Japanese", "Korean", "Vietnamese",
+	"Thai", "Indonesian", "Swedish", "Greek", "Czech",
+}
+
+// translateMessage translates the selected message into the invoker's
+// Discord locale and lets them pick another language from a select menu
+func (b *Bot) translateMessage(i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	message := data.Resolved.Messages[data.TargetID]
+
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to translate command", "error", err)
+		return
+	}
+
+	language := localeLanguage(i.Locale)
+	b.sendTranslation(i, message, language)
+}
+
+// retranslateMessage handles a language picked from the select menu
+// attached to a previous translation
+func (b *Bot) retranslateMessage(i *discordgo.InteractionCreate) {
+	data := i.MessageComponentData()
+
+	ids := strings.SplitN(strings.TrimPrefix(data.CustomID, translateSelectPrefix), ":", 2)
+	if len(ids) != 2 || len(data.Values) == 0 {
+		interactionLogger(i).Warn("Malformed translate select", "custom_id", data.CustomID)
+		return
+	}
+
+	// Acknowledge now and edit the ephemeral message once translated
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to translate select", "error", err)
+		return
+	}
+
+	message, err := b.session.ChannelMessage(ids[0], ids[1])
+	if err != nil {
+		interactionLogger(i).Error("Error fetching message", "message", ids[1], "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, I couldn't read that message."))
+		return
+	}
+	b.sendTranslation(i, message, data.Values[0])
+}
+
+// sendTranslation translates a message and edits the deferred interaction
+// response with the result and a language picker
+func (b *Bot) sendTranslation(i *discordgo.InteractionCreate, message *discordgo.Message, language string) {
+	if message == nil || message.Content == "" {
+		b.editInteractionResponse(i, tr(i, "That message has no text to translate."))
+		return
+	}
+
+	prompt := fmt.Sprintf("Translate the following message into %s. Reply with only the translation.\n\n%s",
+		language, message.Content)
+	translation, err := b.generate(interactionUserID(i), i.GuildID, genai.Text(prompt))
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if translation == "" {
+		translation = "I couldn't generate a translation."
+	}
+
+	chunks := splitMessage(fmt.Sprintf("**%s:**\n%s", language, translation))
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				languageSelect(translateSelectPrefix+message.ChannelID+":"+message.ID, language),
+			},
+		},
+	}
+	_, err = b.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:    &chunks[0],
+		Components: &components,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error editing interaction response", "error", err)
+		return
+	}
+	for _, chunk := range chunks[1:] {
+		_, err := b.session.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+			Content: chunk,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		})
+		if err != nil {
+			interactionLogger(i).Error("Error sending translation follow-up", "error", err)
+			return
+		}
+	}
+}
+
+// translationResult is the structured response requested from Gemini by /translate
+type translationResult struct {
+	DetectedLanguage string `json:"detected_language"`
+	Translation      string `json:"translation"`
+}
+
+// translateText handles /translate, replying with the translation and the
+// detected source language
+func (b *Bot) translateText(i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	text := commandOption(options, "text").StringValue()
+	language := commandOption(options, "to").StringValue()
+
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to translate command", "error", err)
+		return
+	}
+
+	result, err := b.detectAndTranslate(interactionUserID(i), i.GuildID, text, language)
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	b.editInteractionResponseLong(i, fmt.Sprintf("**%s → %s:**\n%s",
+		result.DetectedLanguage, language, result.Translation), 0)
+}
+
+// detectAndTranslate asks Gemini, on behalf of a user, for a JSON object
+// holding both the detected source language and the translation
+func (b *Bot) detectAndTranslate(userID string, guildID string, text string, language string) (*translationResult, error) {
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"detected_language": {
+				Type:        genai.TypeString,
+				Description: "English name of the language the text is written in",
+			},
+			"translation": {
+				Type:        genai.TypeString,
+				Description: "The translated text",
+			},
+		},
+		Required: []string{"detected_language", "translation"},
+	}
+
+	prompt := fmt.Sprintf("Detect the language of the following text and translate it into %s.\n\n%s", language, text)
+	text, err := b.generateJSON(userID, guildID, schema, genai.Text(prompt))
+	if err != nil {
+		return nil, err
+	}
+
+	var result translationResult
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
+		return nil, fmt.Errorf("error parsing translation: %v", err)
+	}
+	return &result, nil
+}
+
+// autocompleteLanguage suggests target languages matching what the user has
+// typed so far, keeping their input as a choice so any language can be used
+func (b *Bot) autocompleteLanguage(i *discordgo.InteractionCreate) {
+	typed := ""
+	if option := commandOption(i.ApplicationCommandData().Options, "to"); option != nil {
+		typed = strings.TrimSpace(option.StringValue())
+	}
+
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	exact := false
+	for _, language := range languages {
+		if strings.Contains(strings.ToLower(language), strings.ToLower(typed)) {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: language, Value: language})
+			exact = exact || strings.EqualFold(language, typed)
+		}
+	}
+	// Choice names and values are limited to 100 characters
+	if typed != "" && !exact && len(choices) < 25 && utf8.RuneCountInString(typed) <= 100 {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: typed, Value: typed})
+	}
+
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to language autocomplete", "error", err)
+	}
+}
+
+// explainMessage explains the selected message in simple terms
+func (b *Bot) explainMessage(i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	message := data.Resolved.Messages[data.TargetID]
+
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to explain command", "error", err)
+		return
+	}
+
+	explanation, err := b.generate(interactionUserID(i), i.GuildID, b.explainParts(interactionUserID(i), i.GuildID, message)...)
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if explanation == "" {
+		explanation = "I couldn't generate an explanation."
+	}
+	b.editInteractionResponseLong(i, explanation, discordgo.MessageFlagsEphemeral)
+}
+
+// explainParts builds the prompt asking for a simple explanation of a
+// message and its attachments, for userID
+func (b *Bot) explainParts(userID string, guildID string, message *discordgo.Message) []genai.Part {
+	parts := b.uploadAttachments(userID, guildID, message.Attachments)
+	prompt := fmt.Sprintf("Explain the following Discord message (and any attached files) in simple terms, "+
+		"as if to a five-year-old. Keep it short.\n\n%s", b.untrusted(userID, guildID, "a message by "+message.Author.Username, message.Content))
+	return append(parts, genai.Text(prompt))
+}
+
+// languageSelect builds a select menu of translation languages with the
+// current language preselected
+func languageSelect(customID string, current string) discordgo.SelectMenu {
+	options := make([]discordgo.SelectMenuOption, 0, len(languages))
+	for _, language := range languages {
+		options = append(options, discordgo.SelectMenuOption{
+			Label:   language,
+			Value:   language,
+			Default: language == current,
+		})
+	}
+	return discordgo.SelectMenu{
+		CustomID:    customID,
+		Placeholder: "Translate to another language",
+		Options:     options,
+	}
+}
+
+// Plain language names for Discord locales, matching the entries of
+// languages where there is one so the select menu can preselect them
+var localeLanguages = map[discordgo.Locale]string{
+	discordgo.EnglishUS:    "English",
+	discordgo.EnglishGB:    "English",
+	discordgo.Bulgarian:    "Bulgarian",
+	discordgo.ChineseCN:    "Chinese (Simplified)",
+	discordgo.ChineseTW:    "Chinese (Traditional)",
+	discordgo.Croatian:     "Croatian",
+	discordgo.Czech:        "Czech",
+	discordgo.Danish:       "Danish",
+	discordgo.Dutch:        "Dutch",
+	discordgo.Finnish:      "Finnish",
+	discordgo.French:       "French",
+	discordgo.German:       "German",
+	discordgo.Greek:        "Greek",
+	discordgo.Hindi:        "Hindi",
+	discordgo.Hungarian:    "Hungarian",
+	discordgo.Italian:      "Italian",
+	discordgo.Japanese:     "Japanese",
+	discordgo.Korean:       "Korean",
+	discordgo.Lithuanian:   "Lithuanian",
+	discordgo.Norwegian:    "Norwegian",
+	discordgo.Polish:       "Polish",
+	discordgo.PortugueseBR: "Portuguese",
+	discordgo.Romanian:     "Romanian",
+	discordgo.Russian:      "Russian",
+	discordgo.SpanishES:    "Spanish",
+	discordgo.SpanishLATAM: "Spanish",
+	discordgo.Swedish:      "Swedish",
+	discordgo.Thai:         "Thai",
+	discordgo.Turkish:      "Turkish",
+	discordgo.Ukrainian:    "Ukrainian",
+	discordgo.Vietnamese:   "Vietnamese",
+}
+
+// localeLanguage returns the language name for a Discord locale,
+// defaulting to English for unknown locales
+func localeLanguage(locale discordgo.Locale) string {
+	if name, ok := localeLanguages[locale]; ok {
+		return name
+	}
+	return "English"
+}
@@ -0,0 +1,190 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/audit"
+	"go-discord-bot/store"
+)
+
+// Sent instead of an answer once a server's monthly token cap is reached
+const quotaExhaustedMessage = "This server has used up its AI quota for the month, it resets on the 1st (UTC)."
+
+// generate sends a one-off prompt on behalf of a user, recording its usage,
+// and returns the response text
+func (b *Bot) generate(userID string, guildID string, parts ...genai.Part) (string, error) {
+	return b.generateContext(b.requestContext(guildID, ""), userID, guildID, parts...)
+}
+
+// generateContext is generate with the context of the request, such as one
+// limiting the answer's length
+func (b *Bot) generateContext(ctx context.Context, userID string, guildID string, parts ...genai.Part) (string, error) {
+	parts, err := b.beforePrompt(userID, guildID, b.scrubParts(guildID, parts))
+	if err != nil {
+		return "", err
+	}
+
+	// Identical prompts get the same answer for a while, using no tokens
+	key, cacheable := b.responseCacheKey(guildID, parts)
+	if cacheable {
+		if reply := b.cachedReply(key); reply != nil {
+			b.auditExchange(userID, guildID, parts, reply, nil)
+			return b.fixMentions(guildID, b.afterResponse(userID, guildID, reply.Text)), nil
+		}
+	}
+
+	reply, err := b.aiFor(guildID).Generate(ctx, parts...)
+	b.auditExchange(userID, guildID, parts, reply, err)
+	if err != nil {
+		return "", err
+	}
+	b.recordUsage(userID, guildID, reply)
+	if cacheable && reply.Text != "" {
+		b.cacheReply(key, reply)
+	}
+	return b.fixMentions(guildID, b.afterResponse(userID, guildID, reply.Text)), nil
+}
+
+// generateJSON sends a one-off prompt on behalf of a user, recording its
+// usage, and returns a JSON response matching schema
+func (b *Bot) generateJSON(userID string, guildID string, schema *genai.Schema, parts ...genai.Part) (string, error) {
+	parts, err := b.beforePrompt(userID, guildID, b.scrubParts(guildID, parts))
+	if err != nil {
+		return "", err
+	}
+	reply, err := b.aiFor(guildID).GenerateJSON(b.ctx, schema, parts...)
+	b.auditExchange(userID, guildID, parts, reply, err)
+	if err != nil {
+		return "", err
+	}
+	b.recordUsage(userID, guildID, reply)
+	return reply.Text, nil
+}
+
+// recordUsage adds a reply's tokens to the usage of the user and guild it
+// was generated for
+func (b *Bot) recordUsage(userID string, guildID string, reply *ai.Reply) {
+	err := b.state().RecordUsage(userID, guildID, time.Now(), reply.PromptTokens, reply.ResponseTokens)
+	if err != nil {
+		slog.Error("Error recording usage", "user", userID, "guild", guildID, "error", err)
+	}
+}
+
+// auditExchange records a prompt and the reply or error it got in the audit
+// log, when auditing is on
+func (b *Bot) auditExchange(userID string, guildID string, parts []genai.Part, reply *ai.Reply, err error) {
+	if b.audit == nil {
+		return
+	}
+	entry := audit.Entry{UserID: userID, GuildID: guildID, Prompt: partsText(parts)}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Model = reply.Model
+		entry.Response = reply.Text
+		entry.FinishReason = reply.FinishReason
+		entry.SafetyFlags = reply.SafetyFlags
+	}
+	b.audit.Record(entry)
+}
+
+// quotaExhausted reports whether a guild has reached its monthly token cap
+func (b *Bot) quotaExhausted(guildID string) bool {
+	if guildID == "" || b.config().MonthlyGuildTokenCap == 0 {
+		return false
+	}
+	usage, err := b.state().GuildUsage(guildID, monthStart(time.Now()))
+	if err != nil {
+		slog.Error("Error loading guild usage", "guild", guildID, "error", err)
+		return false
+	}
+	return usage.Tokens() >= b.config().MonthlyGuildTokenCap
+}
+
+// usesAI reports whether handling an interaction calls the model, so it is
+// refused once the guild's quota is exhausted
+func usesAI(i *discordgo.InteractionCreate) bool {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		switch i.ApplicationCommandData().Name {
+		case "help", "clear", "stop", "memory", "index", "usage", "stats", "provider", "admin", "mydata", "forgetme", "schedule", "moderation", "reactions", "export", "checkpoint", "chat", "settings", "tokens", "character", "abtest", "feedback", "script":
+			return false
+		case "prompt":
+			return i.ApplicationCommandData().Options[0].Name == "run"
+		case "welcome":
+			return i.ApplicationCommandData().Options[0].Name == "preview"
+		case "quiz":
+			return i.ApplicationCommandData().Options[0].Name == "start"
+		case "voice":
+			return i.ApplicationCommandData().Options[0].Name == "join"
+		case "dm":
+			subcommand := i.ApplicationCommandData().Options[0].Name
+			return subcommand == "start" || subcommand == "recap"
+		}
+		return true
+	case discordgo.InteractionMessageComponent:
+		customID := i.MessageComponentData().CustomID
+		return customID != helpSelectID && !strings.HasPrefix(customID, settingsPrefix) &&
+			!strings.HasPrefix(customID, pollPrefix) && !strings.HasPrefix(customID, quizPrefix) &&
+			!strings.HasPrefix(customID, announcePrefix) && !strings.HasPrefix(customID, renameUndoPrefix) &&
+			!strings.HasPrefix(customID, stopPrefix) && !strings.HasPrefix(customID, attachmentsCancelPrefix) && !strings.HasPrefix(customID, feedbackPrefix)
+	case discordgo.InteractionModalSubmit:
+		customID := i.ModalSubmitData().CustomID
+		return customID != settingsModalID && customID != characterModalID && !strings.HasPrefix(customID, pollModalPrefix) &&
+			!strings.HasPrefix(customID, announceModalPrefix)
+	}
+	return false
+}
+
+// usageCommand handles /usage, showing the user's and the server's usage
+// for today and this month
+func (b *Bot) usageCommand(i *discordgo.InteractionCreate) {
+	now := time.Now()
+	month := monthStart(now)
+
+	var sb strings.Builder
+	userID := interactionUserID(i)
+	today, err := b.state().UserUsage(userID, now)
+	if err == nil {
+		var thisMonth store.Usage
+		thisMonth, err = b.state().UserUsage(userID, month)
+		sb.WriteString(tr(i, "**Your usage**\nToday: %s\nThis month: %s\n", formatUsage(i, today), formatUsage(i, thisMonth)))
+	}
+
+	if err == nil && i.GuildID != "" {
+		var today, thisMonth store.Usage
+		today, err = b.state().GuildUsage(i.GuildID, now)
+		if err == nil {
+			thisMonth, err = b.state().GuildUsage(i.GuildID, month)
+		}
+		sb.WriteString(tr(i, "\n**This server**\nToday: %s\nThis month: %s", formatUsage(i, today), formatUsage(i, thisMonth)))
+		if limit := b.config().MonthlyGuildTokenCap; limit > 0 {
+			sb.WriteString(" " + tr(i, "(cap %d tokens)", limit))
+		}
+	}
+
+	if err != nil {
+		interactionLogger(i).Error("Error loading usage", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, I couldn't load the usage."))
+		return
+	}
+	b.respondEphemeral(i, sb.String())
+}
+
+// formatUsage describes usage as requests and tokens
+func formatUsage(i *discordgo.InteractionCreate, u store.Usage) string {
+	return tr(i, "%d requests, %d tokens", u.Requests, u.Tokens())
+}
+
+// monthStart returns the first day of t's month (UTC)
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
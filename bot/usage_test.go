@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/audit"
+)
+
+func TestHandleMessageRecordsUsage(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello", PromptTokens: 30, ResponseTokens: 5}}}
+	b, _ := newTestBot(t, client)
+
+	b.HandleMessage(userMessage("hi"))
+
+	usage, err := b.store.GuildUsage("guild", time.Now())
+	if err != nil {
+		t.Fatalf("GuildUsage: %v", err)
+	}
+	if usage.Requests != 1 || usage.Tokens() != 35 {
+		t.Errorf("usage = %+v, want 1 request and 35 tokens", usage)
+	}
+}
+
+func TestMonthlyGuildTokenCap(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello", PromptTokens: 80, ResponseTokens: 20}}}
+	b, session := newTestBot(t, client)
+	b.config().MonthlyGuildTokenCap = 100
+
+	b.HandleMessage(userMessage("hi"))
+	b.HandleMessage(userMessage("hi again"))
+
+	if len(session.messages) != 2 || session.messages[1] != quotaExhaustedMessage {
+		t.Errorf("sent %q, want the quota message second", session.messages)
+	}
+
+	// Commands using the model are refused too, /usage still works
+	b.HandleInteraction(&discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:    discordgo.InteractionApplicationCommand,
+		GuildID: "guild",
+		Member:  &discordgo.Member{User: &discordgo.User{ID: "user"}},
+		Data:    discordgo.ApplicationCommandInteractionData{Name: "usage"},
+	}})
+	if len(session.responses) != 1 || session.responses[0].Data.Content == quotaExhaustedMessage {
+		t.Errorf("/usage responded %v", session.responses)
+	}
+}
+
+func TestSetConfigRaisesCap(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello", PromptTokens: 80, ResponseTokens: 20}}}
+	b, session := newTestBot(t, client)
+	b.config().MonthlyGuildTokenCap = 100
+
+	b.HandleMessage(userMessage("hi"))
+	b.HandleMessage(userMessage("hi again"))
+
+	// A reloaded configuration applies to the next message
+	cfg := *b.config()
+	cfg.MonthlyGuildTokenCap = 1000
+	b.SetConfig(&cfg)
+	b.HandleMessage(userMessage("and again"))
+
+	want := []string{"hello", quotaExhaustedMessage, "hello"}
+	if !slices.Equal(session.messages, want) {
+		t.Errorf("sent %q, want %q", session.messages, want)
+	}
+}
+
+func TestAuditRecordsExchanges(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "hello", Model: "gemini-test", FinishReason: "STOP"}}}
+	b, _ := newTestBot(t, client)
+	b.SetAudit(audit.New(b.store.AuditSink(), audit.Options{}))
+
+	b.HandleMessage(userMessage("hi"))
+	client.err = errors.New("quota exceeded")
+	b.HandleMessage(userMessage("hi again"))
+
+	entries, err := b.store.AuditEntries(time.Time{})
+	if err != nil {
+		t.Fatalf("AuditEntries: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("recorded %d entries, want 2", len(entries))
+	}
+	if e := entries[0]; e.UserID != "user" || e.GuildID != "guild" || e.Prompt != "hi" || e.Response != "hello" || e.Model != "gemini-test" || e.FinishReason != "STOP" {
+		t.Errorf("first entry = %+v", e)
+	}
+	if e := entries[1]; e.Prompt != "hi again" || e.Error != "quota exceeded" {
+		t.Errorf("second entry = %+v", e)
+	}
+}
+
+func TestMonthStart(t *testing.T) {
+	got := monthStart(time.Date(2024, 2, 29, 23, 0, 0, 0, time.UTC))
+	if want := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("monthStart = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+)
+
+// Answer lengths servers and members can pick, normal being the default
+const (
+	verbosityConcise  = "concise"
+	verbosityNormal   = "normal"
+	verbosityDetailed = "detailed"
+)
+
+// verbosityPreset is how an answer length is asked of the model: the most
+// tokens the answer may take, 0 for the model's limit, and how it's told to
+// write
+type verbosityPreset struct {
+	label           string
+	maxOutputTokens int
+	instruction     string
+}
+
+// verbosityPresets are the answer lengths by name. Guilds keeping normal
+// answers store no verbosity.
+var verbosityPresets = map[string]verbosityPreset{
+	verbosityConcise: {
+		label:           "Concise",
+		maxOutputTokens: 400,
+		instruction:     "Keep the answer short enough for a chat: a few sentences, or a short list, without an introduction or a closing summary.",
+	},
+	verbosityNormal: {label: "Normal"},
+	verbosityDetailed: {
+		label:       "Detailed",
+		instruction: "Answer thoroughly, explaining your reasoning with examples, and use headings or lists where they help.",
+	},
+}
+
+// verbosityChoices returns the answer lengths as command option choices
+func verbosityChoices() []*discordgo.ApplicationCommandOptionChoice {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, name := range []string{verbosityConcise, verbosityNormal, verbosityDetailed} {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: verbosityPresets[name].label, Value: name})
+	}
+	return choices
+}
+
+// verbosityLabel describes a guild's answer length, normal when it has none
+func verbosityLabel(verbosity string) string {
+	if preset, ok := verbosityPresets[verbosity]; ok {
+		return preset.label
+	}
+	return verbosityPresets[verbosityNormal].label
+}
+
+// answerContext returns the context of a request answering a member in a
+// guild's channel, like requestContext, with the answer kept within the
+// token limit of verbosity
+func (b *Bot) answerContext(guildID string, channelID string, verbosity string) context.Context {
+	settings := b.guildSettings(guildID)
+	return ai.WithRequestOptions(b.ctx, ai.RequestOptions{
+		Model:           settings.Model,
+		Safety:          b.safetyLevel(settings, channelID),
+		MaxOutputTokens: verbosityPresets[verbosity].maxOutputTokens,
+	})
+}
+
+// withVerbosity prepends how long the answer should be to a message's parts,
+// leaving them as they are for normal answers
+func withVerbosity(verbosity string, parts []genai.Part) []genai.Part {
+	instruction := verbosityPresets[verbosity].instruction
+	if instruction == "" {
+		return parts
+	}
+	return append([]genai.Part{genai.Text(instruction)}, parts...)
+}
+
+// askCommand handles /ask, answering a one-off question in the channel at
+// the length the member picked, or the server's
+func (b *Bot) askCommand(i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	question := commandOption(options, "question").StringValue()
+	settings := b.guildSettings(i.GuildID)
+	verbosity := settings.Verbosity
+	if option := commandOption(options, "length"); option != nil {
+		verbosity = option.StringValue()
+	}
+
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to ask command", "error", err)
+		return
+	}
+
+	parts := withGuildSettings(settings, question, withVerbosity(verbosity, []genai.Part{genai.Text(question)}))
+	text, err := b.generateContext(b.answerContext(i.GuildID, i.ChannelID, verbosity), interactionUserID(i), i.GuildID, parts...)
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if text == "" {
+		text = tr(i, "I couldn't generate a response.")
+	}
+	interactionLogger(i).Info("Answered question", "verbosity", verbosity)
+
+	b.editInteractionResponseLong(i, fmt.Sprintf("> %s\n\n%s", truncate(question, 500), text), 0)
+}
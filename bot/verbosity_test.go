@@ -0,0 +1,48 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go-discord-bot/ai"
+)
+
+func TestVerbosity(t *testing.T) {
+	client := &fakeAI{replies: []*ai.Reply{{Text: "Goroutines are cheap threads."}}, text: "A goroutine is a lightweight thread."}
+	b, session := newTestBot(t, client)
+
+	// Servers pick their answers' length with /settings
+	command := settingsInteraction(discordgo.PermissionManageServer, discordgo.ApplicationCommandInteractionData{
+		Name:    "settings",
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{stringOption("length", verbosityConcise)},
+	})
+	command.Type = discordgo.InteractionApplicationCommand
+	b.HandleInteraction(command)
+	if got := b.guildSettings("guild").Verbosity; got != verbosityConcise {
+		t.Fatalf("verbosity = %q, want concise", got)
+	}
+
+	b.HandleMessage(userMessage("what is a goroutine?"))
+	if text := partsText(client.chats[0].sent[0]); !strings.Contains(text, "Keep the answer short") {
+		t.Errorf("prompt = %q, want it asked to be concise", text)
+	}
+
+	// /ask picks its own
+	ask := commandInteraction("ask")
+	ask.Data = discordgo.ApplicationCommandInteractionData{
+		Name: "ask",
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{
+			stringOption("question", "what is a goroutine?"),
+			stringOption("length", verbosityDetailed),
+		},
+	}
+	b.HandleInteraction(ask)
+	if text := partsText(client.prompts[0]); !strings.Contains(text, "Answer thoroughly") || strings.Contains(text, "Keep the answer short") {
+		t.Errorf("prompt = %q, want it asked to be detailed", text)
+	}
+	if last := session.edits[len(session.edits)-1]; !strings.Contains(*last.Content, "A goroutine is a lightweight thread.") {
+		t.Errorf("edit = %q, want the answer", *last.Content)
+	}
+}
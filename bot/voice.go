@@ -0,0 +1,447 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// A speaker's turn ends after this much silence
+	voiceTurnSilence = time.Second
+
+	// Turns shorter than this (in 20ms Opus frames) are treated as noise
+	minVoiceTurnFrames = 25
+
+	// Turns are cut off after this many frames (one minute)
+	maxVoiceTurnFrames = 3000
+
+	// Samples per 20ms Opus frame at Discord's 48kHz sample rate
+	opusFrameSamples = 960
+
+	// Longest a spoken answer may take to encode
+	speechEncodeTimeout = time.Minute
+)
+
+// Frames of silence sent after speaking, so Discord doesn't interpolate the
+// end of the answer
+var opusSilence = []byte{0xf8, 0xff, 0xfe}
+
+// voiceSession listens to a voice channel and answers each speaker's turns
+// in the text channel /voice join was used in
+type voiceSession struct {
+	bot           *Bot
+	guildID       string
+	conn          *discordgo.VoiceConnection
+	textChannelID string
+	stop          chan struct{}
+
+	mu       sync.Mutex
+	speakers map[uint32]string // SSRC → user ID
+
+	// Held while an answer is spoken, so answers play one after the other
+	speakMu sync.Mutex
+}
+
+// voiceTurn holds the Opus frames a speaker sent since they started talking
+type voiceTurn struct {
+	frames   [][]byte
+	lastSeen time.Time
+}
+
+// voiceAnswer is the structured response requested from Gemini for a voice turn
+type voiceAnswer struct {
+	Transcript string `json:"transcript"`
+	Answer     string `json:"answer"`
+}
+
+// voiceCommand handles /voice join and /voice leave
+func (b *Bot) voiceCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Voice chat only works in servers."))
+		return
+	}
+
+	switch i.ApplicationCommandData().Options[0].Name {
+	case "join":
+		b.joinVoice(i)
+	case "leave":
+		if b.leaveVoice(i.GuildID) {
+			b.respondEphemeral(i, tr(i, "Left the voice channel."))
+		} else {
+			b.respondEphemeral(i, tr(i, "I'm not in a voice channel."))
+		}
+	}
+}
+
+// joinVoice joins the invoker's voice channel and starts listening
+func (b *Bot) joinVoice(i *discordgo.InteractionCreate) {
+	state, err := b.session.VoiceState(i.GuildID, interactionUserID(i))
+	if err != nil || state.ChannelID == "" {
+		b.respondEphemeral(i, tr(i, "Join a voice channel first."))
+		return
+	}
+
+	// Joining can take a few seconds
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to voice command", "error", err)
+		return
+	}
+
+	b.leaveVoice(i.GuildID)
+	conn, err := b.session.ChannelVoiceJoin(i.GuildID, state.ChannelID, false, false)
+	if err != nil {
+		interactionLogger(i).Error("Error joining voice channel", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, I couldn't join your voice channel."))
+		return
+	}
+
+	vs := &voiceSession{
+		bot:           b,
+		guildID:       i.GuildID,
+		conn:          conn,
+		textChannelID: i.ChannelID,
+		stop:          make(chan struct{}),
+		speakers:      map[uint32]string{},
+	}
+	conn.AddHandler(func(_ *discordgo.VoiceConnection, update *discordgo.VoiceSpeakingUpdate) {
+		vs.mu.Lock()
+		vs.speakers[uint32(update.SSRC)] = update.UserID
+		vs.mu.Unlock()
+	})
+
+	b.voiceMu.Lock()
+	b.voiceSessions[i.GuildID] = vs
+	b.voiceMu.Unlock()
+
+	go vs.listen()
+	b.editInteractionResponse(i, tr(i, "Listening in <#%s>, answers will be posted here.", state.ChannelID))
+}
+
+// leaveVoice disconnects from a guild's voice channel, reporting whether the
+// bot was connected
+func (b *Bot) leaveVoice(guildID string) bool {
+	b.voiceMu.Lock()
+	vs, ok := b.voiceSessions[guildID]
+	delete(b.voiceSessions, guildID)
+	b.voiceMu.Unlock()
+	if !ok {
+		return false
+	}
+
+	close(vs.stop)
+	if err := vs.conn.Disconnect(); err != nil {
+		slog.Error("Error leaving voice channel", "guild", guildID, "error", err)
+	}
+	return true
+}
+
+// listen collects Opus frames per speaker and answers a turn once its
+// speaker has been silent for voiceTurnSilence
+func (vs *voiceSession) listen() {
+	defer recoverPanic(nil)
+
+	turns := map[uint32]*voiceTurn{}
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-vs.stop:
+			return
+		case packet, ok := <-vs.conn.OpusRecv:
+			if !ok {
+				return
+			}
+			turn, found := turns[packet.SSRC]
+			if !found {
+				turn = &voiceTurn{}
+				turns[packet.SSRC] = turn
+			}
+			turn.frames = append(turn.frames, packet.Opus)
+			turn.lastSeen = time.Now()
+			if len(turn.frames) >= maxVoiceTurnFrames {
+				delete(turns, packet.SSRC)
+				go vs.answer(packet.SSRC, turn.frames)
+			}
+		case <-ticker.C:
+			for ssrc, turn := range turns {
+				if time.Since(turn.lastSeen) < voiceTurnSilence {
+					continue
+				}
+				delete(turns, ssrc)
+				if len(turn.frames) >= minVoiceTurnFrames {
+					go vs.answer(ssrc, turn.frames)
+				}
+			}
+		}
+	}
+}
+
+// answer sends a speaker's turn to Gemini, posts the transcript and the
+// answer to the text channel and speaks the answer in the voice channel, or
+// posts it read aloud when it can't be played
+func (vs *voiceSession) answer(ssrc uint32, frames [][]byte) {
+	defer recoverPanic(nil)
+
+	vs.mu.Lock()
+	userID := vs.speakers[ssrc]
+	vs.mu.Unlock()
+
+	b := vs.bot
+	logger := slog.With("channel", vs.textChannelID, "user", userID)
+	// Turns aren't answered during maintenance or once the server's monthly
+	// quota is used up, as messages aren't
+	if b.maintenance.Load() || b.quotaExhausted(vs.guildID) {
+		logger.Debug("Not answering voice turn during maintenance or over quota")
+		return
+	}
+	result, err := b.answerVoiceTurn(userID, vs.guildID, oggOpus(frames))
+	if err != nil {
+		logger.Error("Gemini error", "error", err)
+		return
+	}
+	if result.Answer == "" {
+		return
+	}
+
+	speaker := "Someone"
+	if userID != "" {
+		speaker = fmt.Sprintf("<@%s>", userID)
+	}
+	text := fmt.Sprintf("🎙️ %s: %s\n\n%s", speaker, b.fixMentions(vs.guildID, result.Transcript), b.fixMentions(vs.guildID, result.Answer))
+
+	// Post the text first so readers aren't kept waiting on speech synthesis,
+	// and so the answer is still given when it can't be spoken. Speech comes
+	// from the default provider, as for /speak.
+	b.sendLongMessage(vs.textChannelID, text)
+	audio, err := b.ai.Speak(b.ctx, result.Answer)
+	if err != nil {
+		logger.Error("Gemini TTS error, answering in text only", "error", err)
+		return
+	}
+	if err := vs.speak(audio); err != nil {
+		logger.Warn("Error speaking voice answer, posting it instead", "error", err)
+		_, err = b.session.ChannelFileSend(vs.textChannelID, "answer.wav", bytes.NewReader(audio))
+		if err != nil {
+			logger.Error("Error sending voice answer", "error", err)
+		}
+	}
+}
+
+// speak plays WAV audio in the voice channel, sending its Opus frames while
+// the bot shows as speaking
+func (vs *voiceSession) speak(audio []byte) error {
+	ctx, cancel := context.WithTimeout(vs.bot.ctx, speechEncodeTimeout)
+	frames, err := encodeOpus(ctx, strings.Fields(vs.bot.config().FFmpegCommand), audio)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	vs.speakMu.Lock()
+	defer vs.speakMu.Unlock()
+	if err := vs.conn.Speaking(true); err != nil {
+		return err
+	}
+	defer func() {
+		if err := vs.conn.Speaking(false); err != nil {
+			slog.Error("Error ending voice answer", "guild", vs.guildID, "error", err)
+		}
+	}()
+	for n := range len(frames) + 5 {
+		frame := opusSilence
+		if n < len(frames) {
+			frame = frames[n]
+		}
+		select {
+		case vs.conn.OpusSend <- frame:
+		case <-vs.stop:
+			return nil
+		}
+	}
+	return nil
+}
+
+// encodeOpus encodes a WAV file to the 20ms frames of 48kHz stereo Opus
+// Discord plays, with the ffmpeg command
+func encodeOpus(ctx context.Context, command []string, wav []byte) ([][]byte, error) {
+	if len(command) == 0 {
+		return nil, errors.New("no Opus encoder configured")
+	}
+	args := append(slices.Clone(command[1:]), "-hide_banner", "-loglevel", "error", "-i", "pipe:0",
+		"-ac", "2", "-ar", "48000", "-c:a", "libopus", "-b:a", "64k", "-frame_duration", "20", "-application", "voip",
+		"-f", "ogg", "pipe:1")
+	cmd := exec.CommandContext(ctx, command[0], args...)
+	cmd.Stdin = bytes.NewReader(wav)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if message, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n"); message != "" {
+			return nil, fmt.Errorf("%s: %w: %s", filepath.Base(command[0]), err, message)
+		}
+		return nil, fmt.Errorf("%s: %w", filepath.Base(command[0]), err)
+	}
+	return oggPackets(stdout.Bytes())
+}
+
+// answerVoiceTurn asks Gemini to transcribe a spoken turn and answer it
+func (b *Bot) answerVoiceTurn(userID string, guildID string, audio []byte) (*voiceAnswer, error) {
+	schema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"transcript": {
+				Type:        genai.TypeString,
+				Description: "What the speaker said",
+			},
+			"answer": {
+				Type:        genai.TypeString,
+				Description: "A short, conversational reply, empty if nothing was said to the assistant",
+			},
+		},
+		Required: []string{"transcript", "answer"},
+	}
+
+	prompt := "This is a recording of someone talking in a Discord voice chat. " +
+		"Transcribe it and reply as you would out loud, briefly and without formatting."
+	text, err := b.generateJSON(userID, guildID, schema, genai.Blob{MIMEType: "audio/ogg", Data: audio}, genai.Text(prompt))
+	if err != nil {
+		return nil, err
+	}
+
+	var result voiceAnswer
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
+		return nil, fmt.Errorf("error parsing voice answer: %v", err)
+	}
+	return &result, nil
+}
+
+// oggOpus wraps raw 20ms Opus frames from Discord in an Ogg container, one
+// frame per page, so Gemini can read them as an audio file
+func oggOpus(frames [][]byte) []byte {
+	var buf bytes.Buffer
+	const serial = 1
+
+	// Identification header: version 1, stereo, 312 samples pre-skip, 48kHz
+	head := []byte("OpusHead")
+	head = append(head, 1, 2)
+	head = binary.LittleEndian.AppendUint16(head, 312)
+	head = binary.LittleEndian.AppendUint32(head, 48000)
+	head = append(head, 0, 0, 0)
+	writeOggPage(&buf, head, 0x02, 0, serial, 0)
+
+	// Comment header with an empty vendor string and no comments
+	tags := []byte("OpusTags")
+	tags = binary.LittleEndian.AppendUint32(tags, 0)
+	tags = binary.LittleEndian.AppendUint32(tags, 0)
+	writeOggPage(&buf, tags, 0, 0, serial, 1)
+
+	for n, frame := range frames {
+		var flags byte
+		if n == len(frames)-1 {
+			flags = 0x04
+		}
+		granule := uint64(n+1) * opusFrameSamples
+		writeOggPage(&buf, frame, flags, granule, serial, uint32(n+2))
+	}
+	return buf.Bytes()
+}
+
+// oggPackets returns the audio packets of an Ogg Opus stream, without its
+// two header packets
+func oggPackets(data []byte) ([][]byte, error) {
+	var packets [][]byte
+	var packet []byte
+	for len(data) > 0 {
+		if len(data) < 27 || !bytes.HasPrefix(data, []byte("OggS")) {
+			return nil, errors.New("invalid Ogg page")
+		}
+		segments := int(data[26])
+		if len(data) < 27+segments {
+			return nil, errors.New("truncated Ogg page")
+		}
+		body := data[27+segments:]
+
+		// A packet goes on over the segments of 255 bytes, even across pages
+		for _, size := range data[27 : 27+segments] {
+			if len(body) < int(size) {
+				return nil, errors.New("truncated Ogg page")
+			}
+			packet = append(packet, body[:size]...)
+			body = body[size:]
+			if size < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+		data = body
+	}
+	if len(packets) < 2 {
+		return nil, errors.New("no Opus headers in Ogg stream")
+	}
+	return packets[2:], nil
+}
+
+// writeOggPage writes a single Ogg page holding one packet
+func writeOggPage(buf *bytes.Buffer, packet []byte, flags byte, granule uint64, serial uint32, sequence uint32) {
+	// Lacing values: 255 for every full segment, then the remainder
+	var segments []byte
+	for n := len(packet); ; n -= 255 {
+		if n < 255 {
+			segments = append(segments, byte(n))
+			break
+		}
+		segments = append(segments, 255)
+	}
+
+	page := []byte("OggS")
+	page = append(page, 0, flags)
+	page = binary.LittleEndian.AppendUint64(page, granule)
+	page = binary.LittleEndian.AppendUint32(page, serial)
+	page = binary.LittleEndian.AppendUint32(page, sequence)
+	page = binary.LittleEndian.AppendUint32(page, 0) // checksum, filled in below
+	page = append(page, byte(len(segments)))
+	page = append(page, segments...)
+	page = append(page, packet...)
+	binary.LittleEndian.PutUint32(page[22:], oggChecksum(page))
+	buf.Write(page)
+}
+
+// oggCRCTable is the CRC-32 table for Ogg's polynomial (0x04c11db7, unreflected)
+var oggCRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 24
+		for range 8 {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// oggChecksum computes the checksum of an Ogg page
+func oggChecksum(page []byte) uint32 {
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
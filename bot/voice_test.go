@@ -0,0 +1,138 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestOggChecksum(t *testing.T) {
+	// Check value of CRC-32 with Ogg's polynomial, no reflection and a zero
+	// initial value
+	if got := oggChecksum([]byte("123456789")); got != 0x89a1897f {
+		t.Errorf("oggChecksum = %#x, want 0x89a1897f", got)
+	}
+}
+
+func TestOggOpus(t *testing.T) {
+	frames := [][]byte{bytes.Repeat([]byte{1}, 10), bytes.Repeat([]byte{2}, 300)}
+	data := oggOpus(frames)
+
+	// Walk the pages, checking each checksum
+	var pages int
+	var last []byte
+	for len(data) > 0 {
+		if !bytes.HasPrefix(data, []byte("OggS")) {
+			t.Fatalf("page %d doesn't start with OggS", pages)
+		}
+		segments := int(data[26])
+		size := 27 + segments
+		for _, lacing := range data[27 : 27+segments] {
+			size += int(lacing)
+		}
+		page := bytes.Clone(data[:size])
+		want := binary.LittleEndian.Uint32(page[22:])
+		binary.LittleEndian.PutUint32(page[22:], 0)
+		if got := oggChecksum(page); got != want {
+			t.Errorf("page %d checksum = %#x, want %#x", pages, want, got)
+		}
+		last = data[:size]
+		data = data[size:]
+		pages++
+	}
+
+	// Two header pages, then one page per frame
+	if pages != 4 {
+		t.Errorf("got %d pages, want 4", pages)
+	}
+	if last[5]&0x04 == 0 {
+		t.Error("last page isn't marked end of stream")
+	}
+	if granule := binary.LittleEndian.Uint64(last[6:]); granule != 2*opusFrameSamples {
+		t.Errorf("last granule position = %d, want %d", granule, 2*opusFrameSamples)
+	}
+}
+
+func TestOggPackets(t *testing.T) {
+	// Frames spanning several segments, and one ending on a full segment
+	frames := [][]byte{bytes.Repeat([]byte{1}, 10), bytes.Repeat([]byte{2}, 300), bytes.Repeat([]byte{3}, 510)}
+	packets, err := oggPackets(oggOpus(frames))
+	if err != nil {
+		t.Fatalf("oggPackets: %v", err)
+	}
+	if len(packets) != len(frames) {
+		t.Fatalf("got %d packets, want %d", len(packets), len(frames))
+	}
+	for n := range frames {
+		if !bytes.Equal(packets[n], frames[n]) {
+			t.Errorf("packet %d has %d bytes, want the %d of its frame", n, len(packets[n]), len(frames[n]))
+		}
+	}
+
+	if _, err := oggPackets(oggOpus(frames)[:40]); err == nil {
+		t.Error("oggPackets of a truncated stream succeeded")
+	}
+}
+
+func TestEncodeOpusWithoutEncoder(t *testing.T) {
+	// A missing ffmpeg fails, so the answer is posted as a file instead
+	if _, err := encodeOpus(context.Background(), []string{"no-such-ffmpeg"}, []byte("RIFF")); err == nil {
+		t.Error("encodeOpus without ffmpeg succeeded")
+	}
+}
+
+func TestVoiceAnswer(t *testing.T) {
+	answer := `{"transcript": "what's up", "answer": "Not much."}`
+	gemini := &fakeAI{text: answer, audio: []byte("RIFF")}
+	openAI := &fakeAI{text: answer}
+	b, session := newTestBot(t, gemini)
+	b.config().FFmpegCommand = "no-such-ffmpeg"
+	b.AddProvider(ProviderOpenAI, openAI)
+	b.HandleInteraction(providerInteraction(ProviderOpenAI, discordgo.PermissionManageServer))
+
+	// The guild's provider answers, and the default one speaks the answer,
+	// posted as a file when it can't be played
+	vs := &voiceSession{bot: b, guildID: "guild", textChannelID: "channel", speakers: map[uint32]string{1: "user"}}
+	vs.answer(1, [][]byte{{0xf8}})
+	if len(openAI.prompts) != 1 || len(gemini.prompts) != 0 {
+		t.Errorf("openai prompts = %q, default prompts = %q, want the guild's provider to answer", openAI.prompts, gemini.prompts)
+	}
+	if len(session.messages) != 1 || session.messages[0] != "🎙️ <@user>: what's up\n\nNot much." {
+		t.Errorf("sent %q, want the answer", session.messages)
+	}
+	if _, ok := session.files["channel/answer.wav"]; !ok {
+		t.Errorf("files = %v, want the spoken answer", session.files)
+	}
+
+	// Without speech the answer is still given in text
+	client := &fakeAI{text: answer}
+	b, session = newTestBot(t, client)
+	vs = &voiceSession{bot: b, guildID: "guild", textChannelID: "channel", speakers: map[uint32]string{1: "user"}}
+	vs.answer(1, [][]byte{{0xf8}})
+	if len(session.messages) != 1 || session.messages[0] != "🎙️ <@user>: what's up\n\nNot much." || len(session.files) != 0 {
+		t.Errorf("sent %q with files %v, want the answer in text only", session.messages, session.files)
+	}
+
+	// Turns aren't answered during maintenance
+	b.maintenance.Store(true)
+	vs.answer(1, [][]byte{{0xf8}})
+	if len(client.prompts) != 1 || len(session.messages) != 1 {
+		t.Errorf("prompts = %q, sent %q, want the turn ignored during maintenance", client.prompts, session.messages)
+	}
+}
+
+func TestVoiceLeaveDuringMaintenance(t *testing.T) {
+	voice := func(subcommand string) *discordgo.InteractionCreate {
+		i := commandInteraction("voice")
+		i.Data = discordgo.ApplicationCommandInteractionData{Name: "voice", Options: []*discordgo.ApplicationCommandInteractionDataOption{
+			{Name: subcommand, Type: discordgo.ApplicationCommandOptionSubCommand},
+		}}
+		return i
+	}
+	if !usesAI(voice("join")) || usesAI(voice("leave")) {
+		t.Error("usesAI, want /voice join refused during maintenance and /voice leave allowed")
+	}
+}
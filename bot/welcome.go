@@ -0,0 +1,183 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/store"
+)
+
+// How welcome messages are written when the server doesn't give a template
+const defaultWelcomeTemplate = "Two or three warm sentences pointing out what newcomers should know first."
+
+// welcomeCommand handles the /welcome subcommands, which set up, toggle and
+// preview the welcome messages of new members. They need the Manage Server
+// permission.
+func (b *Bot) welcomeCommand(i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		b.respondEphemeral(i, tr(i, "Welcome messages only work in servers."))
+		return
+	}
+	if i.Member == nil || i.Member.Permissions&discordgo.PermissionManageServer == 0 {
+		b.respondEphemeral(i, tr(i, "You need the Manage Server permission to change welcome messages."))
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	switch subcommand.Name {
+	case "setup":
+		settings := store.WelcomeSettings{
+			GuildID: i.GuildID,
+			About:   commandOption(subcommand.Options, "about").StringValue(),
+			Enabled: true,
+		}
+		if option := commandOption(subcommand.Options, "channel"); option != nil {
+			settings.ChannelID = option.ChannelValue(nil).ID
+		}
+		if option := commandOption(subcommand.Options, "template"); option != nil {
+			settings.Template = option.StringValue()
+		}
+		if err := b.store.SetWelcomeSettings(settings); err != nil {
+			interactionLogger(i).Error("Error saving welcome settings", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+		interactionLogger(i).Info("Set up welcome messages", "welcome_channel", settings.ChannelID)
+		b.respondEphemeral(i, b.welcomeStatus(i, &settings))
+	case "enable", "disable":
+		enabled := subcommand.Name == "enable"
+		found, err := b.store.SetWelcomeEnabled(i.GuildID, enabled)
+		if err != nil {
+			interactionLogger(i).Error("Error changing welcome messages", "error", err)
+			b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+			return
+		}
+		if !found {
+			b.respondEphemeral(i, tr(i, "Set up welcome messages first with `/welcome setup`."))
+			return
+		}
+		interactionLogger(i).Info("Changed welcome messages", "enabled", enabled)
+		if enabled {
+			b.respondEphemeral(i, tr(i, "Welcome messages are on."))
+		} else {
+			b.respondEphemeral(i, tr(i, "Welcome messages are off, `/welcome enable` turns them back on."))
+		}
+	case "preview":
+		b.previewWelcome(i)
+	}
+}
+
+// welcomeStatus describes where welcome messages go, warning when the bot
+// doesn't receive member joins
+func (b *Bot) welcomeStatus(i *discordgo.InteractionCreate, settings *store.WelcomeSettings) string {
+	status := tr(i, "New members will be welcomed by DM.")
+	if settings.ChannelID != "" {
+		status = tr(i, "New members will be welcomed in <#%s>.", settings.ChannelID)
+	}
+	if !b.config().WelcomeMessages {
+		status += " " + tr(i, "The bot's owner still has to turn on `welcome_messages` before I'm told about new members.")
+	}
+	return status + " " + tr(i, "Try it with `/welcome preview`.")
+}
+
+// previewWelcome shows the member the welcome message they would get
+func (b *Bot) previewWelcome(i *discordgo.InteractionCreate) {
+	settings, err := b.store.WelcomeSettings(i.GuildID)
+	if err != nil {
+		interactionLogger(i).Error("Error loading welcome settings", "error", err)
+		b.respondEphemeral(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	if settings == nil {
+		b.respondEphemeral(i, tr(i, "Set up welcome messages first with `/welcome setup`."))
+		return
+	}
+
+	if err := b.deferEphemeral(i); err != nil {
+		interactionLogger(i).Error("Error responding to welcome command", "error", err)
+		return
+	}
+	text, err := b.welcomeText(settings, interactionUser(i))
+	if err != nil {
+		interactionLogger(i).Error("Gemini error", "error", err)
+		b.editInteractionResponse(i, tr(i, "Sorry, an error occurred: %v", err))
+		return
+	}
+	b.editInteractionResponse(i, truncate(text, 2000))
+}
+
+// handleGuildMemberAdd welcomes a new member, when the guild has welcome
+// messages on. A plain welcome is sent if Gemini can't write one.
+func (b *Bot) handleGuildMemberAdd(m *discordgo.GuildMemberAdd) {
+	if m.User == nil || m.User.Bot {
+		return
+	}
+	logger := slog.With("guild", m.GuildID, "user", m.User.ID)
+	settings, err := b.store.WelcomeSettings(m.GuildID)
+	if err != nil {
+		logger.Error("Error loading welcome settings", "error", err)
+		return
+	}
+	if settings == nil || !settings.Enabled {
+		return
+	}
+
+	text := ""
+	if !b.maintenance.Load() && !b.quotaExhausted(m.GuildID) {
+		if text, err = b.welcomeText(settings, m.User); err != nil {
+			logger.Error("Error writing welcome message", "error", err)
+		}
+	}
+	if text == "" {
+		text = fmt.Sprintf("Welcome to %s!", b.guildName(m.GuildID))
+	}
+
+	channelID := settings.ChannelID
+	if channelID == "" {
+		channel, err := b.session.UserChannelCreate(m.User.ID)
+		if err != nil {
+			logger.Warn("Error opening DM channel", "error", err)
+			return
+		}
+		channelID = channel.ID
+	} else {
+		text = fmt.Sprintf("<@%s> %s", m.User.ID, text)
+	}
+	_, err = b.session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:         truncate(text, 2000),
+		AllowedMentions: &discordgo.MessageAllowedMentions{Users: []string{m.User.ID}},
+	})
+	if err != nil {
+		logger.Warn("Error sending welcome message", "error", err)
+		return
+	}
+	logger.Info("Welcomed new member")
+}
+
+// welcomeText has Gemini write a welcome for a member following the
+// guild's description, rules and template
+func (b *Bot) welcomeText(settings *store.WelcomeSettings, user *discordgo.User) (string, error) {
+	template := settings.Template
+	if template == "" {
+		template = defaultWelcomeTemplate
+	}
+	prompt := fmt.Sprintf("Write a welcome message for %s, who just joined the Discord server %q. "+
+		"Address them directly and reply with the message only, without a sign-off.\n\n"+
+		"About the server, from its admins:\n%s\n\nHow to write it:\n%s",
+		user.Username, b.guildName(settings.GuildID), settings.About, template)
+	text, err := b.generate(user.ID, settings.GuildID, genai.Text(prompt))
+	return strings.TrimSpace(text), err
+}
+
+// guildName returns a guild's name, or "the server" if it can't be looked up
+func (b *Bot) guildName(guildID string) string {
+	guild, err := b.session.Guild(guildID)
+	if err != nil || guild.Name == "" {
+		return "the server"
+	}
+	return guild.Name
+}
@@ -0,0 +1,101 @@
+package bot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/store"
+)
+
+// welcomeInteraction is a /welcome subcommand sent by a server member
+func welcomeInteraction(permissions int64, subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	i := promptInteraction("alice", permissions, subcommand, options...)
+	data := i.Data.(discordgo.ApplicationCommandInteractionData)
+	data.Name = "welcome"
+	i.Data = data
+	return i
+}
+
+func TestWelcomeCommand(t *testing.T) {
+	b, session := newTestBot(t, &fakeAI{text: "Hi alice, read #rules first!"})
+	admin := int64(discordgo.PermissionManageServer)
+
+	steps := []struct {
+		interaction *discordgo.InteractionCreate
+		want        string
+	}{
+		{welcomeInteraction(0, "enable"), "You need the Manage Server permission to change welcome messages."},
+		{welcomeInteraction(admin, "enable"), "Set up welcome messages first with `/welcome setup`."},
+		{welcomeInteraction(admin, "setup", stringOption("about", "Gophers. Be kind.")),
+			"New members will be welcomed by DM. The bot's owner still has to turn on `welcome_messages`"},
+		{welcomeInteraction(admin, "setup", stringOption("about", "Gophers. Be kind."), channelOption("channel", "welcome"), stringOption("template", "One sentence")),
+			"New members will be welcomed in <#welcome>."},
+		{welcomeInteraction(admin, "disable"), "Welcome messages are off, `/welcome enable` turns them back on."},
+		{welcomeInteraction(admin, "enable"), "Welcome messages are on."},
+	}
+	for _, step := range steps {
+		session.responses = nil
+		b.HandleInteraction(step.interaction)
+		if len(session.responses) != 1 || !strings.HasPrefix(session.responses[0].Data.Content, step.want) {
+			t.Errorf("responded %v, want %q", session.responses, step.want)
+		}
+	}
+
+	b.HandleInteraction(welcomeInteraction(admin, "preview"))
+	if len(session.edits) != 1 || *session.edits[0].Content != "Hi alice, read #rules first!" {
+		t.Errorf("preview edits = %v, want the generated welcome", session.edits)
+	}
+}
+
+func TestHandleGuildMemberAdd(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings *store.WelcomeSettings
+		err      error
+		user     *discordgo.User
+		want     string
+	}{
+		{"not set up", nil, nil, &discordgo.User{ID: "new", Username: "bob"}, ""},
+		{"disabled", &store.WelcomeSettings{GuildID: "guild", ChannelID: "welcome", About: "Gophers"}, nil, &discordgo.User{ID: "new", Username: "bob"}, ""},
+		{"bot", &store.WelcomeSettings{GuildID: "guild", ChannelID: "welcome", About: "Gophers", Enabled: true}, nil, &discordgo.User{ID: "new", Bot: true}, ""},
+		{"channel", &store.WelcomeSettings{GuildID: "guild", ChannelID: "welcome", About: "Gophers", Enabled: true}, nil,
+			&discordgo.User{ID: "new", Username: "bob"}, "<@new> Glad you're here, bob!"},
+		{"dm", &store.WelcomeSettings{GuildID: "guild", About: "Gophers", Enabled: true}, nil,
+			&discordgo.User{ID: "new", Username: "bob"}, "Glad you're here, bob!"},
+		{"fallback", &store.WelcomeSettings{GuildID: "guild", ChannelID: "welcome", About: "Gophers", Enabled: true}, errors.New("unavailable"),
+			&discordgo.User{ID: "new", Username: "bob"}, "<@new> Welcome to Gophers!"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeAI{text: "Glad you're here, bob!", err: test.err}
+			b, session := newTestBot(t, client)
+			session.guilds = []*discordgo.Guild{{ID: "guild", Name: "Gophers"}}
+			if test.settings != nil {
+				if err := b.store.SetWelcomeSettings(*test.settings); err != nil {
+					t.Fatalf("SetWelcomeSettings: %v", err)
+				}
+			}
+
+			b.handleGuildMemberAdd(&discordgo.GuildMemberAdd{Member: &discordgo.Member{GuildID: "guild", User: test.user}})
+			if test.want == "" {
+				if len(session.messages) != 0 {
+					t.Errorf("messages = %q, want none", session.messages)
+				}
+				return
+			}
+			if len(session.messages) != 1 || session.messages[0] != test.want {
+				t.Errorf("messages = %q, want %q", session.messages, test.want)
+			}
+			if test.err == nil {
+				prompt := string(client.prompts[0][0].(genai.Text))
+				if !strings.Contains(prompt, `"Gophers"`) || !strings.Contains(prompt, defaultWelcomeTemplate) {
+					t.Errorf("prompt = %q, want the server name and default template", prompt)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,683 @@
+// Package config loads the bot's settings from a YAML file and the environment.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Shortest API key accepted, so keys can't be guessed
+const minAPIKeyLength = 16
+
+// Longest wait for more rapid-fire messages, past which answers feel stuck
+const maxMessageDebounce = 10 * time.Second
+
+// Config holds every setting of the bot. Settings come from defaults, then
+// the YAML config file, then environment variables, each overriding the last.
+type Config struct {
+	DiscordToken  string   `yaml:"discord_token"`
+	GeminiAPIKeys []string `yaml:"gemini_api_keys"`
+
+	// Discord user ID of the bot owner, who may use /admin
+	OwnerID string `yaml:"owner_id"`
+
+	// Server commands are registered in instead of globally, for development
+	DevGuildID string `yaml:"dev_guild_id"`
+
+	// Gateway shards the bot's servers are split over, 0 for as many as
+	// Discord recommends, and the one shard this process runs when the bot
+	// is scaled over several processes; all of them when unset
+	ShardCount int  `yaml:"shard_count"`
+	ShardID    *int `yaml:"shard_id"`
+
+	// Chat model of the Gemini backend
+	Model string `yaml:"model"`
+
+	// "vertex" to use Gemini on Vertex AI with Application Default
+	// Credentials instead of API keys, and the project and location to use
+	Backend        string `yaml:"backend"`
+	VertexProject  string `yaml:"vertex_project"`
+	VertexLocation string `yaml:"vertex_location"`
+
+	// Latency of the "mock" backend's answers, and how often it fails:
+	// every MockFailEvery-th request, never when 0
+	MockDelay     time.Duration `yaml:"mock_delay"`
+	MockFailEvery int           `yaml:"mock_fail_every"`
+
+	// Base URL of the Gemini API, such as a regional endpoint or a gateway
+	// in front of it, instead of https://generativelanguage.googleapis.com
+	GeminiBaseURL string `yaml:"gemini_base_url"`
+
+	// Proxy for every connection to Discord and the AI providers; when
+	// unset, the HTTPS_PROXY, HTTP_PROXY and NO_PROXY variables apply
+	ProxyURL string `yaml:"proxy_url"`
+
+	// Provider answering in guilds that haven't chosen one with /provider,
+	// "gemini" or "openai"
+	DefaultProvider string `yaml:"default_provider"`
+
+	// OpenAI-compatible API offered as the "openai" provider, disabled when
+	// the base URL is empty
+	OpenAIBaseURL        string `yaml:"openai_base_url"`
+	OpenAIAPIKey         string `yaml:"openai_api_key"`
+	OpenAIModel          string `yaml:"openai_model"`
+	OpenAIEmbeddingModel string `yaml:"openai_embedding_model"`
+
+	// SQLite database file
+	DatabasePath string `yaml:"database_path"`
+
+	// Where chat sessions, guild settings, memories and usage are kept so
+	// several instances can share them: "sqlite" for the database above,
+	// "postgres" or "redis" at the store URL
+	StoreDriver string `yaml:"store_driver"`
+	StoreURL    string `yaml:"store_url"`
+
+	// Images each user may generate per day with /imagine
+	ImagineDailyLimit int `yaml:"imagine_daily_limit"`
+
+	// "!edit" image editing and the image-output model used for it
+	ImageEditing   bool   `yaml:"image_editing"`
+	ImageEditModel string `yaml:"image_edit_model"`
+
+	// 🔊 button on chat responses and the voice used for speech
+	TTSButton bool   `yaml:"tts_button"`
+	TTSVoice  string `yaml:"tts_voice"`
+
+	// Command encoding speech to Opus for /voice to play answers in voice
+	// channels: ffmpeg, followed by any arguments
+	FFmpegCommand string `yaml:"ffmpeg_command"`
+
+	// Answer server messages in per-user threads
+	AutoThread bool `yaml:"auto_thread"`
+
+	// Every this many answers in a thread, pin a title and summary of its
+	// conversation, updated in place, never when 0
+	ThreadSummaryTurns int `yaml:"thread_summary_turns"`
+
+	// Answer the opening message of every forum post, even when the server
+	// only answers mentions
+	ForumAutoAnswer bool `yaml:"forum_auto_answer"`
+
+	// Send answers as embeds with the model, latency and token usage in the
+	// footer instead of plain messages
+	EmbedResponses bool `yaml:"embed_responses"`
+
+	// Messages a response may be split over before it is sent as a file
+	// instead, never when 0
+	MaxResponseChunks int `yaml:"max_response_chunks"`
+
+	// Attach images of the Mermaid and Graphviz diagrams in answers, rendered
+	// with these commands: a program followed by its arguments
+	RenderDiagrams  bool   `yaml:"render_diagrams"`
+	MermaidCommand  string `yaml:"mermaid_command"`
+	GraphvizCommand string `yaml:"graphviz_command"`
+
+	// Write the LaTeX math of answers with Unicode symbols, since Discord
+	// shows it as its raw source
+	MathUnicode bool `yaml:"math_unicode"`
+
+	// Attach images of the custom emojis and stickers of messages to their
+	// prompt, besides their names
+	EmojiImages bool `yaml:"emoji_images"`
+
+	// Add 👍/👎 buttons to answers, saving votes with their prompt and
+	// response for /feedback
+	FeedbackButtons bool `yaml:"feedback_buttons"`
+
+	// Suggest up to three follow-up questions as buttons under answers,
+	// asked for along with the answer
+	FollowUpButtons bool `yaml:"follow_up_buttons"`
+
+	// Receive member joins for /welcome, which needs the privileged Server
+	// Members intent turned on in the developer portal
+	WelcomeMessages bool `yaml:"welcome_messages"`
+
+	// IDs of the roles whose members may draft and post announcements with
+	// /announce, besides members with the Manage Server permission
+	AnnounceRoles []string `yaml:"announce_roles"`
+
+	// IDs of the bots and webhooks whose messages are answered, others are
+	// ignored, and how many replies in a row to bots a channel may get before
+	// the bot stops answering them there until a human posts (unlimited when 0)
+	AllowedBots  []string `yaml:"allowed_bots"`
+	BotLoopLimit int      `yaml:"bot_loop_limit"`
+
+	// Tokens of chat history kept before older turns are summarized
+	HistoryTokenBudget int `yaml:"history_token_budget"`
+
+	// How long a conversation may sit idle before it is summarized and its
+	// history freed, never when 0
+	SessionIdleTimeout time.Duration `yaml:"session_idle_timeout"`
+
+	// How long the bot waits for more of a member's rapid-fire short
+	// messages before answering them all as one prompt, not at all when 0
+	MessageDebounce time.Duration `yaml:"message_debounce"`
+
+	// Persona and documents cached with the Gemini context caching API
+	ContextFiles        []string `yaml:"context_files"`
+	ContextInstructions string   `yaml:"context_instructions"`
+	ContextCacheModel   string   `yaml:"context_cache_model"`
+
+	// Statuses the bot's presence shows in turn, each showing a custom status
+	// unless it starts with "playing", "listening to", "watching" or
+	// "competing in", with {model} replaced by the default model, and how
+	// long each is shown (the first stays when 0)
+	Statuses       []string      `yaml:"statuses"`
+	StatusInterval time.Duration `yaml:"status_interval"`
+
+	// Minimum level logged ("debug", "info", "warn" or "error") and whether
+	// logs are written as JSON instead of text
+	LogLevel string `yaml:"log_level"`
+	LogJSON  bool   `yaml:"log_json"`
+
+	// Address of the HTTP server serving metrics, health checks and the API,
+	// disabled when empty
+	HTTPAddr string `yaml:"http_addr"`
+
+	// Keys of the HTTP API served there under /v1/, disabled when empty,
+	// each "name:key:ids" with the name standing for the integration using
+	// it in rate limits, usage and the audit log, and the IDs of the servers
+	// or channels it may post in separated by slashes
+	APIKeys []string `yaml:"api_keys"`
+
+	// How long shutdown waits for in-flight requests to finish
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+
+	// Gemini requests run at once, and how many more may wait for a turn
+	MaxConcurrency int `yaml:"max_concurrency"`
+	QueueDepth     int `yaml:"queue_depth"`
+
+	// Failed requests in a row after which a provider's circuit breaker
+	// opens, disabled when 0, and how long it stays open before a request
+	// probes whether the provider recovered
+	BreakerThreshold int           `yaml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+
+	// Tokens each guild may use per month, unlimited when 0
+	MonthlyGuildTokenCap int `yaml:"monthly_guild_token_cap"`
+
+	// Prompt size in tokens, history included, past which a chat message
+	// gets a warning with its estimated cost, never when 0, and the price in
+	// US dollars of a million prompt tokens used for estimates
+	LargePromptTokens int     `yaml:"large_prompt_tokens"`
+	PromptTokenPrice  float64 `yaml:"prompt_token_price"`
+
+	// Longest audio or video attachment in minutes, and most pages of a PDF,
+	// sent to the model in guilds that set no limits of their own, unlimited
+	// when 0, and the estimated tokens above which a message's attachments
+	// are only sent once its author confirms, never asked when 0
+	MaxMediaMinutes         int `yaml:"max_media_minutes"`
+	MaxPDFPages             int `yaml:"max_pdf_pages"`
+	AttachmentConfirmTokens int `yaml:"attachment_confirm_tokens"`
+
+	// How long answers to one-off prompts are reused for identical prompts,
+	// never when 0, and how many are kept
+	ResponseCacheTTL  time.Duration `yaml:"response_cache_ttl"`
+	ResponseCacheSize int           `yaml:"response_cache_size"`
+
+	// Where prompts and responses are audited: "" (off), "database" or
+	// "file", the JSONL file used, and how many days entries are kept
+	// (forever when 0)
+	Audit              string `yaml:"audit"`
+	AuditFile          string `yaml:"audit_file"`
+	AuditRetentionDays int    `yaml:"audit_retention_days"`
+
+	// Replace user and guild IDs in audit entries with pseudonyms derived
+	// from the salt
+	AuditAnonymize bool   `yaml:"audit_anonymize"`
+	AuditSalt      string `yaml:"audit_salt"`
+
+	// Whether the bot runs without Discord, as the REPL does
+	local bool
+
+	// Environment variables set to values that don't parse
+	envErrs []error
+}
+
+// defaults returns the settings used when neither the config file nor the
+// environment sets them
+func defaults() *Config {
+	return &Config{
+		Model:                   "gemini-1.5-pro-latest",
+		Backend:                 "studio",
+		VertexLocation:          "us-central1",
+		DefaultProvider:         "gemini",
+		OpenAIEmbeddingModel:    "text-embedding-3-small",
+		DatabasePath:            "bot.db",
+		StoreDriver:             "sqlite",
+		ImagineDailyLimit:       10,
+		ImageEditModel:          "gemini-2.0-flash-preview-image-generation",
+		TTSVoice:                "Kore",
+		FFmpegCommand:           "ffmpeg",
+		HistoryTokenBudget:      100000,
+		SessionIdleTimeout:      24 * time.Hour,
+		BotLoopLimit:            5,
+		MaxResponseChunks:       4,
+		MermaidCommand:          "mmdc",
+		GraphvizCommand:         "dot",
+		ContextCacheModel:       "gemini-1.5-pro-002",
+		Statuses:                []string{"{model}", "listening to /help"},
+		StatusInterval:          5 * time.Minute,
+		LogLevel:                "info",
+		DrainTimeout:            30 * time.Second,
+		MaxConcurrency:          4,
+		QueueDepth:              32,
+		BreakerThreshold:        5,
+		BreakerCooldown:         30 * time.Second,
+		ResponseCacheSize:       500,
+		LargePromptTokens:       100000,
+		PromptTokenPrice:        1.25,
+		MaxMediaMinutes:         60,
+		MaxPDFPages:             500,
+		AttachmentConfirmTokens: 100000,
+		AuditFile:               "audit.jsonl",
+		AuditRetentionDays:      90,
+	}
+}
+
+// Load builds and validates the configuration. The .env file and the config
+// file (CONFIG_FILE, default config.yaml) are both optional.
+func Load() (*Config, error) {
+	return load(false)
+}
+
+// LoadLocal builds and validates the configuration for running the bot
+// without Discord, which needs no Discord token
+func LoadLocal() (*Config, error) {
+	return load(true)
+}
+
+func load(local bool) (*Config, error) {
+	// Containers usually set real environment variables instead of a .env file
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error loading .env file: %v", err)
+	}
+
+	cfg := defaults()
+	path := String("CONFIG_FILE", "config.yaml")
+	if err := cfg.loadFile(path); err != nil {
+		// The default config file may be missing, one asked for may not
+		if !errors.Is(err, fs.ErrNotExist) || os.Getenv("CONFIG_FILE") != "" {
+			return nil, err
+		}
+	}
+	cfg.applyEnv()
+	cfg.local = local
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%v", err)
+	}
+	return cfg, nil
+}
+
+// loadFile reads settings from a YAML file, rejecting unknown keys
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error reading %s: %v", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides settings with the environment variables that are set,
+// keeping the errors of those that don't parse for Validate
+func (c *Config) applyEnv() {
+	e := &env{}
+	c.DiscordToken = String("DISCORD_BOT_TOKEN", c.DiscordToken)
+	c.GeminiAPIKeys = e.List("GEMINI_API_KEY", c.GeminiAPIKeys)
+	c.OwnerID = String("BOT_OWNER_ID", c.OwnerID)
+	c.DevGuildID = String("DEV_GUILD_ID", c.DevGuildID)
+	c.ShardCount = e.Int("SHARD_COUNT", c.ShardCount)
+	if os.Getenv("SHARD_ID") != "" {
+		id := e.Int("SHARD_ID", 0)
+		c.ShardID = &id
+	}
+	c.Model = String("GEMINI_MODEL", c.Model)
+	c.Backend = String("AI_BACKEND", String("GEMINI_BACKEND", c.Backend))
+	c.MockDelay = e.Duration("MOCK_DELAY_MS", time.Millisecond, c.MockDelay)
+	c.MockFailEvery = e.Int("MOCK_FAIL_EVERY", c.MockFailEvery)
+	c.VertexProject = String("VERTEX_PROJECT", c.VertexProject)
+	c.VertexLocation = String("VERTEX_LOCATION", c.VertexLocation)
+	c.GeminiBaseURL = String("GEMINI_BASE_URL", c.GeminiBaseURL)
+	c.ProxyURL = String("PROXY_URL", c.ProxyURL)
+	c.DefaultProvider = String("DEFAULT_PROVIDER", c.DefaultProvider)
+	c.OpenAIBaseURL = String("OPENAI_BASE_URL", c.OpenAIBaseURL)
+	c.OpenAIAPIKey = String("OPENAI_API_KEY", c.OpenAIAPIKey)
+	c.OpenAIModel = String("OPENAI_MODEL", c.OpenAIModel)
+	c.OpenAIEmbeddingModel = String("OPENAI_EMBEDDING_MODEL", c.OpenAIEmbeddingModel)
+	c.DatabasePath = String("DATABASE_PATH", c.DatabasePath)
+	c.StoreDriver = String("STORE_DRIVER", c.StoreDriver)
+	c.StoreURL = String("STORE_URL", c.StoreURL)
+	c.ImagineDailyLimit = e.Int("IMAGINE_DAILY_LIMIT", c.ImagineDailyLimit)
+	c.ImageEditing = e.Bool("IMAGE_EDITING", c.ImageEditing)
+	c.ImageEditModel = String("IMAGE_EDIT_MODEL", c.ImageEditModel)
+	c.TTSButton = e.Bool("TTS_BUTTON", c.TTSButton)
+	c.TTSVoice = String("TTS_VOICE", c.TTSVoice)
+	c.FFmpegCommand = String("FFMPEG_COMMAND", c.FFmpegCommand)
+	c.AutoThread = e.Bool("AUTO_THREAD", c.AutoThread)
+	c.ThreadSummaryTurns = e.Int("THREAD_SUMMARY_TURNS", c.ThreadSummaryTurns)
+	c.ForumAutoAnswer = e.Bool("FORUM_AUTO_ANSWER", c.ForumAutoAnswer)
+	c.EmbedResponses = e.Bool("EMBED_RESPONSES", c.EmbedResponses)
+	c.MaxResponseChunks = e.Int("MAX_RESPONSE_CHUNKS", c.MaxResponseChunks)
+	c.RenderDiagrams = e.Bool("RENDER_DIAGRAMS", c.RenderDiagrams)
+	c.MermaidCommand = String("MERMAID_COMMAND", c.MermaidCommand)
+	c.GraphvizCommand = String("GRAPHVIZ_COMMAND", c.GraphvizCommand)
+	c.MathUnicode = e.Bool("MATH_UNICODE", c.MathUnicode)
+	c.EmojiImages = e.Bool("EMOJI_IMAGES", c.EmojiImages)
+	c.FeedbackButtons = e.Bool("FEEDBACK_BUTTONS", c.FeedbackButtons)
+	c.FollowUpButtons = e.Bool("FOLLOW_UP_BUTTONS", c.FollowUpButtons)
+	c.WelcomeMessages = e.Bool("WELCOME_MESSAGES", c.WelcomeMessages)
+	c.AnnounceRoles = e.List("ANNOUNCE_ROLES", c.AnnounceRoles)
+	c.AllowedBots = e.List("ALLOWED_BOTS", c.AllowedBots)
+	c.BotLoopLimit = e.Int("BOT_LOOP_LIMIT", c.BotLoopLimit)
+	c.HistoryTokenBudget = e.Int("HISTORY_TOKEN_BUDGET", c.HistoryTokenBudget)
+	c.SessionIdleTimeout = e.Duration("SESSION_IDLE_HOURS", time.Hour, c.SessionIdleTimeout)
+	c.MessageDebounce = e.Duration("MESSAGE_DEBOUNCE_MS", time.Millisecond, c.MessageDebounce)
+	c.ContextFiles = e.List("CONTEXT_FILES", c.ContextFiles)
+	c.ContextInstructions = String("CONTEXT_INSTRUCTIONS", c.ContextInstructions)
+	c.ContextCacheModel = String("CONTEXT_CACHE_MODEL", c.ContextCacheModel)
+	c.Statuses = e.List("STATUSES", c.Statuses)
+	c.StatusInterval = e.Duration("STATUS_INTERVAL", time.Second, c.StatusInterval)
+	c.LogLevel = String("LOG_LEVEL", c.LogLevel)
+	switch format := os.Getenv("LOG_FORMAT"); format {
+	case "":
+	case "json", "text":
+		c.LogJSON = format == "json"
+	default:
+		e.check(fmt.Errorf("LOG_FORMAT must be json or text, not %q", format))
+	}
+	c.HTTPAddr = String("HTTP_ADDR", c.HTTPAddr)
+	c.APIKeys = e.List("API_KEYS", c.APIKeys)
+	c.DrainTimeout = e.Duration("DRAIN_TIMEOUT", time.Second, c.DrainTimeout)
+	c.MaxConcurrency = e.Int("MAX_CONCURRENCY", c.MaxConcurrency)
+	c.QueueDepth = e.Int("QUEUE_DEPTH", c.QueueDepth)
+	c.BreakerThreshold = e.Int("BREAKER_THRESHOLD", c.BreakerThreshold)
+	c.BreakerCooldown = e.Duration("BREAKER_COOLDOWN", time.Second, c.BreakerCooldown)
+	c.MonthlyGuildTokenCap = e.Int("MONTHLY_GUILD_TOKEN_CAP", c.MonthlyGuildTokenCap)
+	c.LargePromptTokens = e.Int("LARGE_PROMPT_TOKENS", c.LargePromptTokens)
+	c.PromptTokenPrice = e.Float("PROMPT_TOKEN_PRICE", c.PromptTokenPrice)
+	c.MaxMediaMinutes = e.Int("MAX_MEDIA_MINUTES", c.MaxMediaMinutes)
+	c.MaxPDFPages = e.Int("MAX_PDF_PAGES", c.MaxPDFPages)
+	c.AttachmentConfirmTokens = e.Int("ATTACHMENT_CONFIRM_TOKENS", c.AttachmentConfirmTokens)
+	c.ResponseCacheTTL = e.Duration("RESPONSE_CACHE_TTL", time.Second, c.ResponseCacheTTL)
+	c.ResponseCacheSize = e.Int("RESPONSE_CACHE_SIZE", c.ResponseCacheSize)
+	c.Audit = String("AUDIT_LOG", c.Audit)
+	c.AuditFile = String("AUDIT_FILE", c.AuditFile)
+	c.AuditRetentionDays = e.Int("AUDIT_RETENTION_DAYS", c.AuditRetentionDays)
+	c.AuditAnonymize = e.Bool("AUDIT_ANONYMIZE", c.AuditAnonymize)
+	c.AuditSalt = String("AUDIT_SALT", c.AuditSalt)
+	c.envErrs = e.errs
+}
+
+// Validate checks that the settings are complete and consistent, returning
+// every problem found
+func (c *Config) Validate() error {
+	// Variables that don't parse are reported first, as the settings they
+	// were meant for keep their earlier values
+	errs := slices.Clone(c.envErrs)
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.DiscordToken != "" || c.local, "discord_token (DISCORD_BOT_TOKEN) is required")
+	switch c.Backend {
+	case "studio":
+		check(len(c.GeminiAPIKeys) > 0, "gemini_api_keys (GEMINI_API_KEY) is required, or set backend to vertex")
+	case "vertex":
+		check(c.VertexProject != "", "vertex_project (VERTEX_PROJECT) is required with the vertex backend")
+	case "mock":
+		check(c.MockDelay >= 0, "mock_delay (MOCK_DELAY_MS) can't be negative")
+		check(c.MockFailEvery >= 0, "mock_fail_every (MOCK_FAIL_EVERY) can't be negative")
+	default:
+		check(false, "backend (AI_BACKEND) must be studio, vertex or mock, not %q", c.Backend)
+	}
+	check(c.Model != "", "model (GEMINI_MODEL) can't be empty")
+	check(validURL(c.GeminiBaseURL, "http", "https"), "gemini_base_url (GEMINI_BASE_URL) must be an http or https URL, not %q", c.GeminiBaseURL)
+	check(validURL(c.ProxyURL, "http", "https", "socks5"), "proxy_url (PROXY_URL) must be an http, https or socks5 URL, not %q", c.ProxyURL)
+
+	switch c.DefaultProvider {
+	case "gemini":
+	case "openai":
+		check(c.OpenAIBaseURL != "", "openai_base_url (OPENAI_BASE_URL) is required when openai is the default provider")
+	default:
+		check(false, "default_provider (DEFAULT_PROVIDER) must be gemini or openai, not %q", c.DefaultProvider)
+	}
+	check(c.OpenAIBaseURL == "" || c.OpenAIModel != "", "openai_model (OPENAI_MODEL) is required with openai_base_url")
+
+	switch c.StoreDriver {
+	case "sqlite":
+	case "postgres":
+		check(validURL(c.StoreURL, "postgres", "postgresql") && c.StoreURL != "", "store_url (STORE_URL) must be a postgres URL with the postgres store driver, not %q", c.StoreURL)
+	case "redis":
+		check(validURL(c.StoreURL, "redis", "rediss") && c.StoreURL != "", "store_url (STORE_URL) must be a redis or rediss URL with the redis store driver, not %q", c.StoreURL)
+	default:
+		check(false, "store_driver (STORE_DRIVER) must be sqlite, postgres or redis, not %q", c.StoreDriver)
+	}
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.LogLevel)) == nil, "log_level (LOG_LEVEL) must be debug, info, warn or error, not %q", c.LogLevel)
+
+	check(c.ShardCount >= 0, "shard_count (SHARD_COUNT) can't be negative")
+	if c.ShardID != nil {
+		check(c.ShardCount > 0, "shard_count (SHARD_COUNT) is required with shard_id")
+		check(*c.ShardID >= 0 && (c.ShardCount == 0 || *c.ShardID < c.ShardCount), "shard_id (SHARD_ID) must be between 0 and shard_count - 1, not %d", *c.ShardID)
+	}
+	check(c.ImagineDailyLimit >= 0, "imagine_daily_limit can't be negative")
+	check(c.HistoryTokenBudget > 0, "history_token_budget must be positive")
+	check(c.SessionIdleTimeout >= 0, "session_idle_timeout can't be negative")
+	check(c.MessageDebounce >= 0 && c.MessageDebounce <= maxMessageDebounce, "message_debounce (MESSAGE_DEBOUNCE_MS) must be from 0 to %v", maxMessageDebounce)
+	check(c.BotLoopLimit >= 0, "bot_loop_limit can't be negative")
+	check(c.MaxResponseChunks >= 0, "max_response_chunks can't be negative")
+	check(c.ThreadSummaryTurns >= 0, "thread_summary_turns can't be negative")
+	check(c.StatusInterval >= 0, "status_interval can't be negative")
+	check(c.DrainTimeout >= 0, "drain_timeout can't be negative")
+	check(len(c.APIKeys) == 0 || c.HTTPAddr != "", "http_addr (HTTP_ADDR) is required with api_keys")
+	for n, entry := range c.APIKeys {
+		// Keys aren't shown, as errors are logged
+		name, key, ids := SplitAPIKey(entry)
+		check(name != "" && len(key) >= minAPIKeyLength && len(ids) > 0,
+			"api_keys (API_KEYS) entry %d must be name:key:ids with a key of at least %d characters and the server or channel IDs it may post in, separated by slashes", n+1, minAPIKeyLength)
+	}
+	check(c.MaxConcurrency > 0, "max_concurrency must be positive")
+	check(c.QueueDepth >= 0, "queue_depth can't be negative")
+	check(c.BreakerThreshold >= 0, "breaker_threshold can't be negative")
+	check(c.BreakerCooldown > 0, "breaker_cooldown must be positive")
+	check(c.MonthlyGuildTokenCap >= 0, "monthly_guild_token_cap can't be negative")
+	check(c.LargePromptTokens >= 0, "large_prompt_tokens can't be negative")
+	check(c.PromptTokenPrice >= 0, "prompt_token_price can't be negative")
+	check(c.MaxMediaMinutes >= 0, "max_media_minutes can't be negative")
+	check(c.MaxPDFPages >= 0, "max_pdf_pages can't be negative")
+	check(c.AttachmentConfirmTokens >= 0, "attachment_confirm_tokens can't be negative")
+	check(c.ResponseCacheTTL >= 0, "response_cache_ttl can't be negative")
+	check(c.ResponseCacheSize > 0, "response_cache_size must be positive")
+	switch c.Audit {
+	case "", "database":
+	case "file":
+		check(c.AuditFile != "", "audit_file (AUDIT_FILE) can't be empty with the file audit log")
+	default:
+		check(false, "audit (AUDIT_LOG) must be database or file, not %q", c.Audit)
+	}
+	check(c.AuditRetentionDays >= 0, "audit_retention_days can't be negative")
+	return errors.Join(errs...)
+}
+
+// validURL reports whether value is empty or an absolute URL with one of
+// the schemes
+func validURL(value string, schemes ...string) bool {
+	if value == "" {
+		return true
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitAPIKey splits an api_keys entry into the name of the integration,
+// its key and the IDs of the servers or channels it may post in
+func SplitAPIKey(entry string) (name string, key string, ids []string) {
+	name, rest, _ := strings.Cut(entry, ":")
+	key, scope, _ := strings.Cut(rest, ":")
+	for _, id := range strings.Split(scope, "/") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return name, key, ids
+}
+
+// String reads a string environment variable, falling back to a default
+// when it is unset or empty
+func String(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Int reads an integer environment variable, falling back to a default
+// when it is unset or empty. Ranges are left to Validate, so 0 can turn off
+// the settings it turns off in the config file.
+func Int(name string, fallback int) (int, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback, fmt.Errorf("%s must be a whole number, not %q", name, value)
+	}
+	return n, nil
+}
+
+// Duration reads an environment variable holding a whole number of units,
+// such as seconds, falling back to a default when it is unset or empty
+func Duration(name string, unit time.Duration, fallback time.Duration) (time.Duration, error) {
+	if strings.TrimSpace(os.Getenv(name)) == "" {
+		return fallback, nil
+	}
+	n, err := Int(name, 0)
+	if err != nil {
+		return fallback, err
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// Float reads a number environment variable such as "0.35", falling back
+// to a default when it is unset or empty
+func Float(name string, fallback float64) (float64, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fallback, fmt.Errorf("%s must be a number, not %q", name, value)
+	}
+	return f, nil
+}
+
+// Bool reads a boolean environment variable such as "true" or "0", falling
+// back to a default when it is unset or empty
+func Bool(name string, fallback bool) (bool, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback, fmt.Errorf("%s must be true or false, not %q", name, value)
+	}
+	return b, nil
+}
+
+// List reads a comma-separated environment variable, skipping empty
+// entries, falling back to a default when it is unset or empty
+func List(name string, fallback []string) ([]string, error) {
+	value := os.Getenv(name)
+	if strings.TrimSpace(value) == "" {
+		return fallback, nil
+	}
+	var values []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			values = append(values, entry)
+		}
+	}
+	if len(values) == 0 {
+		return fallback, fmt.Errorf("%s must list at least one value, not %q", name, value)
+	}
+	return values, nil
+}
+
+// env reads environment variables for applyEnv, keeping the errors of those
+// that don't parse
+type env struct {
+	errs []error
+}
+
+// check keeps an error, if there is one
+func (e *env) check(err error) {
+	if err != nil {
+		e.errs = append(e.errs, err)
+	}
+}
+
+// Int, Duration, Float, Bool and List read a variable like the functions
+// of the same name, keeping the error when it doesn't parse
+func (e *env) Int(name string, fallback int) int {
+	n, err := Int(name, fallback)
+	e.check(err)
+	return n
+}
+
+func (e *env) Duration(name string, unit time.Duration, fallback time.Duration) time.Duration {
+	d, err := Duration(name, unit, fallback)
+	e.check(err)
+	return d
+}
+
+func (e *env) Float(name string, fallback float64) float64 {
+	f, err := Float(name, fallback)
+	e.check(err)
+	return f
+}
+
+func (e *env) Bool(name string, fallback bool) bool {
+	b, err := Bool(name, fallback)
+	e.check(err)
+	return b
+}
+
+func (e *env) List(name string, fallback []string) []string {
+	values, err := List(name, fallback)
+	e.check(err)
+	return values
+}
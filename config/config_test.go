@@ -0,0 +1,314 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInt(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+		err   bool
+	}{
+		{"", 10, false},
+		{"25", 25, false},
+		{" 0 ", 0, false},
+		{"-3", -3, false},
+		{"ten", 10, true},
+		{"2.5", 10, true},
+	}
+	for _, test := range tests {
+		t.Setenv("TEST_INT", test.value)
+		if got, err := Int("TEST_INT", 10); got != test.want || (err != nil) != test.err {
+			t.Errorf("Int(%q) = %d, %v, want %d", test.value, got, err, test.want)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	t.Setenv("TEST_DURATION", "")
+	if got, err := Duration("TEST_DURATION", time.Second, time.Minute); got != time.Minute || err != nil {
+		t.Errorf("Duration of an empty variable = %v, %v, want the fallback", got, err)
+	}
+	t.Setenv("TEST_DURATION", "0")
+	if got, err := Duration("TEST_DURATION", time.Second, time.Minute); got != 0 || err != nil {
+		t.Errorf("Duration(0) = %v, %v, want 0", got, err)
+	}
+	t.Setenv("TEST_DURATION", "90")
+	if got, err := Duration("TEST_DURATION", time.Second, time.Minute); got != 90*time.Second || err != nil {
+		t.Errorf("Duration(90) = %v, %v, want 90s", got, err)
+	}
+	t.Setenv("TEST_DURATION", "1m")
+	if got, err := Duration("TEST_DURATION", time.Second, time.Minute); got != time.Minute || err == nil {
+		t.Errorf("Duration(1m) = %v, %v, want an error", got, err)
+	}
+}
+
+func TestFloat(t *testing.T) {
+	t.Setenv("TEST_FLOAT", "0.35")
+	if got, err := Float("TEST_FLOAT", 1); got != 0.35 || err != nil {
+		t.Errorf("Float = %v, %v, want 0.35", got, err)
+	}
+	t.Setenv("TEST_FLOAT", "cheap")
+	if got, err := Float("TEST_FLOAT", 1); got != 1 || err == nil {
+		t.Errorf("Float(cheap) = %v, %v, want an error", got, err)
+	}
+}
+
+func TestBool(t *testing.T) {
+	tests := []struct {
+		value    string
+		fallback bool
+		want     bool
+		err      bool
+	}{
+		{"", false, false, false},
+		{"", true, true, false},
+		{"true", false, true, false},
+		{"1", false, true, false},
+		{"false", true, false, false},
+		{"yes", true, true, true},
+	}
+	for _, test := range tests {
+		t.Setenv("TEST_BOOL", test.value)
+		if got, err := Bool("TEST_BOOL", test.fallback); got != test.want || (err != nil) != test.err {
+			t.Errorf("Bool(%q, %v) = %v, %v, want %v", test.value, test.fallback, got, err, test.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	t.Setenv("TEST_STRING", "")
+	if got := String("TEST_STRING", "fallback"); got != "fallback" {
+		t.Errorf("String of an empty variable = %q, want fallback", got)
+	}
+	t.Setenv("TEST_STRING", "value")
+	if got := String("TEST_STRING", "fallback"); got != "value" {
+		t.Errorf("String = %q, want value", got)
+	}
+}
+
+func TestList(t *testing.T) {
+	t.Setenv("TEST_LIST", " a.pdf, ,b.md ,")
+	if got, err := List("TEST_LIST", nil); err != nil || !reflect.DeepEqual(got, []string{"a.pdf", "b.md"}) {
+		t.Errorf("List = %q, %v, want [a.pdf b.md]", got, err)
+	}
+	t.Setenv("TEST_LIST", "")
+	if got, err := List("TEST_LIST", []string{"c.txt"}); err != nil || !reflect.DeepEqual(got, []string{"c.txt"}) {
+		t.Errorf("List of an empty variable = %q, %v, want the fallback", got, err)
+	}
+	t.Setenv("TEST_LIST", " , ")
+	if _, err := List("TEST_LIST", []string{"c.txt"}); err == nil {
+		t.Error("List of only commas succeeded, want an error")
+	}
+}
+
+func TestSplitAPIKey(t *testing.T) {
+	name, key, ids := SplitAPIKey("ci:0123456789abcdef:111/ 222/")
+	if name != "ci" || key != "0123456789abcdef" || !reflect.DeepEqual(ids, []string{"111", "222"}) {
+		t.Errorf("SplitAPIKey = %q, %q, %q", name, key, ids)
+	}
+	if _, _, ids := SplitAPIKey("ci:0123456789abcdef"); ids != nil {
+		t.Errorf("SplitAPIKey without IDs = %q, want none", ids)
+	}
+}
+
+// writeConfigFile writes a config file and points CONFIG_FILE at it
+func writeConfigFile(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+}
+
+func TestLoadFileWithEnvOverrides(t *testing.T) {
+	writeConfigFile(t, `
+discord_token: file-token
+gemini_api_keys: [first, second]
+model: gemini-file
+imagine_daily_limit: 3
+auto_thread: true
+drain_timeout: 10s
+session_idle_timeout: 12h
+`)
+	t.Setenv("DISCORD_BOT_TOKEN", "")
+	t.Setenv("GEMINI_API_KEY", "")
+	t.Setenv("GEMINI_MODEL", "gemini-env")
+	t.Setenv("AUTO_THREAD", "false")
+	t.Setenv("SESSION_IDLE_HOURS", "0")
+	t.Setenv("SHARD_ID", "0")
+	t.Setenv("SHARD_COUNT", "4")
+	t.Setenv("RESPONSE_CACHE_TTL", "300")
+	t.Setenv("PROMPT_TOKEN_PRICE", "0.075")
+	t.Setenv("MAX_MEDIA_MINUTES", "0")
+	t.Setenv("STATUSES", "watching the chat, {model}")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.DiscordToken != "file-token" || !reflect.DeepEqual(cfg.GeminiAPIKeys, []string{"first", "second"}) {
+		t.Errorf("file settings = %q, %q", cfg.DiscordToken, cfg.GeminiAPIKeys)
+	}
+	if cfg.Model != "gemini-env" || cfg.AutoThread {
+		t.Errorf("environment didn't override the file: model %q, auto_thread %v", cfg.Model, cfg.AutoThread)
+	}
+	if cfg.ImagineDailyLimit != 3 || cfg.DrainTimeout != 10*time.Second || cfg.QueueDepth != 32 {
+		t.Errorf("limits = %d, %v, %d", cfg.ImagineDailyLimit, cfg.DrainTimeout, cfg.QueueDepth)
+	}
+	if cfg.SessionIdleTimeout != 0 {
+		t.Errorf("SESSION_IDLE_HOURS=0 left session_idle_timeout at %v, want it off", cfg.SessionIdleTimeout)
+	}
+	if cfg.PromptTokenPrice != 0.075 || cfg.LargePromptTokens != 100000 {
+		t.Errorf("prompt pricing = %v, warning at %d tokens", cfg.PromptTokenPrice, cfg.LargePromptTokens)
+	}
+	if cfg.MaxMediaMinutes != 0 || cfg.MaxPDFPages != 500 || cfg.AttachmentConfirmTokens != 100000 {
+		t.Errorf("attachment limits = %d minutes, %d pages, confirmed past %d tokens", cfg.MaxMediaMinutes, cfg.MaxPDFPages, cfg.AttachmentConfirmTokens)
+	}
+	if cfg.ResponseCacheTTL != 5*time.Minute || cfg.ResponseCacheSize != 500 {
+		t.Errorf("response cache = %v, %d entries, want 5m and 500", cfg.ResponseCacheTTL, cfg.ResponseCacheSize)
+	}
+	if !reflect.DeepEqual(cfg.Statuses, []string{"watching the chat", "{model}"}) || cfg.StatusInterval != 5*time.Minute {
+		t.Errorf("statuses = %q every %v", cfg.Statuses, cfg.StatusInterval)
+	}
+	if cfg.ShardID == nil || *cfg.ShardID != 0 || cfg.ShardCount != 4 {
+		t.Errorf("shard = %v of %d, want 0 of 4", cfg.ShardID, cfg.ShardCount)
+	}
+}
+
+func TestLoadRejectsBadFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unknown key", "discord_tokn: x", "field discord_tokn not found"},
+		{"invalid", "backend: [", "error reading"},
+		{"missing token", "gemini_api_keys: [key]", "discord_token (DISCORD_BOT_TOKEN) is required"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writeConfigFile(t, test.content)
+			t.Setenv("DISCORD_BOT_TOKEN", "")
+			if _, err := Load(); err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Load = %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsBadEnv(t *testing.T) {
+	writeConfigFile(t, "discord_token: token\ngemini_api_keys: [key]")
+	t.Setenv("MAX_CONCURRENCY", "four")
+	t.Setenv("SHARD_COUNT", "2")
+	t.Setenv("SHARD_ID", "x")
+	t.Setenv("IMAGE_EDITING", "yes")
+	t.Setenv("LOG_FORMAT", "xml")
+	_, err := Load()
+	for _, want := range []string{
+		`MAX_CONCURRENCY must be a whole number, not "four"`,
+		`SHARD_ID must be a whole number, not "x"`,
+		`IMAGE_EDITING must be true or false, not "yes"`,
+		`LOG_FORMAT must be json or text, not "xml"`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Load = %v, want an error containing %q", err, want)
+		}
+	}
+}
+
+func TestLoadEnvTurnsFeaturesOff(t *testing.T) {
+	writeConfigFile(t, "discord_token: token\ngemini_api_keys: [key]")
+	for _, name := range []string{"MAX_RESPONSE_CHUNKS", "BREAKER_THRESHOLD", "BOT_LOOP_LIMIT", "QUEUE_DEPTH", "MONTHLY_GUILD_TOKEN_CAP", "STATUS_INTERVAL", "AUDIT_RETENTION_DAYS"} {
+		t.Setenv(name, "0")
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.MaxResponseChunks != 0 || cfg.BreakerThreshold != 0 || cfg.BotLoopLimit != 0 || cfg.QueueDepth != 0 ||
+		cfg.MonthlyGuildTokenCap != 0 || cfg.StatusInterval != 0 || cfg.AuditRetentionDays != 0 {
+		t.Errorf("settings = %+v, want 0 to turn them off", cfg)
+	}
+
+	// Settings that must be positive say so
+	t.Setenv("MAX_CONCURRENCY", "0")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "max_concurrency must be positive") {
+		t.Errorf("Load with MAX_CONCURRENCY=0 = %v, want it refused", err)
+	}
+}
+
+func TestLoadLocal(t *testing.T) {
+	writeConfigFile(t, "gemini_api_keys: [key]")
+	t.Setenv("DISCORD_BOT_TOKEN", "")
+	if _, err := LoadLocal(); err != nil {
+		t.Errorf("LoadLocal without a Discord token = %v, want no error", err)
+	}
+}
+
+func TestMockBackend(t *testing.T) {
+	writeConfigFile(t, "discord_token: token")
+	t.Setenv("AI_BACKEND", "mock")
+	t.Setenv("MOCK_DELAY_MS", "250")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load with the mock backend and no API keys = %v, want no error", err)
+	}
+	if cfg.Backend != "mock" || cfg.MockDelay != 250*time.Millisecond {
+		t.Errorf("backend = %q with delay %v, want mock with 250ms", cfg.Backend, cfg.MockDelay)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		cfg := defaults()
+		cfg.DiscordToken = "token"
+		cfg.GeminiAPIKeys = []string{"key"}
+		return cfg
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("Validate of a valid config = %v", err)
+	}
+
+	tests := []struct {
+		change func(*Config)
+		want   string
+	}{
+		{func(c *Config) { c.GeminiAPIKeys = nil }, "gemini_api_keys (GEMINI_API_KEY) is required"},
+		{func(c *Config) { c.Backend = "vertex" }, "vertex_project (VERTEX_PROJECT) is required"},
+		{func(c *Config) { c.Backend = "azure" }, `backend (AI_BACKEND) must be studio, vertex or mock, not "azure"`},
+		{func(c *Config) { c.Backend, c.MockFailEvery = "mock", -1 }, "mock_fail_every (MOCK_FAIL_EVERY) can't be negative"},
+		{func(c *Config) { c.GeminiBaseURL = "generativelanguage.googleapis.com" }, "gemini_base_url (GEMINI_BASE_URL) must be an http or https URL"},
+		{func(c *Config) { c.ProxyURL = "ftp://proxy:21" }, "proxy_url (PROXY_URL) must be an http, https or socks5 URL"},
+		{func(c *Config) { c.DefaultProvider = "openai" }, "openai_base_url (OPENAI_BASE_URL) is required"},
+		{func(c *Config) { c.OpenAIBaseURL = "http://localhost:11434/v1" }, "openai_model (OPENAI_MODEL) is required"},
+		{func(c *Config) { c.LogLevel = "verbose" }, "log_level (LOG_LEVEL) must be"},
+		{func(c *Config) { c.MaxConcurrency = 0 }, "max_concurrency must be positive"},
+		{func(c *Config) { c.MaxResponseChunks = -1 }, "max_response_chunks can't be negative"},
+		{func(c *Config) { c.ThreadSummaryTurns = -1 }, "thread_summary_turns can't be negative"},
+		{func(c *Config) { c.ShardID = new(int) }, "shard_count (SHARD_COUNT) is required with shard_id"},
+		{func(c *Config) { c.ShardID, c.ShardCount = new(int), 2; *c.ShardID = 2 }, "shard_id (SHARD_ID) must be between 0 and shard_count - 1, not 2"},
+		{func(c *Config) { c.StoreDriver = "mysql" }, `store_driver (STORE_DRIVER) must be sqlite, postgres or redis, not "mysql"`},
+		{func(c *Config) { c.StoreDriver = "redis" }, "store_url (STORE_URL) must be a redis or rediss URL"},
+		{func(c *Config) { c.StoreDriver, c.StoreURL = "postgres", "redis://cache:6379" }, "store_url (STORE_URL) must be a postgres URL"},
+		{func(c *Config) { c.APIKeys = []string{"ci:0123456789abcdef:guild"} }, "http_addr (HTTP_ADDR) is required with api_keys"},
+		{func(c *Config) { c.HTTPAddr, c.APIKeys = ":8080", []string{"ci:short:guild"} }, "api_keys (API_KEYS) entry 1 must be name:key:ids"},
+		{func(c *Config) { c.HTTPAddr, c.APIKeys = ":8080", []string{"ci:0123456789abcdef"} }, "api_keys (API_KEYS) entry 1 must be name:key:ids"},
+		{func(c *Config) { c.MessageDebounce = time.Minute }, "message_debounce (MESSAGE_DEBOUNCE_MS) must be from 0 to 10s"},
+		{func(c *Config) { c.Audit = "syslog" }, `audit (AUDIT_LOG) must be database or file, not "syslog"`},
+	}
+	for _, test := range tests {
+		cfg := valid()
+		test.change(cfg)
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Validate = %v, want an error containing %q", err, test.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 5, 15, 10, 31, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2024, 5, 16, 9, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 5, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, 5, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 18 * * 7", time.Date(2024, 5, 19, 18, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 5, 19, 0, 0, 0, 0, time.UTC)},
+		{"30 8 1 * *", time.Date(2024, 6, 1, 8, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1 * 5", time.Date(2024, 5, 17, 12, 0, 0, 0, time.UTC)},
+		{"5,35 10 * * *", time.Date(2024, 5, 15, 10, 35, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		schedule, err := Parse(test.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", test.spec, err)
+		}
+		if got := schedule.Next(from); !got.Equal(test.want) {
+			t.Errorf("Parse(%q).Next = %v, want %v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"0 9 * *", "want 5 fields"},
+		{"60 * * * *", `minute field "60" is outside 0-59`},
+		{"0 9-5 * * *", `hour field "9-5" is outside 0-23`},
+		{"*/0 * * * *", `invalid step "0" in minute field`},
+		{"0 9 * * mon", `invalid value "mon" in day of week field`},
+	}
+	for _, test := range tests {
+		if _, err := Parse(test.spec); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Parse(%q) = %v, want an error containing %q", test.spec, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Package diagram finds Mermaid and Graphviz diagrams in Markdown and
+// renders them to PNG images with their command-line tools.
+package diagram
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Languages of the diagrams found, as tagged on their code blocks
+const (
+	Mermaid  = "mermaid"
+	Graphviz = "dot"
+)
+
+// Largest diagram source rendered, in bytes, and largest image kept
+const (
+	maxSourceSize = 20_000
+	maxImageSize  = 8 << 20
+)
+
+// ErrNoRenderer is returned for diagrams whose tool isn't configured or
+// installed
+var ErrNoRenderer = errors.New("no renderer for this diagram language")
+
+// Fenced code blocks tagged as Mermaid or Graphviz
+var block = regexp.MustCompile("(?s)```[ \\t]*(mermaid|dot|graphviz|gv)[ \\t]*\\n(.*?)\\n?```")
+
+// Diagram is the source of a diagram found in a code block
+type Diagram struct {
+	// Language is Mermaid or Graphviz
+	Language string
+	Source   string
+}
+
+// Find returns the diagrams in the code blocks of Markdown text, at most max
+func Find(text string, max int) []Diagram {
+	var diagrams []Diagram
+	for _, match := range block.FindAllStringSubmatch(text, max) {
+		language := Mermaid
+		if match[1] != Mermaid {
+			language = Graphviz
+		}
+		if source := strings.TrimSpace(match[2]); source != "" {
+			diagrams = append(diagrams, Diagram{Language: language, Source: source})
+		}
+	}
+	return diagrams
+}
+
+// Renderer renders diagrams with command-line tools, given as a program
+// followed by its arguments: Mermaid's mmdc, which is passed the paths of
+// its input and output files, and Graphviz's dot, which reads the source
+// on stdin and writes the image to stdout. A tool left empty isn't used.
+type Renderer struct {
+	Mermaid  []string
+	Graphviz []string
+}
+
+// Available reports whether the tool of a diagram language is configured
+// and installed
+func (r *Renderer) Available(language string) bool {
+	command := r.command(language)
+	if len(command) == 0 {
+		return false
+	}
+	_, err := exec.LookPath(command[0])
+	return err == nil
+}
+
+// command returns the tool rendering a diagram language
+func (r *Renderer) command(language string) []string {
+	if language == Mermaid {
+		return r.Mermaid
+	}
+	return r.Graphviz
+}
+
+// Render renders a diagram to a PNG image, stopping the tool when ctx ends
+func (r *Renderer) Render(ctx context.Context, d Diagram) ([]byte, error) {
+	if !r.Available(d.Language) {
+		return nil, ErrNoRenderer
+	}
+	if len(d.Source) > maxSourceSize {
+		return nil, fmt.Errorf("%s diagram is larger than %d KB", d.Language, maxSourceSize/1000)
+	}
+	if d.Language == Mermaid {
+		return r.renderMermaid(ctx, d.Source)
+	}
+	return run(ctx, r.Graphviz, []string{"-Tpng"}, d.Source)
+}
+
+// renderMermaid runs mmdc, which only reads and writes files
+func (r *Renderer) renderMermaid(ctx context.Context, source string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "diagram-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input, output := filepath.Join(dir, "diagram.mmd"), filepath.Join(dir, "diagram.png")
+	if err := os.WriteFile(input, []byte(source), 0o600); err != nil {
+		return nil, err
+	}
+	if _, err := run(ctx, r.Mermaid, []string{"-i", input, "-o", output, "-b", "white"}, ""); err != nil {
+		return nil, err
+	}
+	return readImage(output)
+}
+
+// readImage reads a rendered image, refusing ones too large to post
+func readImage(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxImageSize {
+		return nil, fmt.Errorf("rendered diagram is larger than %d MB", maxImageSize>>20)
+	}
+	return os.ReadFile(path)
+}
+
+// run runs a tool with extra arguments and stdin, returning its stdout, or
+// an error with what it wrote to stderr
+func run(ctx context.Context, command []string, args []string, stdin string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, command[0], append(append([]string{}, command[1:]...), args...)...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%s: %w: %s", filepath.Base(command[0]), err, firstLine(message))
+		}
+		return nil, fmt.Errorf("%s: %w", filepath.Base(command[0]), err)
+	}
+	if stdout.Len() > maxImageSize {
+		return nil, fmt.Errorf("rendered diagram is larger than %d MB", maxImageSize>>20)
+	}
+	return stdout.Bytes(), nil
+}
+
+// firstLine returns the first line of text
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return line
+}
@@ -0,0 +1,54 @@
+package diagram
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	text := "Here's the flow:\n```mermaid\ngraph TD\n  A-->B\n```\nand the graph:\n```dot\ndigraph { a -> b }\n```\n" +
+		"```go\nfmt.Println()\n```\n```graphviz\n\n```"
+	want := []Diagram{
+		{Language: Mermaid, Source: "graph TD\n  A-->B"},
+		{Language: Graphviz, Source: "digraph { a -> b }"},
+	}
+	if got := Find(text, 10); !reflect.DeepEqual(got, want) {
+		t.Errorf("Find = %+v, want %+v", got, want)
+	}
+	if got := Find(text, 1); len(got) != 1 {
+		t.Errorf("Find with a maximum of 1 found %d diagrams", len(got))
+	}
+}
+
+func TestRender(t *testing.T) {
+	// Stand-ins for dot, echoing the source, and mmdc, copying its input
+	// file to its output file
+	r := &Renderer{
+		Graphviz: []string{"sh", "-c", "cat"},
+		Mermaid:  []string{"sh", "-c", `cp "$1" "$3"`},
+	}
+	ctx := context.Background()
+
+	for _, d := range []Diagram{{Language: Graphviz, Source: "digraph { a -> b }"}, {Language: Mermaid, Source: "graph TD\n  A-->B"}} {
+		image, err := r.Render(ctx, d)
+		if err != nil {
+			t.Fatalf("Render %s: %v", d.Language, err)
+		}
+		if string(image) != d.Source {
+			t.Errorf("Render %s = %q, want the tool's output", d.Language, image)
+		}
+	}
+
+	r.Graphviz = []string{"sh", "-c", "echo 'syntax error in line 1' >&2; exit 1"}
+	if _, err := r.Render(ctx, Diagram{Language: Graphviz, Source: "digraph {"}); err == nil || !strings.Contains(err.Error(), "syntax error in line 1") {
+		t.Errorf("Render of a failing tool = %v, want its message", err)
+	}
+
+	r.Mermaid = []string{"no-such-mmdc"}
+	if _, err := r.Render(ctx, Diagram{Language: Mermaid, Source: "graph TD"}); !errors.Is(err, ErrNoRenderer) {
+		t.Errorf("Render without mmdc = %v, want ErrNoRenderer", err)
+	}
+}
@@ -0,0 +1,149 @@
+// Package health serves the bot's liveness and readiness endpoints.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The gateway may be disconnected this long, while discordgo reconnects,
+// before the bot is reported unhealthy
+const disconnectedGrace = 5 * time.Minute
+
+// Pinger is a dependency that can report whether it is reachable
+type Pinger interface {
+	Ping() error
+}
+
+// Checker tracks the state /healthz and /readyz report
+type Checker struct {
+	// Store is the session store checked by /readyz
+	Store Pinger
+
+	// LastGeminiSuccess returns when a Gemini call last succeeded
+	LastGeminiSuccess func() time.Time
+
+	// Shards is the number of gateway shards this process runs, all of
+	// which must be connected for the gateway to count as connected
+	Shards int
+
+	mu        sync.Mutex
+	shards    map[int]bool
+	connected bool
+	changed   time.Time
+}
+
+// NewChecker creates a checker for one gateway shard; the gateway counts as
+// disconnected until SetConnected is called
+func NewChecker(store Pinger, lastGeminiSuccess func() time.Time) *Checker {
+	return &Checker{Store: store, LastGeminiSuccess: lastGeminiSuccess, Shards: 1, shards: map[int]bool{}, changed: time.Now()}
+}
+
+// SetConnected records a Discord gateway shard connecting or disconnecting
+func (c *Checker) SetConnected(shard int, connected bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.shards[shard] = connected
+	if all := c.connectedShards() >= c.Shards; c.connected != all {
+		c.connected = all
+		c.changed = time.Now()
+	}
+}
+
+// connectedShards counts the connected shards; the caller holds mu
+func (c *Checker) connectedShards() int {
+	var up int
+	for _, connected := range c.shards {
+		if connected {
+			up++
+		}
+	}
+	return up
+}
+
+// status is the JSON body of both endpoints
+type status struct {
+	Status            string     `json:"status"`
+	Discord           string     `json:"discord"`
+	ShardsConnected   *int       `json:"shards_connected,omitempty"`
+	Store             string     `json:"store,omitempty"`
+	LastGeminiSuccess *time.Time `json:"last_gemini_success,omitempty"`
+}
+
+// Register adds /healthz and /readyz to a mux
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", c.healthz)
+	mux.HandleFunc("/readyz", c.readyz)
+}
+
+// healthz reports the bot alive unless the gateway has been disconnected
+// for longer than discordgo takes to reconnect, meaning it is wedged
+func (c *Checker) healthz(w http.ResponseWriter, r *http.Request) {
+	s := c.status()
+	if s.Discord == "disconnected" && c.disconnectedFor() > disconnectedGrace {
+		s.Status = "unhealthy"
+	}
+	writeStatus(w, s)
+}
+
+// readyz reports the bot ready when the gateway is connected and the
+// session store answers
+func (c *Checker) readyz(w http.ResponseWriter, r *http.Request) {
+	s := c.status()
+	if s.Discord != "connected" {
+		s.Status = "unready"
+	}
+	s.Store = "ok"
+	if c.Store != nil {
+		if err := c.Store.Ping(); err != nil {
+			s.Store = err.Error()
+			s.Status = "unready"
+		}
+	}
+	writeStatus(w, s)
+}
+
+// status returns the state shared by both endpoints
+func (c *Checker) status() status {
+	c.mu.Lock()
+	connected := c.connected
+	up, shards := c.connectedShards(), c.Shards
+	c.mu.Unlock()
+
+	s := status{Status: "ok", Discord: "disconnected"}
+	if connected {
+		s.Discord = "connected"
+	}
+	if shards > 1 {
+		s.ShardsConnected = &up
+	}
+	if c.LastGeminiSuccess != nil {
+		if last := c.LastGeminiSuccess(); !last.IsZero() {
+			s.LastGeminiSuccess = &last
+		}
+	}
+	return s
+}
+
+// disconnectedFor returns how long the gateway has been disconnected
+func (c *Checker) disconnectedFor() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.connected {
+		return 0
+	}
+	return time.Since(c.changed)
+}
+
+// writeStatus writes a status as JSON, with 503 unless it is ok
+func writeStatus(w http.ResponseWriter, s status) {
+	w.Header().Set("Content-Type", "application/json")
+	if s.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(s)
+}
@@ -0,0 +1,97 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeStore is a Pinger returning a fixed error
+type fakeStore struct {
+	err error
+}
+
+func (s fakeStore) Ping() error {
+	return s.err
+}
+
+// get requests a path from the checker's endpoints
+func get(t *testing.T, c *Checker, path string) (int, status) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	c.Register(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var s status
+	if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+		t.Fatalf("decoding %s: %v", path, err)
+	}
+	return rec.Code, s
+}
+
+func TestReadyz(t *testing.T) {
+	last := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c := NewChecker(fakeStore{}, func() time.Time { return last })
+
+	if code, s := get(t, c, "/readyz"); code != http.StatusServiceUnavailable || s.Discord != "disconnected" {
+		t.Errorf("before connecting: %d %+v", code, s)
+	}
+
+	c.SetConnected(0, true)
+	code, s := get(t, c, "/readyz")
+	if code != http.StatusOK || s.Status != "ok" || s.Store != "ok" {
+		t.Errorf("connected: %d %+v", code, s)
+	}
+	if s.LastGeminiSuccess == nil || !s.LastGeminiSuccess.Equal(last) {
+		t.Errorf("last Gemini success = %v, want %v", s.LastGeminiSuccess, last)
+	}
+
+	c.Store = fakeStore{err: errors.New("database is locked")}
+	if code, s := get(t, c, "/readyz"); code != http.StatusServiceUnavailable || s.Store != "database is locked" {
+		t.Errorf("store failing: %d %+v", code, s)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	c := NewChecker(fakeStore{}, nil)
+
+	// Briefly disconnected while reconnecting is still healthy
+	if code, _ := get(t, c, "/healthz"); code != http.StatusOK {
+		t.Errorf("just started: %d, want 200", code)
+	}
+
+	c.changed = time.Now().Add(-disconnectedGrace - time.Minute)
+	if code, s := get(t, c, "/healthz"); code != http.StatusServiceUnavailable || s.Status != "unhealthy" {
+		t.Errorf("disconnected for long: %d %+v", code, s)
+	}
+
+	c.SetConnected(0, true)
+	if code, _ := get(t, c, "/healthz"); code != http.StatusOK {
+		t.Errorf("connected: %d, want 200", code)
+	}
+}
+
+func TestShards(t *testing.T) {
+	c := NewChecker(fakeStore{}, nil)
+	c.Shards = 2
+
+	c.SetConnected(0, true)
+	if code, s := get(t, c, "/readyz"); code != http.StatusServiceUnavailable || s.ShardsConnected == nil || *s.ShardsConnected != 1 {
+		t.Errorf("one of two shards connected: %d %+v", code, s)
+	}
+
+	c.SetConnected(1, true)
+	if code, s := get(t, c, "/readyz"); code != http.StatusOK || s.Discord != "connected" {
+		t.Errorf("both shards connected: %d %+v", code, s)
+	}
+
+	c.SetConnected(0, false)
+	if code, s := get(t, c, "/readyz"); code != http.StatusServiceUnavailable || s.Discord != "disconnected" {
+		t.Errorf("shard 0 disconnected: %d %+v", code, s)
+	}
+}
@@ -0,0 +1,112 @@
+package i18n
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Languages told apart by the words they use most, as they share the Latin
+// script
+var latinLanguages = []struct {
+	name    string
+	words   []string
+	letters string // letters hardly used by the other languages
+}{
+	{"English", []string{"the", "and", "is", "are", "you", "what", "how", "this", "that", "with", "for", "can", "it", "of", "to", "do", "my", "your", "i", "me"}, ""},
+	{"Spanish", []string{"el", "la", "los", "las", "que", "es", "y", "de", "en", "por", "para", "con", "una", "un", "cómo", "qué", "mi", "hola", "pero", "está"}, "ñ¿¡"},
+	{"French", []string{"le", "la", "les", "est", "et", "de", "des", "un", "une", "je", "tu", "vous", "que", "qui", "pour", "avec", "pas", "ce", "bonjour", "comment"}, "êèàùç"},
+	{"German", []string{"der", "die", "das", "und", "ist", "ich", "du", "nicht", "ein", "eine", "mit", "wie", "was", "zu", "auf", "für", "den", "sie", "hallo", "kannst"}, "äöüß"},
+	{"Portuguese", []string{"o", "os", "as", "que", "é", "e", "de", "em", "um", "uma", "não", "com", "para", "você", "eu", "como", "olá", "isso", "do", "da"}, "ãõ"},
+	{"Italian", []string{"il", "lo", "gli", "che", "è", "e", "di", "un", "una", "non", "per", "con", "sono", "come", "ciao", "cosa", "mi", "ho", "della", "questo"}, "ò"},
+	{"Dutch", []string{"de", "het", "een", "en", "is", "ik", "je", "niet", "van", "dat", "wat", "hoe", "met", "voor", "zijn", "op", "hallo", "kun", "mijn", "ook"}, "ĳ"},
+	{"Polish", []string{"i", "w", "nie", "się", "na", "jest", "to", "że", "jak", "co", "z", "do", "czy", "mi", "ale", "cześć", "mój", "dla", "tak", "proszę"}, "ąęłśżźćń"},
+	{"Turkish", []string{"ve", "bir", "bu", "ne", "mi", "ben", "sen", "için", "ile", "nasıl", "merhaba", "var", "yok", "da", "de", "çok", "gibi", "ama", "değil", "misin"}, "ğış"},
+}
+
+// Languages recognized by the script they are written in
+var scriptLanguages = []struct {
+	name   string
+	script *unicode.RangeTable
+}{
+	{"Japanese", unicode.Hiragana},
+	{"Japanese", unicode.Katakana},
+	{"Korean", unicode.Hangul},
+	{"Chinese", unicode.Han},
+	{"Russian", unicode.Cyrillic},
+	{"Greek", unicode.Greek},
+	{"Arabic", unicode.Arabic},
+	{"Hebrew", unicode.Hebrew},
+	{"Hindi", unicode.Devanagari},
+	{"Thai", unicode.Thai},
+}
+
+// DetectLanguage guesses the language text is written in, returning its
+// English name such as "Spanish", or "" when the text is too short or mixed
+// to tell. It recognizes languages by their script, and Latin-script ones
+// by their most common words.
+func DetectLanguage(text string) string {
+	var latin, other int
+	scripts := map[string]int{}
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		other++
+		for _, language := range scriptLanguages {
+			if unicode.Is(language.script, r) {
+				scripts[language.name]++
+				break
+			}
+		}
+	}
+	if other > latin {
+		// Japanese mixes kana with Chinese characters
+		if scripts["Japanese"] > 0 {
+			return "Japanese"
+		}
+		best, count := "", 0
+		for name, n := range scripts {
+			if n > count {
+				best, count = name, n
+			}
+		}
+		if best == "Russian" && strings.ContainsAny(strings.ToLower(text), "іїєґ") {
+			return "Ukrainian"
+		}
+		return best
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	best, bestScore, secondScore := "", 0, 0
+	for _, language := range latinLanguages {
+		score := 0
+		for _, word := range words {
+			for _, common := range language.words {
+				if word == common {
+					score++
+					break
+				}
+			}
+		}
+		if language.letters != "" && strings.ContainsAny(strings.ToLower(text), language.letters) {
+			score++
+		}
+		switch {
+		case score > bestScore:
+			best, bestScore, secondScore = language.name, score, bestScore
+		case score > secondScore:
+			secondScore = score
+		}
+	}
+	// Too few common words to be sure, or as many of another language's
+	if bestScore < 2 || bestScore == secondScore {
+		return ""
+	}
+	return best
+}
@@ -0,0 +1,35 @@
+package i18n
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"What is the capital of France and how big is it?", "English"},
+		{"¿Cuál es la capital de Francia y qué tan grande es?", "Spanish"},
+		{"Bonjour, est-ce que tu peux m'expliquer comment marche le moteur ?", "French"},
+		{"Hallo, kannst du mir erklären, wie das funktioniert?", "German"},
+		{"Olá, você pode me explicar como isso funciona?", "Portuguese"},
+		{"Ciao, mi spieghi come funziona questo codice?", "Italian"},
+		{"Hallo, kun je mij uitleggen hoe dat werkt?", "Dutch"},
+		{"Cześć, czy możesz mi wyjaśnić, jak to działa?", "Polish"},
+		{"Merhaba, bunun nasıl çalıştığını açıklar mısın?", "Turkish"},
+		{"Привет, как дела?", "Russian"},
+		{"Привіт, як справи? Що нового в її житті?", "Ukrainian"},
+		{"こんにちは、元気ですか？", "Japanese"},
+		{"你好，今天天气怎么样？", "Chinese"},
+		{"안녕하세요, 잘 지내세요?", "Korean"},
+		{"مرحبا كيف حالك؟", "Arabic"},
+		{"Explain `fmt.Println` in Go", ""},
+		{"hi", ""},
+		{"lol 😂", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := DetectLanguage(test.text); got != test.want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
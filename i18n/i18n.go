@@ -0,0 +1,168 @@
+// Package i18n translates what the bot says, and its commands, into the
+// languages of Discord's locales, and detects the language of messages
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Translations, one file per language such as de.json, or per locale such
+// as pt-BR.json
+//
+//go:embed locales/*.json
+var files embed.FS
+
+// catalog holds the translations of one language, keyed by their English
+// text
+type catalog struct {
+	// Command names, which Discord restricts to lowercase words for slash
+	// commands
+	Names map[string]string `json:"names"`
+	// Messages, descriptions and choices, as fmt format strings when the
+	// English text is one
+	Messages map[string]string `json:"messages"`
+}
+
+// Catalogs by language or locale
+var catalogs = loadCatalogs()
+
+// loadCatalogs reads the embedded translations
+func loadCatalogs() map[string]*catalog {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(fmt.Sprintf("error reading translations: %v", err))
+	}
+	catalogs := map[string]*catalog{}
+	for _, entry := range entries {
+		data, err := files.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(fmt.Sprintf("error reading translation %s: %v", entry.Name(), err))
+		}
+		var c catalog
+		if err := json.Unmarshal(data, &c); err != nil {
+			panic(fmt.Sprintf("error parsing translation %s: %v", entry.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(entry.Name(), ".json")] = &c
+	}
+	return catalogs
+}
+
+// lookup returns the catalog of a locale, falling back to its language's
+// so that es-ES and es-419 share es.json, or nil for English and locales
+// without translations
+func lookup(locale discordgo.Locale) *catalog {
+	if c, ok := catalogs[string(locale)]; ok {
+		return c
+	}
+	language, _, _ := strings.Cut(string(locale), "-")
+	return catalogs[language]
+}
+
+// Languages returns the languages and locales with translations, sorted
+func Languages() []string {
+	languages := make([]string, 0, len(catalogs))
+	for language := range catalogs {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Translate returns text in a locale, or as is when it has no translation,
+// formatted with args like fmt.Sprintf when there are any
+func Translate(locale discordgo.Locale, text string, args ...any) string {
+	if c := lookup(locale); c != nil {
+		if translated, ok := c.Messages[text]; ok {
+			text = translated
+		}
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// Has reports whether text has a translation in a locale, even one
+// written the same as the English
+func Has(locale discordgo.Locale, text string) bool {
+	c := lookup(locale)
+	if c == nil {
+		return false
+	}
+	_, ok := c.Messages[text]
+	return ok
+}
+
+// Name returns a command's name in a locale, or its English name when it
+// has no translation
+func Name(locale discordgo.Locale, name string) string {
+	if c := lookup(locale); c != nil {
+		if translated, ok := c.Names[name]; ok {
+			return translated
+		}
+	}
+	return name
+}
+
+// LocalizeCommands sets the name and description localizations of commands,
+// their options and their choices for every Discord locale with a
+// translation, which Discord shows to users of that locale
+func LocalizeCommands(commands []*discordgo.ApplicationCommand) {
+	for _, command := range commands {
+		names := localizations(func(c *catalog) map[string]string { return c.Names }, command.Name)
+		if names != nil {
+			command.NameLocalizations = &names
+		}
+		if descriptions := localizations(messages, command.Description); descriptions != nil {
+			command.DescriptionLocalizations = &descriptions
+		}
+		localizeOptions(command.Options)
+	}
+}
+
+// localizeOptions sets the description localizations of options, their
+// subcommands' options and their choices. Only command names are
+// translated, so options are typed the same in every language.
+func localizeOptions(options []*discordgo.ApplicationCommandOption) {
+	for _, option := range options {
+		option.DescriptionLocalizations = localizations(messages, option.Description)
+		for _, choice := range option.Choices {
+			choice.NameLocalizations = localizations(messages, choice.Name)
+		}
+		localizeOptions(option.Options)
+	}
+}
+
+// messages returns the messages of a catalog
+func messages(c *catalog) map[string]string {
+	return c.Messages
+}
+
+// localizations returns the translations of text from the given part of the
+// catalogs for every Discord locale that has one, or nil if none does
+func localizations(part func(*catalog) map[string]string, text string) map[discordgo.Locale]string {
+	if text == "" {
+		return nil
+	}
+	var translations map[discordgo.Locale]string
+	for locale := range discordgo.Locales {
+		c := lookup(locale)
+		if c == nil {
+			continue
+		}
+		if translated, ok := part(c)[text]; ok {
+			if translations == nil {
+				translations = map[discordgo.Locale]string{}
+			}
+			translations[locale] = translated
+		}
+	}
+	return translations
+}
@@ -0,0 +1,115 @@
+package i18n
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		locale discordgo.Locale
+		text   string
+		args   []any
+		want   string
+	}{
+		{discordgo.German, "Chat history has been cleared!", nil, "Der Chatverlauf wurde gelöscht!"},
+		{discordgo.SpanishES, "Chat history has been cleared!", nil, "¡Se ha borrado el historial del chat!"},
+		{discordgo.French, "Sorry, an error occurred: %v", []any{"quota"}, "Désolé, une erreur s'est produite : quota"},
+		{discordgo.EnglishUS, "Sorry, an error occurred: %v", []any{"quota"}, "Sorry, an error occurred: quota"},
+		{discordgo.Japanese, "Chat history has been cleared!", nil, "Chat history has been cleared!"},
+		{discordgo.German, "Not translated", nil, "Not translated"},
+		{"", "100% sure", nil, "100% sure"},
+	}
+	for _, test := range tests {
+		if got := Translate(test.locale, test.text, test.args...); got != test.want {
+			t.Errorf("Translate(%q, %q) = %q, want %q", test.locale, test.text, got, test.want)
+		}
+	}
+
+	if got := Name(discordgo.French, "help"); got != "aide" {
+		t.Errorf("Name(fr, help) = %q, want aide", got)
+	}
+	if got := Name(discordgo.Japanese, "help"); got != "help" {
+		t.Errorf("Name(ja, help) = %q, want help", got)
+	}
+}
+
+// Format verbs, which translations must keep in the same order
+var verbs = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func TestCatalogs(t *testing.T) {
+	if len(Languages()) == 0 {
+		t.Fatal("no translations loaded")
+	}
+	for _, language := range Languages() {
+		c := catalogs[language]
+		for text, translated := range c.Messages {
+			if got, want := verbs.FindAllString(translated, -1), verbs.FindAllString(text, -1); len(got) != len(want) {
+				t.Errorf("%s: %q has verbs %q, want %q", language, translated, got, want)
+			} else {
+				for n := range got {
+					if got[n] != want[n] {
+						t.Errorf("%s: %q has verbs %q, want %q", language, translated, got, want)
+						break
+					}
+				}
+			}
+		}
+		for name, translated := range c.Names {
+			if translated == "" {
+				t.Errorf("%s: empty name for %q", language, name)
+			}
+		}
+	}
+}
+
+func TestLocalizeCommands(t *testing.T) {
+	commands := []*discordgo.ApplicationCommand{
+		{
+			Name:        "clear",
+			Description: "Clear the chat history with Gemini AI",
+		},
+		{
+			Name:        "reactions",
+			Description: "Not translated",
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "set",
+				Description: "Make reacting with an emoji run an action (Manage Server)",
+				Options: []*discordgo.ApplicationCommandOption{{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "action",
+					Description: "What reacting with it does",
+					Choices:     []*discordgo.ApplicationCommandOptionChoice{{Name: "summarize", Value: "summarize"}},
+				}},
+			}},
+		},
+	}
+	LocalizeCommands(commands)
+
+	clear := commands[0]
+	if clear.NameLocalizations == nil || (*clear.NameLocalizations)[discordgo.German] != "leeren" {
+		t.Errorf("clear name localizations = %v, want German", clear.NameLocalizations)
+	}
+	// Both Spanish locales use es.json
+	if clear.DescriptionLocalizations == nil || (*clear.DescriptionLocalizations)[discordgo.SpanishES] != "Borrar el historial del chat con Gemini AI" {
+		t.Errorf("clear description localizations = %v, want Spanish", clear.DescriptionLocalizations)
+	}
+	if _, ok := (*clear.DescriptionLocalizations)[discordgo.EnglishUS]; ok {
+		t.Error("clear has an English localization")
+	}
+
+	reactions := commands[1]
+	if reactions.DescriptionLocalizations != nil {
+		t.Errorf("untranslated description localizations = %v, want none", *reactions.DescriptionLocalizations)
+	}
+	set := reactions.Options[0]
+	if set.DescriptionLocalizations[discordgo.French] == "" || set.NameLocalizations != nil {
+		t.Errorf("subcommand localizations = %v %v, want a French description only", set.NameLocalizations, set.DescriptionLocalizations)
+	}
+	if choice := set.Options[0].Choices[0]; choice.NameLocalizations[discordgo.German] != "zusammenfassen" {
+		t.Errorf("choice localizations = %v, want German", choice.NameLocalizations)
+	}
+}
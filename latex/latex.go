@@ -0,0 +1,334 @@
+// Package latex converts the LaTeX math in Markdown to Unicode
+// approximations, since Discord shows math as its raw source.
+package latex
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	// Fenced code blocks and inline code, left as they are
+	code = regexp.MustCompile("(?s)```.*?```|`[^`\n]+`")
+
+	// Display math between $$ or \[ \], and inline math between \( \) or
+	// single dollars. A dollar opening inline math isn't followed by a
+	// space and one closing it isn't preceded by one, so prices like "$5
+	// and $10" aren't taken for math.
+	math = regexp.MustCompile(`(?s)\$\$(.+?)\$\$|\\\[(.+?)\\\]|\\\((.+?)\\\)|\$([^\s$](?:[^$\n]*[^\s$\\])?)\$`)
+
+	// A number, written as it is in a fraction
+	number = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+)
+
+// Convert replaces the math of Markdown text with its Unicode
+// approximation, outside code
+func Convert(text string) string {
+	var out strings.Builder
+	last := 0
+	for _, span := range code.FindAllStringIndex(text, -1) {
+		out.WriteString(convertMath(text[last:span[0]]))
+		out.WriteString(text[span[0]:span[1]])
+		last = span[1]
+	}
+	out.WriteString(convertMath(text[last:]))
+	return out.String()
+}
+
+// convertMath replaces the math of text without code
+func convertMath(text string) string {
+	return math.ReplaceAllStringFunc(text, func(match string) string {
+		groups := math.FindStringSubmatch(match)
+		switch {
+		case groups[1] != "" || groups[2] != "":
+			// Display math goes on a line of its own
+			return "\n" + strings.TrimSpace(ToUnicode(groups[1]+groups[2])) + "\n"
+		case groups[4] != "" && !looksLikeMath(groups[4]):
+			return match
+		default:
+			return ToUnicode(groups[3] + groups[4])
+		}
+	})
+}
+
+// looksLikeMath reports whether the text between single dollars is math
+// rather than prose that happens to sit between two dollar signs
+func looksLikeMath(text string) bool {
+	if strings.ContainsAny(text, `\^_{}=+<>`) {
+		return true
+	}
+	// A single term with a letter, like $x$ or $2n$, not amounts like $20-$
+	return !strings.Contains(text, " ") && len([]rune(text)) <= 10 && strings.IndexFunc(text, unicode.IsLetter) >= 0
+}
+
+// ToUnicode converts LaTeX math to its Unicode approximation: symbols and
+// Greek letters become their characters, scripts become superscript and
+// subscript characters where they all exist, and fractions are written
+// inline with a slash.
+func ToUnicode(source string) string {
+	p := &parser{source: []rune(source)}
+	text := p.sequence(0)
+	// Collapse the runs of spaces left by spacing commands and source
+	// formatting, keeping line breaks
+	lines := strings.Split(text, "\n")
+	for n, line := range lines {
+		lines[n] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// parser reads LaTeX math a token at a time
+type parser struct {
+	source []rune
+	pos    int
+
+	// How many matrix environments enclose the position
+	matrices int
+}
+
+// sequence converts tokens up to the end of the source or, when end is
+// set, up to the closing end, which it consumes
+func (p *parser) sequence(end rune) string {
+	var out strings.Builder
+	for p.pos < len(p.source) {
+		if end != 0 && p.source[p.pos] == end {
+			p.pos++
+			break
+		}
+		if p.atEnvironmentEnd() {
+			break
+		}
+		out.WriteString(p.token())
+	}
+	return out.String()
+}
+
+// atEnvironmentEnd reports whether \end comes next, which ends the
+// contents of an environment
+func (p *parser) atEnvironmentEnd() bool {
+	return p.matrices > 0 && p.atEnd()
+}
+
+// atEnd reports whether \end comes next
+func (p *parser) atEnd() bool {
+	return strings.HasPrefix(string(p.source[p.pos:min(p.pos+4, len(p.source))]), `\end`)
+}
+
+// token converts the next token: a group, a command, a script or a
+// character
+func (p *parser) token() string {
+	c := p.source[p.pos]
+	p.pos++
+	switch c {
+	case '{':
+		return p.sequence('}')
+	case '\\':
+		return p.command()
+	case '^':
+		return script(p.argument(), superscripts, "^")
+	case '_':
+		return script(p.argument(), subscripts, "_")
+	case '&':
+		return " "
+	case '~':
+		return " "
+	case '\'':
+		return "′"
+	case '\n', '\t':
+		return " "
+	}
+	return string(c)
+}
+
+// argument converts the argument of a command or script: a group or a
+// single token
+func (p *parser) argument() string {
+	p.skipSpaces()
+	if p.pos >= len(p.source) {
+		return ""
+	}
+	return p.token()
+}
+
+// optionalArgument converts an argument in square brackets, if there is one
+func (p *parser) optionalArgument() string {
+	p.skipSpaces()
+	if p.pos >= len(p.source) || p.source[p.pos] != '[' {
+		return ""
+	}
+	p.pos++
+	return p.sequence(']')
+}
+
+// rawArgument returns the source of a group argument, like the name of an
+// environment
+func (p *parser) rawArgument() string {
+	p.skipSpaces()
+	if p.pos >= len(p.source) || p.source[p.pos] != '{' {
+		return ""
+	}
+	end := p.pos + 1
+	for end < len(p.source) && p.source[end] != '}' {
+		end++
+	}
+	raw := string(p.source[p.pos+1 : end])
+	p.pos = min(end+1, len(p.source))
+	return raw
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.source) && unicode.IsSpace(p.source[p.pos]) {
+		p.pos++
+	}
+}
+
+// command converts the command after a backslash
+func (p *parser) command() string {
+	if p.pos >= len(p.source) {
+		return ""
+	}
+	start := p.pos
+	for p.pos < len(p.source) && unicode.IsLetter(p.source[p.pos]) && p.source[p.pos] < unicode.MaxASCII {
+		p.pos++
+	}
+	if p.pos == start {
+		// A command made of one other character, like \, or \\
+		p.pos++
+	}
+	name := string(p.source[start:p.pos])
+
+	switch name {
+	case `\`:
+		if p.matrices > 0 {
+			return "; "
+		}
+		return "\n"
+	case "frac", "dfrac", "tfrac", "cfrac":
+		return fraction(p.argument(), p.argument())
+	case "binom", "dbinom", "tbinom":
+		n, k := p.argument(), p.argument()
+		return "C(" + n + ", " + k + ")"
+	case "sqrt":
+		index := p.optionalArgument()
+		radicand := p.argument()
+		root := "√"
+		switch index {
+		case "":
+		case "3":
+			root = "∛"
+		case "4":
+			root = "∜"
+		default:
+			root = script(index, superscripts, "") + "√"
+		}
+		return root + parenthesize(radicand)
+	case "text", "textrm", "textit", "textbf", "mathrm", "mathit", "mathbf", "mathsf", "mathtt",
+		"mathcal", "mathscr", "mathfrak", "operatorname", "boldsymbol", "mbox", "emph":
+		return p.argument()
+	case "mathbb":
+		var out strings.Builder
+		for _, c := range p.argument() {
+			if letter, ok := doubleStruck[c]; ok {
+				out.WriteString(letter)
+			} else {
+				out.WriteRune(c)
+			}
+		}
+		return out.String()
+	case "left", "right":
+		// \left. and \right. open or close nothing
+		if p.pos < len(p.source) && p.source[p.pos] == '.' {
+			p.pos++
+		}
+		return ""
+	case "begin":
+		// Matrices are written in brackets with their rows separated by
+		// semicolons, and cases in braces
+		environment := p.rawArgument()
+		open, close := "[", "]"
+		switch {
+		case environment == "cases":
+			open, close = "{", "}"
+		case !strings.Contains(environment, "matrix"):
+			return ""
+		}
+		p.matrices++
+		contents := p.sequence(0)
+		p.matrices--
+		if p.atEnd() {
+			p.pos += len(`\end`)
+			p.rawArgument()
+		}
+		contents = strings.ReplaceAll(strings.Join(strings.Fields(contents), " "), " ;", ";")
+		return open + strings.TrimSuffix(contents, ";") + close
+	case "end":
+		p.rawArgument()
+		return ""
+	}
+	if mark, ok := accents[name]; ok {
+		var out strings.Builder
+		for _, c := range p.argument() {
+			out.WriteRune(c)
+			out.WriteRune(mark)
+		}
+		return out.String()
+	}
+	if symbol, ok := symbols[name]; ok {
+		return symbol
+	}
+	if functions[name] {
+		// Keep the function apart from a variable or symbol right after it
+		if p.pos < len(p.source) && (unicode.IsLetter(p.source[p.pos]) || p.source[p.pos] == '\\') {
+			return name + " "
+		}
+		return name
+	}
+	// Unknown commands keep their name, which usually says what they mean
+	return name
+}
+
+// fraction writes a fraction inline, parenthesizing a numerator or
+// denominator of more than one term
+func fraction(numerator string, denominator string) string {
+	numerator, denominator = strings.TrimSpace(numerator), strings.TrimSpace(denominator)
+	if vulgar, ok := vulgarFractions[numerator+"/"+denominator]; ok {
+		return vulgar
+	}
+	return parenthesize(numerator) + "/" + parenthesize(denominator)
+}
+
+// parenthesize puts parentheses around an expression of more than one term,
+// which is anything but a number or a character with its scripts and sign
+func parenthesize(expression string) string {
+	expression = strings.TrimSpace(expression)
+	term := strings.Map(func(r rune) rune {
+		if scriptForms[r] {
+			return -1
+		}
+		return r
+	}, strings.TrimPrefix(expression, "-"))
+	if len([]rune(term)) <= 1 || number.MatchString(term) {
+		return expression
+	}
+	return "(" + expression + ")"
+}
+
+// script writes text as superscript or subscript characters when they all
+// have one, or else after marker, parenthesized when it's longer than a
+// character
+func script(text string, forms map[rune]rune, marker string) string {
+	text = strings.TrimSpace(text)
+	var out strings.Builder
+	for _, c := range strings.ReplaceAll(text, " ", "") {
+		form, ok := forms[c]
+		if !ok {
+			if len([]rune(text)) == 1 {
+				return marker + text
+			}
+			return marker + "(" + text + ")"
+		}
+		out.WriteRune(form)
+	}
+	return out.String()
+}
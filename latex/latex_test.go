@@ -0,0 +1,45 @@
+package latex
+
+import "testing"
+
+func TestToUnicode(t *testing.T) {
+	for source, want := range map[string]string{
+		`\frac{a+b}{2}`:                     "(a+b)/2",
+		`\frac12 + \frac{3}{4}`:             "½ + ¾",
+		`x^2 + y_{i+1}`:                     "x² + yᵢ₊₁",
+		`e^{i \pi} = -1`:                    "e^(i π) = -1",
+		`x^{\alpha}`:                        "xᵅ",
+		`2^{f(x)}`:                          "2ᶠ⁽ˣ⁾",
+		`\sqrt{x+1} \geq \sqrt[3]{8}`:       "√(x+1) ≥ ∛8",
+		`\forall x \in \mathbb{R}`:          "∀ x ∈ ℝ",
+		`\sin\theta \cdot \sin(x)`:          "sin θ ⋅ sin(x)",
+		`\sum_{n=1}^{\infty} \frac{1}{n^2}`: "∑ₙ₌₁^∞ 1/n²",
+		`\binom{n}{k}`:                      "C(n, k)",
+		`\left( \frac{a}{b} \right)`:        "( a/b )",
+		`\vec{v}`:                           "v⃗",
+		`\text{if } x > 0`:                  "if x > 0",
+		`\begin{pmatrix} a & b \\ c & d \end{pmatrix}`:        "[a b; c d]",
+		`\begin{cases} x & x \ge 0 \\ -x & x < 0 \end{cases}`: "{x x ≥ 0; -x x < 0}",
+		`a &= b \\ &= c`: "a = b\n= c",
+	} {
+		if got := ToUnicode(source); got != want {
+			t.Errorf("ToUnicode(%q) = %q, want %q", source, got, want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	for text, want := range map[string]string{
+		"The roots are $x = \\frac{-b}{2a}$.":              "The roots are x = -b/(2a).",
+		"Let $n$ be even.":                                 "Let n be even.",
+		"Energy: \\(E = mc^2\\)":                           "Energy: E = mc²",
+		"So\n$$\\int_0^1 x\\,dx = \\frac12$$\ndone":        "So\n\n∫₀¹ x dx = ½\n\ndone",
+		"Then \\[a^2 + b^2 = c^2\\]":                       "Then \na² + b² = c²\n",
+		"It costs $5 and $10 later, or $20-$30.":           "It costs $5 and $10 later, or $20-$30.",
+		"Use `$x^2$` or\n```\n$$\\alpha$$\n```\nand $x^2$": "Use `$x^2$` or\n```\n$$\\alpha$$\n```\nand x²",
+	} {
+		if got := Convert(text); got != want {
+			t.Errorf("Convert(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
@@ -1,270 +1,499 @@
-package main
-
-import (
-	"bytes"
-	"context"
-	"encoding/base64"
-	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"os"
-	"os/signal"
-	"strings"
-	"syscall"
-	"time"
-
-	"github.com/bwmarrin/discordgo"
-	"github.com/google/generative-ai-go/genai"
-	"github.com/joho/godotenv"
-	"google.golang.org/api/option"
-)
-
-var (
-	geminiClient *genai.Client
-	chatSession  *genai.ChatSession
-	ctx          context.Context
-)
-
-func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	// Create Discord session
-	discord, err := discordgo.New("Bot " + os.Getenv("DISCORD_BOT_TOKEN"))
-	if err != nil {
-		log.Fatal("Error creating Discord session:", err)
-	}
-
-	// Set bot avatar
-	err = setBotAvatar(discord, "icon.png", "Go-Gemini-Bot")
-	if err != nil {
-		log.Println("Could not set bot avatar:", err)
-	}
-
-	// Create Gemini client
-	ctx = context.Background()
-	geminiClient, err = genai.NewClient(ctx, option.WithAPIKey(os.Getenv("GEMINI_API_KEY")))
-	if err != nil {
-		log.Fatal("Error creating Gemini client:", err)
-	}
-	defer geminiClient.Close()
-
-	// Create chat model
-	model := geminiClient.GenerativeModel("gemini-1.5-pro-latest")
-
-	// Set response safety settings
-	model.SafetySettings = []*genai.SafetySetting{
-		{
-			Category:  genai.HarmCategoryHarassment,
-			Threshold: genai.HarmBlockNone,
-		},
-		{
-			Category:  genai.HarmCategoryHateSpeech,
-			Threshold: genai.HarmBlockNone,
-		},
-		{
-			Category:  genai.HarmCategorySexuallyExplicit,
-			Threshold: genai.HarmBlockNone,
-		},
-	}
-	chatSession = model.StartChat()
-
-	// Add message handler
-	discord.AddHandler(messageHandler)
-
-	// Add slash command handler
-	discord.AddHandler(interactionHandler)
-
-	// Open Discord session
-	if err := discord.Open(); err != nil {
-		log.Fatal("Cannot open the session:", err)
-	}
-
-	// Create slash command
-	_, err = discord.ApplicationCommandCreate(discord.State.User.ID, "", &discordgo.ApplicationCommand{
-		Name:        "clear",
-		Description: "Clear the chat history with Gemini AI",
-	})
-	if err != nil {
-		log.Fatal("Cannot create slash command:", err)
-	}
-
-	// Wait here until CTRL-C or other term signal is received
-	fmt.Println("Bot is now running. Press CTRL-C to exit.")
-	sc := make(chan os.Signal, 1)
-	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-sc
-
-	// Cleanly close down the Discord session
-	discord.Close()
-}
-func messageHandler(s *discordgo.Session, m *discordgo.MessageCreate) {
-	// Ignore bot's own messages
-	if m.Author.ID == s.State.User.ID {
-		return
-	}
-
-	userMessage := m.Content
-	// Prepare parts for Gemini
-	var parts []genai.Part
-
-	// Check for attachments
-	if len(m.Attachments) > 0 {
-		for _, attachment := range m.Attachments {
-			// Determine file type using MIME types
-			isSupported := strings.HasPrefix(attachment.ContentType, "image/") ||
-				strings.HasPrefix(attachment.ContentType, "video/") ||
-				strings.HasPrefix(attachment.ContentType, "audio/") ||
-				strings.Contains(attachment.ContentType, "pdf") ||
-				strings.Contains(attachment.ContentType, "text/") ||
-				strings.Contains(attachment.ContentType, "application/")
-
-			if isSupported {
-				// Download the file
-				fileResp, err := http.Get(attachment.URL)
-				if err != nil {
-					log.Printf("Error downloading file: %v", err)
-					continue
-				}
-				defer fileResp.Body.Close()
-
-				// Read file bytes
-				fileBytes, err := io.ReadAll(fileResp.Body)
-				if err != nil {
-					log.Printf("Error reading file bytes: %v", err)
-					continue
-				}
-
-				// Use File API for all supported files
-				uploadOpts := genai.UploadFileOptions{DisplayName: attachment.Filename}
-
-				// Create a bytes.Reader from the file bytes
-				fileReader := bytes.NewReader(fileBytes)
-
-				uploadedFile, err := geminiClient.UploadFile(ctx, "", fileReader, &uploadOpts)
-				if err != nil {
-					log.Printf("Error uploading file: %v", err)
-					continue
-				}
-
-				// Wait for processing (simple polling)
-				for {
-					fileStatus, err := geminiClient.GetFile(ctx, uploadedFile.Name)
-					if err != nil {
-						log.Printf("Error checking file status: %v", err)
-						break
-					}
-					if fileStatus.State == genai.FileStateActive {
-						parts = append(parts, genai.FileData{URI: fileStatus.URI})
-						break
-					}
-					// Simple delay between checks
-					time.Sleep(5 * time.Second)
-				}
-			}
-		}
-	}
-
-	// Add text message to parts if not empty
-	if userMessage != "" {
-		parts = append(parts, genai.Text(userMessage))
-	}
-
-	// Ignore empty messages and no attachments
-	if len(parts) == 0 {
-		return
-	}
-
-	// Send typing indicator
-	s.ChannelTyping(m.ChannelID)
-
-	// Send message to Gemini
-	resp, err := chatSession.SendMessage(ctx, parts...)
-	if err != nil {
-		errorMsg := fmt.Sprintf("Sorry, an error occurred: %v", err)
-		s.ChannelMessageSend(m.ChannelID, errorMsg)
-		log.Println("Gemini error:", err)
-		return
-	}
-
-	// Extract and send response
-	var responseText string
-	for _, cand := range resp.Candidates {
-		if cand.Content != nil {
-			for _, part := range cand.Content.Parts {
-				responseText += fmt.Sprintf("%v", part)
-			}
-		}
-	}
-
-	// Send response
-	if responseText != "" {
-		// Split long messages if necessary
-		for len(responseText) > 0 {
-			// Determine message chunk size (Discord has a 2000 character limit)
-			chunkSize := 2000
-			if len(responseText) < chunkSize {
-				chunkSize = len(responseText)
-			}
-
-			// Send message chunk
-			chunk := responseText[:chunkSize]
-			s.ChannelMessageSend(m.ChannelID, chunk)
-
-			// Remove sent chunk
-			responseText = responseText[chunkSize:]
-		}
-	} else {
-		s.ChannelMessageSend(m.ChannelID, "I couldn't generate a response.")
-	}
-}
-
-func interactionHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	if i.Type == discordgo.InteractionApplicationCommand {
-		switch i.ApplicationCommandData().Name {
-		case "clear":
-			clearChatHistory(s, i)
-		}
-	}
-}
-
-func clearChatHistory(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	// Restart the chat session to effectively clear the history
-	model := geminiClient.GenerativeModel("gemini-1.5-pro-latest")
-	chatSession = model.StartChat()
-
-	// Respond to the slash command
-	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Content: "Chat history has been cleared!",
-		},
-	})
-	if err != nil {
-		log.Printf("Error responding to clear command: %v", err)
-	}
-}
-
-// Function to set bot avatar
-func setBotAvatar(s *discordgo.Session, avatarPath string, username string) error {
-	// Read the avatar file
-	avatarBytes, err := os.ReadFile(avatarPath)
-	if err != nil {
-		return fmt.Errorf("error reading avatar file: %v", err)
-	}
-
-	// Encode the avatar to base64
-	avatarBase64 := base64.StdEncoding.EncodeToString(avatarBytes)
-	avatarData := "data:image/png;base64," + avatarBase64
-
-	// Update the bot's avatar
-	_, err = s.UserUpdate(username, avatarData)
-	if err != nil {
-		return fmt.Errorf("error updating bot avatar: %v", err)
-	}
-
-	return nil
-}
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+
+	"go-discord-bot/ai"
+	"go-discord-bot/audit"
+	"go-discord-bot/bot"
+	"go-discord-bot/config"
+	"go-discord-bot/health"
+	"go-discord-bot/i18n"
+	"go-discord-bot/metrics"
+	"go-discord-bot/plugins"
+	"go-discord-bot/store"
+)
+
+// Limits on HTTP connections, so slow or idle clients can't hold them
+// open. Answers to /v1/ask may wait on the channel's queue and the model,
+// so responses get several minutes.
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpReadTimeout       = 30 * time.Second
+	httpWriteTimeout      = 5 * time.Minute
+	httpIdleTimeout       = 2 * time.Minute
+)
+
+func main() {
+	repl := flag.Bool("repl", false, "chat with the bot on stdin and stdout instead of connecting to Discord")
+	flag.Parse()
+
+	// Load configuration, which needs no Discord token for the REPL
+	load := config.Load
+	if *repl {
+		load = config.LoadLocal
+	}
+	cfg, err := load()
+	if err != nil {
+		fatal("Error loading configuration", err)
+	}
+
+	// Set up structured logging, at a level reloads can change
+	logLevel := &slog.LevelVar{}
+	logLevel.Set(parseLevel(cfg.LogLevel))
+	slog.SetDefault(newLogger(logLevel, cfg.LogJSON))
+
+	// Route Discord and AI provider connections through the proxy
+	proxy, err := useProxy(cfg.ProxyURL)
+	if err != nil {
+		fatal("Error configuring the proxy", err)
+	}
+
+	if *repl {
+		runREPL(cfg)
+		return
+	}
+
+	// Create Discord session
+	discord, err := discordgo.New("Bot " + cfg.DiscordToken)
+	if err != nil {
+		fatal("Error creating Discord session", err)
+	}
+
+	// Subscribe to the events the bot handles, and no others
+	discord.Identify.Intents = bot.Intents(cfg)
+
+	// Connect to the gateway through the proxy too
+	dialer := *discord.Dialer
+	dialer.Proxy = proxy
+	discord.Dialer = &dialer
+
+	// Count failed Discord API calls
+	discord.Client.Transport = metrics.Transport{Base: http.DefaultTransport}
+
+	// Split the gateway connection over the shards this process runs
+	shards, err := newShards(discord, cfg)
+	if err != nil {
+		fatal("Error setting up gateway shards", err)
+	}
+	bot.SetShardCount(discord.ShardCount)
+
+	// Set bot avatar
+	err = setBotAvatar(discord, "icon.png", "Go-Gemini-Bot")
+	if err != nil {
+		slog.Warn("Could not set bot avatar", "error", err)
+	}
+
+	// Background jobs stop on CTRL-C or other term signal, while requests
+	// being answered keep their own context until they have drained
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	requests, cancelRequests := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelRequests()
+
+	// Create the AI providers and open the database
+	gemini, openAI, providers, err := newProviders(requests, cfg)
+	if err != nil {
+		fatal("Error creating Gemini client", err)
+	}
+	defer gemini.Close()
+	st, err := store.Open(cfg.DatabasePath)
+	if err != nil {
+		fatal("Error opening database", err)
+	}
+	defer st.Close()
+	backend, err := store.OpenBackend(cfg.StoreDriver, cfg.StoreURL)
+	if err != nil {
+		fatal("Error opening store", err, "driver", cfg.StoreDriver)
+	}
+
+	// Create the bot and add its handlers
+	b := bot.New(requests, cfg, bot.NewDiscordSession(shards...), providers[cfg.DefaultProvider], st)
+	if backend != nil {
+		defer backend.Close()
+		b.SetBackend(backend)
+	}
+	b.SetPlugins(plugins.Registered())
+	for name, client := range providers {
+		b.AddProvider(name, client)
+	}
+	for _, s := range shards {
+		b.AddHandlers(s)
+	}
+
+	// Audit prompts and responses, if enabled
+	if cfg.Audit != "" {
+		sink := st.AuditSink()
+		if cfg.Audit == "file" {
+			file, err := audit.OpenFile(cfg.AuditFile)
+			if err != nil {
+				fatal("Error opening audit log", err)
+			}
+			defer file.Close()
+			sink = file
+		}
+		auditLog := audit.New(sink, audit.Options{
+			Anonymize: cfg.AuditAnonymize,
+			Salt:      cfg.AuditSalt,
+			Retention: time.Duration(cfg.AuditRetentionDays) * 24 * time.Hour,
+		})
+		b.SetAudit(auditLog)
+		go auditLog.Run(ctx)
+	}
+
+	// Reload the configuration on SIGHUP and with /admin reload
+	r := &reloader{ctx: requests, cfg: cfg, bot: b, gemini: gemini, openAI: openAI, logLevel: logLevel}
+	b.SetReload(r.reload)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := r.reload(); err != nil {
+				slog.Error("Error reloading configuration, keeping the current one", "error", err)
+			}
+		}
+	}()
+
+	// Run scheduled jobs such as channel digests
+	go b.RunScheduler(ctx)
+
+	// Track gateway connectivity for the health endpoints
+	checker := health.NewChecker(st, ai.LastSuccess)
+	checker.Shards = len(shards)
+	for _, s := range shards {
+		s.AddHandler(func(s *discordgo.Session, _ *discordgo.Connect) { checker.SetConnected(s.ShardID, true) })
+		s.AddHandler(func(s *discordgo.Session, _ *discordgo.Disconnect) { checker.SetConnected(s.ShardID, false) })
+	}
+
+	// Serve metrics, health checks and the API, if enabled
+	var server *http.Server
+	if cfg.HTTPAddr != "" {
+		server = serveHTTP(cfg.HTTPAddr, checker, b.APIHandler())
+	}
+
+	// Open a gateway connection per shard, waiting between them since
+	// Discord allows one identify every five seconds
+	for n, s := range shards {
+		if n > 0 {
+			time.Sleep(5 * time.Second)
+		}
+		if err := s.Open(); err != nil {
+			fatal("Cannot open the session", err)
+		}
+		slog.Info("Opened gateway shard", "shard", s.ShardID, "shards", s.ShardCount)
+	}
+
+	// Show the model and the configured statuses as the bot's presence
+	go b.RunPresence(ctx)
+
+	// Register slash and context-menu commands, the plugins' included,
+	// removing ones that are gone, with their names and descriptions in every
+	// translated language, and again whenever a gateway session is
+	// invalidated. Only the process running shard 0 does, when the bot spans
+	// several.
+	if shards[0].ShardID == 0 {
+		commands := slices.Concat(bot.Commands, plugins.Commands(plugins.Registered()))
+		i18n.LocalizeCommands(commands)
+		syncCommands := func() error {
+			return bot.SyncCommands(discord, discord.State.User.ID, cfg.DevGuildID, commands)
+		}
+		if err := syncCommands(); err != nil {
+			fatal("Cannot register commands", err)
+		}
+		b.SetCommandSync(syncCommands)
+	}
+
+	// Wait here until CTRL-C or other term signal is received, which stops
+	// the background jobs; a second one exits at once
+	fmt.Println("Bot is now running. Press CTRL-C to exit.")
+	<-ctx.Done()
+	stop()
+
+	// Stop taking API requests, and let those and the handlers in flight
+	// finish before disconnecting
+	slog.Info("Shutting down", "drain_timeout", cfg.DrainTimeout)
+	var stopped sync.WaitGroup
+	if server != nil {
+		stopped.Add(1)
+		go func() {
+			defer stopped.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+			defer cancel()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				slog.Warn("Drain timeout reached with API requests still in flight", "error", err)
+			}
+		}()
+	}
+	if !b.Shutdown(cfg.DrainTimeout) {
+		slog.Warn("Drain timeout reached with requests still in flight")
+	}
+	stopped.Wait()
+	cancelRequests()
+
+	// Cleanly close down the Discord sessions
+	for _, s := range shards {
+		s.Close()
+	}
+}
+
+// newProviders creates the Gemini client, on Vertex AI or mocked when selected,
+// and the OpenAI-compatible one when it is configured, and returns them by
+// provider name, bounding concurrent requests to each and cutting each off
+// during outages
+func newProviders(ctx context.Context, cfg *config.Config) (ai.Backend, *ai.OpenAI, map[string]ai.Client, error) {
+	opts := ai.Options{
+		APIKeys:        cfg.GeminiAPIKeys,
+		BaseURL:        cfg.GeminiBaseURL,
+		Model:          cfg.Model,
+		ImageEditModel: cfg.ImageEditModel,
+		TTSVoice:       cfg.TTSVoice,
+		ChatTools:      []*genai.Tool{bot.MemoryTool},
+	}
+	switch cfg.Backend {
+	case "vertex":
+		opts.VertexProject = cfg.VertexProject
+		opts.VertexLocation = cfg.VertexLocation
+	case "mock":
+		opts.Mock = true
+		opts.MockDelay = cfg.MockDelay
+		opts.MockFailEvery = cfg.MockFailEvery
+	}
+	gemini, err := ai.New(ctx, opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Cache static context documents, if any are configured
+	err = gemini.CacheContext(ctx, cfg.ContextFiles, cfg.ContextInstructions, cfg.ContextCacheModel)
+	if err != nil {
+		slog.Warn("Could not cache context documents", "error", err)
+	}
+
+	providers := map[string]ai.Client{bot.ProviderGemini: gemini}
+	var openAI *ai.OpenAI
+	if cfg.OpenAIBaseURL != "" {
+		openAI = ai.NewOpenAI(ai.OpenAIOptions{
+			BaseURL:        cfg.OpenAIBaseURL,
+			APIKey:         cfg.OpenAIAPIKey,
+			Model:          cfg.OpenAIModel,
+			EmbeddingModel: cfg.OpenAIEmbeddingModel,
+			ChatTools:      []*genai.Tool{bot.MemoryTool},
+		})
+		providers[bot.ProviderOpenAI] = openAI
+	}
+	for name, client := range providers {
+		limited := ai.NewLimited(client, cfg.MaxConcurrency, cfg.QueueDepth)
+		providers[name] = ai.NewBreaker(limited, name, cfg.BreakerThreshold, cfg.BreakerCooldown)
+	}
+	return gemini, openAI, providers, nil
+}
+
+// runREPL runs the bot against stdin and stdout, without Discord, so prompt
+// and tool changes can be tried locally
+func runREPL(cfg *config.Config) {
+	ctx := context.Background()
+	gemini, _, providers, err := newProviders(ctx, cfg)
+	if err != nil {
+		fatal("Error creating Gemini client", err)
+	}
+	defer gemini.Close()
+	st, err := store.Open(cfg.DatabasePath)
+	if err != nil {
+		fatal("Error opening database", err)
+	}
+	defer st.Close()
+	backend, err := store.OpenBackend(cfg.StoreDriver, cfg.StoreURL)
+	if err != nil {
+		fatal("Error opening store", err, "driver", cfg.StoreDriver)
+	}
+
+	b := bot.New(ctx, cfg, bot.NewREPLSession(os.Stdout), providers[cfg.DefaultProvider], st)
+	if backend != nil {
+		defer backend.Close()
+		b.SetBackend(backend)
+	}
+	b.SetPlugins(plugins.Registered())
+	for name, client := range providers {
+		b.AddProvider(name, client)
+	}
+	if err := b.RunREPL(os.Stdin, os.Stdout); err != nil {
+		fatal("Error reading input", err)
+	}
+}
+
+// newShards configures the session for the first shard this process runs
+// and creates sessions for the others. Without a shard count, the bot uses
+// as many shards as Discord recommends for its number of servers.
+func newShards(discord *discordgo.Session, cfg *config.Config) ([]*discordgo.Session, error) {
+	count := cfg.ShardCount
+	if count == 0 {
+		gateway, err := discord.GatewayBot()
+		if err != nil {
+			return nil, fmt.Errorf("error getting the recommended shard count: %v", err)
+		}
+		count = max(gateway.Shards, 1)
+	}
+
+	var shards []*discordgo.Session
+	for n, id := range bot.ShardIDs(cfg.ShardID, count) {
+		s := discord
+		if n > 0 {
+			var err error
+			if s, err = discordgo.New("Bot " + cfg.DiscordToken); err != nil {
+				return nil, fmt.Errorf("error creating session for shard %d: %v", id, err)
+			}
+			s.Identify.Intents = discord.Identify.Intents
+			s.Client = discord.Client
+			s.Dialer = discord.Dialer
+		}
+		s.ShardID, s.ShardCount = id, count
+		shards = append(shards, s)
+	}
+	return shards, nil
+}
+
+// useProxy makes HTTP requests that use the default transport, which the
+// Discord and AI clients all do, go through proxyURL, or through the proxy
+// the environment sets when it is empty, and returns the proxy function for
+// other connections to use
+func useProxy(proxyURL string) (func(*http.Request) (*url.URL, error), error) {
+	proxy := http.ProxyFromEnvironment
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		proxy = http.ProxyURL(u)
+		slog.Info("Using proxy", "host", u.Host)
+	}
+	http.DefaultTransport.(*http.Transport).Proxy = proxy
+	return proxy, nil
+}
+
+// newLogger creates the logger for the given level, writing JSON or text to stderr
+func newLogger(level slog.Leveler, json bool) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	if json {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts))
+}
+
+// parseLevel parses a log level name, falling back to info
+func parseLevel(name string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// reloader applies a reloaded configuration to the running bot. Settings
+// read at startup, such as the Discord token, keys and database, need a restart.
+type reloader struct {
+	ctx      context.Context
+	bot      *bot.Bot
+	gemini   ai.Backend
+	openAI   *ai.OpenAI
+	logLevel *slog.LevelVar
+
+	mu  sync.Mutex
+	cfg *config.Config
+}
+
+// reload loads the configuration again and applies it, leaving the current
+// one in place when the new one is invalid
+func (r *reloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	r.logLevel.Set(parseLevel(cfg.LogLevel))
+	r.gemini.SetModel(cfg.Model)
+	if r.openAI != nil {
+		r.openAI.SetModel(cfg.OpenAIModel)
+	}
+	if !slices.Equal(cfg.ContextFiles, r.cfg.ContextFiles) || cfg.ContextInstructions != r.cfg.ContextInstructions || cfg.ContextCacheModel != r.cfg.ContextCacheModel {
+		err := r.gemini.CacheContext(r.ctx, cfg.ContextFiles, cfg.ContextInstructions, cfg.ContextCacheModel)
+		if err != nil {
+			slog.Warn("Could not cache context documents", "error", err)
+		}
+	}
+	r.bot.SetConfig(cfg)
+	r.cfg = cfg
+
+	slog.Info("Reloaded configuration", "model", cfg.Model, "log_level", cfg.LogLevel)
+	return nil
+}
+
+// serveHTTP serves the metrics and health endpoints and the API on addr
+// until the returned server is shut down
+func serveHTTP(addr string, checker *health.Checker, api http.Handler) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/v1/", api)
+	checker.Register(mux)
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ReadTimeout:       httpReadTimeout,
+		WriteTimeout:      httpWriteTimeout,
+		IdleTimeout:       httpIdleTimeout,
+	}
+	go func() {
+		slog.Info("Serving HTTP", "addr", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Error serving HTTP", "error", err)
+		}
+	}()
+	return server
+}
+
+// fatal logs an error and exits
+func fatal(msg string, err error, args ...any) {
+	slog.Error(msg, append(args, "error", err)...)
+	os.Exit(1)
+}
+
+// Function to set bot avatar
+func setBotAvatar(s *discordgo.Session, avatarPath string, username string) error {
+	// Read the avatar file
+	avatarBytes, err := os.ReadFile(avatarPath)
+	if err != nil {
+		return fmt.Errorf("error reading avatar file: %v", err)
+	}
+
+	// Encode the avatar to base64
+	avatarBase64 := base64.StdEncoding.EncodeToString(avatarBytes)
+	avatarData := "data:image/png;base64," + avatarBase64
+
+	// Update the bot's avatar
+	_, err = s.UserUpdate(username, avatarData)
+	if err != nil {
+		return fmt.Errorf("error updating bot avatar: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+// Package metrics defines the bot's Prometheus metrics.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// MessagesHandled counts chat messages sent to the model
+	MessagesHandled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "discord_bot_messages_handled_total",
+		Help: "Chat messages sent to the model.",
+	})
+
+	// GeminiRequests counts Gemini requests by model and outcome ("ok" or "error")
+	GeminiRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "discord_bot_gemini_requests_total",
+		Help: "Gemini requests by model and outcome.",
+	}, []string{"model", "outcome"})
+
+	// GeminiLatency observes how long Gemini requests take, by model
+	GeminiLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "discord_bot_gemini_request_duration_seconds",
+		Help:    "Gemini request latency by model.",
+		Buckets: []float64{0.25, 0.5, 1, 2, 5, 10, 20, 40, 80},
+	}, []string{"model"})
+
+	// TokensUsed counts tokens consumed by model and kind ("prompt" or "response")
+	TokensUsed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "discord_bot_gemini_tokens_total",
+		Help: "Gemini tokens consumed by model and kind.",
+	}, []string{"model", "kind"})
+
+	// FileUploads counts files uploaded to the Gemini File API by outcome
+	FileUploads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "discord_bot_file_uploads_total",
+		Help: "Files uploaded to the Gemini File API by outcome.",
+	}, []string{"outcome"})
+
+	// RateLimitRejections counts requests refused by one of the bot's limits
+	RateLimitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "discord_bot_rate_limit_rejections_total",
+		Help: "Requests refused by a bot limit, by limit.",
+	}, []string{"limit"})
+
+	// CircuitBreakerState is the state of each provider's circuit breaker:
+	// 0 closed, 1 open, 2 half-open while a request probes for recovery
+	CircuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "discord_bot_circuit_breaker_state",
+		Help: "State of each AI provider's circuit breaker (0 closed, 1 open, 2 half-open).",
+	}, []string{"provider"})
+
+	// CircuitBreakerTrips counts how often each provider's circuit breaker opened
+	CircuitBreakerTrips = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "discord_bot_circuit_breaker_trips_total",
+		Help: "Times each AI provider's circuit breaker opened.",
+	}, []string{"provider"})
+
+	// DiscordErrors counts failed Discord API calls by HTTP status
+	DiscordErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "discord_bot_discord_api_errors_total",
+		Help: "Failed Discord API calls by HTTP status.",
+	}, []string{"status"})
+
+	// ResponseCacheLookups counts one-off prompts looked up in the response
+	// cache by result
+	ResponseCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "discord_bot_response_cache_lookups_total",
+		Help: "One-off prompts looked up in the response cache, by result (hit or miss).",
+	}, []string{"result"})
+
+	// ShardConnected is 1 while a gateway shard is connected
+	ShardConnected = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "discord_bot_shard_connected",
+		Help: "Whether each gateway shard is connected.",
+	}, []string{"shard"})
+
+	// ShardGuilds counts the guilds on each gateway shard
+	ShardGuilds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "discord_bot_shard_guilds",
+		Help: "Guilds on each gateway shard.",
+	}, []string{"shard"})
+
+	// ShardDisconnects counts gateway connections of each shard that dropped
+	ShardDisconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "discord_bot_shard_disconnects_total",
+		Help: "Gateway disconnects of each shard.",
+	}, []string{"shard"})
+
+	// ShardReconnects counts each shard's reconnections, by whether the
+	// gateway session was resumed or a new one identified after Discord
+	// invalidated it
+	ShardReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "discord_bot_shard_reconnects_total",
+		Help: "Gateway reconnections of each shard, by kind (resume or identify).",
+	}, []string{"shard", "kind"})
+
+	// ShardEvents counts gateway events received by each shard
+	ShardEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "discord_bot_shard_events_total",
+		Help: "Gateway events received by each shard.",
+	}, []string{"shard"})
+)
+
+// Outcome returns the outcome label for an error
+func Outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// Totals are the bot's counters summed over their labels since it started
+type Totals struct {
+	MessagesHandled int
+	GeminiRequests  int
+	GeminiErrors    int
+
+	// Mean latency of Gemini requests, zero before the first one
+	AverageLatency time.Duration
+}
+
+// Read sums the bot's metrics for reports such as /stats
+func Read() (Totals, error) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return Totals{}, err
+	}
+
+	var totals Totals
+	var latencySum float64
+	var latencyCount uint64
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			switch family.GetName() {
+			case "discord_bot_messages_handled_total":
+				totals.MessagesHandled += int(metric.GetCounter().GetValue())
+			case "discord_bot_gemini_requests_total":
+				value := int(metric.GetCounter().GetValue())
+				totals.GeminiRequests += value
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "outcome" && label.GetValue() == "error" {
+						totals.GeminiErrors += value
+					}
+				}
+			case "discord_bot_gemini_request_duration_seconds":
+				latencySum += metric.GetHistogram().GetSampleSum()
+				latencyCount += metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	if latencyCount > 0 {
+		totals.AverageLatency = time.Duration(latencySum / float64(latencyCount) * float64(time.Second))
+	}
+	return totals, nil
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Transport counts failed Discord API calls before handing responses back
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip sends a request with the base transport and counts error statuses
+func (t Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		DiscordErrors.WithLabelValues("network").Inc()
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		DiscordErrors.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+	}
+	return resp, nil
+}
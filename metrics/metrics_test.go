@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTransportCountsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: Transport{Base: http.DefaultTransport}}
+	before := testutil.ToFloat64(DiscordErrors.WithLabelValues("404"))
+	for _, path := range []string{"/ok", "/missing", "/missing"} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if got := testutil.ToFloat64(DiscordErrors.WithLabelValues("404")) - before; got != 2 {
+		t.Errorf("counted %v errors, want 2", got)
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	if got := Outcome(nil); got != "ok" {
+		t.Errorf("Outcome(nil) = %q, want ok", got)
+	}
+	if got := Outcome(errors.New("boom")); got != "error" {
+		t.Errorf("Outcome(err) = %q, want error", got)
+	}
+}
+
+func TestRead(t *testing.T) {
+	before, err := Read()
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	MessagesHandled.Inc()
+	GeminiRequests.WithLabelValues("test-model", "ok").Inc()
+	GeminiRequests.WithLabelValues("test-model", "error").Inc()
+	GeminiLatency.WithLabelValues("test-model").Observe(1)
+	GeminiLatency.WithLabelValues("other-model").Observe(3)
+
+	after, err := Read()
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if after.MessagesHandled-before.MessagesHandled != 1 || after.GeminiRequests-before.GeminiRequests != 2 ||
+		after.GeminiErrors-before.GeminiErrors != 1 {
+		t.Errorf("Read = %+v after %+v, want 1 message and 2 requests, 1 failed", after, before)
+	}
+	if before.GeminiRequests == 0 && after.AverageLatency != 2*time.Second {
+		t.Errorf("AverageLatency = %v, want 2s", after.AverageLatency)
+	}
+}
@@ -0,0 +1,49 @@
+//go:build dice
+
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// An example plugin adding /roll, built in with `go build -tags dice`
+func init() {
+	Register(dice{})
+}
+
+type dice struct{}
+
+func (dice) Name() string {
+	return "dice"
+}
+
+func (dice) Commands() []Command {
+	minSides := float64(2)
+	return []Command{{
+		ApplicationCommand: &discordgo.ApplicationCommand{
+			Name:        "roll",
+			Description: "Roll a die",
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "sides",
+				Description: "Number of sides, 6 by default",
+				MinValue:    &minSides,
+				MaxValue:    1000,
+			}},
+		},
+		Handle: roll,
+	}}
+}
+
+// roll answers /roll with a random side of the die
+func roll(_ context.Context, i *discordgo.InteractionCreate) (*discordgo.InteractionResponseData, error) {
+	sides := 6
+	if options := i.ApplicationCommandData().Options; len(options) > 0 {
+		sides = int(options[0].IntValue())
+	}
+	return &discordgo.InteractionResponseData{Content: fmt.Sprintf("🎲 %d (d%d)", rand.IntN(sides)+1, sides)}, nil
+}
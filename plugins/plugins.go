@@ -0,0 +1,104 @@
+// Package plugins lets communities extend the bot without forking it. A
+// plugin is a file of this package built in with a tag, which registers
+// itself from init:
+//
+//	//go:build rules
+//
+//	package plugins
+//
+//	func init() {
+//		Register(rules{})
+//	}
+//
+// The bot built with `go build -tags rules` then runs it. A plugin
+// implements Plugin and any of the hook interfaces: MessageHook to see or
+// filter messages, PromptHook and ResponseHook to change what is sent to and
+// received from the model, and CommandProvider to add slash commands.
+package plugins
+
+import (
+	"context"
+	"slices"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Plugin is an extension of the bot, named in its logs
+type Plugin interface {
+	Name() string
+}
+
+// MessageHook sees every message the bot receives, before it decides
+// whether to answer
+type MessageHook interface {
+	// OnMessage returns false to have the bot ignore the message
+	OnMessage(ctx context.Context, m *discordgo.Message) bool
+}
+
+// Prompt is a request about to be sent to the model on behalf of a user
+type Prompt struct {
+	UserID  string
+	GuildID string
+	Parts   []genai.Part
+}
+
+// PromptHook runs before each request to the model
+type PromptHook interface {
+	// BeforePrompt may change the prompt's parts, or return an error to
+	// refuse it, which the user is shown
+	BeforePrompt(ctx context.Context, p *Prompt) error
+}
+
+// Response is the text the model answered a user's prompt with
+type Response struct {
+	UserID  string
+	GuildID string
+	Text    string
+}
+
+// ResponseHook runs on each answer of the model before the bot uses it,
+// except the JSON ones it reads itself
+type ResponseHook interface {
+	// AfterResponse may change the answer's text
+	AfterResponse(ctx context.Context, r *Response)
+}
+
+// Command is a slash command a plugin adds, answered with the message
+// Handle returns
+type Command struct {
+	*discordgo.ApplicationCommand
+	Handle func(ctx context.Context, i *discordgo.InteractionCreate) (*discordgo.InteractionResponseData, error)
+}
+
+// CommandProvider adds slash commands, registered along with the bot's own
+type CommandProvider interface {
+	Commands() []Command
+}
+
+// Plugins built in, in the order they registered
+var registered []Plugin
+
+// Register adds a plugin to the ones the bot runs. It is called from init.
+func Register(p Plugin) {
+	registered = append(registered, p)
+}
+
+// Registered returns the plugins built in, in the order they registered,
+// which is their files' order
+func Registered() []Plugin {
+	return slices.Clone(registered)
+}
+
+// Commands returns the definitions of the commands plugins add
+func Commands(list []Plugin) []*discordgo.ApplicationCommand {
+	var commands []*discordgo.ApplicationCommand
+	for _, p := range list {
+		if provider, ok := p.(CommandProvider); ok {
+			for _, command := range provider.Commands() {
+				commands = append(commands, command.ApplicationCommand)
+			}
+		}
+	}
+	return commands
+}
@@ -0,0 +1,30 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type commandPlugin struct{}
+
+func (commandPlugin) Name() string {
+	return "commands"
+}
+
+func (commandPlugin) Commands() []Command {
+	return []Command{{ApplicationCommand: &discordgo.ApplicationCommand{Name: "ping"}}}
+}
+
+type hookPlugin struct{}
+
+func (hookPlugin) Name() string {
+	return "hooks"
+}
+
+func TestCommands(t *testing.T) {
+	commands := Commands([]Plugin{hookPlugin{}, commandPlugin{}})
+	if len(commands) != 1 || commands[0].Name != "ping" {
+		t.Errorf("Commands = %v, want the command plugin's", commands)
+	}
+}
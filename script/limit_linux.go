@@ -0,0 +1,38 @@
+package script
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// limitMemory makes allocations fail once the process has twice limit more
+// bytes of data than it started with, leaving the garbage collector room, so
+// a value too large for the sandbox crashes it at once instead of being built
+func limitMemory(limit uint64) {
+	data, ok := dataBytes()
+	if !ok {
+		return
+	}
+	max := data + 2*limit
+	syscall.Setrlimit(syscall.RLIMIT_DATA, &syscall.Rlimit{Cur: max, Max: max})
+}
+
+// dataBytes returns the size of the process's data, which RLIMIT_DATA limits
+func dataBytes() (uint64, bool) {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "VmData:"); ok {
+			kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+			return kb << 10, err == nil
+		}
+	}
+	return 0, false
+}
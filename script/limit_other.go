@@ -0,0 +1,7 @@
+//go:build !linux
+
+package script
+
+// limitMemory does nothing where the data size can't be limited, leaving the
+// sandbox's heap to watch
+func limitMemory(limit uint64) {}
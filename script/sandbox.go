@@ -0,0 +1,151 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Scripts run in a child process, the bot's own executable started again
+// with sandboxEnv set, so the memory they use can be limited by the system
+// and measured apart from the bot's
+const sandboxEnv = "GO_DISCORD_BOT_SCRIPT_SANDBOX"
+
+// How much longer than a run may take the child process is given to start
+// and answer, before it's killed
+const sandboxStartTime = 5 * time.Second
+
+// What the child process is asked to do
+const (
+	opCompile = "compile"
+	opCompute = "compute"
+)
+
+// request is what the bot sends a child process: a script or program, and
+// what to run it on
+type request struct {
+	Op     string   `json:"op"`
+	Source string   `json:"source"`
+	Texts  []string `json:"texts,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+// response is what a child process answers, or the error it ran into
+type response struct {
+	Error         string   `json:"error,omitempty"`
+	BeforePrompt  bool     `json:"before_prompt,omitempty"`
+	AfterResponse bool     `json:"after_response,omitempty"`
+	Texts         []string `json:"texts,omitempty"`
+	Text          string   `json:"text,omitempty"`
+	Output        string   `json:"output,omitempty"`
+}
+
+// A process started as a sandbox serves one request and exits before the
+// rest of the program starts
+func init() {
+	if os.Getenv(sandboxEnv) == "" {
+		return
+	}
+	limitMemory(maxMemory)
+	if err := json.NewEncoder(os.Stdout).Encode(serve(os.Stdin)); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// serve runs the request read from r in this process
+func serve(r *os.File) response {
+	var req request
+	if err := json.NewDecoder(r).Decode(&req); err != nil {
+		return response{Error: fmt.Sprintf("error reading the request: %v", err)}
+	}
+
+	var resp response
+	var err error
+	switch req.Op {
+	case opCompile:
+		var p *program
+		if p, err = compile(req.Source); err == nil {
+			resp.BeforePrompt, resp.AfterResponse = p.beforePrompt != nil, p.afterResponse != nil
+		}
+	case beforePromptName:
+		var p *program
+		if p, err = compile(req.Source); err == nil {
+			resp.Texts, err = p.runBeforePrompt(req.Texts)
+			resp.Output = strings.TrimSpace(p.output.String())
+		}
+	case afterResponseName:
+		var p *program
+		if p, err = compile(req.Source); err == nil {
+			resp.Text, err = p.runAfterResponse(req.Text)
+			resp.Output = strings.TrimSpace(p.output.String())
+		}
+	case opCompute:
+		var c Computation
+		c, err = compute(req.Source)
+		resp.Text, resp.Output = c.Result, c.Output
+	default:
+		err = fmt.Errorf("unknown request %q", req.Op)
+	}
+	if err != nil {
+		return response{Error: err.Error()}
+	}
+	return resp
+}
+
+// sandbox runs a request in a child process. A process killed by the memory
+// limit is reported as running out of memory.
+func sandbox(req request) (response, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return response{}, fmt.Errorf("error finding the sandbox: %v", err)
+	}
+	input, err := json.Marshal(req)
+	if err != nil {
+		return response{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), maxRunTime+sandboxStartTime)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, executable)
+	// A build with the race detector would otherwise wait a second on exit
+	cmd.Env = []string{sandboxEnv + "=1", "GORACE=atexit_sleep_ms=0"}
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err = cmd.Run()
+	switch {
+	case ctx.Err() != nil:
+		return response{}, fmt.Errorf("ran for over %v", maxRunTime)
+	case err != nil && outOfMemory(stderr.String()):
+		return response{}, fmt.Errorf("used over %d MB of memory", maxMemory>>20)
+	case err != nil:
+		return response{}, fmt.Errorf("the sandbox failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var resp response
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return response{}, fmt.Errorf("error reading the sandbox's answer: %v", err)
+	}
+	if resp.Error != "" {
+		return response{}, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+// outOfMemory reports whether a child process crashed because an allocation
+// failed, as the runtime or the race detector writes it
+func outOfMemory(stderr string) bool {
+	for _, message := range []string{"out of memory", "cannot allocate memory", "failed to allocate"} {
+		if strings.Contains(stderr, message) {
+			return true
+		}
+	}
+	return false
+}
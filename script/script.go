@@ -0,0 +1,329 @@
+// Package script runs the Starlark scripts server admins upload to shape
+// what is sent to the model and what it answers. Scripts run sandboxed, in a
+// child process of their own: they can't load modules or reach files or the
+// network, and are stopped past a number of steps, a time limit or a memory
+// limit.
+//
+// A script defines either function or both:
+//
+//	def before_prompt(parts):
+//	    # parts is the list of the prompt's texts, return the new list
+//	    return ["Server rules: be kind."] + parts
+//
+//	def after_response(text):
+//	    # return the answer's new text
+//	    return text.replace("Gemini", "our bot")
+//
+// The same sandbox runs the programs /math has the model write to compute
+// answers instead of doing arithmetic itself, see Compute.
+package script
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/metrics"
+	"strings"
+	"time"
+
+	"go.starlark.net/lib/math"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+const (
+	// Largest script accepted, in bytes
+	MaxSourceBytes = 16 << 10
+
+	// Steps, time and memory after which a script's run is stopped
+	maxSteps   = 1_000_000
+	maxRunTime = time.Second
+	maxMemory  = 64 << 20
+
+	// How often the heap is checked while a script runs
+	heapCheckInterval = 5 * time.Millisecond
+
+	// Longest text a script may return, in bytes
+	maxResultBytes = 200_000
+)
+
+// Names of the functions a script defines, and of the global a computation
+// leaves its result in
+const (
+	beforePromptName  = "before_prompt"
+	afterResponseName = "after_response"
+	resultName        = "result"
+)
+
+// Script is a script that compiled, run anew in the sandbox each time so
+// runs don't share state and a script can run several times at once
+type Script struct {
+	source        string
+	beforePrompt  bool
+	afterResponse bool
+}
+
+// Compile loads a script, running its top level in the sandbox, and checks
+// it defines before_prompt or after_response taking one argument
+func Compile(source string) (*Script, error) {
+	if len(source) > MaxSourceBytes {
+		return nil, fmt.Errorf("the script is longer than %d KB", MaxSourceBytes>>10)
+	}
+	resp, err := sandbox(request{Op: opCompile, Source: source})
+	if err != nil {
+		return nil, err
+	}
+	return &Script{source: source, beforePrompt: resp.BeforePrompt, afterResponse: resp.AfterResponse}, nil
+}
+
+// BeforePrompt runs before_prompt on the texts of a prompt, returning the
+// texts it returns, or the texts unchanged when the script doesn't define it
+func (s *Script) BeforePrompt(texts []string) ([]string, error) {
+	if !s.beforePrompt {
+		return texts, nil
+	}
+	resp, err := sandbox(request{Op: beforePromptName, Source: s.source, Texts: texts})
+	if err != nil {
+		return nil, err
+	}
+	logOutput(resp.Output)
+	return resp.Texts, nil
+}
+
+// AfterResponse runs after_response on the text of an answer, returning the
+// text it returns, or the text unchanged when the script doesn't define it
+func (s *Script) AfterResponse(text string) (string, error) {
+	if !s.afterResponse {
+		return text, nil
+	}
+	resp, err := sandbox(request{Op: afterResponseName, Source: s.source, Text: text})
+	if err != nil {
+		return "", err
+	}
+	logOutput(resp.Output)
+	return resp.Text, nil
+}
+
+// Computation is what a program run by Compute found
+type Computation struct {
+	// The value the program assigned to result, as Starlark writes it
+	Result string
+
+	// What the program printed, one line per print
+	Output string
+}
+
+// Compute runs a program computing a result in the sandbox, with the math
+// module (math.sqrt, math.pi, math.log…) predeclared. Unlike scripts it may
+// use loops, recursion and control flow at the top level, and must assign
+// the answer to result.
+func Compute(source string) (Computation, error) {
+	if len(source) > MaxSourceBytes {
+		return Computation{}, fmt.Errorf("the program is longer than %d KB", MaxSourceBytes>>10)
+	}
+	resp, err := sandbox(request{Op: opCompute, Source: source})
+	if err != nil {
+		return Computation{}, err
+	}
+	return Computation{Result: resp.Text, Output: resp.Output}, nil
+}
+
+// logOutput logs what a script printed
+func logOutput(output string) {
+	if output != "" {
+		slog.Debug("Script printed", "output", output)
+	}
+}
+
+// program is a script loaded in the sandbox. Its globals are frozen once
+// it's loaded.
+type program struct {
+	beforePrompt  *starlark.Function
+	afterResponse *starlark.Function
+	output        strings.Builder
+}
+
+// compile loads a script in this process, running its top level
+func compile(source string) (*program, error) {
+	p := &program{}
+	var globals starlark.StringDict
+	err := run(&p.output, func(thread *starlark.Thread) error {
+		var err error
+		globals, err = starlark.ExecFileOptions(&syntax.FileOptions{}, thread, "script.star", source, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	globals.Freeze()
+
+	for name, fn := range map[string]**starlark.Function{beforePromptName: &p.beforePrompt, afterResponseName: &p.afterResponse} {
+		value, ok := globals[name]
+		if !ok {
+			continue
+		}
+		function, ok := value.(*starlark.Function)
+		if !ok || function.NumParams() != 1 {
+			return nil, fmt.Errorf("%s must be a function taking one argument", name)
+		}
+		*fn = function
+	}
+	if p.beforePrompt == nil && p.afterResponse == nil {
+		return nil, fmt.Errorf("the script must define %s(parts) or %s(text)", beforePromptName, afterResponseName)
+	}
+	return p, nil
+}
+
+// runBeforePrompt runs before_prompt in this process
+func (p *program) runBeforePrompt(texts []string) ([]string, error) {
+	if p.beforePrompt == nil {
+		return texts, nil
+	}
+	parts := make([]starlark.Value, len(texts))
+	for n, text := range texts {
+		parts[n] = starlark.String(text)
+	}
+	result, err := p.call(p.beforePrompt, starlark.NewList(parts))
+	if err != nil {
+		return nil, err
+	}
+
+	// A single text is taken as the whole prompt
+	if text, ok := result.(starlark.String); ok {
+		return []string{string(text)}, checkSize(len(text))
+	}
+	list, ok := result.(*starlark.List)
+	if !ok {
+		return nil, fmt.Errorf("%s must return a list of strings, not %s", beforePromptName, result.Type())
+	}
+	texts = make([]string, list.Len())
+	size := 0
+	for n := range texts {
+		text, ok := list.Index(n).(starlark.String)
+		if !ok {
+			return nil, fmt.Errorf("%s must return a list of strings, not a list with %s", beforePromptName, list.Index(n).Type())
+		}
+		texts[n] = string(text)
+		size += len(text)
+	}
+	return texts, checkSize(size)
+}
+
+// runAfterResponse runs after_response in this process
+func (p *program) runAfterResponse(text string) (string, error) {
+	if p.afterResponse == nil {
+		return text, nil
+	}
+	result, err := p.call(p.afterResponse, starlark.String(text))
+	if err != nil {
+		return "", err
+	}
+	answer, ok := result.(starlark.String)
+	if !ok {
+		return "", fmt.Errorf("%s must return a string, not %s", afterResponseName, result.Type())
+	}
+	return string(answer), checkSize(len(answer))
+}
+
+// call runs one of a script's functions
+func (p *program) call(fn *starlark.Function, arg starlark.Value) (starlark.Value, error) {
+	var result starlark.Value
+	err := run(&p.output, func(thread *starlark.Thread) error {
+		var err error
+		result, err = starlark.Call(thread, fn, starlark.Tuple{arg}, nil)
+		return err
+	})
+	return result, err
+}
+
+// compute runs a program for Compute in this process
+func compute(source string) (Computation, error) {
+	var output strings.Builder
+	var globals starlark.StringDict
+	err := run(&output, func(thread *starlark.Thread) error {
+		options := &syntax.FileOptions{Set: true, While: true, TopLevelControl: true, GlobalReassign: true, Recursion: true}
+		var err error
+		globals, err = starlark.ExecFileOptions(options, thread, "program.star", source, starlark.StringDict{"math": math.Module})
+		return err
+	})
+	if err != nil {
+		return Computation{}, err
+	}
+	result, ok := globals[resultName]
+	if !ok {
+		return Computation{}, fmt.Errorf("the program didn't assign its answer to %s", resultName)
+	}
+	text := result.String()
+	if s, ok := result.(starlark.String); ok {
+		text = string(s)
+	}
+	return Computation{Result: text, Output: strings.TrimSpace(output.String())}, checkSize(len(text))
+}
+
+// checkSize refuses results too long to send on
+func checkSize(size int) error {
+	if size > maxResultBytes {
+		return fmt.Errorf("the script returned more than %d KB of text", maxResultBytes>>10)
+	}
+	return nil
+}
+
+// run runs Starlark code on a thread that's cancelled once it takes too
+// many steps, too long or grows the heap too much, writing what it prints
+// to output
+func run(output *strings.Builder, code func(thread *starlark.Thread) error) error {
+	thread := &starlark.Thread{
+		Name: "script",
+		Print: func(_ *starlark.Thread, msg string) {
+			if output.Len() < maxResultBytes {
+				output.WriteString(msg + "\n")
+			}
+		},
+		Load: func(*starlark.Thread, string) (starlark.StringDict, error) {
+			return nil, errors.New("scripts can't load modules")
+		},
+	}
+	thread.SetMaxExecutionSteps(maxSteps)
+
+	done := make(chan struct{})
+	defer close(done)
+	go watch(thread, done)
+
+	return code(thread)
+}
+
+// watch cancels a thread when it runs past the time limit or the heap grows
+// past the memory limit, until done is closed. The sandbox's process runs
+// nothing else, so its heap is the script's. A value too large to allocate
+// at all is stopped by limitMemory instead, where the system can.
+func watch(thread *starlark.Thread, done <-chan struct{}) {
+	start := heapBytes()
+	timeout := time.NewTimer(maxRunTime)
+	defer timeout.Stop()
+	ticker := time.NewTicker(heapCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-timeout.C:
+			thread.Cancel(fmt.Sprintf("ran for over %v", maxRunTime))
+			return
+		case <-ticker.C:
+			if heapBytes() > start+maxMemory {
+				thread.Cancel(fmt.Sprintf("used over %d MB of memory", maxMemory>>20))
+				return
+			}
+		}
+	}
+}
+
+// heapBytes returns the size of the objects on the heap
+func heapBytes() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
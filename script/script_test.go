@@ -0,0 +1,137 @@
+package script
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	s, err := Compile(`
+def before_prompt(parts):
+    return ["Server rules: be kind."] + [p for p in parts if not p.startswith("!")]
+
+def after_response(text):
+    return text.replace("Gemini", "our bot")
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts, err := s.BeforePrompt([]string{"!ping", "Hi"})
+	if want := []string{"Server rules: be kind.", "Hi"}; err != nil || !slices.Equal(texts, want) {
+		t.Errorf("BeforePrompt = %q, %v, want %q", texts, err, want)
+	}
+	if text, err := s.AfterResponse("I'm Gemini."); err != nil || text != "I'm our bot." {
+		t.Errorf("AfterResponse = %q, %v", text, err)
+	}
+
+	// A script may define a single hook, and before_prompt return a string
+	s, err = Compile(`def before_prompt(parts): return " ".join(parts).upper()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if texts, err := s.BeforePrompt([]string{"a", "b"}); err != nil || !slices.Equal(texts, []string{"A B"}) {
+		t.Errorf("BeforePrompt = %q, %v, want one text", texts, err)
+	}
+	if text, err := s.AfterResponse("unchanged"); err != nil || text != "unchanged" {
+		t.Errorf("AfterResponse = %q, %v, want the text unchanged", text, err)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`x = 1`, "must define before_prompt(parts) or after_response(text)"},
+		{`def after_response(): return ""`, "after_response must be a function taking one argument"},
+		{`load("os", "system")`, "scripts can't load modules"},
+		{`def after_response(text):
+    n = 0
+    for i in range(100000000):
+        n += i
+    return text`, "too many steps"},
+		{`def after_response(text):
+    texts = []
+    for i in range(100000):
+        texts.append(text * 10000)
+    return text`, "used over"},
+		{`def after_response(text):
+    return text + str(len(["a"] * 200000000))`, "used over"},
+		{`def after_response(text): return 1`, "after_response must return a string, not int"},
+		{strings.Repeat("#", MaxSourceBytes+1), "longer than"},
+	}
+	for _, test := range tests {
+		s, err := Compile(test.source)
+		if err == nil {
+			_, err = s.AfterResponse("text")
+		}
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("running %q = %v, want an error containing %q", test.source, err, test.want)
+		}
+	}
+}
+
+func TestSandboxMemory(t *testing.T) {
+	s, err := Compile(`
+def after_response(text):
+    n = 0
+    for i in range(50000):
+        n += i
+    return text + str(n)
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Memory the bot allocates while a script runs isn't counted against it
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		var ballast [][]byte
+		for len(ballast) < 4*maxMemory>>20 {
+			select {
+			case <-done:
+				return
+			default:
+				ballast = append(ballast, make([]byte, 1<<20))
+			}
+		}
+		<-done
+	}()
+	if text, err := s.AfterResponse("n = "); err != nil || text != "n = 1249975000" {
+		t.Errorf("AfterResponse = %q, %v, want the sum", text, err)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	c, err := Compute(`
+def factorial(n):
+    return 1 if n < 2 else n * factorial(n - 1)
+
+total = 0
+for k in range(1, 101):
+    total += k
+print("sum", total)
+result = factorial(25) + total + int(math.sqrt(16))
+`)
+	if err != nil || c.Result != "15511210043330985984005054" || c.Output != "sum 5050" {
+		t.Errorf("Compute = %+v, %v, want exact integers and the printed lines", c, err)
+	}
+	if c, err := Compute(`result = "x = %d" % (2 * 3)`); err != nil || c.Result != "x = 6" {
+		t.Errorf("Compute = %+v, %v, want a string result as it is", c, err)
+	}
+
+	for source, want := range map[string]string{
+		`x = 1`:                         "didn't assign its answer to result",
+		`result = 1 / 0`:                "division by zero",
+		`load("os", "system")`:          "can't load modules",
+		"while True:\n    pass":         "too many steps",
+		`result = math.nosuchthing`:     "no .nosuchthing field",
+		`result = len("a" * 500000000)`: "used over",
+	} {
+		if _, err := Compute(source); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Compute(%q) = %v, want an error containing %q", source, err, want)
+		}
+	}
+}
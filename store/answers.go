@@ -0,0 +1,70 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Answer maps a message the bot answered to the messages of its reply
+type Answer struct {
+	PromptID  string
+	ChannelID string
+	ReplyIDs  []string
+	CreatedAt time.Time
+	// When the prompt was last edited before being answered, zero if never
+	EditedAt time.Time
+}
+
+// SaveAnswer records the reply messages sent for a prompt message, replacing
+// any earlier reply to it
+func (s *Store) SaveAnswer(answer Answer) error {
+	var edited int64
+	if !answer.EditedAt.IsZero() {
+		edited = answer.EditedAt.UnixMilli()
+	}
+	_, err := s.db.Exec(`INSERT INTO answers (prompt_id, channel_id, reply_ids, created_at, edited_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (prompt_id) DO UPDATE SET channel_id = excluded.channel_id, reply_ids = excluded.reply_ids, edited_at = excluded.edited_at`,
+		answer.PromptID, answer.ChannelID, strings.Join(answer.ReplyIDs, ","), answer.CreatedAt.UnixMilli(), edited)
+	return err
+}
+
+// Answer returns the reply recorded for a prompt message, or nil when there
+// is none
+func (s *Store) Answer(promptID string) (*Answer, error) {
+	answer := Answer{PromptID: promptID}
+	var replyIDs string
+	var created, edited int64
+	err := s.db.QueryRow(`SELECT channel_id, reply_ids, created_at, edited_at FROM answers WHERE prompt_id = ?`, promptID).
+		Scan(&answer.ChannelID, &replyIDs, &created, &edited)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	answer.ReplyIDs = strings.Split(replyIDs, ",")
+	answer.CreatedAt = time.UnixMilli(created)
+	if edited != 0 {
+		answer.EditedAt = time.UnixMilli(edited)
+	}
+	return &answer, nil
+}
+
+// DeleteAnswer forgets the reply to a prompt message
+func (s *Store) DeleteAnswer(promptID string) error {
+	_, err := s.db.Exec(`DELETE FROM answers WHERE prompt_id = ?`, promptID)
+	return err
+}
+
+// DeleteAnswersBefore forgets the replies to prompts answered before a time
+// and returns how many were deleted
+func (s *Store) DeleteAnswersBefore(before time.Time) (int, error) {
+	result, err := s.db.Exec(`DELETE FROM answers WHERE created_at < ?`, before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"go-discord-bot/audit"
+)
+
+// auditSink writes audit entries to the audit_log table
+type auditSink struct {
+	db *sql.DB
+}
+
+// AuditSink returns an audit sink storing entries in the database
+func (s *Store) AuditSink() audit.Sink {
+	return auditSink{db: s.db}
+}
+
+// Write stores an audit entry
+func (a auditSink) Write(e audit.Entry) error {
+	_, err := a.db.Exec(`INSERT INTO audit_log (time, user_id, guild_id, model, prompt, response, finish_reason, safety_flags, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Time.UnixMilli(), e.UserID, e.GuildID, e.Model, e.Prompt, e.Response, e.FinishReason, strings.Join(e.SafetyFlags, ","), e.Error)
+	return err
+}
+
+// Prune deletes audit entries older than before
+func (a auditSink) Prune(before time.Time) (int, error) {
+	result, err := a.db.Exec(`DELETE FROM audit_log WHERE time < ?`, before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+// UserEntries returns the audit entries of a user, oldest first
+func (a auditSink) UserEntries(userID string) ([]audit.Entry, error) {
+	return queryAuditEntries(a.db, `WHERE user_id = ?`, userID)
+}
+
+// Forget deletes the audit entries of a user
+func (a auditSink) Forget(userID string) (int, error) {
+	result, err := a.db.Exec(`DELETE FROM audit_log WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+// AuditEntries returns the audit entries recorded since a time, oldest first
+func (s *Store) AuditEntries(since time.Time) ([]audit.Entry, error) {
+	return queryAuditEntries(s.db, `WHERE time >= ?`, since.UnixMilli())
+}
+
+// queryAuditEntries returns the audit entries matching a WHERE clause,
+// oldest first
+func queryAuditEntries(db *sql.DB, where string, args ...any) ([]audit.Entry, error) {
+	rows, err := db.Query(`SELECT time, user_id, guild_id, model, prompt, response, finish_reason, safety_flags, error
+		FROM audit_log `+where+` ORDER BY time, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []audit.Entry
+	for rows.Next() {
+		var e audit.Entry
+		var millis int64
+		var flags string
+		err := rows.Scan(&millis, &e.UserID, &e.GuildID, &e.Model, &e.Prompt, &e.Response, &e.FinishReason, &flags, &e.Error)
+		if err != nil {
+			return nil, err
+		}
+		e.Time = time.UnixMilli(millis)
+		if flags != "" {
+			e.SafetyFlags = strings.Split(flags, ",")
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Backend keeps the state several instances of the bot need to share: chat
+// sessions, guild settings, memories and usage. The SQLite database is the
+// default one; Postgres and Redis let instances on different hosts share it.
+type Backend interface {
+	// Session returns the history saved under a conversation's key, or nil
+	// when there's none or it expired
+	Session(key string) ([]byte, error)
+	// SaveSession saves a conversation's history, expiring after ttl unless
+	// it's 0
+	SaveSession(key string, history []byte, ttl time.Duration) error
+	DeleteSession(key string) error
+
+	GuildSettings(guildID string) (*GuildSettings, error)
+	SetGuildSettings(g GuildSettings) error
+	DeleteGuildSettings(guildID string) error
+
+	Memories(userID string) ([]Memory, error)
+	AddMemory(userID string, fact string, limit int) error
+	DeleteMemory(userID string, id int64) (bool, error)
+	DeleteMemories(userID string) error
+
+	RecordUsage(userID string, guildID string, at time.Time, promptTokens int, responseTokens int) error
+	UserUsage(userID string, since time.Time) (Usage, error)
+	GuildUsage(guildID string, since time.Time) (Usage, error)
+	TotalUsage(since time.Time) (Usage, error)
+	// UsageDays returns a user's usage by day and guild, oldest first
+	UsageDays(userID string) ([]UsageDay, error)
+
+	// AnonymizeUser deletes a user's memories and moves their usage to an
+	// anonymous user, as ForgetUser does
+	AnonymizeUser(userID string) error
+
+	Ping() error
+	Close() error
+}
+
+// Locker is a Backend that can lock a conversation, so a single one of the
+// instances sharing it answers there at a time
+type Locker interface {
+	// LockSession takes the lock of a conversation for up to ttl, returning
+	// a token to release it with, or "" while another instance holds it
+	LockSession(key string, ttl time.Duration) (string, error)
+	// RefreshSession holds the lock of a conversation for ttl more,
+	// reporting whether it was still held with token
+	RefreshSession(key string, token string, ttl time.Duration) (bool, error)
+	// UnlockSession releases the lock of a conversation, unless it expired
+	// and was taken again
+	UnlockSession(key string, token string) error
+}
+
+// Store must implement Backend
+var _ Backend = (*Store)(nil)
+
+// Drivers STORE_DRIVER selects the backend with
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+	DriverRedis    = "redis"
+)
+
+// OpenBackend connects to the backend of a driver at url. It returns nil for
+// SQLite, whose state stays in the database Open opened.
+func OpenBackend(driver string, url string) (Backend, error) {
+	switch driver {
+	case "", DriverSQLite:
+		return nil, nil
+	case DriverPostgres:
+		return OpenPostgres(url)
+	case DriverRedis:
+		return OpenRedis(url)
+	}
+	return nil, fmt.Errorf("unknown store driver %q", driver)
+}
+
+// Session returns the history saved under a conversation's key, or nil when
+// there's none or it expired
+func (s *Store) Session(key string) ([]byte, error) {
+	var history []byte
+	err := s.db.QueryRow(`SELECT history FROM sessions WHERE key = ? AND (expires_at = 0 OR expires_at > ?)`, key, time.Now().UnixMilli()).
+		Scan(&history)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return history, err
+}
+
+// SaveSession saves a conversation's history, expiring after ttl unless it's 0.
+// Expired sessions are deleted as others are saved.
+func (s *Store) SaveSession(key string, history []byte, ttl time.Duration) error {
+	now := time.Now()
+	var expires int64
+	if ttl > 0 {
+		expires = now.Add(ttl).UnixMilli()
+	}
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE expires_at != 0 AND expires_at <= ?`, now.UnixMilli()); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO sessions (key, history, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET history = excluded.history, expires_at = excluded.expires_at`,
+		key, history, expires)
+	return err
+}
+
+// DeleteSession forgets a conversation's history
+func (s *Store) DeleteSession(key string) error {
+	_, err := s.db.Exec(`DELETE FROM sessions WHERE key = ?`, key)
+	return err
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrCampaignRunning is returned when a channel already has a campaign
+var ErrCampaignRunning = errors.New("a campaign is already running")
+
+// Campaign is the state of a tabletop campaign the bot runs as dungeon
+// master in a channel, kept up to date after every turn
+type Campaign struct {
+	ChannelID string
+	GuildID   string
+	// World and premise the campaign was started with
+	Setting string
+	// Characters of the party, one line each
+	Party []string
+	// Items the party carries, one line each
+	Inventory []string
+	// Where the party is and what is happening
+	Scene string
+	// Turns played so far
+	Turns     int
+	StartedBy string
+	UpdatedAt time.Time
+}
+
+// StartCampaign saves a new campaign. It returns ErrCampaignRunning if the
+// channel already has one.
+func (s *Store) StartCampaign(c Campaign) error {
+	result, err := s.db.Exec(`INSERT INTO campaigns (channel_id, guild_id, setting, party, inventory, scene, turns, started_by, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (channel_id) DO NOTHING`,
+		c.ChannelID, c.GuildID, c.Setting, strings.Join(c.Party, "\n"), strings.Join(c.Inventory, "\n"), c.Scene, c.Turns, c.StartedBy, c.UpdatedAt.UnixMilli())
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err == nil && n == 0 {
+		err = ErrCampaignRunning
+	}
+	return err
+}
+
+// Campaign returns the campaign of a channel, or nil when there is none
+func (s *Store) Campaign(channelID string) (*Campaign, error) {
+	c, err := scanCampaign(s.db.QueryRow(`SELECT channel_id, guild_id, setting, party, inventory, scene, turns, started_by, updated_at
+		FROM campaigns WHERE channel_id = ?`, channelID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// userCampaigns returns the campaigns a user started
+func (s *Store) userCampaigns(userID string) ([]Campaign, error) {
+	rows, err := s.db.Query(`SELECT channel_id, guild_id, setting, party, inventory, scene, turns, started_by, updated_at
+		FROM campaigns WHERE started_by = ? ORDER BY updated_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var campaigns []Campaign
+	for rows.Next() {
+		c, err := scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, *c)
+	}
+	return campaigns, rows.Err()
+}
+
+// scanCampaign reads a campaign from a row of a query selecting all its
+// columns, from sql.Row or sql.Rows
+func scanCampaign(row interface{ Scan(...any) error }) (*Campaign, error) {
+	var c Campaign
+	var party, inventory string
+	var updated int64
+	err := row.Scan(&c.ChannelID, &c.GuildID, &c.Setting, &party, &inventory, &c.Scene, &c.Turns, &c.StartedBy, &updated)
+	if err != nil {
+		return nil, err
+	}
+	if party != "" {
+		c.Party = strings.Split(party, "\n")
+	}
+	if inventory != "" {
+		c.Inventory = strings.Split(inventory, "\n")
+	}
+	c.UpdatedAt = time.UnixMilli(updated)
+	return &c, nil
+}
+
+// UpdateCampaign saves a channel's campaign state: its party, inventory,
+// scene and turns
+func (s *Store) UpdateCampaign(c Campaign) error {
+	_, err := s.db.Exec(`UPDATE campaigns SET party = ?, inventory = ?, scene = ?, turns = ?, updated_at = ? WHERE channel_id = ?`,
+		strings.Join(c.Party, "\n"), strings.Join(c.Inventory, "\n"), c.Scene, c.Turns, c.UpdatedAt.UnixMilli(), c.ChannelID)
+	return err
+}
+
+// EndCampaign deletes a channel's campaign, reporting whether it had one
+func (s *Store) EndCampaign(channelID string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM campaigns WHERE channel_id = ?`, channelID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
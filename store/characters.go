@@ -0,0 +1,91 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrCharactersFull is returned when a guild already has the maximum number
+// of roleplay characters
+var ErrCharactersFull = errors.New("characters are full")
+
+// Character is a roleplay character saved in a guild, which the bot plays in
+// a thread of its own. Names are matched regardless of case.
+type Character struct {
+	GuildID     string
+	Name        string
+	Description string
+	// First message the character sends in a roleplay
+	Greeting string
+	// Sample exchange showing how the character talks, may be empty
+	ExampleDialogue string
+	AuthorID        string
+}
+
+// Character returns a guild's character by name, or nil when there is none
+func (s *Store) Character(guildID string, name string) (*Character, error) {
+	c := Character{GuildID: guildID}
+	err := s.db.QueryRow(`SELECT name, description, greeting, example_dialogue, author_id FROM characters WHERE guild_id = ? AND name = ?`, guildID, name).
+		Scan(&c.Name, &c.Description, &c.Greeting, &c.ExampleDialogue, &c.AuthorID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Characters returns a guild's characters by name
+func (s *Store) Characters(guildID string) ([]Character, error) {
+	return s.queryCharacters(`SELECT guild_id, name, description, greeting, example_dialogue, author_id FROM characters
+		WHERE guild_id = ? ORDER BY name`, guildID)
+}
+
+// queryCharacters runs a query selecting characters
+func (s *Store) queryCharacters(query string, args ...any) ([]Character, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var characters []Character
+	for rows.Next() {
+		var c Character
+		if err := rows.Scan(&c.GuildID, &c.Name, &c.Description, &c.Greeting, &c.ExampleDialogue, &c.AuthorID); err != nil {
+			return nil, err
+		}
+		characters = append(characters, c)
+	}
+	return characters, rows.Err()
+}
+
+// SaveCharacter saves a character, replacing the guild's character of the
+// same name. It returns ErrCharactersFull if the character is new and the
+// guild already has limit characters.
+func (s *Store) SaveCharacter(c Character, limit int) error {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM characters WHERE guild_id = ? AND name != ?`, c.GuildID, c.Name).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count >= limit {
+		return ErrCharactersFull
+	}
+	_, err = s.db.Exec(`INSERT INTO characters (guild_id, name, description, greeting, example_dialogue, author_id) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (guild_id, name) DO UPDATE SET name = excluded.name, description = excluded.description,
+			greeting = excluded.greeting, example_dialogue = excluded.example_dialogue, author_id = excluded.author_id`,
+		c.GuildID, c.Name, c.Description, c.Greeting, c.ExampleDialogue, c.AuthorID)
+	return err
+}
+
+// DeleteCharacter deletes a guild's character, reporting whether it existed
+func (s *Store) DeleteCharacter(guildID string, name string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM characters WHERE guild_id = ? AND name = ?`, guildID, name)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,53 @@
+package store
+
+import "time"
+
+// EventReminder is a reminder the bot posts in a channel before a guild's
+// scheduled event starts
+type EventReminder struct {
+	ID        int64
+	GuildID   string
+	EventID   string
+	ChannelID string
+	CreatedBy string
+	RemindAt  time.Time
+}
+
+// AddEventReminder saves a reminder of a scheduled event and returns its ID
+func (s *Store) AddEventReminder(r EventReminder) (int64, error) {
+	result, err := s.db.Exec(`INSERT INTO event_reminders (guild_id, event_id, channel_id, created_by, remind_at) VALUES (?, ?, ?, ?, ?)`,
+		r.GuildID, r.EventID, r.ChannelID, r.CreatedBy, r.RemindAt.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// DueEventReminders returns the event reminders due at or before now,
+// oldest first
+func (s *Store) DueEventReminders(now time.Time) ([]EventReminder, error) {
+	rows, err := s.db.Query(`SELECT id, guild_id, event_id, channel_id, created_by, remind_at
+		FROM event_reminders WHERE remind_at <= ? ORDER BY remind_at`, now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []EventReminder
+	for rows.Next() {
+		var r EventReminder
+		var remindAt int64
+		if err := rows.Scan(&r.ID, &r.GuildID, &r.EventID, &r.ChannelID, &r.CreatedBy, &remindAt); err != nil {
+			return nil, err
+		}
+		r.RemindAt = time.UnixMilli(remindAt)
+		reminders = append(reminders, r)
+	}
+	return reminders, rows.Err()
+}
+
+// DeleteEventReminder deletes an event reminder once it has been posted
+func (s *Store) DeleteEventReminder(id int64) error {
+	_, err := s.db.Exec(`DELETE FROM event_reminders WHERE id = ?`, id)
+	return err
+}
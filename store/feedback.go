@@ -0,0 +1,85 @@
+package store
+
+import "time"
+
+// Feedback is a member's 👍 or 👎 on an answer of the bot, with the prompt
+// and response it was given on
+type Feedback struct {
+	GuildID   string
+	ChannelID string
+	MessageID string
+	UserID    string
+	Up        bool
+	Prompt    string
+	Response  string
+	CreatedAt time.Time
+
+	// Who wrote the prompt, "" when it was forgotten before the vote
+	AskerID string
+}
+
+// FeedbackDay counts the votes given in a guild on a day
+type FeedbackDay struct {
+	// Day in UTC, like "2024-05-31"
+	Day  string
+	Up   int
+	Down int
+}
+
+// RecordFeedback saves a member's vote on an answer, replacing their earlier
+// vote on it
+func (s *Store) RecordFeedback(f Feedback) error {
+	_, err := s.db.Exec(`INSERT INTO feedback (message_id, user_id, guild_id, channel_id, up, prompt, response, created_at, asker_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (message_id, user_id) DO UPDATE SET
+			up = excluded.up, created_at = excluded.created_at`,
+		f.MessageID, f.UserID, f.GuildID, f.ChannelID, f.Up, f.Prompt, f.Response, f.CreatedAt.UnixMilli(), f.AskerID)
+	return err
+}
+
+// FeedbackByDay counts the votes given in a guild since a time, by day
+func (s *Store) FeedbackByDay(guildID string, since time.Time) ([]FeedbackDay, error) {
+	rows, err := s.db.Query(`SELECT date(created_at / 1000, 'unixepoch') AS day, SUM(up), SUM(NOT up) FROM feedback
+		WHERE guild_id = ? AND created_at >= ? GROUP BY day ORDER BY day`, guildID, since.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []FeedbackDay
+	for rows.Next() {
+		var d FeedbackDay
+		if err := rows.Scan(&d.Day, &d.Up, &d.Down); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// GuildFeedback returns the latest votes given in a guild, newest first, at
+// most limit
+func (s *Store) GuildFeedback(guildID string, limit int) ([]Feedback, error) {
+	return s.queryFeedback(`SELECT guild_id, channel_id, message_id, user_id, up, prompt, response, created_at, asker_id FROM feedback
+		WHERE guild_id = ? ORDER BY created_at DESC LIMIT ?`, guildID, limit)
+}
+
+// queryFeedback runs a query selecting votes
+func (s *Store) queryFeedback(query string, args ...any) ([]Feedback, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feedback []Feedback
+	for rows.Next() {
+		var f Feedback
+		var created int64
+		if err := rows.Scan(&f.GuildID, &f.ChannelID, &f.MessageID, &f.UserID, &f.Up, &f.Prompt, &f.Response, &created, &f.AskerID); err != nil {
+			return nil, err
+		}
+		f.CreatedAt = time.UnixMilli(created)
+		feedback = append(feedback, f)
+	}
+	return feedback, rows.Err()
+}
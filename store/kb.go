@@ -0,0 +1,86 @@
+package store
+
+// KBChunk is a chunk of a knowledge base document and its embedding
+type KBChunk struct {
+	Source  string
+	Content string
+	Vector  []float32
+}
+
+// KBSource is a knowledge base document and the number of chunks it has
+type KBSource struct {
+	Name   string
+	Chunks int
+}
+
+// AddKBSource saves a document's chunks and their embeddings, replacing any
+// earlier version of the same source
+func (s *Store) AddKBSource(guildID string, source string, chunks []string, vectors [][]float32) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM kb_chunks WHERE guild_id = ? AND source = ?`, guildID, source); err != nil {
+		return err
+	}
+	for n, chunk := range chunks {
+		_, err := tx.Exec(`INSERT INTO kb_chunks (guild_id, source, content, embedding) VALUES (?, ?, ?, ?)`,
+			guildID, source, chunk, encodeVector(vectors[n]))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RemoveKBSource deletes every chunk of a source, reporting whether it existed
+func (s *Store) RemoveKBSource(guildID string, source string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM kb_chunks WHERE guild_id = ? AND source = ?`, guildID, source)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
+
+// KBSources lists a guild's knowledge base documents by name
+func (s *Store) KBSources(guildID string) ([]KBSource, error) {
+	rows, err := s.db.Query(`SELECT source, COUNT(*) FROM kb_chunks WHERE guild_id = ? GROUP BY source ORDER BY source`, guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []KBSource
+	for rows.Next() {
+		var source KBSource
+		if err := rows.Scan(&source.Name, &source.Chunks); err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return sources, rows.Err()
+}
+
+// KBChunks returns every chunk of a guild's knowledge base
+func (s *Store) KBChunks(guildID string) ([]KBChunk, error) {
+	rows, err := s.db.Query(`SELECT source, content, embedding FROM kb_chunks WHERE guild_id = ?`, guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []KBChunk
+	for rows.Next() {
+		var chunk KBChunk
+		var embedding []byte
+		if err := rows.Scan(&chunk.Source, &chunk.Content, &embedding); err != nil {
+			return nil, err
+		}
+		chunk.Vector = decodeVector(embedding)
+		chunks = append(chunks, chunk)
+	}
+	return chunks, rows.Err()
+}
@@ -0,0 +1,61 @@
+package store
+
+import "errors"
+
+// ErrMemoryFull is returned when a user already has the maximum number of memories
+var ErrMemoryFull = errors.New("memory is full")
+
+// Memory is a fact remembered about a user
+type Memory struct {
+	ID   int64
+	Fact string
+}
+
+// Memories returns the facts remembered about a user, oldest first
+func (s *Store) Memories(userID string) ([]Memory, error) {
+	rows, err := s.db.Query(`SELECT id, fact FROM memories WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memories []Memory
+	for rows.Next() {
+		var m Memory
+		if err := rows.Scan(&m.ID, &m.Fact); err != nil {
+			return nil, err
+		}
+		memories = append(memories, m)
+	}
+	return memories, rows.Err()
+}
+
+// AddMemory remembers a fact about a user, returning ErrMemoryFull if they
+// already have limit memories
+func (s *Store) AddMemory(userID string, fact string, limit int) error {
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM memories WHERE user_id = ?`, userID).Scan(&count); err != nil {
+		return err
+	}
+	if count >= limit {
+		return ErrMemoryFull
+	}
+	_, err := s.db.Exec(`INSERT INTO memories (user_id, fact) VALUES (?, ?)`, userID, fact)
+	return err
+}
+
+// DeleteMemory forgets one of a user's memories, reporting whether it existed
+func (s *Store) DeleteMemory(userID string, id int64) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM memories WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
+
+// DeleteMemories forgets everything remembered about a user
+func (s *Store) DeleteMemories(userID string) error {
+	_, err := s.db.Exec(`DELETE FROM memories WHERE user_id = ?`, userID)
+	return err
+}
@@ -0,0 +1,92 @@
+package store
+
+import "time"
+
+// IndexedMessage is a message of an indexed channel and its embedding
+type IndexedMessage struct {
+	MessageID string
+	GuildID   string
+	ChannelID string
+	Author    string
+	AuthorID  string
+	Content   string
+	CreatedAt time.Time
+	Vector    []float32
+}
+
+// EnableIndexing opts a channel in to message indexing
+func (s *Store) EnableIndexing(channelID string, guildID string) error {
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO indexed_channels (channel_id, guild_id) VALUES (?, ?)`, channelID, guildID)
+	return err
+}
+
+// DisableIndexing opts a channel out of message indexing and deletes its index
+func (s *Store) DisableIndexing(channelID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM indexed_channels WHERE channel_id = ?`, channelID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM message_index WHERE channel_id = ?`, channelID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsIndexed reports whether indexing is enabled for a channel
+func (s *Store) IsIndexed(channelID string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM indexed_channels WHERE channel_id = ?)`, channelID).Scan(&exists)
+	return exists, err
+}
+
+// IndexMessages adds messages to the index, replacing earlier versions
+func (s *Store) IndexMessages(messages []IndexedMessage) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, m := range messages {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO message_index
+			(message_id, guild_id, channel_id, author, author_id, content, embedding, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			m.MessageID, m.GuildID, m.ChannelID, m.Author, m.AuthorID, m.Content, encodeVector(m.Vector), m.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// IndexedMessages returns every indexed message of a guild
+func (s *Store) IndexedMessages(guildID string) ([]IndexedMessage, error) {
+	rows, err := s.db.Query(`SELECT message_id, channel_id, author, author_id, content, embedding, created_at
+		FROM message_index WHERE guild_id = ?`, guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []IndexedMessage
+	for rows.Next() {
+		m := IndexedMessage{GuildID: guildID}
+		var embedding []byte
+		if err := rows.Scan(&m.MessageID, &m.ChannelID, &m.Author, &m.AuthorID, &m.Content, &embedding, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.Vector = decodeVector(embedding)
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// DeleteIndexedMessage removes a message from the index
+func (s *Store) DeleteIndexedMessage(messageID string) error {
+	_, err := s.db.Exec(`DELETE FROM message_index WHERE message_id = ?`, messageID)
+	return err
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ModeratedChannel holds the moderation settings of a channel that opted in
+type ModeratedChannel struct {
+	ChannelID string
+	GuildID   string
+	// Channel flagged messages are reported to
+	LogChannelID string
+	// Score from 0 to 100 at which a message is flagged
+	Threshold int
+	// Whether flagged messages are also deleted
+	AutoDelete bool
+}
+
+// SetModeratedChannel turns moderation on for a channel, replacing its
+// earlier settings
+func (s *Store) SetModeratedChannel(c ModeratedChannel) error {
+	_, err := s.db.Exec(`INSERT INTO moderated_channels (channel_id, guild_id, log_channel_id, threshold, auto_delete) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (channel_id) DO UPDATE SET log_channel_id = excluded.log_channel_id, threshold = excluded.threshold, auto_delete = excluded.auto_delete`,
+		c.ChannelID, c.GuildID, c.LogChannelID, c.Threshold, c.AutoDelete)
+	return err
+}
+
+// ModeratedChannel returns a channel's moderation settings, or nil when
+// moderation is off
+func (s *Store) ModeratedChannel(channelID string) (*ModeratedChannel, error) {
+	c := ModeratedChannel{ChannelID: channelID}
+	err := s.db.QueryRow(`SELECT guild_id, log_channel_id, threshold, auto_delete FROM moderated_channels WHERE channel_id = ?`, channelID).
+		Scan(&c.GuildID, &c.LogChannelID, &c.Threshold, &c.AutoDelete)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// DeleteModeratedChannel turns moderation off for a channel, reporting
+// whether it was on
+func (s *Store) DeleteModeratedChannel(channelID string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM moderated_channels WHERE channel_id = ?`, channelID)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Variants of a persona test
+const (
+	VariantA = "a"
+	VariantB = "b"
+)
+
+// PersonaTest is an A/B test in which the bot alternates between two
+// personas in a guild for a while, collecting votes on its answers
+type PersonaTest struct {
+	GuildID   string
+	PersonaA  string
+	PersonaB  string
+	StartedBy string
+	StartedAt time.Time
+	EndsAt    time.Time
+}
+
+// Running reports whether the test is still running at a time
+func (t *PersonaTest) Running(now time.Time) bool {
+	return now.Before(t.EndsAt)
+}
+
+// Persona returns the persona of a variant
+func (t *PersonaTest) Persona(variant string) string {
+	if variant == VariantB {
+		return t.PersonaB
+	}
+	return t.PersonaA
+}
+
+// PersonaVotes counts the votes on the answers of one variant of a test
+type PersonaVotes struct {
+	Up   int
+	Down int
+}
+
+// PersonaVote is a member's vote on an answer written by a variant of a
+// guild's persona test
+type PersonaVote struct {
+	GuildID   string
+	MessageID string
+	Variant   string
+	Up        bool
+}
+
+// StartPersonaTest saves a guild's persona test, replacing its earlier one
+// and that test's votes
+func (s *Store) StartPersonaTest(t PersonaTest) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM persona_votes WHERE guild_id = ?`, t.GuildID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO persona_tests (guild_id, persona_a, persona_b, started_by, started_at, ends_at)
+		VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (guild_id) DO UPDATE SET
+			persona_a = excluded.persona_a, persona_b = excluded.persona_b, started_by = excluded.started_by,
+			started_at = excluded.started_at, ends_at = excluded.ends_at`,
+		t.GuildID, t.PersonaA, t.PersonaB, t.StartedBy, t.StartedAt.UnixMilli(), t.EndsAt.UnixMilli())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PersonaTest returns a guild's latest persona test, running or ended, or
+// nil when it never ran one
+func (s *Store) PersonaTest(guildID string) (*PersonaTest, error) {
+	t := PersonaTest{GuildID: guildID}
+	var started, ends int64
+	err := s.db.QueryRow(`SELECT persona_a, persona_b, started_by, started_at, ends_at FROM persona_tests WHERE guild_id = ?`, guildID).
+		Scan(&t.PersonaA, &t.PersonaB, &t.StartedBy, &started, &ends)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.StartedAt, t.EndsAt = time.UnixMilli(started), time.UnixMilli(ends)
+	return &t, nil
+}
+
+// EndPersonaTest ends a guild's persona test early, keeping its votes for
+// its report. It reports whether a test was running.
+func (s *Store) EndPersonaTest(guildID string, at time.Time) (bool, error) {
+	result, err := s.db.Exec(`UPDATE persona_tests SET ends_at = ? WHERE guild_id = ? AND ends_at > ?`,
+		at.UnixMilli(), guildID, at.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// RecordPersonaVote saves a user's vote on an answer of a variant of a
+// guild's persona test, replacing their earlier vote on that answer
+func (s *Store) RecordPersonaVote(guildID string, messageID string, userID string, variant string, up bool) error {
+	_, err := s.db.Exec(`INSERT INTO persona_votes (message_id, user_id, guild_id, variant, up) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (message_id, user_id) DO UPDATE SET up = excluded.up`,
+		messageID, userID, guildID, variant, up)
+	return err
+}
+
+// PersonaTestVotes counts the votes of a guild's persona test by variant
+func (s *Store) PersonaTestVotes(guildID string) (map[string]PersonaVotes, error) {
+	rows, err := s.db.Query(`SELECT variant, SUM(up), SUM(NOT up) FROM persona_votes WHERE guild_id = ? GROUP BY variant`, guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	votes := make(map[string]PersonaVotes)
+	for rows.Next() {
+		var variant string
+		var v PersonaVotes
+		if err := rows.Scan(&variant, &v.Up, &v.Down); err != nil {
+			return nil, err
+		}
+		votes[variant] = v
+	}
+	return votes, rows.Err()
+}
@@ -0,0 +1,304 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Name of the database/sql driver Postgres connects with, registered only by
+// builds with the postgres tag so others don't carry it
+const postgresDriver = "pgx"
+
+// Tables of the shared state created on startup if they don't exist yet
+var postgresSchema = []string{
+	`CREATE TABLE IF NOT EXISTS sessions (
+		key TEXT PRIMARY KEY,
+		history BYTEA NOT NULL,
+		expires_at BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS guild_settings (
+		guild_id TEXT PRIMARY KEY,
+		trigger_mode TEXT NOT NULL,
+		model TEXT NOT NULL,
+		persona TEXT NOT NULL,
+		safety TEXT NOT NULL,
+		nsfw_safety TEXT NOT NULL,
+		allowed_channels TEXT NOT NULL,
+		rate_limit INTEGER NOT NULL,
+		language TEXT NOT NULL,
+		spoilers BOOLEAN NOT NULL,
+		scrub_pii BOOLEAN NOT NULL,
+		polls_disabled BOOLEAN NOT NULL,
+		media_minutes INTEGER NOT NULL,
+		pdf_pages INTEGER NOT NULL,
+		verbosity TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS memories (
+		id BIGSERIAL PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		fact TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS memories_user ON memories (user_id)`,
+	`CREATE TABLE IF NOT EXISTS usage (
+		day TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		guild_id TEXT NOT NULL,
+		requests INTEGER NOT NULL,
+		prompt_tokens BIGINT NOT NULL,
+		response_tokens BIGINT NOT NULL,
+		PRIMARY KEY (day, user_id, guild_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS usage_guild ON usage (guild_id, day)`,
+	`CREATE INDEX IF NOT EXISTS usage_user ON usage (user_id, day)`,
+}
+
+// Postgres keeps the shared state in a PostgreSQL database, for instances of
+// the bot on several hosts
+type Postgres struct {
+	db *sql.DB
+}
+
+// Postgres must implement Backend
+var _ Backend = (*Postgres)(nil)
+
+// OpenPostgres connects to the PostgreSQL database at url, like
+// "postgres://bot:secret@db:5432/bot", and creates any missing tables
+func OpenPostgres(url string) (*Postgres, error) {
+	if !slices.Contains(sql.Drivers(), postgresDriver) {
+		return nil, errors.New("this build has no Postgres driver, build the bot with -tags postgres")
+	}
+	db, err := sql.Open(postgresDriver, url)
+	if err != nil {
+		return nil, fmt.Errorf("error opening Postgres: %v", err)
+	}
+	for _, statement := range postgresSchema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error creating tables: %v", err)
+		}
+	}
+	return &Postgres{db: db}, nil
+}
+
+// Session returns the history saved under a conversation's key, or nil when
+// there's none or it expired
+func (p *Postgres) Session(key string) ([]byte, error) {
+	var history []byte
+	err := p.db.QueryRow(`SELECT history FROM sessions WHERE key = $1 AND (expires_at = 0 OR expires_at > $2)`, key, time.Now().UnixMilli()).
+		Scan(&history)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return history, err
+}
+
+// SaveSession saves a conversation's history, expiring after ttl unless it's 0.
+// Expired sessions are deleted as others are saved.
+func (p *Postgres) SaveSession(key string, history []byte, ttl time.Duration) error {
+	now := time.Now()
+	var expires int64
+	if ttl > 0 {
+		expires = now.Add(ttl).UnixMilli()
+	}
+	if _, err := p.db.Exec(`DELETE FROM sessions WHERE expires_at != 0 AND expires_at <= $1`, now.UnixMilli()); err != nil {
+		return err
+	}
+	_, err := p.db.Exec(`INSERT INTO sessions (key, history, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET history = excluded.history, expires_at = excluded.expires_at`,
+		key, history, expires)
+	return err
+}
+
+// DeleteSession forgets a conversation's history
+func (p *Postgres) DeleteSession(key string) error {
+	_, err := p.db.Exec(`DELETE FROM sessions WHERE key = $1`, key)
+	return err
+}
+
+// SetGuildSettings saves a guild's settings, replacing earlier ones
+func (p *Postgres) SetGuildSettings(g GuildSettings) error {
+	_, err := p.db.Exec(`INSERT INTO guild_settings (guild_id, trigger_mode, model, persona, safety, nsfw_safety, allowed_channels, rate_limit, language, spoilers, scrub_pii, polls_disabled, media_minutes, pdf_pages, verbosity)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (guild_id) DO UPDATE SET trigger_mode = excluded.trigger_mode, model = excluded.model,
+			persona = excluded.persona, safety = excluded.safety, nsfw_safety = excluded.nsfw_safety,
+			allowed_channels = excluded.allowed_channels, rate_limit = excluded.rate_limit,
+			language = excluded.language, spoilers = excluded.spoilers, scrub_pii = excluded.scrub_pii,
+			polls_disabled = excluded.polls_disabled, media_minutes = excluded.media_minutes, pdf_pages = excluded.pdf_pages,
+			verbosity = excluded.verbosity`,
+		g.GuildID, g.Trigger, g.Model, g.Persona, g.Safety, g.NSFWSafety, strings.Join(g.AllowedChannels, ","), g.RateLimit, g.Language, g.Spoilers, g.ScrubPII, g.PollsDisabled,
+		g.MaxMediaMinutes, g.MaxPDFPages, g.Verbosity)
+	return err
+}
+
+// GuildSettings returns a guild's settings, or nil when they were never changed
+func (p *Postgres) GuildSettings(guildID string) (*GuildSettings, error) {
+	g := GuildSettings{GuildID: guildID}
+	var channels string
+	err := p.db.QueryRow(`SELECT trigger_mode, model, persona, safety, nsfw_safety, allowed_channels, rate_limit, language, spoilers, scrub_pii, polls_disabled, media_minutes, pdf_pages, verbosity
+		FROM guild_settings WHERE guild_id = $1`, guildID).
+		Scan(&g.Trigger, &g.Model, &g.Persona, &g.Safety, &g.NSFWSafety, &channels, &g.RateLimit, &g.Language, &g.Spoilers, &g.ScrubPII, &g.PollsDisabled,
+			&g.MaxMediaMinutes, &g.MaxPDFPages, &g.Verbosity)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if channels != "" {
+		g.AllowedChannels = strings.Split(channels, ",")
+	}
+	return &g, nil
+}
+
+// DeleteGuildSettings resets a guild's settings to the defaults
+func (p *Postgres) DeleteGuildSettings(guildID string) error {
+	_, err := p.db.Exec(`DELETE FROM guild_settings WHERE guild_id = $1`, guildID)
+	return err
+}
+
+// Memories returns the facts remembered about a user, oldest first
+func (p *Postgres) Memories(userID string) ([]Memory, error) {
+	rows, err := p.db.Query(`SELECT id, fact FROM memories WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memories []Memory
+	for rows.Next() {
+		var m Memory
+		if err := rows.Scan(&m.ID, &m.Fact); err != nil {
+			return nil, err
+		}
+		memories = append(memories, m)
+	}
+	return memories, rows.Err()
+}
+
+// AddMemory remembers a fact about a user, returning ErrMemoryFull if they
+// already have limit memories
+func (p *Postgres) AddMemory(userID string, fact string, limit int) error {
+	var count int
+	if err := p.db.QueryRow(`SELECT COUNT(*) FROM memories WHERE user_id = $1`, userID).Scan(&count); err != nil {
+		return err
+	}
+	if count >= limit {
+		return ErrMemoryFull
+	}
+	_, err := p.db.Exec(`INSERT INTO memories (user_id, fact) VALUES ($1, $2)`, userID, fact)
+	return err
+}
+
+// DeleteMemory forgets one of a user's memories, reporting whether it existed
+func (p *Postgres) DeleteMemory(userID string, id int64) (bool, error) {
+	result, err := p.db.Exec(`DELETE FROM memories WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
+
+// DeleteMemories forgets everything remembered about a user
+func (p *Postgres) DeleteMemories(userID string) error {
+	_, err := p.db.Exec(`DELETE FROM memories WHERE user_id = $1`, userID)
+	return err
+}
+
+// RecordUsage adds a model request and its tokens to a user's usage for the
+// day of at; guildID is empty for direct messages
+func (p *Postgres) RecordUsage(userID string, guildID string, at time.Time, promptTokens int, responseTokens int) error {
+	_, err := p.db.Exec(`INSERT INTO usage (day, user_id, guild_id, requests, prompt_tokens, response_tokens)
+		VALUES ($1, $2, $3, 1, $4, $5)
+		ON CONFLICT (day, user_id, guild_id) DO UPDATE SET
+			requests = usage.requests + 1,
+			prompt_tokens = usage.prompt_tokens + excluded.prompt_tokens,
+			response_tokens = usage.response_tokens + excluded.response_tokens`,
+		usageDay(at), userID, guildID, promptTokens, responseTokens)
+	return err
+}
+
+// UserUsage returns a user's usage across all guilds from the day of since onwards
+func (p *Postgres) UserUsage(userID string, since time.Time) (Usage, error) {
+	return p.sumUsage(`user_id = $1 AND day >= $2`, userID, usageDay(since))
+}
+
+// GuildUsage returns a guild's usage from the day of since onwards
+func (p *Postgres) GuildUsage(guildID string, since time.Time) (Usage, error) {
+	return p.sumUsage(`guild_id = $1 AND day >= $2`, guildID, usageDay(since))
+}
+
+// TotalUsage returns everyone's usage from the day of since onwards
+func (p *Postgres) TotalUsage(since time.Time) (Usage, error) {
+	return p.sumUsage(`day >= $1`, usageDay(since))
+}
+
+// sumUsage totals the usage rows matching a condition
+func (p *Postgres) sumUsage(where string, args ...any) (Usage, error) {
+	var u Usage
+	err := p.db.QueryRow(`SELECT COALESCE(SUM(requests), 0), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(response_tokens), 0)
+		FROM usage WHERE `+where, args...).Scan(&u.Requests, &u.PromptTokens, &u.ResponseTokens)
+	return u, err
+}
+
+// UsageDays returns a user's usage by day and guild, oldest first
+func (p *Postgres) UsageDays(userID string) ([]UsageDay, error) {
+	rows, err := p.db.Query(`SELECT day, guild_id, requests, prompt_tokens, response_tokens
+		FROM usage WHERE user_id = $1 ORDER BY day, guild_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []UsageDay
+	for rows.Next() {
+		var u UsageDay
+		if err := rows.Scan(&u.Day, &u.GuildID, &u.Requests, &u.PromptTokens, &u.ResponseTokens); err != nil {
+			return nil, err
+		}
+		days = append(days, u)
+	}
+	return days, rows.Err()
+}
+
+// AnonymizeUser deletes a user's memories and moves their usage to an
+// anonymous user, as ForgetUser does
+func (p *Postgres) AnonymizeUser(userID string) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM memories WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO usage (day, user_id, guild_id, requests, prompt_tokens, response_tokens)
+		SELECT day, '', guild_id, requests, prompt_tokens, response_tokens FROM usage WHERE user_id = $1
+		ON CONFLICT (day, user_id, guild_id) DO UPDATE SET
+			requests = usage.requests + excluded.requests,
+			prompt_tokens = usage.prompt_tokens + excluded.prompt_tokens,
+			response_tokens = usage.response_tokens + excluded.response_tokens`, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM usage WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Ping checks that the database can still be queried
+func (p *Postgres) Ping() error {
+	return p.db.Ping()
+}
+
+// Close closes the connections to the database
+func (p *Postgres) Close() error {
+	return p.db.Close()
+}
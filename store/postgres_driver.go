@@ -0,0 +1,7 @@
+//go:build postgres
+
+package store
+
+// Only builds with the postgres tag carry the Postgres driver, since SQLite is
+// enough for a single instance
+import _ "github.com/jackc/pgx/v5/stdlib"
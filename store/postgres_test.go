@@ -0,0 +1,42 @@
+//go:build postgres
+
+package store
+
+import (
+	"database/sql"
+	"os"
+	"slices"
+	"testing"
+)
+
+// These tests run with go test -tags postgres ./store, checking the driver
+// builds in. TestPostgresSessions also needs POSTGRES_TEST_URL to point at a
+// database it may write to.
+
+func TestPostgresDriver(t *testing.T) {
+	if !slices.Contains(sql.Drivers(), postgresDriver) {
+		t.Fatalf("sql.Drivers() = %q, want %q among them", sql.Drivers(), postgresDriver)
+	}
+}
+
+func TestPostgresSessions(t *testing.T) {
+	url := os.Getenv("POSTGRES_TEST_URL")
+	if url == "" {
+		t.Skip("POSTGRES_TEST_URL isn't set")
+	}
+	p, err := OpenPostgres(url)
+	if err != nil {
+		t.Fatalf("OpenPostgres: %v", err)
+	}
+	defer p.Close()
+
+	key := "test:" + t.Name()
+	defer p.DeleteSession(key)
+	if err := p.SaveSession(key, []byte("history"), 0); err != nil {
+		t.Fatalf("SaveSession: %v", err)
+	}
+	history, err := p.Session(key)
+	if err != nil || string(history) != "history" {
+		t.Errorf("Session = %q, %v, want history", history, err)
+	}
+}
@@ -0,0 +1,206 @@
+package store
+
+import "database/sql"
+
+// UserData is everything the database holds about a user, apart from the
+// audit log: what they wrote or saved, their votes and the answers they got
+// votes on
+type UserData struct {
+	Memories []Memory
+	Usage    []UsageDay
+
+	// Messages the user wrote in indexed channels, without their embeddings
+	Messages []IndexedMessage
+
+	// Prompt templates the user saved
+	PromptTemplates []PromptTemplate
+
+	// Reminders the user set that haven't been sent yet
+	Reminders []Reminder
+
+	// Votes the user gave on answers, and votes on the answers to their
+	// prompts, with the prompt and response of each
+	Feedback []Feedback
+
+	// The user's answers in quizzes and votes in persona tests
+	QuizAnswers  []QuizAnswer
+	PersonaVotes []PersonaVote
+
+	// Roleplay characters the user saved and campaigns they started
+	Characters []Character
+	Campaigns  []Campaign
+}
+
+// authoredBy matches the indexed messages of a user. Messages indexed before
+// author IDs were stored only have the author's username.
+const authoredBy = `(author_id = ? OR (author_id = '' AND author = ?))`
+
+// UserData returns everything stored about a user, who may also be known by
+// username in older indexed messages
+func (s *Store) UserData(userID string, username string) (*UserData, error) {
+	memories, err := s.Memories(userID)
+	if err != nil {
+		return nil, err
+	}
+	data := &UserData{Memories: memories}
+
+	data.Usage, err = s.UsageDays(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT message_id, guild_id, channel_id, author, author_id, content, created_at
+		FROM message_index WHERE `+authoredBy+` ORDER BY created_at`, userID, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m IndexedMessage
+		if err := rows.Scan(&m.MessageID, &m.GuildID, &m.ChannelID, &m.Author, &m.AuthorID, &m.Content, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		data.Messages = append(data.Messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	data.PromptTemplates, err = s.queryPromptTemplates(`SELECT guild_id, name, template, author_id FROM prompt_templates
+		WHERE author_id = ? ORDER BY guild_id, name`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Reminders, err = s.UserReminders(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Feedback, err = s.queryFeedback(`SELECT guild_id, channel_id, message_id, user_id, up, prompt, response, created_at, asker_id
+		FROM feedback WHERE user_id = ? OR asker_id = ? ORDER BY created_at`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	answers, err := s.db.Query(`SELECT channel_id, number, correct FROM quiz_answers WHERE user_id = ? ORDER BY channel_id, number`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer answers.Close()
+	for answers.Next() {
+		var a QuizAnswer
+		if err := answers.Scan(&a.ChannelID, &a.Number, &a.Correct); err != nil {
+			return nil, err
+		}
+		data.QuizAnswers = append(data.QuizAnswers, a)
+	}
+	if err := answers.Err(); err != nil {
+		return nil, err
+	}
+
+	votes, err := s.db.Query(`SELECT guild_id, message_id, variant, up FROM persona_votes WHERE user_id = ? ORDER BY guild_id, message_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer votes.Close()
+	for votes.Next() {
+		var v PersonaVote
+		if err := votes.Scan(&v.GuildID, &v.MessageID, &v.Variant, &v.Up); err != nil {
+			return nil, err
+		}
+		data.PersonaVotes = append(data.PersonaVotes, v)
+	}
+	if err := votes.Err(); err != nil {
+		return nil, err
+	}
+
+	data.Characters, err = s.queryCharacters(`SELECT guild_id, name, description, greeting, example_dialogue, author_id FROM characters
+		WHERE author_id = ? ORDER BY guild_id, name`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Campaigns, err = s.userCampaigns(userID)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ForgetUser deletes a user's memories, indexed messages, reminders, quiz
+// answers, persona test votes, and the feedback they gave or that was given
+// on the answers to their prompts. Their usage is kept under an
+// anonymous user, so server token caps still count it, and the prompt
+// templates and characters they saved and the campaigns they started stay in
+// their servers without their ID.
+func (s *Store) ForgetUser(userID string, username string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := anonymizeUser(tx, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM message_index WHERE `+authoredBy, userID, username); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE prompt_templates SET author_id = '' WHERE author_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE characters SET author_id = '' WHERE author_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE campaigns SET started_by = '' WHERE started_by = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM reminders WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM quiz_answers WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM persona_votes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM feedback WHERE user_id = ? OR asker_id = ?`, userID, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AnonymizeUser deletes a user's memories and moves their usage to an
+// anonymous user, as ForgetUser does
+func (s *Store) AnonymizeUser(userID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := anonymizeUser(tx, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// anonymizeUser deletes a user's memories and moves their usage to the
+// anonymous user within a transaction
+func anonymizeUser(tx *sql.Tx, userID string) error {
+	if _, err := tx.Exec(`DELETE FROM memories WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`INSERT INTO usage (day, user_id, guild_id, requests, prompt_tokens, response_tokens)
+		SELECT day, '', guild_id, requests, prompt_tokens, response_tokens FROM usage WHERE user_id = ?
+		ON CONFLICT (day, user_id, guild_id) DO UPDATE SET
+			requests = requests + excluded.requests,
+			prompt_tokens = prompt_tokens + excluded.prompt_tokens,
+			response_tokens = response_tokens + excluded.response_tokens`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM usage WHERE user_id = ?`, userID)
+	return err
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrProfilesFull is returned when a channel already has the maximum number
+// of conversation profiles
+var ErrProfilesFull = errors.New("conversation profiles are full")
+
+// ChatProfile is a named conversation of a channel, with the persona the bot
+// takes on in it
+type ChatProfile struct {
+	ChannelID string
+	Name      string
+	Persona   string
+}
+
+// ChatProfile returns a channel's conversation profile by name, or nil when
+// there is none
+func (s *Store) ChatProfile(channelID string, name string) (*ChatProfile, error) {
+	p := ChatProfile{ChannelID: channelID, Name: name}
+	err := s.db.QueryRow(`SELECT persona FROM chat_profiles WHERE channel_id = ? AND name = ?`, channelID, name).Scan(&p.Persona)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ChatProfiles returns a channel's conversation profiles by name
+func (s *Store) ChatProfiles(channelID string) ([]ChatProfile, error) {
+	rows, err := s.db.Query(`SELECT channel_id, name, persona FROM chat_profiles WHERE channel_id = ? ORDER BY name`, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []ChatProfile
+	for rows.Next() {
+		var p ChatProfile
+		if err := rows.Scan(&p.ChannelID, &p.Name, &p.Persona); err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
+
+// SaveChatProfile saves a conversation profile, replacing the channel's
+// profile of the same name. It returns ErrProfilesFull if the profile is new
+// and the channel already has limit profiles.
+func (s *Store) SaveChatProfile(p ChatProfile, limit int) error {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM chat_profiles WHERE channel_id = ? AND name != ?`, p.ChannelID, p.Name).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count >= limit {
+		return ErrProfilesFull
+	}
+	_, err = s.db.Exec(`INSERT INTO chat_profiles (channel_id, name, persona) VALUES (?, ?, ?)
+		ON CONFLICT (channel_id, name) DO UPDATE SET persona = excluded.persona`,
+		p.ChannelID, p.Name, p.Persona)
+	return err
+}
+
+// DeleteChatProfile deletes a channel's conversation profile, switching the
+// channel back to its default conversation if the profile was active. It
+// reports whether the profile existed.
+func (s *Store) DeleteChatProfile(channelID string, name string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM chat_profiles WHERE channel_id = ? AND name = ?`, channelID, name)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	_, err = s.db.Exec(`DELETE FROM active_chat_profiles WHERE channel_id = ? AND name = ?`, channelID, name)
+	return n > 0, err
+}
+
+// SetActiveChatProfile makes a profile the conversation the bot answers in
+// a channel, or the default conversation when name is empty
+func (s *Store) SetActiveChatProfile(channelID string, name string) error {
+	if name == "" {
+		_, err := s.db.Exec(`DELETE FROM active_chat_profiles WHERE channel_id = ?`, channelID)
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO active_chat_profiles (channel_id, name) VALUES (?, ?)
+		ON CONFLICT (channel_id) DO UPDATE SET name = excluded.name`, channelID, name)
+	return err
+}
+
+// ActiveChatProfile returns the profile the bot answers with in a channel,
+// or nil when it uses the default conversation
+func (s *Store) ActiveChatProfile(channelID string) (*ChatProfile, error) {
+	var name string
+	err := s.db.QueryRow(`SELECT name FROM active_chat_profiles WHERE channel_id = ?`, channelID).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.ChatProfile(channelID, name)
+}
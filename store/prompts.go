@@ -0,0 +1,76 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrTemplatesFull is returned when a guild already has the maximum number
+// of prompt templates
+var ErrTemplatesFull = errors.New("prompt templates are full")
+
+// PromptTemplate is a reusable prompt saved in a guild
+type PromptTemplate struct {
+	GuildID  string
+	Name     string
+	Template string
+	AuthorID string
+}
+
+// PromptTemplate returns a guild's prompt template by name, or nil when there
+// is none
+func (s *Store) PromptTemplate(guildID string, name string) (*PromptTemplate, error) {
+	t := PromptTemplate{GuildID: guildID, Name: name}
+	err := s.db.QueryRow(`SELECT template, author_id FROM prompt_templates WHERE guild_id = ? AND name = ?`, guildID, name).
+		Scan(&t.Template, &t.AuthorID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// PromptTemplates returns a guild's prompt templates by name
+func (s *Store) PromptTemplates(guildID string) ([]PromptTemplate, error) {
+	return s.queryPromptTemplates(`SELECT guild_id, name, template, author_id FROM prompt_templates
+		WHERE guild_id = ? ORDER BY name`, guildID)
+}
+
+// SavePromptTemplate saves a prompt template, replacing the guild's template
+// of the same name. It returns ErrTemplatesFull if the template is new and the
+// guild already has limit templates.
+func (s *Store) SavePromptTemplate(t PromptTemplate, limit int) error {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM prompt_templates WHERE guild_id = ? AND name != ?`, t.GuildID, t.Name).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count >= limit {
+		return ErrTemplatesFull
+	}
+	_, err = s.db.Exec(`INSERT INTO prompt_templates (guild_id, name, template, author_id) VALUES (?, ?, ?, ?)
+		ON CONFLICT (guild_id, name) DO UPDATE SET template = excluded.template, author_id = excluded.author_id`,
+		t.GuildID, t.Name, t.Template, t.AuthorID)
+	return err
+}
+
+// queryPromptTemplates runs a query returning prompt templates
+func (s *Store) queryPromptTemplates(query string, args ...any) ([]PromptTemplate, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []PromptTemplate
+	for rows.Next() {
+		var t PromptTemplate
+		if err := rows.Scan(&t.GuildID, &t.Name, &t.Template, &t.AuthorID); err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
@@ -0,0 +1,24 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// GuildProvider returns the AI provider a guild chose, or "" when it uses
+// the default
+func (s *Store) GuildProvider(guildID string) (string, error) {
+	var provider string
+	err := s.db.QueryRow(`SELECT provider FROM guild_providers WHERE guild_id = ?`, guildID).Scan(&provider)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return provider, err
+}
+
+// SetGuildProvider sets the AI provider a guild uses
+func (s *Store) SetGuildProvider(guildID string, provider string) error {
+	_, err := s.db.Exec(`INSERT INTO guild_providers (guild_id, provider) VALUES (?, ?)
+		ON CONFLICT (guild_id) DO UPDATE SET provider = excluded.provider`, guildID, provider)
+	return err
+}
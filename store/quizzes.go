@@ -0,0 +1,167 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrQuizRunning is returned when a channel already has a quiz going on
+var ErrQuizRunning = errors.New("a quiz is already running")
+
+// Quiz is a multiple-choice quiz going on in a channel, asking its
+// questions one at a time
+type Quiz struct {
+	ChannelID string
+	GuildID   string
+	Topic     string
+	StartedBy string
+	Questions []QuizQuestion
+	// Index of the question being asked
+	Current int
+	// Message asking the current question, empty before it is posted
+	MessageID string
+	StartedAt time.Time
+}
+
+// QuizQuestion is a question of a quiz with its options, Answer being the
+// index of the right one
+type QuizQuestion struct {
+	Question string
+	Options  []string
+	Answer   int
+}
+
+// QuizScore is how a member did in a quiz
+type QuizScore struct {
+	UserID   string
+	Correct  int
+	Answered int
+}
+
+// StartQuiz saves a new quiz with its questions. It returns ErrQuizRunning
+// if the channel already has one.
+func (s *Store) StartQuiz(q Quiz) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO quizzes (channel_id, guild_id, topic, started_by, current, message_id, started_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (channel_id) DO NOTHING`,
+		q.ChannelID, q.GuildID, q.Topic, q.StartedBy, q.Current, q.MessageID, q.StartedAt.UnixMilli())
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = ErrQuizRunning
+		}
+		return err
+	}
+	for n, question := range q.Questions {
+		_, err := tx.Exec(`INSERT INTO quiz_questions (channel_id, number, question, options, answer) VALUES (?, ?, ?, ?, ?)`,
+			q.ChannelID, n, question.Question, strings.Join(question.Options, "\n"), question.Answer)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Quiz returns the quiz going on in a channel, or nil when there is none
+func (s *Store) Quiz(channelID string) (*Quiz, error) {
+	q := Quiz{ChannelID: channelID}
+	var started int64
+	err := s.db.QueryRow(`SELECT guild_id, topic, started_by, current, message_id, started_at FROM quizzes WHERE channel_id = ?`, channelID).
+		Scan(&q.GuildID, &q.Topic, &q.StartedBy, &q.Current, &q.MessageID, &started)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	q.StartedAt = time.UnixMilli(started)
+
+	rows, err := s.db.Query(`SELECT question, options, answer FROM quiz_questions WHERE channel_id = ? ORDER BY number`, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var question QuizQuestion
+		var options string
+		if err := rows.Scan(&question.Question, &options, &question.Answer); err != nil {
+			return nil, err
+		}
+		question.Options = strings.Split(options, "\n")
+		q.Questions = append(q.Questions, question)
+	}
+	return &q, rows.Err()
+}
+
+// QuizAnswer is a member's answer to a question of a channel's quiz, Number
+// being the index of the question
+type QuizAnswer struct {
+	ChannelID string
+	Number    int
+	Correct   bool
+}
+
+// SetQuizQuestion moves a channel's quiz to a question, asked in a message
+func (s *Store) SetQuizQuestion(channelID string, current int, messageID string) error {
+	_, err := s.db.Exec(`UPDATE quizzes SET current = ?, message_id = ? WHERE channel_id = ?`, current, messageID, channelID)
+	return err
+}
+
+// AnswerQuiz records a member's answer to a question of a channel's quiz.
+// It reports false if they had already answered it, keeping their first
+// answer.
+func (s *Store) AnswerQuiz(channelID string, number int, userID string, correct bool) (bool, error) {
+	result, err := s.db.Exec(`INSERT INTO quiz_answers (channel_id, number, user_id, correct) VALUES (?, ?, ?, ?)
+		ON CONFLICT (channel_id, number, user_id) DO NOTHING`, channelID, number, userID, correct)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// QuizScores returns the scores of the members who answered in a channel's
+// quiz, best first
+func (s *Store) QuizScores(channelID string) ([]QuizScore, error) {
+	rows, err := s.db.Query(`SELECT user_id, SUM(correct), COUNT(*) FROM quiz_answers WHERE channel_id = ?
+		GROUP BY user_id ORDER BY SUM(correct) DESC, COUNT(*), user_id`, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scores []QuizScore
+	for rows.Next() {
+		var score QuizScore
+		if err := rows.Scan(&score.UserID, &score.Correct, &score.Answered); err != nil {
+			return nil, err
+		}
+		scores = append(scores, score)
+	}
+	return scores, rows.Err()
+}
+
+// EndQuiz deletes a channel's quiz with its questions and answers
+func (s *Store) EndQuiz(channelID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"quizzes", "quiz_questions", "quiz_answers"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE channel_id = ?`, channelID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
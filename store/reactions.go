@@ -0,0 +1,63 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ReactionAction maps an emoji reaction in a guild to an AI action
+type ReactionAction struct {
+	GuildID string
+	// A Unicode emoji, or "name:id" for custom emojis
+	Emoji  string
+	Action string
+}
+
+// SetReactionAction maps an emoji to an action in a guild, replacing its
+// earlier action
+func (s *Store) SetReactionAction(r ReactionAction) error {
+	_, err := s.db.Exec(`INSERT INTO reaction_actions (guild_id, emoji, action) VALUES (?, ?, ?)
+		ON CONFLICT (guild_id, emoji) DO UPDATE SET action = excluded.action`, r.GuildID, r.Emoji, r.Action)
+	return err
+}
+
+// DeleteReactionAction removes an emoji's action in a guild, reporting
+// whether it had one
+func (s *Store) DeleteReactionAction(guildID string, emoji string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM reaction_actions WHERE guild_id = ? AND emoji = ?`, guildID, emoji)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+// ReactionActionFor returns the action an emoji triggers in a guild, or ""
+// when it triggers none
+func (s *Store) ReactionActionFor(guildID string, emoji string) (string, error) {
+	var action string
+	err := s.db.QueryRow(`SELECT action FROM reaction_actions WHERE guild_id = ? AND emoji = ?`, guildID, emoji).Scan(&action)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return action, err
+}
+
+// ReactionActions returns a guild's reaction actions by action and emoji
+func (s *Store) ReactionActions(guildID string) ([]ReactionAction, error) {
+	rows, err := s.db.Query(`SELECT guild_id, emoji, action FROM reaction_actions WHERE guild_id = ? ORDER BY action, emoji`, guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actions []ReactionAction
+	for rows.Next() {
+		var r ReactionAction
+		if err := rows.Scan(&r.GuildID, &r.Emoji, &r.Action); err != nil {
+			return nil, err
+		}
+		actions = append(actions, r)
+	}
+	return actions, rows.Err()
+}
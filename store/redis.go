@@ -0,0 +1,672 @@
+package store
+
+import (
+	"bufio"
+	"cmp"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// How long connecting to Redis and each command may take
+	redisDialTimeout    = 5 * time.Second
+	redisCommandTimeout = 10 * time.Second
+
+	// How many connections may be open at once, and how many of them are
+	// kept open for later commands
+	redisMaxConns  = 16
+	redisIdleConns = 4
+
+	// What keys start with unless the URL sets a prefix, so the bot's don't
+	// mix with others in the same database
+	redisDefaultPrefix = "go-discord-bot:"
+
+	// Keys of the set of days with usage and of the last memory ID
+	redisUsageDays = "usage_days"
+	redisMemoryIDs = "memory_ids"
+)
+
+// Scripts run by Redis so each change is made at once
+const (
+	// Adds a memory unless the user already has ARGV[1] or more of them,
+	// returning its ID or 0
+	addMemoryScript = `if redis.call('HLEN', KEYS[1]) >= tonumber(ARGV[1]) then return 0 end
+local id = redis.call('INCR', KEYS[2])
+redis.call('HSET', KEYS[1], id, ARGV[2])
+return id`
+
+	// Adds a request and its tokens to a day's usage of a user and guild,
+	// and to the counters in the rest of the keys
+	recordUsageScript = `redis.call('HINCRBY', KEYS[1], ARGV[1] .. '|requests', 1)
+redis.call('HINCRBY', KEYS[1], ARGV[1] .. '|prompt_tokens', ARGV[2])
+redis.call('HINCRBY', KEYS[1], ARGV[1] .. '|response_tokens', ARGV[3])
+redis.call('SADD', KEYS[2], ARGV[4])
+for i = 3, #KEYS do
+	redis.call('HINCRBY', KEYS[i], 'requests', 1)
+	redis.call('HINCRBY', KEYS[i], 'prompt_tokens', ARGV[2])
+	redis.call('HINCRBY', KEYS[i], 'response_tokens', ARGV[3])
+end
+return 0`
+
+	// Adds up the requests and tokens of the counters in the keys
+	sumUsageScript = `local total = {0, 0, 0}
+for i = 1, #KEYS do
+	local counts = redis.call('HMGET', KEYS[i], 'requests', 'prompt_tokens', 'response_tokens')
+	for j = 1, 3 do
+		total[j] = total[j] + (tonumber(counts[j]) or 0)
+	end
+end
+return total`
+
+	// Moves a user's usage on a day to the anonymous user, and deletes their
+	// counters of the day and month
+	anonymizeUsageScript = `local fields = redis.call('HGETALL', KEYS[1])
+local prefix = ARGV[1] .. '|'
+for i = 1, #fields, 2 do
+	if string.sub(fields[i], 1, #prefix) == prefix then
+		redis.call('HINCRBY', KEYS[1], '|' .. string.sub(fields[i], #prefix + 1), fields[i + 1])
+		redis.call('HDEL', KEYS[1], fields[i])
+	end
+end
+redis.call('DEL', KEYS[2], KEYS[3])
+return 0`
+
+	// Extends a lock by ARGV[2] milliseconds if it still holds the token it
+	// was taken with
+	refreshLockScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`
+
+	// Releases a lock if it still holds the token it was taken with
+	unlockScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`
+)
+
+// Redis keeps the shared state in a Redis server, for instances of the bot on
+// several hosts. Sessions expire on their own there and are locked while an
+// instance answers in them. Usage is kept in a hash per day with a field per
+// user, guild and counter, and added up in counters per user, guild and in
+// all by day and month, so a month's usage is read at once.
+type Redis struct {
+	addr     string
+	tls      bool
+	username string
+	password string
+	db       int
+	prefix   string
+
+	// A slot for each connection open at once, and the connections kept
+	// open for later commands
+	slots  chan struct{}
+	mu     sync.Mutex
+	idle   []*redisConn
+	closed bool
+}
+
+// redisConn is a connection to the server and its replies
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Redis must implement Backend and Locker
+var (
+	_ Backend = (*Redis)(nil)
+	_ Locker  = (*Redis)(nil)
+)
+
+// redisError is an error reply of Redis
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// OpenRedis connects to the Redis server at url, like
+// "redis://:secret@cache:6379/0", or "rediss://" for TLS. Keys start with
+// the prefix parameter of the URL, like "?prefix=bot:", or "go-discord-bot:".
+func OpenRedis(rawURL string) (*Redis, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Redis URL %q, want redis://[:password@]host[:port][/db][?prefix=name:]", rawURL)
+	}
+	r := &Redis{addr: u.Host, tls: u.Scheme == "rediss", prefix: redisDefaultPrefix, slots: make(chan struct{}, redisMaxConns)}
+	if query := u.Query(); query.Has("prefix") {
+		r.prefix = query.Get("prefix")
+	}
+	if u.Port() == "" {
+		r.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		r.username = u.User.Username()
+		r.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if r.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+	}
+	if err := r.Ping(); err != nil {
+		return nil, fmt.Errorf("error connecting to Redis: %v", err)
+	}
+	return r, nil
+}
+
+// key returns the name of a key in the bot's namespace
+func (r *Redis) key(name string) string {
+	return r.prefix + name
+}
+
+// do sends a command on a connection of its own and returns its reply: a
+// string, an int64, a []byte, a []any of those, or nil
+func (r *Redis) do(args ...any) (any, error) {
+	r.slots <- struct{}{}
+	defer func() { <-r.slots }()
+
+	conn, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(redisCommandTimeout))
+	reply, err := conn.roundTrip(args)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		// The connection may be out of step with its replies
+		conn.Close()
+		return reply, err
+	}
+	r.put(conn)
+	return reply, err
+}
+
+// get returns an idle connection, or opens one
+func (r *Redis) get() (*redisConn, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, errors.New("redis: closed")
+	}
+	if n := len(r.idle); n > 0 {
+		conn := r.idle[n-1]
+		r.idle = r.idle[:n-1]
+		r.mu.Unlock()
+		return conn, nil
+	}
+	r.mu.Unlock()
+	return r.connect()
+}
+
+// put keeps a connection open for a later command, unless enough already are
+func (r *Redis) put(conn *redisConn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed || len(r.idle) >= redisIdleConns {
+		conn.Close()
+		return
+	}
+	r.idle = append(r.idle, conn)
+}
+
+// connect opens a connection and logs in
+func (r *Redis) connect() (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: redisDialTimeout}
+	var netConn net.Conn
+	var err error
+	if r.tls {
+		netConn, err = tls.DialWithDialer(dialer, "tcp", r.addr, nil)
+	} else {
+		netConn, err = dialer.Dial("tcp", r.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: netConn, reader: bufio.NewReader(netConn)}
+	conn.SetDeadline(time.Now().Add(redisCommandTimeout))
+
+	var setup [][]any
+	switch {
+	case r.username != "" && r.password != "":
+		setup = append(setup, []any{"AUTH", r.username, r.password})
+	case r.password != "":
+		setup = append(setup, []any{"AUTH", r.password})
+	}
+	if r.db != 0 {
+		setup = append(setup, []any{"SELECT", r.db})
+	}
+	for _, command := range setup {
+		if _, err := conn.roundTrip(command); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// roundTrip writes a command as an array of bulk strings and reads its reply
+func (c *redisConn) roundTrip(args []any) (any, error) {
+	var command []byte
+	command = fmt.Appendf(command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var value string
+		switch arg := arg.(type) {
+		case string:
+			value = arg
+		case []byte:
+			value = string(arg)
+		default:
+			value = fmt.Sprint(arg)
+		}
+		command = fmt.Appendf(command, "$%d\r\n%s\r\n", len(value), value)
+	}
+	if _, err := c.Write(command); err != nil {
+		return nil, err
+	}
+	return readReply(c.reader)
+}
+
+// readReply reads a reply of the Redis protocol. An array holding an error
+// reply is read to its end before the error is returned, so the next reply
+// starts where it should.
+func readReply(reader *bufio.Reader) (any, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]any, n)
+		var replyErr error
+		for i := range values {
+			values[i], err = readReply(reader)
+			var nested redisError
+			switch {
+			case errors.As(err, &nested):
+				if replyErr == nil {
+					replyErr = err
+				}
+			case err != nil:
+				return nil, err
+			}
+		}
+		if replyErr != nil {
+			return nil, replyErr
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// redisHash reads the reply of HGETALL into a map
+func redisHash(reply any) map[string]string {
+	values, _ := reply.([]any)
+	hash := make(map[string]string, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		field, _ := values[i].([]byte)
+		value, _ := values[i+1].([]byte)
+		hash[string(field)] = string(value)
+	}
+	return hash
+}
+
+// Session returns the history saved under a conversation's key, or nil when
+// there's none or it expired
+func (r *Redis) Session(key string) ([]byte, error) {
+	reply, err := r.do("GET", r.key("session:"+key))
+	history, _ := reply.([]byte)
+	return history, err
+}
+
+// SaveSession saves a conversation's history, expiring after ttl unless it's 0
+func (r *Redis) SaveSession(key string, history []byte, ttl time.Duration) error {
+	args := []any{"SET", "session:" + key, history}
+	if ttl > 0 {
+		args = append(args, "PX", ttl.Milliseconds())
+	}
+	_, err := r.do(args...)
+	return err
+}
+
+// DeleteSession forgets a conversation's history
+func (r *Redis) DeleteSession(key string) error {
+	_, err := r.do("DEL", r.key("session:"+key))
+	return err
+}
+
+// LockSession takes the lock of a conversation for up to ttl, returning a
+// token to release it with, or "" while another instance holds it
+func (r *Redis) LockSession(key string, ttl time.Duration) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(random)
+	reply, err := r.do("SET", r.key("lock:"+key), token, "NX", "PX", ttl.Milliseconds())
+	if err != nil || reply == nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RefreshSession holds the lock of a conversation for ttl more, reporting
+// whether it was still held with token
+func (r *Redis) RefreshSession(key string, token string, ttl time.Duration) (bool, error) {
+	reply, err := r.do("EVAL", refreshLockScript, 1, r.key("lock:"+key), token, ttl.Milliseconds())
+	held, _ := reply.(int64)
+	return held == 1, err
+}
+
+// UnlockSession releases the lock of a conversation, unless it expired and
+// was taken again
+func (r *Redis) UnlockSession(key string, token string) error {
+	_, err := r.do("EVAL", unlockScript, 1, r.key("lock:"+key), token)
+	return err
+}
+
+// SetGuildSettings saves a guild's settings, replacing earlier ones
+func (r *Redis) SetGuildSettings(g GuildSettings) error {
+	data, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	_, err = r.do("SET", r.key("guild_settings:"+g.GuildID), data)
+	return err
+}
+
+// GuildSettings returns a guild's settings, or nil when they were never changed
+func (r *Redis) GuildSettings(guildID string) (*GuildSettings, error) {
+	reply, err := r.do("GET", r.key("guild_settings:"+guildID))
+	data, _ := reply.([]byte)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var g GuildSettings
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// DeleteGuildSettings resets a guild's settings to the defaults
+func (r *Redis) DeleteGuildSettings(guildID string) error {
+	_, err := r.do("DEL", r.key("guild_settings:"+guildID))
+	return err
+}
+
+// Memories returns the facts remembered about a user, oldest first
+func (r *Redis) Memories(userID string) ([]Memory, error) {
+	reply, err := r.do("HGETALL", r.key("memories:"+userID))
+	if err != nil {
+		return nil, err
+	}
+	var memories []Memory
+	for field, fact := range redisHash(reply) {
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			continue
+		}
+		memories = append(memories, Memory{ID: id, Fact: fact})
+	}
+	slices.SortFunc(memories, func(a, b Memory) int { return cmp.Compare(a.ID, b.ID) })
+	return memories, nil
+}
+
+// AddMemory remembers a fact about a user, returning ErrMemoryFull if they
+// already have limit memories
+func (r *Redis) AddMemory(userID string, fact string, limit int) error {
+	reply, err := r.do("EVAL", addMemoryScript, 2, r.key("memories:"+userID), r.key(redisMemoryIDs), limit, fact)
+	if err != nil {
+		return err
+	}
+	if id, _ := reply.(int64); id == 0 {
+		return ErrMemoryFull
+	}
+	return nil
+}
+
+// DeleteMemory forgets one of a user's memories, reporting whether it existed
+func (r *Redis) DeleteMemory(userID string, id int64) (bool, error) {
+	reply, err := r.do("HDEL", r.key("memories:"+userID), id)
+	removed, _ := reply.(int64)
+	return removed > 0, err
+}
+
+// DeleteMemories forgets everything remembered about a user
+func (r *Redis) DeleteMemories(userID string) error {
+	_, err := r.do("DEL", r.key("memories:"+userID))
+	return err
+}
+
+// RecordUsage adds a model request and its tokens to a user's usage for the
+// day of at; guildID is empty for direct messages
+func (r *Redis) RecordUsage(userID string, guildID string, at time.Time, promptTokens int, responseTokens int) error {
+	day, month := usageDay(at), usageMonth(at)
+	args := []any{"EVAL", recordUsageScript, 8, r.key("usage:" + day), r.key(redisUsageDays)}
+	for _, period := range []string{day, month} {
+		args = append(args, r.key("usage:"+period+":user:"+userID), r.key("usage:"+period+":guild:"+guildID), r.key("usage:"+period+":total"))
+	}
+	_, err := r.do(append(args, userID+"|"+guildID, promptTokens, responseTokens, day)...)
+	return err
+}
+
+// UserUsage returns a user's usage across all guilds from the day of since onwards
+func (r *Redis) UserUsage(userID string, since time.Time) (Usage, error) {
+	return r.sumUsage("user:"+userID, since)
+}
+
+// GuildUsage returns a guild's usage from the day of since onwards
+func (r *Redis) GuildUsage(guildID string, since time.Time) (Usage, error) {
+	return r.sumUsage("guild:"+guildID, since)
+}
+
+// TotalUsage returns everyone's usage from the day of since onwards
+func (r *Redis) TotalUsage(since time.Time) (Usage, error) {
+	return r.sumUsage("total", since)
+}
+
+// sumUsage adds up the counters of scope, like "guild:1234" or "total", from
+// the day of since to today
+func (r *Redis) sumUsage(scope string, since time.Time) (Usage, error) {
+	periods := usagePeriods(since, time.Now())
+	args := []any{"EVAL", sumUsageScript, len(periods)}
+	for _, period := range periods {
+		args = append(args, r.key("usage:"+period+":"+scope))
+	}
+	reply, err := r.do(args...)
+	if err != nil {
+		return Usage{}, err
+	}
+	counts, _ := reply.([]any)
+	if len(counts) != 3 {
+		return Usage{}, fmt.Errorf("redis: unexpected usage %v", reply)
+	}
+	requests, _ := counts[0].(int64)
+	promptTokens, _ := counts[1].(int64)
+	responseTokens, _ := counts[2].(int64)
+	return Usage{Requests: int(requests), PromptTokens: int(promptTokens), ResponseTokens: int(responseTokens)}, nil
+}
+
+// usageMonth is the month of a time in UTC, as its usage counters are named
+func usageMonth(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// usagePeriods returns the days and months whose counters add up to the
+// usage from the day of since to the day of now: whole months from their
+// first day on, and single days before that
+func usagePeriods(since time.Time, now time.Time) []string {
+	since = since.UTC()
+	today := usageDay(now)
+	var periods []string
+	for day := time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, time.UTC); usageDay(day) <= today; {
+		if day.Day() == 1 {
+			periods = append(periods, usageMonth(day))
+			day = day.AddDate(0, 1, 0)
+		} else {
+			periods = append(periods, usageDay(day))
+			day = day.AddDate(0, 0, 1)
+		}
+	}
+	return periods
+}
+
+// redisUsage is a user's usage on a day in a guild
+type redisUsage struct {
+	userID string
+	UsageDay
+}
+
+// dayUsage returns the usage of a day by user and guild
+func (r *Redis) dayUsage(day string) ([]redisUsage, error) {
+	reply, err := r.do("HGETALL", r.key("usage:"+day))
+	if err != nil {
+		return nil, err
+	}
+	byKey := map[string]*redisUsage{}
+	for field, value := range redisHash(reply) {
+		parts := strings.SplitN(field, "|", 3)
+		n, err := strconv.Atoi(value)
+		if len(parts) != 3 || err != nil {
+			continue
+		}
+		key := parts[0] + "|" + parts[1]
+		u, ok := byKey[key]
+		if !ok {
+			u = &redisUsage{userID: parts[0], UsageDay: UsageDay{Day: day, GuildID: parts[1]}}
+			byKey[key] = u
+		}
+		switch parts[2] {
+		case "requests":
+			u.Requests = n
+		case "prompt_tokens":
+			u.PromptTokens = n
+		case "response_tokens":
+			u.ResponseTokens = n
+		}
+	}
+	usage := make([]redisUsage, 0, len(byKey))
+	for _, u := range byKey {
+		usage = append(usage, *u)
+	}
+	return usage, nil
+}
+
+// usageDays returns the days anyone used the bot, oldest first
+func (r *Redis) usageDays() ([]string, error) {
+	reply, err := r.do("SMEMBERS", r.key(redisUsageDays))
+	if err != nil {
+		return nil, err
+	}
+	values, _ := reply.([]any)
+	var days []string
+	for _, value := range values {
+		day, _ := value.([]byte)
+		days = append(days, string(day))
+	}
+	slices.Sort(days)
+	return days, nil
+}
+
+// UsageDays returns a user's usage by day and guild, oldest first
+func (r *Redis) UsageDays(userID string) ([]UsageDay, error) {
+	days, err := r.usageDays()
+	if err != nil {
+		return nil, err
+	}
+	var usage []UsageDay
+	for _, day := range days {
+		dayUsage, err := r.dayUsage(day)
+		if err != nil {
+			return nil, err
+		}
+		var user []UsageDay
+		for _, u := range dayUsage {
+			if u.userID == userID {
+				user = append(user, u.UsageDay)
+			}
+		}
+		slices.SortFunc(user, func(a, b UsageDay) int { return strings.Compare(a.GuildID, b.GuildID) })
+		usage = append(usage, user...)
+	}
+	return usage, nil
+}
+
+// AnonymizeUser deletes a user's memories and moves their usage to an
+// anonymous user, as ForgetUser does
+func (r *Redis) AnonymizeUser(userID string) error {
+	if err := r.DeleteMemories(userID); err != nil {
+		return err
+	}
+	days, err := r.usageDays()
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		month := day[:len("2006-01")]
+		if _, err := r.do("EVAL", anonymizeUsageScript, 3, r.key("usage:"+day), r.key("usage:"+day+":user:"+userID),
+			r.key("usage:"+month+":user:"+userID), userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ping checks that the server still answers
+func (r *Redis) Ping() error {
+	_, err := r.do("PING")
+	return err
+}
+
+// Close closes the idle connections to the server, and the others as soon as
+// their commands are done
+func (r *Redis) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	var errs []error
+	for _, conn := range r.idle {
+		errs = append(errs, conn.Close())
+	}
+	r.idle = nil
+	return errors.Join(errs...)
+}
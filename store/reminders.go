@@ -0,0 +1,81 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrRemindersFull is returned when a user already has the maximum number of
+// pending reminders
+var ErrRemindersFull = errors.New("reminders are full")
+
+// Reminder is a message the bot sends a user at a given time
+type Reminder struct {
+	ID     int64
+	UserID string
+	// Where the reminder was set, empty in DMs
+	GuildID string
+	// Channel the reminder pings the user in, or their DM channel
+	ChannelID string
+	Text      string
+	DueAt     time.Time
+	CreatedAt time.Time
+}
+
+// AddReminder saves a reminder and returns its ID. It returns
+// ErrRemindersFull if the user already has limit pending reminders.
+func (s *Store) AddReminder(r Reminder, limit int) (int64, error) {
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM reminders WHERE user_id = ?`, r.UserID).Scan(&count); err != nil {
+		return 0, err
+	}
+	if count >= limit {
+		return 0, ErrRemindersFull
+	}
+	result, err := s.db.Exec(`INSERT INTO reminders (user_id, guild_id, channel_id, text, due_at, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		r.UserID, r.GuildID, r.ChannelID, r.Text, r.DueAt.UnixMilli(), r.CreatedAt.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// DueReminders returns the reminders due at or before now, oldest first
+func (s *Store) DueReminders(now time.Time) ([]Reminder, error) {
+	return s.queryReminders(`SELECT id, user_id, guild_id, channel_id, text, due_at, created_at
+		FROM reminders WHERE due_at <= ? ORDER BY due_at`, now.UnixMilli())
+}
+
+// UserReminders returns a user's pending reminders, soonest first
+func (s *Store) UserReminders(userID string) ([]Reminder, error) {
+	return s.queryReminders(`SELECT id, user_id, guild_id, channel_id, text, due_at, created_at
+		FROM reminders WHERE user_id = ? ORDER BY due_at`, userID)
+}
+
+// DeleteReminder deletes a reminder once it has been sent
+func (s *Store) DeleteReminder(id int64) error {
+	_, err := s.db.Exec(`DELETE FROM reminders WHERE id = ?`, id)
+	return err
+}
+
+// queryReminders runs a query returning reminders
+func (s *Store) queryReminders(query string, args ...any) ([]Reminder, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []Reminder
+	for rows.Next() {
+		var r Reminder
+		var due, created int64
+		if err := rows.Scan(&r.ID, &r.UserID, &r.GuildID, &r.ChannelID, &r.Text, &due, &created); err != nil {
+			return nil, err
+		}
+		r.DueAt = time.UnixMilli(due)
+		r.CreatedAt = time.UnixMilli(created)
+		reminders = append(reminders, r)
+	}
+	return reminders, rows.Err()
+}
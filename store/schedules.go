@@ -0,0 +1,99 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSchedulesFull is returned when a guild already has the maximum number of
+// scheduled jobs
+var ErrSchedulesFull = errors.New("scheduled jobs are full")
+
+// ScheduledJob is a recurring summary of a channel, posted to another one
+type ScheduledJob struct {
+	ID      int64
+	GuildID string
+	// Channel summarized and channel the summary is posted to
+	SourceChannelID string
+	TargetChannelID string
+	// Cron expression of when the job runs, in UTC
+	Spec string
+	// How many hours of messages each run summarizes
+	Hours int
+	// Extra instructions for the summary, may be empty
+	Instructions string
+	CreatedBy    string
+	NextRun      time.Time
+}
+
+// AddScheduledJob saves a new scheduled job and returns its ID. It returns
+// ErrSchedulesFull if the guild already has limit jobs.
+func (s *Store) AddScheduledJob(job ScheduledJob, limit int) (int64, error) {
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM scheduled_jobs WHERE guild_id = ?`, job.GuildID).Scan(&count); err != nil {
+		return 0, err
+	}
+	if count >= limit {
+		return 0, ErrSchedulesFull
+	}
+	result, err := s.db.Exec(`INSERT INTO scheduled_jobs
+		(guild_id, source_channel_id, target_channel_id, spec, hours, instructions, created_by, next_run)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.GuildID, job.SourceChannelID, job.TargetChannelID, job.Spec, job.Hours, job.Instructions, job.CreatedBy, job.NextRun.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// ScheduledJobs returns a guild's scheduled jobs, oldest first
+func (s *Store) ScheduledJobs(guildID string) ([]ScheduledJob, error) {
+	return s.queryScheduledJobs(`SELECT id, guild_id, source_channel_id, target_channel_id, spec, hours, instructions, created_by, next_run
+		FROM scheduled_jobs WHERE guild_id = ? ORDER BY id`, guildID)
+}
+
+// DueScheduledJobs returns the jobs whose next run is at or before now
+func (s *Store) DueScheduledJobs(now time.Time) ([]ScheduledJob, error) {
+	return s.queryScheduledJobs(`SELECT id, guild_id, source_channel_id, target_channel_id, spec, hours, instructions, created_by, next_run
+		FROM scheduled_jobs WHERE next_run <= ? ORDER BY next_run`, now.UnixMilli())
+}
+
+// SetScheduledJobNextRun records when a job runs next
+func (s *Store) SetScheduledJobNextRun(id int64, next time.Time) error {
+	_, err := s.db.Exec(`UPDATE scheduled_jobs SET next_run = ? WHERE id = ?`, next.UnixMilli(), id)
+	return err
+}
+
+// DeleteScheduledJob deletes one of a guild's scheduled jobs, reporting
+// whether it existed
+func (s *Store) DeleteScheduledJob(guildID string, id int64) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM scheduled_jobs WHERE guild_id = ? AND id = ?`, guildID, id)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+// queryScheduledJobs runs a query returning scheduled jobs
+func (s *Store) queryScheduledJobs(query string, args ...any) ([]ScheduledJob, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []ScheduledJob
+	for rows.Next() {
+		var job ScheduledJob
+		var next int64
+		err := rows.Scan(&job.ID, &job.GuildID, &job.SourceChannelID, &job.TargetChannelID, &job.Spec,
+			&job.Hours, &job.Instructions, &job.CreatedBy, &next)
+		if err != nil {
+			return nil, err
+		}
+		job.NextRun = time.UnixMilli(next)
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
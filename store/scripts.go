@@ -0,0 +1,48 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// GuildScript is the script a guild's admins uploaded to shape prompts and
+// answers
+type GuildScript struct {
+	GuildID   string
+	Source    string
+	UpdatedAt time.Time
+}
+
+// SetGuildScript saves a guild's script, replacing the earlier one
+func (s *Store) SetGuildScript(g GuildScript) error {
+	_, err := s.db.Exec(`INSERT INTO guild_scripts (guild_id, source, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (guild_id) DO UPDATE SET source = excluded.source, updated_at = excluded.updated_at`,
+		g.GuildID, g.Source, g.UpdatedAt.UnixMilli())
+	return err
+}
+
+// GuildScript returns a guild's script, or nil when it has none
+func (s *Store) GuildScript(guildID string) (*GuildScript, error) {
+	g := GuildScript{GuildID: guildID}
+	var updated int64
+	err := s.db.QueryRow(`SELECT source, updated_at FROM guild_scripts WHERE guild_id = ?`, guildID).Scan(&g.Source, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	g.UpdatedAt = time.UnixMilli(updated)
+	return &g, nil
+}
+
+// DeleteGuildScript removes a guild's script, reporting whether it had one
+func (s *Store) DeleteGuildScript(guildID string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM guild_scripts WHERE guild_id = ?`, guildID)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
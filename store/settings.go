@@ -0,0 +1,84 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// GuildSettings are how the bot behaves in a guild, as its admins set it up
+// with /settings
+type GuildSettings struct {
+	GuildID string
+	// Which messages the bot answers, see the bot's trigger modes
+	Trigger string
+	// Chat model answering instead of the default, empty for the default
+	Model string
+	// How the bot should act in the guild, empty for no persona
+	Persona string
+	// Level responses are blocked at outside NSFW channels and in NSFW
+	// channels, "off" to block nothing, empty for the bot's defaults
+	Safety     string
+	NSFWSafety string
+	// Channels the bot answers messages in, all of them when empty
+	AllowedChannels []string
+	// Messages each member can have answered per minute, 0 for no limit
+	RateLimit int
+	// Language answers are written in, empty to follow the member
+	Language string
+	// Whether answers the model rated possibly harmful are hidden behind
+	// spoiler tags
+	Spoilers bool
+	// Whether emails, phone numbers, Discord tokens and invite links are
+	// redacted from messages before they're sent to the model
+	ScrubPII bool
+	// Whether members can't have the bot write polls with /poll
+	PollsDisabled bool
+	// Longest audio or video attachment in minutes, and most pages of a PDF,
+	// sent to the model; 0 for the bot's defaults
+	MaxMediaMinutes int
+	MaxPDFPages     int
+	// How long answers are: "concise" or "detailed", empty for normal
+	Verbosity string
+}
+
+// SetGuildSettings saves a guild's settings, replacing earlier ones
+func (s *Store) SetGuildSettings(g GuildSettings) error {
+	_, err := s.db.Exec(`INSERT INTO guild_settings (guild_id, trigger_mode, model, persona, safety, nsfw_safety, allowed_channels, rate_limit, language, spoilers, scrub_pii, polls_disabled, media_minutes, pdf_pages, verbosity)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (guild_id) DO UPDATE SET trigger_mode = excluded.trigger_mode, model = excluded.model,
+			persona = excluded.persona, safety = excluded.safety, nsfw_safety = excluded.nsfw_safety,
+			allowed_channels = excluded.allowed_channels, rate_limit = excluded.rate_limit,
+			language = excluded.language, spoilers = excluded.spoilers, scrub_pii = excluded.scrub_pii,
+			polls_disabled = excluded.polls_disabled, media_minutes = excluded.media_minutes, pdf_pages = excluded.pdf_pages,
+			verbosity = excluded.verbosity`,
+		g.GuildID, g.Trigger, g.Model, g.Persona, g.Safety, g.NSFWSafety, strings.Join(g.AllowedChannels, ","), g.RateLimit, g.Language, g.Spoilers, g.ScrubPII, g.PollsDisabled,
+		g.MaxMediaMinutes, g.MaxPDFPages, g.Verbosity)
+	return err
+}
+
+// GuildSettings returns a guild's settings, or nil when they were never changed
+func (s *Store) GuildSettings(guildID string) (*GuildSettings, error) {
+	g := GuildSettings{GuildID: guildID}
+	var channels string
+	err := s.db.QueryRow(`SELECT trigger_mode, model, persona, safety, nsfw_safety, allowed_channels, rate_limit, language, spoilers, scrub_pii, polls_disabled, media_minutes, pdf_pages, verbosity
+		FROM guild_settings WHERE guild_id = ?`, guildID).
+		Scan(&g.Trigger, &g.Model, &g.Persona, &g.Safety, &g.NSFWSafety, &channels, &g.RateLimit, &g.Language, &g.Spoilers, &g.ScrubPII, &g.PollsDisabled,
+			&g.MaxMediaMinutes, &g.MaxPDFPages, &g.Verbosity)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if channels != "" {
+		g.AllowedChannels = strings.Split(channels, ",")
+	}
+	return &g, nil
+}
+
+// DeleteGuildSettings resets a guild's settings to the defaults
+func (s *Store) DeleteGuildSettings(guildID string) error {
+	_, err := s.db.Exec(`DELETE FROM guild_settings WHERE guild_id = ?`, guildID)
+	return err
+}
@@ -0,0 +1,323 @@
+// Package store keeps the bot's persistent data in a local SQLite database,
+// and the state instances share in it or in Postgres or Redis.
+package store
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	_ "modernc.org/sqlite"
+)
+
+// Tables created on startup if they don't exist yet
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS kb_chunks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		guild_id TEXT NOT NULL,
+		source TEXT NOT NULL,
+		content TEXT NOT NULL,
+		embedding BLOB NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS kb_chunks_guild ON kb_chunks (guild_id)`,
+	`CREATE TABLE IF NOT EXISTS memories (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT NOT NULL,
+		fact TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS memories_user ON memories (user_id)`,
+	`CREATE TABLE IF NOT EXISTS indexed_channels (
+		channel_id TEXT PRIMARY KEY,
+		guild_id TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS message_index (
+		message_id TEXT PRIMARY KEY,
+		guild_id TEXT NOT NULL,
+		channel_id TEXT NOT NULL,
+		author TEXT NOT NULL,
+		author_id TEXT NOT NULL DEFAULT '',
+		content TEXT NOT NULL,
+		embedding BLOB NOT NULL,
+		created_at DATETIME NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS message_index_guild ON message_index (guild_id)`,
+	`CREATE TABLE IF NOT EXISTS usage (
+		day TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		guild_id TEXT NOT NULL,
+		requests INTEGER NOT NULL,
+		prompt_tokens INTEGER NOT NULL,
+		response_tokens INTEGER NOT NULL,
+		PRIMARY KEY (day, user_id, guild_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS usage_guild ON usage (guild_id, day)`,
+	`CREATE TABLE IF NOT EXISTS guild_providers (
+		guild_id TEXT PRIMARY KEY,
+		provider TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		time INTEGER NOT NULL,
+		user_id TEXT NOT NULL,
+		guild_id TEXT NOT NULL,
+		model TEXT NOT NULL,
+		prompt TEXT NOT NULL,
+		response TEXT NOT NULL,
+		finish_reason TEXT NOT NULL,
+		safety_flags TEXT NOT NULL,
+		error TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_time ON audit_log (time)`,
+	`CREATE TABLE IF NOT EXISTS answers (
+		prompt_id TEXT PRIMARY KEY,
+		channel_id TEXT NOT NULL,
+		reply_ids TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		edited_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS answers_created ON answers (created_at)`,
+	`CREATE TABLE IF NOT EXISTS prompt_templates (
+		guild_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		template TEXT NOT NULL,
+		author_id TEXT NOT NULL,
+		PRIMARY KEY (guild_id, name)
+	)`,
+	`CREATE TABLE IF NOT EXISTS scheduled_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		guild_id TEXT NOT NULL,
+		source_channel_id TEXT NOT NULL,
+		target_channel_id TEXT NOT NULL,
+		spec TEXT NOT NULL,
+		hours INTEGER NOT NULL,
+		instructions TEXT NOT NULL,
+		created_by TEXT NOT NULL,
+		next_run INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS scheduled_jobs_next_run ON scheduled_jobs (next_run)`,
+	`CREATE TABLE IF NOT EXISTS reminders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT NOT NULL,
+		guild_id TEXT NOT NULL,
+		channel_id TEXT NOT NULL,
+		text TEXT NOT NULL,
+		due_at INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS reminders_due ON reminders (due_at)`,
+	`CREATE TABLE IF NOT EXISTS event_reminders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		guild_id TEXT NOT NULL,
+		event_id TEXT NOT NULL,
+		channel_id TEXT NOT NULL,
+		created_by TEXT NOT NULL,
+		remind_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS event_reminders_due ON event_reminders (remind_at)`,
+	`CREATE TABLE IF NOT EXISTS moderated_channels (
+		channel_id TEXT PRIMARY KEY,
+		guild_id TEXT NOT NULL,
+		log_channel_id TEXT NOT NULL,
+		threshold INTEGER NOT NULL,
+		auto_delete INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS reaction_actions (
+		guild_id TEXT NOT NULL,
+		emoji TEXT NOT NULL,
+		action TEXT NOT NULL,
+		PRIMARY KEY (guild_id, emoji)
+	)`,
+	`CREATE TABLE IF NOT EXISTS welcome_settings (
+		guild_id TEXT PRIMARY KEY,
+		channel_id TEXT NOT NULL,
+		about TEXT NOT NULL,
+		template TEXT NOT NULL,
+		enabled INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_profiles (
+		channel_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		persona TEXT NOT NULL,
+		PRIMARY KEY (channel_id, name)
+	)`,
+	`CREATE TABLE IF NOT EXISTS active_chat_profiles (
+		channel_id TEXT PRIMARY KEY,
+		name TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS guild_settings (
+		guild_id TEXT PRIMARY KEY,
+		trigger_mode TEXT NOT NULL,
+		model TEXT NOT NULL,
+		persona TEXT NOT NULL,
+		safety TEXT NOT NULL,
+		allowed_channels TEXT NOT NULL,
+		rate_limit INTEGER NOT NULL,
+		language TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS quizzes (
+		channel_id TEXT PRIMARY KEY,
+		guild_id TEXT NOT NULL,
+		topic TEXT NOT NULL,
+		started_by TEXT NOT NULL,
+		current INTEGER NOT NULL,
+		message_id TEXT NOT NULL,
+		started_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS quiz_questions (
+		channel_id TEXT NOT NULL,
+		number INTEGER NOT NULL,
+		question TEXT NOT NULL,
+		options TEXT NOT NULL,
+		answer INTEGER NOT NULL,
+		PRIMARY KEY (channel_id, number)
+	)`,
+	`CREATE TABLE IF NOT EXISTS quiz_answers (
+		channel_id TEXT NOT NULL,
+		number INTEGER NOT NULL,
+		user_id TEXT NOT NULL,
+		correct INTEGER NOT NULL,
+		PRIMARY KEY (channel_id, number, user_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS characters (
+		guild_id TEXT NOT NULL,
+		name TEXT NOT NULL COLLATE NOCASE,
+		description TEXT NOT NULL,
+		greeting TEXT NOT NULL,
+		example_dialogue TEXT NOT NULL,
+		author_id TEXT NOT NULL,
+		PRIMARY KEY (guild_id, name)
+	)`,
+	`CREATE TABLE IF NOT EXISTS campaigns (
+		channel_id TEXT PRIMARY KEY,
+		guild_id TEXT NOT NULL,
+		setting TEXT NOT NULL,
+		party TEXT NOT NULL,
+		inventory TEXT NOT NULL,
+		scene TEXT NOT NULL,
+		turns INTEGER NOT NULL,
+		started_by TEXT NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS persona_tests (
+		guild_id TEXT PRIMARY KEY,
+		persona_a TEXT NOT NULL,
+		persona_b TEXT NOT NULL,
+		started_by TEXT NOT NULL,
+		started_at INTEGER NOT NULL,
+		ends_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS persona_votes (
+		message_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		guild_id TEXT NOT NULL,
+		variant TEXT NOT NULL,
+		up INTEGER NOT NULL,
+		PRIMARY KEY (message_id, user_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS persona_votes_guild ON persona_votes (guild_id)`,
+	`CREATE TABLE IF NOT EXISTS feedback (
+		message_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		guild_id TEXT NOT NULL,
+		channel_id TEXT NOT NULL,
+		up INTEGER NOT NULL,
+		prompt TEXT NOT NULL,
+		response TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		asker_id TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (message_id, user_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS feedback_guild ON feedback (guild_id, created_at)`,
+	`CREATE TABLE IF NOT EXISTS sessions (
+		key TEXT PRIMARY KEY,
+		history BLOB NOT NULL,
+		expires_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS guild_scripts (
+		guild_id TEXT PRIMARY KEY,
+		source TEXT NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`,
+}
+
+// Columns added to tables after they were first created, added on startup to
+// databases that don't have them yet
+var addedColumns = []struct {
+	table, column, definition string
+}{
+	{"message_index", "author_id", "TEXT NOT NULL DEFAULT ''"},
+	{"guild_settings", "nsfw_safety", "TEXT NOT NULL DEFAULT ''"},
+	{"guild_settings", "spoilers", "INTEGER NOT NULL DEFAULT 0"},
+	{"guild_settings", "scrub_pii", "INTEGER NOT NULL DEFAULT 0"},
+	{"guild_settings", "polls_disabled", "INTEGER NOT NULL DEFAULT 0"},
+	{"guild_settings", "media_minutes", "INTEGER NOT NULL DEFAULT 0"},
+	{"guild_settings", "pdf_pages", "INTEGER NOT NULL DEFAULT 0"},
+	{"guild_settings", "verbosity", "TEXT NOT NULL DEFAULT ''"},
+	{"feedback", "asker_id", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// Store is the bot's SQLite database
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens the SQLite database at path and creates any missing tables
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %v", err)
+	}
+	// SQLite allows a single writer at a time
+	db.SetMaxOpenConns(1)
+
+	for _, statement := range schema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error creating tables: %v", err)
+		}
+	}
+	for _, added := range addedColumns {
+		var exists bool
+		err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pragma_table_info(?) WHERE name = ?)`, added.table, added.column).Scan(&exists)
+		if err == nil && !exists {
+			_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, added.table, added.column, added.definition))
+		}
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error adding column %s.%s: %v", added.table, added.column, err)
+		}
+	}
+	return &Store{db: db}, nil
+}
+
+// Ping checks that the database can still be queried
+func (s *Store) Ping() error {
+	var one int
+	return s.db.QueryRow(`SELECT 1`).Scan(&one)
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// encodeVector packs a vector into little-endian float32s for storage
+func encodeVector(vector []float32) []byte {
+	data := make([]byte, 0, len(vector)*4)
+	for _, value := range vector {
+		data = binary.LittleEndian.AppendUint32(data, math.Float32bits(value))
+	}
+	return data
+}
+
+// decodeVector unpacks a vector stored by encodeVector
+func decodeVector(data []byte) []float32 {
+	vector := make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return vector
+}
@@ -0,0 +1,1107 @@
+package store
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go-discord-bot/audit"
+)
+
+// openTestStore opens a fresh database in a temporary directory
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	s, err := Open(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestVectorRoundTrip(t *testing.T) {
+	vector := []float32{0, 1.5, -2.25, 3e-7}
+	if got := decodeVector(encodeVector(vector)); !reflect.DeepEqual(got, vector) {
+		t.Errorf("decodeVector(encodeVector(%v)) = %v", vector, got)
+	}
+}
+
+func TestKnowledgeBase(t *testing.T) {
+	s := openTestStore(t)
+
+	err := s.AddKBSource("guild", "faq.md", []string{"one", "two"}, [][]float32{{1, 0}, {0, 1}})
+	if err != nil {
+		t.Fatalf("AddKBSource: %v", err)
+	}
+	if err := s.AddKBSource("other", "rules.md", []string{"three"}, [][]float32{{1, 1}}); err != nil {
+		t.Fatalf("AddKBSource: %v", err)
+	}
+
+	sources, err := s.KBSources("guild")
+	if err != nil {
+		t.Fatalf("KBSources: %v", err)
+	}
+	if want := []KBSource{{Name: "faq.md", Chunks: 2}}; !reflect.DeepEqual(sources, want) {
+		t.Errorf("KBSources = %v, want %v", sources, want)
+	}
+
+	chunks, err := s.KBChunks("guild")
+	if err != nil {
+		t.Fatalf("KBChunks: %v", err)
+	}
+	if len(chunks) != 2 || chunks[1].Content != "two" || !reflect.DeepEqual(chunks[1].Vector, []float32{0, 1}) {
+		t.Errorf("KBChunks = %v", chunks)
+	}
+
+	if removed, err := s.RemoveKBSource("guild", "faq.md"); err != nil || !removed {
+		t.Errorf("RemoveKBSource = %v, %v, want true", removed, err)
+	}
+	if removed, err := s.RemoveKBSource("guild", "faq.md"); err != nil || removed {
+		t.Errorf("RemoveKBSource of a removed source = %v, %v, want false", removed, err)
+	}
+	if chunks, _ := s.KBChunks("other"); len(chunks) != 1 {
+		t.Errorf("removing a source affected another guild")
+	}
+}
+
+func TestMemories(t *testing.T) {
+	s := openTestStore(t)
+
+	for _, fact := range []string{"Prefers Go", "Lives in Lisbon"} {
+		if err := s.AddMemory("user", fact, 2); err != nil {
+			t.Fatalf("AddMemory: %v", err)
+		}
+	}
+	if err := s.AddMemory("user", "Has a cat", 2); !errors.Is(err, ErrMemoryFull) {
+		t.Errorf("AddMemory over the limit = %v, want ErrMemoryFull", err)
+	}
+	if err := s.AddMemory("other", "Likes tea", 2); err != nil {
+		t.Fatalf("AddMemory: %v", err)
+	}
+
+	memories, err := s.Memories("user")
+	if err != nil {
+		t.Fatalf("Memories: %v", err)
+	}
+	if len(memories) != 2 || memories[0].Fact != "Prefers Go" || memories[1].Fact != "Lives in Lisbon" {
+		t.Fatalf("Memories = %v", memories)
+	}
+
+	// Users can only delete their own memories
+	if deleted, err := s.DeleteMemory("other", memories[0].ID); err != nil || deleted {
+		t.Errorf("DeleteMemory of another user's memory = %v, %v, want false", deleted, err)
+	}
+	if deleted, err := s.DeleteMemory("user", memories[0].ID); err != nil || !deleted {
+		t.Errorf("DeleteMemory = %v, %v, want true", deleted, err)
+	}
+
+	if err := s.DeleteMemories("user"); err != nil {
+		t.Fatalf("DeleteMemories: %v", err)
+	}
+	if memories, _ := s.Memories("user"); len(memories) != 0 {
+		t.Errorf("Memories after DeleteMemories = %v", memories)
+	}
+	if memories, _ := s.Memories("other"); len(memories) != 1 {
+		t.Errorf("DeleteMemories affected another user")
+	}
+}
+
+func TestMessageIndex(t *testing.T) {
+	s := openTestStore(t)
+
+	if indexed, err := s.IsIndexed("channel"); err != nil || indexed {
+		t.Errorf("IsIndexed before enabling = %v, %v", indexed, err)
+	}
+	if err := s.EnableIndexing("channel", "guild"); err != nil {
+		t.Fatalf("EnableIndexing: %v", err)
+	}
+	// Enabling twice is harmless
+	if err := s.EnableIndexing("channel", "guild"); err != nil {
+		t.Fatalf("EnableIndexing again: %v", err)
+	}
+	if indexed, err := s.IsIndexed("channel"); err != nil || !indexed {
+		t.Errorf("IsIndexed after enabling = %v, %v", indexed, err)
+	}
+
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	messages := []IndexedMessage{
+		{MessageID: "1", GuildID: "guild", ChannelID: "channel", Author: "alice", Content: "first", CreatedAt: createdAt, Vector: []float32{1, 0}},
+		{MessageID: "2", GuildID: "guild", ChannelID: "channel", Author: "bob", Content: "second", CreatedAt: createdAt, Vector: []float32{0, 1}},
+	}
+	if err := s.IndexMessages(messages); err != nil {
+		t.Fatalf("IndexMessages: %v", err)
+	}
+
+	indexed, err := s.IndexedMessages("guild")
+	if err != nil {
+		t.Fatalf("IndexedMessages: %v", err)
+	}
+	if len(indexed) != 2 || !indexed[0].CreatedAt.Equal(createdAt) {
+		t.Fatalf("IndexedMessages = %v", indexed)
+	}
+
+	if err := s.DeleteIndexedMessage("1"); err != nil {
+		t.Fatalf("DeleteIndexedMessage: %v", err)
+	}
+	if indexed, _ := s.IndexedMessages("guild"); len(indexed) != 1 || indexed[0].MessageID != "2" {
+		t.Errorf("IndexedMessages after delete = %v", indexed)
+	}
+
+	if err := s.DisableIndexing("channel"); err != nil {
+		t.Fatalf("DisableIndexing: %v", err)
+	}
+	if indexed, _ := s.IsIndexed("channel"); indexed {
+		t.Error("channel still indexed after DisableIndexing")
+	}
+	if indexed, _ := s.IndexedMessages("guild"); len(indexed) != 0 {
+		t.Errorf("DisableIndexing kept %d messages", len(indexed))
+	}
+}
+
+func TestPing(t *testing.T) {
+	s := openTestStore(t)
+	if err := s.Ping(); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+	s.Close()
+	if err := s.Ping(); err == nil {
+		t.Error("Ping of a closed store succeeded")
+	}
+}
+
+func TestUsage(t *testing.T) {
+	s := openTestStore(t)
+
+	may1 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	may2 := may1.Add(24 * time.Hour)
+	april := may1.AddDate(0, -1, 0)
+	for _, record := range []struct {
+		user, guild string
+		at          time.Time
+		prompt      int
+	}{
+		{"alice", "guild", may1, 100},
+		{"alice", "guild", may1, 50},
+		{"alice", "other", may2, 10},
+		{"bob", "guild", may2, 20},
+		{"alice", "guild", april, 1000},
+	} {
+		if err := s.RecordUsage(record.user, record.guild, record.at, record.prompt, 1); err != nil {
+			t.Fatalf("RecordUsage: %v", err)
+		}
+	}
+
+	if u, err := s.UserUsage("alice", may1); err != nil || u != (Usage{Requests: 3, PromptTokens: 160, ResponseTokens: 3}) {
+		t.Errorf("UserUsage since May 1 = %+v, %v", u, err)
+	}
+	if u, err := s.UserUsage("alice", may2); err != nil || u.Requests != 1 {
+		t.Errorf("UserUsage since May 2 = %+v, %v", u, err)
+	}
+	if u, err := s.GuildUsage("guild", may1); err != nil || u.Tokens() != 173 {
+		t.Errorf("GuildUsage since May 1 = %+v, %v", u, err)
+	}
+	if u, err := s.GuildUsage("empty", may1); err != nil || u != (Usage{}) {
+		t.Errorf("GuildUsage of an unknown guild = %+v, %v", u, err)
+	}
+	if u, err := s.TotalUsage(may2); err != nil || u != (Usage{Requests: 2, PromptTokens: 30, ResponseTokens: 2}) {
+		t.Errorf("TotalUsage since May 2 = %+v, %v", u, err)
+	}
+}
+
+func TestGuildProvider(t *testing.T) {
+	s := openTestStore(t)
+
+	if provider, err := s.GuildProvider("guild"); err != nil || provider != "" {
+		t.Errorf("GuildProvider before choosing = %q, %v", provider, err)
+	}
+	for _, provider := range []string{"openai", "gemini"} {
+		if err := s.SetGuildProvider("guild", provider); err != nil {
+			t.Fatalf("SetGuildProvider: %v", err)
+		}
+		if got, err := s.GuildProvider("guild"); err != nil || got != provider {
+			t.Errorf("GuildProvider = %q, %v, want %q", got, err, provider)
+		}
+	}
+}
+
+func TestAnswers(t *testing.T) {
+	s := openTestStore(t)
+
+	if answer, err := s.Answer("prompt"); err != nil || answer != nil {
+		t.Errorf("Answer before saving = %v, %v", answer, err)
+	}
+	now := time.UnixMilli(time.Now().UnixMilli())
+	answers := []Answer{
+		{PromptID: "prompt", ChannelID: "channel", ReplyIDs: []string{"one"}, CreatedAt: now},
+		{PromptID: "prompt", ChannelID: "channel", ReplyIDs: []string{"two", "three"}, CreatedAt: now, EditedAt: now.Add(time.Minute)},
+	}
+	for _, answer := range answers {
+		if err := s.SaveAnswer(answer); err != nil {
+			t.Fatalf("SaveAnswer: %v", err)
+		}
+		if got, err := s.Answer("prompt"); err != nil || got == nil || !reflect.DeepEqual(*got, answer) {
+			t.Errorf("Answer = %+v, %v, want %+v", got, err, answer)
+		}
+	}
+
+	if err := s.DeleteAnswer("prompt"); err != nil {
+		t.Fatalf("DeleteAnswer: %v", err)
+	}
+	if answer, err := s.Answer("prompt"); err != nil || answer != nil {
+		t.Errorf("Answer after deleting = %v, %v", answer, err)
+	}
+
+	if err := s.SaveAnswer(answers[0]); err != nil {
+		t.Fatalf("SaveAnswer: %v", err)
+	}
+	if deleted, err := s.DeleteAnswersBefore(now); err != nil || deleted != 0 {
+		t.Errorf("DeleteAnswersBefore(now) = %d, %v, want 0", deleted, err)
+	}
+	if deleted, err := s.DeleteAnswersBefore(now.Add(time.Second)); err != nil || deleted != 1 {
+		t.Errorf("DeleteAnswersBefore(later) = %d, %v, want 1", deleted, err)
+	}
+}
+
+func TestPromptTemplates(t *testing.T) {
+	s := openTestStore(t)
+
+	if template, err := s.PromptTemplate("guild", "standup"); err != nil || template != nil {
+		t.Errorf("PromptTemplate before saving = %v, %v", template, err)
+	}
+	templates := []PromptTemplate{
+		{GuildID: "guild", Name: "standup", Template: "Summarize: {input}", AuthorID: "alice"},
+		{GuildID: "guild", Name: "eli5", Template: "Explain simply: {input}", AuthorID: "bob"},
+	}
+	for _, template := range templates {
+		if err := s.SavePromptTemplate(template, 2); err != nil {
+			t.Fatalf("SavePromptTemplate: %v", err)
+		}
+	}
+
+	// Replacing a template doesn't count against the limit, adding one does
+	templates[0].Template = "Summarize for the team: {input}"
+	if err := s.SavePromptTemplate(templates[0], 2); err != nil {
+		t.Fatalf("SavePromptTemplate replacing: %v", err)
+	}
+	err := s.SavePromptTemplate(PromptTemplate{GuildID: "guild", Name: "third", Template: "{input}"}, 2)
+	if !errors.Is(err, ErrTemplatesFull) {
+		t.Errorf("SavePromptTemplate over the limit = %v, want ErrTemplatesFull", err)
+	}
+
+	got, err := s.PromptTemplates("guild")
+	if want := []PromptTemplate{templates[1], templates[0]}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("PromptTemplates = %+v, %v, want %+v", got, err, want)
+	}
+	if got, err := s.PromptTemplates("other"); err != nil || len(got) != 0 {
+		t.Errorf("PromptTemplates of another guild = %+v, %v", got, err)
+	}
+}
+
+func TestScheduledJobs(t *testing.T) {
+	s := openTestStore(t)
+
+	now := time.UnixMilli(time.Now().UnixMilli())
+	jobs := []ScheduledJob{
+		{GuildID: "guild", SourceChannelID: "general", TargetChannelID: "digest", Spec: "0 9 * * *", Hours: 24, CreatedBy: "alice", NextRun: now},
+		{GuildID: "guild", SourceChannelID: "dev", TargetChannelID: "digest", Spec: "@weekly", Hours: 168, Instructions: "Bullet points", CreatedBy: "bob", NextRun: now.Add(time.Hour)},
+	}
+	for n := range jobs {
+		id, err := s.AddScheduledJob(jobs[n], 2)
+		if err != nil {
+			t.Fatalf("AddScheduledJob: %v", err)
+		}
+		jobs[n].ID = id
+	}
+	if _, err := s.AddScheduledJob(jobs[0], 2); !errors.Is(err, ErrSchedulesFull) {
+		t.Errorf("AddScheduledJob over the limit = %v, want ErrSchedulesFull", err)
+	}
+
+	if got, err := s.ScheduledJobs("guild"); err != nil || !reflect.DeepEqual(got, jobs) {
+		t.Errorf("ScheduledJobs = %+v, %v, want %+v", got, err, jobs)
+	}
+	if got, err := s.DueScheduledJobs(now); err != nil || !reflect.DeepEqual(got, jobs[:1]) {
+		t.Errorf("DueScheduledJobs = %+v, %v, want the first job", got, err)
+	}
+
+	if err := s.SetScheduledJobNextRun(jobs[0].ID, now.Add(24*time.Hour)); err != nil {
+		t.Fatalf("SetScheduledJobNextRun: %v", err)
+	}
+	if got, err := s.DueScheduledJobs(now); err != nil || len(got) != 0 {
+		t.Errorf("DueScheduledJobs after rescheduling = %+v, %v", got, err)
+	}
+
+	if deleted, err := s.DeleteScheduledJob("other", jobs[0].ID); err != nil || deleted {
+		t.Errorf("DeleteScheduledJob from another guild = %v, %v", deleted, err)
+	}
+	if deleted, err := s.DeleteScheduledJob("guild", jobs[0].ID); err != nil || !deleted {
+		t.Errorf("DeleteScheduledJob = %v, %v", deleted, err)
+	}
+	if got, err := s.ScheduledJobs("guild"); err != nil || len(got) != 1 {
+		t.Errorf("ScheduledJobs after deleting = %+v, %v", got, err)
+	}
+}
+
+func TestReminders(t *testing.T) {
+	s := openTestStore(t)
+
+	now := time.UnixMilli(time.Now().UnixMilli())
+	reminders := []Reminder{
+		{UserID: "alice", GuildID: "guild", ChannelID: "channel", Text: "stand up", DueAt: now.Add(time.Hour), CreatedAt: now},
+		{UserID: "alice", ChannelID: "dm-alice", Text: "call mom", DueAt: now, CreatedAt: now},
+	}
+	for n := range reminders {
+		id, err := s.AddReminder(reminders[n], 2)
+		if err != nil {
+			t.Fatalf("AddReminder: %v", err)
+		}
+		reminders[n].ID = id
+	}
+	if _, err := s.AddReminder(reminders[0], 2); !errors.Is(err, ErrRemindersFull) {
+		t.Errorf("AddReminder over the limit = %v, want ErrRemindersFull", err)
+	}
+
+	if got, err := s.UserReminders("alice"); err != nil || !reflect.DeepEqual(got, []Reminder{reminders[1], reminders[0]}) {
+		t.Errorf("UserReminders = %+v, %v, want soonest first", got, err)
+	}
+	if got, err := s.DueReminders(now); err != nil || !reflect.DeepEqual(got, reminders[1:]) {
+		t.Errorf("DueReminders = %+v, %v, want the DM reminder", got, err)
+	}
+	if err := s.DeleteReminder(reminders[1].ID); err != nil {
+		t.Fatalf("DeleteReminder: %v", err)
+	}
+	if got, err := s.DueReminders(now); err != nil || len(got) != 0 {
+		t.Errorf("DueReminders after deleting = %+v, %v", got, err)
+	}
+}
+
+func TestEventReminders(t *testing.T) {
+	s := openTestStore(t)
+
+	now := time.UnixMilli(time.Now().UnixMilli())
+	reminders := []EventReminder{
+		{GuildID: "guild", EventID: "later", ChannelID: "channel", CreatedBy: "alice", RemindAt: now.Add(time.Hour)},
+		{GuildID: "guild", EventID: "soon", ChannelID: "channel", CreatedBy: "alice", RemindAt: now},
+	}
+	for n := range reminders {
+		id, err := s.AddEventReminder(reminders[n])
+		if err != nil {
+			t.Fatalf("AddEventReminder: %v", err)
+		}
+		reminders[n].ID = id
+	}
+
+	if got, err := s.DueEventReminders(now); err != nil || !reflect.DeepEqual(got, reminders[1:]) {
+		t.Errorf("DueEventReminders = %+v, %v, want the one due now", got, err)
+	}
+	if err := s.DeleteEventReminder(reminders[1].ID); err != nil {
+		t.Fatalf("DeleteEventReminder: %v", err)
+	}
+	if got, err := s.DueEventReminders(now.Add(time.Hour)); err != nil || !reflect.DeepEqual(got, reminders[:1]) {
+		t.Errorf("DueEventReminders after deleting = %+v, %v", got, err)
+	}
+}
+
+func TestModeratedChannels(t *testing.T) {
+	s := openTestStore(t)
+
+	if c, err := s.ModeratedChannel("channel"); err != nil || c != nil {
+		t.Errorf("ModeratedChannel before enabling = %+v, %v", c, err)
+	}
+	settings := []ModeratedChannel{
+		{ChannelID: "channel", GuildID: "guild", LogChannelID: "modlog", Threshold: 70},
+		{ChannelID: "channel", GuildID: "guild", LogChannelID: "other-log", Threshold: 50, AutoDelete: true},
+	}
+	for _, c := range settings {
+		if err := s.SetModeratedChannel(c); err != nil {
+			t.Fatalf("SetModeratedChannel: %v", err)
+		}
+		if got, err := s.ModeratedChannel("channel"); err != nil || got == nil || *got != c {
+			t.Errorf("ModeratedChannel = %+v, %v, want %+v", got, err, c)
+		}
+	}
+
+	if deleted, err := s.DeleteModeratedChannel("channel"); err != nil || !deleted {
+		t.Errorf("DeleteModeratedChannel = %v, %v", deleted, err)
+	}
+	if deleted, err := s.DeleteModeratedChannel("channel"); err != nil || deleted {
+		t.Errorf("DeleteModeratedChannel again = %v, %v", deleted, err)
+	}
+	if c, err := s.ModeratedChannel("channel"); err != nil || c != nil {
+		t.Errorf("ModeratedChannel after disabling = %+v, %v", c, err)
+	}
+}
+
+func TestWelcomeSettings(t *testing.T) {
+	s := openTestStore(t)
+
+	if w, err := s.WelcomeSettings("guild"); err != nil || w != nil {
+		t.Errorf("WelcomeSettings before setting up = %+v, %v", w, err)
+	}
+	if found, err := s.SetWelcomeEnabled("guild", true); err != nil || found {
+		t.Errorf("SetWelcomeEnabled before setting up = %v, %v", found, err)
+	}
+
+	settings := WelcomeSettings{GuildID: "guild", ChannelID: "welcome", About: "A Go community. Be kind.", Template: "Short and cheerful", Enabled: true}
+	if err := s.SetWelcomeSettings(settings); err != nil {
+		t.Fatalf("SetWelcomeSettings: %v", err)
+	}
+	if found, err := s.SetWelcomeEnabled("guild", false); err != nil || !found {
+		t.Errorf("SetWelcomeEnabled = %v, %v", found, err)
+	}
+	settings.Enabled = false
+	if got, err := s.WelcomeSettings("guild"); err != nil || got == nil || *got != settings {
+		t.Errorf("WelcomeSettings = %+v, %v, want %+v", got, err, settings)
+	}
+}
+
+func TestGuildSettings(t *testing.T) {
+	s := openTestStore(t)
+
+	if g, err := s.GuildSettings("guild"); err != nil || g != nil {
+		t.Errorf("GuildSettings before changing any = %+v, %v", g, err)
+	}
+
+	settings := GuildSettings{GuildID: "guild", Trigger: "mention", Model: "gemini-1.5-flash", Persona: "A pirate",
+		Safety: "medium", NSFWSafety: "off", AllowedChannels: []string{"general", "help"}, RateLimit: 5, Language: "French", Spoilers: true, ScrubPII: true, PollsDisabled: true,
+		MaxMediaMinutes: 10, MaxPDFPages: 50, Verbosity: "concise"}
+	if err := s.SetGuildSettings(settings); err != nil {
+		t.Fatalf("SetGuildSettings: %v", err)
+	}
+	settings.AllowedChannels = nil
+	settings.RateLimit = 0
+	if err := s.SetGuildSettings(settings); err != nil {
+		t.Fatalf("SetGuildSettings again: %v", err)
+	}
+	if got, err := s.GuildSettings("guild"); err != nil || !reflect.DeepEqual(got, &settings) {
+		t.Errorf("GuildSettings = %+v, %v, want %+v", got, err, settings)
+	}
+
+	if err := s.DeleteGuildSettings("guild"); err != nil {
+		t.Fatalf("DeleteGuildSettings: %v", err)
+	}
+	if g, err := s.GuildSettings("guild"); err != nil || g != nil {
+		t.Errorf("GuildSettings after resetting = %+v, %v", g, err)
+	}
+}
+
+func TestReactionActions(t *testing.T) {
+	s := openTestStore(t)
+
+	actions := []ReactionAction{
+		{GuildID: "guild", Emoji: "📌", Action: "summarize"},
+		{GuildID: "guild", Emoji: "🌐", Action: "translate"},
+		{GuildID: "guild", Emoji: "gopher:123", Action: "explain"},
+		{GuildID: "guild", Emoji: "📌", Action: "explain"},
+	}
+	for _, r := range actions {
+		if err := s.SetReactionAction(r); err != nil {
+			t.Fatalf("SetReactionAction: %v", err)
+		}
+	}
+	if action, err := s.ReactionActionFor("guild", "📌"); err != nil || action != "explain" {
+		t.Errorf("ReactionActionFor = %q, %v, want the replaced action", action, err)
+	}
+	if action, err := s.ReactionActionFor("other", "📌"); err != nil || action != "" {
+		t.Errorf("ReactionActionFor in another guild = %q, %v", action, err)
+	}
+	want := []ReactionAction{actions[2], actions[3], actions[1]}
+	if got, err := s.ReactionActions("guild"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ReactionActions = %+v, %v, want %+v", got, err, want)
+	}
+
+	if deleted, err := s.DeleteReactionAction("guild", "📌"); err != nil || !deleted {
+		t.Errorf("DeleteReactionAction = %v, %v", deleted, err)
+	}
+	if action, err := s.ReactionActionFor("guild", "📌"); err != nil || action != "" {
+		t.Errorf("ReactionActionFor after deleting = %q, %v", action, err)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	s := openTestStore(t)
+	sink := s.AuditSink()
+
+	now := time.Now().Truncate(time.Millisecond)
+	old := audit.Entry{Time: now.Add(-48 * time.Hour), UserID: "user", Prompt: "old"}
+	recent := audit.Entry{
+		Time:         now,
+		UserID:       "user",
+		GuildID:      "guild",
+		Model:        "gemini",
+		Prompt:       "hi",
+		Response:     "hello",
+		FinishReason: "SAFETY",
+		SafetyFlags:  []string{"HARASSMENT: HIGH", "HATE_SPEECH: MEDIUM"},
+	}
+	for _, e := range []audit.Entry{old, recent} {
+		if err := sink.Write(e); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	deleted, err := sink.Prune(now.Add(-24 * time.Hour))
+	if err != nil || deleted != 1 {
+		t.Fatalf("Prune = %d, %v, want 1 deleted", deleted, err)
+	}
+	entries, err := s.AuditEntries(time.Time{})
+	if err != nil {
+		t.Fatalf("AuditEntries: %v", err)
+	}
+	if len(entries) != 1 || !reflect.DeepEqual(entries[0], recent) {
+		t.Errorf("entries = %+v, want only %+v", entries, recent)
+	}
+
+	if entries, err := sink.UserEntries("user"); err != nil || len(entries) != 1 {
+		t.Errorf("UserEntries = %+v, %v, want 1 entry", entries, err)
+	}
+	if deleted, err := sink.Forget("user"); err != nil || deleted != 1 {
+		t.Errorf("Forget = %d, %v, want 1 deleted", deleted, err)
+	}
+}
+
+func TestForgetUser(t *testing.T) {
+	s := openTestStore(t)
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	if err := s.AddMemory("alice", "likes Go", 10); err != nil {
+		t.Fatalf("AddMemory: %v", err)
+	}
+	for _, user := range []string{"alice", "bob"} {
+		if err := s.RecordUsage(user, "guild", day, 10, 5); err != nil {
+			t.Fatalf("RecordUsage: %v", err)
+		}
+	}
+	err := s.IndexMessages([]IndexedMessage{
+		{MessageID: "1", GuildID: "guild", ChannelID: "c", Author: "alice", AuthorID: "alice", Content: "hi", CreatedAt: day},
+		{MessageID: "2", GuildID: "guild", ChannelID: "c", Author: "alice_name", Content: "older", CreatedAt: day},
+		{MessageID: "3", GuildID: "guild", ChannelID: "c", Author: "bob", AuthorID: "bob", Content: "hey", CreatedAt: day},
+	})
+	if err != nil {
+		t.Fatalf("IndexMessages: %v", err)
+	}
+	if err := s.SavePromptTemplate(PromptTemplate{GuildID: "guild", Name: "tldr", Template: "{input}", AuthorID: "alice"}, 10); err != nil {
+		t.Fatalf("SavePromptTemplate: %v", err)
+	}
+	if _, err := s.AddReminder(Reminder{UserID: "alice", ChannelID: "c", Text: "stretch", DueAt: day, CreatedAt: day}, 10); err != nil {
+		t.Fatalf("AddReminder: %v", err)
+	}
+	// Bob votes on the answer to Alice's prompt, Alice on Bob's
+	for _, f := range []Feedback{
+		{GuildID: "guild", ChannelID: "c", MessageID: "a1", UserID: "bob", AskerID: "alice", Up: true, Prompt: "Hi", Response: "Hello", CreatedAt: day},
+		{GuildID: "guild", ChannelID: "c", MessageID: "a2", UserID: "alice", AskerID: "bob", Prompt: "Yo", Response: "Hey", CreatedAt: day},
+		{GuildID: "guild", ChannelID: "c", MessageID: "a3", UserID: "carol", AskerID: "bob", Prompt: "Sup", Response: "Hi", CreatedAt: day},
+	} {
+		if err := s.RecordFeedback(f); err != nil {
+			t.Fatalf("RecordFeedback: %v", err)
+		}
+	}
+	if _, err := s.AnswerQuiz("c", 0, "alice", true); err != nil {
+		t.Fatalf("AnswerQuiz: %v", err)
+	}
+	if err := s.RecordPersonaVote("guild", "a1", "alice", "b", false); err != nil {
+		t.Fatalf("RecordPersonaVote: %v", err)
+	}
+	if err := s.SaveCharacter(Character{GuildID: "guild", Name: "Sherlock", Description: "A detective", Greeting: "Hello", AuthorID: "alice"}, 10); err != nil {
+		t.Fatalf("SaveCharacter: %v", err)
+	}
+	if err := s.StartCampaign(Campaign{ChannelID: "c", GuildID: "guild", Setting: "A dungeon", Party: []string{"Alice the bard"}, StartedBy: "alice", UpdatedAt: day}); err != nil {
+		t.Fatalf("StartCampaign: %v", err)
+	}
+
+	data, err := s.UserData("alice", "alice_name")
+	if err != nil {
+		t.Fatalf("UserData: %v", err)
+	}
+	if len(data.Memories) != 1 || len(data.Usage) != 1 || data.Usage[0].Tokens() != 15 || len(data.Messages) != 2 || len(data.PromptTemplates) != 1 || len(data.Reminders) != 1 {
+		t.Errorf("UserData = %+v, want 1 memory, 1 usage day, 2 messages, 1 template and 1 reminder", data)
+	}
+	if len(data.Feedback) != 2 || data.Feedback[0].MessageID != "a1" || data.Feedback[1].MessageID != "a2" {
+		t.Errorf("feedback = %+v, want the vote on Alice's prompt and Alice's vote", data.Feedback)
+	}
+	if len(data.QuizAnswers) != 1 || !data.QuizAnswers[0].Correct || len(data.PersonaVotes) != 1 || data.PersonaVotes[0].Variant != "b" {
+		t.Errorf("quiz answers = %+v, persona votes = %+v", data.QuizAnswers, data.PersonaVotes)
+	}
+	if len(data.Characters) != 1 || data.Characters[0].Name != "Sherlock" || len(data.Campaigns) != 1 || data.Campaigns[0].Party[0] != "Alice the bard" {
+		t.Errorf("characters = %+v, campaigns = %+v", data.Characters, data.Campaigns)
+	}
+
+	if err := s.ForgetUser("alice", "alice_name"); err != nil {
+		t.Fatalf("ForgetUser: %v", err)
+	}
+	data, err = s.UserData("alice", "alice_name")
+	if err != nil {
+		t.Fatalf("UserData: %v", err)
+	}
+	if len(data.Memories) != 0 || len(data.Usage) != 0 || len(data.Messages) != 0 || len(data.PromptTemplates) != 0 || len(data.Reminders) != 0 ||
+		len(data.Feedback) != 0 || len(data.QuizAnswers) != 0 || len(data.PersonaVotes) != 0 || len(data.Characters) != 0 || len(data.Campaigns) != 0 {
+		t.Errorf("UserData after ForgetUser = %+v, want nothing", data)
+	}
+	if feedback, err := s.GuildFeedback("guild", 10); err != nil || len(feedback) != 1 || feedback[0].UserID != "carol" {
+		t.Errorf("GuildFeedback = %+v, %v, want only the vote on Bob's prompt by Carol kept", feedback, err)
+	}
+
+	// The guild's usage and templates, and other users' messages stay
+	if template, err := s.PromptTemplate("guild", "tldr"); err != nil || template == nil || template.AuthorID != "" {
+		t.Errorf("PromptTemplate = %+v, %v, want it kept without an author", template, err)
+	}
+	if usage, err := s.GuildUsage("guild", day); err != nil || usage.Tokens() != 30 {
+		t.Errorf("GuildUsage = %+v, %v, want 30 tokens", usage, err)
+	}
+	if messages, err := s.IndexedMessages("guild"); err != nil || len(messages) != 1 {
+		t.Errorf("IndexedMessages = %d messages, %v, want 1", len(messages), err)
+	}
+}
+
+func TestChatProfiles(t *testing.T) {
+	s := openTestStore(t)
+
+	if p, err := s.ActiveChatProfile("channel"); err != nil || p != nil {
+		t.Errorf("ActiveChatProfile before switching = %+v, %v", p, err)
+	}
+	profiles := []ChatProfile{
+		{ChannelID: "channel", Name: "coding", Persona: "A terse senior Go reviewer"},
+		{ChannelID: "channel", Name: "dnd", Persona: "A dramatic dungeon master"},
+	}
+	for _, p := range profiles {
+		if err := s.SaveChatProfile(p, 2); err != nil {
+			t.Fatalf("SaveChatProfile: %v", err)
+		}
+	}
+	// Replacing a profile doesn't count against the limit, adding one does
+	profiles[0].Persona = "A patient Go mentor"
+	if err := s.SaveChatProfile(profiles[0], 2); err != nil {
+		t.Fatalf("SaveChatProfile replacing: %v", err)
+	}
+	if err := s.SaveChatProfile(ChatProfile{ChannelID: "channel", Name: "third"}, 2); !errors.Is(err, ErrProfilesFull) {
+		t.Errorf("SaveChatProfile over the limit = %v, want ErrProfilesFull", err)
+	}
+	if got, err := s.ChatProfiles("channel"); err != nil || !reflect.DeepEqual(got, profiles) {
+		t.Errorf("ChatProfiles = %+v, %v, want %+v", got, err, profiles)
+	}
+
+	if err := s.SetActiveChatProfile("channel", "coding"); err != nil {
+		t.Fatalf("SetActiveChatProfile: %v", err)
+	}
+	if got, err := s.ActiveChatProfile("channel"); err != nil || got == nil || *got != profiles[0] {
+		t.Errorf("ActiveChatProfile = %+v, %v, want %+v", got, err, profiles[0])
+	}
+	if got, err := s.ActiveChatProfile("other"); err != nil || got != nil {
+		t.Errorf("ActiveChatProfile of another channel = %+v, %v", got, err)
+	}
+
+	// Deleting the active profile switches back to the default conversation
+	if found, err := s.DeleteChatProfile("channel", "coding"); err != nil || !found {
+		t.Errorf("DeleteChatProfile = %v, %v", found, err)
+	}
+	if found, err := s.DeleteChatProfile("channel", "coding"); err != nil || found {
+		t.Errorf("DeleteChatProfile again = %v, %v", found, err)
+	}
+	if got, err := s.ActiveChatProfile("channel"); err != nil || got != nil {
+		t.Errorf("ActiveChatProfile after deleting it = %+v, %v", got, err)
+	}
+}
+
+func TestQuizzes(t *testing.T) {
+	s := openTestStore(t)
+
+	if q, err := s.Quiz("channel"); err != nil || q != nil {
+		t.Errorf("Quiz before starting = %+v, %v", q, err)
+	}
+	quiz := Quiz{
+		ChannelID: "channel", GuildID: "guild", Topic: "Go", StartedBy: "alice",
+		Questions: []QuizQuestion{
+			{Question: "Who made Go?", Options: []string{"Google", "Mozilla"}, Answer: 0},
+			{Question: "Go's mascot?", Options: []string{"Crab", "Gopher", "Camel"}, Answer: 1},
+		},
+		StartedAt: time.UnixMilli(1700000000000),
+	}
+	if err := s.StartQuiz(quiz); err != nil {
+		t.Fatalf("StartQuiz: %v", err)
+	}
+	if err := s.StartQuiz(quiz); !errors.Is(err, ErrQuizRunning) {
+		t.Errorf("StartQuiz twice = %v, want ErrQuizRunning", err)
+	}
+	if err := s.SetQuizQuestion("channel", 1, "message"); err != nil {
+		t.Fatalf("SetQuizQuestion: %v", err)
+	}
+	quiz.Current, quiz.MessageID = 1, "message"
+	if got, err := s.Quiz("channel"); err != nil || !reflect.DeepEqual(got, &quiz) {
+		t.Errorf("Quiz = %+v, %v, want %+v", got, err, quiz)
+	}
+
+	answers := []struct {
+		number  int
+		userID  string
+		correct bool
+		want    bool
+	}{
+		{0, "alice", true, true},
+		{0, "bob", false, true},
+		{0, "bob", true, false},
+		{1, "alice", false, true},
+		{1, "bob", true, true},
+		{1, "carol", true, true},
+	}
+	for _, answer := range answers {
+		if recorded, err := s.AnswerQuiz("channel", answer.number, answer.userID, answer.correct); err != nil || recorded != answer.want {
+			t.Errorf("AnswerQuiz(%d, %s) = %v, %v, want %v", answer.number, answer.userID, recorded, err, answer.want)
+		}
+	}
+	want := []QuizScore{{"carol", 1, 1}, {"alice", 1, 2}, {"bob", 1, 2}}
+	if scores, err := s.QuizScores("channel"); err != nil || !reflect.DeepEqual(scores, want) {
+		t.Errorf("QuizScores = %+v, %v, want %+v", scores, err, want)
+	}
+
+	if err := s.EndQuiz("channel"); err != nil {
+		t.Fatalf("EndQuiz: %v", err)
+	}
+	if q, err := s.Quiz("channel"); err != nil || q != nil {
+		t.Errorf("Quiz after ending = %+v, %v", q, err)
+	}
+	if scores, err := s.QuizScores("channel"); err != nil || len(scores) != 0 {
+		t.Errorf("QuizScores after ending = %+v, %v", scores, err)
+	}
+}
+
+func TestCharacters(t *testing.T) {
+	s := openTestStore(t)
+
+	wizard := Character{GuildID: "guild", Name: "Gandalf", Description: "A wise wizard", Greeting: "A wizard is never late.", AuthorID: "alice"}
+	if err := s.SaveCharacter(wizard, 2); err != nil {
+		t.Fatalf("SaveCharacter: %v", err)
+	}
+	if err := s.SaveCharacter(Character{GuildID: "guild", Name: "Pirate", Greeting: "Arr", AuthorID: "bob"}, 2); err != nil {
+		t.Fatalf("SaveCharacter: %v", err)
+	}
+	if err := s.SaveCharacter(Character{GuildID: "guild", Name: "Third"}, 2); !errors.Is(err, ErrCharactersFull) {
+		t.Errorf("SaveCharacter over the limit = %v, want ErrCharactersFull", err)
+	}
+
+	// Names are matched regardless of case, replacing keeps the new spelling
+	wizard.Name, wizard.ExampleDialogue = "GANDALF", "User: Hi\nGandalf: Fly, you fools!"
+	if err := s.SaveCharacter(wizard, 2); err != nil {
+		t.Fatalf("SaveCharacter replacing: %v", err)
+	}
+	if got, err := s.Character("guild", "gandalf"); err != nil || got == nil || *got != wizard {
+		t.Errorf("Character = %+v, %v, want %+v", got, err, wizard)
+	}
+	if got, err := s.Character("other", "gandalf"); err != nil || got != nil {
+		t.Errorf("Character of another guild = %+v, %v", got, err)
+	}
+	if got, err := s.Characters("guild"); err != nil || len(got) != 2 || got[0] != wizard {
+		t.Errorf("Characters = %+v, %v", got, err)
+	}
+
+	if found, err := s.DeleteCharacter("guild", "pirate"); err != nil || !found {
+		t.Errorf("DeleteCharacter = %v, %v", found, err)
+	}
+	if found, err := s.DeleteCharacter("guild", "pirate"); err != nil || found {
+		t.Errorf("DeleteCharacter again = %v, %v", found, err)
+	}
+}
+
+func TestCampaigns(t *testing.T) {
+	s := openTestStore(t)
+
+	if c, err := s.Campaign("channel"); err != nil || c != nil {
+		t.Errorf("Campaign before starting = %+v, %v", c, err)
+	}
+	campaign := Campaign{ChannelID: "channel", GuildID: "guild", Setting: "A haunted forest", StartedBy: "alice", UpdatedAt: time.UnixMilli(1700000000000)}
+	if err := s.StartCampaign(campaign); err != nil {
+		t.Fatalf("StartCampaign: %v", err)
+	}
+	if err := s.StartCampaign(campaign); !errors.Is(err, ErrCampaignRunning) {
+		t.Errorf("StartCampaign twice = %v, want ErrCampaignRunning", err)
+	}
+	if got, err := s.Campaign("channel"); err != nil || !reflect.DeepEqual(got, &campaign) {
+		t.Errorf("Campaign = %+v, %v, want %+v", got, err, campaign)
+	}
+
+	campaign.Party = []string{"Aria (alice): elf ranger", "Bram (bob): dwarf cleric"}
+	campaign.Inventory = []string{"Rope", "3 torches"}
+	campaign.Scene, campaign.Turns, campaign.UpdatedAt = "At the forest's edge", 1, time.UnixMilli(1700000060000)
+	if err := s.UpdateCampaign(campaign); err != nil {
+		t.Fatalf("UpdateCampaign: %v", err)
+	}
+	if got, err := s.Campaign("channel"); err != nil || !reflect.DeepEqual(got, &campaign) {
+		t.Errorf("Campaign after updating = %+v, %v, want %+v", got, err, campaign)
+	}
+
+	if ended, err := s.EndCampaign("channel"); err != nil || !ended {
+		t.Errorf("EndCampaign = %v, %v", ended, err)
+	}
+	if ended, err := s.EndCampaign("channel"); err != nil || ended {
+		t.Errorf("EndCampaign again = %v, %v", ended, err)
+	}
+}
+
+func TestPersonaTests(t *testing.T) {
+	s := openTestStore(t)
+
+	if test, err := s.PersonaTest("guild"); err != nil || test != nil {
+		t.Errorf("PersonaTest before starting = %+v, %v", test, err)
+	}
+	start := time.UnixMilli(1700000000000)
+	test := PersonaTest{GuildID: "guild", PersonaA: "Be formal", PersonaB: "Be playful", StartedBy: "alice",
+		StartedAt: start, EndsAt: start.Add(7 * 24 * time.Hour)}
+	if err := s.StartPersonaTest(test); err != nil {
+		t.Fatalf("StartPersonaTest: %v", err)
+	}
+	if got, err := s.PersonaTest("guild"); err != nil || !reflect.DeepEqual(got, &test) {
+		t.Errorf("PersonaTest = %+v, %v, want %+v", got, err, test)
+	}
+
+	// A user's vote on an answer replaces their earlier one
+	for _, vote := range []struct {
+		message, user, variant string
+		up                     bool
+	}{
+		{"m1", "alice", VariantA, false}, {"m1", "alice", VariantA, true}, {"m1", "bob", VariantA, true},
+		{"m2", "alice", VariantB, false},
+	} {
+		if err := s.RecordPersonaVote("guild", vote.message, vote.user, vote.variant, vote.up); err != nil {
+			t.Fatalf("RecordPersonaVote: %v", err)
+		}
+	}
+	want := map[string]PersonaVotes{VariantA: {Up: 2}, VariantB: {Down: 1}}
+	if got, err := s.PersonaTestVotes("guild"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("PersonaTestVotes = %+v, %v, want %+v", got, err, want)
+	}
+
+	if ended, err := s.EndPersonaTest("guild", start.Add(time.Hour)); err != nil || !ended {
+		t.Errorf("EndPersonaTest = %v, %v", ended, err)
+	}
+	if ended, err := s.EndPersonaTest("guild", start.Add(2*time.Hour)); err != nil || ended {
+		t.Errorf("EndPersonaTest again = %v, %v", ended, err)
+	}
+	if got, err := s.PersonaTest("guild"); err != nil || got.Running(start.Add(2*time.Hour)) {
+		t.Errorf("PersonaTest after ending = %+v, %v, want it ended", got, err)
+	}
+
+	// Starting a new test drops the votes of the last one
+	if err := s.StartPersonaTest(test); err != nil {
+		t.Fatalf("StartPersonaTest again: %v", err)
+	}
+	if got, err := s.PersonaTestVotes("guild"); err != nil || len(got) != 0 {
+		t.Errorf("PersonaTestVotes of a new test = %+v, %v", got, err)
+	}
+}
+
+func TestFeedback(t *testing.T) {
+	s := openTestStore(t)
+
+	day := time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC)
+	votes := []Feedback{
+		{GuildID: "guild", ChannelID: "channel", MessageID: "m1", UserID: "alice", Up: false, Prompt: "Hi", Response: "Hello", CreatedAt: day},
+		{GuildID: "guild", ChannelID: "channel", MessageID: "m1", UserID: "alice", Up: true, Prompt: "Hi", Response: "Hello", CreatedAt: day},
+		{GuildID: "guild", ChannelID: "channel", MessageID: "m1", UserID: "bob", Up: false, Prompt: "Hi", Response: "Hello", CreatedAt: day},
+		{GuildID: "guild", ChannelID: "channel", MessageID: "m2", UserID: "bob", AskerID: "alice", Up: true, Prompt: "Bye", Response: "See you", CreatedAt: day.Add(24 * time.Hour)},
+		{GuildID: "other", ChannelID: "elsewhere", MessageID: "m3", UserID: "bob", Up: true, CreatedAt: day},
+	}
+	for _, f := range votes {
+		if err := s.RecordFeedback(f); err != nil {
+			t.Fatalf("RecordFeedback: %v", err)
+		}
+	}
+
+	want := []FeedbackDay{{Day: "2024-05-31", Up: 1, Down: 1}, {Day: "2024-06-01", Up: 1}}
+	if got, err := s.FeedbackByDay("guild", day.Add(-time.Hour)); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("FeedbackByDay = %+v, %v, want %+v", got, err, want)
+	}
+	if got, err := s.FeedbackByDay("guild", day.Add(time.Hour)); err != nil || len(got) != 1 {
+		t.Errorf("FeedbackByDay since the second day = %+v, %v", got, err)
+	}
+	got, err := s.GuildFeedback("guild", 2)
+	if err != nil || len(got) != 2 || got[0].MessageID != "m2" || got[0].AskerID != "alice" || !got[1].CreatedAt.Equal(day) {
+		t.Fatalf("GuildFeedback = %+v, %v, want the latest two votes", got, err)
+	}
+
+	if err := s.ForgetUser("bob", "bob"); err != nil {
+		t.Fatalf("ForgetUser: %v", err)
+	}
+	if got, err := s.GuildFeedback("guild", 10); err != nil || len(got) != 1 || got[0].UserID != "alice" {
+		t.Errorf("GuildFeedback after forgetting bob = %+v, %v", got, err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	s := openTestStore(t)
+
+	if got, err := s.Session("shared:gemini"); err != nil || got != nil {
+		t.Errorf("Session before saving = %q, %v", got, err)
+	}
+	if err := s.SaveSession("shared:gemini", []byte("one"), 0); err != nil {
+		t.Fatalf("SaveSession: %v", err)
+	}
+	if err := s.SaveSession("shared:gemini", []byte("two"), time.Hour); err != nil {
+		t.Fatalf("SaveSession: %v", err)
+	}
+	if got, err := s.Session("shared:gemini"); err != nil || string(got) != "two" {
+		t.Errorf("Session = %q, %v, want the latest history", got, err)
+	}
+	if err := s.SaveSession("thread:2", []byte("short"), time.Millisecond); err != nil {
+		t.Fatalf("SaveSession: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if got, err := s.Session("thread:2"); err != nil || got != nil {
+		t.Errorf("Session after it expired = %q, %v", got, err)
+	}
+
+	if err := s.DeleteSession("shared:gemini"); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+	if got, err := s.Session("shared:gemini"); err != nil || got != nil {
+		t.Errorf("Session after deleting it = %q, %v", got, err)
+	}
+}
+
+func TestGuildScripts(t *testing.T) {
+	s := openTestStore(t)
+
+	if g, err := s.GuildScript("guild"); err != nil || g != nil {
+		t.Errorf("GuildScript before uploading = %+v, %v", g, err)
+	}
+	script := GuildScript{GuildID: "guild", Source: "def after_response(text): return text", UpdatedAt: time.UnixMilli(1700000000000)}
+	if err := s.SetGuildScript(script); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GuildScript("guild"); err != nil || got == nil || got.Source != script.Source || !got.UpdatedAt.Equal(script.UpdatedAt) {
+		t.Errorf("GuildScript = %+v, %v, want %+v", got, err, script)
+	}
+	if deleted, err := s.DeleteGuildScript("guild"); err != nil || !deleted {
+		t.Errorf("DeleteGuildScript = %v, %v", deleted, err)
+	}
+	if deleted, err := s.DeleteGuildScript("guild"); err != nil || deleted {
+		t.Errorf("DeleteGuildScript again = %v, %v, want nothing deleted", deleted, err)
+	}
+}
+
+// fakeRedis returns a client of a server answering each command with the
+// next reply, and the commands it receives
+func fakeRedis(t *testing.T, replies ...string) (*Redis, chan []any) {
+	client, server := net.Pipe()
+	r := &Redis{prefix: "bot:", slots: make(chan struct{}, redisMaxConns), idle: []*redisConn{{Conn: client, reader: bufio.NewReader(client)}}}
+	t.Cleanup(func() { r.Close() })
+
+	commands := make(chan []any, len(replies))
+	go func() {
+		reader := bufio.NewReader(server)
+		for _, reply := range replies {
+			command, err := readReply(reader)
+			if err != nil {
+				return
+			}
+			commands <- command.([]any)
+			server.Write([]byte(reply))
+		}
+	}()
+	return r, commands
+}
+
+func TestRedisProtocol(t *testing.T) {
+	r, commands := fakeRedis(t, "$-1\r\n", "*4\r\n$5\r\nfield\r\n$5\r\nvalue\r\n$3\r\nnum\r\n$1\r\n1\r\n", "-ERR unknown command\r\n",
+		"*3\r\n+OK\r\n-ERR wrong type\r\n:1\r\n", ":2\r\n")
+
+	if got, err := r.Session("missing"); err != nil || got != nil {
+		t.Errorf("Session = %q, %v, want nil for a missing key", got, err)
+	}
+	if command := <-commands; string(command[0].([]byte)) != "GET" || string(command[1].([]byte)) != "bot:session:missing" {
+		t.Errorf("command = %q, want GET of the session", command)
+	}
+	reply, err := r.do("HGETALL", "hash")
+	if want := map[string]string{"field": "value", "num": "1"}; err != nil || !reflect.DeepEqual(redisHash(reply), want) {
+		t.Errorf("HGETALL = %v, %v, want %v", redisHash(reply), err, want)
+	}
+	if _, err := r.do("NOPE"); err == nil || err.Error() != "redis: ERR unknown command" {
+		t.Errorf("error = %v, want the error reply", err)
+	}
+	// The rest of an array is read after an error in it
+	if _, err := r.do("EXEC"); err == nil || err.Error() != "redis: ERR wrong type" {
+		t.Errorf("error = %v, want the error reply in the array", err)
+	}
+	if len(r.idle) != 1 {
+		t.Error("connection closed after an error reply")
+	}
+	if removed, err := r.DeleteMemory("alice", 7); err != nil || !removed {
+		t.Errorf("DeleteMemory = %v, %v", removed, err)
+	}
+}
+
+func TestRedisLocks(t *testing.T) {
+	r, commands := fakeRedis(t, "+OK\r\n", "$-1\r\n", ":1\r\n", ":1\r\n")
+
+	token, err := r.LockSession("thread:1", time.Minute)
+	if err != nil || token == "" {
+		t.Fatalf("LockSession = %q, %v, want a token", token, err)
+	}
+	command := <-commands
+	if got := fmt.Sprintf("%s", command); got != "[SET bot:lock:thread:1 "+token+" NX PX 60000]" {
+		t.Errorf("command = %s, want SET NX with the TTL", got)
+	}
+	if held, err := r.LockSession("thread:1", time.Minute); err != nil || held != "" {
+		t.Errorf("LockSession = %q, %v, want none while it's held", held, err)
+	}
+	<-commands
+	if held, err := r.RefreshSession("thread:1", token, time.Minute); err != nil || !held {
+		t.Errorf("RefreshSession = %v, %v, want the lock still held", held, err)
+	}
+	if command := <-commands; fmt.Sprintf("%s", command[3:]) != "[bot:lock:thread:1 "+token+" 60000]" {
+		t.Errorf("command = %s, want the refresh script with the token and TTL", command)
+	}
+	if err := r.UnlockSession("thread:1", token); err != nil {
+		t.Fatal(err)
+	}
+	if command := <-commands; string(command[0].([]byte)) != "EVAL" || string(command[4].([]byte)) != token {
+		t.Errorf("command = %q, want the unlock script with the token", command)
+	}
+}
+
+func TestRedisUsage(t *testing.T) {
+	r, commands := fakeRedis(t, ":0\r\n", "*3\r\n:2\r\n:30\r\n:12\r\n")
+
+	at := time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC)
+	if err := r.RecordUsage("alice", "guild", at, 15, 6); err != nil {
+		t.Fatal(err)
+	}
+	command := <-commands
+	if got := fmt.Sprintf("%s", command[3:11]); got != "[bot:usage:2024-05-31 bot:usage_days bot:usage:2024-05-31:user:alice bot:usage:2024-05-31:guild:guild bot:usage:2024-05-31:total "+
+		"bot:usage:2024-05:user:alice bot:usage:2024-05:guild:guild bot:usage:2024-05:total]" {
+		t.Errorf("keys = %s, want the day's usage and the counters of the day and month", got)
+	}
+
+	// This month's usage is read from its counter at once
+	now := time.Now().UTC()
+	usage, err := r.GuildUsage("guild", time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC))
+	if want := (Usage{Requests: 2, PromptTokens: 30, ResponseTokens: 12}); err != nil || usage != want {
+		t.Errorf("GuildUsage = %+v, %v, want %+v", usage, err, want)
+	}
+	command = <-commands
+	if got := fmt.Sprintf("%s", command[2:]); got != "[1 bot:usage:"+usageMonth(now)+":guild:guild]" {
+		t.Errorf("keys = %s, want the month's counter", got)
+	}
+}
+
+func TestUsagePeriods(t *testing.T) {
+	now := time.Date(2024, 6, 2, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		since time.Time
+		want  []string
+	}{
+		{now, []string{"2024-06-02"}},
+		{time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), []string{"2024-06"}},
+		{time.Date(2024, 5, 30, 18, 0, 0, 0, time.UTC), []string{"2024-05-30", "2024-05-31", "2024-06"}},
+		{time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), []string{"2024-04", "2024-05", "2024-06"}},
+		{now.Add(24 * time.Hour), nil},
+	}
+	for _, test := range tests {
+		if got := usagePeriods(test.since, now); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("usagePeriods(%v) = %v, want %v", test.since, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package store
+
+import "time"
+
+// Usage totals the model requests and tokens of a user or guild
+type Usage struct {
+	Requests       int
+	PromptTokens   int
+	ResponseTokens int
+}
+
+// Tokens returns the prompt and response tokens together
+func (u Usage) Tokens() int {
+	return u.PromptTokens + u.ResponseTokens
+}
+
+// UsageDay is a user's usage on one day in one guild
+type UsageDay struct {
+	Day     string
+	GuildID string
+	Usage
+}
+
+// usageDay returns the day a usage row is counted under (UTC)
+func usageDay(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// RecordUsage adds a model request and its tokens to a user's usage for the
+// day of at; guildID is empty for direct messages
+func (s *Store) RecordUsage(userID string, guildID string, at time.Time, promptTokens int, responseTokens int) error {
+	_, err := s.db.Exec(`INSERT INTO usage (day, user_id, guild_id, requests, prompt_tokens, response_tokens)
+		VALUES (?, ?, ?, 1, ?, ?)
+		ON CONFLICT (day, user_id, guild_id) DO UPDATE SET
+			requests = requests + 1,
+			prompt_tokens = prompt_tokens + excluded.prompt_tokens,
+			response_tokens = response_tokens + excluded.response_tokens`,
+		usageDay(at), userID, guildID, promptTokens, responseTokens)
+	return err
+}
+
+// UserUsage returns a user's usage across all guilds from the day of since onwards
+func (s *Store) UserUsage(userID string, since time.Time) (Usage, error) {
+	var u Usage
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(requests), 0), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(response_tokens), 0)
+		FROM usage WHERE user_id = ? AND day >= ?`, userID, usageDay(since)).Scan(&u.Requests, &u.PromptTokens, &u.ResponseTokens)
+	return u, err
+}
+
+// GuildUsage returns a guild's usage from the day of since onwards
+func (s *Store) GuildUsage(guildID string, since time.Time) (Usage, error) {
+	var u Usage
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(requests), 0), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(response_tokens), 0)
+		FROM usage WHERE guild_id = ? AND day >= ?`, guildID, usageDay(since)).Scan(&u.Requests, &u.PromptTokens, &u.ResponseTokens)
+	return u, err
+}
+
+// TotalUsage returns everyone's usage from the day of since onwards
+func (s *Store) TotalUsage(since time.Time) (Usage, error) {
+	var u Usage
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(requests), 0), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(response_tokens), 0)
+		FROM usage WHERE day >= ?`, usageDay(since)).Scan(&u.Requests, &u.PromptTokens, &u.ResponseTokens)
+	return u, err
+}
+
+// UsageDays returns a user's usage by day and guild, oldest first
+func (s *Store) UsageDays(userID string) ([]UsageDay, error) {
+	rows, err := s.db.Query(`SELECT day, guild_id, requests, prompt_tokens, response_tokens
+		FROM usage WHERE user_id = ? ORDER BY day, guild_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []UsageDay
+	for rows.Next() {
+		var u UsageDay
+		if err := rows.Scan(&u.Day, &u.GuildID, &u.Requests, &u.PromptTokens, &u.ResponseTokens); err != nil {
+			return nil, err
+		}
+		days = append(days, u)
+	}
+	return days, rows.Err()
+}
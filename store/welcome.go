@@ -0,0 +1,53 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// WelcomeSettings configure the welcome messages a guild's new members get
+type WelcomeSettings struct {
+	GuildID string
+	// Channel welcomes are posted in, empty to DM them
+	ChannelID string
+	// Description and rules of the server, given to the model
+	About string
+	// How the welcome should be written, empty for the default
+	Template string
+	Enabled  bool
+}
+
+// SetWelcomeSettings saves a guild's welcome settings, replacing earlier ones
+func (s *Store) SetWelcomeSettings(w WelcomeSettings) error {
+	_, err := s.db.Exec(`INSERT INTO welcome_settings (guild_id, channel_id, about, template, enabled) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (guild_id) DO UPDATE SET channel_id = excluded.channel_id, about = excluded.about,
+			template = excluded.template, enabled = excluded.enabled`,
+		w.GuildID, w.ChannelID, w.About, w.Template, w.Enabled)
+	return err
+}
+
+// WelcomeSettings returns a guild's welcome settings, or nil when they were
+// never set up
+func (s *Store) WelcomeSettings(guildID string) (*WelcomeSettings, error) {
+	w := WelcomeSettings{GuildID: guildID}
+	err := s.db.QueryRow(`SELECT channel_id, about, template, enabled FROM welcome_settings WHERE guild_id = ?`, guildID).
+		Scan(&w.ChannelID, &w.About, &w.Template, &w.Enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// SetWelcomeEnabled turns a guild's welcome messages on or off, keeping its
+// settings. It reports whether the guild has any.
+func (s *Store) SetWelcomeEnabled(guildID string, enabled bool) (bool, error) {
+	result, err := s.db.Exec(`UPDATE welcome_settings SET enabled = ? WHERE guild_id = ?`, enabled, guildID)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}